@@ -0,0 +1,183 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zip
+
+// This file implements decryption of files encrypted with WinZip AES,
+// as specified in the WinZip "AES Encryption Information: Encryption
+// Specification AE-1 and AE-2" document.
+//
+// The data of an encrypted file is laid out as follows:
+//
+//	salt (8, 12 or 16 bytes)
+//	password verification value (2 bytes)
+//	encrypted data
+//	authentication code (10 bytes)
+//
+// Keys are derived from the password and the salt with PBKDF2-HMAC-SHA1,
+// the data is encrypted with AES in counter mode, and the authentication
+// code is the truncated HMAC-SHA1 of the encrypted data.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"hash"
+	"io"
+)
+
+const (
+	aesMethod         = 99 // compression method of WinZip AES encrypted files
+	aesVendorID       = 0x4541
+	aesVerifierLen    = 2
+	aesMACLen         = 10
+	aesKeyIterations  = 1000
+	aesExtraFieldSize = 7
+)
+
+// A PasswordFunc returns the password of the encrypted file f.
+// It may be called concurrently for different files.
+type PasswordFunc func(f *File) (password string, err error)
+
+// aesReader decrypts and authenticates the data of a WinZip AES encrypted
+// file.
+type aesReader struct {
+	data    *io.SectionReader // encrypted data
+	mac     hash.Hash
+	wantMAC *io.SectionReader // authentication code
+	stream  cipher.Stream
+}
+
+// newAESReader returns an aesReader for the encrypted data of f, which is
+// read from r.
+func (f *File) newAESReader(r *io.SectionReader) (*aesReader, error) {
+	if f.Method != aesMethod || f.aesVersion == 0 || f.zip.password == nil {
+		return nil, ErrEncrypted
+	}
+	if f.aesStrength < 1 || f.aesStrength > 3 {
+		return nil, ErrEncrypted
+	}
+	keyLen := 8 * (int(f.aesStrength) + 1)
+	saltLen := keyLen / 2
+	if r.Size() < int64(saltLen+aesVerifierLen+aesMACLen) {
+		return nil, ErrFormat
+	}
+
+	password, err := f.zip.password(f)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, saltLen+aesVerifierLen)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	salt, verifier := header[:saltLen], header[saltLen:]
+
+	keys := pbkdf2SHA1([]byte(password), salt, aesKeyIterations, 2*keyLen+aesVerifierLen)
+	if !hmac.Equal(keys[2*keyLen:], verifier) {
+		return nil, ErrPassword
+	}
+	block, err := aes.NewCipher(keys[:keyLen])
+	if err != nil {
+		return nil, err
+	}
+
+	dataLen := r.Size() - int64(len(header)) - aesMACLen
+	return &aesReader{
+		data:    io.NewSectionReader(r, int64(len(header)), dataLen),
+		mac:     hmac.New(sha1.New, keys[keyLen:2*keyLen]),
+		wantMAC: io.NewSectionReader(r, int64(len(header))+dataLen, aesMACLen),
+		stream:  &aesCTR{block: block, used: aes.BlockSize},
+	}, nil
+}
+
+func (r *aesReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	r.mac.Write(p[:n])
+	r.stream.XORKeyStream(p[:n], p[:n])
+	return n, err
+}
+
+// verify checks the authentication code of the encrypted data, reading any
+// data that the decompressor didn't consume.
+func (r *aesReader) verify() error {
+	if _, err := io.Copy(r.mac, r.data); err != nil {
+		return err
+	}
+	want := make([]byte, aesMACLen)
+	if _, err := io.ReadFull(r.wantMAC, want); err != nil {
+		return err
+	}
+	if !hmac.Equal(r.mac.Sum(nil)[:aesMACLen], want) {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// aesCTR is AES in counter mode with a little-endian counter starting at 1,
+// as used by WinZip AES. It's not compatible with cipher.NewCTR, which
+// increments the counter as a big-endian number.
+type aesCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int // number of bytes of stream already used
+}
+
+func (c *aesCTR) XORKeyStream(dst, src []byte) {
+	for len(src) > 0 {
+		if c.used == len(c.stream) {
+			for i := range c.counter {
+				c.counter[i]++
+				if c.counter[i] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.used = 0
+		}
+		n := len(c.stream) - c.used
+		if n > len(src) {
+			n = len(src)
+		}
+		for i, b := range c.stream[c.used : c.used+n] {
+			dst[i] = src[i] ^ b
+		}
+		c.used += n
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// pbkdf2SHA1 derives a key of keyLen bytes from password and salt using
+// PBKDF2 with HMAC-SHA1, as specified in RFC 8018, Section 5.2.
+func pbkdf2SHA1(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
@@ -0,0 +1,165 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zip
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrInsecurePath is returned by Extract for file names that refer to a
+// location outside of the destination directory, or that aren't valid
+// local file names on the current system.
+var ErrInsecurePath = errors.New("zip: insecure file path")
+
+// Extract writes the regular files and directories of fsys to the directory
+// dir, creating dir if needed. fsys is typically a *Reader.
+//
+// Extract never writes outside of dir. If fsys is a *Reader, Extract returns
+// ErrInsecurePath before writing anything if the archive contains a name
+// that is absolute or that escapes the archive root, such as "../file".
+// Names that are not valid local file names, such as "a:b" on Windows, are
+// also rejected. Extract returns an error for symbolic links and other
+// special files in fsys, and it doesn't follow symbolic links already present
+// in dir. Existing files are not overwritten.
+//
+// Files are created with the permission bits of their mode in fsys, before
+// umask, and keep their modification time. Directories are created with
+// mode 0777, before umask.
+func Extract(dir string, fsys fs.FS) error {
+	if r, ok := fsys.(*Reader); ok {
+		for _, f := range r.File {
+			if !isLocalName(f.Name) {
+				return &fs.PathError{Op: "extract", Path: f.Name, Err: ErrInsecurePath}
+			}
+		}
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		local, err := localPath(name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, local)
+		switch d.Type() {
+		case fs.ModeDir:
+			return extractDir(target)
+		case 0:
+			return extractFile(target, fsys, name)
+		}
+		return &fs.PathError{Op: "extract", Path: name, Err: errors.New("not a regular file or directory")}
+	})
+}
+
+// extractDir creates the directory target, unless it already exists. Because
+// fs.WalkDir visits directories before their contents, checking that target
+// isn't a symbolic link ensures that nothing is extracted through one.
+func extractDir(target string) error {
+	err := os.Mkdir(target, 0777)
+	if err == nil || !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	fi, lerr := os.Lstat(target)
+	if lerr != nil {
+		return lerr
+	}
+	if !fi.IsDir() {
+		return err
+	}
+	return nil
+}
+
+// extractFile writes the contents of the file name in fsys to target, which
+// must not exist.
+func extractFile(target string, fsys fs.FS, name string) error {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	// O_EXCL ensures that target isn't an existing file or symbolic link.
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if mtime := fi.ModTime(); !mtime.IsZero() {
+		return os.Chtimes(target, mtime, mtime)
+	}
+	return nil
+}
+
+// isLocalName reports whether name, a file name in a zip archive, stays
+// within the archive root. Backslashes are treated as separators, as by
+// Reader.Open.
+func isLocalName(name string) bool {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") || len(name) >= 2 && name[1] == ':' {
+		return false
+	}
+	p := path.Clean(name)
+	return p != ".." && !strings.HasPrefix(p, "../")
+}
+
+// localPath converts name, a valid fs.FS path, to a relative path on the
+// current system.
+func localPath(name string) (string, error) {
+	if runtime.GOOS == "windows" {
+		if strings.ContainsAny(name, `\:`) {
+			return "", &fs.PathError{Op: "extract", Path: name, Err: ErrInsecurePath}
+		}
+		for _, elem := range strings.Split(name, "/") {
+			if isReservedWindowsName(elem) {
+				return "", &fs.PathError{Op: "extract", Path: name, Err: ErrInsecurePath}
+			}
+		}
+	}
+	return filepath.FromSlash(name), nil
+}
+
+// isReservedWindowsName reports whether elem is a reserved device name on
+// Windows, such as "NUL" or "com1.txt".
+func isReservedWindowsName(elem string) bool {
+	if i := strings.IndexByte(elem, '.'); i >= 0 {
+		elem = elem[:i]
+	}
+	elem = strings.TrimRight(elem, " ")
+	switch strings.ToUpper(elem) {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	if len(elem) == 4 {
+		switch strings.ToUpper(elem[:3]) {
+		case "COM", "LPT":
+			return '1' <= elem[3] && elem[3] <= '9'
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zip
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// newTestReader returns a Reader of an archive with the given files.
+func newTestReader(t *testing.T, files map[string]string) *Reader {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestExtract(t *testing.T) {
+	r := newTestReader(t, map[string]string{
+		"a/b/c.txt": "c",
+		"a/d.txt":   "d",
+		"e/":        "",
+		"f.txt":     "f",
+	})
+	dir := t.TempDir()
+	if err := Extract(dir, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WalkDir(r, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		want, err := fs.ReadFile(r, name)
+		if err != nil {
+			return err
+		}
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "e")); err != nil || !fi.IsDir() {
+		t.Errorf("empty directory was not extracted: %v", err)
+	}
+
+	// Existing files are not overwritten.
+	if err := Extract(dir, r); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("extracting twice: got error %v, want fs.ErrExist", err)
+	}
+}
+
+func TestExtractMode(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skipf("file modes are not fully supported on %s", runtime.GOOS)
+	}
+	mtime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"bin/tool":   {Data: []byte("#!/bin/sh\n"), Mode: 0755, ModTime: mtime},
+		"bin/readme": {Data: []byte("read only\n"), Mode: 0444 | fs.ModeSetuid, ModTime: mtime},
+	}
+	dir := t.TempDir()
+	if err := Extract(dir, fsys); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]fs.FileMode{"bin/tool": 0755, "bin/readme": 0444} {
+		fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode()&^0022 != want&^0022 {
+			t.Errorf("%s: mode %v, want %v", name, fi.Mode(), want)
+		}
+		if !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s: modification time %v, want %v", name, fi.ModTime(), mtime)
+		}
+	}
+}
+
+func TestExtractInsecurePath(t *testing.T) {
+	for _, name := range []string{
+		"../escape",
+		"a/../../escape",
+		`..\escape`,
+		"/abs",
+		"C:/windows",
+	} {
+		dir := t.TempDir()
+		r := newTestReader(t, map[string]string{"ok": "ok", name: "escape"})
+		if err := Extract(filepath.Join(dir, "out"), r); !errors.Is(err, ErrInsecurePath) {
+			t.Errorf("%q: got error %v, want ErrInsecurePath", name, err)
+		}
+		// Nothing is written.
+		if _, err := os.Stat(filepath.Join(dir, "out")); err == nil {
+			t.Errorf("%q: destination directory was created", name)
+		}
+	}
+
+	// Names that only look suspicious are allowed.
+	r := newTestReader(t, map[string]string{"a/../b": "b", "..c": "c"})
+	if err := Extract(t.TempDir(), r); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExtractSymlink(t *testing.T) {
+	r, err := OpenReader("testdata/symlink.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := Extract(t.TempDir(), r); err == nil {
+		t.Error("extracting a symbolic link succeeded")
+	}
+}
+
+func TestExtractThroughSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skipf("symbolic links are not supported on %s", runtime.GOOS)
+	}
+	dir, outside := t.TempDir(), t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "target"), filepath.Join(dir, "file")); err != nil {
+		t.Fatal(err)
+	}
+	for name, fsys := range map[string]fstest.MapFS{
+		"directory": {"link/escape": {Data: []byte("escape")}},
+		"file":      {"file": {Data: []byte("escape")}},
+	} {
+		if err := Extract(dir, fsys); err == nil {
+			t.Errorf("%s: extracting through a symbolic link succeeded", name)
+		}
+	}
+	if entries, err := os.ReadDir(outside); err != nil || len(entries) != 0 {
+		t.Errorf("files were written outside the destination: %v, %v", entries, err)
+	}
+}
+
+func TestIsReservedWindowsName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"NUL":      true,
+		"nul.txt":  true,
+		"COM1":     true,
+		"lpt9.log": true,
+		"CON .txt": true,
+		"COM0":     false,
+		"console":  false,
+		"null":     false,
+		"file.txt": false,
+	} {
+		if got := isReservedWindowsName(name); got != want {
+			t.Errorf("isReservedWindowsName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -24,6 +24,8 @@ var (
 	ErrFormat    = errors.New("zip: not a valid zip file")
 	ErrAlgorithm = errors.New("zip: unsupported compression algorithm")
 	ErrChecksum  = errors.New("zip: checksum error")
+	ErrEncrypted = errors.New("zip: encrypted file without a password or with unsupported encryption")
+	ErrPassword  = errors.New("zip: incorrect password")
 )
 
 // A Reader serves content from a ZIP archive.
@@ -32,6 +34,7 @@ type Reader struct {
 	File          []*File
 	Comment       string
 	decompressors map[uint16]Decompressor
+	password      PasswordFunc
 
 	// fileList is a list of files sorted by ename,
 	// for use by the Open method.
@@ -55,6 +58,11 @@ type File struct {
 	headerOffset int64
 	zip64        bool  // zip64 extended information extra field presence
 	descErr      error // error reading the data descriptor during init
+
+	// WinZip AES extra field, if aesVersion is non-zero.
+	aesVersion  uint16 // 1 for AE-1, 2 for AE-2
+	aesStrength uint8  // 1, 2 or 3 for AES-128, AES-192 or AES-256
+	aesMethod   uint16 // compression method of the decrypted data
 }
 
 // OpenReader will open the Zip file specified by name and return a ReadCloser.
@@ -154,6 +162,18 @@ func (z *Reader) decompressor(method uint16) Decompressor {
 	return dcomp
 }
 
+// SetPasswordFunc sets the function that returns the password of encrypted
+// files. Files encrypted with WinZip AES (AE-1 or AE-2) are transparently
+// decrypted and authenticated by File.Open once a PasswordFunc is set.
+//
+// Without a PasswordFunc, or for files using other encryption methods,
+// File.Open returns ErrEncrypted. If the password is wrong, it returns
+// ErrPassword, and if the contents fail authentication, reading them
+// returns ErrChecksum.
+func (z *Reader) SetPasswordFunc(fn PasswordFunc) {
+	z.password = fn
+}
+
 // Close closes the Zip file, rendering it unusable for I/O.
 func (rc *ReadCloser) Close() error {
 	return rc.f.Close()
@@ -174,6 +194,9 @@ func (f *File) DataOffset() (offset int64, err error) {
 
 // Open returns a ReadCloser that provides access to the File's contents.
 // Multiple files may be read concurrently.
+//
+// Encrypted files can only be opened if the Reader has a PasswordFunc;
+// see Reader.SetPasswordFunc.
 func (f *File) Open() (io.ReadCloser, error) {
 	bodyOffset, err := f.findBodyOffset()
 	if err != nil {
@@ -181,15 +204,27 @@ func (f *File) Open() (io.ReadCloser, error) {
 	}
 	size := int64(f.CompressedSize64)
 	r := io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, size)
-	dcomp := f.zip.decompressor(f.Method)
+	var (
+		body   io.Reader = r
+		method           = f.Method
+		auth   *aesReader
+	)
+	if f.Flags&0x1 != 0 {
+		if auth, err = f.newAESReader(r); err != nil {
+			return nil, err
+		}
+		body, method = auth, f.aesMethod
+	}
+	dcomp := f.zip.decompressor(method)
 	if dcomp == nil {
 		return nil, ErrAlgorithm
 	}
-	var rc io.ReadCloser = dcomp(r)
+	var rc io.ReadCloser = dcomp(body)
 	rc = &checksumReader{
 		rc:   rc,
 		hash: crc32.NewIEEE(),
 		f:    f,
+		auth: auth,
 	}
 	return rc, nil
 }
@@ -247,7 +282,8 @@ type checksumReader struct {
 	hash  hash.Hash32
 	nread uint64 // number of bytes read so far
 	f     *File
-	err   error // sticky error
+	auth  *aesReader // authenticates the data of encrypted files
+	err   error      // sticky error
 }
 
 func (r *checksumReader) Stat() (fs.FileInfo, error) {
@@ -268,6 +304,18 @@ func (r *checksumReader) Read(b []byte) (n int, err error) {
 		if r.nread != r.f.UncompressedSize64 {
 			return 0, io.ErrUnexpectedEOF
 		}
+		if r.auth != nil {
+			if authErr := r.auth.verify(); authErr != nil {
+				r.err = authErr
+				return n, authErr
+			}
+			if r.f.aesVersion == 2 {
+				// AE-2 files store no CRC-32; the authentication
+				// code protects their contents instead.
+				r.err = err
+				return
+			}
+		}
 		if r.f.hasDataDescriptor() {
 			if r.f.descErr != nil {
 				if r.f.descErr == io.EOF {
@@ -447,6 +495,17 @@ parseExtras:
 			}
 			ts := int64(fieldBuf.uint32()) // ModTime since Unix epoch
 			modified = time.Unix(ts, 0)
+		case aesExtraID:
+			if len(fieldBuf) < aesExtraFieldSize {
+				continue parseExtras
+			}
+			version := fieldBuf.uint16()
+			if fieldBuf.uint16() != aesVendorID {
+				continue parseExtras
+			}
+			f.aesVersion = version
+			f.aesStrength = fieldBuf.uint8()
+			f.aesMethod = fieldBuf.uint16()
 		}
 	}
 
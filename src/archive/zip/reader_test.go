@@ -1402,3 +1402,103 @@ func TestCVE202139293(t *testing.T) {
 		t.Fatalf("unexpected error, got: %v, want: %v", err, ErrFormat)
 	}
 }
+
+func TestWinZipAES(t *testing.T) {
+	password := func(f *File) (string, error) { return "gopher", nil }
+	read := func(data []byte, password PasswordFunc) ([]byte, error) {
+		r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if password != nil {
+			r.SetPasswordFunc(password)
+		}
+		rc, err := r.File[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		content string
+	}{
+		{"winzip-aes128.zip", "This is an AES-128 encrypted file.\n"},
+		{"winzip-aes256.zip", "This is an AES-256 encrypted file.\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := read(data, password)
+			if err != nil || string(got) != tt.content {
+				t.Errorf("got %q, %v; want %q", got, err, tt.content)
+			}
+			if _, err := read(data, nil); err != ErrEncrypted {
+				t.Errorf("without a password: got error %v, want ErrEncrypted", err)
+			}
+			wrong := func(f *File) (string, error) { return "wrong", nil }
+			if _, err := read(data, wrong); err != ErrPassword {
+				t.Errorf("with a wrong password: got error %v, want ErrPassword", err)
+			}
+
+			// These archives use AE-1, which also stores a CRC-32. After
+			// corrupting it, the archive is still valid as AE-2.
+			dd := bytes.Index(data, []byte("PK\x07\x08"))
+			if dd < 0 {
+				t.Fatal("missing data descriptor")
+			}
+			badCRC := append([]byte{}, data...)
+			badCRC[dd+4] ^= 0xff
+			if _, err := read(badCRC, password); err != ErrChecksum {
+				t.Errorf("AE-1 with a wrong CRC-32: got error %v, want ErrChecksum", err)
+			}
+			ae2 := bytes.ReplaceAll(badCRC, []byte("\x01\x99\x07\x00\x01\x00AE"), []byte("\x01\x99\x07\x00\x02\x00AE"))
+			if got, err := read(ae2, password); err != nil || string(got) != tt.content {
+				t.Errorf("AE-2: got %q, %v; want %q", got, err, tt.content)
+			}
+		})
+	}
+
+	// Tampering with the encrypted data of the stored file is detected by
+	// the authentication code.
+	data, err := os.ReadFile("testdata/winzip-aes128.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	off, err := r.File[0].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[off+8+aesVerifierLen] ^= 1
+	if _, err := read(data, password); err != ErrChecksum {
+		t.Errorf("tampered data: got error %v, want ErrChecksum", err)
+	}
+}
+
+func TestPBKDF2SHA1(t *testing.T) {
+	// Test vectors from RFC 6070.
+	for _, tt := range []struct {
+		password, salt string
+		iter, keyLen   int
+		want           string
+	}{
+		{"password", "salt", 1, 20, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"password", "salt", 2, 20, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{"password", "salt", 4096, 20, "4b007901b765489abead49d926f721d065a429c1"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 25,
+			"3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+	} {
+		got := pbkdf2SHA1([]byte(tt.password), []byte(tt.salt), tt.iter, tt.keyLen)
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("pbkdf2SHA1(%q, %q, %d, %d) = %x, want %s", tt.password, tt.salt, tt.iter, tt.keyLen, got, tt.want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package zip
 
 import (
 	"compress/flate"
+	"compress/zstd"
 	"errors"
 	"io"
 	"sync"
@@ -101,6 +102,48 @@ func (r *pooledFlateReader) Close() error {
 	return err
 }
 
+var zstdWriterPool sync.Pool
+
+func newZstdWriter(w io.Writer) (io.WriteCloser, error) {
+	zw, ok := zstdWriterPool.Get().(*zstd.Writer)
+	if ok {
+		zw.Reset(w)
+	} else {
+		zw = zstd.NewWriter(w)
+	}
+	return &pooledZstdWriter{zw: zw}, nil
+}
+
+type pooledZstdWriter struct {
+	mu sync.Mutex // guards Close and Write
+	zw *zstd.Writer
+}
+
+func (w *pooledZstdWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.zw == nil {
+		return 0, errors.New("Write after Close")
+	}
+	return w.zw.Write(p)
+}
+
+func (w *pooledZstdWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var err error
+	if w.zw != nil {
+		err = w.zw.Close()
+		zstdWriterPool.Put(w.zw)
+		w.zw = nil
+	}
+	return err
+}
+
+func newZstdReader(r io.Reader) io.ReadCloser {
+	return zstd.NewReader(r)
+}
+
 var (
 	compressors   sync.Map // map[uint16]Compressor
 	decompressors sync.Map // map[uint16]Decompressor
@@ -112,10 +155,17 @@ func init() {
 
 	decompressors.Store(Store, Decompressor(io.NopCloser))
 	decompressors.Store(Deflate, Decompressor(newFlateReader))
+
+	// Zstd is not stored here but provided as a fallback by compressor
+	// and decompressor, so that programs registering their own Zstd
+	// implementation, as was required before it was built in, keep
+	// working.
 }
 
 // RegisterDecompressor allows custom decompressors for a specified method ID.
 // The common methods Store and Deflate are built in.
+// Zstd is built in as well, but a custom decompressor may be registered
+// for it, in which case that one is used instead.
 func RegisterDecompressor(method uint16, dcomp Decompressor) {
 	if _, dup := decompressors.LoadOrStore(method, dcomp); dup {
 		panic("decompressor already registered")
@@ -124,6 +174,8 @@ func RegisterDecompressor(method uint16, dcomp Decompressor) {
 
 // RegisterCompressor registers custom compressors for a specified method ID.
 // The common methods Store and Deflate are built in.
+// Zstd is built in as well, but a custom compressor may be registered
+// for it, in which case that one is used instead.
 func RegisterCompressor(method uint16, comp Compressor) {
 	if _, dup := compressors.LoadOrStore(method, comp); dup {
 		panic("compressor already registered")
@@ -133,6 +185,9 @@ func RegisterCompressor(method uint16, comp Compressor) {
 func compressor(method uint16) Compressor {
 	ci, ok := compressors.Load(method)
 	if !ok {
+		if method == Zstd {
+			return newZstdWriter
+		}
 		return nil
 	}
 	return ci.(Compressor)
@@ -141,6 +196,9 @@ func compressor(method uint16) Compressor {
 func decompressor(method uint16) Decompressor {
 	di, ok := decompressors.Load(method)
 	if !ok {
+		if method == Zstd {
+			return newZstdReader
+		}
 		return nil
 	}
 	return di.(Decompressor)
@@ -6,18 +6,21 @@ package zip
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"hash"
 	"hash/crc32"
 	"io"
 	"strings"
+	"sync"
 	"unicode/utf8"
 )
 
 var (
 	errLongName  = errors.New("zip: FileHeader.Name too long")
 	errLongExtra = errors.New("zip: FileHeader.Extra too long")
+	errPending   = errors.New("zip: parallel file not closed")
 )
 
 // Writer implements a zip file writer.
@@ -29,6 +32,10 @@ type Writer struct {
 	compressors map[uint16]Compressor
 	comment     string
 
+	// mu guards pending and the output of parallel files.
+	mu      sync.Mutex
+	pending []*parallelFile // parallel files not yet complete, in order
+
 	// testHookCloseSizeOffset if non-nil is called with the size
 	// of offset of the central directory at Close.
 	testHookCloseSizeOffset func(size, offset uint64)
@@ -59,6 +66,8 @@ func (w *Writer) SetOffset(n int64) {
 // Flush flushes any buffered data to the underlying writer.
 // Calling Flush is not normally necessary; calling Close is sufficient.
 func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	return w.cw.w.(*bufio.Writer).Flush()
 }
 
@@ -84,6 +93,9 @@ func (w *Writer) Close() error {
 	if w.closed {
 		return errors.New("zip: writer closed twice")
 	}
+	if w.hasPending() {
+		return errPending
+	}
 	w.closed = true
 
 	// write central directory
@@ -254,6 +266,9 @@ func (w *Writer) prepare(fh *FileHeader) error {
 			return err
 		}
 	}
+	if w.hasPending() {
+		return errPending
+	}
 	if len(w.dir) > 0 && w.dir[len(w.dir)-1].FileHeader == fh {
 		// See https://golang.org/issue/11144 confusion.
 		return errors.New("archive/zip: invalid duplicate FileHeader")
@@ -273,6 +288,40 @@ func (w *Writer) CreateHeader(fh *FileHeader) (io.Writer, error) {
 		return nil, err
 	}
 
+	initHeader(fh)
+
+	var (
+		ow io.Writer
+		fw *fileWriter
+	)
+	h := &header{
+		FileHeader: fh,
+		offset:     uint64(w.cw.count),
+	}
+
+	if strings.HasSuffix(fh.Name, "/") {
+		initDirHeader(fh)
+		ow = dirWriter{}
+	} else {
+		var err error
+		fw, err = w.newFileWriter(h, w.cw, w.cw)
+		if err != nil {
+			return nil, err
+		}
+		ow = fw
+	}
+	w.dir = append(w.dir, h)
+	if err := writeHeader(w.cw, h); err != nil {
+		return nil, err
+	}
+	// If we're creating a directory, fw is nil.
+	w.last = fw
+	return ow, nil
+}
+
+// initHeader sets the fields of fh that CreateHeader and CreateParallel
+// derive from the rest of the header.
+func initHeader(fh *FileHeader) {
 	// The ZIP format has a sad state of affairs regarding character encoding.
 	// Officially, the name and comment fields are supposed to be encoded
 	// in CP-437 (which is mostly compatible with ASCII), unless the UTF-8
@@ -328,59 +377,46 @@ func (w *Writer) CreateHeader(fh *FileHeader) (io.Writer, error) {
 		eb.uint32(mt) // ModTime
 		fh.Extra = append(fh.Extra, mbuf[:]...)
 	}
+}
 
-	var (
-		ow io.Writer
-		fw *fileWriter
-	)
-	h := &header{
-		FileHeader: fh,
-		offset:     uint64(w.cw.count),
-	}
-
-	if strings.HasSuffix(fh.Name, "/") {
-		// Set the compression method to Store to ensure data length is truly zero,
-		// which the writeHeader method always encodes for the size fields.
-		// This is necessary as most compression formats have non-zero lengths
-		// even when compressing an empty string.
-		fh.Method = Store
-		fh.Flags &^= 0x8 // we will not write a data descriptor
-
-		// Explicitly clear sizes as they have no meaning for directories.
-		fh.CompressedSize = 0
-		fh.CompressedSize64 = 0
-		fh.UncompressedSize = 0
-		fh.UncompressedSize64 = 0
+// initDirHeader sets the fields of fh for a directory, which has no data.
+func initDirHeader(fh *FileHeader) {
+	// Set the compression method to Store to ensure data length is truly zero,
+	// which the writeHeader method always encodes for the size fields.
+	// This is necessary as most compression formats have non-zero lengths
+	// even when compressing an empty string.
+	fh.Method = Store
+	fh.Flags &^= 0x8 // we will not write a data descriptor
+
+	// Explicitly clear sizes as they have no meaning for directories.
+	fh.CompressedSize = 0
+	fh.CompressedSize64 = 0
+	fh.UncompressedSize = 0
+	fh.UncompressedSize64 = 0
+}
 
-		ow = dirWriter{}
-	} else {
-		fh.Flags |= 0x8 // we will write a data descriptor
+// newFileWriter returns a fileWriter for h that compresses data into compw
+// and writes the data descriptor to zipw.
+func (w *Writer) newFileWriter(h *header, zipw, compw io.Writer) (*fileWriter, error) {
+	h.Flags |= 0x8 // we will write a data descriptor
 
-		fw = &fileWriter{
-			zipw:      w.cw,
-			compCount: &countWriter{w: w.cw},
-			crc32:     crc32.NewIEEE(),
-		}
-		comp := w.compressor(fh.Method)
-		if comp == nil {
-			return nil, ErrAlgorithm
-		}
-		var err error
-		fw.comp, err = comp(fw.compCount)
-		if err != nil {
-			return nil, err
-		}
-		fw.rawCount = &countWriter{w: fw.comp}
-		fw.header = h
-		ow = fw
+	fw := &fileWriter{
+		header:    h,
+		zipw:      zipw,
+		compCount: &countWriter{w: compw},
+		crc32:     crc32.NewIEEE(),
 	}
-	w.dir = append(w.dir, h)
-	if err := writeHeader(w.cw, h); err != nil {
+	comp := w.compressor(h.Method)
+	if comp == nil {
+		return nil, ErrAlgorithm
+	}
+	var err error
+	fw.comp, err = comp(fw.compCount)
+	if err != nil {
 		return nil, err
 	}
-	// If we're creating a directory, fw is nil.
-	w.last = fw
-	return ow, nil
+	fw.rawCount = &countWriter{w: fw.comp}
+	return fw, nil
 }
 
 func writeHeader(w io.Writer, h *header) error {
@@ -470,6 +506,150 @@ func (w *Writer) CreateRaw(fh *FileHeader) (io.Writer, error) {
 	return fw, nil
 }
 
+// CreateParallel adds a file to the zip archive like CreateHeader, but the
+// returned WriteCloser can be written concurrently with other files added by
+// CreateParallel, so that the files are compressed in parallel. The file must
+// be closed once all of its contents have been written.
+//
+// Files are written to the archive in the order of the CreateParallel calls.
+// The data of the first file that isn't complete is streamed to the
+// underlying writer as it's compressed, so it may be of any size, while the
+// compressed data of the following files is buffered in memory until all the
+// files before them are closed.
+//
+// CreateParallel and the returned WriteCloser are safe for concurrent use,
+// but Create, CreateHeader, CreateRaw, Copy, and Close return an error
+// until all files added by CreateParallel are closed.
+func (w *Writer) CreateParallel(fh *FileHeader) (io.WriteCloser, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, errors.New("zip: CreateParallel after Close")
+	}
+	if w.last != nil && !w.last.closed {
+		if err := w.last.close(); err != nil {
+			return nil, err
+		}
+	}
+	initHeader(fh)
+	f := &parallelFile{
+		zw:     w,
+		header: &header{FileHeader: fh},
+	}
+	if strings.HasSuffix(fh.Name, "/") {
+		initDirHeader(fh)
+		f.done = true
+	} else {
+		fw, err := w.newFileWriter(f.header, parallelOutput{f, false}, parallelOutput{f, true})
+		if err != nil {
+			return nil, err
+		}
+		f.fw = fw
+	}
+	w.pending = append(w.pending, f)
+	if err := w.flushPending(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// hasPending reports whether there are parallel files that are not
+// complete yet.
+func (w *Writer) hasPending() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending) > 0
+}
+
+// flushPending writes the local header and buffered output of the first
+// pending file, and removes it from w.pending if it's complete, repeating
+// until the first pending file isn't complete. w.mu must be held.
+func (w *Writer) flushPending() error {
+	for len(w.pending) > 0 {
+		f := w.pending[0]
+		if !f.head {
+			f.head = true
+			f.header.offset = uint64(w.cw.count)
+			w.dir = append(w.dir, f.header)
+			if err := writeHeader(w.cw, f.header); err != nil {
+				return err
+			}
+			if _, err := f.buf.WriteTo(w.cw); err != nil {
+				return err
+			}
+			f.buf = bytes.Buffer{}
+		}
+		if !f.done {
+			return nil
+		}
+		w.pending[0] = nil
+		w.pending = w.pending[1:]
+	}
+	w.pending = nil
+	return nil
+}
+
+// A parallelFile is a file added by CreateParallel.
+type parallelFile struct {
+	zw     *Writer
+	header *header
+	fw     *fileWriter // nil for directories
+
+	// The following fields are guarded by zw.mu.
+	buf  bytes.Buffer // output held back until the file is first in zw.pending
+	head bool         // the local header was written and output goes to zw.cw
+	done bool         // all output was written
+}
+
+func (f *parallelFile) Write(p []byte) (int, error) {
+	if f.fw == nil {
+		return dirWriter{}.Write(p)
+	}
+	return f.fw.Write(p)
+}
+
+func (f *parallelFile) Close() error {
+	if f.fw == nil {
+		return nil
+	}
+	if f.fw.closed {
+		return errors.New("zip: file closed twice")
+	}
+	f.fw.closed = true
+	err := f.fw.comp.Close()
+
+	f.zw.mu.Lock()
+	defer f.zw.mu.Unlock()
+	if err == nil {
+		f.fw.updateHeader()
+		err = f.fw.writeDataDescriptor()
+	}
+	f.done = true
+	if flushErr := f.zw.flushPending(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// parallelOutput receives the compressed data and the data descriptor of a
+// parallel file. If lock is false, zw.mu must already be held.
+type parallelOutput struct {
+	f    *parallelFile
+	lock bool
+}
+
+func (o parallelOutput) Write(p []byte) (int, error) {
+	zw := o.f.zw
+	if o.lock {
+		zw.mu.Lock()
+		defer zw.mu.Unlock()
+	}
+	if o.f.head {
+		return zw.cw.Write(p)
+	}
+	return o.f.buf.Write(p)
+}
+
 // Copy copies the file f (obtained from a Reader) into w. It copies the raw
 // form directly bypassing decompression, compression, and validation.
 func (w *Writer) Copy(f *File) error {
@@ -544,8 +724,13 @@ func (w *fileWriter) close() error {
 	if err := w.comp.Close(); err != nil {
 		return err
 	}
+	w.updateHeader()
+	return w.writeDataDescriptor()
+}
 
-	// update FileHeader
+// updateHeader sets the checksum and sizes of the FileHeader once all
+// data has been written.
+func (w *fileWriter) updateHeader() {
 	fh := w.header.FileHeader
 	fh.CRC32 = w.crc32.Sum32()
 	fh.CompressedSize64 = uint64(w.compCount.count)
@@ -559,8 +744,6 @@ func (w *fileWriter) close() error {
 		fh.CompressedSize = uint32(fh.CompressedSize64)
 		fh.UncompressedSize = uint32(fh.UncompressedSize64)
 	}
-
-	return w.writeDataDescriptor()
 }
 
 func (w *fileWriter) writeDataDescriptor() error {
@@ -71,6 +71,12 @@ var writeTests = []WriteTest{
 		Method: Deflate,
 		Mode:   0755 | fs.ModeDevice | fs.ModeCharDevice,
 	},
+	{
+		Name:   "zstd",
+		Data:   []byte("Zstandard compressed, Zstandard compressed, Zstandard compressed."),
+		Method: Zstd,
+		Mode:   0644,
+	},
 }
 
 func TestWriter(t *testing.T) {
@@ -409,6 +415,101 @@ func TestWriterCopy(t *testing.T) {
 	}
 }
 
+func TestWriterCreateParallel(t *testing.T) {
+	const n = 20
+	contents := make([][]byte, n)
+	for i := range contents {
+		contents[i] = bytes.Repeat([]byte(fmt.Sprintf("file %d\n", i)), rand.Intn(50000))
+	}
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	if _, err := w.Create("first.txt"); err != nil {
+		t.Fatal(err)
+	}
+	writers := make([]io.WriteCloser, n)
+	for i := range writers {
+		fw, err := w.CreateParallel(&FileHeader{Name: fmt.Sprintf("%d.txt", i), Method: Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writers[i] = fw
+	}
+	dir, err := w.CreateParallel(&FileHeader{Name: "dir/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Create("early.txt"); err != errPending {
+		t.Errorf("Create with pending parallel files: got error %v, want errPending", err)
+	}
+	if err := w.Close(); err != errPending {
+		t.Errorf("Close with pending parallel files: got error %v, want errPending", err)
+	}
+
+	// Write the files in reverse order, concurrently.
+	errc := make(chan error, n)
+	for i := n - 1; i >= 0; i-- {
+		go func(i int) {
+			for data := contents[i]; len(data) > 0; {
+				chunk := data[:rand.Intn(len(data))+1]
+				if _, err := writers[i].Write(chunk); err != nil {
+					errc <- err
+					return
+				}
+				data = data[len(chunk):]
+			}
+			errc <- writers[i].Close()
+		}(i)
+	}
+	for range writers {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writers[0].Close(); err == nil {
+		t.Error("closing a parallel file twice succeeded")
+	}
+	if _, err := dir.Write([]byte("x")); err == nil {
+		t.Error("write to a parallel directory succeeded")
+	}
+	if err := dir.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Create("last.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File) != n+3 {
+		t.Fatalf("got %d files, want %d", len(r.File), n+3)
+	}
+	if r.File[0].Name != "first.txt" || r.File[n+1].Name != "dir/" || r.File[n+2].Name != "last.txt" {
+		t.Errorf("unexpected file order: %q, %q, %q", r.File[0].Name, r.File[n+1].Name, r.File[n+2].Name)
+	}
+	for i, want := range contents {
+		f := r.File[i+1]
+		if f.Name != fmt.Sprintf("%d.txt", i) {
+			t.Errorf("file %d is named %q", i, f.Name)
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: got %d bytes, %v; want %d bytes", f.Name, len(got), err, len(want))
+		}
+	}
+}
+
 func TestWriterCreateRaw(t *testing.T) {
 	files := []struct {
 		name             string
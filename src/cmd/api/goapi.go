@@ -369,7 +369,7 @@ type Walker struct {
 	stdPackages []string                     // names, omitting "unsafe", internal, and vendored packages
 	importMap   map[string]map[string]string // importer dir -> import path -> canonical path
 	importDir   map[string]string            // canonical import path -> dir
-
+	tparams     *types.TParamList            // type parameters in scope, for naming them $0, $1, ...
 }
 
 func NewWalker(context *build.Context, root string) *Walker {
@@ -758,13 +758,28 @@ func (w *Walker) writeType(buf *bytes.Buffer, typ types.Type) {
 
 	case *types.Interface:
 		buf.WriteString("interface{")
-		if typ.NumMethods() > 0 {
+		elems := append(sortedMethodNames(typ), w.sortedEmbeddeds(typ)...)
+		if len(elems) > 0 {
 			buf.WriteByte(' ')
-			buf.WriteString(strings.Join(sortedMethodNames(typ), ", "))
+			buf.WriteString(strings.Join(elems, ", "))
 			buf.WriteByte(' ')
 		}
 		buf.WriteString("}")
 
+	case *types.Union:
+		w.writeUnion(buf, typ)
+
+	case *types.TypeParam:
+		// Type parameters are written by position rather than by name,
+		// so that renaming one is not reported as an API change.
+		for i, n := 0, w.tparams.Len(); i < n; i++ {
+			if w.tparams.At(i) == typ {
+				fmt.Fprintf(buf, "$%d", i)
+				return
+			}
+		}
+		buf.WriteString(typ.Obj().Name())
+
 	case *types.Map:
 		buf.WriteString("map[")
 		w.writeType(buf, typ.Key())
@@ -801,6 +816,10 @@ func (w *Walker) writeType(buf *bytes.Buffer, typ types.Type) {
 }
 
 func (w *Walker) writeSignature(buf *bytes.Buffer, sig *types.Signature) {
+	if tparams := sig.TParams(); tparams.Len() > 0 {
+		defer w.setTypeParams(tparams)()
+		w.writeTypeParams(buf, tparams)
+	}
 	w.writeParams(buf, sig.Params(), sig.Variadic())
 	switch res := sig.Results(); res.Len() {
 	case 0:
@@ -830,6 +849,60 @@ func (w *Walker) writeParams(buf *bytes.Buffer, t *types.Tuple, variadic bool) {
 	buf.WriteByte(')')
 }
 
+// setTypeParams makes tparams the type parameters in scope
+// and returns a function that restores the previous ones.
+func (w *Walker) setTypeParams(tparams *types.TParamList) (restore func()) {
+	old := w.tparams
+	w.tparams = tparams
+	return func() { w.tparams = old }
+}
+
+func (w *Walker) writeTypeParams(buf *bytes.Buffer, tparams *types.TParamList) {
+	buf.WriteByte('[')
+	for i, n := 0, tparams.Len(); i < n; i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		tp := tparams.At(i)
+		w.writeType(buf, tp)
+		buf.WriteByte(' ')
+		w.writeType(buf, tp.Constraint())
+	}
+	buf.WriteByte(']')
+}
+
+func (w *Walker) writeUnion(buf *bytes.Buffer, u *types.Union) {
+	for i, n := 0, u.Len(); i < n; i++ {
+		if i > 0 {
+			buf.WriteString(" | ")
+		}
+		term := u.Term(i)
+		if term.Tilde() {
+			buf.WriteByte('~')
+		}
+		w.writeType(buf, term.Type())
+	}
+}
+
+// sortedEmbeddeds returns the embedded type set elements of typ, such as
+// the unions of a constraint interface, in sorted order. Embedded
+// interfaces contribute their own elements; their methods are already
+// part of typ's method set.
+func (w *Walker) sortedEmbeddeds(typ *types.Interface) []string {
+	n := typ.NumEmbeddeds()
+	list := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		emb := typ.EmbeddedType(i)
+		if iface, ok := emb.Underlying().(*types.Interface); ok {
+			list = append(list, w.sortedEmbeddeds(iface)...)
+			continue
+		}
+		list = append(list, w.typeString(emb))
+	}
+	sort.Strings(list)
+	return list
+}
+
 func (w *Walker) typeString(typ types.Type) string {
 	var buf bytes.Buffer
 	w.writeType(&buf, typ)
@@ -960,13 +1033,14 @@ func (w *Walker) emitIfaceType(name string, typ *types.Interface) {
 		return
 	}
 
-	if len(methodNames) == 0 {
+	sort.Strings(methodNames)
+	elems := append(methodNames, w.sortedEmbeddeds(typ)...)
+	if len(elems) == 0 {
 		w.emitf("type %s interface {}", name)
 		return
 	}
 
-	sort.Strings(methodNames)
-	w.emitf("type %s interface { %s }", name, strings.Join(methodNames, ", "))
+	w.emitf("type %s interface { %s }", name, strings.Join(elems, ", "))
 }
 
 func (w *Walker) emitFunc(f *types.Func) {
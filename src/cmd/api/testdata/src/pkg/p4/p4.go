@@ -0,0 +1,33 @@
+package p4
+
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+type Stringer interface {
+	Number
+	String() string
+}
+
+func Sum[T Number](s []T) (sum T) {
+	for _, v := range s {
+		sum += v
+	}
+	return sum
+}
+
+func Map[S interface{ ~[]E }, E, R any](s S, f func(E) R) []R {
+	r := make([]R, 0, len(s))
+	for _, v := range s {
+		r = append(r, f(v))
+	}
+	return r
+}
+
+func Keys[M interface{ ~map[K]V }, K comparable, V any](m M) []K {
+	var keys []K
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -102,6 +102,10 @@ Flags:
 		and diagnose imports that would cause a circular dependency.
 	-pack
 		Write a package (archive) file rather than an object file
+	-pgoprofile file
+		Read a CPU profile in the pprof format from file and use it to
+		guide optimizations: inline calls at hot call sites beyond the
+		usual budget, and devirtualize hot interface method calls.
 	-race
 		Compile with race detector enabled.
 	-s
@@ -41,6 +41,9 @@ type DebugFlags struct {
 	Nil                  int    `help:"print information about nil checks"`
 	NoOpenDefer          int    `help:"disable open-coded defers"`
 	PCTab                string `help:"print named pc-value table"`
+	PGODebug             int    `help:"print information about profile-guided optimizations"`
+	PGODevirtualize      int    `help:"enable profile-guided devirtualization"`
+	PGOInline            int    `help:"enable profile-guided inlining"`
 	Panic                int    `help:"show all compiler panics"`
 	Slice                int    `help:"print information about slice compilation"`
 	SoftFloat            int    `help:"force compiler to emit soft-float code"`
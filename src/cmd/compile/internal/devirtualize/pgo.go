@@ -0,0 +1,185 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package devirtualize
+
+import (
+	"fmt"
+
+	"cmd/compile/internal/base"
+	"cmd/compile/internal/ir"
+	"cmd/compile/internal/pgo"
+	"cmd/compile/internal/typecheck"
+	"cmd/compile/internal/types"
+)
+
+// ProfileGuided performs call devirtualization of indirect calls
+// based on profile information.
+//
+// Specifically, it performs conditional devirtualization of interface
+// calls for the hottest callee. That is, it performs a transformation
+// like:
+//
+//	type Iface interface {
+//		Foo()
+//	}
+//
+//	type Concrete struct{}
+//
+//	func (Concrete) Foo() {}
+//
+//	func foo(i Iface) {
+//		i.Foo()
+//	}
+//
+// to:
+//
+//	func foo(i Iface) {
+//		if c, ok := i.(Concrete); ok {
+//			c.Foo()
+//		} else {
+//			i.Foo()
+//		}
+//	}
+//
+// The primary benefit of this transformation is enabling inlining of
+// the direct call.
+//
+// Only callees that are methods declared in the package being
+// compiled are considered, since the concrete type must be
+// available to construct the type assertion.
+func ProfileGuided(fn *ir.Func, p *pgo.Profile) {
+	ir.CurFunc = fn
+
+	var methods map[string]*ir.Func // lazily built by lookup
+	lookup := func(name string) *ir.Func {
+		if methods == nil {
+			methods = make(map[string]*ir.Func)
+			for _, n := range typecheck.Target.Decls {
+				if n.Op() != ir.ODCLFUNC {
+					continue
+				}
+				fn := n.(*ir.Func)
+				if fn.Nname != nil && fn.Type().Recv() != nil {
+					methods[ir.PkgFuncName(fn)] = fn
+				}
+			}
+		}
+		return methods[name]
+	}
+
+	var edit func(n ir.Node) ir.Node
+	edit = func(n ir.Node) ir.Node {
+		if n == nil {
+			return n
+		}
+
+		switch n.Op() {
+		case ir.ODEFER, ir.OGO:
+			// The call in a go or defer statement must remain a
+			// call, but its operands may contain other calls.
+			ir.EditChildren(n.(*ir.GoDeferStmt).Call, edit)
+			return n
+		case ir.OCLOSURE:
+			// Closures are handled as separate functions.
+			return n
+		}
+
+		ir.EditChildren(n, edit)
+
+		call, ok := n.(*ir.CallExpr)
+		if !ok || call.Op() != ir.OCALLINTER {
+			return n
+		}
+		sel := call.X.(*ir.SelectorExpr)
+		for _, e := range p.HotCallees(fn, call.Pos()) {
+			callee := lookup(e.Callee)
+			if callee == nil {
+				continue
+			}
+			typ := callee.Type().Recv().Type
+			if typ.HasTParam() || typ.HasShape() {
+				continue
+			}
+			if ir.MethodSym(typ, sel.Sel) != callee.Sym() || !typecheck.Implements(typ, sel.X.Type()) {
+				continue
+			}
+			return rewriteCondCall(call, fn, typ, e)
+		}
+		return n
+	}
+	ir.EditChildren(fn, edit)
+}
+
+// rewriteCondCall rewrites the interface call to a direct call of the
+// method of concrete type typ, guarded by a type assertion.
+func rewriteCondCall(call *ir.CallExpr, curfn *ir.Func, typ *types.Type, e *pgo.Edge) ir.Node {
+	if base.Flag.LowerM != 0 {
+		fmt.Printf("%v: PGO devirtualizing %v to %v\n", ir.Line(call), call.X, typ)
+	}
+	if base.Debug.PGODebug > 0 {
+		fmt.Printf("%v: PGO devirtualizing call to %s (weight %d) in function %s\n", ir.Line(call), e.Callee, e.Weight, ir.PkgFuncName(curfn))
+	}
+
+	pos := call.Pos()
+	sel := call.X.(*ir.SelectorExpr)
+	typecheck.FixVariadicCall(call)
+
+	init := ir.TakeInit(call)
+
+	// Evaluate the receiver and arguments once, in order, into
+	// temporaries shared by both branches.
+	temp := func(x ir.Node) ir.Node {
+		tmp := typecheck.Temp(x.Type())
+		init.Append(ir.NewDecl(pos, ir.ODCL, tmp))
+		as := ir.NewAssignStmt(pos, tmp, x)
+		as.Def = true
+		init.Append(typecheck.Stmt(as))
+		return tmp
+	}
+	recv := temp(sel.X)
+	args := make([]ir.Node, len(call.Args))
+	for i, arg := range call.Args {
+		args[i] = temp(arg)
+	}
+
+	var retvars []ir.Node
+	for _, ret := range call.X.Type().Results().FieldSlice() {
+		tmp := typecheck.Temp(ret.Type)
+		init.Append(ir.NewDecl(pos, ir.ODCL, tmp))
+		retvars = append(retvars, tmp)
+	}
+
+	// assign assigns the results of the call x to retvars.
+	assign := func(x ir.Node) ir.Node {
+		switch len(retvars) {
+		case 0:
+			return x
+		case 1:
+			return typecheck.Stmt(ir.NewAssignStmt(pos, retvars[0], x))
+		}
+		as := ir.NewAssignListStmt(pos, ir.OAS2, retvars, []ir.Node{x})
+		return typecheck.Stmt(as)
+	}
+
+	// if c, ok := recv.(typ); ok { retvars = c.M(args) } else { retvars = recv.M(args) }
+	c := typecheck.Temp(typ)
+	ok := typecheck.Temp(types.Types[types.TBOOL])
+	dt := ir.NewTypeAssertExpr(pos, recv, ir.TypeNode(typ))
+	assert := ir.NewAssignListStmt(pos, ir.OAS2, []ir.Node{c, ok}, []ir.Node{dt})
+	assert.Def = true
+
+	thenCall := typecheck.Call(pos, ir.NewSelectorExpr(pos, ir.OXDOT, c, sel.Sel), args, call.IsDDD)
+	elseCall := typecheck.Call(pos, ir.NewSelectorExpr(pos, ir.OXDOT, recv, sel.Sel), args, call.IsDDD)
+
+	cond := ir.NewIfStmt(pos, ok, []ir.Node{assign(thenCall)}, []ir.Node{assign(elseCall)})
+	cond.PtrInit().Append(ir.NewDecl(pos, ir.ODCL, c), ir.NewDecl(pos, ir.ODCL, ok), typecheck.Stmt(assert))
+	cond = typecheck.Stmt(cond).(*ir.IfStmt)
+
+	res := ir.NewInlinedCallExpr(pos, []ir.Node{cond}, retvars)
+	res.SetInit(init)
+	res.SetType(call.Type())
+	res.SetTypecheck(1)
+	return res
+}
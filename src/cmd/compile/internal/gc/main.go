@@ -16,6 +16,7 @@ import (
 	"cmd/compile/internal/ir"
 	"cmd/compile/internal/logopt"
 	"cmd/compile/internal/noder"
+	"cmd/compile/internal/pgo"
 	"cmd/compile/internal/pkginit"
 	"cmd/compile/internal/reflectdata"
 	"cmd/compile/internal/ssa"
@@ -240,10 +241,38 @@ func Main(archInit func(*ssagen.ArchInfo)) {
 		typecheck.AllImportedBodies()
 	}
 
+	// Read the profile and build the weighted call graph.
+	var profile *pgo.Profile
+	if base.Flag.PgoProfile != "" {
+		base.Timer.Start("fe", "pgo-load-profile")
+		var err error
+		profile, err = pgo.New(base.Flag.PgoProfile)
+		if err != nil {
+			log.Fatalf("%s: PGO error: %v", base.Flag.PgoProfile, err)
+		}
+		if base.Debug.PGODebug >= 2 {
+			profile.Dump(base.Ctxt.Bso)
+			base.Ctxt.Bso.Flush()
+		}
+	}
+
+	// Profile-guided devirtualization. With inlining enabled,
+	// InlinePackage does it, so that the devirtualized calls can
+	// be inlined.
+	if profile != nil && base.Debug.PGODevirtualize != 0 && base.Flag.LowerL == 0 {
+		base.Timer.Start("fe", "pgo-devirtualization")
+		for _, n := range typecheck.Target.Decls {
+			if n.Op() == ir.ODCLFUNC {
+				devirtualize.ProfileGuided(n.(*ir.Func), profile)
+			}
+		}
+		ir.CurFunc = nil
+	}
+
 	// Inlining
 	base.Timer.Start("fe", "inlining")
 	if base.Flag.LowerL != 0 {
-		inline.InlinePackage()
+		inline.InlinePackage(profile)
 	}
 	noder.MakeWrappers(typecheck.Target) // must happen after inlining
 
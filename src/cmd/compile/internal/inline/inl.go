@@ -23,6 +23,11 @@
 //
 // The Debug.m flag enables diagnostic output.  a single -m is useful for verifying
 // which calls get inlined or not, more is for debugging, and may go away at any point.
+//
+// If a profile is provided (-pgoprofile), functions called from hot call sites
+// get the larger inlineHotMaxBudget, and calls at hot call sites are inlined even
+// if the callee's cost exceeds the caller's usual limit. The -d pgoinline=0 flag
+// disables this.
 
 package inline
 
@@ -32,8 +37,10 @@ import (
 	"strings"
 
 	"cmd/compile/internal/base"
+	"cmd/compile/internal/devirtualize"
 	"cmd/compile/internal/ir"
 	"cmd/compile/internal/logopt"
+	"cmd/compile/internal/pgo"
 	"cmd/compile/internal/typecheck"
 	"cmd/compile/internal/types"
 	"cmd/internal/obj"
@@ -51,10 +58,20 @@ const (
 
 	inlineBigFunctionNodes   = 5000 // Functions with this many nodes are considered "big".
 	inlineBigFunctionMaxCost = 20   // Max cost of inlinee when inlining into a "big" function.
+
+	inlineHotMaxBudget = 2000 // Max cost of a function called from a hot call site, with a profile.
 )
 
+// pgoProfile is the profile used to guide inlining, if any.
+var pgoProfile *pgo.Profile
+
 // InlinePackage finds functions that can be inlined and clones them before walk expands them.
-func InlinePackage() {
+// If profile is not nil, it is used to inline hot calls more aggressively
+// and to devirtualize hot interface calls (see devirtualize.ProfileGuided).
+func InlinePackage(profile *pgo.Profile) {
+	if base.Debug.PGOInline != 0 {
+		pgoProfile = profile
+	}
 	ir.VisitFuncsBottomUp(typecheck.Target.Decls, func(list []*ir.Func, recursive bool) {
 		numfns := numNonClosures(list)
 		for _, n := range list {
@@ -68,6 +85,13 @@ func InlinePackage() {
 					fmt.Printf("%v: cannot inline %v: recursive\n", ir.Line(n), n.Nname)
 				}
 			}
+			if profile != nil && base.Debug.PGODevirtualize != 0 {
+				// Devirtualize after CanInline, so that the
+				// inlinable body of n keeps the interface call,
+				// and before InlineCalls, so that the direct
+				// calls can be inlined.
+				devirtualize.ProfileGuided(n, profile)
+			}
 			InlineCalls(n)
 		}
 	})
@@ -166,17 +190,29 @@ func CanInline(fn *ir.Func) {
 	// locals, and we use this map to produce a pruned Inline.Dcl
 	// list. See issue 25249 for more context.
 
+	budget := int32(inlineMaxBudget)
+	if pgoProfile != nil && pgoProfile.IsHotCallee(fn) {
+		// Functions called from hot call sites get a bigger
+		// budget. mkinlcall only allows inlining calls to them
+		// that exceed the usual limit at the hot call sites.
+		budget = inlineHotMaxBudget
+	}
 	visitor := hairyVisitor{
-		budget:        inlineMaxBudget,
+		maxBudget:     budget,
+		budget:        budget,
 		extraCallCost: cc,
 	}
 	if visitor.tooHairy(fn) {
 		reason = visitor.reason
 		return
 	}
+	cost := budget - visitor.budget
+	if base.Debug.PGODebug > 0 && cost > inlineMaxBudget {
+		fmt.Printf("hot-budget check allows inlining of %v with cost %d\n", ir.PkgFuncName(fn), cost)
+	}
 
 	n.Func.Inl = &ir.Inline{
-		Cost: inlineMaxBudget - visitor.budget,
+		Cost: cost,
 		Dcl:  pruneUnusedAutos(n.Defn.(*ir.Func).Dcl, &visitor),
 		Body: inlcopylist(fn.Body),
 
@@ -184,12 +220,12 @@ func CanInline(fn *ir.Func) {
 	}
 
 	if base.Flag.LowerM > 1 {
-		fmt.Printf("%v: can inline %v with cost %d as: %v { %v }\n", ir.Line(fn), n, inlineMaxBudget-visitor.budget, fn.Type(), ir.Nodes(n.Func.Inl.Body))
+		fmt.Printf("%v: can inline %v with cost %d as: %v { %v }\n", ir.Line(fn), n, cost, fn.Type(), ir.Nodes(n.Func.Inl.Body))
 	} else if base.Flag.LowerM != 0 {
 		fmt.Printf("%v: can inline %v\n", ir.Line(fn), n)
 	}
 	if logopt.Enabled() {
-		logopt.LogOpt(fn.Pos(), "canInlineFunction", "inline", ir.FuncName(fn), fmt.Sprintf("cost: %d", inlineMaxBudget-visitor.budget))
+		logopt.LogOpt(fn.Pos(), "canInlineFunction", "inline", ir.FuncName(fn), fmt.Sprintf("cost: %d", cost))
 	}
 }
 
@@ -228,6 +264,7 @@ func canDelayResults(fn *ir.Func) bool {
 // hairyVisitor visits a function body to determine its inlining
 // hairiness and whether or not it can be inlined.
 type hairyVisitor struct {
+	maxBudget     int32
 	budget        int32
 	reason        string
 	extraCallCost int32
@@ -241,7 +278,7 @@ func (v *hairyVisitor) tooHairy(fn *ir.Func) bool {
 		return true
 	}
 	if v.budget < 0 {
-		v.reason = fmt.Sprintf("function too complex: cost %d exceeds budget %d", inlineMaxBudget-v.budget, inlineMaxBudget)
+		v.reason = fmt.Sprintf("function too complex: cost %d exceeds budget %d", v.maxBudget-v.budget, v.maxBudget)
 		return true
 	}
 	return false
@@ -672,11 +709,17 @@ func mkinlcall(n *ir.CallExpr, fn *ir.Func, maxCost int32, inlMap map[*ir.Func]b
 	if fn.Inl.Cost > maxCost {
 		// The inlined function body is too big. Typically we use this check to restrict
 		// inlining into very big functions.  See issue 26546 and 17566.
-		if logopt.Enabled() {
-			logopt.LogOpt(n.Pos(), "cannotInlineCall", "inline", ir.FuncName(ir.CurFunc),
-				fmt.Sprintf("cost %d of %s exceeds max large caller cost %d", fn.Inl.Cost, ir.PkgFuncName(fn), maxCost))
+		// Calls at hot call sites are allowed up to the hot budget.
+		if fn.Inl.Cost > inlineHotMaxBudget || pgoProfile == nil || !pgoProfile.IsHotCallSite(ir.CurFunc, n.Pos(), fn) {
+			if logopt.Enabled() {
+				logopt.LogOpt(n.Pos(), "cannotInlineCall", "inline", ir.FuncName(ir.CurFunc),
+					fmt.Sprintf("cost %d of %s exceeds max large caller cost %d", fn.Inl.Cost, ir.PkgFuncName(fn), maxCost))
+			}
+			return n
+		}
+		if base.Debug.PGODebug > 0 {
+			fmt.Printf("hot-budget check allows inlining for call %s (cost %d) at %v in function %s\n", ir.PkgFuncName(fn), fn.Inl.Cost, ir.Line(n), ir.PkgFuncName(ir.CurFunc))
 		}
-		return n
 	}
 
 	if fn == ir.CurFunc {
@@ -0,0 +1,243 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pgo implements support for profile-guided optimization.
+//
+// A profile is a CPU profile in the profile.proto format, as written
+// by runtime/pprof. The profile is reduced to a weighted call graph:
+// each edge records a caller, a callee and the line of the call site
+// in the caller, weighted by the number of samples in which that call
+// was on the stack. The optimization passes (currently inlining and
+// devirtualization) ask whether a particular function or call site
+// is hot, that is, whether it belongs to the set of heaviest edges
+// that together account for most of the profile.
+package pgo
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"cmd/compile/internal/base"
+	"cmd/compile/internal/ir"
+	"cmd/internal/src"
+)
+
+// hotCallSiteCDFThreshold is the percentage of the total edge weight
+// covered by the hot edges. Edges are considered in order of
+// decreasing weight, and are hot until the cumulative weight of the
+// edges considered so far reaches this threshold.
+const hotCallSiteCDFThreshold = 99
+
+// A Profile is the weighted call graph built from a profile file.
+type Profile struct {
+	// TotalWeight is the sum of the weights of all edges.
+	TotalWeight int64
+
+	// Edges holds all edges of the call graph, sorted by
+	// decreasing weight.
+	Edges []*Edge
+
+	// hotCallSites maps each hot call site to its hot callees,
+	// sorted by decreasing weight.
+	hotCallSites map[CallSite][]*Edge
+
+	// hotCallees is the set of functions called from a hot call site.
+	hotCallees map[string]bool
+
+	// startLines records the start line of each function, if known.
+	// Call sites in functions with a known start line are recorded
+	// as a line offset from the start of the function, which is
+	// robust against edits elsewhere in the file.
+	startLines map[string]int64
+}
+
+// A CallSite identifies a call site: a caller and a line within it.
+// Line is an offset from the start of the caller if the profile
+// records the caller's start line, and an absolute line otherwise.
+type CallSite struct {
+	Caller string
+	Line   int64
+}
+
+// An Edge is a weighted call graph edge.
+type Edge struct {
+	CallSite
+	Callee string
+	Weight int64
+	Hot    bool
+}
+
+// New reads the profile in the named file and builds its weighted
+// call graph.
+func New(filename string) (*Profile, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data)
+}
+
+func parse(data []byte) (*Profile, error) {
+	raw, err := parseProfile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Profile{
+		hotCallSites: make(map[CallSite][]*Edge),
+		hotCallees:   make(map[string]bool),
+		startLines:   make(map[string]int64),
+	}
+	if len(raw.samples) == 0 {
+		// An empty profile is valid, and simply has no effect.
+		return p, nil
+	}
+
+	valueIndex := -1
+	for i, st := range raw.sampleTypes {
+		if (st.typ == "samples" && st.unit == "count") || (st.typ == "cpu" && st.unit == "nanoseconds") {
+			valueIndex = i
+			break
+		}
+	}
+	if valueIndex < 0 {
+		return nil, fmt.Errorf("profile does not contain a sample index with value/type samples/count or cpu/nanoseconds")
+	}
+
+	for _, f := range raw.functions {
+		if f.startLine != 0 {
+			p.startLines[f.name] = f.startLine
+		}
+	}
+
+	type frame struct {
+		fn   string
+		line int64
+	}
+	edges := make(map[Edge]*Edge)
+	seen := make(map[Edge]bool)
+	var frames []frame
+	for _, s := range raw.samples {
+		if valueIndex >= len(s.values) {
+			return nil, errMalformed
+		}
+		weight := s.values[valueIndex]
+		if weight <= 0 {
+			continue
+		}
+
+		// Expand the stack, leaf first, including inlined frames.
+		frames = frames[:0]
+		for _, id := range s.locationIDs {
+			for _, l := range raw.locations[id] {
+				f, ok := raw.functions[l.functionID]
+				if !ok {
+					continue
+				}
+				frames = append(frames, frame{f.name, l.line})
+			}
+		}
+
+		// Count each edge at most once per sample, so that
+		// recursion does not inflate its weight.
+		for k := range seen {
+			delete(seen, k)
+		}
+		for i := 0; i+1 < len(frames); i++ {
+			callee, caller := frames[i], frames[i+1]
+			line := caller.line
+			if start := p.startLines[caller.fn]; start != 0 {
+				line -= start
+			}
+			key := Edge{CallSite: CallSite{caller.fn, line}, Callee: callee.fn}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			e := edges[key]
+			if e == nil {
+				e = new(Edge)
+				*e = key
+				edges[key] = e
+				p.Edges = append(p.Edges, e)
+			}
+			e.Weight += weight
+			p.TotalWeight += weight
+		}
+	}
+
+	sort.Slice(p.Edges, func(i, j int) bool {
+		ei, ej := p.Edges[i], p.Edges[j]
+		if ei.Weight != ej.Weight {
+			return ei.Weight > ej.Weight
+		}
+		// Break ties deterministically.
+		if ei.Caller != ej.Caller {
+			return ei.Caller < ej.Caller
+		}
+		if ei.Line != ej.Line {
+			return ei.Line < ej.Line
+		}
+		return ei.Callee < ej.Callee
+	})
+
+	var cum int64
+	for _, e := range p.Edges {
+		if cum*100 >= p.TotalWeight*hotCallSiteCDFThreshold {
+			break
+		}
+		cum += e.Weight
+		e.Hot = true
+		p.hotCallSites[e.CallSite] = append(p.hotCallSites[e.CallSite], e)
+		p.hotCallees[e.Callee] = true
+	}
+	return p, nil
+}
+
+// IsHotCallee reports whether fn is called from a hot call site.
+func (p *Profile) IsHotCallee(fn *ir.Func) bool {
+	return p.hotCallees[ir.PkgFuncName(fn)]
+}
+
+// HotCallees returns the hot callees of the call at pos in caller,
+// sorted by decreasing weight.
+func (p *Profile) HotCallees(caller *ir.Func, pos src.XPos) []*Edge {
+	return p.hotCallSites[p.callSite(caller, pos)]
+}
+
+// IsHotCallSite reports whether the call to callee at pos in caller
+// is hot.
+func (p *Profile) IsHotCallSite(caller *ir.Func, pos src.XPos, callee *ir.Func) bool {
+	name := ir.PkgFuncName(callee)
+	for _, e := range p.HotCallees(caller, pos) {
+		if e.Callee == name {
+			return true
+		}
+	}
+	return false
+}
+
+// callSite returns the profile call site for a call at pos in caller.
+func (p *Profile) callSite(caller *ir.Func, pos src.XPos) CallSite {
+	name := ir.PkgFuncName(caller)
+	line := int64(base.Ctxt.InnermostPos(pos).Line())
+	if p.startLines[name] != 0 {
+		line -= int64(base.Ctxt.InnermostPos(caller.Pos()).Line())
+	}
+	return CallSite{name, line}
+}
+
+// Dump writes the call graph to w, for debugging with -d=pgodebug=2.
+func (p *Profile) Dump(w io.Writer) {
+	fmt.Fprintf(w, "PGO profile: %d edges, total weight %d\n", len(p.Edges), p.TotalWeight)
+	for _, e := range p.Edges {
+		hot := ""
+		if e.Hot {
+			hot = " (hot)"
+		}
+		fmt.Fprintf(w, "\t%s:%d -> %s weight %d%s\n", e.Caller, e.Line, e.Callee, e.Weight, hot)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgo
+
+import (
+	"bytes"
+	"internal/profile"
+	"reflect"
+	"testing"
+)
+
+// testProfile returns a profile with the call graph
+//
+//	main -> run (line 12) -> hot (line 25, via inlined helper at line 40)
+//	                      -> cold (line 27)
+//
+// where main has a known start line and the other functions do not.
+func testProfile() *profile.Profile {
+	var (
+		main   = &profile.Function{ID: 1, Name: "p.main", StartLine: 10}
+		run    = &profile.Function{ID: 2, Name: "p.run"}
+		helper = &profile.Function{ID: 3, Name: "p.helper"}
+		hot    = &profile.Function{ID: 4, Name: "p.hot"}
+		cold   = &profile.Function{ID: 5, Name: "p.cold"}
+	)
+	locMain := &profile.Location{ID: 1, Line: []profile.Line{{Function: main, Line: 12}}}
+	// helper is inlined into run.
+	locRunHot := &profile.Location{ID: 2, Line: []profile.Line{{Function: helper, Line: 40}, {Function: run, Line: 25}}}
+	locRunCold := &profile.Location{ID: 3, Line: []profile.Line{{Function: run, Line: 27}}}
+	locHot := &profile.Location{ID: 4, Line: []profile.Line{{Function: hot, Line: 50}}}
+	locCold := &profile.Location{ID: 5, Line: []profile.Line{{Function: cold, Line: 60}}}
+	return &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "cpu", Unit: "nanoseconds"},
+		},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     1,
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{locHot, locRunHot, locMain}, Value: []int64{1000, 1000e6}},
+			{Location: []*profile.Location{locCold, locRunCold, locMain}, Value: []int64{1, 1e6}},
+		},
+		Location: []*profile.Location{locMain, locRunHot, locRunCold, locHot, locCold},
+		Function: []*profile.Function{main, run, helper, hot, cold},
+	}
+}
+
+func TestParse(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testProfile().Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The edges from main to run in both samples are merged.
+	want := []Edge{
+		{CallSite{"p.main", 2}, "p.run", 1001, true},
+		{CallSite{"p.helper", 40}, "p.hot", 1000, true},
+		{CallSite{"p.run", 25}, "p.helper", 1000, true},
+		{CallSite{"p.run", 27}, "p.cold", 1, false},
+	}
+	var got []Edge
+	for _, e := range p.Edges {
+		got = append(got, *e)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("edges:\ngot  %v\nwant %v", got, want)
+	}
+	if p.TotalWeight != 3002 {
+		t.Errorf("TotalWeight = %d, want 3002", p.TotalWeight)
+	}
+
+	for _, name := range []string{"p.hot", "p.helper", "p.run"} {
+		if !p.hotCallees[name] {
+			t.Errorf("%s is not a hot callee", name)
+		}
+	}
+	if p.hotCallees["p.cold"] {
+		t.Errorf("p.cold is a hot callee")
+	}
+	if len(p.hotCallSites[CallSite{"p.run", 25}]) != 1 {
+		t.Errorf("p.run:25 is not a hot call site")
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		[]byte("2\nabcdefghi\n"), // just a string table entry
+	} {
+		p, err := parse(data)
+		if err != nil {
+			t.Errorf("parse(%q): %v", data, err)
+			continue
+		}
+		if len(p.Edges) != 0 || p.TotalWeight != 0 {
+			t.Errorf("parse(%q) = %d edges with weight %d, want none", data, len(p.Edges), p.TotalWeight)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var buf bytes.Buffer
+	p := testProfile()
+	p.SampleType = []*profile.ValueType{{Type: "alloc_space", Unit: "bytes"}, {Type: "inuse_space", Unit: "bytes"}}
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{
+		buf.Bytes(),     // not a CPU profile
+		[]byte("3"),     // unknown wire type
+		[]byte("2\xff"), // truncated length
+		{0x1f, 0x8b, 0}, // truncated gzip header
+	} {
+		if _, err := parse(data); err == nil {
+			t.Errorf("parse(%q) succeeded, want error", data)
+		}
+	}
+}
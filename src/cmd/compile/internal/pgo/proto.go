@@ -0,0 +1,319 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgo
+
+// This file implements a minimal decoder for the profile.proto
+// format written by runtime/pprof. Only the parts of the format
+// needed to build a weighted call graph are decoded; everything
+// else is skipped.
+//
+// The compiler is built with the bootstrap toolchain, so this
+// package cannot depend on internal/profile (or anything newer
+// than the bootstrap toolchain's standard library).
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Field numbers from profile.proto.
+const (
+	// message Profile
+	tagProfile_SampleType  = 1 // repeated ValueType
+	tagProfile_Sample      = 2 // repeated Sample
+	tagProfile_Location    = 4 // repeated Location
+	tagProfile_Function    = 5 // repeated Function
+	tagProfile_StringTable = 6 // repeated string
+
+	// message ValueType
+	tagValueType_Type = 1 // int64 (string table index)
+	tagValueType_Unit = 2 // int64 (string table index)
+
+	// message Sample
+	tagSample_Location = 1 // repeated uint64
+	tagSample_Value    = 2 // repeated int64
+
+	// message Location
+	tagLocation_ID   = 1 // uint64
+	tagLocation_Line = 4 // repeated Line
+
+	// message Line
+	tagLine_FunctionID = 1 // uint64
+	tagLine_Line       = 2 // int64
+
+	// message Function
+	tagFunction_ID        = 1 // uint64
+	tagFunction_Name      = 2 // int64 (string table index)
+	tagFunction_StartLine = 5 // int64
+)
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errMalformed = errors.New("malformed profile")
+
+// rawProfile is the decoded subset of a profile.proto message.
+// String table indexes have already been resolved.
+type rawProfile struct {
+	sampleTypes []rawValueType
+	samples     []rawSample
+	locations   map[uint64][]rawLine
+	functions   map[uint64]rawFunction
+}
+
+type rawValueType struct {
+	typ, unit string
+}
+
+type rawSample struct {
+	locationIDs []uint64
+	values      []int64
+}
+
+type rawLine struct {
+	functionID uint64
+	line       int64
+}
+
+type rawFunction struct {
+	name      string
+	startLine int64
+}
+
+// parseProfile decodes a gzip-compressed or uncompressed
+// profile.proto message.
+func parseProfile(data []byte) (*rawProfile, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decompressing profile: %v", err)
+		}
+		data, err = ioutil.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing profile: %v", err)
+		}
+	}
+
+	// String table indexes can refer to strings that appear later in
+	// the message, so keep the indexes around until the whole message
+	// has been read.
+	type valueType struct{ typ, unit int64 }
+	type function struct {
+		id, name  int64
+		startLine int64
+	}
+	var (
+		strs       []string
+		valueTypes []valueType
+		funcs      []function
+	)
+	p := &rawProfile{
+		locations: make(map[uint64][]rawLine),
+		functions: make(map[uint64]rawFunction),
+	}
+
+	err := decodeMessage(data, func(tag, wire int, v uint64, b []byte) error {
+		switch tag {
+		case tagProfile_SampleType:
+			var vt valueType
+			err := decodeMessage(b, func(tag, wire int, v uint64, b []byte) error {
+				switch tag {
+				case tagValueType_Type:
+					vt.typ = int64(v)
+				case tagValueType_Unit:
+					vt.unit = int64(v)
+				}
+				return nil
+			})
+			valueTypes = append(valueTypes, vt)
+			return err
+		case tagProfile_Sample:
+			var s rawSample
+			err := decodeMessage(b, func(tag, wire int, v uint64, b []byte) error {
+				switch tag {
+				case tagSample_Location:
+					return decodeRepeated(wire, v, b, func(v uint64) {
+						s.locationIDs = append(s.locationIDs, v)
+					})
+				case tagSample_Value:
+					return decodeRepeated(wire, v, b, func(v uint64) {
+						s.values = append(s.values, int64(v))
+					})
+				}
+				return nil
+			})
+			p.samples = append(p.samples, s)
+			return err
+		case tagProfile_Location:
+			var id uint64
+			var lines []rawLine
+			err := decodeMessage(b, func(tag, wire int, v uint64, b []byte) error {
+				switch tag {
+				case tagLocation_ID:
+					id = v
+				case tagLocation_Line:
+					var l rawLine
+					err := decodeMessage(b, func(tag, wire int, v uint64, b []byte) error {
+						switch tag {
+						case tagLine_FunctionID:
+							l.functionID = v
+						case tagLine_Line:
+							l.line = int64(v)
+						}
+						return nil
+					})
+					lines = append(lines, l)
+					return err
+				}
+				return nil
+			})
+			p.locations[id] = lines
+			return err
+		case tagProfile_Function:
+			var f function
+			err := decodeMessage(b, func(tag, wire int, v uint64, b []byte) error {
+				switch tag {
+				case tagFunction_ID:
+					f.id = int64(v)
+				case tagFunction_Name:
+					f.name = int64(v)
+				case tagFunction_StartLine:
+					f.startLine = int64(v)
+				}
+				return nil
+			})
+			funcs = append(funcs, f)
+			return err
+		case tagProfile_StringTable:
+			if wire != wireBytes {
+				return errMalformed
+			}
+			strs = append(strs, string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	str := func(i int64) (string, error) {
+		if i < 0 || i >= int64(len(strs)) {
+			return "", fmt.Errorf("%v: string index %d out of range", errMalformed, i)
+		}
+		return strs[i], nil
+	}
+	for _, vt := range valueTypes {
+		typ, err := str(vt.typ)
+		if err != nil {
+			return nil, err
+		}
+		unit, err := str(vt.unit)
+		if err != nil {
+			return nil, err
+		}
+		p.sampleTypes = append(p.sampleTypes, rawValueType{typ, unit})
+	}
+	for _, f := range funcs {
+		name, err := str(f.name)
+		if err != nil {
+			return nil, err
+		}
+		p.functions[uint64(f.id)] = rawFunction{name, f.startLine}
+	}
+	return p, nil
+}
+
+// decodeMessage calls f for each field of the protocol buffer
+// message in data. For varint and fixed-size fields, v holds the
+// value; for length-delimited fields, b holds the contents.
+func decodeMessage(data []byte, f func(tag, wire int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := decodeVarint(data)
+		if n == 0 {
+			return errMalformed
+		}
+		data = data[n:]
+		tag, wire := int(key>>3), int(key&7)
+		var v uint64
+		var b []byte
+		switch wire {
+		case wireVarint:
+			v, n = decodeVarint(data)
+			if n == 0 {
+				return errMalformed
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return errMalformed
+			}
+			for i := 7; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return errMalformed
+			}
+			for i := 3; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			data = data[4:]
+		case wireBytes:
+			l, n := decodeVarint(data)
+			if n == 0 || l > uint64(len(data)-n) {
+				return errMalformed
+			}
+			b = data[n : n+int(l)]
+			data = data[n+int(l):]
+		default:
+			return fmt.Errorf("%v: unknown wire type %d", errMalformed, wire)
+		}
+		if err := f(tag, wire, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeRepeated decodes a repeated integer field, which may
+// be encoded either as individual varints or as a packed list.
+func decodeRepeated(wire int, v uint64, b []byte, add func(uint64)) error {
+	if wire != wireBytes {
+		add(v)
+		return nil
+	}
+	for len(b) > 0 {
+		v, n := decodeVarint(b)
+		if n == 0 {
+			return errMalformed
+		}
+		add(v)
+		b = b[n:]
+	}
+	return nil
+}
+
+// decodeVarint decodes a varint from the start of b, returning
+// the value and the number of bytes consumed, or 0 if b does not
+// start with a valid varint.
+func decodeVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,196 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"internal/profile"
+	"internal/testenv"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const pgoSrc = `package main
+
+import "fmt"
+
+type Adder interface {
+	Add(a int, b ...int) (int, error)
+}
+
+type add struct{ base int }
+
+func (x *add) Add(a int, b ...int) (int, error) {
+	s := x.base + a
+	if len(b) > 1 {
+		s += b[0] * b[1]
+	}
+	return s, nil
+}
+
+type neg struct{}
+
+func (neg) Add(a int, b ...int) (int, error) { return -a, nil }
+
+func big(x int) int {
+	for i := 0; i < 3; i++ {
+		x = x*31 + i
+		x ^= x >> 3
+		x += x << 2
+		x -= x >> 5
+		x = x*17 + 3
+		x ^= x >> 7
+		x += x << 1
+		x -= x >> 2
+		x = x*13 + 1
+		x ^= x >> 11
+		x += x << 3
+		x -= x >> 9
+	}
+	return x & 0xffff
+}
+
+func run(as []Adder) int {
+	s := 0
+	for _, a := range as {
+		r, _ := a.Add(s, 1, 2) // HOT-ADD
+		s = big(r)             // HOT-BIG
+	}
+	return s
+}
+
+func addTwo(a Adder, x int) int {
+	r, _ := a.Add(x, 2) // HOT-ADDTWO
+	return r
+}
+
+func main() {
+	fmt.Println(run([]Adder{&add{1}, neg{}, &add{2}}), addTwo(&add{3}, 4))
+}
+`
+
+// pgoLine returns the line number of the first line of pgoSrc
+// containing marker.
+func pgoLine(marker string) int64 {
+	for i, l := range strings.Split(pgoSrc, "\n") {
+		if strings.Contains(l, marker) {
+			return int64(i + 1)
+		}
+	}
+	panic("marker " + marker + " not found")
+}
+
+// pgoProfile writes a CPU profile for pgoSrc in which the calls
+// marked HOT-ADD, HOT-BIG, and HOT-ADDTWO are hot, and returns its path.
+func pgoProfile(t *testing.T, dir string) string {
+	var (
+		main = &profile.Function{ID: 1, Name: "main.main"}
+		run  = &profile.Function{ID: 2, Name: "main.run"}
+		add  = &profile.Function{ID: 3, Name: "main.(*add).Add"}
+		big  = &profile.Function{ID: 4, Name: "main.big"}
+		two  = &profile.Function{ID: 5, Name: "main.addTwo"}
+	)
+	locMain := &profile.Location{ID: 1, Line: []profile.Line{{Function: main, Line: pgoLine("fmt.Println")}}}
+	locRunAdd := &profile.Location{ID: 2, Line: []profile.Line{{Function: run, Line: pgoLine("HOT-ADD")}}}
+	locRunBig := &profile.Location{ID: 3, Line: []profile.Line{{Function: run, Line: pgoLine("HOT-BIG")}}}
+	locAdd := &profile.Location{ID: 4, Line: []profile.Line{{Function: add, Line: pgoLine("s += b[0]")}}}
+	locBig := &profile.Location{ID: 5, Line: []profile.Line{{Function: big, Line: pgoLine("x = x*31 + i")}}}
+	locTwoAdd := &profile.Location{ID: 6, Line: []profile.Line{{Function: two, Line: pgoLine("HOT-ADDTWO")}}}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     10e6,
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{locAdd, locRunAdd, locMain}, Value: []int64{100, 1000e6}},
+			{Location: []*profile.Location{locBig, locRunBig, locMain}, Value: []int64{100, 1000e6}},
+			{Location: []*profile.Location{locAdd, locTwoAdd, locMain}, Value: []int64{100, 1000e6}},
+		},
+		Location: []*profile.Location{locMain, locRunAdd, locRunBig, locAdd, locBig, locTwoAdd},
+		Function: []*profile.Function{main, run, add, big, two},
+	}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	prof := filepath.Join(dir, "cpu.pprof")
+	if err := ioutil.WriteFile(prof, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return prof
+}
+
+// TestPGO checks that a profile makes the compiler inline and
+// devirtualize hot calls, that a function with a devirtualized call
+// can still be inlined, and that the optimized program behaves
+// the same as the unoptimized one.
+func TestPGO(t *testing.T) {
+	testenv.MustHaveGoRun(t)
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "x.go")
+	if err := ioutil.WriteFile(src, []byte(pgoSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prof := pgoProfile(t, dir)
+
+	compile := func(flags ...string) string {
+		args := append([]string{"tool", "compile", "-p=main", "-m", "-o", filepath.Join(dir, "x.o")}, flags...)
+		cmd := exec.Command(testenv.GoToolPath(t), append(args, src)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %v\n%s", cmd, err, out)
+		}
+		return string(out)
+	}
+	addRE := fmt.Sprintf(`x.go:%d:\d+: PGO devirtualizing a.Add to \*add`, pgoLine("HOT-ADD"))
+	addInlRE := fmt.Sprintf(`x.go:%d:\d+: inlining call to \(\*add\).Add`, pgoLine("HOT-ADD"))
+	bigRE := fmt.Sprintf(`x.go:%d:\d+: inlining call to big`, pgoLine("HOT-BIG"))
+	twoRE := fmt.Sprintf(`x.go:%d:\d+: PGO devirtualizing a.Add to \*add`, pgoLine("HOT-ADDTWO"))
+	twoInlRE := fmt.Sprintf(`x.go:%d:\d+: inlining call to addTwo`, pgoLine("fmt.Println"))
+
+	out := compile()
+	for _, re := range []string{addRE, addInlRE, bigRE} {
+		if regexp.MustCompile(re).MatchString(out) {
+			t.Errorf("without profile, output unexpectedly matches %s:\n%s", re, out)
+		}
+	}
+
+	out = compile("-pgoprofile=" + prof)
+	for _, re := range []string{addRE, addInlRE, bigRE, twoRE, twoInlRE} {
+		if !regexp.MustCompile(re).MatchString(out) {
+			t.Errorf("with profile, output does not match %s:\n%s", re, out)
+		}
+	}
+
+	out = compile("-pgoprofile="+prof, "-d=pgoinline=0,pgodevirtualize=0")
+	for _, re := range []string{addRE, addInlRE, bigRE} {
+		if regexp.MustCompile(re).MatchString(out) {
+			t.Errorf("with PGO disabled, output unexpectedly matches %s:\n%s", re, out)
+		}
+	}
+
+	if testing.Short() {
+		return
+	}
+	goRun := func(flags ...string) string {
+		cmd := exec.Command(testenv.GoToolPath(t), append(append([]string{"run"}, flags...), src)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %v\n%s", cmd, err, out)
+		}
+		return string(out)
+	}
+	want := goRun()
+	if got := goRun("-gcflags=-pgoprofile=" + prof); got != want {
+		t.Errorf("output with profile = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"internal/coverage"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"cmd/internal/objabi"
+)
+
+const usageMessage = "" +
+	`Usage of 'go tool covdata':
+Given coverage data written to GOCOVERDIR by programs built with 'go build -cover':
+
+Merge the data in several directories into one:
+	go tool covdata merge -i=dir1,dir2 -o=outdir
+
+Subtract the coverage of dir2 from that of dir1:
+	go tool covdata subtract -i=dir1,dir2 -o=outdir
+
+Convert the data to a coverage profile for 'go tool cover':
+	go tool covdata textfmt -i=dir1,dir2 -o=profile.txt
+`
+
+func usage() {
+	fmt.Fprintln(os.Stderr, usageMessage)
+	fmt.Fprintln(os.Stderr, "Flags:")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+var (
+	input  = flag.String("i", "", "comma-separated list of input directories")
+	output = flag.String("o", "", "output directory, or output file for textfmt")
+)
+
+func main() {
+	objabi.AddVersionFlag()
+	flag.Usage = usage
+	flag.Parse()
+
+	// The command comes first, followed by its flags.
+	if flag.NArg() == 0 {
+		flag.Usage()
+	}
+	cmd := flag.Arg(0)
+	flag.CommandLine.Parse(flag.Args()[1:])
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "covdata: unexpected arguments: %s\n", strings.Join(flag.Args(), " "))
+		fmt.Fprintln(os.Stderr, `For usage information, run "go tool covdata -help"`)
+		os.Exit(2)
+	}
+	if *input == "" || *output == "" {
+		fmt.Fprintln(os.Stderr, "covdata: -i and -o are required")
+		fmt.Fprintln(os.Stderr, `For usage information, run "go tool covdata -help"`)
+		os.Exit(2)
+	}
+	dirs := strings.Split(*input, ",")
+
+	var err error
+	switch cmd {
+	case "merge":
+		err = merge(dirs, *output)
+	case "subtract":
+		err = subtract(dirs, *output)
+	case "textfmt":
+		err = textfmt(dirs, *output)
+	default:
+		fmt.Fprintf(os.Stderr, "covdata: unknown command %q\n", cmd)
+		fmt.Fprintln(os.Stderr, `For usage information, run "go tool covdata -help"`)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "covdata: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// A profile accumulates the merged data of a set of runs.
+type profile struct {
+	data  coverage.Data
+	index map[coverage.Block]int // index of each block in data
+}
+
+// add merges the data of a run into p.
+func (p *profile) add(d *coverage.Data) error {
+	if p.index == nil {
+		p.data.Mode = d.Mode
+		p.index = make(map[coverage.Block]int)
+	} else if d.Mode != p.data.Mode {
+		return fmt.Errorf("cannot merge data in mode %q with data in mode %q", d.Mode, p.data.Mode)
+	}
+	for i, b := range d.Blocks {
+		j, ok := p.index[b]
+		if !ok {
+			j = len(p.data.Blocks)
+			p.index[b] = j
+			p.data.Blocks = append(p.data.Blocks, b)
+			p.data.Counts = append(p.data.Counts, 0)
+		}
+		p.data.Counts[j] = mergeCounts(p.data.Mode, p.data.Counts[j], d.Counts[i])
+	}
+	return nil
+}
+
+// mergeCounts returns the merged value of two counters in the given mode.
+func mergeCounts(mode string, x, y uint32) uint32 {
+	if mode == "set" {
+		if x != 0 || y != 0 {
+			return 1
+		}
+		return 0
+	}
+	if x > math.MaxUint32-y {
+		return math.MaxUint32
+	}
+	return x + y
+}
+
+// sort sorts the blocks of p by file and position.
+func (p *profile) sort() {
+	sort.Sort(byPos{&p.data})
+	for i, b := range p.data.Blocks {
+		p.index[b] = i
+	}
+}
+
+type byPos struct{ d *coverage.Data }
+
+func (x byPos) Len() int { return len(x.d.Blocks) }
+func (x byPos) Swap(i, j int) {
+	x.d.Blocks[i], x.d.Blocks[j] = x.d.Blocks[j], x.d.Blocks[i]
+	x.d.Counts[i], x.d.Counts[j] = x.d.Counts[j], x.d.Counts[i]
+}
+func (x byPos) Less(i, j int) bool {
+	bi, bj := x.d.Blocks[i], x.d.Blocks[j]
+	if bi.File != bj.File {
+		return bi.File < bj.File
+	}
+	if bi.Line0 != bj.Line0 {
+		return bi.Line0 < bj.Line0
+	}
+	return bi.Col0 < bj.Col0
+}
+
+// read reads and merges the data in dirs.
+func read(dirs []string) (*profile, error) {
+	p := new(profile)
+	for _, dir := range dirs {
+		runs, err := coverage.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) == 0 {
+			return nil, fmt.Errorf("no coverage data files in %s", dir)
+		}
+		for _, d := range runs {
+			if err := p.add(d); err != nil {
+				return nil, fmt.Errorf("%s: %v", dir, err)
+			}
+		}
+	}
+	p.sort()
+	return p, nil
+}
+
+// merge merges the data in dirs and writes it to the directory out.
+func merge(dirs []string, out string) error {
+	p, err := read(dirs)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(out, 0777); err != nil {
+		return err
+	}
+	return coverage.WriteDir(out, &p.data)
+}
+
+// subtract writes to the directory out the data in the first of dirs,
+// less the blocks covered in the others.
+func subtract(dirs []string, out string) error {
+	if len(dirs) < 2 {
+		return errors.New("subtract needs at least two input directories")
+	}
+	p, err := read(dirs[:1])
+	if err != nil {
+		return err
+	}
+	q, err := read(dirs[1:])
+	if err != nil {
+		return err
+	}
+	subtractProfile(p, q)
+	if err := os.MkdirAll(out, 0777); err != nil {
+		return err
+	}
+	return coverage.WriteDir(out, &p.data)
+}
+
+// subtractProfile clears the counters of the blocks of p that q covers.
+func subtractProfile(p, q *profile) {
+	for i, b := range p.data.Blocks {
+		if j, ok := q.index[b]; ok && q.data.Counts[j] != 0 {
+			p.data.Counts[i] = 0
+		}
+	}
+}
+
+// textfmt merges the data in dirs and writes it to the file out as a
+// coverage profile.
+func textfmt(dirs []string, out string) error {
+	p, err := read(dirs)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := writeProfile(f, &p.data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeProfile writes d to w in the format of 'go test -coverprofile'.
+func writeProfile(w io.Writer, d *coverage.Data) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mode: %s\n", d.Mode)
+	for i, b := range d.Blocks {
+		fmt.Fprintf(bw, "%s:%d.%d,%d.%d %d %d\n", b.File,
+			b.Line0, b.Col0,
+			b.Line1, b.Col1,
+			b.Stmts,
+			d.Counts[i])
+	}
+	return bw.Flush()
+}
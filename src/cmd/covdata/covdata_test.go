@@ -0,0 +1,131 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"internal/coverage"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	blockA = coverage.Block{File: "m/a.go", Line0: 3, Col0: 14, Line1: 5, Col1: 2, Stmts: 1}
+	blockB = coverage.Block{File: "m/a.go", Line0: 5, Col0: 2, Line1: 7, Col1: 3, Stmts: 2}
+	blockC = coverage.Block{File: "m/b.go", Line0: 1, Col0: 1, Line1: 2, Col1: 2, Stmts: 3}
+)
+
+// writeRuns writes each of runs as the data of a run to a new directory,
+// and returns the directory.
+func writeRuns(t *testing.T, runs ...*coverage.Data) string {
+	dir := t.TempDir()
+	for _, d := range runs {
+		if err := coverage.WriteDir(dir, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMergeCounts(t *testing.T) {
+	for _, tt := range []struct {
+		mode string
+		x, y uint32
+		want uint32
+	}{
+		{"set", 0, 0, 0},
+		{"set", 1, 0, 1},
+		{"set", 1, 1, 1},
+		{"count", 2, 3, 5},
+		{"atomic", math.MaxUint32 - 1, 3, math.MaxUint32},
+	} {
+		if got := mergeCounts(tt.mode, tt.x, tt.y); got != tt.want {
+			t.Errorf("mergeCounts(%q, %d, %d) = %d, want %d", tt.mode, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestMergeAndTextfmt(t *testing.T) {
+	// Two runs of one binary, and a run of another binary
+	// that shares a block with the first.
+	dir1 := writeRuns(t,
+		&coverage.Data{Mode: "count", Blocks: []coverage.Block{blockB, blockA}, Counts: []uint32{1, 2}},
+		&coverage.Data{Mode: "count", Blocks: []coverage.Block{blockB, blockA}, Counts: []uint32{0, 3}},
+	)
+	dir2 := writeRuns(t,
+		&coverage.Data{Mode: "count", Blocks: []coverage.Block{blockC, blockA}, Counts: []uint32{0, 1}},
+	)
+
+	out := t.TempDir()
+	if err := merge([]string{dir1, dir2}, out); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := coverage.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("merge wrote %d runs, want 1", len(runs))
+	}
+
+	profile := filepath.Join(t.TempDir(), "profile.txt")
+	if err := textfmt([]string{out}, profile); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `mode: count
+m/a.go:3.14,5.2 1 6
+m/a.go:5.2,7.3 2 1
+m/b.go:1.1,2.2 3 0
+`
+	if string(data) != want {
+		t.Errorf("textfmt wrote:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestMergeModeMismatch(t *testing.T) {
+	dir1 := writeRuns(t, &coverage.Data{Mode: "set", Blocks: []coverage.Block{blockA}, Counts: []uint32{1}})
+	dir2 := writeRuns(t, &coverage.Data{Mode: "count", Blocks: []coverage.Block{blockA}, Counts: []uint32{1}})
+	err := merge([]string{dir1, dir2}, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "cannot merge") {
+		t.Errorf("merge with mixed modes: got error %v", err)
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	dir1 := writeRuns(t, &coverage.Data{Mode: "set", Blocks: []coverage.Block{blockA, blockB, blockC}, Counts: []uint32{1, 1, 0}})
+	dir2 := writeRuns(t, &coverage.Data{Mode: "set", Blocks: []coverage.Block{blockA, blockB}, Counts: []uint32{1, 0}})
+
+	out := t.TempDir()
+	if err := subtract([]string{dir1, dir2}, out); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := coverage.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("subtract wrote %d runs, want 1", len(runs))
+	}
+	got := make(map[coverage.Block]uint32)
+	for i, b := range runs[0].Blocks {
+		got[b] = runs[0].Counts[i]
+	}
+	if got[blockA] != 0 || got[blockB] != 1 || got[blockC] != 0 {
+		t.Errorf("subtract: got counts A=%d B=%d C=%d, want 0, 1, 0", got[blockA], got[blockB], got[blockC])
+	}
+}
+
+func TestNoData(t *testing.T) {
+	err := textfmt([]string{t.TempDir()}, filepath.Join(t.TempDir(), "profile.txt"))
+	if err == nil || !strings.Contains(err.Error(), "no coverage data files") {
+		t.Errorf("textfmt of an empty directory: got error %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Covdata is a program for manipulating the coverage data files written by
+programs built with 'go build -cover'.
+
+An instrumented program writes the values of its coverage counters to the
+directory named by the GOCOVERDIR environment variable each time it runs.
+Covdata reads the data in one or more such directories, named by the -i
+flag, and combines the runs it finds:
+
+	go tool covdata merge -i=dir1,dir2 -o=outdir
+		Merge the data in the input directories into a single run
+		written to the output directory.
+
+	go tool covdata subtract -i=dir1,dir2 -o=outdir
+		Write to the output directory the data in dir1, with the counters
+		of the blocks covered in dir2 (and any later input directories)
+		set to zero, to show what dir1 covers that dir2 does not.
+
+	go tool covdata textfmt -i=dir1,dir2 -o=profile.txt
+		Merge the data in the input directories and write it as a coverage
+		profile, in the format written by 'go test -coverprofile', for use
+		with 'go tool cover'.
+
+When merging, the counters of a block are added in "count" and "atomic"
+mode, and combined with "or" in "set" mode. The data being merged must have
+been collected in the same mode.
+
+For usage information, please see:
+	go help build
+	go tool covdata -help
+*/
+package main
@@ -72,7 +72,7 @@
 //
 // Usage:
 //
-// 	go build [-o output] [build flags] [packages]
+// 	go build [-o output] [-json] [-cover] [build flags] [packages]
 //
 // Build compiles the packages named by the import paths,
 // along with their dependencies, but it does not install the results.
@@ -101,6 +101,46 @@
 // The -i flag installs the packages that are dependencies of the target.
 // The -i flag is deprecated. Compiled packages are cached automatically.
 //
+// The -json flag reports the progress and output of the build as a stream
+// of JSON events on standard output, instead of as text on standard error.
+// Each event is a JSON object on a line of its own, encoding this struct:
+//
+// 	type BuildEvent struct {
+// 		Time       time.Time
+// 		ImportPath string // package being built
+// 		Action     string
+// 		Output     string // for build-output events
+// 	}
+//
+// The Action is "build-start" when the go command starts building a package
+// that is not up to date in the build cache,
+// "build-output" for output of the compiler, vet, the linker or other tools
+// run while building a package, such as compiler errors, and "build-fail"
+// when a step building a package fails. Errors that are not associated
+// with a single build step, such as errors loading packages, are still
+// printed to standard error. 'go test -json' reports the same events
+// alongside its test events.
+//
+// The -cover flag builds programs instrumented for coverage analysis.
+// When an instrumented program exits, either by returning from main.main
+// or by calling os.Exit, it writes the coverage counters collected while it
+// ran to files in the directory named by the GOCOVERDIR environment
+// variable. If GOCOVERDIR is not set, the program prints a warning and
+// writes nothing. The data of several runs, such as those of an integration
+// test, can be merged, subtracted, and converted to the profile format read
+// by 'go tool cover' with 'go tool covdata'; see 'go doc cmd/covdata'.
+//
+// 	-cover
+// 		enable coverage instrumentation.
+// 	-covermode set,count,atomic
+// 		set the mode for coverage analysis, as for 'go test -covermode'.
+// 		The default is "set", or "atomic" if -race is enabled.
+// 		Sets -cover.
+// 	-coverpkg pattern1,pattern2,pattern3
+// 		instrument the packages matching the patterns. The default is
+// 		to instrument the packages of the main module (in GOPATH mode,
+// 		the packages named on the command line). Sets -cover.
+//
 // The build flags are shared by the build, clean, get, install, list, run,
 // and test commands:
 //
@@ -186,6 +226,14 @@
 // 		include path must be in the same directory as the Go package they are
 // 		included from, and overlays will not appear when binaries and tests are
 // 		run through go run and go test respectively.
+// 	-pgo file
+// 		specify the file path of a profile for profile-guided optimization (PGO).
+// 		The profile is a CPU profile in the pprof format, such as one written
+// 		by runtime/pprof. The compiler uses it to inline hot calls more
+// 		aggressively and to devirtualize hot interface method calls.
+// 		The special name "off" (or the empty string, the default) turns off PGO.
+// 		The profile is applied to all packages in the build, and its content
+// 		is part of the build cache key.
 // 	-pkgdir dir
 // 		install and load all packages from dir instead of the usual locations.
 // 		For example, when building with a non-standard configuration,
@@ -292,6 +340,13 @@
 // download cache, including unpacked source code of versioned
 // dependencies.
 //
+// The -fuzzcache flag causes clean to remove files stored in the Go build
+// cache for fuzz testing. The fuzzing engine caches files that expand
+// code coverage, so removing them may make fuzzing less effective until
+// new inputs are found that provide the same coverage. These files are
+// distinct from those stored in testdata directory; clean does not remove
+// those files.
+//
 // For more about build flags, see 'go help build'.
 //
 // For more about specifying packages, see 'go help packages'.
@@ -677,7 +732,7 @@
 //
 // Usage:
 //
-// 	go install [build flags] [packages]
+// 	go install [-json] [-cover] [build flags] [packages]
 //
 // Install compiles and installs the packages named by the import paths.
 //
@@ -724,6 +779,12 @@
 // The -i flag installs the dependencies of the named packages as well.
 // The -i flag is deprecated. Compiled packages are cached automatically.
 //
+// The -json flag reports build output as JSON events, as described
+// in 'go help build'.
+//
+// The -cover, -covermode, and -coverpkg flags install programs instrumented
+// for coverage analysis, as described in 'go help build'.
+//
 // For more about the build flags, see 'go help build'.
 // For more about specifying packages, see 'go help packages'.
 //
@@ -1036,6 +1097,7 @@
 // 	graph       print module requirement graph
 // 	init        initialize new module in current directory
 // 	initwork    initialize workspace file
+// 	sbom        print software bill of materials for a main package
 // 	tidy        add missing and remove unused modules
 // 	vendor      make vendored copy of dependencies
 // 	verify      verify dependencies have expected content
@@ -1319,6 +1381,30 @@
 // more information.
 //
 //
+// Print software bill of materials for a main package
+//
+// Usage:
+//
+// 	go mod sbom [-format=spdx|cyclonedx] [package]
+//
+// SBOM prints a software bill of materials for the named main package of
+// the main module, or for the package in the current directory if none is
+// named. It describes what 'go build' would build the package from: the
+// main module and the modules providing the package's dependencies, with
+// their hashes from go.sum, and the Go version and settings the build would
+// use, such as GOOS, GOARCH, and CGO_ENABLED. The package is not built; set
+// those environment variables to describe a build for another platform.
+// The go.sum hashes are recorded as Go-specific references ("golang-h1" in
+// SPDX) or properties ("golang:h1" in CycloneDX), not as file checksums.
+//
+// The -format flag sets the format of the document: "spdx", the default,
+// for an SPDX 2.3 JSON document, or "cyclonedx" for a CycloneDX 1.4 JSON
+// document.
+//
+// 'go version -m -sbom=format' prints the same document from the
+// module information embedded in a binary.
+//
+//
 // Add missing and remove unused modules
 //
 // Usage:
@@ -1485,8 +1571,8 @@
 //
 // 'Go test' recompiles each package along with any files with names matching
 // the file pattern "*_test.go".
-// These additional files can contain test functions, benchmark functions, and
-// example functions. See 'go help testfunc' for more.
+// These additional files can contain test functions, benchmark functions, fuzz
+// targets, and example functions. See 'go help testfunc' for more.
 // Each listed package causes the execution of a separate test binary.
 // Files whose names begin with "_" (including "_test.go") or "." are ignored.
 //
@@ -1545,7 +1631,7 @@
 // The rule for a match in the cache is that the run involves the same
 // test binary and the flags on the command line come entirely from a
 // restricted set of 'cacheable' test flags, defined as -benchtime, -cpu,
-// -list, -parallel, -run, -short, -timeout, -failfast, and -v.
+// -list, -parallel, -run, -shard, -short, -timeout, -failfast, and -v.
 // If a run of go test has any test or non-test flags outside this set,
 // the result is not cached. To disable test caching, use any test flag
 // or argument other than the cacheable flags. The idiomatic way to disable
@@ -1586,6 +1672,19 @@
 // 	    Compile the test binary to the named file.
 // 	    The test still runs (unless -c or -i is specified).
 //
+// 	-rerun-failed file
+// 	    Run only the tests that failed in a previous run, as recorded in
+// 	    file by 'go test -json'. Failing top-level tests, examples and
+// 	    benchmarks are run again in each package that had them; a
+// 	    package that failed without a failing test, for example by
+// 	    panicking in TestMain, is run again as a whole. Each test that
+// 	    passes on retry is reported in a "--- FLAKY:" line. The run
+// 	    still fails, so that flaky tests are not hidden: a package whose
+// 	    tests all pass on retry is reported as FAIL, marked [flaky].
+// 	    Packages that did not fail are not run, and the flag cannot be
+// 	    combined with -run or -bench. Tests that pass on retry are not
+// 	    reported when test binaries are run by -exec.
+//
 // The test binary also accepts flags that control execution of the test; these
 // flags are also accessible by 'go test'. See 'go help testflag' for details.
 //
@@ -1614,7 +1713,7 @@
 //
 // Usage:
 //
-// 	go version [-m] [-v] [file ...]
+// 	go version [-m] [-v] [-sbom=format] [file ...]
 //
 // Version prints the build information for Go executables.
 //
@@ -1634,6 +1733,17 @@
 // information consists of multiple lines following the version line, each
 // indented by a leading tab character.
 //
+// The -sbom flag, used with -m, causes go version to print a software bill
+// of materials for each executable instead, built from its module
+// information. The format is "spdx" for an SPDX 2.3 JSON document, or
+// "cyclonedx" for a CycloneDX 1.4 JSON document. The bill of materials
+// describes the executable's main module and the modules it depends on,
+// with their go.sum hashes, and records the Go version and settings the
+// executable was built with, such as GOOS, GOARCH, and CGO_ENABLED. Each
+// document is printed on standard output; for several executables, the
+// documents follow each other. 'go mod sbom' prints the same document for
+// a main package without building it.
+//
 // See also: go doc runtime/debug.BuildInfo.
 //
 //
@@ -1832,6 +1942,63 @@
 // The go command periodically deletes cached data that has not been
 // used recently. Running 'go clean -cache' deletes all cached data.
 //
+// Setting the GOCACHEPROG environment variable to a command line makes
+// the go command start that program and use it as a remote cache, for
+// example to share build outputs between machines. Entries that miss in
+// the local cache are looked up in the remote cache and copied into the
+// local cache when found. New entries are written to the local cache and
+// sent to the remote cache in the background before the go command exits.
+// If the program fails, the go command prints a warning and continues
+// without it.
+//
+// The go command starts the GOCACHEPROG program once per invocation and
+// talks to it over its standard input and output. Each message is a JSON
+// object on a line of its own. Byte fields, such as ActionID and OutputID,
+// are encoded as base64 strings, as usual for JSON. A message with a
+// non-zero BodySize is followed by a line holding the body, also as a
+// base64-encoded JSON string, so that a program can be written with
+// nothing more than a JSON library.
+//
+// On startup, the program writes a response with ID 0 whose KnownCommands
+// field lists the commands it supports. It must support "get", "get-output"
+// and "put", and may support "close". Every later request has a unique ID,
+// and the program answers it with a response with the same ID. Requests
+// may be sent before earlier ones have been answered, and responses may be
+// written in any order.
+//
+// A request has these fields:
+//
+// 	ID        the request ID
+// 	Command   the command name
+// 	ActionID  the action ID, for "get" and "put"
+// 	OutputID  the output ID, for "get-output" and "put"
+// 	BodySize  the size of the body that follows, for "put"
+//
+// A response has these fields:
+//
+// 	ID             the ID of the request being answered
+// 	Err            if not empty, the reason the request failed
+// 	KnownCommands  the supported commands, in the initial response only
+// 	Miss           whether the requested entry was not found
+// 	OutputID       the output ID of the entry, for "get"
+// 	Size           the size of the output, for "get"
+// 	Time           the time the entry was stored, for "get"
+// 	BodySize       the size of the body that follows, for "get-output"
+//
+// The commands are:
+//
+// 	get         look up an action ID and return the output ID, size
+// 	            and time of the entry, or Miss
+// 	get-output  return the output with the given output ID as the body
+// 	            of the response, or Miss
+// 	put         store the body as the output of the action, with the
+// 	            given action and output IDs
+// 	close       flush any state and prepare to exit; the go command
+// 	            closes the program's standard input afterward
+//
+// An output ID is the SHA-256 hash of the output, and the go command
+// ignores outputs returned by "get-output" that don't match it.
+//
 // The build cache correctly accounts for changes to Go source files,
 // compilers, compiler options, and so on: cleaning the cache explicitly
 // should not be necessary in typical use. However, the build cache
@@ -1890,6 +2057,14 @@
 // 	GOCACHE
 // 		The directory where the go command will store cached
 // 		information for reuse in future builds.
+// 	GOCACHEPROG
+// 		A command line for a helper program that the go command uses
+// 		as a remote layer behind the build cache in GOCACHE.
+// 		See 'go help cache' for details.
+// 	GOCOVERDIR
+// 		The directory to which programs built with 'go build -cover'
+// 		write their coverage data when they exit.
+// 		See 'go help build' for details.
 // 	GOMODCACHE
 // 		The directory where the go command will store downloaded modules.
 // 	GODEBUG
@@ -2757,6 +2932,29 @@
 // 	-failfast
 // 	    Do not start new tests after the first test failure.
 //
+// 	-fuzz regexp
+// 	    Run the fuzz target matching the regular expression. When specified,
+// 	    the command line argument must match exactly one package, and regexp
+// 	    must match exactly one fuzz target within that package. Fuzzing
+// 	    will occur after tests, benchmarks, seed corpora of other fuzz
+// 	    targets, and examples have completed. See the Fuzzing section of
+// 	    the testing package documentation for details.
+//
+// 	-fuzztime t
+// 	    Run enough iterations of the fuzz target during fuzzing to take t,
+// 	    specified as a time.Duration (for example, -fuzztime 1h30s).
+// 	    The default is to run forever.
+// 	    The special syntax Nx means to run the fuzz target N times
+// 	    (for example, -fuzztime 1000x).
+//
+// 	-fuzzminimizetime t
+// 	    Run enough iterations of the fuzz target during each minimization
+// 	    attempt to take t, as specified as a time.Duration (for example,
+// 	    -fuzzminimizetime 30s).
+// 	    The default is 60s.
+// 	    The special syntax Nx means to run the fuzz target N times
+// 	    (for example, -fuzzminimizetime 100x).
+//
 // 	-json
 // 	    Log verbose output and test results in JSON. This presents the
 // 	    same information as the -v flag in a machine-readable format.
@@ -2776,7 +2974,8 @@
 // 	    (see 'go help build').
 //
 // 	-run regexp
-// 	    Run only those tests and examples matching the regular expression.
+// 	    Run only those tests, examples, and fuzz targets matching the regular
+// 	    expression.
 // 	    For tests, the regular expression is split by unbracketed slash (/)
 // 	    characters into a sequence of regular expressions, and each part
 // 	    of a test's identifier must match the corresponding element in
@@ -2785,6 +2984,13 @@
 // 	    of all tests matching X, even those without sub-tests matching Y,
 // 	    because it must run them to look for those sub-tests.
 //
+// 	-shard i/n
+// 	    Run only shard i of n of the top-level tests, examples, fuzz
+// 	    targets and benchmarks, counting from 0. The tests are assigned
+// 	    to shards in the order they appear in the source, so running
+// 	    shards 0 through n-1 runs each test exactly once. Sharding
+// 	    applies before -run, -bench and -shuffle.
+//
 // 	-short
 // 	    Tell long-running tests to shorten their run time.
 // 	    It is off by default but set during all.bash so that installing
@@ -2802,6 +3008,7 @@
 // 	    If a test binary runs longer than duration d, panic.
 // 	    If d is 0, the timeout is disabled.
 // 	    The default is 10 minutes (10m).
+// 	    The timeout does not apply to fuzzing with -fuzz.
 //
 // 	-v
 // 	    Verbose output: log all tests as they are run. Also print all
@@ -2934,8 +3141,8 @@
 //
 // Testing functions
 //
-// The 'go test' command expects to find test, benchmark, and example functions
-// in the "*_test.go" files corresponding to the package under test.
+// The 'go test' command expects to find test, benchmark, fuzz, and example
+// functions in the "*_test.go" files corresponding to the package under test.
 //
 // A test function is one named TestXxx (where Xxx does not start with a
 // lower case letter) and should have the signature,
@@ -2946,6 +3153,10 @@
 //
 // 	func BenchmarkXxx(b *testing.B) { ... }
 //
+// A fuzz target is one named FuzzXxx and should have the signature,
+//
+// 	func FuzzXxx(f *testing.F) { ... }
+//
 // An example function is similar to a test function but, instead of using
 // *testing.T to report success or failure, prints output to os.Stdout.
 // If the last comment in the function starts with "Output:" then the output
@@ -2985,7 +3196,7 @@
 //
 // The entire test file is presented as the example when it contains a single
 // example function, at least one other function, type, variable, or constant
-// declaration, and no test or benchmark functions.
+// declaration, and no test, benchmark, or fuzz functions.
 //
 // See the documentation of the testing package for more information.
 //
@@ -32,8 +32,9 @@ type OutputID [HashSize]byte
 
 // A Cache is a package cache, backed by a file system directory tree.
 type Cache struct {
-	dir string
-	now func() time.Time
+	dir    string
+	now    func() time.Time
+	remote *remoteCache // optional cache helper; see remote.go
 }
 
 // Open opens and returns the cache in the given directory.
@@ -140,7 +141,13 @@ func (c *Cache) Get(id ActionID) (Entry, error) {
 	if verify {
 		return Entry{}, &entryNotFoundError{Err: errVerifyMode}
 	}
-	return c.get(id)
+	entry, err := c.get(id)
+	if err != nil && c.remote != nil {
+		if rentry, rerr := c.getRemote(id); rerr == nil {
+			return rentry, nil
+		}
+	}
+	return entry, err
 }
 
 type Entry struct {
@@ -219,15 +226,25 @@ func (c *Cache) GetFile(id ActionID) (file string, entry Entry, err error) {
 	if err != nil {
 		return "", Entry{}, err
 	}
-	file = c.OutputFile(entry.OutputID)
+	file, err = c.checkOutput(entry)
+	if err != nil {
+		return "", Entry{}, err
+	}
+	return file, entry, nil
+}
+
+// checkOutput returns the name of the data file of entry,
+// if it is present and has the expected size.
+func (c *Cache) checkOutput(entry Entry) (string, error) {
+	file := c.OutputFile(entry.OutputID)
 	info, err := os.Stat(file)
 	if err != nil {
-		return "", Entry{}, &entryNotFoundError{Err: err}
+		return "", &entryNotFoundError{Err: err}
 	}
 	if info.Size() != entry.Size {
-		return "", Entry{}, &entryNotFoundError{Err: errors.New("file incomplete")}
+		return "", &entryNotFoundError{Err: errors.New("file incomplete")}
 	}
-	return file, entry, nil
+	return file, nil
 }
 
 // GetBytes looks up the action ID in the cache and returns
@@ -252,6 +269,16 @@ func (c *Cache) OutputFile(out OutputID) string {
 	return file
 }
 
+// FuzzDir returns a subdirectory within the cache for storing fuzzing data.
+// The subdirectory may not exist.
+//
+// This directory is managed by the internal/fuzz package. Files in this
+// directory aren't removed by the 'go clean -cache' command or by Trim.
+// They may be removed with 'go clean -fuzzcache'.
+func (c *Cache) FuzzDir() string {
+	return filepath.Join(c.dir, "fuzz")
+}
+
 // Time constants for cache expiration.
 //
 // We set the mtime on a cache file on each use, but at most one per mtimeInterval (1 hour),
@@ -441,7 +468,13 @@ func (c *Cache) put(id ActionID, file io.ReadSeeker, allowVerify bool) (OutputID
 	}
 
 	// Add to cache index.
-	return out, size, c.putIndexEntry(id, out, size, allowVerify)
+	if err := c.putIndexEntry(id, out, size, allowVerify); err != nil {
+		return out, size, err
+	}
+	if c.remote != nil {
+		c.remote.putLater(id, out, c.fileName(out, "d"))
+	}
+	return out, size, nil
 }
 
 // PutBytes stores the given bytes in the cache as the output for the action ID.
@@ -51,10 +51,25 @@ func initDefaultCache() {
 		os.WriteFile(filepath.Join(dir, "README"), []byte(cacheREADME), 0666)
 	}
 
-	c, err := Open(dir)
+	prog := cfg.Getenv("GOCACHEPROG")
+	if prog == "" {
+		c, err := Open(dir)
+		if err != nil {
+			base.Fatalf("failed to initialize build cache at %s: %s\n", dir, err)
+		}
+		defaultCache = c
+		return
+	}
+
+	c, err := OpenRemote(dir, prog)
 	if err != nil {
 		base.Fatalf("failed to initialize build cache at %s: %s\n", dir, err)
 	}
+	base.AtExit(func() {
+		if err := c.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "go: cache helper %s: %v\n", prog, err)
+		}
+	})
 	defaultCache = c
 }
 
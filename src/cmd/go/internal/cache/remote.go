@@ -0,0 +1,382 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+// This file implements a remote cache layer backed by a helper program,
+// as configured by GOCACHEPROG. The protocol spoken with the helper is
+// documented in 'go help cache'.
+//
+// The local cache in GOCACHE remains the primary store. It is used as a
+// read-through layer: an entry found only by the helper is copied into the
+// local cache before it is returned. It is also used as a write-back layer:
+// Put stores entries locally, and the go command sends them to the helper in
+// the background, waiting for outstanding puts when the cache is closed.
+//
+// The helper is an optimization. If it fails once it has been started, the
+// go command prints a warning and continues with the local cache alone.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"cmd/internal/str"
+)
+
+// A remoteRequest is a request sent to the cache helper.
+type remoteRequest struct {
+	ID       int64
+	Command  string
+	ActionID []byte `json:",omitempty"`
+	OutputID []byte `json:",omitempty"`
+	BodySize int64  `json:",omitempty"`
+}
+
+// A remoteResponse is a response written by the cache helper.
+type remoteResponse struct {
+	ID            int64
+	Err           string     `json:",omitempty"`
+	KnownCommands []string   `json:",omitempty"` // only in the initial response
+	Miss          bool       `json:",omitempty"`
+	OutputID      []byte     `json:",omitempty"`
+	Size          int64      `json:",omitempty"`
+	Time          *time.Time `json:",omitempty"`
+	BodySize      int64      `json:",omitempty"`
+
+	body []byte
+}
+
+// maxRemotePuts is the maximum number of puts sent to the helper at once.
+const maxRemotePuts = 4
+
+// A remoteCache is a connection to a running cache helper.
+type remoteCache struct {
+	prog  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	done  chan struct{} // closed when the helper's output is exhausted
+	known map[string]bool
+
+	writeMu sync.Mutex // serializes writes to w
+	w       *bufio.Writer
+
+	mu       sync.Mutex
+	nextID   int64
+	inFlight map[int64]chan *remoteResponse
+	err      error // first failure; the helper isn't used after it
+
+	puts   sync.WaitGroup
+	putSem chan struct{}
+}
+
+// startRemote starts the helper program prog, a command line that is
+// split into fields as by str.SplitQuotedFields, and waits for its initial
+// response.
+func startRemote(prog string) (*remoteCache, error) {
+	args, err := str.SplitQuotedFields(prog)
+	if err != nil {
+		return nil, fmt.Errorf("parsing GOCACHEPROG: %v", err)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("GOCACHEPROG is empty")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	r := &remoteCache{
+		prog:     prog,
+		cmd:      cmd,
+		stdin:    stdin,
+		done:     make(chan struct{}),
+		known:    make(map[string]bool),
+		w:        bufio.NewWriter(stdin),
+		inFlight: make(map[int64]chan *remoteResponse),
+		putSem:   make(chan struct{}, maxRemotePuts),
+	}
+	dec := json.NewDecoder(bufio.NewReader(stdout))
+	init, err := readRemoteResponse(dec)
+	if err == nil && init.ID != 0 {
+		err = fmt.Errorf("initial response has ID %d, want 0", init.ID)
+	}
+	if err == nil {
+		for _, name := range init.KnownCommands {
+			r.known[name] = true
+		}
+		for _, name := range []string{"get", "get-output", "put"} {
+			if !r.known[name] {
+				err = fmt.Errorf("helper does not support the %q command", name)
+				break
+			}
+		}
+	}
+	if err != nil {
+		stdin.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+	go r.readLoop(dec)
+	return r, nil
+}
+
+// readRemoteResponse reads a response and its body, if any, from dec.
+func readRemoteResponse(dec *json.Decoder) (*remoteResponse, error) {
+	res := new(remoteResponse)
+	if err := dec.Decode(res); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if res.BodySize > 0 {
+		if err := dec.Decode(&res.body); err != nil {
+			return nil, fmt.Errorf("reading body of response %d: %v", res.ID, err)
+		}
+		if int64(len(res.body)) != res.BodySize {
+			return nil, fmt.Errorf("response %d has a body of %d bytes, want %d", res.ID, len(res.body), res.BodySize)
+		}
+	}
+	return res, nil
+}
+
+// readLoop reads responses from dec and delivers them to the requests
+// waiting for them, until the helper exits or fails.
+func (r *remoteCache) readLoop(dec *json.Decoder) {
+	defer close(r.done)
+	for {
+		res, err := readRemoteResponse(dec)
+		if err != nil {
+			r.fail(err)
+			return
+		}
+		r.mu.Lock()
+		ch, ok := r.inFlight[res.ID]
+		delete(r.inFlight, res.ID)
+		r.mu.Unlock()
+		if !ok {
+			r.fail(fmt.Errorf("unexpected response with ID %d", res.ID))
+			return
+		}
+		ch <- res
+	}
+}
+
+// fail records err as the reason the helper can no longer be used,
+// and fails all outstanding requests.
+func (r *remoteCache) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.err = err
+	fmt.Fprintf(os.Stderr, "go: cache helper %s: %v; continuing without it\n", r.prog, err)
+	for id, ch := range r.inFlight {
+		close(ch)
+		delete(r.inFlight, id)
+	}
+}
+
+// send sends req, followed by body if it's not nil, and waits for the
+// response.
+func (r *remoteCache) send(req *remoteRequest, body []byte) (*remoteResponse, error) {
+	ch := make(chan *remoteResponse, 1)
+	r.mu.Lock()
+	if r.err != nil {
+		r.mu.Unlock()
+		return nil, r.err
+	}
+	r.nextID++
+	req.ID = r.nextID
+	r.inFlight[req.ID] = ch
+	r.mu.Unlock()
+
+	if body != nil {
+		req.BodySize = int64(len(body))
+	}
+	if err := r.write(req, body); err != nil {
+		r.fail(err)
+		return nil, err
+	}
+	res, ok := <-ch
+	if !ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return nil, r.err
+	}
+	if res.Err != "" {
+		return nil, fmt.Errorf("%s: %s", req.Command, res.Err)
+	}
+	return res, nil
+}
+
+func (r *remoteCache) write(req *remoteRequest, body []byte) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	enc := json.NewEncoder(r.w)
+	if err := enc.Encode(req); err != nil {
+		return err
+	}
+	if req.BodySize > 0 {
+		if err := enc.Encode(body); err != nil {
+			return err
+		}
+	}
+	return r.w.Flush()
+}
+
+// get looks up the action ID in the helper.
+func (r *remoteCache) get(id ActionID) (Entry, error) {
+	res, err := r.send(&remoteRequest{Command: "get", ActionID: id[:]}, nil)
+	if err != nil {
+		return Entry{}, err
+	}
+	if res.Miss {
+		return Entry{}, &entryNotFoundError{}
+	}
+	var entry Entry
+	if len(res.OutputID) != len(entry.OutputID) {
+		return Entry{}, &entryNotFoundError{Err: errors.New("malformed output ID")}
+	}
+	copy(entry.OutputID[:], res.OutputID)
+	entry.Size = res.Size
+	if res.Time != nil {
+		entry.Time = *res.Time
+	}
+	return entry, nil
+}
+
+// getOutput returns the output with the given output ID from the helper.
+func (r *remoteCache) getOutput(out OutputID) ([]byte, error) {
+	res, err := r.send(&remoteRequest{Command: "get-output", OutputID: out[:]}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.Miss {
+		return nil, &entryNotFoundError{}
+	}
+	if sha256.Sum256(res.body) != out {
+		return nil, &entryNotFoundError{Err: errors.New("bad checksum")}
+	}
+	return res.body, nil
+}
+
+// putLater sends the output stored in file to the helper in the background
+// as the output for the action ID. Errors disable the helper.
+func (r *remoteCache) putLater(id ActionID, out OutputID, file string) {
+	r.puts.Add(1)
+	go func() {
+		defer r.puts.Done()
+		r.putSem <- struct{}{}
+		defer func() { <-r.putSem }()
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			// The entry was removed from the local cache, perhaps by
+			// another go command. Don't bother the helper with it.
+			return
+		}
+		if sha256.Sum256(data) != out {
+			return
+		}
+		r.send(&remoteRequest{Command: "put", ActionID: id[:], OutputID: out[:]}, data)
+	}()
+}
+
+// close waits for outstanding puts, asks the helper to exit and waits
+// for it to do so.
+func (r *remoteCache) close() error {
+	r.puts.Wait()
+	if r.known["close"] {
+		r.send(&remoteRequest{Command: "close"}, nil)
+	}
+
+	// Record the closing before the helper exits, so that its exit
+	// isn't reported as a failure.
+	r.mu.Lock()
+	if r.err == nil {
+		r.err = errRemoteClosed
+	}
+	r.mu.Unlock()
+	r.stdin.Close()
+	select {
+	case <-r.done:
+	case <-time.After(5 * time.Second):
+		r.cmd.Process.Kill()
+	}
+	return r.cmd.Wait()
+}
+
+var errRemoteClosed = errors.New("cache helper closed")
+
+// OpenRemote is like Open, but also starts the cache helper program prog,
+// described in the GOCACHEPROG documentation, and uses it as a remote layer
+// behind the cache in dir. The caller must call Close once it's done with
+// the cache, to wait for outputs to be sent to the helper.
+func OpenRemote(dir, prog string) (*Cache, error) {
+	c, err := Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	c.remote, err = startRemote(prog)
+	if err != nil {
+		return nil, fmt.Errorf("starting cache helper %s: %v", prog, err)
+	}
+	return c, nil
+}
+
+// Close waits for the outputs written to c to be sent to its cache helper,
+// if any, and stops the helper. c must not be used after Close.
+func (c *Cache) Close() error {
+	if c.remote == nil {
+		return nil
+	}
+	return c.remote.close()
+}
+
+// getRemote looks up the action ID in the cache helper. If it's found,
+// getRemote copies the entry and its output into the local cache, unless
+// the output is already present there.
+func (c *Cache) getRemote(id ActionID) (Entry, error) {
+	entry, err := c.remote.get(id)
+	if err != nil {
+		return Entry{}, err
+	}
+	if _, err := c.checkOutput(entry); err != nil {
+		data, err := c.remote.getOutput(entry.OutputID)
+		if err != nil {
+			return Entry{}, err
+		}
+		if int64(len(data)) != entry.Size {
+			return Entry{}, &entryNotFoundError{Err: errors.New("file incomplete")}
+		}
+		if err := c.copyFile(bytes.NewReader(data), entry.OutputID, entry.Size); err != nil {
+			return Entry{}, err
+		}
+	}
+	if err := c.putIndexEntry(id, entry.OutputID, entry.Size, false); err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
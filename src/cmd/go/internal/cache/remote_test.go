@@ -0,0 +1,222 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cmd/internal/str"
+)
+
+func TestMain(m *testing.M) {
+	if dir := os.Getenv("GO_CACHE_STUB_HELPER"); dir != "" {
+		if err := stubHelper(dir, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "stub helper: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// stubHelper is a cache helper that stores entries in dir. It runs in place
+// of the tests when GO_CACHE_STUB_HELPER is set to dir.
+//
+// If GO_CACHE_STUB_COMMANDS is set, it's the space-separated list of
+// commands the helper announces. If GO_CACHE_STUB_EXIT is set, the helper
+// exits without a response when it receives a request for that command.
+func stubHelper(dir string, stdin io.Reader, stdout io.Writer) error {
+	commands := []string{"get", "get-output", "put", "close"}
+	if s := os.Getenv("GO_CACHE_STUB_COMMANDS"); s != "" {
+		commands = strings.Fields(s)
+	}
+	exitOn := os.Getenv("GO_CACHE_STUB_EXIT")
+
+	w := bufio.NewWriter(stdout)
+	enc := json.NewEncoder(w)
+	respond := func(res *remoteResponse) error {
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+		if res.BodySize > 0 {
+			if err := enc.Encode(res.body); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	}
+	if err := respond(&remoteResponse{KnownCommands: commands}); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(stdin))
+	for {
+		var req remoteRequest
+		if err := dec.Decode(&req); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var body []byte
+		if req.BodySize > 0 {
+			if err := dec.Decode(&body); err != nil {
+				return err
+			}
+		}
+		if req.Command == exitOn {
+			return fmt.Errorf("exiting on %q request", req.Command)
+		}
+
+		res := &remoteResponse{ID: req.ID}
+		switch req.Command {
+		case "get":
+			data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("a-%x", req.ActionID)))
+			if err != nil {
+				res.Miss = true
+				break
+			}
+			if err := json.Unmarshal(data, res); err != nil {
+				return err
+			}
+			res.ID = req.ID
+		case "get-output":
+			data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("o-%x", req.OutputID)))
+			if err != nil {
+				res.Miss = true
+				break
+			}
+			res.body, res.BodySize = data, int64(len(data))
+		case "put":
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("o-%x", req.OutputID)), body, 0666); err != nil {
+				res.Err = err.Error()
+				break
+			}
+			now := time.Now()
+			data, err := json.Marshal(&remoteResponse{OutputID: req.OutputID, Size: int64(len(body)), Time: &now})
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("a-%x", req.ActionID)), data, 0666); err != nil {
+				res.Err = err.Error()
+			}
+		case "close":
+			if err := respond(res); err != nil {
+				return err
+			}
+			return nil
+		default:
+			res.Err = fmt.Sprintf("unknown command %q", req.Command)
+		}
+		if err := respond(res); err != nil {
+			return err
+		}
+	}
+}
+
+// stubHelperProg returns a GOCACHEPROG setting that runs stubHelper,
+// storing entries in a new temporary directory.
+func stubHelperProg(t *testing.T) string {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skipf("cannot run the stub helper: %v", err)
+	}
+	t.Setenv("GO_CACHE_STUB_HELPER", t.TempDir())
+	prog, err := str.JoinAndQuoteFields([]string{exe})
+	if err != nil {
+		t.Skipf("cannot run the stub helper: %v", err)
+	}
+	return prog
+}
+
+func TestRemote(t *testing.T) {
+	prog := stubHelperProg(t)
+
+	// Write an entry through one local cache...
+	c1, err := OpenRemote(t.TempDir(), prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c1.PutBytes(dummyID(1), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c1.PutBytes(dummyID(2), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c1.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// ... and read it through another.
+	dir2 := t.TempDir()
+	c2, err := OpenRemote(dir2, prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, entry, err := c2.GetBytes(dummyID(1))
+	if err != nil || string(data) != "hello" || entry.Size != 5 {
+		t.Errorf("GetBytes(1) = %q, %v, %v, want %q, 5, nil", data, entry.Size, err, "hello")
+	}
+	if data, entry, err := c2.GetBytes(dummyID(2)); err != nil || len(data) != 0 || entry.Size != 0 {
+		t.Errorf("GetBytes(2) = %q, %v, %v, want empty output", data, entry.Size, err)
+	}
+	if _, err := c2.Get(dummyID(3)); err == nil {
+		t.Errorf("Get(3) succeeded for a missing entry")
+	}
+	if err := c2.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The entries read from the helper are in the second local cache.
+	c3, err := Open(dir2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _, err := c3.GetBytes(dummyID(1)); err != nil || string(data) != "hello" {
+		t.Errorf("local GetBytes(1) = %q, %v, want %q, nil", data, err, "hello")
+	}
+}
+
+func TestRemoteFailure(t *testing.T) {
+	prog := stubHelperProg(t)
+	t.Setenv("GO_CACHE_STUB_EXIT", "get")
+
+	dir := t.TempDir()
+	c, err := OpenRemote(dir, prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(dummyID(1)); err == nil {
+		t.Errorf("Get(1) succeeded for a missing entry")
+	}
+
+	// The local cache keeps working once the helper is gone.
+	if err := c.PutBytes(dummyID(1), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _, err := c.GetBytes(dummyID(1)); err != nil || !bytes.Equal(data, []byte("hello")) {
+		t.Errorf("GetBytes(1) = %q, %v, want %q, nil", data, err, "hello")
+	}
+	if err := c.Close(); err == nil {
+		t.Errorf("Close succeeded after the helper failed")
+	}
+}
+
+func TestRemoteUnsupported(t *testing.T) {
+	prog := stubHelperProg(t)
+	t.Setenv("GO_CACHE_STUB_COMMANDS", "get put")
+
+	if _, err := OpenRemote(t.TempDir(), prog); err == nil || !strings.Contains(err.Error(), "get-output") {
+		t.Errorf("OpenRemote with a helper lacking get-output: got error %v", err)
+	}
+}
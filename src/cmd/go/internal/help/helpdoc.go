@@ -498,6 +498,14 @@ General-purpose environment variables:
 	GOCACHE
 		The directory where the go command will store cached
 		information for reuse in future builds.
+	GOCACHEPROG
+		A command line for a helper program that the go command uses
+		as a remote layer behind the build cache in GOCACHE.
+		See 'go help cache' for details.
+	GOCOVERDIR
+		The directory to which programs built with 'go build -cover'
+		write their coverage data when they exit.
+		See 'go help build' for details.
 	GOMODCACHE
 		The directory where the go command will store downloaded modules.
 	GODEBUG
@@ -758,6 +766,63 @@ and running 'go env GOCACHE' prints the current cache directory.
 The go command periodically deletes cached data that has not been
 used recently. Running 'go clean -cache' deletes all cached data.
 
+Setting the GOCACHEPROG environment variable to a command line makes
+the go command start that program and use it as a remote cache, for
+example to share build outputs between machines. Entries that miss in
+the local cache are looked up in the remote cache and copied into the
+local cache when found. New entries are written to the local cache and
+sent to the remote cache in the background before the go command exits.
+If the program fails, the go command prints a warning and continues
+without it.
+
+The go command starts the GOCACHEPROG program once per invocation and
+talks to it over its standard input and output. Each message is a JSON
+object on a line of its own. Byte fields, such as ActionID and OutputID,
+are encoded as base64 strings, as usual for JSON. A message with a
+non-zero BodySize is followed by a line holding the body, also as a
+base64-encoded JSON string, so that a program can be written with
+nothing more than a JSON library.
+
+On startup, the program writes a response with ID 0 whose KnownCommands
+field lists the commands it supports. It must support "get", "get-output"
+and "put", and may support "close". Every later request has a unique ID,
+and the program answers it with a response with the same ID. Requests
+may be sent before earlier ones have been answered, and responses may be
+written in any order.
+
+A request has these fields:
+
+	ID        the request ID
+	Command   the command name
+	ActionID  the action ID, for "get" and "put"
+	OutputID  the output ID, for "get-output" and "put"
+	BodySize  the size of the body that follows, for "put"
+
+A response has these fields:
+
+	ID             the ID of the request being answered
+	Err            if not empty, the reason the request failed
+	KnownCommands  the supported commands, in the initial response only
+	Miss           whether the requested entry was not found
+	OutputID       the output ID of the entry, for "get"
+	Size           the size of the output, for "get"
+	Time           the time the entry was stored, for "get"
+	BodySize       the size of the body that follows, for "get-output"
+
+The commands are:
+
+	get         look up an action ID and return the output ID, size
+	            and time of the entry, or Miss
+	get-output  return the output with the given output ID as the body
+	            of the response, or Miss
+	put         store the body as the output of the action, with the
+	            given action and output IDs
+	close       flush any state and prepare to exit; the go command
+	            closes the program's standard input afterward
+
+An output ID is the SHA-256 hash of the output, and the go command
+ignores outputs returned by "get-output" that don't match it.
+
 The build cache correctly accounts for changes to Go source files,
 compilers, compiler options, and so on: cleaning the cache explicitly
 should not be necessary in typical use. However, the build cache
@@ -27,6 +27,7 @@ See 'go help modules' for an overview of module functionality.
 		cmdGraph,
 		cmdInit,
 		cmdInitwork,
+		cmdSBOM,
 		cmdTidy,
 		cmdVendor,
 		cmdVerify,
@@ -0,0 +1,88 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// go mod sbom
+
+package modcmd
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strings"
+
+	"cmd/go/internal/base"
+	"cmd/go/internal/load"
+	"cmd/go/internal/modload"
+	"cmd/go/internal/sbom"
+)
+
+var cmdSBOM = &base.Command{
+	UsageLine: "go mod sbom [-format=spdx|cyclonedx] [package]",
+	Short:     "print software bill of materials for a main package",
+	Long: `
+SBOM prints a software bill of materials for the named main package of
+the main module, or for the package in the current directory if none is
+named. It describes what 'go build' would build the package from: the
+main module and the modules providing the package's dependencies, with
+their hashes from go.sum, and the Go version and settings the build would
+use, such as GOOS, GOARCH, and CGO_ENABLED. The package is not built; set
+those environment variables to describe a build for another platform.
+The go.sum hashes are recorded as Go-specific references ("golang-h1" in
+SPDX) or properties ("golang:h1" in CycloneDX), not as file checksums.
+
+The -format flag sets the format of the document: "spdx", the default,
+for an SPDX 2.3 JSON document, or "cyclonedx" for a CycloneDX 1.4 JSON
+document.
+
+'go version -m -sbom=format' prints the same document from the
+module information embedded in a binary.
+	`,
+}
+
+var sbomFormat = cmdSBOM.Flag.String("format", "spdx", "")
+
+func init() {
+	cmdSBOM.Run = runSBOM // break init cycle
+	base.AddModCommonFlags(&cmdSBOM.Flag)
+	base.AddWorkfileFlag(&cmdSBOM.Flag)
+}
+
+func runSBOM(ctx context.Context, cmd *base.Command, args []string) {
+	modload.InitWorkfile()
+
+	if len(args) > 1 {
+		base.Fatalf("go mod sbom: sbom takes at most one package")
+	}
+	if !sbom.ValidFormat(*sbomFormat) {
+		base.Fatalf("go mod sbom: invalid -format %q: must be one of %s", *sbomFormat, strings.Join(sbom.Formats, ", "))
+	}
+	pattern := "."
+	if len(args) == 1 {
+		pattern = args[0]
+	}
+	modload.ForceUseModules = true
+	modload.RootMode = modload.NeedRoot
+
+	pkgs := load.PackagesAndErrors(ctx, load.PackageOpts{}, []string{pattern})
+	load.CheckPackageErrors(pkgs)
+	if len(pkgs) != 1 {
+		base.Fatalf("go mod sbom: %s matches %d packages, not a single main package", pattern, len(pkgs))
+	}
+	p := pkgs[0]
+	if p.Name != "main" {
+		base.Fatalf("go mod sbom: %s is not a main package", p.ImportPath)
+	}
+	if p.Internal.BuildInfo == "" {
+		base.Fatalf("go mod sbom: no module information for %s", p.ImportPath)
+	}
+
+	bi, err := sbom.ParseBuildInfo(runtime.Version(), p.Internal.BuildInfo)
+	if err != nil {
+		base.Fatalf("go mod sbom: %v", err)
+	}
+	if err := sbom.Write(os.Stdout, *sbomFormat, bi); err != nil {
+		base.Fatalf("go mod sbom: %v", err)
+	}
+}
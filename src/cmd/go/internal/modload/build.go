@@ -337,8 +337,9 @@ func moduleInfo(ctx context.Context, rs *Requirements, m module.Version, mode Li
 }
 
 // PackageBuildInfo returns a string containing module version information
-// for modules providing packages named by path and deps. path and deps must
-// name packages that were resolved successfully with LoadPackages.
+// for modules providing packages named by path and deps, followed by the
+// settings the binary is built with. path and deps must name packages that
+// were resolved successfully with LoadPackages.
 func PackageBuildInfo(path string, deps []string) string {
 	if !Enabled() {
 		return ""
@@ -380,6 +381,23 @@ func PackageBuildInfo(path string, deps []string) string {
 		writeEntry("dep", mod)
 	}
 
+	// Record the settings that select what the binary runs on,
+	// for tools producing a bill of materials from it.
+	writeSetting := func(key, value string) {
+		fmt.Fprintf(&buf, "build\t%s=%s\n", key, value)
+	}
+	writeSetting("-compiler", cfg.BuildContext.Compiler)
+	cgo := "0"
+	if cfg.BuildContext.CgoEnabled {
+		cgo = "1"
+	}
+	writeSetting("CGO_ENABLED", cgo)
+	writeSetting("GOARCH", cfg.BuildContext.GOARCH)
+	if key, val := cfg.GetArchEnv(); key != "" && val != "" {
+		writeSetting(key, val)
+	}
+	writeSetting("GOOS", cfg.BuildContext.GOOS)
+
 	return buf.String()
 }
 
@@ -0,0 +1,101 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sbom
+
+// CycloneDX 1.4 documents, as described at
+// https://cyclonedx.org/docs/1.4/json/.
+// Only the fields the go command can fill in are included.
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string        `json:"timestamp"`
+	Tools     []cdxTool     `json:"tools"`
+	Component *cdxComponent `json:"component"`
+}
+
+type cdxTool struct {
+	Vendor  string `json:"vendor"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cdxComponent struct {
+	BOMRef     string        `json:"bom-ref"`
+	Type       string        `json:"type"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	Purl       string        `json:"purl"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func cyclonedxDocument(bi *BuildInfo) *cdxBOM {
+	main, deps := components(bi)
+	mainComp := cdxComponentFor(main, "application")
+	// The build settings describe the binary, that is, the main component.
+	for _, s := range settings(bi) {
+		mainComp.Properties = append(mainComp.Properties, cdxProperty{Name: "golang:build:" + s.Key, Value: s.Value})
+	}
+	bom := &cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: created(),
+			Tools:     []cdxTool{{Vendor: "Go", Name: "go", Version: toolVersion}},
+			Component: &mainComp,
+		},
+		Components: []cdxComponent{},
+	}
+	dependsOn := []string{}
+	for _, c := range deps {
+		comp := cdxComponentFor(c, "library")
+		bom.Components = append(bom.Components, comp)
+		dependsOn = append(dependsOn, comp.BOMRef)
+	}
+	bom.Dependencies = []cdxDependency{{Ref: mainComp.BOMRef, DependsOn: dependsOn}}
+	return bom
+}
+
+func cdxComponentFor(c component, typ string) cdxComponent {
+	comp := cdxComponent{
+		BOMRef:  c.purl(),
+		Type:    typ,
+		Name:    c.path,
+		Version: c.version,
+		Purl:    c.purl(),
+	}
+	if c.sum != "" {
+		// A go.sum hash is not the hash of a file, as CycloneDX
+		// hashes are: record it as a Go-specific property.
+		comp.Properties = append(comp.Properties, cdxProperty{Name: "golang:h1", Value: c.sum})
+	}
+	if c.replaces != "" {
+		comp.Properties = append(comp.Properties, cdxProperty{Name: "golang:replaces", Value: c.replaces})
+	}
+	if c.dir != "" {
+		comp.Properties = append(comp.Properties, cdxProperty{Name: "golang:dir", Value: c.dir})
+	}
+	return comp
+}
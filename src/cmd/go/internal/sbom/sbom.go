@@ -0,0 +1,240 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sbom writes software bills of materials, in the SPDX and
+// CycloneDX formats, from the module information the go command embeds
+// in binaries.
+package sbom
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Formats lists the supported document formats.
+var Formats = []string{"spdx", "cyclonedx"}
+
+// ValidFormat reports whether format is one of Formats.
+func ValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildInfo is the build information of a binary: the modules it is
+// built from and the settings it is built with.
+type BuildInfo struct {
+	GoVersion string    // Go version used to build the binary
+	Path      string    // main package path
+	Main      Module    // module containing the main package
+	Deps      []*Module // module dependencies
+	Settings  []Setting // build settings, such as GOOS
+}
+
+// A Module is a module in a BuildInfo.
+type Module struct {
+	Path    string  // module path
+	Version string  // module version, or "(devel)" for a main module
+	Sum     string  // checksum from go.sum, such as "h1:..."
+	Replace *Module // replaced by this module
+}
+
+// A Setting is a key=value setting a binary is built with.
+type Setting struct {
+	Key, Value string
+}
+
+// ParseBuildInfo parses the module information embedded in a binary built
+// with Go version goVersion, in the format written by
+// cmd/go/internal/modload.PackageBuildInfo and printed by 'go version -m'.
+// Lines of the form "build\tkey=value", which record build settings,
+// are parsed into Settings.
+func ParseBuildInfo(goVersion, modinfo string) (*BuildInfo, error) {
+	bi := &BuildInfo{GoVersion: goVersion}
+	var last *Module
+	for lineNum, line := range strings.Split(modinfo, "\n") {
+		if line == "" {
+			continue
+		}
+		bad := func() error {
+			return fmt.Errorf("invalid build info line %d: %q", lineNum+1, line)
+		}
+		elem := strings.Split(line, "\t")
+		switch elem[0] {
+		case "path":
+			if len(elem) != 2 {
+				return nil, bad()
+			}
+			bi.Path = elem[1]
+		case "mod", "dep":
+			if len(elem) != 3 && len(elem) != 4 {
+				return nil, bad()
+			}
+			m := &Module{Path: elem[1], Version: elem[2]}
+			if len(elem) == 4 {
+				m.Sum = elem[3]
+			}
+			if elem[0] == "mod" {
+				bi.Main = *m
+				last = &bi.Main
+			} else {
+				bi.Deps = append(bi.Deps, m)
+				last = m
+			}
+		case "=>":
+			if len(elem) != 4 || last == nil {
+				return nil, bad()
+			}
+			last.Replace = &Module{Path: elem[1], Version: elem[2], Sum: elem[3]}
+			last = nil
+		case "build":
+			if len(elem) != 2 {
+				return nil, bad()
+			}
+			i := strings.Index(elem[1], "=")
+			if i < 0 {
+				return nil, bad()
+			}
+			bi.Settings = append(bi.Settings, Setting{elem[1][:i], elem[1][i+1:]})
+		}
+		// Ignore lines added by later versions of the go command.
+	}
+	if bi.Path == "" {
+		return nil, errors.New("no main package path in build info")
+	}
+	return bi, nil
+}
+
+// Write writes a bill of materials for bi to w, in the given format.
+func Write(w io.Writer, format string, bi *BuildInfo) error {
+	var doc interface{}
+	switch format {
+	case "spdx":
+		doc = spdxDocument(bi)
+	case "cyclonedx":
+		doc = cyclonedxDocument(bi)
+	default:
+		return fmt.Errorf("unknown SBOM format %q: must be one of %s", format, strings.Join(Formats, ", "))
+	}
+	data, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
+
+// A component is a module in a bill of materials, after applying
+// replacements: it describes the code the binary is built from.
+type component struct {
+	path     string // module path of the code
+	version  string // its version, or "" if unknown, as for a directory
+	sum      string // its go.sum hash, such as "h1:...", or ""
+	replaces string // module the code replaces, as path@version, or ""
+	dir      string // directory replacing the module, or ""
+}
+
+func newComponent(m *Module) component {
+	c := component{path: m.Path, version: m.Version, sum: m.Sum}
+	if r := m.Replace; r != nil {
+		c = component{path: r.Path, version: r.Version, sum: r.Sum, replaces: m.Path + "@" + m.Version}
+		if r.Version == "" {
+			// A directory has no module path or version of its own.
+			c.path, c.dir = m.Path, r.Path
+		}
+	}
+	if c.version == "(devel)" {
+		c.version = ""
+	}
+	return c
+}
+
+// purl returns the package URL identifying the component,
+// as described at https://github.com/package-url/purl-spec.
+func (c component) purl() string {
+	var b strings.Builder
+	b.WriteString("pkg:golang/")
+	for i, elem := range strings.Split(c.path, "/") {
+		if i > 0 {
+			b.WriteByte('/')
+		}
+		b.WriteString(purlEscape(elem))
+	}
+	if c.version != "" {
+		b.WriteString("@" + purlEscape(c.version))
+	}
+	return b.String()
+}
+
+// purlEscape percent-encodes the characters of s that
+// may not appear unencoded in a package URL.
+func purlEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '.' || c == '-' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// components returns the components of the main module and the
+// dependencies of bi. The main component has no module, and so no
+// version, if the binary was not built in module mode.
+func components(bi *BuildInfo) (main component, deps []component) {
+	main = newComponent(&bi.Main)
+	if main.path == "" {
+		main.path = bi.Path
+	}
+	for _, m := range bi.Deps {
+		deps = append(deps, newComponent(m))
+	}
+	return main, deps
+}
+
+// settings returns the build settings of bi to record in a document:
+// the Go version, as GOVERSION, followed by bi.Settings.
+func settings(bi *BuildInfo) []Setting {
+	var list []Setting
+	if bi.GoVersion != "" {
+		list = append(list, Setting{"GOVERSION", bi.GoVersion})
+	}
+	return append(list, bi.Settings...)
+}
+
+// newUUID returns a random (version 4) UUID, to identify a document.
+func newUUID() string {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(err)
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	h := hex.EncodeToString(u[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// timeNow is the creation time of documents, replaced in tests.
+var timeNow = func() time.Time { return time.Now() }
+
+func created() string {
+	return timeNow().UTC().Format(time.RFC3339)
+}
+
+// toolVersion is the version of the go command writing the document.
+var toolVersion = runtime.Version()
@@ -0,0 +1,197 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testModinfo = "path\texample.com/cmd/hello\n" +
+	"mod\texample.com\t(devel)\t\n" +
+	"dep\tgolang.org/x/text\tv0.3.7\th1:olpwvP2KacW1ZWvsR7uQhoyTYvKAupfQrRGBFM352Gk=\n" +
+	"dep\trsc.io/quote\tv1.5.2\n" +
+	"=>\texample.com/quote\tv1.5.3-fork+incompatible\th1:w5fcysjrx7yqtD/aO+QwRjYZOKnaM9Uh2b40tElTs3Y=\n" +
+	"dep\texample.org/local\tv1.0.0\th1:lnDyOYeIMMwqBEUvvRT0mqROH/DLcbpXVdvpY5Wevqc=\n" +
+	"=>\t../local\t\t\n" +
+	"build\t-compiler=gc\n" +
+	"build\tCGO_ENABLED=0\n" +
+	"build\tGOARCH=amd64\n" +
+	"build\tGOOS=linux\n"
+
+func TestParseBuildInfo(t *testing.T) {
+	bi, err := ParseBuildInfo("go1.18", testModinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &BuildInfo{
+		GoVersion: "go1.18",
+		Path:      "example.com/cmd/hello",
+		Main:      Module{Path: "example.com", Version: "(devel)"},
+		Deps: []*Module{
+			{Path: "golang.org/x/text", Version: "v0.3.7", Sum: "h1:olpwvP2KacW1ZWvsR7uQhoyTYvKAupfQrRGBFM352Gk="},
+			{Path: "rsc.io/quote", Version: "v1.5.2", Replace: &Module{Path: "example.com/quote", Version: "v1.5.3-fork+incompatible", Sum: "h1:w5fcysjrx7yqtD/aO+QwRjYZOKnaM9Uh2b40tElTs3Y="}},
+			{Path: "example.org/local", Version: "v1.0.0", Sum: "h1:lnDyOYeIMMwqBEUvvRT0mqROH/DLcbpXVdvpY5Wevqc=", Replace: &Module{Path: "../local"}},
+		},
+		Settings: []Setting{{"-compiler", "gc"}, {"CGO_ENABLED", "0"}, {"GOARCH", "amd64"}, {"GOOS", "linux"}},
+	}
+	if !reflect.DeepEqual(bi, want) {
+		t.Errorf("ParseBuildInfo:\nhave %+v\nwant %+v", bi, want)
+	}
+
+	for _, bad := range []string{
+		"",
+		"mod\texample.com\n",
+		"path\tx\n=>\texample.com\tv1.0.0\th1:x\n",
+		"path\tx\nbuild\tGOOS\n",
+	} {
+		if _, err := ParseBuildInfo("go1.18", bad); err == nil {
+			t.Errorf("ParseBuildInfo(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestPurl(t *testing.T) {
+	for _, tt := range []struct {
+		c    component
+		want string
+	}{
+		{component{path: "golang.org/x/text", version: "v0.3.7"}, "pkg:golang/golang.org/x/text@v0.3.7"},
+		{component{path: "example.com/quote", version: "v1.5.3-fork+incompatible"}, "pkg:golang/example.com/quote@v1.5.3-fork%2Bincompatible"},
+		{component{path: "example.com"}, "pkg:golang/example.com"},
+	} {
+		if got := tt.c.purl(); got != tt.want {
+			t.Errorf("purl(%+v) = %q, want %q", tt.c, got, tt.want)
+		}
+	}
+}
+
+func writeDoc(t *testing.T, format string) map[string]interface{} {
+	t.Helper()
+	defer func(old func() time.Time) { timeNow = old }(timeNow)
+	timeNow = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	bi, err := ParseBuildInfo("go1.18", testModinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, format, bi); err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("%s document is not valid JSON: %v\n%s", format, err, buf.Bytes())
+	}
+	return doc
+}
+
+// get returns the value at the given path of keys and indexes in doc,
+// or nil if there is none.
+func get(t *testing.T, doc interface{}, path ...interface{}) interface{} {
+	t.Helper()
+	v := doc
+	for _, key := range path {
+		switch key := key.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				t.Fatalf("no %v in document", path)
+			}
+			v = m[key]
+		case int:
+			a, ok := v.([]interface{})
+			if !ok {
+				t.Fatalf("no %v in document", path)
+			}
+			if key >= len(a) {
+				return nil
+			}
+			v = a[key]
+		}
+	}
+	return v
+}
+
+func TestSPDX(t *testing.T) {
+	doc := writeDoc(t, "spdx")
+	for _, tt := range []struct {
+		path []interface{}
+		want interface{}
+	}{
+		{[]interface{}{"spdxVersion"}, "SPDX-2.3"},
+		{[]interface{}{"name"}, "example.com/cmd/hello"},
+		{[]interface{}{"creationInfo", "created"}, "2023-01-02T03:04:05Z"},
+		{[]interface{}{"packages", 0, "name"}, "example.com"},
+		{[]interface{}{"packages", 0, "annotations", 0, "comment"}, "GOVERSION=go1.18"},
+		{[]interface{}{"packages", 0, "annotations", 2, "comment"}, "CGO_ENABLED=0"},
+		{[]interface{}{"packages", 1, "name"}, "golang.org/x/text"},
+		{[]interface{}{"packages", 1, "versionInfo"}, "v0.3.7"},
+		{[]interface{}{"packages", 1, "checksums"}, nil},
+		{[]interface{}{"packages", 1, "externalRefs", 0, "referenceLocator"}, "pkg:golang/golang.org/x/text@v0.3.7"},
+		{[]interface{}{"packages", 1, "externalRefs", 1, "referenceCategory"}, "OTHER"},
+		{[]interface{}{"packages", 1, "externalRefs", 1, "referenceType"}, "golang-h1"},
+		{[]interface{}{"packages", 1, "externalRefs", 1, "referenceLocator"}, "h1:olpwvP2KacW1ZWvsR7uQhoyTYvKAupfQrRGBFM352Gk="},
+		{[]interface{}{"packages", 2, "name"}, "example.com/quote"},
+		{[]interface{}{"packages", 2, "comment"}, "Replaces module rsc.io/quote@v1.5.2."},
+		{[]interface{}{"packages", 3, "name"}, "example.org/local"},
+		{[]interface{}{"packages", 3, "versionInfo"}, nil},
+		{[]interface{}{"packages", 3, "externalRefs", 1}, nil},
+		{[]interface{}{"packages", 3, "comment"}, "Replaces module example.org/local@v1.0.0 with directory ../local."},
+		{[]interface{}{"relationships", 0, "relationshipType"}, "DESCRIBES"},
+		{[]interface{}{"relationships", 2, "relationshipType"}, "DEPENDS_ON"},
+		{[]interface{}{"relationships", 2, "relatedSpdxElement"}, "SPDXRef-Dep-2"},
+	} {
+		if got := get(t, doc, tt.path...); got != tt.want {
+			t.Errorf("%v = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	if ns := get(t, doc, "documentNamespace").(string); !strings.HasPrefix(ns, "urn:uuid:") {
+		t.Errorf("documentNamespace = %q, want a UUID URN", ns)
+	}
+}
+
+func TestCycloneDX(t *testing.T) {
+	doc := writeDoc(t, "cyclonedx")
+	for _, tt := range []struct {
+		path []interface{}
+		want interface{}
+	}{
+		{[]interface{}{"bomFormat"}, "CycloneDX"},
+		{[]interface{}{"specVersion"}, "1.4"},
+		{[]interface{}{"metadata", "timestamp"}, "2023-01-02T03:04:05Z"},
+		{[]interface{}{"metadata", "component", "type"}, "application"},
+		{[]interface{}{"metadata", "component", "name"}, "example.com"},
+		{[]interface{}{"metadata", "component", "properties", 4, "name"}, "golang:build:GOOS"},
+		{[]interface{}{"metadata", "component", "properties", 4, "value"}, "linux"},
+		{[]interface{}{"components", 0, "purl"}, "pkg:golang/golang.org/x/text@v0.3.7"},
+		{[]interface{}{"components", 0, "hashes"}, nil},
+		{[]interface{}{"components", 0, "properties", 0, "name"}, "golang:h1"},
+		{[]interface{}{"components", 0, "properties", 0, "value"}, "h1:olpwvP2KacW1ZWvsR7uQhoyTYvKAupfQrRGBFM352Gk="},
+		{[]interface{}{"components", 1, "version"}, "v1.5.3-fork+incompatible"},
+		{[]interface{}{"components", 1, "properties", 1, "name"}, "golang:replaces"},
+		{[]interface{}{"components", 1, "properties", 1, "value"}, "rsc.io/quote@v1.5.2"},
+		{[]interface{}{"components", 2, "purl"}, "pkg:golang/example.org/local"},
+		{[]interface{}{"components", 2, "properties", 1, "name"}, "golang:dir"},
+		{[]interface{}{"components", 2, "properties", 1, "value"}, "../local"},
+		{[]interface{}{"dependencies", 0, "ref"}, "pkg:golang/example.com"},
+		{[]interface{}{"dependencies", 0, "dependsOn", 1}, "pkg:golang/example.com/quote@v1.5.3-fork%2Bincompatible"},
+	} {
+		if got := get(t, doc, tt.path...); got != tt.want {
+			t.Errorf("%v = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	err := Write(new(bytes.Buffer), "swid", &BuildInfo{Path: "m"})
+	if err == nil || !strings.Contains(err.Error(), "unknown SBOM format") {
+		t.Errorf("Write with unknown format: got error %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sbom
+
+import "fmt"
+
+// SPDX 2.3 documents, as described at https://spdx.github.io/spdx-spec/v2.3/.
+// Only the fields the go command can fill in are included.
+
+type spdxDoc struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+	Comment          string            `json:"comment,omitempty"`
+	Annotations      []spdxAnnotation  `json:"annotations,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxAnnotation struct {
+	AnnotationDate string `json:"annotationDate"`
+	AnnotationType string `json:"annotationType"`
+	Annotator      string `json:"annotator"`
+	Comment        string `json:"comment"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxNoAssertion is the value of fields the go command knows nothing about,
+// such as licenses.
+const spdxNoAssertion = "NOASSERTION"
+
+func spdxDocument(bi *BuildInfo) *spdxDoc {
+	now := created()
+	tool := "Tool: go-" + toolVersion
+	doc := &spdxDoc{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              bi.Path,
+		DocumentNamespace: "urn:uuid:" + newUUID(),
+		CreationInfo: spdxCreationInfo{
+			Created:  now,
+			Creators: []string{tool},
+		},
+	}
+
+	main, deps := components(bi)
+	mainPkg := spdxPackageFor(main, "SPDXRef-Main")
+	// The build settings describe the binary, that is, the main package.
+	for _, s := range settings(bi) {
+		mainPkg.Annotations = append(mainPkg.Annotations, spdxAnnotation{
+			AnnotationDate: now,
+			AnnotationType: "OTHER",
+			Annotator:      tool,
+			Comment:        s.Key + "=" + s.Value,
+		})
+	}
+	doc.Packages = append(doc.Packages, mainPkg)
+	doc.Relationships = append(doc.Relationships, spdxRelationship{
+		SPDXElementID:      doc.SPDXID,
+		RelationshipType:   "DESCRIBES",
+		RelatedSPDXElement: mainPkg.SPDXID,
+	})
+	for i, c := range deps {
+		pkg := spdxPackageFor(c, fmt.Sprintf("SPDXRef-Dep-%d", i+1))
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      mainPkg.SPDXID,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: pkg.SPDXID,
+		})
+	}
+	return doc
+}
+
+func spdxPackageFor(c component, id string) spdxPackage {
+	pkg := spdxPackage{
+		Name:             c.path,
+		SPDXID:           id,
+		VersionInfo:      c.version,
+		DownloadLocation: spdxNoAssertion,
+		LicenseConcluded: spdxNoAssertion,
+		LicenseDeclared:  spdxNoAssertion,
+		CopyrightText:    spdxNoAssertion,
+		ExternalRefs: []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER",
+			ReferenceType:     "purl",
+			ReferenceLocator:  c.purl(),
+		}},
+	}
+	if c.sum != "" {
+		// A go.sum hash is not the checksum of a file, as SPDX
+		// checksums are: record it as a Go-specific reference.
+		pkg.ExternalRefs = append(pkg.ExternalRefs, spdxExternalRef{
+			ReferenceCategory: "OTHER",
+			ReferenceType:     "golang-h1",
+			ReferenceLocator:  c.sum,
+		})
+	}
+	switch {
+	case c.dir != "":
+		pkg.Comment = "Replaces module " + c.replaces + " with directory " + c.dir + "."
+	case c.replaces != "":
+		pkg.Comment = "Replaces module " + c.replaces + "."
+	}
+	return pkg
+}
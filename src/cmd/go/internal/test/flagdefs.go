@@ -19,6 +19,9 @@ var passFlagToTest = map[string]bool{
 	"cpu":                  true,
 	"cpuprofile":           true,
 	"failfast":             true,
+	"fuzz":                 true,
+	"fuzzminimizetime":     true,
+	"fuzztime":             true,
 	"list":                 true,
 	"memprofile":           true,
 	"memprofilerate":       true,
@@ -27,6 +30,7 @@ var passFlagToTest = map[string]bool{
 	"outputdir":            true,
 	"parallel":             true,
 	"run":                  true,
+	"shard":                true,
 	"short":                true,
 	"shuffle":              true,
 	"timeout":              true,
@@ -0,0 +1,175 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// A failedPackage records the failures of a package in a previous run of
+// 'go test -json', as read for the -rerun-failed flag.
+type failedPackage struct {
+	tests  []string        // failed top-level tests, in the order they failed
+	failed map[string]bool // set of tests
+}
+
+// rerunAll reports whether the whole package must be run again, because it
+// failed without any failing test, as when the test binary panics in an
+// init function or TestMain.
+func (f *failedPackage) rerunAll() bool {
+	return len(f.tests) == 0
+}
+
+// rerun maps the import path of each package rerun by -rerun-failed to
+// its failures in the previous run. It is nil if -rerun-failed is not set.
+var rerun map[string]*failedPackage
+
+// readFailedTests reads the events written by 'go test -json' from file and
+// returns the packages that failed, keyed by import path. Lines that are not
+// test events, such as build events or output interleaved by a script, are
+// ignored.
+func readFailedTests(file string) (map[string]*failedPackage, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	failed := make(map[string]*failedPackage)
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var e struct {
+			Action  string
+			Package string
+			Test    string
+		}
+		if err := json.Unmarshal(line, &e); err != nil || e.Action != "fail" || e.Package == "" {
+			continue
+		}
+		p := failed[e.Package]
+		if p == nil {
+			p = &failedPackage{failed: make(map[string]bool)}
+			failed[e.Package] = p
+		}
+		if e.Test == "" {
+			continue
+		}
+		name := e.Test
+		if i := strings.Index(name, "/"); i >= 0 {
+			// A failing subtest fails its parent as well;
+			// rerun the top-level test.
+			name = name[:i]
+		}
+		if isBenchmark(name) {
+			// Drop the -GOMAXPROCS suffix of a benchmark result.
+			// A Go identifier cannot contain '-'.
+			if i := strings.Index(name, "-"); i >= 0 {
+				name = name[:i]
+			}
+		}
+		if !p.failed[name] {
+			p.failed[name] = true
+			p.tests = append(p.tests, name)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", file, err)
+	}
+	return failed, nil
+}
+
+// isBenchmark reports whether the top-level test name is a benchmark,
+// which runs only when selected by -test.bench.
+func isBenchmark(name string) bool {
+	return strings.HasPrefix(name, "Benchmark")
+}
+
+// rerunArgs returns the flags that make a test binary run exactly the
+// failed tests of f: the tests and examples through -test.run, and the
+// benchmarks through -test.bench. It returns nil if the whole package
+// must be run again.
+func (f *failedPackage) rerunArgs() []string {
+	if f.rerunAll() {
+		return nil
+	}
+	var tests, benchmarks []string
+	for _, name := range f.tests {
+		if isBenchmark(name) {
+			benchmarks = append(benchmarks, name)
+		} else {
+			tests = append(tests, name)
+		}
+	}
+	if len(tests) == 0 {
+		// Run only the benchmarks.
+		return []string{"-test.run=^$", "-test.bench=" + rerunPattern(benchmarks)}
+	}
+	args := []string{"-test.run=" + rerunPattern(tests)}
+	if len(benchmarks) > 0 {
+		args = append(args, "-test.bench="+rerunPattern(benchmarks))
+	}
+	return args
+}
+
+// rerunPattern returns a pattern matching exactly the given
+// top-level tests.
+func rerunPattern(tests []string) string {
+	quoted := make([]string, len(tests))
+	for i, name := range tests {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
+
+// readPassedTests returns the set of top-level tests that the test log
+// written by a test binary records as passing. It returns nil if the
+// log cannot be read, as when the test binary did not finish.
+func readPassedTests(file string) map[string]bool {
+	data, err := os.ReadFile(file)
+	if err != nil || !bytes.HasPrefix(data, testlogMagic) {
+		return nil
+	}
+	var passed map[string]bool
+	for _, line := range bytes.Split(data[len(testlogMagic):], []byte("\n")) {
+		if name := bytes.TrimPrefix(line, passOp); len(name) < len(line) {
+			if passed == nil {
+				passed = make(map[string]bool)
+			}
+			passed[string(name)] = true
+		}
+	}
+	return passed
+}
+
+var passOp = []byte("pass ")
+
+// reportFlaky prints a line to w for each test in f that passed when it was
+// run again, according to passed. For a package rerun as a whole,
+// pkgPassed reports whether the package passed.
+func reportFlaky(w io.Writer, importPath string, f *failedPackage, passed map[string]bool, pkgPassed bool) {
+	if f.rerunAll() {
+		if pkgPassed {
+			fmt.Fprintf(w, "--- FLAKY: %s (passed on retry)\n", importPath)
+		}
+		return
+	}
+	for _, name := range f.tests {
+		if passed[name] {
+			fmt.Fprintf(w, "--- FLAKY: %s (passed on retry)\n", name)
+		}
+	}
+}
@@ -7,7 +7,6 @@ package test
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
 	"errors"
 	"fmt"
 	"go/build"
@@ -15,13 +14,11 @@ import (
 	"io"
 	"io/fs"
 	"os"
-	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"cmd/go/internal/base"
@@ -34,6 +31,7 @@ import (
 	"cmd/go/internal/trace"
 	"cmd/go/internal/work"
 	"cmd/internal/str"
+	"cmd/internal/sys"
 	"cmd/internal/test2json"
 )
 
@@ -61,8 +59,8 @@ followed by detailed output for each failed package.
 
 'Go test' recompiles each package along with any files with names matching
 the file pattern "*_test.go".
-These additional files can contain test functions, benchmark functions, and
-example functions. See 'go help testfunc' for more.
+These additional files can contain test functions, benchmark functions, fuzz
+targets, and example functions. See 'go help testfunc' for more.
 Each listed package causes the execution of a separate test binary.
 Files whose names begin with "_" (including "_test.go") or "." are ignored.
 
@@ -121,7 +119,7 @@ elapsed time in the summary line.
 The rule for a match in the cache is that the run involves the same
 test binary and the flags on the command line come entirely from a
 restricted set of 'cacheable' test flags, defined as -benchtime, -cpu,
--list, -parallel, -run, -short, -timeout, -failfast, and -v.
+-list, -parallel, -run, -shard, -short, -timeout, -failfast, and -v.
 If a run of go test has any test or non-test flags outside this set,
 the result is not cached. To disable test caching, use any test flag
 or argument other than the cacheable flags. The idiomatic way to disable
@@ -162,6 +160,19 @@ In addition to the build flags, the flags handled by 'go test' itself are:
 	    Compile the test binary to the named file.
 	    The test still runs (unless -c or -i is specified).
 
+	-rerun-failed file
+	    Run only the tests that failed in a previous run, as recorded in
+	    file by 'go test -json'. Failing top-level tests, examples and
+	    benchmarks are run again in each package that had them; a
+	    package that failed without a failing test, for example by
+	    panicking in TestMain, is run again as a whole. Each test that
+	    passes on retry is reported in a "--- FLAKY:" line. The run
+	    still fails, so that flaky tests are not hidden: a package whose
+	    tests all pass on retry is reported as FAIL, marked [flaky].
+	    Packages that did not fail are not run, and the flag cannot be
+	    combined with -run or -bench. Tests that pass on retry are not
+	    reported when test binaries are run by -exec.
+
 The test binary also accepts flags that control execution of the test; these
 flags are also accessible by 'go test'. See 'go help testflag' for details.
 
@@ -244,6 +255,29 @@ control the execution of any test:
 	-failfast
 	    Do not start new tests after the first test failure.
 
+	-fuzz regexp
+	    Run the fuzz target matching the regular expression. When specified,
+	    the command line argument must match exactly one package, and regexp
+	    must match exactly one fuzz target within that package. Fuzzing
+	    will occur after tests, benchmarks, seed corpora of other fuzz
+	    targets, and examples have completed. See the Fuzzing section of
+	    the testing package documentation for details.
+
+	-fuzztime t
+	    Run enough iterations of the fuzz target during fuzzing to take t,
+	    specified as a time.Duration (for example, -fuzztime 1h30s).
+	    The default is to run forever.
+	    The special syntax Nx means to run the fuzz target N times
+	    (for example, -fuzztime 1000x).
+
+	-fuzzminimizetime t
+	    Run enough iterations of the fuzz target during each minimization
+	    attempt to take t, as specified as a time.Duration (for example,
+	    -fuzzminimizetime 30s).
+	    The default is 60s.
+	    The special syntax Nx means to run the fuzz target N times
+	    (for example, -fuzzminimizetime 100x).
+
 	-json
 	    Log verbose output and test results in JSON. This presents the
 	    same information as the -v flag in a machine-readable format.
@@ -263,7 +297,8 @@ control the execution of any test:
 	    (see 'go help build').
 
 	-run regexp
-	    Run only those tests and examples matching the regular expression.
+	    Run only those tests, examples, and fuzz targets matching the regular
+	    expression.
 	    For tests, the regular expression is split by unbracketed slash (/)
 	    characters into a sequence of regular expressions, and each part
 	    of a test's identifier must match the corresponding element in
@@ -272,6 +307,13 @@ control the execution of any test:
 	    of all tests matching X, even those without sub-tests matching Y,
 	    because it must run them to look for those sub-tests.
 
+	-shard i/n
+	    Run only shard i of n of the top-level tests, examples, fuzz
+	    targets and benchmarks, counting from 0. The tests are assigned
+	    to shards in the order they appear in the source, so running
+	    shards 0 through n-1 runs each test exactly once. Sharding
+	    applies before -run, -bench and -shuffle.
+
 	-short
 	    Tell long-running tests to shorten their run time.
 	    It is off by default but set during all.bash so that installing
@@ -289,6 +331,7 @@ control the execution of any test:
 	    If a test binary runs longer than duration d, panic.
 	    If d is 0, the timeout is disabled.
 	    The default is 10 minutes (10m).
+	    The timeout does not apply to fuzzing with -fuzz.
 
 	-v
 	    Verbose output: log all tests as they are run. Also print all
@@ -424,8 +467,8 @@ var HelpTestfunc = &base.Command{
 	UsageLine: "testfunc",
 	Short:     "testing functions",
 	Long: `
-The 'go test' command expects to find test, benchmark, and example functions
-in the "*_test.go" files corresponding to the package under test.
+The 'go test' command expects to find test, benchmark, fuzz, and example
+functions in the "*_test.go" files corresponding to the package under test.
 
 A test function is one named TestXxx (where Xxx does not start with a
 lower case letter) and should have the signature,
@@ -436,6 +479,10 @@ A benchmark function is one named BenchmarkXxx and should have the signature,
 
 	func BenchmarkXxx(b *testing.B) { ... }
 
+A fuzz target is one named FuzzXxx and should have the signature,
+
+	func FuzzXxx(f *testing.F) { ... }
+
 An example function is similar to a test function but, instead of using
 *testing.T to report success or failure, prints output to os.Stdout.
 If the last comment in the function starts with "Output:" then the output
@@ -475,7 +522,7 @@ Here is another example where the ordering of the output is ignored:
 
 The entire test file is presented as the example when it contains a single
 example function, at least one other function, type, variable, or constant
-declaration, and no test or benchmark functions.
+declaration, and no test, benchmark, or fuzz functions.
 
 See the documentation of the testing package for more information.
 `,
@@ -489,10 +536,12 @@ var (
 	testCoverPaths   []string                          // -coverpkg flag
 	testCoverPkgs    []*load.Package                   // -coverpkg flag
 	testCoverProfile string                            // -coverprofile flag
+	testFuzz         string                            // -fuzz flag
 	testJSON         bool                              // -json flag
 	testList         string                            // -list flag
 	testO            string                            // -o flag
 	testOutputDir    outputdirFlag                     // -outputdir flag
+	testRerunFailed  string                            // -rerun-failed flag
 	testShuffle      shuffleFlag                       // -shuffle flag
 	testTimeout      time.Duration                     // -timeout flag
 	testV            bool                              // -v flag
@@ -616,6 +665,30 @@ func runTest(ctx context.Context, cmd *base.Command, args []string) {
 		base.Fatalf("no packages to test")
 	}
 
+	if testRerunFailed != "" {
+		failed, err := readFailedTests(testRerunFailed)
+		if err != nil {
+			base.Fatalf("go test: -rerun-failed: %v", err)
+		}
+		var rerunPkgs []*load.Package
+		for _, p := range pkgs {
+			if failed[p.ImportPath] != nil {
+				rerunPkgs = append(rerunPkgs, p)
+			}
+		}
+		if len(rerunPkgs) == 0 {
+			fmt.Fprintf(os.Stderr, "go test: no failed tests in %s\n", testRerunFailed)
+			return
+		}
+		pkgs = rerunPkgs
+		rerun = failed
+		if execCmd := work.FindExecCmd(); len(execCmd) > 0 {
+			// The test log that records which tests pass is written
+			// only when the test binary is run directly.
+			fmt.Fprintf(os.Stderr, "warning: -rerun-failed cannot report flaky tests when test binaries are run by %s\n", execCmd[0])
+		}
+	}
+
 	if testC && len(pkgs) != 1 {
 		base.Fatalf("cannot use -c flag with multiple packages")
 	}
@@ -625,6 +698,12 @@ func runTest(ctx context.Context, cmd *base.Command, args []string) {
 	if testProfile() != "" && len(pkgs) != 1 {
 		base.Fatalf("cannot use %s flag with multiple packages", testProfile())
 	}
+	if testFuzz != "" && len(pkgs) != 1 {
+		base.Fatalf("cannot use -fuzz flag with multiple packages")
+	}
+	if testFuzz != "" && !sys.FuzzSupported(cfg.Goos, cfg.Goarch) {
+		base.Fatalf("-fuzz flag is not supported on %s/%s", cfg.Goos, cfg.Goarch)
+	}
 	initCoverProfile()
 	defer closeCoverProfile()
 
@@ -632,7 +711,9 @@ func runTest(ctx context.Context, cmd *base.Command, args []string) {
 	// to that timeout plus one minute. This is a backup alarm in case
 	// the test wedges with a goroutine spinning and its background
 	// timer does not get a chance to fire.
-	if testTimeout > 0 {
+	// The timeout does not apply to fuzzing, which runs until -fuzztime
+	// elapses or it is interrupted.
+	if testTimeout > 0 && testFuzz == "" {
 		testKillTimeout = testTimeout + 1*time.Minute
 	}
 
@@ -775,13 +856,37 @@ func runTest(ctx context.Context, cmd *base.Command, args []string) {
 			coverFiles = append(coverFiles, p.GoFiles...)
 			coverFiles = append(coverFiles, p.CgoFiles...)
 			coverFiles = append(coverFiles, p.TestGoFiles...)
-			p.Internal.CoverVars = declareCoverVars(p, coverFiles...)
+			p.Internal.CoverVars = load.DeclareCoverVars(p, coverFiles...)
 			if testCover && testCoverMode == "atomic" {
 				ensureImport(p, "sync/atomic")
 			}
 		}
 	}
 
+	if testFuzz != "" && sys.FuzzInstrumented(cfg.Goos, cfg.Goarch) {
+		// Instrument the package under test and its dependencies for
+		// coverage-guided fuzzing. Packages the fuzzing engine itself runs
+		// on are skipped: their coverage says nothing about the code being
+		// fuzzed, and some of them are built in ways the instrumentation
+		// does not support.
+		skipInstrumentation := map[string]bool{
+			"context":       true,
+			"internal/fuzz": true,
+			"reflect":       true,
+			"runtime":       true,
+			"sync":          true,
+			"sync/atomic":   true,
+			"syscall":       true,
+			"testing":       true,
+			"time":          true,
+		}
+		for _, p := range load.TestPackageList(ctx, pkgOpts, pkgs) {
+			if !skipInstrumentation[p.ImportPath] && !strings.HasPrefix(p.ImportPath, "runtime/internal/") {
+				p.Internal.FuzzInstrument = true
+			}
+		}
+	}
+
 	// Prepare build + run + print actions for all packages being tested.
 	for _, p := range pkgs {
 		// sync/atomic import is inserted by the cover tool. See #18486
@@ -876,7 +981,7 @@ func builderTest(b *work.Builder, ctx context.Context, pkgOpts load.PackageOpts,
 			Local:    testCover && testCoverPaths == nil,
 			Pkgs:     testCoverPkgs,
 			Paths:    testCoverPaths,
-			DeclVars: declareCoverVars,
+			DeclVars: load.DeclareCoverVars,
 		}
 	}
 	pmain, ptest, pxtest, err := load.TestPackagesFor(ctx, pkgOpts, p, cover)
@@ -1042,50 +1147,6 @@ func addTestVet(b *work.Builder, p *load.Package, runAction, installAction *work
 	}
 }
 
-// isTestFile reports whether the source file is a set of tests and should therefore
-// be excluded from coverage analysis.
-func isTestFile(file string) bool {
-	// We don't cover tests, only the code they test.
-	return strings.HasSuffix(file, "_test.go")
-}
-
-// declareCoverVars attaches the required cover variables names
-// to the files, to be used when annotating the files.
-func declareCoverVars(p *load.Package, files ...string) map[string]*load.CoverVar {
-	coverVars := make(map[string]*load.CoverVar)
-	coverIndex := 0
-	// We create the cover counters as new top-level variables in the package.
-	// We need to avoid collisions with user variables (GoCover_0 is unlikely but still)
-	// and more importantly with dot imports of other covered packages,
-	// so we append 12 hex digits from the SHA-256 of the import path.
-	// The point is only to avoid accidents, not to defeat users determined to
-	// break things.
-	sum := sha256.Sum256([]byte(p.ImportPath))
-	h := fmt.Sprintf("%x", sum[:6])
-	for _, file := range files {
-		if isTestFile(file) {
-			continue
-		}
-		// For a package that is "local" (imported via ./ import or command line, outside GOPATH),
-		// we record the full path to the file name.
-		// Otherwise we record the import path, then a forward slash, then the file name.
-		// This makes profiles within GOPATH file system-independent.
-		// These names appear in the cmd/cover HTML interface.
-		var longFile string
-		if p.Internal.Local {
-			longFile = filepath.Join(p.Dir, file)
-		} else {
-			longFile = path.Join(p.ImportPath, file)
-		}
-		coverVars[file] = &load.CoverVar{
-			File: longFile,
-			Var:  fmt.Sprintf("GoCover_%d_%x", coverIndex, h),
-		}
-		coverIndex++
-	}
-	return coverVars
-}
-
 var noTestsToRun = []byte("\ntesting: warning: no tests to run\n")
 
 type runCache struct {
@@ -1096,20 +1157,13 @@ type runCache struct {
 	id2 cache.ActionID
 }
 
-// stdoutMu and lockedStdout provide a locked standard output
-// that guarantees never to interlace writes from multiple
-// goroutines, so that we can have multiple JSON streams writing
-// to a lockedStdout simultaneously and know that events will
-// still be intelligible.
-var stdoutMu sync.Mutex
+// errBuildFailed is reported to test2json for a test binary that could not
+// be built.
+var errBuildFailed = errors.New("build failed")
 
-type lockedStdout struct{}
-
-func (lockedStdout) Write(b []byte) (int, error) {
-	stdoutMu.Lock()
-	defer stdoutMu.Unlock()
-	return os.Stdout.Write(b)
-}
+// errFlaky is reported to test2json for a package whose previously failed
+// tests all pass when run again by -rerun-failed.
+var errFlaky = errors.New("failed tests passed on retry")
 
 // builderRunTest is the action for running a test binary.
 func (c *runCache) builderRunTest(b *work.Builder, ctx context.Context, a *work.Action) error {
@@ -1117,7 +1171,15 @@ func (c *runCache) builderRunTest(b *work.Builder, ctx context.Context, a *work.
 		// We were unable to build the binary.
 		a.Failed = false
 		a.TestOutput = new(bytes.Buffer)
-		fmt.Fprintf(a.TestOutput, "FAIL\t%s [build failed]\n", a.Package.ImportPath)
+		var stdout io.Writer = a.TestOutput
+		if testJSON {
+			json := test2json.NewConverter(a.TestOutput, a.Package.ImportPath, test2json.Timestamp)
+			json.SetFailedBuild(a.FailedBuild)
+			json.Exited(errBuildFailed)
+			defer json.Close()
+			stdout = json
+		}
+		fmt.Fprintf(stdout, "FAIL\t%s [build failed]\n", a.Package.ImportPath)
 		base.SetExitStatus(1)
 		return nil
 	}
@@ -1125,7 +1187,7 @@ func (c *runCache) builderRunTest(b *work.Builder, ctx context.Context, a *work.
 	var stdout io.Writer = os.Stdout
 	var err error
 	if testJSON {
-		json := test2json.NewConverter(lockedStdout{}, a.Package.ImportPath, test2json.Timestamp)
+		json := test2json.NewConverter(work.LockedStdout{}, a.Package.ImportPath, test2json.Timestamp)
 		defer func() {
 			json.Exited(err)
 			json.Close()
@@ -1185,12 +1247,24 @@ func (c *runCache) builderRunTest(b *work.Builder, ctx context.Context, a *work.
 	}
 
 	execCmd := work.FindExecCmd()
+	failed := rerun[a.Package.ImportPath]
 	testlogArg := []string{}
-	if !c.disableCache && len(execCmd) == 0 {
+	if (!c.disableCache || failed != nil) && len(execCmd) == 0 {
+		// The test log records the inputs of the test for the cache,
+		// and the tests that pass, for -rerun-failed.
 		testlogArg = []string{"-test.testlogfile=" + a.Objdir + "testlog.txt"}
 	}
 	panicArg := "-test.paniconexit0"
-	args := str.StringList(execCmd, a.Deps[0].BuiltTarget(), testlogArg, panicArg, testArgs)
+	fuzzArg := []string{}
+	if testFuzz != "" {
+		fuzzCacheDir := filepath.Join(cache.Default().FuzzDir(), a.Package.ImportPath)
+		fuzzArg = []string{"-test.fuzzcachedir=" + fuzzCacheDir}
+	}
+	rerunArg := []string{}
+	if failed != nil {
+		rerunArg = failed.rerunArgs()
+	}
+	args := str.StringList(execCmd, a.Deps[0].BuiltTarget(), testlogArg, panicArg, fuzzArg, rerunArg, testArgs)
 
 	if testCoverProfile != "" {
 		// Write coverage to temporary profile, for merging later.
@@ -1275,7 +1349,19 @@ func (c *runCache) builderRunTest(b *work.Builder, ctx context.Context, a *work.
 
 	mergeCoverProfile(cmd.Stdout, a.Objdir+"_cover_.out")
 
-	if err == nil {
+	if failed != nil {
+		reportFlaky(cmd.Stdout, a.Package.ImportPath, failed, readPassedTests(a.Objdir+"testlog.txt"), err == nil)
+	}
+
+	if err == nil && failed != nil {
+		// Every test that failed before passes now. The package still
+		// fails, so that flaky tests aren't hidden, and it is reported
+		// as failed so that text and JSON output agree with the exit
+		// status.
+		base.SetExitStatus(1)
+		fmt.Fprintf(cmd.Stdout, "FAIL\t%s\t%s [flaky]\n", a.Package.ImportPath, t)
+		err = errFlaky
+	} else if err == nil {
 		norun := ""
 		if !testShowPass() && !testJSON {
 			buf.Reset()
@@ -1303,8 +1389,8 @@ func (c *runCache) builderRunTest(b *work.Builder, ctx context.Context, a *work.
 		fmt.Fprintf(cmd.Stdout, "FAIL\t%s\t%s\n", a.Package.ImportPath, t)
 	}
 
-	if cmd.Stdout != &buf {
-		buf.Reset() // cmd.Stdout was going to os.Stdout already
+	if stdout != &buf {
+		buf.Reset() // stdout was going to os.Stdout already
 	}
 	return nil
 }
@@ -1327,6 +1413,15 @@ func (c *runCache) tryCacheWithID(b *work.Builder, a *work.Action, id string) bo
 		return false
 	}
 
+	if testRerunFailed != "" {
+		// The point of rerunning failed tests is to run them.
+		if cache.DebugTest {
+			fmt.Fprintf(os.Stderr, "testcache: caching disabled for -rerun-failed\n")
+		}
+		c.disableCache = true
+		return false
+	}
+
 	if a.Package.Root == "" {
 		// Caching does not apply to tests outside of any module, GOPATH, or GOROOT.
 		if cache.DebugTest {
@@ -1352,6 +1447,7 @@ func (c *runCache) tryCacheWithID(b *work.Builder, a *work.Action, id string) bo
 			"-test.list",
 			"-test.parallel",
 			"-test.run",
+			"-test.shard",
 			"-test.short",
 			"-test.timeout",
 			"-test.failfast",
@@ -1513,6 +1609,9 @@ func computeTestInputsID(a *work.Action, testlog []byte) (cache.ActionID, error)
 				fmt.Fprintf(os.Stderr, "testcache: %s: input list malformed (%q)\n", a.Package.ImportPath, line)
 			}
 			return cache.ActionID{}, errBadTestInputs
+		case "pass":
+			// A test that passed, recorded for -rerun-failed.
+			// It is not an input of the test.
 		case "getenv":
 			fmt.Fprintf(h, "env %s %x\n", name, hashGetenv(name))
 		case "chdir":
@@ -1711,7 +1810,7 @@ func builderPrintTest(b *work.Builder, ctx context.Context, a *work.Action) erro
 func builderNoTest(b *work.Builder, ctx context.Context, a *work.Action) error {
 	var stdout io.Writer = os.Stdout
 	if testJSON {
-		json := test2json.NewConverter(lockedStdout{}, a.Package.ImportPath, test2json.Timestamp)
+		json := test2json.NewConverter(work.LockedStdout{}, a.Package.ImportPath, test2json.Timestamp)
 		defer json.Close()
 		stdout = json
 	}
@@ -41,6 +41,7 @@ func init() {
 
 	cf.Var((*base.StringsFlag)(&work.ExecCmd), "exec", "")
 	cf.BoolVar(&testJSON, "json", false, "")
+	cf.StringVar(&testRerunFailed, "rerun-failed", "", "")
 	cf.Var(&testVet, "vet", "")
 
 	// Register flags to be forwarded to the test binary. We retain variables for
@@ -57,6 +58,9 @@ func init() {
 	cf.String("cpu", "", "")
 	cf.StringVar(&testCPUProfile, "cpuprofile", "", "")
 	cf.Bool("failfast", false, "")
+	cf.StringVar(&testFuzz, "fuzz", "", "")
+	cf.String("fuzzminimizetime", "", "")
+	cf.String("fuzztime", "", "")
 	cf.StringVar(&testList, "list", "", "")
 	cf.StringVar(&testMemProfile, "memprofile", "", "")
 	cf.String("memprofilerate", "", "")
@@ -65,6 +69,7 @@ func init() {
 	cf.Var(&testOutputDir, "outputdir", "")
 	cf.Int("parallel", 0, "")
 	cf.String("run", "", "")
+	cf.String("shard", "", "")
 	cf.Bool("short", false, "")
 	cf.DurationVar(&testTimeout, "timeout", 10*time.Minute, "")
 	cf.StringVar(&testTrace, "trace", "", "")
@@ -390,6 +395,9 @@ func testFlags(args []string) (packageNames, passToTest []string) {
 
 	var injectedFlags []string
 	if testJSON {
+		// Report build output as JSON events interlaced with the test events.
+		cfg.BuildJSON = true
+
 		// If converting to JSON, we need the full output in order to pipe it to
 		// test2json.
 		injectedFlags = append(injectedFlags, "-test.v=true")
@@ -400,7 +408,7 @@ func testFlags(args []string) (packageNames, passToTest []string) {
 	// Inject flags from GOFLAGS before the explicit command-line arguments.
 	// (They must appear before the flag terminator or first non-flag argument.)
 	// Also determine whether flags with awkward defaults have already been set.
-	var timeoutSet, outputDirSet bool
+	var timeoutSet, outputDirSet, runSet, benchSet bool
 	CmdTest.Flag.Visit(func(f *flag.Flag) {
 		short := strings.TrimPrefix(f.Name, "test.")
 		if addFromGOFLAGS[f.Name] {
@@ -411,9 +419,40 @@ func testFlags(args []string) (packageNames, passToTest []string) {
 			timeoutSet = true
 		case "outputdir":
 			outputDirSet = true
+		case "run":
+			runSet = true
+		case "bench":
+			benchSet = true
 		}
 	})
 
+	// -rerun-failed selects the tests to run in each package itself,
+	// with flags that -run or -bench would override, including when
+	// passed straight to the test binary, as after -args.
+	if testRerunFailed != "" {
+		for _, arg := range explicitArgs {
+			if arg == "--" {
+				break
+			}
+			name := strings.TrimLeft(arg, "-")
+			if i := strings.Index(name, "="); i >= 0 {
+				name = name[:i]
+			}
+			switch name {
+			case "test.run":
+				runSet = true
+			case "test.bench":
+				benchSet = true
+			}
+		}
+		if runSet {
+			base.Fatalf("go test: -rerun-failed cannot be used with -run")
+		}
+		if benchSet {
+			base.Fatalf("go test: -rerun-failed cannot be used with -bench")
+		}
+	}
+
 	// 'go test' has a default timeout, but the test binary itself does not.
 	// If the timeout wasn't set (and forwarded) explicitly, add the default
 	// timeout to the command line.
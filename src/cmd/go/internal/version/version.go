@@ -17,10 +17,11 @@ import (
 	"strings"
 
 	"cmd/go/internal/base"
+	"cmd/go/internal/sbom"
 )
 
 var CmdVersion = &base.Command{
-	UsageLine: "go version [-m] [-v] [file ...]",
+	UsageLine: "go version [-m] [-v] [-sbom=format] [file ...]",
 	Short:     "print Go version",
 	Long: `Version prints the build information for Go executables.
 
@@ -40,6 +41,17 @@ module version information, when available. In the output, the module
 information consists of multiple lines following the version line, each
 indented by a leading tab character.
 
+The -sbom flag, used with -m, causes go version to print a software bill
+of materials for each executable instead, built from its module
+information. The format is "spdx" for an SPDX 2.3 JSON document, or
+"cyclonedx" for a CycloneDX 1.4 JSON document. The bill of materials
+describes the executable's main module and the modules it depends on,
+with their go.sum hashes, and records the Go version and settings the
+executable was built with, such as GOOS, GOARCH, and CGO_ENABLED. Each
+document is printed on standard output; for several executables, the
+documents follow each other. 'go mod sbom' prints the same document for
+a main package without building it.
+
 See also: go doc runtime/debug.BuildInfo.
 `,
 }
@@ -49,8 +61,9 @@ func init() {
 }
 
 var (
-	versionM = CmdVersion.Flag.Bool("m", false, "")
-	versionV = CmdVersion.Flag.Bool("v", false, "")
+	versionM    = CmdVersion.Flag.Bool("m", false, "")
+	versionV    = CmdVersion.Flag.Bool("v", false, "")
+	versionSBOM = CmdVersion.Flag.String("sbom", "", "")
 )
 
 func runVersion(ctx context.Context, cmd *base.Command, args []string) {
@@ -62,7 +75,7 @@ func runVersion(ctx context.Context, cmd *base.Command, args []string) {
 		// a reasonable use case. For example, imagine GOFLAGS=-v to
 		// turn "verbose mode" on for all Go commands, which should not
 		// break "go version".
-		if (!base.InGOFLAGS("-m") && *versionM) || (!base.InGOFLAGS("-v") && *versionV) {
+		if (!base.InGOFLAGS("-m") && *versionM) || (!base.InGOFLAGS("-v") && *versionV) || (!base.InGOFLAGS("-sbom") && *versionSBOM != "") {
 			fmt.Fprintf(os.Stderr, "go version: flags can only be used with arguments\n")
 			base.SetExitStatus(2)
 			return
@@ -71,6 +84,19 @@ func runVersion(ctx context.Context, cmd *base.Command, args []string) {
 		return
 	}
 
+	if *versionSBOM != "" {
+		if !*versionM {
+			fmt.Fprintf(os.Stderr, "go version: -sbom requires -m\n")
+			base.SetExitStatus(2)
+			return
+		}
+		if !sbom.ValidFormat(*versionSBOM) {
+			fmt.Fprintf(os.Stderr, "go version: invalid -sbom format %q: must be one of %s\n", *versionSBOM, strings.Join(sbom.Formats, ", "))
+			base.SetExitStatus(2)
+			return
+		}
+	}
+
 	for _, arg := range args {
 		info, err := os.Stat(arg)
 		if err != nil {
@@ -152,12 +178,38 @@ func scanFile(file string, info fs.FileInfo, mustPrint bool) {
 		return
 	}
 
+	if *versionSBOM != "" {
+		writeSBOM(file, vers, mod, mustPrint)
+		return
+	}
+
 	fmt.Printf("%s: %s\n", file, vers)
 	if *versionM && mod != "" {
 		fmt.Printf("\t%s\n", strings.ReplaceAll(mod[:len(mod)-1], "\n", "\n\t"))
 	}
 }
 
+// writeSBOM prints a bill of materials for file, an executable built with
+// Go version vers and module information mod. If mustPrint is false,
+// writeSBOM skips executables without module information.
+func writeSBOM(file, vers, mod string, mustPrint bool) {
+	if mod == "" {
+		if mustPrint {
+			fmt.Fprintf(os.Stderr, "%s: no module information\n", file)
+			base.SetExitStatus(1)
+		}
+		return
+	}
+	bi, err := sbom.ParseBuildInfo(vers, mod)
+	if err == nil {
+		err = sbom.Write(os.Stdout, *versionSBOM, bi)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+		base.SetExitStatus(1)
+	}
+}
+
 // The build info blob left by the linker is identified by
 // a 16-byte header, consisting of buildInfoMagic (14 bytes),
 // the binary's pointer size (1 byte),
@@ -95,6 +95,7 @@ type Action struct {
 	pending      int               // number of deps yet to complete
 	priority     int               // relative execution priority
 	Failed       bool              // whether the action failed
+	FailedBuild  string            // if Failed, import path of the package whose build step failed
 	json         *actionJSON       // action graph information
 	nonGoOverlay map[string]string // map from non-.go source files to copied files in objdir. Nil if no overlay is used.
 	traceSpan    *trace.Span
@@ -113,6 +114,14 @@ func (a *Action) BuildID() string { return a.buildID }
 // from Target when the result was cached.
 func (a *Action) BuiltTarget() string { return a.built }
 
+// importPath returns the import path of a's package, or "" if it has none.
+func (a *Action) importPath() string {
+	if a.Package == nil {
+		return ""
+	}
+	return a.Package.ImportPath
+}
+
 // An actionQueue is a priority queue of actions.
 type actionQueue []*Action
 
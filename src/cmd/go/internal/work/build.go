@@ -25,7 +25,7 @@ import (
 )
 
 var CmdBuild = &base.Command{
-	UsageLine: "go build [-o output] [build flags] [packages]",
+	UsageLine: "go build [-o output] [-json] [-cover] [build flags] [packages]",
 	Short:     "compile packages and dependencies",
 	Long: `
 Build compiles the packages named by the import paths,
@@ -55,6 +55,46 @@ will be written to that directory.
 The -i flag installs the packages that are dependencies of the target.
 The -i flag is deprecated. Compiled packages are cached automatically.
 
+The -json flag reports the progress and output of the build as a stream
+of JSON events on standard output, instead of as text on standard error.
+Each event is a JSON object on a line of its own, encoding this struct:
+
+	type BuildEvent struct {
+		Time       time.Time
+		ImportPath string // package being built
+		Action     string
+		Output     string // for build-output events
+	}
+
+The Action is "build-start" when the go command starts building a package
+that is not up to date in the build cache,
+"build-output" for output of the compiler, vet, the linker or other tools
+run while building a package, such as compiler errors, and "build-fail"
+when a step building a package fails. Errors that are not associated
+with a single build step, such as errors loading packages, are still
+printed to standard error. 'go test -json' reports the same events
+alongside its test events.
+
+The -cover flag builds programs instrumented for coverage analysis.
+When an instrumented program exits, either by returning from main.main
+or by calling os.Exit, it writes the coverage counters collected while it
+ran to files in the directory named by the GOCOVERDIR environment
+variable. If GOCOVERDIR is not set, the program prints a warning and
+writes nothing. The data of several runs, such as those of an integration
+test, can be merged, subtracted, and converted to the profile format read
+by 'go tool cover' with 'go tool covdata'; see 'go doc cmd/covdata'.
+
+	-cover
+		enable coverage instrumentation.
+	-covermode set,count,atomic
+		set the mode for coverage analysis, as for 'go test -covermode'.
+		The default is "set", or "atomic" if -race is enabled.
+		Sets -cover.
+	-coverpkg pattern1,pattern2,pattern3
+		instrument the packages matching the patterns. The default is
+		to instrument the packages of the main module (in GOPATH mode,
+		the packages named on the command line). Sets -cover.
+
 The build flags are shared by the build, clean, get, install, list, run,
 and test commands:
 
@@ -140,6 +180,14 @@ and test commands:
 		include path must be in the same directory as the Go package they are
 		included from, and overlays will not appear when binaries and tests are
 		run through go run and go test respectively.
+	-pgo file
+		specify the file path of a profile for profile-guided optimization (PGO).
+		The profile is a CPU profile in the pprof format, such as one written
+		by runtime/pprof. The compiler uses it to inline hot calls more
+		aggressively and to devirtualize hot interface method calls.
+		The special name "off" (or the empty string, the default) turns off PGO.
+		The profile is applied to all packages in the build, and its content
+		is part of the build cache key.
 	-pkgdir dir
 		install and load all packages from dir instead of the usual locations.
 		For example, when building with a non-standard configuration,
@@ -207,6 +255,16 @@ func init() {
 
 	CmdInstall.Flag.BoolVar(&cfg.BuildI, "i", false, "")
 
+	CmdBuild.Flag.BoolVar(&cfg.BuildJSON, "json", false, "")
+	CmdInstall.Flag.BoolVar(&cfg.BuildJSON, "json", false, "")
+
+	CmdBuild.Flag.BoolVar(&cfg.BuildCover, "cover", false, "")
+	CmdBuild.Flag.Var((*coverModeFlag)(&cfg.BuildCoverMode), "covermode", "")
+	CmdBuild.Flag.Var((*coverPkgFlag)(&cfg.BuildCoverPkg), "coverpkg", "")
+	CmdInstall.Flag.BoolVar(&cfg.BuildCover, "cover", false, "")
+	CmdInstall.Flag.Var((*coverModeFlag)(&cfg.BuildCoverMode), "covermode", "")
+	CmdInstall.Flag.Var((*coverPkgFlag)(&cfg.BuildCoverPkg), "coverpkg", "")
+
 	AddBuildFlags(CmdBuild, DefaultBuildFlags)
 	AddBuildFlags(CmdInstall, DefaultBuildFlags)
 	base.AddWorkfileFlag(&CmdBuild.Flag)
@@ -295,6 +353,7 @@ func AddBuildFlags(cmd *base.Command, mask BuildFlagMask) {
 	cmd.Flag.StringVar(&cfg.BuildContext.InstallSuffix, "installsuffix", "", "")
 	cmd.Flag.Var(&load.BuildLdflags, "ldflags", "")
 	cmd.Flag.BoolVar(&cfg.BuildLinkshared, "linkshared", false, "")
+	cmd.Flag.StringVar(&cfg.BuildPGO, "pgo", "", "")
 	cmd.Flag.StringVar(&cfg.BuildPkgdir, "pkgdir", "", "")
 	cmd.Flag.BoolVar(&cfg.BuildRace, "race", false, "")
 	cmd.Flag.BoolVar(&cfg.BuildMSan, "msan", false, "")
@@ -410,6 +469,7 @@ func runBuild(ctx context.Context, cmd *base.Command, args []string) {
 	}
 
 	pkgs = omitTestOnly(pkgsFilter(pkgs))
+	initCoverage(pkgs)
 
 	// Special case -o /dev/null by not writing at all.
 	if cfg.BuildO == os.DevNull {
@@ -470,7 +530,7 @@ func runBuild(ctx context.Context, cmd *base.Command, args []string) {
 }
 
 var CmdInstall = &base.Command{
-	UsageLine: "go install [build flags] [packages]",
+	UsageLine: "go install [-json] [-cover] [build flags] [packages]",
 	Short:     "compile and install packages and dependencies",
 	Long: `
 Install compiles and installs the packages named by the import paths.
@@ -518,6 +578,12 @@ other packages are built and cached but not installed.
 The -i flag installs the dependencies of the named packages as well.
 The -i flag is deprecated. Compiled packages are cached automatically.
 
+The -json flag reports build output as JSON events, as described
+in 'go help build'.
+
+The -cover, -covermode, and -coverpkg flags install programs instrumented
+for coverage analysis, as described in 'go help build'.
+
 For more about the build flags, see 'go help build'.
 For more about specifying packages, see 'go help packages'.
 
@@ -664,6 +730,7 @@ func InstallPackages(ctx context.Context, patterns []string, pkgs []*load.Packag
 	}
 
 	pkgs = omitTestOnly(pkgsFilter(pkgs))
+	initCoverage(pkgs)
 	for _, p := range pkgs {
 		if p.Target == "" {
 			switch {
@@ -0,0 +1,165 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Coverage instrumentation for 'go build -cover' and 'go install -cover'.
+
+package work
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"cmd/go/internal/base"
+	"cmd/go/internal/cfg"
+	"cmd/go/internal/load"
+	"cmd/internal/str"
+)
+
+// coverRuntimePath is the import path of the package that collects the
+// counters of a program built with -cover, and writes them to GOCOVERDIR
+// when the program exits.
+const coverRuntimePath = "internal/coverage"
+
+// coverModeFlag is the -covermode flag of build and install.
+// Setting it implies -cover.
+type coverModeFlag string
+
+func (f *coverModeFlag) String() string { return string(*f) }
+func (f *coverModeFlag) Set(value string) error {
+	switch value {
+	case "set", "count", "atomic":
+	default:
+		return errors.New(`valid modes are "set", "count", or "atomic"`)
+	}
+	*f = coverModeFlag(value)
+	cfg.BuildCover = true
+	return nil
+}
+
+// coverPkgFlag is the -coverpkg flag of build and install, a
+// comma-separated list of package patterns. Setting it implies -cover.
+type coverPkgFlag []string
+
+func (f *coverPkgFlag) String() string { return strings.Join(*f, ",") }
+func (f *coverPkgFlag) Set(value string) error {
+	*f = nil
+	if value != "" {
+		*f = strings.Split(value, ",")
+	}
+	cfg.BuildCover = true
+	return nil
+}
+
+// initCoverage prepares the packages being built, pkgs, and their
+// dependencies for -cover. It instruments the packages matching
+// -coverpkg or, without it, the packages in the main modules (in GOPATH
+// mode, the packages named on the command line), and makes each of them
+// register its counters with the coverage runtime.
+func initCoverage(pkgs []*load.Package) {
+	if !cfg.BuildCover {
+		return
+	}
+	if cfg.BuildToolchainName == "gccgo" {
+		base.Fatalf("go: -cover is not supported by gccgo")
+	}
+	if cfg.BuildCoverMode == "" {
+		cfg.BuildCoverMode = "set"
+		if cfg.BuildRace {
+			// Default coverage mode is atomic when -race is set.
+			cfg.BuildCoverMode = "atomic"
+		}
+	}
+	if cfg.BuildRace && cfg.BuildCoverMode != "atomic" {
+		base.Fatalf(`go: -covermode must be "atomic", not %q, when -race is enabled`, cfg.BuildCoverMode)
+	}
+
+	var stk load.ImportStack
+	rt := load.LoadImportWithFlags(coverRuntimePath, base.Cwd(), nil, &stk, nil, 0)
+	if rt.Error != nil {
+		base.Fatalf("go: loading %s: %v", coverRuntimePath, rt.Error)
+	}
+	// The packages the coverage runtime depends on can't import it,
+	// so they can't be instrumented.
+	skip := map[string]bool{coverRuntimePath: true, "unsafe": true}
+	for _, dep := range rt.Deps {
+		skip[dep] = true
+	}
+	var atomicPkg *load.Package
+	if cfg.BuildCoverMode == "atomic" {
+		// The cover tool makes instrumented files import sync/atomic.
+		atomicPkg = load.LoadImportWithFlags("sync/atomic", base.Cwd(), nil, &stk, nil, 0)
+		if atomicPkg.Error != nil {
+			base.Fatalf("go: loading sync/atomic: %v", atomicPkg.Error)
+		}
+	}
+
+	match := make([]func(*load.Package) bool, len(cfg.BuildCoverPkg))
+	matched := make([]bool, len(cfg.BuildCoverPkg))
+	for i, pattern := range cfg.BuildCoverPkg {
+		match[i] = load.MatchPackage(pattern, base.Cwd())
+	}
+	for _, p := range load.PackageList(pkgs) {
+		selected := false
+		if len(match) == 0 {
+			if cfg.ModulesEnabled {
+				selected = p.Module != nil && p.Module.Main
+			} else {
+				selected = p.Internal.CmdlinePkg
+			}
+		}
+		for i := range match {
+			if match[i](p) {
+				matched[i] = true
+				selected = true
+			}
+		}
+		if !selected || (p.Standard && skip[p.ImportPath]) || len(p.GoFiles)+len(p.CgoFiles) == 0 {
+			continue
+		}
+		p.Internal.CoverMode = cfg.BuildCoverMode
+		p.Internal.CoverVars = load.DeclareCoverVars(p, str.StringList(p.GoFiles, p.CgoFiles)...)
+		p.Internal.CoverRegister = true
+		addImport(p, rt)
+		if atomicPkg != nil {
+			addImport(p, atomicPkg)
+		}
+	}
+
+	// Warn about -coverpkg arguments that are not actually used.
+	for i, pattern := range cfg.BuildCoverPkg {
+		if !matched[i] {
+			fmt.Fprintf(os.Stderr, "warning: no packages being built depend on matches for pattern %s\n", pattern)
+		}
+	}
+}
+
+// addImport adds p1 to the packages p imports, if it isn't there already.
+func addImport(p, p1 *load.Package) {
+	for _, d := range p.Internal.Imports {
+		if d.ImportPath == p1.ImportPath {
+			return
+		}
+	}
+	p.Internal.Imports = append(p.Internal.Imports, p1)
+}
+
+// coverRegisterFile returns the source of a file that registers the
+// coverage variables of the covered files of package p with the coverage
+// runtime, when p is initialized.
+func coverRegisterFile(p *load.Package, covered []*load.CoverVar) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by 'go build -cover'. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", p.Name)
+	fmt.Fprintf(&buf, "import _cover_rt %q\n\n", coverRuntimePath)
+	fmt.Fprintf(&buf, "func init() {\n")
+	for _, cv := range covered {
+		fmt.Fprintf(&buf, "\t_cover_rt.RegisterFile(%q, %q, %s.Count[:], %s.Pos[:], %s.NumStmt[:])\n",
+			p.Internal.CoverMode, cv.File, cv.Var, cv.Var, cv.Var)
+	}
+	fmt.Fprintf(&buf, "}\n")
+	return buf.Bytes()
+}
@@ -147,17 +147,32 @@ func (b *Builder) Do(ctx context.Context, root *Action) {
 		defer b.exec.Unlock()
 
 		if err != nil {
+			importPath := a.importPath()
 			if err == errPrintedOutput {
 				base.SetExitStatus(2)
+			} else if cfg.BuildJSON && importPath != "" {
+				b.output.Lock()
+				b.writeBuildEvent(importPath, "build-output", err.Error()+"\n")
+				b.output.Unlock()
+				base.SetExitStatus(1)
 			} else {
 				base.Errorf("%s", err)
 			}
+			if cfg.BuildJSON && importPath != "" {
+				b.output.Lock()
+				b.writeBuildEvent(importPath, "build-fail", "")
+				b.output.Unlock()
+			}
 			a.Failed = true
+			a.FailedBuild = importPath
 		}
 
 		for _, a0 := range a.triggers {
 			if a.Failed {
 				a0.Failed = true
+				if a0.FailedBuild == "" {
+					a0.FailedBuild = a.FailedBuild
+				}
 			}
 			if a0.pending--; a0.pending == 0 {
 				b.ready.push(a0)
@@ -280,8 +295,14 @@ func (b *Builder) buildActionID(a *Action) cache.ActionID {
 	}
 	if p.Internal.CoverMode != "" {
 		fmt.Fprintf(h, "cover %q %q\n", p.Internal.CoverMode, b.toolID("cover"))
+		if p.Internal.CoverRegister {
+			fmt.Fprintf(h, "coverregister\n")
+		}
 	}
 	fmt.Fprintf(h, "modinfo %q\n", p.Internal.BuildInfo)
+	if p.Internal.FuzzInstrument {
+		fmt.Fprintf(h, "fuzz\n")
+	}
 
 	// Configuration specific to compiler toolchain.
 	switch cfg.BuildToolchainName {
@@ -289,6 +310,10 @@ func (b *Builder) buildActionID(a *Action) cache.ActionID {
 		base.Fatalf("buildActionID: unknown build toolchain %q", cfg.BuildToolchainName)
 	case "gc":
 		fmt.Fprintf(h, "compile %s %q %q\n", b.toolID("compile"), forcedGcflags, p.Internal.Gcflags)
+		if cfg.BuildPGO != "" {
+			// The profile is identified by its content, not its path.
+			fmt.Fprintf(h, "pgofile %s\n", b.fileHash(cfg.BuildPGO))
+		}
 		if len(p.SFiles) > 0 {
 			fmt.Fprintf(h, "asm %q %q %q\n", b.toolID("asm"), forcedAsmflags, p.Internal.Asmflags)
 		}
@@ -502,6 +527,11 @@ func (b *Builder) build(ctx context.Context, a *Action) (err error) {
 	if cfg.BuildV {
 		b.Print(a.Package.ImportPath + "\n")
 	}
+	if cfg.BuildJSON && need&needBuild != 0 {
+		b.output.Lock()
+		b.writeBuildEvent(a.Package.ImportPath, "build-start", "")
+		b.output.Unlock()
+	}
 
 	if a.Package.BinaryOnly {
 		p.Stale = true
@@ -557,7 +587,7 @@ func (b *Builder) build(ctx context.Context, a *Action) (err error) {
 	var objects, cgoObjects, pcCFLAGS, pcLDFLAGS []string
 
 	if a.Package.UsesCgo() || a.Package.UsesSwig() {
-		if pcCFLAGS, pcLDFLAGS, err = b.getPkgConfigFlags(a.Package); err != nil {
+		if pcCFLAGS, pcLDFLAGS, err = b.getPkgConfigFlags(a); err != nil {
 			return
 		}
 	}
@@ -605,6 +635,7 @@ OverlayLoop:
 
 	// If we're doing coverage, preprocess the .go files and put them in the work directory
 	if a.Package.Internal.CoverMode != "" {
+		var covered []*load.CoverVar
 		for i, file := range str.StringList(gofiles, cgofiles) {
 			var sourceFile string
 			var coverFile string
@@ -634,6 +665,17 @@ OverlayLoop:
 			} else {
 				cgofiles[i-len(gofiles)] = coverFile
 			}
+			covered = append(covered, cover)
+		}
+
+		// For go build -cover, add a file registering the coverage
+		// variables with the coverage runtime.
+		if a.Package.Internal.CoverRegister && len(covered) > 0 {
+			registerFile := objdir + "_cover_register_.go"
+			if err := b.writeFile(registerFile, coverRegisterFile(a.Package, covered)); err != nil {
+				return err
+			}
+			gofiles = append(gofiles, registerFile)
 		}
 	}
 
@@ -1444,7 +1486,8 @@ func splitPkgConfigOutput(out []byte) ([]string, error) {
 }
 
 // Calls pkg-config if needed and returns the cflags/ldflags needed to build the package.
-func (b *Builder) getPkgConfigFlags(p *load.Package) (cflags, ldflags []string, err error) {
+func (b *Builder) getPkgConfigFlags(a *Action) (cflags, ldflags []string, err error) {
+	p := a.Package
 	if pcargs := p.CgoPkgConfig; len(pcargs) > 0 {
 		// pkg-config permits arguments to appear anywhere in
 		// the command line. Move them all to the front, before --.
@@ -1467,8 +1510,7 @@ func (b *Builder) getPkgConfigFlags(p *load.Package) (cflags, ldflags []string,
 		var out []byte
 		out, err = b.runOut(nil, p.Dir, nil, b.PkgconfigCmd(), "--cflags", pcflags, "--", pkgs)
 		if err != nil {
-			b.showOutput(nil, p.Dir, b.PkgconfigCmd()+" --cflags "+strings.Join(pcflags, " ")+" -- "+strings.Join(pkgs, " "), string(out))
-			b.Print(err.Error() + "\n")
+			b.showOutput(a, p.Dir, b.PkgconfigCmd()+" --cflags "+strings.Join(pcflags, " ")+" -- "+strings.Join(pkgs, " "), string(out)+err.Error()+"\n")
 			return nil, nil, errPrintedOutput
 		}
 		if len(out) > 0 {
@@ -1482,8 +1524,7 @@ func (b *Builder) getPkgConfigFlags(p *load.Package) (cflags, ldflags []string,
 		}
 		out, err = b.runOut(nil, p.Dir, nil, b.PkgconfigCmd(), "--libs", pcflags, "--", pkgs)
 		if err != nil {
-			b.showOutput(nil, p.Dir, b.PkgconfigCmd()+" --libs "+strings.Join(pcflags, " ")+" -- "+strings.Join(pkgs, " "), string(out))
-			b.Print(err.Error() + "\n")
+			b.showOutput(a, p.Dir, b.PkgconfigCmd()+" --libs "+strings.Join(pcflags, " ")+" -- "+strings.Join(pkgs, " "), string(out)+err.Error()+"\n")
 			return nil, nil, errPrintedOutput
 		}
 		if len(out) > 0 {
@@ -1980,6 +2021,9 @@ func (b *Builder) Showcmd(dir string, format string, args ...interface{}) {
 // If a is not nil and a.output is not nil, showOutput appends to that slice instead of
 // printing to b.Print.
 //
+// If -json is set, the output is written as a build-output event
+// attributed to the package of a.
+//
 func (b *Builder) showOutput(a *Action, dir, desc, out string) {
 	prefix := "# " + desc
 	suffix := "\n" + out
@@ -1995,9 +2039,65 @@ func (b *Builder) showOutput(a *Action, dir, desc, out string) {
 		return
 	}
 
+	importPath := ""
+	if a != nil {
+		importPath = a.importPath()
+	}
 	b.output.Lock()
 	defer b.output.Unlock()
-	b.Print(prefix, suffix)
+	b.printOutput(importPath, prefix+suffix)
+}
+
+// printOutput prints text, output from building the package with the given
+// import path, or writes it as a build-output event if -json is set.
+// The caller must hold b.output.
+func (b *Builder) printOutput(importPath, text string) {
+	if cfg.BuildJSON {
+		b.writeBuildEvent(importPath, "build-output", text)
+		return
+	}
+	b.Print(text)
+}
+
+// A buildEvent is an event written to standard output when -json is set.
+// Keep in sync with the documentation of BuildEvent in 'go help build'.
+type buildEvent struct {
+	Time       time.Time
+	ImportPath string `json:",omitempty"`
+	Action     string
+	Output     string `json:",omitempty"`
+}
+
+// writeBuildEvent writes a build event to standard output.
+// The caller must hold b.output.
+func (b *Builder) writeBuildEvent(importPath, action, output string) {
+	js, err := json.Marshal(&buildEvent{
+		Time:       time.Now(),
+		ImportPath: importPath,
+		Action:     action,
+		Output:     output,
+	})
+	if err != nil {
+		// Should not happen - buildEvent is valid for json.Marshal.
+		base.Fatalf("go: internal error: %v", err)
+	}
+	LockedStdout{}.Write(append(js, '\n'))
+}
+
+// stdoutMu and LockedStdout provide a locked standard output
+// that guarantees never to interlace writes from multiple
+// goroutines, so that we can have multiple JSON streams writing
+// to a LockedStdout simultaneously and know that events will
+// still be intelligible. Build events are written to it too, so
+// that they stay whole lines among 'go test -json' events.
+var stdoutMu sync.Mutex
+
+type LockedStdout struct{}
+
+func (LockedStdout) Write(b []byte) (int, error) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	return os.Stdout.Write(b)
 }
 
 // errPrintedOutput is a special error indicating that a command failed
@@ -116,7 +116,7 @@ func (gcToolchain) gc(b *Builder, a *Action, archive string, importcfg, embedcfg
 	extFiles := len(p.CgoFiles) + len(p.CFiles) + len(p.CXXFiles) + len(p.MFiles) + len(p.FFiles) + len(p.SFiles) + len(p.SysoFiles) + len(p.SwigFiles) + len(p.SwigCXXFiles)
 	if p.Standard {
 		switch p.ImportPath {
-		case "bytes", "internal/poll", "net", "os":
+		case "bytes", "internal/coverage", "internal/poll", "maps", "net", "os":
 			fallthrough
 		case "runtime/metrics", "runtime/pprof", "runtime/trace":
 			fallthrough
@@ -142,8 +142,14 @@ func (gcToolchain) gc(b *Builder, a *Action, archive string, importcfg, embedcfg
 	if symabis != "" {
 		gcflags = append(gcflags, "-symabis", symabis)
 	}
+	if cfg.BuildPGO != "" {
+		gcflags = append(gcflags, "-pgoprofile", cfg.BuildPGO)
+	}
 
 	gcflags = append(gcflags, str.StringList(forcedGcflags, p.Internal.Gcflags)...)
+	if p.Internal.FuzzInstrument {
+		gcflags = append(gcflags, "-d=libfuzzer")
+	}
 	if compilingRuntime {
 		// Remove -N, if present.
 		// It is not possible to build the runtime with no optimizations,
@@ -40,6 +40,23 @@ func BuildInit() {
 		cfg.BuildPkgdir = p
 	}
 
+	// Likewise for the -pgo profile, which is passed to the compiler.
+	if cfg.BuildPGO == "off" {
+		cfg.BuildPGO = ""
+	}
+	if cfg.BuildPGO != "" && !filepath.IsAbs(cfg.BuildPGO) {
+		p, err := filepath.Abs(cfg.BuildPGO)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "go %s: evaluating -pgo: %v\n", flag.Args()[0], err)
+			base.SetExitStatus(2)
+			base.Exit()
+		}
+		cfg.BuildPGO = p
+	}
+	if cfg.BuildPGO != "" && cfg.BuildToolchainName == "gccgo" {
+		base.Fatalf("go %s: -pgo is not supported by gccgo", flag.Args()[0])
+	}
+
 	if cfg.BuildP <= 0 {
 		base.Fatalf("go: -p must be a positive integer: %v\n", cfg.BuildP)
 	}
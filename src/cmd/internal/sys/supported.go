@@ -130,3 +130,28 @@ func InternalLinkPIESupported(goos, goarch string) bool {
 	}
 	return false
 }
+
+// FuzzSupported reports whether goos/goarch supports fuzzing
+// ('go test -fuzz=.').
+func FuzzSupported(goos, goarch string) bool {
+	switch goos {
+	case "darwin", "dragonfly", "freebsd", "linux", "netbsd", "openbsd":
+		return true
+	default:
+		return false
+	}
+}
+
+// FuzzInstrumented reports whether fuzzing on goos/goarch uses coverage
+// instrumentation. (FuzzInstrumented implies FuzzSupported.)
+func FuzzInstrumented(goos, goarch string) bool {
+	switch goarch {
+	case "amd64", "arm64":
+		// The counters are placed in a dedicated ELF section.
+		switch goos {
+		case "freebsd", "linux", "netbsd", "openbsd":
+			return true
+		}
+	}
+	return false
+}
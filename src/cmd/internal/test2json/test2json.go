@@ -35,6 +35,8 @@ type event struct {
 	Test    string     `json:",omitempty"`
 	Elapsed *float64   `json:",omitempty"`
 	Output  *textBytes `json:",omitempty"`
+
+	FailedBuild string `json:",omitempty"`
 }
 
 // textBytes is a hack to get JSON to emit a []byte as a string
@@ -56,6 +58,7 @@ type Converter struct {
 	testName string     // name of current test, for output attribution
 	report   []*event   // pending test result reports (nested for subtests)
 	result   string     // overall test result if seen
+	failed   string     // package that failed to build, if any
 	input    lineBuffer // input buffer
 	output   lineBuffer // output buffer
 }
@@ -136,6 +139,13 @@ func (c *Converter) Exited(err error) {
 	}
 }
 
+// SetFailedBuild records that the test binary could not be built because
+// the package with the given import path failed to build. The package is
+// reported in the FailedBuild field of the final "fail" event.
+func (c *Converter) SetFailedBuild(pkg string) {
+	c.failed = pkg
+}
+
 var (
 	// printed by test on successful run.
 	bigPass = []byte("PASS\n")
@@ -312,6 +322,9 @@ func (c *Converter) Close() error {
 	c.output.flush()
 	if c.result != "" {
 		e := &event{Action: c.result}
+		if c.result == "fail" {
+			e.FailedBuild = c.failed
+		}
 		if c.mode&Timestamp != 0 {
 			dt := time.Since(c.start).Round(1 * time.Millisecond).Seconds()
 			e.Elapsed = &dt
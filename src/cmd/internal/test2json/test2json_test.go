@@ -261,6 +261,22 @@ func diffJSON(t *testing.T, have, want []byte) {
 	}
 }
 
+func TestFailedBuild(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewConverter(&buf, "m/p", 0)
+	c.SetFailedBuild("m/dep")
+	io.WriteString(c, "FAIL\tm/p [build failed]\n")
+	c.Exited(fmt.Errorf("build failed"))
+	c.Close()
+
+	want := `{"Action":"output","Package":"m/p","Output":"FAIL\tm/p [build failed]\n"}
+{"Action":"fail","Package":"m/p","FailedBuild":"m/dep"}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
 func TestTrimUTF8(t *testing.T) {
 	s := "hello α ☺ 😂 world" // α is 2-byte, ☺ is 3-byte, 😂 is 4-byte
 	b := []byte(s)
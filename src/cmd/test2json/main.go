@@ -32,12 +32,13 @@
 // corresponding to the Go struct:
 //
 //	type TestEvent struct {
-//		Time    time.Time // encodes as an RFC3339-format string
-//		Action  string
-//		Package string
-//		Test    string
-//		Elapsed float64 // seconds
-//		Output  string
+//		Time        time.Time // encodes as an RFC3339-format string
+//		Action      string
+//		Package     string
+//		Test        string
+//		Elapsed     float64 // seconds
+//		Output      string
+//		FailedBuild string
 //	}
 //
 // The Time field holds the time the event happened.
@@ -73,6 +74,19 @@
 // the concatenation of the Output fields of all output events is the exact
 // output of the test execution.
 //
+// The FailedBuild field is set for the final "fail" event of a package
+// whose test binary could not be built. It gives the import path of the
+// package that failed to build, which may be the package under test or
+// one of its dependencies.
+//
+// "go test -json" also reports the progress and output of building the
+// test binaries, such as compiler errors, as described for the -json flag
+// of "go build". These build events are interlaced with the test events
+// in the same stream. They set ImportPath instead of Package, and their
+// Action starts with "build-", so readers can tell them apart from test
+// events. The FailedBuild field of a test event matches the ImportPath
+// of the build events reporting the failure.
+//
 // When a benchmark runs, it typically produces a single line of output
 // giving timing results. That line is reported in an event with Action == "output"
 // and no Test field. If a benchmark logs output or reports a failure
@@ -12,3 +12,15 @@ type MethodTest int
 
 func (t *MethodTest) Scan(x fmt.ScanState, c byte) { // ERROR "should have signature Scan\(fmt\.ScanState, rune\) error"
 }
+
+type UnwrapTest struct{ errs []error }
+
+func (u UnwrapTest) Error() string { return "" }
+
+func (u UnwrapTest) Unwrap() []error { return u.errs } // ok
+
+type BadUnwrapTest struct{}
+
+func (u BadUnwrapTest) Error() string { return "" }
+
+func (u BadUnwrapTest) Unwrap() []string { return nil } // ERROR "should have signature Unwrap\(\) error or Unwrap\(\) \[\]error"
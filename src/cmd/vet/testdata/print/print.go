@@ -208,6 +208,8 @@ func PrintfTests() {
 	// Something that satisfies the error interface.
 	var e error
 	fmt.Println(e.Error()) // ok
+	// An error may wrap several errors.
+	_ = fmt.Errorf("%w: %w", e, e) // ok
 	// Something that looks like an error interface but isn't, such as the (*T).Error method
 	// in the testing package.
 	var et1 *testing.T
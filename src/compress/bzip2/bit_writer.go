@@ -0,0 +1,41 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+// bitWriter accumulates bits, most significant bit first, in a byte
+// slice. Complete bytes are appended to out as soon as they are
+// available; the remaining bits are kept until more are written or the
+// stream is padded with Flush.
+type bitWriter struct {
+	out  []byte
+	n    uint64
+	bits uint
+}
+
+// WriteBits writes the low bits bits of v, bits <= 32.
+func (bw *bitWriter) WriteBits(bits uint, v uint32) {
+	bw.n = bw.n<<bits | uint64(v)&(1<<bits-1)
+	bw.bits += bits
+	for bw.bits >= 8 {
+		bw.bits -= 8
+		bw.out = append(bw.out, byte(bw.n>>bw.bits))
+	}
+}
+
+// WriteBit writes a single bit.
+func (bw *bitWriter) WriteBit(bit bool) {
+	if bit {
+		bw.WriteBits(1, 1)
+	} else {
+		bw.WriteBits(1, 0)
+	}
+}
+
+// Flush pads the stream with zero bits up to a byte boundary.
+func (bw *bitWriter) Flush() {
+	if bw.bits > 0 {
+		bw.WriteBits(8-bw.bits, 0)
+	}
+}
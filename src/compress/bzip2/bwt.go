@@ -0,0 +1,116 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+// bwtSorter holds the scratch space needed to compute the
+// Burrows-Wheeler transform of a block, so that it can be reused from
+// block to block.
+type bwtSorter struct {
+	p, pn []int32 // rotations in sorted order
+	c, cn []int32 // equivalence class of each rotation
+	cnt   []int32 // counts for the counting sort
+	last  []byte
+}
+
+// transform computes the Burrows-Wheeler transform of block. It returns
+// the last column of the sorted matrix of rotations of block, and the row
+// of that matrix holding block itself, which the bzip2 format calls
+// origPtr. The returned slice is only valid until the next call.
+//
+// The rotations are sorted by prefix doubling. Before the round for h,
+// the rotations are ordered by their first h bytes and c gives the rank
+// of each rotation's prefix. A 2h-byte prefix is the pair of ranks of
+// rotations r and r+h, so the round is a stable counting sort by the rank
+// of r of the rotations already ordered by r+h.
+func (s *bwtSorter) transform(block []byte) (last []byte, origPtr int) {
+	n := len(block)
+	if cap(s.p) < n {
+		s.p = make([]int32, n)
+		s.pn = make([]int32, n)
+		s.c = make([]int32, n)
+		s.cn = make([]int32, n)
+		s.cnt = make([]int32, n+256)
+		s.last = make([]byte, n)
+	}
+	p, pn, c, cn := s.p[:n], s.pn[:n], s.c[:n], s.cn[:n]
+
+	// Sort the rotations by their first byte.
+	cnt := s.cnt[:256]
+	for i := range cnt {
+		cnt[i] = 0
+	}
+	for _, b := range block {
+		cnt[b]++
+	}
+	for i := 1; i < 256; i++ {
+		cnt[i] += cnt[i-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		cnt[block[i]]--
+		p[cnt[block[i]]] = int32(i)
+	}
+	classes := int32(1)
+	c[p[0]] = 0
+	for i := 1; i < n; i++ {
+		if block[p[i]] != block[p[i-1]] {
+			classes++
+		}
+		c[p[i]] = classes - 1
+	}
+
+	for h := 1; h < n && int(classes) < n; h <<= 1 {
+		// Order the rotations r-h by their second half, rotation r.
+		for i, r := range p {
+			r -= int32(h)
+			if r < 0 {
+				r += int32(n)
+			}
+			pn[i] = r
+		}
+		cnt := s.cnt[:classes]
+		for i := range cnt {
+			cnt[i] = 0
+		}
+		for _, r := range pn {
+			cnt[c[r]]++
+		}
+		for i := 1; i < len(cnt); i++ {
+			cnt[i] += cnt[i-1]
+		}
+		for i := n - 1; i >= 0; i-- {
+			r := pn[i]
+			cnt[c[r]]--
+			p[cnt[c[r]]] = r
+		}
+
+		// Compute the classes of the 2h-byte prefixes.
+		classes = 1
+		cn[p[0]] = 0
+		second := func(r int32) int32 {
+			r += int32(h)
+			if r >= int32(n) {
+				r -= int32(n)
+			}
+			return c[r]
+		}
+		for i := 1; i < n; i++ {
+			if c[p[i]] != c[p[i-1]] || second(p[i]) != second(p[i-1]) {
+				classes++
+			}
+			cn[p[i]] = classes - 1
+		}
+		c, cn = cn, c
+	}
+
+	last = s.last[:n]
+	for i, r := range p {
+		if r == 0 {
+			origPtr = i
+			r = int32(n)
+		}
+		last[i] = block[r-1]
+	}
+	return last, origPtr
+}
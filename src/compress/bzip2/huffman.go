@@ -235,3 +235,72 @@ func buildHuffmanNode(t *huffmanTree, codes []huffmanCode, level uint32) (nodeIn
 
 	return
 }
+
+// huffmanCodeLengths sets lengths to the code lengths of a Huffman code for
+// symbols with the given frequencies. Every symbol is given a code, even if
+// its frequency is zero, and no code is longer than maxLen bits.
+//
+// Like the bzip2 source code, the lengths are limited by halving the
+// frequencies and building the tree again until it is shallow enough.
+func huffmanCodeLengths(lengths []uint8, freq []int32, maxLen int) {
+	n := len(freq)
+	weight := make([]int64, 2*n-1)
+	parent := make([]int32, 2*n-1)
+	depth := make([]int, 2*n-1)
+	leaves := make([]int32, n)
+	for i, f := range freq {
+		if f == 0 {
+			f = 1
+		}
+		weight[i] = int64(f)
+	}
+	for {
+		for i := range leaves {
+			leaves[i] = int32(i)
+		}
+		sort.Slice(leaves, func(i, j int) bool {
+			wi, wj := weight[leaves[i]], weight[leaves[j]]
+			if wi != wj {
+				return wi < wj
+			}
+			return leaves[i] < leaves[j]
+		})
+
+		// The internal nodes, numbered from n, are created in order of
+		// increasing weight, so the two lightest nodes are at the
+		// front of either leaves or the internal nodes.
+		nextLeaf, nextNode, newNode := 0, n, n
+		lightest := func() int {
+			if nextLeaf < n && (nextNode == newNode || weight[leaves[nextLeaf]] <= weight[nextNode]) {
+				nextLeaf++
+				return int(leaves[nextLeaf-1])
+			}
+			nextNode++
+			return nextNode - 1
+		}
+		for ; newNode < 2*n-1; newNode++ {
+			a, b := lightest(), lightest()
+			weight[newNode] = weight[a] + weight[b]
+			parent[a], parent[b] = int32(newNode), int32(newNode)
+		}
+
+		// Parents come after their children, and the root is last.
+		tooLong := false
+		depth[2*n-2] = 0
+		for i := 2*n - 3; i >= 0; i-- {
+			depth[i] = depth[parent[i]] + 1
+			if i < n && depth[i] > maxLen {
+				tooLong = true
+			}
+		}
+		if !tooLong {
+			for i := range lengths {
+				lengths[i] = uint8(depth[i])
+			}
+			return
+		}
+		for i := 0; i < n; i++ {
+			weight[i] = 1 + weight[i]/2
+		}
+	}
+}
@@ -0,0 +1,426 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Compression levels. The level is the block size in units of 100,000
+// bytes: higher levels usually compress better but use more memory, both
+// to compress and to decompress.
+const (
+	BestSpeed          = 1
+	BestCompression    = 9
+	DefaultCompression = -1
+)
+
+const defaultLevel = 9 // as in the bzip2 command
+
+const (
+	maxRun        = 255 // longest run encoded by the initial run-length encoding
+	maxCodeLen    = 17  // longest Huffman code written, as in the bzip2 source code
+	groupSize     = 50  // number of symbols coded with each Huffman table
+	maxHuffTables = 6
+	maxSymbols    = 258 // RUNA, RUNB, 255 other MTF values and EOB
+	numIterations = 4   // rounds of refinement of the Huffman tables
+)
+
+var errClosed = errors.New("bzip2: Writer is closed")
+
+// A Writer is an io.WriteCloser.
+// Writes to a Writer are compressed and written to w.
+type Writer struct {
+	w        io.Writer
+	level    int
+	maxBlock int    // a block is written once its size reaches maxBlock
+	block    []byte // the current block, after the initial run-length encoding
+	blockCRC uint32
+	fileCRC  uint32
+	runByte  byte // the byte repeated by the pending run
+	runLen   int  // the length of the pending run
+	bw       bitWriter
+	enc      blockEncoder
+	closed   bool
+	err      error
+}
+
+// NewWriter returns a new Writer.
+// Writes to the returned writer are compressed and written to w.
+//
+// It is the caller's responsibility to call Close on the Writer when done.
+// Writes may be buffered and not flushed until Close.
+func NewWriter(w io.Writer) *Writer {
+	z, _ := NewWriterLevel(w, DefaultCompression)
+	return z
+}
+
+// NewWriterLevel is like NewWriter but specifies the compression level instead
+// of assuming DefaultCompression.
+//
+// The compression level can be DefaultCompression or any integer value
+// between BestSpeed and BestCompression inclusive. The error returned will
+// be nil if the level is valid.
+func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
+	if level == DefaultCompression {
+		level = defaultLevel
+	}
+	if level < BestSpeed || level > BestCompression {
+		return nil, fmt.Errorf("bzip2: invalid compression level: %d", level)
+	}
+	// The bzip2 source code leaves some room in each block, which
+	// readers may rely on.
+	z := &Writer{level: level, maxBlock: level*100*1000 - 19}
+	z.Reset(w)
+	return z, nil
+}
+
+// Reset discards the Writer z's state and makes it equivalent to the
+// result of its original state from NewWriter or NewWriterLevel, but
+// writing to w instead. This permits reusing a Writer rather than
+// allocating a new one.
+func (z *Writer) Reset(w io.Writer) {
+	z.w = w
+	z.block = z.block[:0]
+	z.blockCRC = 0
+	z.fileCRC = 0
+	z.runLen = 0
+	z.bw = bitWriter{out: z.bw.out[:0]}
+	z.bw.WriteBits(16, bzip2FileMagic)
+	z.bw.WriteBits(8, 'h')
+	z.bw.WriteBits(8, uint32('0'+z.level))
+	z.closed = false
+	z.err = nil
+}
+
+// Write writes a compressed form of p to the underlying io.Writer. The
+// compressed bytes are not necessarily flushed until the Writer is closed.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, errClosed
+	}
+	if z.block == nil {
+		z.block = make([]byte, 0, z.maxBlock+5)
+	}
+	for i, b := range p {
+		if z.runLen > 0 && (b != z.runByte || z.runLen == maxRun) {
+			if err := z.endRun(); err != nil {
+				return i, err
+			}
+		}
+		z.runByte = b
+		z.runLen++
+	}
+	return len(p), nil
+}
+
+// endRun adds the pending run to the block, writing the block if it is
+// then full.
+//
+// The first step of bzip2 compression is a run-length encoding, which
+// replaces runs of four to 255 equal bytes by four of them followed by a
+// byte holding the number of remaining repeats. A run never spans blocks.
+func (z *Writer) endRun() error {
+	b, n := z.runByte, z.runLen
+	crc := ^z.blockCRC
+	for i := 0; i < n; i++ {
+		crc = crctab[byte(crc>>24)^b] ^ (crc << 8)
+	}
+	z.blockCRC = ^crc
+	if n < 4 {
+		for i := 0; i < n; i++ {
+			z.block = append(z.block, b)
+		}
+	} else {
+		z.block = append(z.block, b, b, b, b, byte(n-4))
+	}
+	z.runLen = 0
+	if len(z.block) >= z.maxBlock {
+		return z.writeBlock()
+	}
+	return nil
+}
+
+// Close closes the Writer by flushing any unwritten data to the underlying
+// io.Writer and writing the end of stream marker and checksum. It does not
+// close the underlying io.Writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	if z.runLen > 0 {
+		if err := z.endRun(); err != nil {
+			return err
+		}
+	}
+	if len(z.block) > 0 {
+		if err := z.writeBlock(); err != nil {
+			return err
+		}
+	}
+	z.closed = true
+	bw := &z.bw
+	bw.WriteBits(24, bzip2FinalMagic>>24)
+	bw.WriteBits(24, bzip2FinalMagic&0xffffff)
+	bw.WriteBits(32, z.fileCRC)
+	bw.Flush()
+	_, z.err = z.w.Write(bw.out)
+	bw.out = bw.out[:0]
+	return z.err
+}
+
+// writeBlock compresses the current block and writes the complete bytes
+// of the stream so far to the underlying writer.
+func (z *Writer) writeBlock() error {
+	bw := &z.bw
+	bw.WriteBits(24, bzip2BlockMagic>>24)
+	bw.WriteBits(24, bzip2BlockMagic&0xffffff)
+	bw.WriteBits(32, z.blockCRC)
+	z.fileCRC = (z.fileCRC<<1 | z.fileCRC>>31) ^ z.blockCRC
+	z.enc.encode(bw, z.block)
+	z.block = z.block[:0]
+	z.blockCRC = 0
+
+	_, z.err = z.w.Write(bw.out)
+	bw.out = bw.out[:0]
+	return z.err
+}
+
+// A blockEncoder holds the scratch space needed to encode a block.
+type blockEncoder struct {
+	bwt       bwtSorter
+	syms      []uint16 // the MTF and RUNA/RUNB coded block
+	selectors []uint8  // the Huffman table used for each group of symbols
+}
+
+// encode writes the body of a block, after its checksum, to bw.
+func (e *blockEncoder) encode(bw *bitWriter, block []byte) {
+	last, origPtr := e.bwt.transform(block)
+	bw.WriteBit(false) // not randomized
+	bw.WriteBits(24, uint32(origPtr))
+
+	// The symbols used are stored as a two-level, 16x16 bitmap.
+	var inUse [256]bool
+	for _, b := range block {
+		inUse[b] = true
+	}
+	var symbolRangeUsedBitmap uint32
+	for symRange := 0; symRange < 16; symRange++ {
+		for symbol := 0; symbol < 16; symbol++ {
+			if inUse[16*symRange+symbol] {
+				symbolRangeUsedBitmap |= 1 << (15 - symRange)
+				break
+			}
+		}
+	}
+	bw.WriteBits(16, symbolRangeUsedBitmap)
+	for symRange := 0; symRange < 16; symRange++ {
+		if symbolRangeUsedBitmap&(1<<(15-symRange)) == 0 {
+			continue
+		}
+		var bits uint32
+		for symbol := 0; symbol < 16; symbol++ {
+			if inUse[16*symRange+symbol] {
+				bits |= 1 << (15 - symbol)
+			}
+		}
+		bw.WriteBits(16, bits)
+	}
+
+	// Apply the move-to-front transform to the output of the BWT, over
+	// the list of the symbols used. The frequent runs of zeros that
+	// result are written in bijective base 2 with the digits RUNA and
+	// RUNB, and the other values v as v+1.
+	var seq [256]byte // index of each symbol in the MTF list
+	numSymbols := 0
+	for i, used := range inUse {
+		if used {
+			seq[i] = byte(numSymbols)
+			numSymbols++
+		}
+	}
+	var mtf [256]byte
+	for i := range mtf {
+		mtf[i] = byte(i)
+	}
+	syms := e.syms[:0]
+	zeros := 0
+	for _, b := range last {
+		s := seq[b]
+		if mtf[0] == s {
+			zeros++
+			continue
+		}
+		if zeros > 0 {
+			syms = appendRun(syms, zeros)
+			zeros = 0
+		}
+		j := 1
+		for mtf[j] != s {
+			j++
+		}
+		copy(mtf[1:j+1], mtf[:j])
+		mtf[0] = s
+		syms = append(syms, uint16(j+1))
+	}
+	if zeros > 0 {
+		syms = appendRun(syms, zeros)
+	}
+	alphaSize := numSymbols + 2
+	syms = append(syms, uint16(alphaSize-1)) // EOB
+	e.syms = syms
+
+	e.writeSymbols(bw, syms, alphaSize)
+}
+
+// appendRun appends the encoding of a run of n zeros to syms.
+func appendRun(syms []uint16, n int) []uint16 {
+	n--
+	for {
+		syms = append(syms, uint16(n&1)) // RUNA or RUNB
+		if n < 2 {
+			return syms
+		}
+		n = (n - 2) / 2
+	}
+}
+
+// writeSymbols chooses the Huffman tables used to code syms, writes them
+// to bw, and then writes syms.
+func (e *blockEncoder) writeSymbols(bw *bitWriter, syms []uint16, alphaSize int) {
+	numTables := 6
+	switch {
+	case len(syms) < 200:
+		numTables = 2
+	case len(syms) < 600:
+		numTables = 3
+	case len(syms) < 1200:
+		numTables = 4
+	case len(syms) < 2400:
+		numTables = 5
+	}
+
+	// Start from tables which each favour a contiguous range of symbols,
+	// ranges of roughly equal frequency. This is the same heuristic as
+	// the bzip2 source code, which also uses costs of 0 and 15 bits.
+	var freq [maxSymbols]int32
+	for _, s := range syms {
+		freq[s]++
+	}
+	var lengths [maxHuffTables][maxSymbols]uint8
+	remaining := int32(len(syms))
+	start := 0
+	for t := numTables; t > 0; t-- {
+		target := remaining / int32(t)
+		end, sum := start-1, int32(0)
+		for sum < target && end < alphaSize-1 {
+			end++
+			sum += freq[end]
+		}
+		if end > start && t != numTables && t != 1 && (numTables-t)%2 == 1 {
+			sum -= freq[end]
+			end--
+		}
+		for s := 0; s < alphaSize; s++ {
+			if s < start || s > end {
+				lengths[t-1][s] = 15
+			}
+		}
+		start = end + 1
+		remaining -= sum
+	}
+
+	// Refine the tables by choosing the cheapest table for each group of
+	// symbols and rebuilding each table from the symbols assigned to it.
+	selectors := e.selectors[:0]
+	for iter := 0; iter < numIterations; iter++ {
+		var tableFreq [maxHuffTables][maxSymbols]int32
+		selectors = selectors[:0]
+		for start := 0; start < len(syms); start += groupSize {
+			group := syms[start:]
+			if len(group) > groupSize {
+				group = group[:groupSize]
+			}
+			var cost [maxHuffTables]int
+			for _, s := range group {
+				for t := 0; t < numTables; t++ {
+					cost[t] += int(lengths[t][s])
+				}
+			}
+			best := 0
+			for t := 1; t < numTables; t++ {
+				if cost[t] < cost[best] {
+					best = t
+				}
+			}
+			selectors = append(selectors, uint8(best))
+			for _, s := range group {
+				tableFreq[best][s]++
+			}
+		}
+		for t := 0; t < numTables; t++ {
+			huffmanCodeLengths(lengths[t][:alphaSize], tableFreq[t][:alphaSize], maxCodeLen)
+		}
+	}
+	e.selectors = selectors
+
+	// The selectors are move-to-front transformed and stored as unary
+	// numbers.
+	bw.WriteBits(3, uint32(numTables))
+	bw.WriteBits(15, uint32(len(selectors)))
+	mtf := [maxHuffTables]uint8{0, 1, 2, 3, 4, 5}
+	for _, sel := range selectors {
+		j := 0
+		for mtf[j] != sel {
+			j++
+			bw.WriteBit(true)
+		}
+		bw.WriteBit(false)
+		copy(mtf[1:j+1], mtf[:j])
+		mtf[0] = sel
+	}
+
+	// The code lengths are delta encoded from a 5-bit base value. The
+	// codes are canonical: they are assigned in order of increasing
+	// length, and of symbol value for equal lengths.
+	var codes [maxHuffTables][maxSymbols]uint32
+	for t := 0; t < numTables; t++ {
+		length := lengths[t][0]
+		bw.WriteBits(5, uint32(length))
+		for _, l := range lengths[t][:alphaSize] {
+			for ; length < l; length++ {
+				bw.WriteBits(2, 2)
+			}
+			for ; length > l; length-- {
+				bw.WriteBits(2, 3)
+			}
+			bw.WriteBit(false)
+		}
+
+		code := uint32(0)
+		for l := uint8(1); l <= maxCodeLen; l++ {
+			for s, sl := range lengths[t][:alphaSize] {
+				if sl == l {
+					codes[t][s] = code
+					code++
+				}
+			}
+			code <<= 1
+		}
+	}
+
+	for i, s := range syms {
+		t := selectors[i/groupSize]
+		bw.WriteBits(uint(lengths[t][s]), codes[t][s])
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func mustDecompress(compressed []byte) []byte {
+	b, err := io.ReadAll(NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func compress(t testing.TB, level int, input []byte) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(input); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// runs returns data made of runs of every length up to 600, which
+// exercises the initial run-length encoding, including runs split
+// between blocks.
+func runs() []byte {
+	var b []byte
+	for n := 1; n <= 600; n++ {
+		b = append(b, bytes.Repeat([]byte{byte(n)}, n)...)
+		b = append(b, bytes.Repeat([]byte{'r'}, n)...)
+	}
+	return b
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 300*1000)
+	rng.Read(random)
+	inputs := []struct {
+		name  string
+		input []byte
+	}{
+		{"empty", nil},
+		{"one byte", []byte{'x'}},
+		{"e.txt", mustDecompress(digits)},
+		{"newton", mustDecompress(newton)},
+		{"random", random},
+		{"pass-random1", mustLoadFile("testdata/pass-random1.bin")},
+		{"zeros", make([]byte, 1<<20)},
+		{"periodic", []byte(strings.Repeat("ab", 200*1000))},
+		{"runs", runs()},
+	}
+	levels := []int{BestSpeed, 2, 5, DefaultCompression}
+	if testing.Short() {
+		levels = []int{BestSpeed, DefaultCompression}
+	}
+	for _, tt := range inputs {
+		for _, level := range levels {
+			t.Run(fmt.Sprintf("%s/%d", tt.name, level), func(t *testing.T) {
+				c := compress(t, level, tt.input)
+				got, err := io.ReadAll(NewReader(bytes.NewReader(c)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, tt.input) {
+					t.Fatalf("round trip mismatch: got %s, want %s", trim(got), trim(tt.input))
+				}
+			})
+		}
+	}
+}
+
+// TestWriterSize checks that the compression ratio is comparable to that
+// of the bzip2 command, which produced the files in testdata.
+func TestWriterSize(t *testing.T) {
+	for _, compressed := range [][]byte{digits, newton} {
+		input := mustDecompress(compressed)
+		c := compress(t, BestCompression, input)
+		if len(c) > len(compressed)+len(compressed)/100 {
+			t.Errorf("compressed %d bytes to %d, want at most 1%% more than %d", len(input), len(c), len(compressed))
+		}
+	}
+}
+
+func TestWriterBlocks(t *testing.T) {
+	input := mustDecompress(newton)
+	input = append(input, runs()...)
+	c := compress(t, BestSpeed, input)
+	if c[3] != '1' {
+		t.Errorf("block size in header = %q, want '1'", c[3])
+	}
+	if got := mustDecompress(c); !bytes.Equal(got, input) {
+		t.Fatalf("round trip mismatch")
+	}
+
+	// Write in small pieces.
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i := 0; i < len(input); i += 1000 {
+		end := i + 1000
+		if end > len(input) {
+			end = len(input)
+		}
+		if _, err := w.Write(input[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustDecompress(buf.Bytes()); !bytes.Equal(got, input) {
+		t.Fatalf("round trip mismatch writing in pieces")
+	}
+}
+
+func TestWriterReset(t *testing.T) {
+	input := mustDecompress(digits)
+	var buf1, buf2 bytes.Buffer
+	w := NewWriter(&buf1)
+	w.Write(input)
+	w.Close()
+	w.Reset(&buf2)
+	w.Write(input)
+	w.Close()
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Errorf("output after Reset differs")
+	}
+	if _, err := w.Write(input); err == nil {
+		t.Errorf("Write after Close: no error")
+	}
+}
+
+func TestWriterLevel(t *testing.T) {
+	for _, level := range []int{-2, 0, BestCompression + 1} {
+		if _, err := NewWriterLevel(io.Discard, level); err == nil {
+			t.Errorf("NewWriterLevel(%d): no error", level)
+		}
+	}
+}
+
+func TestBWT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	inputs := []string{"a", "banana", "abababab", "aaaa", "mississippi", "abcabcabd"}
+	for i := 0; i < 50; i++ {
+		b := make([]byte, 1+rng.Intn(100))
+		for j := range b {
+			b[j] = 'a' + byte(rng.Intn(1+i%4))
+		}
+		inputs = append(inputs, string(b))
+	}
+	var s bwtSorter
+	for _, in := range inputs {
+		n := len(in)
+		rotations := make([]string, n)
+		for i := range rotations {
+			rotations[i] = in[i:] + in[:i]
+		}
+		sort.Strings(rotations)
+		want := make([]byte, n)
+		for i, r := range rotations {
+			want[i] = r[n-1]
+		}
+		last, origPtr := s.transform([]byte(in))
+		if string(last) != string(want) || rotations[origPtr] != in {
+			t.Errorf("transform(%q) = %q, %d; want %q, row %q", in, last, origPtr, want, rotations[origPtr])
+		}
+	}
+}
+
+func TestHuffmanCodeLengths(t *testing.T) {
+	// Frequencies following the Fibonacci sequence give the deepest
+	// possible tree, which must be limited.
+	fib := make([]int32, 30)
+	fib[0], fib[1] = 1, 1
+	for i := 2; i < len(fib); i++ {
+		fib[i] = fib[i-1] + fib[i-2]
+	}
+	for _, freq := range [][]int32{
+		{0, 0, 0},
+		{1, 0, 1000},
+		{5, 1, 1, 2, 9, 0, 3},
+		fib,
+	} {
+		lengths := make([]uint8, len(freq))
+		huffmanCodeLengths(lengths, freq, maxCodeLen)
+		// The code must be complete: the Kraft sum is exactly 1.
+		sum := 0
+		for _, l := range lengths {
+			if l < 1 || l > maxCodeLen {
+				t.Fatalf("%v: code length %d out of range", freq, l)
+			}
+			sum += 1 << (maxCodeLen - l)
+		}
+		if sum != 1<<maxCodeLen {
+			t.Errorf("%v: lengths %v do not form a complete code", freq, lengths)
+		}
+	}
+}
+
+func BenchmarkEncodeDigits(b *testing.B) { benchmarkEncode(b, digits) }
+func BenchmarkEncodeNewton(b *testing.B) { benchmarkEncode(b, newton) }
+func BenchmarkEncodeRand(b *testing.B)   { benchmarkEncode(b, random) }
+
+func benchmarkEncode(b *testing.B, compressed []byte) {
+	input := mustDecompress(compressed)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	w := NewWriter(io.Discard)
+	for i := 0; i < b.N; i++ {
+		w.Reset(io.Discard)
+		w.Write(input)
+		w.Close()
+	}
+}
@@ -80,6 +80,11 @@ type Reader struct {
 	buf          [512]byte
 	err          error
 	multistream  bool
+
+	src   io.Reader // the reader given to NewReader or Reset
+	index *Index
+	pos   int64 // offset in the uncompressed data
+	skip  int64 // bytes to discard before the next Read, after a Seek
 }
 
 // NewReader creates a new Reader reading the given reader.
@@ -104,6 +109,7 @@ func (z *Reader) Reset(r io.Reader) error {
 	*z = Reader{
 		decompressor: z.decompressor,
 		multistream:  true,
+		src:          r,
 	}
 	if rr, ok := r.(flate.Reader); ok {
 		z.r = rr
@@ -244,6 +250,26 @@ func (z *Reader) readHeader() (hdr Header, err error) {
 
 // Read implements io.Reader, reading uncompressed bytes from its underlying Reader.
 func (z *Reader) Read(p []byte) (n int, err error) {
+	// Discard the data up to the offset of the last Seek, using p as
+	// scratch space.
+	for z.skip > 0 {
+		buf := p
+		if int64(len(buf)) > z.skip {
+			buf = buf[:z.skip]
+		}
+		if len(buf) == 0 {
+			return 0, nil
+		}
+		n, err := z.read(buf)
+		z.skip -= int64(n)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return z.read(p)
+}
+
+func (z *Reader) read(p []byte) (n int, err error) {
 	if z.err != nil {
 		return 0, z.err
 	}
@@ -251,6 +277,7 @@ func (z *Reader) Read(p []byte) (n int, err error) {
 	n, z.err = z.decompressor.Read(p)
 	z.digest = crc32.Update(z.digest, crc32.IEEETable, p[:n])
 	z.size += uint32(n)
+	z.pos += int64(n)
 	if z.err != io.EOF {
 		// In the normal case we return here.
 		return n, z.err
@@ -283,7 +310,7 @@ func (z *Reader) Read(p []byte) (n int, err error) {
 	if n > 0 {
 		return n, nil
 	}
-	return z.Read(p)
+	return z.read(p)
 }
 
 // Close closes the Reader. It does not close the underlying io.Reader.
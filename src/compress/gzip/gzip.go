@@ -36,6 +36,21 @@ type Writer struct {
 	closed      bool
 	buf         [10]byte
 	err         error
+
+	count       countWriter // counts the bytes written to w; its w is the underlying writer
+	offset      int64       // total uncompressed size so far
+	memberStart int64       // uncompressed offset of the current member
+
+	// Settings kept by Reset.
+	blockSize int   // if not zero, the size of the blocks compressed concurrently
+	blocks    int   // the maximum number of blocks compressed at once
+	interval  int64 // if not zero, a new member starts every interval bytes
+
+	index   []IndexEntry
+	cur     *block   // the block being filled
+	pending []*block // the blocks being compressed, in order
+	free    []*block
+	window  []byte // the last 32 KiB of input of the current member
 }
 
 // NewWriter returns a new Writer.
@@ -68,16 +83,21 @@ func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
 
 func (z *Writer) init(w io.Writer, level int) {
 	compressor := z.compressor
-	if compressor != nil {
-		compressor.Reset(w)
-	}
 	*z = Writer{
 		Header: Header{
 			OS: 255, // unknown
 		},
-		w:          w,
 		level:      level,
 		compressor: compressor,
+		blockSize:  z.blockSize,
+		blocks:     z.blocks,
+		interval:   z.interval,
+		free:       z.free,
+	}
+	z.count.w = w
+	z.w = &z.count
+	if compressor != nil {
+		compressor.Reset(z.w)
 	}
 }
 
@@ -134,67 +154,128 @@ func (z *Writer) writeString(s string) (err error) {
 	return err
 }
 
+// writeHeader writes the GZIP header of a member starting at the
+// uncompressed offset off, recording it in the index if there is one.
+func (z *Writer) writeHeader(off int64) error {
+	if z.interval > 0 {
+		z.index = append(z.index, IndexEntry{CompressedOffset: z.count.n, UncompressedOffset: off})
+	}
+	z.buf = [10]byte{0: gzipID1, 1: gzipID2, 2: gzipDeflate}
+	if z.Extra != nil {
+		z.buf[3] |= 0x04
+	}
+	if z.Name != "" {
+		z.buf[3] |= 0x08
+	}
+	if z.Comment != "" {
+		z.buf[3] |= 0x10
+	}
+	if z.ModTime.After(time.Unix(0, 0)) {
+		// Section 2.3.1, the zero value for MTIME means that the
+		// modified time is not set.
+		le.PutUint32(z.buf[4:8], uint32(z.ModTime.Unix()))
+	}
+	if z.level == BestCompression {
+		z.buf[8] = 2
+	} else if z.level == BestSpeed {
+		z.buf[8] = 4
+	}
+	z.buf[9] = z.OS
+	if _, err := z.w.Write(z.buf[:10]); err != nil {
+		return err
+	}
+	if z.Extra != nil {
+		if err := z.writeBytes(z.Extra); err != nil {
+			return err
+		}
+	}
+	if z.Name != "" {
+		if err := z.writeString(z.Name); err != nil {
+			return err
+		}
+	}
+	if z.Comment != "" {
+		if err := z.writeString(z.Comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTrailer writes the GZIP footer of a member.
+func (z *Writer) writeTrailer(digest, size uint32) error {
+	le.PutUint32(z.buf[:4], digest)
+	le.PutUint32(z.buf[4:8], size)
+	_, err := z.w.Write(z.buf[:8])
+	return err
+}
+
 // Write writes a compressed form of p to the underlying io.Writer. The
 // compressed bytes are not necessarily flushed until the Writer is closed.
 func (z *Writer) Write(p []byte) (int, error) {
 	if z.err != nil {
 		return 0, z.err
 	}
-	var n int
-	// Write the GZIP header lazily.
-	if !z.wroteHeader {
-		z.wroteHeader = true
-		z.buf = [10]byte{0: gzipID1, 1: gzipID2, 2: gzipDeflate}
-		if z.Extra != nil {
-			z.buf[3] |= 0x04
-		}
-		if z.Name != "" {
-			z.buf[3] |= 0x08
-		}
-		if z.Comment != "" {
-			z.buf[3] |= 0x10
-		}
-		if z.ModTime.After(time.Unix(0, 0)) {
-			// Section 2.3.1, the zero value for MTIME means that the
-			// modified time is not set.
-			le.PutUint32(z.buf[4:8], uint32(z.ModTime.Unix()))
-		}
-		if z.level == BestCompression {
-			z.buf[8] = 2
-		} else if z.level == BestSpeed {
-			z.buf[8] = 4
-		}
-		z.buf[9] = z.OS
-		_, z.err = z.w.Write(z.buf[:10])
-		if z.err != nil {
-			return 0, z.err
-		}
-		if z.Extra != nil {
-			z.err = z.writeBytes(z.Extra)
-			if z.err != nil {
-				return 0, z.err
+	if z.blockSize > 0 {
+		return z.writeBlocks(p)
+	}
+	n := 0
+	for {
+		// Write the GZIP header lazily. With an index interval, a
+		// new member is only started once there is data for it.
+		if !z.wroteHeader {
+			if len(p) == 0 && z.offset > 0 {
+				return n, nil
+			}
+			z.wroteHeader = true
+			z.memberStart = z.offset
+			if z.err = z.writeHeader(z.offset); z.err != nil {
+				return n, z.err
+			}
+			if z.compressor == nil {
+				z.compressor, _ = flate.NewWriter(z.w, z.level)
+			} else if z.offset > 0 {
+				z.compressor.Reset(z.w)
 			}
 		}
-		if z.Name != "" {
-			z.err = z.writeString(z.Name)
-			if z.err != nil {
-				return 0, z.err
+		q := p
+		if z.interval > 0 {
+			if left := z.memberStart + z.interval - z.offset; int64(len(q)) > left {
+				q = q[:left]
 			}
 		}
-		if z.Comment != "" {
-			z.err = z.writeString(z.Comment)
-			if z.err != nil {
-				return 0, z.err
+		z.size += uint32(len(q))
+		z.digest = crc32.Update(z.digest, crc32.IEEETable, q)
+		z.offset += int64(len(q))
+		m, err := z.compressor.Write(q)
+		n += m
+		if err != nil {
+			z.err = err
+			return n, z.err
+		}
+		p = p[len(q):]
+		if z.interval > 0 && z.offset == z.memberStart+z.interval {
+			if z.err = z.endMember(); z.err != nil {
+				return n, z.err
 			}
 		}
-		if z.compressor == nil {
-			z.compressor, _ = flate.NewWriter(z.w, z.level)
+		if len(p) == 0 {
+			return n, nil
 		}
 	}
-	z.size += uint32(len(p))
-	z.digest = crc32.Update(z.digest, crc32.IEEETable, p)
-	n, z.err = z.compressor.Write(p)
-	return n, z.err
+}
+
+// endMember finishes the current member.
+func (z *Writer) endMember() error {
+	if err := z.compressor.Close(); err != nil {
+		return err
+	}
+	if err := z.writeTrailer(z.digest, z.size); err != nil {
+		return err
+	}
+	z.wroteHeader = false
+	z.digest, z.size = 0, 0
+	return nil
 }
 
 // Flush flushes any pending compressed data to the underlying writer.
@@ -212,7 +293,14 @@ func (z *Writer) Flush() error {
 	if z.closed {
 		return nil
 	}
+	if z.blockSize > 0 {
+		return z.flushBlocks()
+	}
 	if !z.wroteHeader {
+		if z.offset > 0 {
+			// The last member is complete.
+			return nil
+		}
 		z.Write(nil)
 		if z.err != nil {
 			return z.err
@@ -233,18 +321,31 @@ func (z *Writer) Close() error {
 		return nil
 	}
 	z.closed = true
+	if z.blockSize > 0 {
+		z.err = z.closeBlocks()
+		return z.err
+	}
 	if !z.wroteHeader {
+		if z.offset > 0 {
+			return nil
+		}
 		z.Write(nil)
 		if z.err != nil {
 			return z.err
 		}
 	}
-	z.err = z.compressor.Close()
-	if z.err != nil {
-		return z.err
-	}
-	le.PutUint32(z.buf[:4], z.digest)
-	le.PutUint32(z.buf[4:8], z.size)
-	_, z.err = z.w.Write(z.buf[:8])
+	z.err = z.endMember()
 	return z.err
 }
+
+// A countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,205 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// An Index records where the members of a gzip file start, both in the
+// file and in the uncompressed data, so that a Reader can seek within the
+// file by decompressing it from the start of a member rather than from
+// the start of the file.
+//
+// An Index is produced by a Writer with an index interval; see
+// Writer.SetIndexInterval. It can be stored alongside the gzip file using
+// its MarshalBinary method.
+type Index struct {
+	Members []IndexEntry // in increasing order of offset
+	Size    int64        // total size of the uncompressed data
+}
+
+// An IndexEntry records the start of a member of a gzip file.
+type IndexEntry struct {
+	CompressedOffset   int64 // offset of the member header in the file
+	UncompressedOffset int64 // offset of the member's data in the uncompressed data
+}
+
+var errIndex = errors.New("gzip: invalid index")
+
+// indexMagic starts the binary encoding of an Index.
+const indexMagic = "gzidx\x01"
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (x *Index) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, len(indexMagic)+2*binary.MaxVarintLen64*(len(x.Members)+1))
+	b = append(b, indexMagic...)
+	var tmp [binary.MaxVarintLen64]byte
+	put := func(v int64) {
+		b = append(b, tmp[:binary.PutUvarint(tmp[:], uint64(v))]...)
+	}
+	put(int64(len(x.Members)))
+	var prev IndexEntry
+	for _, e := range x.Members {
+		if e.CompressedOffset < prev.CompressedOffset || e.UncompressedOffset < prev.UncompressedOffset {
+			return nil, errIndex
+		}
+		put(e.CompressedOffset - prev.CompressedOffset)
+		put(e.UncompressedOffset - prev.UncompressedOffset)
+		prev = e
+	}
+	if x.Size < prev.UncompressedOffset {
+		return nil, errIndex
+	}
+	put(x.Size - prev.UncompressedOffset)
+	return b, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (x *Index) UnmarshalBinary(data []byte) error {
+	if len(data) < len(indexMagic) || string(data[:len(indexMagic)]) != indexMagic {
+		return errIndex
+	}
+	data = data[len(indexMagic):]
+	get := func(prev int64) (int64, error) {
+		v, n := binary.Uvarint(data)
+		if n <= 0 || v > uint64(1<<63-1-prev) {
+			return 0, errIndex
+		}
+		data = data[n:]
+		return prev + int64(v), nil
+	}
+	n, err := get(0)
+	if err != nil || n > int64(len(data)) {
+		return errIndex
+	}
+	members := make([]IndexEntry, n)
+	var prev IndexEntry
+	for i := range members {
+		if prev.CompressedOffset, err = get(prev.CompressedOffset); err != nil {
+			return err
+		}
+		if prev.UncompressedOffset, err = get(prev.UncompressedOffset); err != nil {
+			return err
+		}
+		members[i] = prev
+	}
+	size, err := get(prev.UncompressedOffset)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		return errIndex
+	}
+	x.Members = members
+	x.Size = size
+	return nil
+}
+
+// SetIndexInterval makes z start a new gzip member every interval bytes of
+// input and record where each member starts in the Index returned by
+// z.Index. A Reader given that index can seek to any offset by
+// decompressing at most interval bytes. As the members follow each other,
+// the output can still be decompressed by any gzip reader, each member
+// repeating the Header of z.
+//
+// SetIndexInterval must be called before the first call to Write, Flush,
+// or Close. The setting is kept by Reset.
+func (z *Writer) SetIndexInterval(interval int64) error {
+	if interval <= 0 {
+		return errors.New("gzip: invalid index interval")
+	}
+	if z.wroteHeader || z.offset > 0 {
+		return errors.New("gzip: SetIndexInterval called after Write")
+	}
+	z.interval = interval
+	return nil
+}
+
+// Index returns the index of the members written by z, which is only
+// complete once z has been closed. It returns nil if no index interval was
+// set with SetIndexInterval.
+func (z *Writer) Index() *Index {
+	if z.interval == 0 {
+		return nil
+	}
+	return &Index{
+		Members: append([]IndexEntry(nil), z.index...),
+		Size:    z.offset,
+	}
+}
+
+// SetIndex gives z an index of its input, which must have been produced
+// along with it, enabling z to seek.
+func (z *Reader) SetIndex(x *Index) {
+	z.index = x
+}
+
+// Seek implements the io.Seeker interface, setting the offset for the next
+// Read in the uncompressed data. It requires an index, set with SetIndex,
+// and the io.Reader given to NewReader or Reset to also implement
+// io.Seeker. The offsets in the index are taken to be relative to the
+// start of that reader; an io.SectionReader can be used if the gzip data
+// does not start at offset 0.
+//
+// Seek only moves the underlying reader when the new offset cannot be
+// reached by reading forward from the current member.
+func (z *Reader) Seek(offset int64, whence int) (int64, error) {
+	if z.index == nil || len(z.index.Members) == 0 {
+		return 0, errors.New("gzip.Reader.Seek: no index")
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += z.pos + z.skip
+	case io.SeekEnd:
+		offset += z.index.Size
+	default:
+		return 0, errors.New("gzip.Reader.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("gzip.Reader.Seek: negative position")
+	}
+
+	// Find the last member starting at or before offset.
+	members := z.index.Members
+	i := sort.Search(len(members), func(i int) bool {
+		return members[i].UncompressedOffset > offset
+	}) - 1
+	if i < 0 {
+		return 0, errIndex
+	}
+	m := members[i]
+	if z.err == nil && m.UncompressedOffset <= z.pos && z.pos <= offset {
+		z.skip = offset - z.pos
+		return offset, nil
+	}
+
+	s, ok := z.src.(io.Seeker)
+	if !ok {
+		return 0, errors.New("gzip.Reader.Seek: underlying reader does not implement io.Seeker")
+	}
+	if _, z.err = s.Seek(m.CompressedOffset, io.SeekStart); z.err != nil {
+		return 0, z.err
+	}
+	if rr, ok := z.src.(flate.Reader); ok {
+		z.r = rr
+	} else {
+		z.r.(*bufio.Reader).Reset(z.src)
+	}
+	z.digest, z.size = 0, 0
+	if _, z.err = z.readHeader(); z.err != nil {
+		z.err = noEOF(z.err)
+		return 0, z.err
+	}
+	z.pos = m.UncompressedOffset
+	z.skip = offset - z.pos
+	return offset, nil
+}
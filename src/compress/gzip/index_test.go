@@ -0,0 +1,186 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// indexed compresses input with the given index interval, concurrently if
+// blockSize is not zero.
+func indexed(t *testing.T, input []byte, interval int64, blockSize int) ([]byte, *Index) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Name = "name"
+	if blockSize > 0 {
+		w.SetConcurrency(blockSize, 4)
+	}
+	if w.Index() != nil {
+		t.Errorf("Index without interval is not nil")
+	}
+	if err := w.SetIndexInterval(interval); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(input); i += 3000 {
+		end := i + 3000
+		if end > len(input) {
+			end = len(input)
+		}
+		w.Write(input[i:end])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), w.Index()
+}
+
+func TestWriterIndex(t *testing.T) {
+	input := testData(t, 200<<10)
+	for _, tt := range []struct {
+		interval  int64
+		blockSize int
+	}{
+		{50 << 10, 0},
+		{50 << 10, 16 << 10},
+		{30000, 0},
+		{30000, 64 << 10},
+		{1 << 20, 0},
+		{1 << 20, 64 << 10},
+	} {
+		t.Run(fmt.Sprintf("%d/%d", tt.interval, tt.blockSize), func(t *testing.T) {
+			c, x := indexed(t, input, tt.interval, tt.blockSize)
+			if got := gunzip(t, c); !bytes.Equal(got, input) {
+				t.Fatalf("round trip mismatch")
+			}
+			n := (int64(len(input)) + tt.interval - 1) / tt.interval
+			if got := countMembers(t, c); int64(got) != n {
+				t.Errorf("got %d members, want %d", got, n)
+			}
+			if int64(len(x.Members)) != n || x.Size != int64(len(input)) {
+				t.Fatalf("index has %d members and size %d, want %d and %d", len(x.Members), x.Size, n, len(input))
+			}
+			for i, m := range x.Members {
+				if m.UncompressedOffset != int64(i)*tt.interval {
+					t.Errorf("member %d at uncompressed offset %d, want %d", i, m.UncompressedOffset, int64(i)*tt.interval)
+				}
+				r, err := NewReader(bytes.NewReader(c[m.CompressedOffset:]))
+				if err != nil {
+					t.Fatalf("member %d: %v", i, err)
+				}
+				if r.Name != "name" {
+					t.Errorf("member %d: Name = %q, want %q", i, r.Name, "name")
+				}
+				got, err := io.ReadAll(r)
+				if err != nil || !bytes.Equal(got, input[m.UncompressedOffset:]) {
+					t.Errorf("member %d: reading from its offset: mismatch, %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestReaderSeek(t *testing.T) {
+	input := testData(t, 200<<10)
+	c, x := indexed(t, input, 20000, 0)
+	r, err := NewReader(bytes.NewReader(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err == nil {
+		t.Errorf("Seek without index: no error")
+	}
+	r.SetIndex(x)
+
+	rng := rand.New(rand.NewSource(1))
+	pos := int64(0)
+	buf := make([]byte, 5000)
+	for i := 0; i < 200; i++ {
+		var off, want int64
+		whence := rng.Intn(3)
+		switch whence {
+		case io.SeekStart:
+			want = rng.Int63n(int64(len(input)) + 10)
+			off = want
+		case io.SeekCurrent:
+			off = rng.Int63n(50000) - 25000
+			want = pos + off
+		case io.SeekEnd:
+			off = -rng.Int63n(int64(len(input)))
+			want = int64(len(input)) + off
+		}
+		got, err := r.Seek(off, whence)
+		if want < 0 {
+			if err == nil {
+				t.Errorf("Seek(%d, %d) to %d: no error", off, whence, want)
+			}
+			continue
+		}
+		if got != want || err != nil {
+			t.Fatalf("Seek(%d, %d) = %d, %v; want %d, nil", off, whence, got, err, want)
+		}
+		pos = want
+
+		n, err := io.ReadFull(r, buf[:rng.Intn(len(buf))])
+		wantN := int64(len(input)) - pos
+		if wantN > int64(n) {
+			wantN = int64(n)
+		}
+		if wantN < 0 {
+			wantN = 0
+		}
+		if int64(n) != wantN || !bytes.Equal(buf[:n], input[pos:pos+wantN]) {
+			t.Fatalf("read %d bytes at %d, %v: mismatch", n, pos, err)
+		}
+		pos += int64(n)
+	}
+
+	// Seeking needs an io.Seeker.
+	r, err = NewReader(struct{ io.Reader }{bytes.NewReader(c)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetIndex(x)
+	if _, err := r.Seek(100, io.SeekStart); err != nil {
+		t.Errorf("Seek forward within the first member: %v", err)
+	}
+	if _, err := r.Seek(100<<10, io.SeekStart); err == nil {
+		t.Errorf("Seek on a reader without Seek: no error")
+	}
+}
+
+func TestIndexMarshal(t *testing.T) {
+	input := testData(t, 100<<10)
+	_, x := indexed(t, input, 10000, 0)
+	b, err := x.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y Index
+	if err := y.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x, &y) {
+		t.Errorf("UnmarshalBinary(MarshalBinary(%v)) = %v", x, y)
+	}
+
+	for i := 0; i < len(b); i++ {
+		if err := y.UnmarshalBinary(b[:i]); err == nil {
+			t.Errorf("UnmarshalBinary of %d bytes of %d: no error", i, len(b))
+		}
+	}
+	if err := y.UnmarshalBinary(append(b, 0)); err == nil {
+		t.Errorf("UnmarshalBinary with trailing data: no error")
+	}
+
+	bad := &Index{Members: []IndexEntry{{0, 0}, {10, 5}, {5, 10}}, Size: 20}
+	if _, err := bad.MarshalBinary(); err == nil {
+		t.Errorf("MarshalBinary of unordered index: no error")
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"hash/crc32"
+)
+
+// windowSize is the size of the dictionary given to each block, the
+// largest distance that DEFLATE can refer back to.
+const windowSize = 32 << 10
+
+// SetConcurrency makes z compress its input in blocks of blockSize bytes,
+// up to blocks of which are compressed at once, each on its own goroutine.
+//
+// Each block is compressed with the preceding 32 KiB of input as a preset
+// dictionary and its output is ended by the equivalent of Flush, so that
+// the compressed blocks join into a single standard gzip member. Compression
+// is only slightly worse than without concurrency, mostly because of the
+// empty block written by each flush. Flush itself ends the current block
+// early and waits for every pending block to be written.
+//
+// Concurrent compression uses memory for up to blocks blocks of input and
+// their compressed output, as well as a compressor for each of them.
+//
+// SetConcurrency must be called before the first call to Write, Flush, or
+// Close. The setting is kept by Reset.
+func (z *Writer) SetConcurrency(blockSize, blocks int) error {
+	if blockSize <= 0 || blocks <= 0 {
+		return errors.New("gzip: invalid concurrency settings")
+	}
+	if z.wroteHeader || z.offset > 0 {
+		return errors.New("gzip: SetConcurrency called after Write")
+	}
+	z.blockSize = blockSize
+	z.blocks = blocks
+	return nil
+}
+
+// A block is a piece of the input compressed on its own goroutine.
+type block struct {
+	in    []byte
+	dict  []byte
+	out   bytes.Buffer
+	level int
+	done  chan struct{} // receives a value when out is complete
+	err   error
+
+	start  bool  // the block is the first of a member
+	offset int64 // uncompressed offset of the member, if start is set
+	final  bool  // the block is the last of a member
+	digest uint32
+	size   uint32 // trailer of the member, if final is set
+}
+
+func (b *block) compress() {
+	b.out.Reset()
+	fw, err := flate.NewWriterDict(&b.out, b.level, b.dict)
+	if err == nil {
+		_, err = fw.Write(b.in)
+	}
+	if err == nil {
+		if b.final {
+			err = fw.Close()
+		} else {
+			err = fw.Flush()
+		}
+	}
+	b.err = err
+	b.done <- struct{}{}
+}
+
+// writeBlocks is Write for concurrent compression.
+func (z *Writer) writeBlocks(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		z.startMember()
+		q := p
+		if room := z.blockSize - len(z.cur.in); len(q) > room {
+			q = q[:room]
+		}
+		if z.interval > 0 {
+			if left := z.memberStart + z.interval - z.offset; int64(len(q)) > left {
+				q = q[:left]
+			}
+		}
+		z.cur.in = append(z.cur.in, q...)
+		z.size += uint32(len(q))
+		z.digest = crc32.Update(z.digest, crc32.IEEETable, q)
+		z.offset += int64(len(q))
+		n += len(q)
+		p = p[len(q):]
+
+		final := z.interval > 0 && z.offset == z.memberStart+z.interval
+		if final || len(z.cur.in) == z.blockSize {
+			if z.err = z.startBlock(final); z.err != nil {
+				return n, z.err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (z *Writer) newBlock() *block {
+	if n := len(z.free); n > 0 {
+		b := z.free[n-1]
+		z.free = z.free[:n-1]
+		return b
+	}
+	return &block{
+		in:   make([]byte, 0, z.blockSize),
+		done: make(chan struct{}, 1),
+	}
+}
+
+// startBlock starts compressing the current block, after waiting for room
+// in the queue of pending blocks. If final is set, the block ends the
+// current member.
+func (z *Writer) startBlock(final bool) error {
+	b := z.cur
+	z.cur = nil
+	b.level = z.level
+	b.dict = append(b.dict[:0], z.window...)
+	b.final = final
+	if final {
+		b.digest, b.size = z.digest, z.size
+		z.digest, z.size = 0, 0
+		z.wroteHeader = false
+		z.window = z.window[:0]
+	} else if len(b.in) >= windowSize {
+		z.window = append(z.window[:0], b.in[len(b.in)-windowSize:]...)
+	} else {
+		z.window = append(z.window, b.in...)
+		if n := len(z.window); n > windowSize {
+			z.window = z.window[:copy(z.window, z.window[n-windowSize:])]
+		}
+	}
+
+	if len(z.pending) == z.blocks {
+		if err := z.writeNextBlock(); err != nil {
+			return err
+		}
+	}
+	z.pending = append(z.pending, b)
+	go b.compress()
+	return nil
+}
+
+// writeNextBlock waits for the oldest pending block to be compressed and
+// writes it, along with the header and trailer of its member if needed.
+func (z *Writer) writeNextBlock() error {
+	b := z.pending[0]
+	<-b.done
+	z.pending = z.pending[:copy(z.pending, z.pending[1:])]
+	defer func() {
+		b.in = b.in[:0]
+		b.start, b.final = false, false
+		z.free = append(z.free, b)
+	}()
+	if b.err != nil {
+		return b.err
+	}
+	if b.start {
+		if err := z.writeHeader(b.offset); err != nil {
+			return err
+		}
+	}
+	if _, err := z.w.Write(b.out.Bytes()); err != nil {
+		return err
+	}
+	if b.final {
+		return z.writeTrailer(b.digest, b.size)
+	}
+	return nil
+}
+
+// writePending writes all the pending blocks.
+func (z *Writer) writePending() error {
+	for len(z.pending) > 0 {
+		if err := z.writeNextBlock(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushBlocks is Flush for concurrent compression.
+func (z *Writer) flushBlocks() error {
+	if z.cur != nil || (!z.wroteHeader && z.offset == 0) {
+		z.startMember()
+		if z.err = z.startBlock(false); z.err != nil {
+			return z.err
+		}
+	}
+	z.err = z.writePending()
+	return z.err
+}
+
+// closeBlocks is Close for concurrent compression.
+func (z *Writer) closeBlocks() error {
+	// An empty final block ends the member if the input ended with a
+	// full block.
+	if z.wroteHeader || z.offset == 0 {
+		z.startMember()
+		if err := z.startBlock(true); err != nil {
+			return err
+		}
+	}
+	return z.writePending()
+}
+
+// startMember makes sure that there is a current block and that a member
+// has been started.
+func (z *Writer) startMember() {
+	if z.cur == nil {
+		z.cur = z.newBlock()
+	}
+	if !z.wroteHeader {
+		z.wroteHeader = true
+		z.memberStart = z.offset
+		z.cur.start, z.cur.offset = true, z.offset
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// testData returns compressible test data of about n bytes.
+func testData(t testing.TB, n int) []byte {
+	e, err := os.ReadFile("../testdata/e.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := os.ReadFile("../testdata/gettysburg.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b []byte
+	for len(b) < n {
+		b = append(b, g...)
+		b = append(b, e[:len(e)/4]...)
+	}
+	return b[:n]
+}
+
+func gunzip(t *testing.T, compressed []byte) []byte {
+	r, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// countMembers returns the number of members in a gzip file.
+func countMembers(t *testing.T, compressed []byte) int {
+	br := bytes.NewReader(compressed)
+	var r Reader
+	n := 0
+	for {
+		if err := r.Reset(br); err == io.EOF {
+			return n
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		r.Multistream(false)
+		if _, err := io.Copy(io.Discard, &r); err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+}
+
+func TestWriterConcurrency(t *testing.T) {
+	input := testData(t, 1<<20)
+	var serial bytes.Buffer
+	w := NewWriter(&serial)
+	w.Write(input)
+	w.Close()
+
+	for _, tt := range []struct {
+		blockSize, blocks int
+		chunk             int
+	}{
+		{64 << 10, 4, len(input)},
+		{64 << 10, 4, 1000},
+		{100 << 10, 1, 1 << 16},
+		{1 << 20, 8, len(input)},
+		{1 << 20, 8, 1 << 20},
+		{5000, 3, 777},
+	} {
+		t.Run(fmt.Sprintf("%d/%d/%d", tt.blockSize, tt.blocks, tt.chunk), func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			w.Name = "name"
+			if err := w.SetConcurrency(tt.blockSize, tt.blocks); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < len(input); i += tt.chunk {
+				end := i + tt.chunk
+				if end > len(input) {
+					end = len(input)
+				}
+				if n, err := w.Write(input[i:end]); n != end-i || err != nil {
+					t.Fatalf("Write = %d, %v", n, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := gunzip(t, buf.Bytes()); !bytes.Equal(got, input) {
+				t.Fatalf("round trip mismatch")
+			}
+			if n := countMembers(t, buf.Bytes()); n != 1 {
+				t.Errorf("got %d members, want 1", n)
+			}
+			if tt.blockSize >= 64<<10 && buf.Len() > serial.Len()+serial.Len()/100 {
+				t.Errorf("compressed to %d bytes, want at most 1%% more than %d", buf.Len(), serial.Len())
+			}
+		})
+	}
+}
+
+func TestWriterConcurrencyEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(1<<10, 2)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := gunzip(t, buf.Bytes()); len(got) != 0 {
+		t.Errorf("got %q, want empty", got)
+	}
+}
+
+func TestWriterConcurrencyFlush(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(1<<10, 4)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	input := testData(t, 100<<10)
+	for len(input) > 0 {
+		n := rng.Intn(5000)
+		if n > len(input) {
+			n = len(input)
+		}
+		msg := input[:n]
+		input = input[len(msg):]
+		w.Write(msg)
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, len(msg))
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("got %q, want %q", got, msg)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read at end = %d, %v; want 0, io.EOF", n, err)
+	}
+}
+
+func TestWriterConcurrencyReset(t *testing.T) {
+	input := testData(t, 300<<10)
+	var buf1, buf2 bytes.Buffer
+	w := NewWriter(&buf1)
+	w.SetConcurrency(64<<10, 2)
+	w.Write(input)
+	w.Close()
+	if err := w.SetConcurrency(64<<10, 2); err == nil {
+		t.Errorf("SetConcurrency after Write: no error")
+	}
+	w.Reset(&buf2)
+	w.Write(input)
+	w.Close()
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Errorf("output after Reset differs")
+	}
+
+	var serial bytes.Buffer
+	w = NewWriter(&serial)
+	w.Write(input)
+	w.Close()
+	if bytes.Equal(buf2.Bytes(), serial.Bytes()) {
+		t.Errorf("Reset did not keep the concurrency setting")
+	}
+}
+
+func TestWriterConcurrencyError(t *testing.T) {
+	input := testData(t, 300<<10)
+	w := NewWriter(&limitedWriter{1000})
+	w.SetConcurrency(10<<10, 2)
+	var err error
+	for i := 0; i < len(input) && err == nil; i += 1000 {
+		_, err = w.Write(input[i : i+1000])
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != io.ErrShortWrite {
+		t.Errorf("got %v, want %v", err, io.ErrShortWrite)
+	}
+	if err := w.Close(); err != io.ErrShortWrite {
+		t.Errorf("Close after error = %v, want %v", err, io.ErrShortWrite)
+	}
+}
+
+func BenchmarkWriterConcurrency(b *testing.B) {
+	input := testData(b, 8<<20)
+	b.SetBytes(int64(len(input)))
+	w := NewWriter(io.Discard)
+	w.SetConcurrency(1<<20, 8)
+	for i := 0; i < b.N; i++ {
+		w.Reset(io.Discard)
+		w.Write(input)
+		w.Close()
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import "math/bits"
+
+// highBit returns the index of the highest set bit of v, which must
+// not be zero.
+func highBit(v uint32) uint8 {
+	return uint8(bits.Len32(v) - 1)
+}
+
+// forwardBitReader reads bits from the start of a buffer, least
+// significant bit first. It is used for FSE table descriptions.
+type forwardBitReader struct {
+	data []byte
+	pos  uint // bit position of the next bit
+}
+
+// peek returns the next 32 bits, padded with zeros past the end of data.
+func (r *forwardBitReader) peek() uint32 {
+	i := r.pos / 8
+	var v uint64
+	for j := uint(0); j < 5 && i+j < uint(len(r.data)); j++ {
+		v |= uint64(r.data[i+j]) << (8 * j)
+	}
+	return uint32(v >> (r.pos % 8))
+}
+
+func (r *forwardBitReader) skip(n uint) {
+	r.pos += n
+}
+
+// overflow reports whether r has read past the end of data.
+func (r *forwardBitReader) overflow() bool {
+	return r.pos > uint(len(r.data))*8
+}
+
+// reverseBitReader reads a bitstream written by a bitWriter. The
+// stream is read backwards, starting from the end of the buffer, whose
+// last byte holds a 1 bit marking where the stream begins.
+//
+// Reading past the start of the stream yields zero bits; the number of
+// such bits is recorded so that callers can detect the condition.
+type reverseBitReader struct {
+	data []byte
+	off  int    // data[:off] has not been loaded yet
+	bits uint64 // the low cnt bits are unread
+	cnt  uint
+	over uint // number of bits read past the start of the stream
+}
+
+func (r *reverseBitReader) init(data []byte) error {
+	if len(data) == 0 {
+		return StructuralError("empty bitstream")
+	}
+	last := data[len(data)-1]
+	if last == 0 {
+		return StructuralError("missing bitstream end marker")
+	}
+	r.data = data
+	r.off = len(data) - 1
+	r.cnt = uint(highBit(uint32(last)))
+	r.bits = uint64(last) & (1<<r.cnt - 1)
+	r.over = 0
+	return nil
+}
+
+func (r *reverseBitReader) fill() {
+	for r.cnt <= 56 && r.off > 0 {
+		r.off--
+		r.bits = r.bits<<8 | uint64(r.data[r.off])
+		r.cnt += 8
+	}
+}
+
+// read reads n bits, n <= 32.
+func (r *reverseBitReader) read(n uint8) uint32 {
+	if n == 0 {
+		return 0
+	}
+	if r.cnt < uint(n) {
+		r.fill()
+		if r.cnt < uint(n) {
+			d := uint(n) - r.cnt
+			r.over += d
+			r.bits <<= d
+			r.cnt = uint(n)
+		}
+	}
+	r.cnt -= uint(n)
+	v := r.bits >> r.cnt
+	r.bits &= 1<<r.cnt - 1
+	return uint32(v)
+}
+
+// peek returns the next n bits without consuming them, n <= 32.
+func (r *reverseBitReader) peek(n uint8) uint32 {
+	if r.cnt < uint(n) {
+		r.fill()
+		if r.cnt < uint(n) {
+			return uint32(r.bits << (uint(n) - r.cnt))
+		}
+	}
+	return uint32(r.bits >> (r.cnt - uint(n)))
+}
+
+// skip consumes n bits previously examined with peek.
+func (r *reverseBitReader) skip(n uint8) {
+	if r.cnt < uint(n) {
+		r.over += uint(n) - r.cnt
+		r.cnt = 0
+		r.bits = 0
+		return
+	}
+	r.cnt -= uint(n)
+	r.bits &= 1<<r.cnt - 1
+}
+
+// finished reports whether the whole stream has been read exactly.
+func (r *reverseBitReader) finished() bool {
+	return r.off == 0 && r.cnt == 0 && r.over == 0
+}
+
+// bitWriter writes a bitstream to be read by a reverseBitReader.
+type bitWriter struct {
+	out  []byte
+	bits uint64
+	n    uint
+}
+
+// add writes the low n bits of v, n <= 32.
+func (w *bitWriter) add(v uint32, n uint8) {
+	w.bits |= uint64(v) & (1<<n - 1) << w.n
+	w.n += uint(n)
+	if w.n >= 32 {
+		w.out = append(w.out, byte(w.bits), byte(w.bits>>8), byte(w.bits>>16), byte(w.bits>>24))
+		w.bits >>= 32
+		w.n -= 32
+	}
+}
+
+// flush writes the buffered bits, padding the last byte with zeros.
+func (w *bitWriter) flush() {
+	for w.n > 0 {
+		w.out = append(w.out, byte(w.bits))
+		w.bits >>= 8
+		if w.n < 8 {
+			w.n = 0
+		} else {
+			w.n -= 8
+		}
+	}
+	w.bits = 0
+}
+
+// close writes the end marker and returns the stream.
+func (w *bitWriter) close() []byte {
+	w.add(1, 1)
+	w.flush()
+	return w.out
+}
+
+// forwardBitWriter writes bits to be read by a forwardBitReader.
+type forwardBitWriter struct {
+	bitWriter
+}
+
+// close pads the last byte with zero bits and returns the stream.
+func (w *forwardBitWriter) close() []byte {
+	w.flush()
+	return w.out
+}
@@ -0,0 +1,297 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+// Decoding of compressed blocks, RFC 8878 section 3.1.1.3.
+
+// Literals block types.
+const (
+	litRaw        = 0
+	litRLE        = 1
+	litCompressed = 2
+	litTreeless   = 3
+)
+
+// decodeBlock decodes the compressed block data, appending the result
+// to z.hist.
+func (z *Reader) decodeBlock(data []byte) error {
+	lits, n, err := z.readLiterals(data)
+	if err != nil {
+		return err
+	}
+	data = data[n:]
+
+	if len(data) == 0 {
+		return StructuralError("missing sequences section")
+	}
+	var nbSeq int
+	switch b := int(data[0]); {
+	case b < 128:
+		nbSeq, n = b, 1
+	case b < 255:
+		if len(data) < 2 {
+			return StructuralError("truncated sequences section")
+		}
+		nbSeq, n = (b-128)<<8+int(data[1]), 2
+	default:
+		if len(data) < 3 {
+			return StructuralError("truncated sequences section")
+		}
+		nbSeq, n = int(data[1])+int(data[2])<<8+0x7F00, 3
+	}
+	data = data[n:]
+	if nbSeq == 0 {
+		if len(data) != 0 {
+			return StructuralError("extra data after sequences section")
+		}
+		if len(lits) > maxBlockSize {
+			return StructuralError("block too large")
+		}
+		z.hist = append(z.hist, lits...)
+		return nil
+	}
+
+	if len(data) == 0 {
+		return StructuralError("missing symbol compression modes")
+	}
+	modes := data[0]
+	if modes&3 != 0 {
+		return StructuralError("reserved symbol compression mode bits set")
+	}
+	data = data[1:]
+	for _, t := range []struct {
+		mode      byte
+		t         **fseTable
+		buf       *fseTable
+		predef    *fseTable
+		maxSymbol int
+		maxLog    uint8
+	}{
+		{modes >> 6, &z.ll, &z.llBuf, &predefLL, maxLLCode, maxLLLog},
+		{modes >> 4 & 3, &z.of, &z.ofBuf, &predefOF, maxOFCode, maxOFLog},
+		{modes >> 2 & 3, &z.ml, &z.mlBuf, &predefML, maxMLCode, maxMLLog},
+	} {
+		switch t.mode {
+		case modePredefined:
+			*t.t = t.predef
+		case modeRLE:
+			if len(data) == 0 || int(data[0]) > t.maxSymbol {
+				return StructuralError("invalid RLE symbol")
+			}
+			t.buf.buildRLE(data[0])
+			*t.t = t.buf
+			data = data[1:]
+		case modeFSE:
+			norm, log, n, err := readNCount(data, t.maxSymbol, t.maxLog)
+			if err != nil {
+				return err
+			}
+			if err := t.buf.build(norm, log); err != nil {
+				return err
+			}
+			*t.t = t.buf
+			data = data[n:]
+		case modeRepeat:
+			if *t.t == nil {
+				return StructuralError("repeat mode without previous table")
+			}
+		}
+	}
+
+	var br reverseBitReader
+	if err := br.init(data); err != nil {
+		return err
+	}
+	var ll, of, ml fseDecoder
+	ll.init(z.ll, &br)
+	of.init(z.of, &br)
+	ml.init(z.ml, &br)
+
+	start := len(z.hist)
+	for i := 0; i < nbSeq; i++ {
+		llc, ofc, mlc := ll.symbol(), of.symbol(), ml.symbol()
+		if ofc > maxOFCode {
+			return StructuralError("invalid offset code")
+		}
+		offVal := uint32(1)<<ofc + br.read(ofc)
+		matchLen := mlBase[mlc] + br.read(mlBits[mlc])
+		litLen := llBase[llc] + br.read(llBits[llc])
+		if i != nbSeq-1 {
+			ll.update(&br)
+			ml.update(&br)
+			of.update(&br)
+		}
+		if br.over > 0 {
+			return StructuralError("truncated sequences bitstream")
+		}
+
+		off := z.reps.resolve(offVal, litLen)
+		if litLen > uint32(len(lits)) {
+			return StructuralError("literals length exceeds literals")
+		}
+		if len(z.hist)-start+int(litLen)+int(matchLen) > maxBlockSize {
+			return StructuralError("block too large")
+		}
+		z.hist = append(z.hist, lits[:litLen]...)
+		lits = lits[litLen:]
+		if off == 0 || int(off) > len(z.hist) {
+			return StructuralError("invalid match offset")
+		}
+		z.hist = appendMatch(z.hist, int(off), int(matchLen))
+	}
+	if !br.finished() {
+		return StructuralError("invalid sequences bitstream")
+	}
+	if len(z.hist)-start+len(lits) > maxBlockSize {
+		return StructuralError("block too large")
+	}
+	z.hist = append(z.hist, lits...)
+	return nil
+}
+
+// appendMatch appends n bytes copied from off bytes back in b.
+func appendMatch(b []byte, off, n int) []byte {
+	src := len(b) - off
+	if off >= n {
+		return append(b, b[src:src+n]...)
+	}
+	for n > 0 {
+		// The match overlaps its own output; copy it in chunks
+		// of the period.
+		k := off
+		if k > n {
+			k = n
+		}
+		b = append(b, b[src:src+k]...)
+		n -= k
+		off += k
+	}
+	return b
+}
+
+// readLiterals reads the literals section at the start of data. It
+// returns the literals and the size of the section.
+func (z *Reader) readLiterals(data []byte) ([]byte, int, error) {
+	if len(data) == 0 {
+		return nil, 0, StructuralError("missing literals section")
+	}
+	typ := data[0] & 3
+	sizeFormat := data[0] >> 2 & 3
+
+	if typ == litRaw || typ == litRLE {
+		var size, hs int
+		switch sizeFormat {
+		case 0, 2:
+			size, hs = int(data[0]>>3), 1
+		case 1:
+			if len(data) < 2 {
+				return nil, 0, StructuralError("truncated literals header")
+			}
+			size, hs = int(data[0]>>4)+int(data[1])<<4, 2
+		case 3:
+			if len(data) < 3 {
+				return nil, 0, StructuralError("truncated literals header")
+			}
+			size, hs = int(data[0]>>4)+int(data[1])<<4+int(data[2])<<12, 3
+		}
+		if size > maxBlockSize {
+			return nil, 0, StructuralError("literals too large")
+		}
+		if typ == litRaw {
+			if hs+size > len(data) {
+				return nil, 0, StructuralError("truncated literals")
+			}
+			return data[hs : hs+size], hs + size, nil
+		}
+		if hs+1 > len(data) {
+			return nil, 0, StructuralError("truncated literals")
+		}
+		lits := z.litBuf[:0]
+		for i := 0; i < size; i++ {
+			lits = append(lits, data[hs])
+		}
+		z.litBuf = lits
+		return lits, hs + 1, nil
+	}
+
+	var regen, comp, hs int
+	streams := 4
+	switch sizeFormat {
+	case 0, 1:
+		if len(data) < 3 {
+			return nil, 0, StructuralError("truncated literals header")
+		}
+		v := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+		regen, comp, hs = v>>4&0x3FF, v>>14&0x3FF, 3
+		if sizeFormat == 0 {
+			streams = 1
+		}
+	case 2:
+		if len(data) < 4 {
+			return nil, 0, StructuralError("truncated literals header")
+		}
+		v := int(le.Uint32(data))
+		regen, comp, hs = v>>4&0x3FFF, v>>18&0x3FFF, 4
+	case 3:
+		if len(data) < 5 {
+			return nil, 0, StructuralError("truncated literals header")
+		}
+		v := int(le.Uint32(data)) | int(data[4])<<32
+		regen, comp, hs = v>>4&0x3FFFF, v>>22&0x3FFFF, 5
+	}
+	if regen > maxBlockSize {
+		return nil, 0, StructuralError("literals too large")
+	}
+	if hs+comp > len(data) {
+		return nil, 0, StructuralError("truncated literals")
+	}
+	src := data[hs : hs+comp]
+	if typ == litCompressed {
+		n, err := z.huffBuf.read(src)
+		if err != nil {
+			return nil, 0, err
+		}
+		z.huff = &z.huffBuf
+		src = src[n:]
+	} else if z.huff == nil {
+		return nil, 0, StructuralError("treeless literals without previous Huffman table")
+	}
+
+	if cap(z.litBuf) < regen {
+		z.litBuf = make([]byte, regen, maxBlockSize)
+	}
+	lits := z.litBuf[:regen]
+	if streams == 1 {
+		if err := z.huff.decode(lits, src); err != nil {
+			return nil, 0, err
+		}
+		return lits, hs + comp, nil
+	}
+
+	if len(src) < 6 {
+		return nil, 0, StructuralError("truncated literals jump table")
+	}
+	seg := (regen + 3) / 4
+	if 3*seg > regen {
+		return nil, 0, StructuralError("invalid literals size")
+	}
+	sizes := [4]int{int(le.Uint16(src)), int(le.Uint16(src[2:])), int(le.Uint16(src[4:]))}
+	src = src[6:]
+	sizes[3] = len(src) - sizes[0] - sizes[1] - sizes[2]
+	if sizes[3] < 0 {
+		return nil, 0, StructuralError("invalid literals jump table")
+	}
+	for i, size := range sizes {
+		dst := lits[i*seg:]
+		if i < 3 {
+			dst = dst[:seg]
+		}
+		if err := z.huff.decode(dst, src[:size]); err != nil {
+			return nil, 0, err
+		}
+		src = src[size:]
+	}
+	return lits, hs + comp, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+// A dict is a parsed dictionary, RFC 8878 section 5.
+//
+// A dictionary in the Zstandard format starts with a magic number and
+// an ID, followed by entropy tables that serve as the initial tables
+// of each frame, initial repeat offsets and the content. Any other
+// data is a raw content dictionary, whose ID is zero.
+type dict struct {
+	id      uint32
+	content []byte
+	reps    repOffsets
+
+	// The entropy tables are nil for a raw content dictionary.
+	huff       *huffTable
+	ll, of, ml *fseTable
+}
+
+func parseDict(b []byte) (*dict, error) {
+	if len(b) < 8 || le.Uint32(b) != dictMagic {
+		return &dict{content: b, reps: initialRepOffsets}, nil
+	}
+	d := &dict{
+		id:   le.Uint32(b[4:]),
+		huff: new(huffTable),
+		ll:   new(fseTable),
+		of:   new(fseTable),
+		ml:   new(fseTable),
+	}
+	b = b[8:]
+	n, err := d.huff.read(b)
+	if err != nil {
+		return nil, ErrDictionary
+	}
+	b = b[n:]
+	for _, t := range []struct {
+		t         *fseTable
+		maxSymbol int
+		maxLog    uint8
+	}{
+		{d.of, maxOFCode, maxOFLog},
+		{d.ml, maxMLCode, maxMLLog},
+		{d.ll, maxLLCode, maxLLLog},
+	} {
+		norm, log, n, err := readNCount(b, t.maxSymbol, t.maxLog)
+		if err != nil {
+			return nil, ErrDictionary
+		}
+		if err := t.t.build(norm, log); err != nil {
+			return nil, ErrDictionary
+		}
+		b = b[n:]
+	}
+	if len(b) < 12 {
+		return nil, ErrDictionary
+	}
+	d.content = b[12:]
+	for i := range d.reps {
+		d.reps[i] = le.Uint32(b[4*i:])
+		if d.reps[i] == 0 || d.reps[i] > uint32(len(d.content)) {
+			return nil, ErrDictionary
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,445 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import "math/bits"
+
+const (
+	minMatch = 4
+	hashMul  = 0x9E3779B1
+)
+
+// encoderParams are the parameters of a compression level.
+type encoderParams struct {
+	windowLog uint8
+	hashLog   uint8
+	chainLog  uint8 // 0 disables hash chains
+	depth     int   // maximum number of chain candidates examined
+	lazy      bool  // whether to defer matches for a longer one
+	nice      int   // match length that stops the search
+}
+
+var levelParams = [BestCompression + 1]encoderParams{
+	1: {19, 16, 0, 1, false, 32},
+	2: {20, 17, 16, 2, false, 32},
+	3: {21, 17, 17, 4, false, 48},
+	4: {21, 17, 17, 8, true, 64},
+	5: {22, 18, 18, 16, true, 96},
+	6: {22, 18, 19, 32, true, 128},
+	7: {23, 19, 20, 64, true, 192},
+	8: {23, 20, 21, 128, true, 256},
+	9: {23, 20, 21, 256, true, 512},
+}
+
+// An encoder finds matches in the data written to a Writer and encodes
+// them as compressed blocks.
+//
+// Positions in the hash tables are offsets in hist plus one, so that
+// zero means no position. When the history is shifted, the positions
+// are shifted accordingly.
+type encoder struct {
+	p          encoderParams
+	windowSize int
+	maxOffset  int // largest match offset allowed in the current frame
+
+	hist       []byte // window, followed by data not yet encoded
+	cur        int    // start of data not yet encoded in hist
+	nextInsert int    // next position to insert in the hash tables
+	head       []int32
+	chain      []int32
+	reps       repOffsets
+
+	lits []byte
+	seqs []seq
+}
+
+func (e *encoder) init(p encoderParams) {
+	e.p = p
+	e.windowSize = 1 << p.windowLog
+	e.head = make([]int32, 1<<p.hashLog)
+	if p.chainLog > 0 {
+		e.chain = make([]int32, 1<<p.chainLog)
+	}
+}
+
+// reset prepares e for a new frame using dictionary d, which may be nil.
+func (e *encoder) reset(d *dict) {
+	e.hist = e.hist[:0]
+	e.reps = initialRepOffsets
+	if d != nil {
+		e.hist = append(e.hist, d.content...)
+		e.reps = d.reps
+	}
+	e.cur = len(e.hist)
+	e.nextInsert = 0
+	e.maxOffset = e.windowSize
+	for i := range e.head {
+		e.head[i] = 0
+	}
+	for i := range e.chain {
+		e.chain[i] = 0
+	}
+}
+
+// slide drops history that is no longer within the window.
+func (e *encoder) slide() {
+	if e.cur <= 2*e.windowSize {
+		return
+	}
+	// Keep the chain index of each position by shifting by a multiple
+	// of the window size, which is a multiple of the chain size.
+	delta := (e.cur - e.windowSize) &^ (e.windowSize - 1)
+	n := copy(e.hist, e.hist[delta:])
+	e.hist = e.hist[:n]
+	e.cur -= delta
+	e.nextInsert -= delta
+	if e.nextInsert < 0 {
+		e.nextInsert = 0
+	}
+	d := int32(delta)
+	for _, t := range [][]int32{e.head, e.chain} {
+		for i, v := range t {
+			if v > d {
+				t[i] = v - d
+			} else {
+				t[i] = 0
+			}
+		}
+	}
+}
+
+func (e *encoder) hash(i int) uint32 {
+	return (le.Uint32(e.hist[i:]) * hashMul) >> (32 - e.p.hashLog)
+}
+
+// insertUpTo inserts the positions before i in the hash tables.
+func (e *encoder) insertUpTo(i int) {
+	p := e.nextInsert
+	for ; p < i && p+minMatch <= len(e.hist); p++ {
+		h := e.hash(p)
+		if e.chain != nil {
+			e.chain[p&(len(e.chain)-1)] = e.head[h]
+		}
+		e.head[h] = int32(p + 1)
+	}
+	e.nextInsert = p
+}
+
+// findMatch returns the longest match for the data at i that ends
+// before end, considering the repeat offset if litLen is not zero.
+// It returns a length of zero if there is no match.
+func (e *encoder) findMatch(i, end, litLen int) (length, offset int) {
+	e.insertUpTo(i)
+	if i+minMatch > end {
+		return 0, 0
+	}
+	var cand int
+	if i >= e.nextInsert {
+		h := e.hash(i)
+		cand = int(e.head[h]) - 1
+		if e.chain != nil {
+			e.chain[i&(len(e.chain)-1)] = e.head[h]
+		}
+		e.head[h] = int32(i + 1)
+		e.nextInsert = i + 1
+	} else if e.chain != nil {
+		cand = int(e.chain[i&(len(e.chain)-1)]) - 1
+	} else {
+		cand = int(e.head[e.hash(i)]) - 1
+		if cand >= i {
+			cand = -1
+		}
+	}
+
+	src := e.hist[i:end]
+	if r := int(e.reps[0]); litLen > 0 && r <= i && r <= e.maxOffset {
+		if l := matchLen(e.hist[i-r:], src); l >= minMatch {
+			length, offset = l, r
+		}
+	}
+	for n := e.p.depth; cand >= 0 && n > 0 && length < len(src); n-- {
+		off := i - cand
+		if off > e.maxOffset {
+			break
+		}
+		if e.hist[cand+length] == src[length] {
+			if l := matchLen(e.hist[cand:], src); l > length {
+				length, offset = l, off
+				if l >= e.p.nice {
+					break
+				}
+			}
+		}
+		if e.chain == nil {
+			break
+		}
+		next := int(e.chain[cand&(len(e.chain)-1)]) - 1
+		if next >= cand {
+			break
+		}
+		cand = next
+	}
+	if length < minMatch {
+		return 0, 0
+	}
+	return length, offset
+}
+
+// matchLen returns the length of the common prefix of a and b, with
+// len(a) >= len(b).
+func matchLen(a, b []byte) int {
+	n := 0
+	for len(b)-n >= 8 {
+		if x := le.Uint64(a[n:]) ^ le.Uint64(b[n:]); x != 0 {
+			return n + bits.TrailingZeros64(x)/8
+		}
+		n += 8
+	}
+	for n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// findSequences fills e.lits and e.seqs with the sequences encoding
+// hist[start:end].
+func (e *encoder) findSequences(start, end int) {
+	e.lits = e.lits[:0]
+	e.seqs = e.seqs[:0]
+	litStart := start
+	for i := start; i+minMatch <= end; {
+		length, offset := e.findMatch(i, end, i-litStart)
+		if length == 0 {
+			i++
+			continue
+		}
+		if e.p.lazy {
+			for length < e.p.nice && i+1+minMatch <= end {
+				l, off := e.findMatch(i+1, end, i+1-litStart)
+				if l <= length {
+					break
+				}
+				i++
+				length, offset = l, off
+			}
+		}
+		litLen := uint32(i - litStart)
+		e.lits = append(e.lits, e.hist[litStart:i]...)
+		offVal := e.reps.offsetValue(uint32(offset), litLen)
+		e.reps.resolve(offVal, litLen)
+		e.seqs = append(e.seqs, seq{litLen: litLen, matchLen: uint32(length), offVal: offVal})
+		i += length
+		litStart = i
+	}
+	e.lits = append(e.lits, e.hist[litStart:end]...)
+}
+
+// encodeBlock appends the compressed block encoding e.lits and e.seqs
+// to dst.
+func (e *encoder) encodeBlock(dst []byte) []byte {
+	dst = encodeLiterals(dst, e.lits)
+
+	n := len(e.seqs)
+	switch {
+	case n < 128:
+		dst = append(dst, byte(n))
+	case n < 0x7F00:
+		dst = append(dst, byte(n>>8+128), byte(n))
+	default:
+		dst = append(dst, 255, byte(n-0x7F00), byte((n-0x7F00)>>8))
+	}
+	if n == 0 {
+		return dst
+	}
+
+	llCodes := make([]uint8, n)
+	mlCodes := make([]uint8, n)
+	ofCodes := make([]uint8, n)
+	for i, s := range e.seqs {
+		llCodes[i] = llCode(s.litLen)
+		mlCodes[i] = mlCode(s.matchLen)
+		ofCodes[i] = ofCode(s.offVal)
+	}
+
+	modesAt := len(dst)
+	dst = append(dst, 0)
+	var llMode, ofMode, mlMode byte
+	var llEnc, ofEnc, mlEnc *fseEncoder
+	dst, llMode, llEnc = seqEncoder(dst, llCodes, maxLLLog, predefLLNorm, predefLLLog, predefLLEnc)
+	dst, ofMode, ofEnc = seqEncoder(dst, ofCodes, maxOFLog, predefOFNorm, predefOFLog, predefOFEnc)
+	dst, mlMode, mlEnc = seqEncoder(dst, mlCodes, maxMLLog, predefMLNorm, predefMLLog, predefMLEnc)
+	dst[modesAt] = llMode<<6 | ofMode<<4 | mlMode<<2
+
+	// The bitstream is read backwards, so the sequences are written
+	// in reverse order, each one's fields in reverse reading order.
+	var bw bitWriter
+	bw.out = dst
+	addExtra := func(i int) {
+		s := e.seqs[i]
+		bw.add(s.litLen-llBase[llCodes[i]], llBits[llCodes[i]])
+		bw.add(s.matchLen-mlBase[mlCodes[i]], mlBits[mlCodes[i]])
+		bw.add(s.offVal-1<<ofCodes[i], ofCodes[i])
+	}
+	last := n - 1
+	mlState := mlEnc.initState(mlCodes[last])
+	ofState := ofEnc.initState(ofCodes[last])
+	llState := llEnc.initState(llCodes[last])
+	addExtra(last)
+	for i := last - 1; i >= 0; i-- {
+		ofState = ofEnc.encode(&bw, ofState, ofCodes[i])
+		mlState = mlEnc.encode(&bw, mlState, mlCodes[i])
+		llState = llEnc.encode(&bw, llState, llCodes[i])
+		addExtra(i)
+	}
+	mlEnc.flush(&bw, mlState)
+	ofEnc.flush(&bw, ofState)
+	llEnc.flush(&bw, llState)
+	return bw.close()
+}
+
+// seqEncoder chooses how to encode the given symbols, appends the
+// table description to dst and returns the mode and encoder to use.
+func seqEncoder(dst []byte, codes []uint8, maxLog uint8, predefNorm []int16, predefLog uint8, predef *fseEncoder) ([]byte, byte, *fseEncoder) {
+	var counts [maxMLCode + 1]uint32
+	distinct := 0
+	for _, c := range codes {
+		if counts[c] == 0 {
+			distinct++
+		}
+		counts[c]++
+	}
+	if distinct == 1 {
+		norm := make([]int16, codes[0]+1)
+		norm[codes[0]] = 1
+		enc, _ := newFSEEncoder(norm, 0)
+		return append(dst, codes[0]), modeRLE, enc
+	}
+
+	predefCost := entropyCost(counts[:], predefNorm, predefLog)
+	tableLog := optimalTableLog(uint32(len(codes)), distinct, maxLog)
+	norm := normalizeCounts(counts[:], uint32(len(codes)), tableLog)
+	desc := writeNCount(nil, norm, tableLog)
+	if predefCost <= len(desc)*8+entropyCost(counts[:], norm, tableLog) {
+		return dst, modePredefined, predef
+	}
+	enc, err := newFSEEncoder(norm, tableLog)
+	if err != nil {
+		return dst, modePredefined, predef
+	}
+	return append(dst, desc...), modeFSE, enc
+}
+
+// encodeLiterals appends the literals section for lits to dst.
+func encodeLiterals(dst, lits []byte) []byte {
+	n := len(lits)
+	if n == 0 {
+		return append(dst, litRaw)
+	}
+	rle := true
+	for _, b := range lits[1:] {
+		if b != lits[0] {
+			rle = false
+			break
+		}
+	}
+	if rle && n > 2 {
+		return append(appendLiteralsHeader(dst, litRLE, n), lits[0])
+	}
+	if n >= 32 {
+		if b, ok := huffLiterals(dst, lits); ok {
+			return b
+		}
+	}
+	return append(appendLiteralsHeader(dst, litRaw, n), lits...)
+}
+
+// appendLiteralsHeader appends the header of a raw or RLE literals
+// section of n bytes.
+func appendLiteralsHeader(dst []byte, typ byte, n int) []byte {
+	switch {
+	case n < 32:
+		return append(dst, typ|byte(n)<<3)
+	case n < 4096:
+		return append(dst, typ|1<<2|byte(n)<<4, byte(n>>4))
+	default:
+		return append(dst, typ|3<<2|byte(n)<<4, byte(n>>4), byte(n>>12))
+	}
+}
+
+// huffLiterals appends a Huffman-compressed literals section for lits
+// to dst. It reports false if that would not be smaller than raw
+// literals.
+func huffLiterals(dst, lits []byte) ([]byte, bool) {
+	var counts [256]uint32
+	for _, b := range lits {
+		counts[b]++
+	}
+	h := newHuffEncoder(&counts)
+	if h == nil {
+		return dst, false
+	}
+
+	n := len(lits)
+	streams := 4
+	if n < 256 {
+		streams = 1
+	}
+	// Leave room for the largest header, then move the payload
+	// once its size is known.
+	const maxHeader = 5
+	start := len(dst)
+	out := append(dst, make([]byte, maxHeader)...)
+	out = append(out, h.desc...)
+	if streams == 1 {
+		out = h.encode(out, lits)
+	} else {
+		jump := len(out)
+		out = append(out, 0, 0, 0, 0, 0, 0)
+		seg := (n + 3) / 4
+		for i := 0; i < 4; i++ {
+			s := lits[i*seg:]
+			if i < 3 {
+				s = s[:seg]
+			}
+			before := len(out)
+			out = h.encode(out, s)
+			if i < 3 {
+				size := len(out) - before
+				if size > 0xFFFF {
+					return dst, false
+				}
+				le.PutUint16(out[jump+2*i:], uint16(size))
+			}
+		}
+	}
+	comp := len(out) - start - maxHeader
+
+	var hdr []byte
+	var v uint64
+	switch size := n; {
+	case streams == 1 && size < 1024 && comp < 1024:
+		v = uint64(size)<<4 | uint64(comp)<<14
+		hdr = make([]byte, 3)
+	case size < 1024 && comp < 1024:
+		v = 1<<2 | uint64(size)<<4 | uint64(comp)<<14
+		hdr = make([]byte, 3)
+	case size < 16384 && comp < 16384:
+		v = 2<<2 | uint64(size)<<4 | uint64(comp)<<18
+		hdr = make([]byte, 4)
+	default:
+		v = 3<<2 | uint64(size)<<4 | uint64(comp)<<22
+		hdr = make([]byte, 5)
+	}
+	v |= litCompressed
+	for i := range hdr {
+		hdr[i] = byte(v >> (8 * i))
+	}
+	if len(hdr)+comp >= n {
+		return dst, false
+	}
+	copy(out[start:], hdr)
+	copy(out[start+len(hdr):], out[start+maxHeader:])
+	return out[:start+len(hdr)+comp], true
+}
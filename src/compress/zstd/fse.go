@@ -0,0 +1,378 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import "math"
+
+// Finite State Entropy (FSE) coding, RFC 8878 section 4.1.
+//
+// A distribution is described by normalized counts that sum to
+// 1<<tableLog, where a count of -1 denotes a "less than one"
+// probability, which occupies a single state.
+
+// fseEntry is an entry of an FSE decoding table.
+type fseEntry struct {
+	symbol   uint8
+	nbBits   uint8
+	newState uint16
+}
+
+// fseTable is an FSE decoding table.
+type fseTable struct {
+	tableLog uint8
+	entries  []fseEntry
+}
+
+// readNCount reads an FSE table description from the start of data.
+// It returns the normalized counts, the accuracy log and the number
+// of bytes consumed.
+func readNCount(data []byte, maxSymbol int, maxLog uint8) (norm []int16, tableLog uint8, n int, err error) {
+	if len(data) == 0 {
+		return nil, 0, 0, StructuralError("missing FSE table description")
+	}
+	br := forwardBitReader{data: data}
+	tableLog = uint8(br.peek()&15) + 5
+	br.skip(4)
+	if tableLog > maxLog {
+		return nil, 0, 0, StructuralError("FSE accuracy log too large")
+	}
+
+	norm = make([]int16, maxSymbol+1)
+	remaining := int32(1<<tableLog) + 1
+	threshold := int32(1 << tableLog)
+	nbBits := uint(tableLog) + 1
+	symbol := 0
+	prev0 := false
+	for remaining > 1 && symbol <= maxSymbol {
+		if prev0 {
+			// A zero count is followed by 2-bit repeat flags giving
+			// the number of additional zero counts.
+			for {
+				rep := int(br.peek() & 3)
+				br.skip(2)
+				symbol += rep
+				if rep != 3 {
+					break
+				}
+			}
+			if symbol > maxSymbol {
+				break
+			}
+		}
+		v := int32(br.peek())
+		max := 2*threshold - 1 - remaining
+		var count int32
+		if v&(threshold-1) < max {
+			count = v & (threshold - 1)
+			br.skip(nbBits - 1)
+		} else {
+			count = v & (2*threshold - 1)
+			if count >= threshold {
+				count -= max
+			}
+			br.skip(nbBits)
+		}
+		count--
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		norm[symbol] = int16(count)
+		symbol++
+		prev0 = count == 0
+		for remaining < threshold && threshold > 1 {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	if remaining != 1 || symbol > maxSymbol+1 || br.overflow() {
+		return nil, 0, 0, StructuralError("invalid FSE table description")
+	}
+	return norm[:symbol], tableLog, int((br.pos + 7) / 8), nil
+}
+
+// build fills t with the decoding table for the given distribution.
+func (t *fseTable) build(norm []int16, tableLog uint8) error {
+	size := 1 << tableLog
+	if cap(t.entries) < size {
+		t.entries = make([]fseEntry, size)
+	}
+	t.entries = t.entries[:size]
+	t.tableLog = tableLog
+
+	var next [256]uint16
+	high := size - 1
+	for s, c := range norm {
+		if c == -1 {
+			t.entries[high].symbol = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = uint16(c)
+		}
+	}
+
+	pos := 0
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	for s, c := range norm {
+		for i := 0; i < int(c); i++ {
+			t.entries[pos].symbol = uint8(s)
+			pos = (pos + step) & mask
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+	if pos != 0 {
+		return StructuralError("invalid FSE distribution")
+	}
+
+	for i := range t.entries {
+		e := &t.entries[i]
+		k := next[e.symbol]
+		next[e.symbol]++
+		e.nbBits = tableLog - highBit(uint32(k))
+		e.newState = uint16(int(k)<<e.nbBits - size)
+	}
+	return nil
+}
+
+// buildRLE makes t a table that always yields symbol.
+func (t *fseTable) buildRLE(symbol uint8) {
+	if cap(t.entries) < 1 {
+		t.entries = make([]fseEntry, 1)
+	}
+	t.entries = t.entries[:1]
+	t.entries[0] = fseEntry{symbol: symbol}
+	t.tableLog = 0
+}
+
+// fseDecoder is the decoding state of an FSE stream.
+type fseDecoder struct {
+	t     *fseTable
+	state uint32
+}
+
+func (d *fseDecoder) init(t *fseTable, br *reverseBitReader) {
+	d.t = t
+	d.state = br.read(t.tableLog)
+}
+
+func (d *fseDecoder) symbol() uint8 {
+	return d.t.entries[d.state].symbol
+}
+
+func (d *fseDecoder) update(br *reverseBitReader) {
+	e := &d.t.entries[d.state]
+	d.state = uint32(e.newState) + br.read(e.nbBits)
+}
+
+// fseEncoder is an FSE encoding table, derived from the same
+// distribution as the corresponding decoding table.
+type fseEncoder struct {
+	tableLog uint8
+	norm     []int16
+	dec      fseTable
+	// states lists the decoding states of each symbol s, in table
+	// order, starting at start[s].
+	states []uint16
+	start  []uint16
+}
+
+// newFSEEncoder returns an encoder for the given distribution.
+func newFSEEncoder(norm []int16, tableLog uint8) (*fseEncoder, error) {
+	e := &fseEncoder{tableLog: tableLog, norm: norm}
+	if err := e.dec.build(norm, tableLog); err != nil {
+		return nil, err
+	}
+	e.start = make([]uint16, len(norm))
+	n := uint16(0)
+	for s, c := range norm {
+		e.start[s] = n
+		if c == -1 {
+			c = 1
+		}
+		n += uint16(c)
+	}
+	e.states = make([]uint16, 1<<tableLog)
+	next := make([]uint16, len(norm))
+	copy(next, e.start)
+	for u, d := range e.dec.entries {
+		e.states[next[d.symbol]] = uint16(u)
+		next[d.symbol]++
+	}
+	return e, nil
+}
+
+// count returns the number of states of symbol s.
+func (e *fseEncoder) count(s uint8) uint32 {
+	if c := e.norm[s]; c > 0 {
+		return uint32(c)
+	}
+	return 1
+}
+
+// initState returns the initial encoding state for the final symbol
+// s of a stream. The state is chosen so that decoding past it reads
+// at least one bit, which lets decoders detect the end of a stream
+// by overflow.
+func (e *fseEncoder) initState(s uint8) uint32 {
+	return uint32(e.states[e.start[s]])
+}
+
+// encode encodes symbol s, preceding the symbol of the given state,
+// and returns the new state.
+func (e *fseEncoder) encode(bw *bitWriter, state uint32, s uint8) uint32 {
+	c := e.count(s)
+	v := state + 1<<e.tableLog
+	nb := e.tableLog - highBit(c)
+	if v>>nb < c {
+		nb--
+	}
+	bw.add(v, nb)
+	k := v >> nb
+	return uint32(e.states[uint32(e.start[s])+k-c])
+}
+
+// flush writes the final state.
+func (e *fseEncoder) flush(bw *bitWriter, state uint32) {
+	bw.add(state, e.tableLog)
+}
+
+// normalizeCounts computes a distribution with the given accuracy log
+// from symbol counts. At least two symbols must have a non-zero count,
+// and the table must have at least twice as many states as there are
+// such symbols.
+func normalizeCounts(counts []uint32, total uint32, tableLog uint8) []int16 {
+	last := len(counts) - 1
+	for last > 0 && counts[last] == 0 {
+		last--
+	}
+	norm := make([]int16, last+1)
+	size := int32(1) << tableLog
+	sum := int32(0)
+	largest := 0
+	for s, c := range counts[:last+1] {
+		if c == 0 {
+			continue
+		}
+		p := int32((uint64(c)*uint64(size) + uint64(total)/2) / uint64(total))
+		if p == 0 {
+			norm[s] = -1
+			sum++
+		} else {
+			norm[s] = int16(p)
+			sum += p
+		}
+		if c > counts[largest] {
+			largest = s
+		}
+	}
+	if sum < size {
+		norm[largest] += int16(size - sum)
+	}
+	for sum > size {
+		// Take states from the most probable symbols.
+		max := largest
+		for s, c := range norm {
+			if c > norm[max] {
+				max = s
+			}
+		}
+		norm[max]--
+		sum--
+	}
+	return norm
+}
+
+// optimalTableLog returns the accuracy log to use for a distribution of
+// total symbols of which n are distinct.
+func optimalTableLog(total uint32, n int, maxLog uint8) uint8 {
+	log := maxLog
+	if l := highBit(total) - 2; total > 4 && l < log {
+		log = l
+	}
+	if min := highBit(uint32(n)) + 2; log < min {
+		log = min
+	}
+	if log < 5 {
+		log = 5
+	}
+	if log > maxLog {
+		log = maxLog
+	}
+	return log
+}
+
+// writeNCount appends the description of a distribution to dst.
+func writeNCount(dst []byte, norm []int16, tableLog uint8) []byte {
+	var bw forwardBitWriter
+	bw.out = dst
+	bw.add(uint32(tableLog-5), 4)
+	size := int32(1) << tableLog
+	remaining := size + 1
+	threshold := size
+	nbBits := tableLog + 1
+	prev0 := false
+	for s := 0; s < len(norm) && remaining > 1; {
+		if prev0 {
+			start := s
+			for norm[s] == 0 {
+				s++
+			}
+			for s >= start+3 {
+				bw.add(3, 2)
+				start += 3
+			}
+			bw.add(uint32(s-start), 2)
+		}
+		count := int32(norm[s])
+		s++
+		max := 2*threshold - 1 - remaining
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		count++
+		if count >= threshold {
+			count += max
+		}
+		if count < max {
+			bw.add(uint32(count), nbBits-1)
+		} else {
+			bw.add(uint32(count), nbBits)
+		}
+		prev0 = count == 1
+		for remaining < threshold && threshold > 1 {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	return bw.close()
+}
+
+// entropyCost estimates the number of bits needed to encode symbols
+// with the given counts using the distribution norm. It returns
+// math.MaxInt32 if some symbol cannot be represented.
+func entropyCost(counts []uint32, norm []int16, tableLog uint8) int {
+	bits := 0.0
+	for s, c := range counts {
+		if c == 0 {
+			continue
+		}
+		if s >= len(norm) || norm[s] == 0 {
+			return math.MaxInt32
+		}
+		p := float64(norm[s])
+		if p < 0 {
+			p = 1
+		}
+		bits += float64(c) * (float64(tableLog) - math.Log2(p))
+	}
+	return int(bits)
+}
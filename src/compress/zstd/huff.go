@@ -0,0 +1,426 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"math"
+	"sort"
+)
+
+// Huffman coding of literals, RFC 8878 section 4.2.
+
+const (
+	maxHuffBits       = 11
+	maxHuffWeight     = 12 // as accepted by the reference decoder
+	maxHuffWeightsLog = 6
+)
+
+// huffEntry is an entry of a Huffman decoding table.
+type huffEntry struct {
+	symbol uint8
+	nbBits uint8
+}
+
+// huffTable is a Huffman decoding table, indexed by the next maxBits
+// bits of the stream.
+type huffTable struct {
+	maxBits uint8
+	entries []huffEntry
+}
+
+// read reads a Huffman tree description from the start of data and
+// builds the decoding table. It returns the number of bytes consumed.
+func (t *huffTable) read(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, StructuralError("missing Huffman tree description")
+	}
+	var weights [256]uint8
+	var n, size int
+	if h := int(data[0]); h >= 128 {
+		// Weights stored directly, 4 bits each.
+		n = h - 127
+		size = 1 + (n+1)/2
+		if size > len(data) {
+			return 0, StructuralError("truncated Huffman tree description")
+		}
+		for i := 0; i < n; i++ {
+			b := data[1+i/2]
+			if i%2 == 0 {
+				weights[i] = b >> 4
+			} else {
+				weights[i] = b & 15
+			}
+		}
+	} else {
+		// FSE-compressed weights.
+		size = 1 + h
+		if size > len(data) {
+			return 0, StructuralError("truncated Huffman tree description")
+		}
+		var err error
+		n, err = readHuffWeights(data[1:size], weights[:255])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var sum uint32
+	for _, w := range weights[:n] {
+		if w > maxHuffWeight {
+			return 0, StructuralError("invalid Huffman weight")
+		}
+		if w > 0 {
+			sum += 1 << (w - 1)
+		}
+	}
+	if sum == 0 {
+		return 0, StructuralError("invalid Huffman weights")
+	}
+	maxBits := highBit(sum) + 1
+	if maxBits > maxHuffBits {
+		return 0, StructuralError("Huffman code too long")
+	}
+	// The weight of the last symbol is implied by the others, as the
+	// code must be complete.
+	left := uint32(1)<<maxBits - sum
+	if left&(left-1) != 0 {
+		return 0, StructuralError("invalid Huffman weights")
+	}
+	weights[n] = highBit(left) + 1
+	n++
+
+	t.maxBits = maxBits
+	tsize := 1 << maxBits
+	if cap(t.entries) < tsize {
+		t.entries = make([]huffEntry, tsize)
+	}
+	t.entries = t.entries[:tsize]
+	// Codes are assigned in order of increasing weight, then symbol.
+	pos := 0
+	for w := uint8(1); w <= maxBits; w++ {
+		span := 1 << (w - 1)
+		e := huffEntry{nbBits: maxBits + 1 - w}
+		for s, sw := range weights[:n] {
+			if sw != w {
+				continue
+			}
+			e.symbol = uint8(s)
+			for i := pos; i < pos+span; i++ {
+				t.entries[i] = e
+			}
+			pos += span
+		}
+	}
+	return size, nil
+}
+
+// readHuffWeights decodes FSE-compressed Huffman weights into out and
+// returns their number.
+func readHuffWeights(data []byte, out []uint8) (int, error) {
+	norm, tableLog, k, err := readNCount(data, maxHuffWeight, maxHuffWeightsLog)
+	if err != nil {
+		return 0, err
+	}
+	var t fseTable
+	if err := t.build(norm, tableLog); err != nil {
+		return 0, err
+	}
+	var br reverseBitReader
+	if err := br.init(data[k:]); err != nil {
+		return 0, err
+	}
+	// The weights are encoded with two interleaved states sharing
+	// the table. The stream ends when updating a state would read
+	// past its start; the other state then yields the last weight.
+	var d1, d2 fseDecoder
+	d1.init(&t, &br)
+	d2.init(&t, &br)
+	n := 0
+	for {
+		if n+2 > len(out) {
+			return 0, StructuralError("too many Huffman weights")
+		}
+		out[n] = d1.symbol()
+		n++
+		d1.update(&br)
+		if br.over > 0 {
+			out[n] = d2.symbol()
+			n++
+			break
+		}
+		out[n] = d2.symbol()
+		n++
+		d2.update(&br)
+		if br.over > 0 {
+			out[n] = d1.symbol()
+			n++
+			break
+		}
+	}
+	return n, nil
+}
+
+// decode decodes a single Huffman-coded stream filling dst.
+func (t *huffTable) decode(dst, src []byte) error {
+	var br reverseBitReader
+	if err := br.init(src); err != nil {
+		return err
+	}
+	for i := range dst {
+		e := t.entries[br.peek(t.maxBits)]
+		dst[i] = e.symbol
+		br.skip(e.nbBits)
+	}
+	if !br.finished() {
+		return StructuralError("invalid Huffman stream")
+	}
+	return nil
+}
+
+// huffCode is the code of a symbol in a Huffman encoder.
+type huffCode struct {
+	code uint16
+	len  uint8
+}
+
+// huffEncoder is a Huffman code for literals.
+type huffEncoder struct {
+	codes [256]huffCode
+	desc  []byte // the tree description
+}
+
+// newHuffEncoder builds a Huffman code for the given symbol counts, of
+// which at least two must be non-zero. It returns nil if the tree
+// cannot be described.
+func newHuffEncoder(counts *[256]uint32) *huffEncoder {
+	var lengths [256]uint8
+	huffLengths(counts[:], maxHuffBits, lengths[:])
+
+	last, maxLen := 0, uint8(0)
+	for s, l := range lengths {
+		if l > 0 {
+			last = s
+			if l > maxLen {
+				maxLen = l
+			}
+		}
+	}
+	h := new(huffEncoder)
+	var weights [256]uint8
+	for s, l := range lengths[:last+1] {
+		if l > 0 {
+			weights[s] = maxLen + 1 - l
+		}
+	}
+	pos := uint32(0)
+	for w := uint8(1); w <= maxLen; w++ {
+		for s := range lengths[:last+1] {
+			if weights[s] == w {
+				h.codes[s] = huffCode{code: uint16(pos >> (w - 1)), len: lengths[s]}
+				pos += 1 << (w - 1)
+			}
+		}
+	}
+
+	// Describe the tree by the weights of all symbols but the last,
+	// preferring the FSE-compressed form when it is smaller.
+	w := weights[:last]
+	h.desc = writeHuffWeights(nil, w)
+	if len(w) <= 128 && (h.desc == nil || len(h.desc) >= 1+(len(w)+1)/2) {
+		desc := append(h.desc[:0], byte(127+len(w)))
+		for i := 0; i < len(w); i += 2 {
+			b := w[i] << 4
+			if i+1 < len(w) {
+				b |= w[i+1]
+			}
+			desc = append(desc, b)
+		}
+		h.desc = desc
+	}
+	if h.desc == nil {
+		return nil
+	}
+	return h
+}
+
+// writeHuffWeights returns the FSE-compressed description of the
+// Huffman weights w, or nil if they cannot be compressed in that form.
+func writeHuffWeights(dst []byte, w []uint8) []byte {
+	if len(w) < 2 {
+		return nil
+	}
+	var counts [maxHuffWeight + 1]uint32
+	distinct := 0
+	for _, v := range w {
+		if counts[v] == 0 {
+			distinct++
+		}
+		counts[v]++
+	}
+	if distinct < 2 {
+		return nil
+	}
+	tableLog := optimalTableLog(uint32(len(w)), distinct, maxHuffWeightsLog)
+	norm := normalizeCounts(counts[:], uint32(len(w)), tableLog)
+	enc, err := newFSEEncoder(norm, tableLog)
+	if err != nil {
+		return nil
+	}
+	dst = append(dst, 0)
+	dst = writeNCount(dst, norm, tableLog)
+
+	var bw bitWriter
+	bw.out = dst
+	n := len(w)
+	var s1, s2 uint32
+	i := n
+	if n%2 == 1 {
+		s1 = enc.initState(w[n-1])
+		s2 = enc.initState(w[n-2])
+		s1 = enc.encode(&bw, s1, w[n-3])
+		i = n - 3
+	} else {
+		s2 = enc.initState(w[n-1])
+		s1 = enc.initState(w[n-2])
+		i = n - 2
+	}
+	for i > 0 {
+		s2 = enc.encode(&bw, s2, w[i-1])
+		s1 = enc.encode(&bw, s1, w[i-2])
+		i -= 2
+	}
+	enc.flush(&bw, s2)
+	enc.flush(&bw, s1)
+	dst = bw.close()
+	if len(dst) > 128 {
+		return nil
+	}
+	dst[0] = byte(len(dst) - 1)
+	return dst
+}
+
+// encode appends the Huffman coding of src to dst as a single stream.
+func (h *huffEncoder) encode(dst, src []byte) []byte {
+	var bw bitWriter
+	bw.out = dst
+	for i := len(src) - 1; i >= 0; i-- {
+		c := h.codes[src[i]]
+		bw.add(uint32(c.code), c.len)
+	}
+	return bw.close()
+}
+
+// huffNode is a symbol and its count, for building Huffman codes.
+type huffNode struct {
+	symbol uint16
+	count  int32
+}
+
+// huffLengths sets lengths[s] to the length of the code of symbol s
+// in an optimal prefix code limited to maxBits bits, for each symbol
+// with a non-zero count. There must be at least two such symbols.
+//
+// The lengths are computed with the boundary package-merge algorithm,
+// as in compress/flate.
+func huffLengths(counts []uint32, maxBits int32, lengths []uint8) {
+	list := make([]huffNode, 0, len(counts)+1)
+	for s, c := range counts {
+		if c != 0 {
+			list = append(list, huffNode{uint16(s), int32(c)})
+		}
+	}
+	n := int32(len(list))
+	if n <= 2 {
+		for _, node := range list {
+			lengths[node.symbol] = 1
+		}
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].count != list[j].count {
+			return list[i].count < list[j].count
+		}
+		return list[i].symbol < list[j].symbol
+	})
+	list = append(list, huffNode{count: math.MaxInt32})
+
+	if maxBits > n-1 {
+		maxBits = n - 1
+	}
+
+	type levelInfo struct {
+		level        int32
+		lastFreq     int32
+		nextCharFreq int32
+		nextPairFreq int32
+		needed       int32
+	}
+	var levels [maxHuffBits + 2]levelInfo
+	var leafCounts [maxHuffBits + 2][maxHuffBits + 2]int32
+
+	for level := int32(1); level <= maxBits; level++ {
+		levels[level] = levelInfo{
+			level:        level,
+			lastFreq:     list[1].count,
+			nextCharFreq: list[2].count,
+			nextPairFreq: list[0].count + list[1].count,
+		}
+		leafCounts[level][level] = 2
+		if level == 1 {
+			levels[level].nextPairFreq = math.MaxInt32
+		}
+	}
+	levels[maxBits].needed = 2*n - 4
+
+	level := maxBits
+	for {
+		l := &levels[level]
+		if l.nextPairFreq == math.MaxInt32 && l.nextCharFreq == math.MaxInt32 {
+			l.needed = 0
+			levels[level+1].nextPairFreq = math.MaxInt32
+			level++
+			continue
+		}
+
+		prevFreq := l.lastFreq
+		if l.nextCharFreq < l.nextPairFreq {
+			n := leafCounts[level][level] + 1
+			l.lastFreq = l.nextCharFreq
+			leafCounts[level][level] = n
+			l.nextCharFreq = list[n].count
+		} else {
+			l.lastFreq = l.nextPairFreq
+			copy(leafCounts[level][:level], leafCounts[level-1][:level])
+			levels[l.level-1].needed = 2
+		}
+
+		if l.needed--; l.needed == 0 {
+			if l.level == maxBits {
+				break
+			}
+			levels[l.level+1].nextPairFreq = prevFreq + l.lastFreq
+			level++
+		} else {
+			for levels[level-1].needed > 0 {
+				level--
+			}
+		}
+	}
+
+	// leafCounts[maxBits][level] - leafCounts[maxBits][level-1] is the
+	// number of symbols with codes of length maxBits+1-level; they are
+	// the most frequent ones not yet assigned.
+	list = list[:n]
+	counts2 := &leafCounts[maxBits]
+	bits := uint8(1)
+	for level := maxBits; level > 0; level-- {
+		k := counts2[level] - counts2[level-1]
+		for _, node := range list[len(list)-int(k):] {
+			lengths[node.symbol] = bits
+		}
+		list = list[:len(list)-int(k)]
+		bits++
+	}
+}
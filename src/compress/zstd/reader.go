@@ -0,0 +1,308 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import "io"
+
+// A Reader is an io.Reader that decompresses Zstandard data.
+//
+// The data may consist of several frames, which are decompressed in
+// turn and whose content is concatenated. Skippable frames are
+// ignored.
+type Reader struct {
+	r    io.Reader
+	dict *dict
+	err  error
+
+	// State of the current frame.
+	inFrame     bool
+	lastBlock   bool
+	hasChecksum bool
+	contentSize int64 // -1 if unknown
+	windowSize  int
+	produced    int64
+	hasher      xxhash64
+	reps        repOffsets
+
+	// hist holds the window followed by the decompressed data that
+	// has not been returned by Read yet, starting at hist[out].
+	hist []byte
+	out  int
+
+	block   []byte
+	litBuf  []byte
+	scratch [14]byte
+
+	// Entropy tables, which may be reused by later blocks of a
+	// frame. They point either into the buffers below, to the
+	// predefined tables or to the dictionary's tables.
+	huff       *huffTable
+	ll, of, ml *fseTable
+
+	huffBuf             huffTable
+	llBuf, ofBuf, mlBuf fseTable
+}
+
+// NewReader creates a new Reader reading the given reader.
+//
+// It is the caller's responsibility to call Close on the Reader when done.
+func NewReader(r io.Reader) *Reader {
+	z := new(Reader)
+	z.Reset(r)
+	return z
+}
+
+// NewReaderDict is like NewReader but uses a dictionary. The dictionary
+// is either in the Zstandard dictionary format or raw content. An error
+// is returned if the dictionary is in the Zstandard format but malformed.
+//
+// Frames that name a dictionary must name this dictionary's ID. Frames
+// that do not name a dictionary are decompressed using it.
+func NewReaderDict(r io.Reader, dict []byte) (*Reader, error) {
+	d, err := parseDict(dict)
+	if err != nil {
+		return nil, err
+	}
+	z := &Reader{dict: d}
+	z.Reset(r)
+	return z, nil
+}
+
+// Reset discards the Reader z's state and makes it equivalent to the
+// result of its original state from NewReader or NewReaderDict, but
+// reading from r instead. This permits reusing a Reader rather than
+// allocating a new one.
+func (z *Reader) Reset(r io.Reader) {
+	z.r = r
+	z.err = nil
+	z.inFrame = false
+	z.hist = z.hist[:0]
+	z.out = 0
+}
+
+// Read implements io.Reader, reading uncompressed bytes from its
+// underlying Reader.
+func (z *Reader) Read(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	for z.out == len(z.hist) {
+		if err := z.next(); err != nil {
+			z.err = err
+			return 0, err
+		}
+	}
+	n := copy(p, z.hist[z.out:])
+	z.out += n
+	return n, nil
+}
+
+// Close closes the Reader. It does not close the underlying io.Reader.
+// In order for the content checksums to be verified, the reader must be
+// fully consumed until the io.EOF.
+func (z *Reader) Close() error {
+	if z.err == io.EOF {
+		return nil
+	}
+	return z.err
+}
+
+// next decompresses the next block, reading frame headers and
+// trailers as needed.
+func (z *Reader) next() error {
+	if !z.inFrame {
+		return z.readFrameHeader()
+	}
+	if z.lastBlock {
+		return z.finishFrame()
+	}
+
+	// Everything has been read; trim the history to the window. The
+	// dictionary remains available until the window has been filled.
+	if z.produced > int64(z.windowSize) && len(z.hist) > 2*z.windowSize {
+		n := copy(z.hist, z.hist[len(z.hist)-z.windowSize:])
+		z.hist = z.hist[:n]
+		z.out = n
+	}
+
+	if _, err := io.ReadFull(z.r, z.scratch[:3]); err != nil {
+		return noEOF(err)
+	}
+	h := uint32(z.scratch[0]) | uint32(z.scratch[1])<<8 | uint32(z.scratch[2])<<16
+	z.lastBlock = h&1 != 0
+	typ := h >> 1 & 3
+	size := int(h >> 3)
+	if size > maxBlockSize {
+		return StructuralError("block too large")
+	}
+
+	start := len(z.hist)
+	switch typ {
+	case blockRaw:
+		z.hist = append(z.hist, make([]byte, size)...)
+		if _, err := io.ReadFull(z.r, z.hist[start:]); err != nil {
+			return noEOF(err)
+		}
+	case blockRLE:
+		if _, err := io.ReadFull(z.r, z.scratch[:1]); err != nil {
+			return noEOF(err)
+		}
+		for i := 0; i < size; i++ {
+			z.hist = append(z.hist, z.scratch[0])
+		}
+	case blockCompressed:
+		if cap(z.block) < size {
+			z.block = make([]byte, size, maxBlockSize)
+		}
+		z.block = z.block[:size]
+		if _, err := io.ReadFull(z.r, z.block); err != nil {
+			return noEOF(err)
+		}
+		if err := z.decodeBlock(z.block); err != nil {
+			return err
+		}
+	default:
+		return StructuralError("reserved block type")
+	}
+
+	b := z.hist[start:]
+	z.produced += int64(len(b))
+	if z.contentSize >= 0 && z.produced > z.contentSize {
+		return StructuralError("frame content size exceeded")
+	}
+	if z.hasChecksum {
+		z.hasher.write(b)
+	}
+	return nil
+}
+
+// readFrameHeader reads the header of the next frame, skipping any
+// skippable frames. It returns io.EOF at the end of the stream.
+func (z *Reader) readFrameHeader() error {
+	for {
+		if _, err := io.ReadFull(z.r, z.scratch[:4]); err != nil {
+			return err
+		}
+		magic := le.Uint32(z.scratch[:])
+		if magic == frameMagic {
+			break
+		}
+		if magic&skippableMagicMask != skippableMagic {
+			return ErrHeader
+		}
+		if _, err := io.ReadFull(z.r, z.scratch[:4]); err != nil {
+			return noEOF(err)
+		}
+		n := int64(le.Uint32(z.scratch[:]))
+		if m, err := io.CopyN(io.Discard, z.r, n); m != n {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+
+	if _, err := io.ReadFull(z.r, z.scratch[:1]); err != nil {
+		return noEOF(err)
+	}
+	fhd := z.scratch[0]
+	fcsFlag := fhd >> 6
+	singleSegment := fhd&(1<<5) != 0
+	if fhd&(1<<3) != 0 {
+		return ErrHeader
+	}
+	z.hasChecksum = fhd&(1<<2) != 0
+	dictIDSize := [4]int{0, 1, 2, 4}[fhd&3]
+	fcsSize := [4]int{0, 2, 4, 8}[fcsFlag]
+	if fcsFlag == 0 && singleSegment {
+		fcsSize = 1
+	}
+	n := dictIDSize + fcsSize
+	if !singleSegment {
+		n++
+	}
+	b := z.scratch[:n]
+	if _, err := io.ReadFull(z.r, b); err != nil {
+		return noEOF(err)
+	}
+
+	window := uint64(0)
+	if !singleSegment {
+		exp := uint(b[0] >> 3)
+		mantissa := uint64(b[0] & 7)
+		base := uint64(1) << (minWindowLog + exp)
+		window = base + base/8*mantissa
+		b = b[1:]
+	}
+	var dictID uint32
+	switch dictIDSize {
+	case 1:
+		dictID = uint32(b[0])
+	case 2:
+		dictID = uint32(le.Uint16(b))
+	case 4:
+		dictID = le.Uint32(b)
+	}
+	b = b[dictIDSize:]
+	z.contentSize = -1
+	switch fcsSize {
+	case 1:
+		z.contentSize = int64(b[0])
+	case 2:
+		z.contentSize = int64(le.Uint16(b)) + 256
+	case 4:
+		z.contentSize = int64(le.Uint32(b))
+	case 8:
+		v := le.Uint64(b)
+		if v > 1<<62 {
+			return ErrWindowTooLarge
+		}
+		z.contentSize = int64(v)
+	}
+	if singleSegment {
+		window = uint64(z.contentSize)
+	}
+	if window > maxWindowSize {
+		return ErrWindowTooLarge
+	}
+	z.windowSize = int(window)
+
+	z.hist = z.hist[:0]
+	z.reps = initialRepOffsets
+	z.huff, z.ll, z.of, z.ml = nil, nil, nil, nil
+	if dictID != 0 && (z.dict == nil || z.dict.id != dictID) {
+		return ErrDictionary
+	}
+	if d := z.dict; d != nil {
+		z.hist = append(z.hist, d.content...)
+		z.reps = d.reps
+		if d.huff != nil {
+			z.huff, z.ll, z.of, z.ml = d.huff, d.ll, d.of, d.ml
+		}
+	}
+	z.out = len(z.hist)
+	z.produced = 0
+	z.hasher.reset()
+	z.inFrame = true
+	z.lastBlock = false
+	return nil
+}
+
+// finishFrame checks the end of the current frame.
+func (z *Reader) finishFrame() error {
+	if z.contentSize >= 0 && z.produced != z.contentSize {
+		return StructuralError("frame content size mismatch")
+	}
+	if z.hasChecksum {
+		if _, err := io.ReadFull(z.r, z.scratch[:4]); err != nil {
+			return noEOF(err)
+		}
+		if le.Uint32(z.scratch[:]) != uint32(z.hasher.sum64()) {
+			return ErrChecksum
+		}
+	}
+	z.inFrame = false
+	return nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func mustLoadFile(f string) []byte {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// The files in testdata were produced by the reference implementation:
+//
+//	zstd -19 ../testdata/e.txt -o testdata/e.txt.zst
+//	zstd --train newton/* --maxdict=4096 --dictID=12345 -o testdata/newton.dict
+//	zstd -19 -D testdata/newton.dict ../testdata/gettysburg.txt -o testdata/gettysburg.txt.dict.zst
+//
+// where newton holds the text of Isaac Newton's Opticks split in
+// 1500-byte pieces.
+
+func TestReader(t *testing.T) {
+	dict := mustLoadFile("testdata/newton.dict")
+	tests := []struct {
+		name   string
+		input  []byte
+		output []byte
+		dict   []byte
+	}{
+		{
+			name:   "e.txt",
+			input:  mustLoadFile("testdata/e.txt.zst"),
+			output: mustLoadFile("../testdata/e.txt"),
+		},
+		{
+			name:   "dictionary",
+			input:  mustLoadFile("testdata/gettysburg.txt.dict.zst"),
+			output: mustLoadFile("../testdata/gettysburg.txt"),
+			dict:   dict,
+		},
+		{
+			name:   "empty",
+			input:  []byte{},
+			output: []byte{},
+		},
+		{
+			name: "empty frame",
+			// Single segment, content size 0, last raw block of size 0.
+			input:  []byte{0x28, 0xb5, 0x2f, 0xfd, 0x20, 0x00, 0x01, 0x00, 0x00},
+			output: []byte{},
+		},
+		{
+			name: "RLE block",
+			// Single segment, content size 5, last RLE block of size 5.
+			input:  []byte{0x28, 0xb5, 0x2f, 0xfd, 0x20, 0x05, 0x2b, 0x00, 0x00, 'z'},
+			output: []byte("zzzzz"),
+		},
+	}
+	for _, tt := range tests {
+		var r *Reader
+		if tt.dict != nil {
+			var err error
+			r, err = NewReaderDict(bytes.NewReader(tt.input), tt.dict)
+			if err != nil {
+				t.Fatalf("%s: NewReaderDict: %v", tt.name, err)
+			}
+		} else {
+			r = NewReader(bytes.NewReader(tt.input))
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("%s: ReadAll: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.output) {
+			t.Errorf("%s: output mismatch: got %d bytes, want %d", tt.name, len(got), len(tt.output))
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%s: Close: %v", tt.name, err)
+		}
+	}
+}
+
+func TestReaderDictionaryMismatch(t *testing.T) {
+	input := mustLoadFile("testdata/gettysburg.txt.dict.zst")
+	_, err := ioutil.ReadAll(NewReader(bytes.NewReader(input)))
+	if err != ErrDictionary {
+		t.Errorf("without dictionary: got %v, want %v", err, ErrDictionary)
+	}
+	r, err := NewReaderDict(bytes.NewReader(input), []byte("raw content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != ErrDictionary {
+		t.Errorf("with raw dictionary: got %v, want %v", err, ErrDictionary)
+	}
+
+	// A dictionary in the Zstandard format must be valid.
+	dict := mustLoadFile("testdata/newton.dict")
+	if _, err := NewReaderDict(bytes.NewReader(input), dict[:20]); err != ErrDictionary {
+		t.Errorf("truncated dictionary: got %v, want %v", err, ErrDictionary)
+	}
+}
+
+func TestReaderChecksum(t *testing.T) {
+	input := append([]byte(nil), mustLoadFile("testdata/e.txt.zst")...)
+	input[len(input)-1] ^= 1
+	_, err := ioutil.ReadAll(NewReader(bytes.NewReader(input)))
+	if err != ErrChecksum {
+		t.Errorf("got %v, want %v", err, ErrChecksum)
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	input := mustLoadFile("testdata/e.txt.zst")
+	for _, n := range []int{1, 4, 5, 6, 100, len(input) / 2, len(input) - 4, len(input) - 1} {
+		_, err := ioutil.ReadAll(NewReader(bytes.NewReader(input[:n])))
+		if err == nil {
+			t.Errorf("reading %d of %d bytes: no error", n, len(input))
+		}
+	}
+}
+
+func TestReaderMultipleFrames(t *testing.T) {
+	var input, want bytes.Buffer
+	for i, s := range []string{"hello, ", "", "world"} {
+		w := NewWriter(&input)
+		io.WriteString(w, s)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		want.WriteString(s)
+		if i == 0 {
+			// A skippable frame holding 3 bytes.
+			input.Write([]byte{0x5a, 0x2a, 0x4d, 0x18, 3, 0, 0, 0, 'x', 'y', 'z'})
+		}
+	}
+	got, err := ioutil.ReadAll(NewReader(&input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("got %q, want %q", got, want.Bytes())
+	}
+}
+
+func TestReaderBadHeader(t *testing.T) {
+	for _, input := range [][]byte{
+		[]byte("not zstd data"),
+		{0x28, 0xb5, 0x2f, 0xfd, 0x08}, // reserved bit set
+	} {
+		_, err := ioutil.ReadAll(NewReader(bytes.NewReader(input)))
+		if err != ErrHeader {
+			t.Errorf("%q: got %v, want %v", input, err, ErrHeader)
+		}
+	}
+
+	// A window of 1<<31 bytes.
+	input := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 21 << 3}
+	if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(input))); err != ErrWindowTooLarge {
+		t.Errorf("large window: got %v, want %v", err, ErrWindowTooLarge)
+	}
+}
+
+func TestReaderReset(t *testing.T) {
+	input := mustLoadFile("testdata/e.txt.zst")
+	want := mustLoadFile("../testdata/e.txt")
+	r := NewReader(bytes.NewReader([]byte("garbage")))
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Fatal("reading garbage: no error")
+	}
+	for i := 0; i < 2; i++ {
+		r.Reset(bytes.NewReader(input))
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("output mismatch after Reset")
+		}
+	}
+}
+
+// TestReaderCorrupt checks that the Reader fails gracefully on
+// corrupted input.
+func TestReaderCorrupt(t *testing.T) {
+	inputs := [][]byte{
+		mustLoadFile("testdata/e.txt.zst"),
+		mustLoadFile("testdata/gettysburg.txt.dict.zst"),
+	}
+	dict := mustLoadFile("testdata/newton.dict")
+	rng := rand.New(rand.NewSource(1))
+	n := 500
+	if testing.Short() {
+		n = 50
+	}
+	for i := 0; i < n; i++ {
+		input := append([]byte(nil), inputs[i%len(inputs)]...)
+		for j := 0; j < 1+rng.Intn(4); j++ {
+			input[rng.Intn(len(input))] ^= byte(1 + rng.Intn(255))
+		}
+		r, err := NewReaderDict(bytes.NewReader(input), dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(r); err == nil {
+			// Some corruptions go undetected, but most are
+			// caught by the checksum at the latest.
+			continue
+		} else if errors.Is(err, io.EOF) {
+			t.Errorf("unexpected io.EOF")
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+// Sequences, RFC 8878 section 3.1.1.3.2.
+
+// A sequence copies litLen literals, then a match of matchLen bytes
+// designated by offVal, which is either a repeat offset code (1-3) or
+// an offset plus 3.
+type seq struct {
+	litLen   uint32
+	matchLen uint32
+	offVal   uint32
+}
+
+// Symbol compression modes.
+const (
+	modePredefined = 0
+	modeRLE        = 1
+	modeFSE        = 2
+	modeRepeat     = 3
+)
+
+const (
+	maxLLCode = 35
+	maxMLCode = 52
+	maxOFCode = 31
+
+	maxLLLog = 9
+	maxMLLog = 9
+	maxOFLog = 8
+)
+
+var llBase = [maxLLCode + 1]uint32{
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+	16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+	8192, 16384, 32768, 65536,
+}
+
+var llBits = [maxLLCode + 1]uint8{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+	13, 14, 15, 16,
+}
+
+var mlBase = [maxMLCode + 1]uint32{
+	3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+	19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+	35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+	4099, 8195, 16387, 32771, 65539,
+}
+
+var mlBits = [maxMLCode + 1]uint8{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+	12, 13, 14, 15, 16,
+}
+
+// Predefined distributions, used when no table has been transmitted.
+var (
+	predefLLNorm = []int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}
+	predefMLNorm = []int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}
+	predefOFNorm = []int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}
+)
+
+const (
+	predefLLLog = 6
+	predefMLLog = 6
+	predefOFLog = 5
+)
+
+var (
+	predefLL, predefML, predefOF fseTable
+	predefLLEnc                  *fseEncoder
+	predefMLEnc                  *fseEncoder
+	predefOFEnc                  *fseEncoder
+
+	llCodeTable [64]uint8
+	mlCodeTable [128]uint8
+)
+
+func init() {
+	mustBuild := func(t *fseTable, norm []int16, log uint8) *fseEncoder {
+		if err := t.build(norm, log); err != nil {
+			panic("zstd: bad predefined distribution")
+		}
+		e, err := newFSEEncoder(norm, log)
+		if err != nil {
+			panic("zstd: bad predefined distribution")
+		}
+		return e
+	}
+	predefLLEnc = mustBuild(&predefLL, predefLLNorm, predefLLLog)
+	predefMLEnc = mustBuild(&predefML, predefMLNorm, predefMLLog)
+	predefOFEnc = mustBuild(&predefOF, predefOFNorm, predefOFLog)
+
+	code := uint8(0)
+	for v := range llCodeTable {
+		for code < maxLLCode && llBase[code+1] <= uint32(v) {
+			code++
+		}
+		llCodeTable[v] = code
+	}
+	code = 0
+	for v := range mlCodeTable {
+		for code < maxMLCode && mlBase[code+1] <= uint32(v)+3 {
+			code++
+		}
+		mlCodeTable[v] = code
+	}
+}
+
+// llCode returns the literals length code for n.
+func llCode(n uint32) uint8 {
+	if n < 64 {
+		return llCodeTable[n]
+	}
+	return highBit(n) + 19
+}
+
+// mlCode returns the match length code for n, n >= 3.
+func mlCode(n uint32) uint8 {
+	if n-3 < 128 {
+		return mlCodeTable[n-3]
+	}
+	return highBit(n-3) + 36
+}
+
+// ofCode returns the offset code for the offset value v.
+func ofCode(v uint32) uint8 {
+	return highBit(v)
+}
+
+// repOffsets holds the repeat offsets of a frame.
+type repOffsets [3]uint32
+
+var initialRepOffsets = repOffsets{1, 4, 8}
+
+// resolve returns the offset designated by the offset value v of a
+// sequence with litLen literals, updating the repeat offsets. It
+// returns 0 if v is invalid.
+func (r *repOffsets) resolve(v, litLen uint32) uint32 {
+	if v > 3 {
+		off := v - 3
+		r[2], r[1], r[0] = r[1], r[0], off
+		return off
+	}
+	i := v - 1
+	if litLen == 0 {
+		i++
+	}
+	var off uint32
+	switch i {
+	case 0:
+		return r[0]
+	case 1:
+		off = r[1]
+		r[1] = r[0]
+	case 2:
+		off = r[2]
+		r[2], r[1] = r[1], r[0]
+	case 3:
+		off = r[0] - 1
+		if off == 0 {
+			return 0
+		}
+		r[2], r[1] = r[1], r[0]
+	}
+	r[0] = off
+	return off
+}
+
+// offsetValue returns the offset value encoding offset off in a
+// sequence with litLen literals, given the current repeat offsets.
+func (r *repOffsets) offsetValue(off, litLen uint32) uint32 {
+	if litLen > 0 {
+		switch off {
+		case r[0]:
+			return 1
+		case r[1]:
+			return 2
+		case r[2]:
+			return 3
+		}
+	} else {
+		switch off {
+		case r[1]:
+			return 1
+		case r[2]:
+			return 2
+		case r[0] - 1:
+			return 3
+		}
+	}
+	return off + 3
+}
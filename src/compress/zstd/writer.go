@@ -0,0 +1,288 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Compression levels. Higher levels compress better but more slowly
+// and use more memory.
+const (
+	BestSpeed          = 1
+	BestCompression    = 9
+	DefaultCompression = -1
+)
+
+const defaultLevel = 3
+
+var errClosed = errors.New("zstd: Writer is closed")
+
+// A Writer is an io.WriteCloser.
+// Writes to a Writer are compressed and written to w.
+type Writer struct {
+	w           io.Writer
+	level       int
+	dict        *dict
+	enc         encoder
+	hasher      xxhash64
+	buf         []byte
+	wroteHeader bool
+	closed      bool
+	err         error
+}
+
+// NewWriter returns a new Writer.
+// Writes to the returned writer are compressed and written to w.
+//
+// It is the caller's responsibility to call Close on the Writer when done.
+// Writes may be buffered and not flushed until Close.
+func NewWriter(w io.Writer) *Writer {
+	z, _ := NewWriterLevelDict(w, DefaultCompression, nil)
+	return z
+}
+
+// NewWriterLevel is like NewWriter but specifies the compression level instead
+// of assuming DefaultCompression.
+//
+// The compression level can be DefaultCompression or any integer value
+// between BestSpeed and BestCompression inclusive. The error returned will
+// be nil if the level is valid.
+func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
+	return NewWriterLevelDict(w, level, nil)
+}
+
+// NewWriterLevelDict is like NewWriterLevel but specifies a dictionary to
+// compress with. The dictionary is either in the Zstandard dictionary
+// format or raw content; in the former case its ID is recorded in the
+// frame header. The same dictionary must be given to NewReaderDict to
+// decompress the data.
+//
+// The dictionary may be nil. If not, its contents should not be modified
+// until the Writer is closed.
+func NewWriterLevelDict(w io.Writer, level int, dict []byte) (*Writer, error) {
+	if level == DefaultCompression {
+		level = defaultLevel
+	}
+	if level < BestSpeed || level > BestCompression {
+		return nil, fmt.Errorf("zstd: invalid compression level: %d", level)
+	}
+	z := &Writer{level: level}
+	if dict != nil {
+		d, err := parseDict(dict)
+		if err != nil {
+			return nil, err
+		}
+		z.dict = d
+	}
+	z.enc.init(levelParams[level])
+	z.Reset(w)
+	return z, nil
+}
+
+// Reset discards the Writer z's state and makes it equivalent to the
+// result of its original state from NewWriter, NewWriterLevel or
+// NewWriterLevelDict, but writing to w instead. This permits reusing
+// a Writer rather than allocating a new one.
+func (z *Writer) Reset(w io.Writer) {
+	z.w = w
+	z.enc.reset(z.dict)
+	z.hasher.reset()
+	z.wroteHeader = false
+	z.closed = false
+	z.err = nil
+}
+
+// Write writes a compressed form of p to the underlying io.Writer. The
+// compressed bytes are not necessarily flushed until the Writer is closed.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, errClosed
+	}
+	n := len(p)
+	for len(p) > 0 {
+		// A full block is only written once more data follows, so
+		// that Close can mark it as the last one.
+		room := maxBlockSize - (len(z.enc.hist) - z.enc.cur)
+		if room == 0 {
+			if err := z.writeBlock(false); err != nil {
+				return n - len(p), err
+			}
+			continue
+		}
+		if room > len(p) {
+			room = len(p)
+		}
+		z.enc.hist = append(z.enc.hist, p[:room]...)
+		p = p[room:]
+	}
+	return n, nil
+}
+
+// Flush writes any pending data to the underlying writer.
+// It is useful mainly in compressed network protocols, to ensure that
+// a remote reader has enough data to reconstruct a packet.
+// Flush does not return until the data has been written.
+// If the underlying writer returns an error, Flush returns that error.
+func (z *Writer) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	if z.enc.cur < len(z.enc.hist) {
+		return z.writeBlock(false)
+	}
+	if !z.wroteHeader {
+		return z.writeHeader(-1)
+	}
+	return nil
+}
+
+// Close closes the Writer by flushing any unwritten data to the underlying
+// io.Writer and writing the frame's last block and checksum. It does not
+// close the underlying io.Writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	if err := z.writeBlock(true); err != nil {
+		return err
+	}
+	z.closed = true
+	var sum [4]byte
+	le.PutUint32(sum[:], uint32(z.hasher.sum64()))
+	_, z.err = z.w.Write(sum[:])
+	return z.err
+}
+
+// writeHeader writes the frame header. If contentSize is not negative,
+// it is the size of the whole content, which is recorded in the header.
+func (z *Writer) writeHeader(contentSize int64) error {
+	z.wroteHeader = true
+	b := make([]byte, 4, 18)
+	le.PutUint32(b, frameMagic)
+	fhd := byte(1 << 2) // content checksum
+	var dictID uint32
+	if z.dict != nil {
+		dictID = z.dict.id
+	}
+	switch {
+	case dictID == 0:
+	case dictID < 1<<8:
+		fhd |= 1
+	case dictID < 1<<16:
+		fhd |= 2
+	default:
+		fhd |= 3
+	}
+	// A frame whose size is known in advance is a single segment: its
+	// window is its content.
+	single := contentSize >= 0 && contentSize <= int64(z.enc.windowSize)
+	if single {
+		fhd |= 1 << 5
+		switch {
+		case contentSize < 256:
+		case contentSize < 1<<16+256:
+			fhd |= 1 << 6
+		case contentSize <= math.MaxUint32:
+			fhd |= 2 << 6
+		default:
+			fhd |= 3 << 6
+		}
+		z.enc.maxOffset = math.MaxInt32
+	}
+	b = append(b, fhd)
+	if !single {
+		b = append(b, (z.enc.p.windowLog-minWindowLog)<<3)
+	}
+	switch fhd & 3 {
+	case 1:
+		b = append(b, byte(dictID))
+	case 2:
+		b = append(b, byte(dictID), byte(dictID>>8))
+	case 3:
+		b = append(b, byte(dictID), byte(dictID>>8), byte(dictID>>16), byte(dictID>>24))
+	}
+	if single {
+		switch fhd >> 6 {
+		case 0:
+			b = append(b, byte(contentSize))
+		case 1:
+			v := contentSize - 256
+			b = append(b, byte(v), byte(v>>8))
+		case 2:
+			b = append(b, make([]byte, 4)...)
+			le.PutUint32(b[len(b)-4:], uint32(contentSize))
+		case 3:
+			b = append(b, make([]byte, 8)...)
+			le.PutUint64(b[len(b)-8:], uint64(contentSize))
+		}
+	}
+	_, z.err = z.w.Write(b)
+	return z.err
+}
+
+// writeBlock compresses and writes the pending data as a block.
+func (z *Writer) writeBlock(last bool) error {
+	e := &z.enc
+	if !z.wroteHeader {
+		size := int64(-1)
+		if last {
+			size = int64(len(e.hist) - e.cur)
+		}
+		if err := z.writeHeader(size); err != nil {
+			return err
+		}
+	}
+	e.slide()
+	start, end := e.cur, len(e.hist)
+	src := e.hist[start:end]
+
+	b := append(z.buf[:0], 0, 0, 0)
+	typ, size := blockRaw, len(src)
+	rle := len(src) > 2
+	for i := 1; rle && i < len(src); i++ {
+		rle = src[i] == src[0]
+	}
+	if rle {
+		typ = blockRLE
+		b = append(b, src[0])
+	} else {
+		reps := e.reps
+		e.findSequences(start, end)
+		b = e.encodeBlock(b)
+		if len(b)-3 < len(src) {
+			typ, size = blockCompressed, len(b)-3
+		} else {
+			e.reps = reps
+			b = append(b[:3], src...)
+		}
+	}
+	h := uint32(size)<<3 | uint32(typ)<<1
+	if last {
+		h |= 1
+	}
+	b[0], b[1], b[2] = byte(h), byte(h>>8), byte(h>>16)
+	z.buf = b
+
+	z.hasher.write(src)
+	e.cur = end
+	if _, err := z.w.Write(b); err != nil {
+		z.err = err
+		return err
+	}
+	return nil
+}
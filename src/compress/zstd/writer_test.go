@@ -0,0 +1,272 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// testInputs returns inputs exercising the various block and literals
+// encodings.
+func testInputs() map[string][]byte {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 300<<10)
+	rng.Read(random)
+	// Text using more than 128 distinct byte values, so that the
+	// Huffman weights are FSE-compressed.
+	var wide []byte
+	for len(wide) < 200<<10 {
+		n := 1 + rng.Intn(8)
+		for i := 0; i < n; i++ {
+			wide = append(wide, byte(rng.Intn(16)*rng.Intn(16)))
+		}
+		if rng.Intn(2) == 0 && len(wide) > 1000 {
+			off := 1 + rng.Intn(1000)
+			start := len(wide) - off
+			wide = append(wide, wide[start:start+rng.Intn(off)]...)
+		}
+	}
+	return map[string][]byte{
+		"empty":    {},
+		"one byte": {'x'},
+		"zeros":    make([]byte, 1<<20),
+		"random":   random,
+		"e.txt":    mustLoadFile("../testdata/e.txt"),
+		"text":     []byte(strings.Repeat(string(mustLoadFile("../testdata/gettysburg.txt")), 200)),
+		"wide":     wide,
+		"blocks":   bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz0123456789"), 3*maxBlockSize/36+1)[:3*maxBlockSize],
+	}
+}
+
+func compress(t *testing.T, level int, dict, input []byte) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriterLevelDict(&buf, level, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(input); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decompress(t *testing.T, dict, input []byte) []byte {
+	r, err := NewReaderDict(bytes.NewReader(input), dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	levels := []int{DefaultCompression, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if testing.Short() {
+		levels = []int{BestSpeed, DefaultCompression, BestCompression}
+	}
+	for name, input := range testInputs() {
+		for _, level := range levels {
+			t.Run(fmt.Sprintf("%s/%d", name, level), func(t *testing.T) {
+				c := compress(t, level, nil, input)
+				if got := decompress(t, nil, c); !bytes.Equal(got, input) {
+					t.Fatalf("round trip mismatch")
+				}
+				if len(input) > 1000 && name != "random" && len(c) > len(input)/2 {
+					t.Errorf("compressed %d bytes to %d", len(input), len(c))
+				}
+			})
+		}
+	}
+}
+
+func TestWriterBlockBoundaries(t *testing.T) {
+	input := mustLoadFile("../testdata/e.txt")
+	for len(input) < 3*maxBlockSize {
+		input = append(input, input...)
+	}
+	for _, n := range []int{maxBlockSize - 1, maxBlockSize, maxBlockSize + 1, 2 * maxBlockSize, 3*maxBlockSize - 1} {
+		c := compress(t, DefaultCompression, nil, input[:n])
+		if got := decompress(t, nil, c); !bytes.Equal(got, input[:n]) {
+			t.Errorf("%d bytes: round trip mismatch", n)
+		}
+	}
+}
+
+func TestWriterDict(t *testing.T) {
+	input := mustLoadFile("../testdata/gettysburg.txt")
+	plain := compress(t, BestCompression, nil, input)
+	for _, dict := range [][]byte{
+		mustLoadFile("testdata/newton.dict"),
+		[]byte(strings.Repeat("that this nation, under God, shall have a new birth of freedom ", 4)),
+	} {
+		c := compress(t, BestCompression, dict, input)
+		if len(c) >= len(plain) {
+			t.Errorf("compressed size with dictionary %d, want less than %d", len(c), len(plain))
+		}
+		if got := decompress(t, dict, c); !bytes.Equal(got, input) {
+			t.Errorf("round trip mismatch")
+		}
+	}
+
+	// The ID of a dictionary in the Zstandard format is recorded.
+	c := compress(t, BestCompression, mustLoadFile("testdata/newton.dict"), input)
+	if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(c))); err != ErrDictionary {
+		t.Errorf("reading without dictionary: got %v, want %v", err, ErrDictionary)
+	}
+
+	if _, err := NewWriterLevelDict(ioutil.Discard, DefaultCompression, mustLoadFile("testdata/newton.dict")[:20]); err != ErrDictionary {
+		t.Errorf("truncated dictionary: got %v, want %v", err, ErrDictionary)
+	}
+}
+
+// TestWriterFlush checks that the data written before a Flush can be
+// decompressed before the Writer is closed.
+func TestWriterFlush(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	r := NewReader(&buf)
+	for i := 0; i < 5; i++ {
+		msg := []byte(strings.Repeat(fmt.Sprintf("message %d. ", i), 10*i))
+		if _, err := w.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, len(msg))
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("message %d: got %q, want %q", i, got, msg)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read at end = %d, %v; want 0, io.EOF", n, err)
+	}
+}
+
+func TestWriterReset(t *testing.T) {
+	input := testInputs()["text"]
+	var buf1, buf2 bytes.Buffer
+	w := NewWriter(&buf1)
+	w.Write(input)
+	w.Close()
+	w.Reset(&buf2)
+	w.Write(input)
+	w.Close()
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Errorf("output after Reset differs")
+	}
+	if _, err := w.Write(input); err == nil {
+		t.Errorf("Write after Close: no error")
+	}
+}
+
+func TestWriterLevel(t *testing.T) {
+	for _, level := range []int{-2, 0, BestCompression + 1} {
+		if _, err := NewWriterLevel(ioutil.Discard, level); err == nil {
+			t.Errorf("NewWriterLevel(%d): no error", level)
+		}
+	}
+}
+
+func TestXXHash(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xEF46DB3751D8E999},
+		{"a", 0xD24EC4F1A98C6E5B},
+		{"abc", 0x44BC2CF5AD770999},
+	}
+	for _, tt := range tests {
+		var d xxhash64
+		d.reset()
+		d.write([]byte(tt.in))
+		if got := d.sum64(); got != tt.want {
+			t.Errorf("xxhash64(%q) = %#x, want %#x", tt.in, got, tt.want)
+		}
+	}
+
+	// Writing in pieces yields the same hash.
+	data := testInputs()["text"][:1000]
+	var d1, d2 xxhash64
+	d1.reset()
+	d1.write(data)
+	d2.reset()
+	for i := 0; i < len(data); i += 7 {
+		d2.write(data[i:min(i+7, len(data))])
+	}
+	if d1.sum64() != d2.sum64() {
+		t.Errorf("hash differs when written in pieces")
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func TestPredefinedDistributions(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		norm []int16
+		log  uint8
+	}{
+		{"literals length", predefLLNorm, predefLLLog},
+		{"match length", predefMLNorm, predefMLLog},
+		{"offset", predefOFNorm, predefOFLog},
+	} {
+		sum := 0
+		for _, c := range tt.norm {
+			if c < 0 {
+				c = 1
+			}
+			sum += int(c)
+		}
+		if sum != 1<<tt.log {
+			t.Errorf("%s: sum of predefined distribution = %d, want %d", tt.name, sum, 1<<tt.log)
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	input := mustLoadFile("../testdata/e.txt")
+	b.SetBytes(int64(len(input)))
+	w := NewWriter(ioutil.Discard)
+	for i := 0; i < b.N; i++ {
+		w.Reset(ioutil.Discard)
+		w.Write(input)
+		w.Close()
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	input := mustLoadFile("testdata/e.txt.zst")
+	b.SetBytes(int64(len(mustLoadFile("../testdata/e.txt"))))
+	r := NewReader(nil)
+	for i := 0; i < b.N; i++ {
+		r.Reset(bytes.NewReader(input))
+		io.Copy(ioutil.Discard, r)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import "math/bits"
+
+// The content checksum of a frame is the low 32 bits of the XXH64
+// hash of the decompressed content, with a seed of zero.
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxhash64 is a streaming XXH64 hash with a seed of zero.
+type xxhash64 struct {
+	v     [4]uint64
+	total uint64
+	mem   [32]byte
+	n     int // number of bytes buffered in mem
+}
+
+func (d *xxhash64) reset() {
+	d.v[0] = xxPrime1
+	d.v[0] += xxPrime2
+	d.v[1] = xxPrime2
+	d.v[2] = 0
+	d.v[3] = ^xxPrime1 + 1
+	d.total = 0
+	d.n = 0
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func (d *xxhash64) write(p []byte) {
+	d.total += uint64(len(p))
+	if d.n+len(p) < 32 {
+		d.n += copy(d.mem[d.n:], p)
+		return
+	}
+	if d.n > 0 {
+		c := copy(d.mem[d.n:], p)
+		d.stripe(d.mem[:])
+		p = p[c:]
+		d.n = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		d.stripe(p)
+	}
+	d.n = copy(d.mem[:], p)
+}
+
+func (d *xxhash64) stripe(p []byte) {
+	d.v[0] = xxRound(d.v[0], le.Uint64(p[0:]))
+	d.v[1] = xxRound(d.v[1], le.Uint64(p[8:]))
+	d.v[2] = xxRound(d.v[2], le.Uint64(p[16:]))
+	d.v[3] = xxRound(d.v[3], le.Uint64(p[24:]))
+}
+
+func (d *xxhash64) sum64() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		h = bits.RotateLeft64(d.v[0], 1) + bits.RotateLeft64(d.v[1], 7) +
+			bits.RotateLeft64(d.v[2], 12) + bits.RotateLeft64(d.v[3], 18)
+		for _, v := range d.v {
+			h = xxMergeRound(h, v)
+		}
+	} else {
+		h = d.v[2] + xxPrime5
+	}
+	h += d.total
+
+	p := d.mem[:d.n]
+	for ; len(p) >= 8; p = p[8:] {
+		h ^= xxRound(0, le.Uint64(p))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(p) >= 4 {
+		h ^= uint64(le.Uint32(p)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		h ^= uint64(b) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
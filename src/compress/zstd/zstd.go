@@ -0,0 +1,81 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zstd implements reading and writing of Zstandard compressed
+// data, as specified in RFC 8878.
+//
+// A compressed stream is a sequence of frames. The Reader decodes all
+// frames of a stream in turn, skipping skippable frames, and verifies
+// the content checksum of each frame that has one. The Writer produces
+// a single frame per stream, always with a content checksum.
+//
+// Both the Reader and the Writer support dictionaries, either in the
+// Zstandard dictionary format, as produced by "zstd --train", or as
+// raw content.
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	frameMagic         = 0xFD2FB528
+	skippableMagic     = 0x184D2A50
+	skippableMagicMask = 0xFFFFFFF0
+	dictMagic          = 0xEC30A437
+
+	// maxBlockSize is the largest size of a block, both compressed
+	// and decompressed.
+	maxBlockSize = 128 << 10
+
+	// maxWindowSize is the largest window size the Reader accepts.
+	// It matches the default limit of the reference decoder.
+	maxWindowSize = 1 << 27
+
+	minWindowLog = 10
+)
+
+// Block types.
+const (
+	blockRaw        = 0
+	blockRLE        = 1
+	blockCompressed = 2
+	blockReserved   = 3
+)
+
+var (
+	// ErrChecksum is returned when reading Zstandard data whose content
+	// checksum does not match.
+	ErrChecksum = errors.New("zstd: invalid checksum")
+	// ErrHeader is returned when reading Zstandard data that has an
+	// invalid frame header.
+	ErrHeader = errors.New("zstd: invalid header")
+	// ErrDictionary is returned when the dictionary required to decode
+	// a frame is missing or does not match the one given to the Reader,
+	// or when a dictionary is malformed.
+	ErrDictionary = errors.New("zstd: invalid or mismatched dictionary")
+	// ErrWindowTooLarge is returned when reading a frame whose window
+	// size exceeds the limit of the Reader.
+	ErrWindowTooLarge = errors.New("zstd: window size too large")
+)
+
+// A StructuralError is returned when the Zstandard data is found to be
+// syntactically invalid.
+type StructuralError string
+
+func (s StructuralError) Error() string {
+	return "zstd: invalid data: " + string(s)
+}
+
+var le = binary.LittleEndian
+
+// noEOF converts io.EOF to io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
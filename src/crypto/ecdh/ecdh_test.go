@@ -0,0 +1,251 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ecdh_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// Check that PrivateKey and PublicKey implement the interfaces documented in
+// crypto.PrivateKey and crypto.PublicKey.
+var _ interface {
+	Public() crypto.PublicKey
+	Equal(x crypto.PrivateKey) bool
+} = &ecdh.PrivateKey{}
+var _ interface {
+	Equal(x crypto.PublicKey) bool
+} = &ecdh.PublicKey{}
+
+var curves = []ecdh.Curve{ecdh.P256(), ecdh.P384(), ecdh.P521(), ecdh.X25519()}
+
+func TestECDH(t *testing.T) {
+	for _, curve := range curves {
+		t.Run(fmt.Sprint(curve), func(t *testing.T) {
+			aliceKey, err := curve.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bobKey, err := curve.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			alicePubKey, err := curve.NewPublicKey(aliceKey.PublicKey().Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !alicePubKey.Equal(aliceKey.PublicKey()) {
+				t.Error("encoded and decoded public keys are different")
+			}
+			if !alicePubKey.Equal(aliceKey.Public()) {
+				t.Error("encoded and decoded public keys are different")
+			}
+
+			alicePrivKey, err := curve.NewPrivateKey(aliceKey.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !alicePrivKey.Equal(aliceKey) {
+				t.Error("encoded and decoded private keys are different")
+			}
+			if alicePrivKey.Equal(bobKey) || alicePubKey.Equal(bobKey.PublicKey()) {
+				t.Error("different keys are reported as equal")
+			}
+
+			bobSecret, err := bobKey.ECDH(aliceKey.PublicKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			aliceSecret, err := aliceKey.ECDH(bobKey.PublicKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(bobSecret, aliceSecret) {
+				t.Error("two ECDH computations came out different")
+			}
+		})
+	}
+}
+
+var vectors = map[ecdh.Curve]struct {
+	PrivateKey, PublicKey string
+	PeerPublicKey         string
+	SharedSecret          string
+}{
+	// NIST CAVP SP 800-56A ECC CDH Primitive, first P-256 test case.
+	ecdh.P256(): {
+		PrivateKey: "7d7dc5f71eb29ddaf80d6214632eeae03d9058af1fb6d22ed80badb62bc1a534",
+		PublicKey: "04ead218590119e8876b29146ff89ca61770c4edbbf97d38ce385ed281d8a6b230" +
+			"28af61281fd35e2fa7002523acc85a429cb06ee6648325389f59edfce1405141",
+		PeerPublicKey: "04700c48f77f56584c5cc632ca65640db91b6bacce3a4df6b42ce7cc838833d287" +
+			"db71e509e3fd9b060ddb20ba5c51dcc5948d46fbf640dfe0441782cab85fa4ac",
+		SharedSecret: "46fc62106420ff012e54a434fbdd2d25ccc5852060561e68040dd7778997bd7b",
+	},
+	// RFC 7748, Section 6.1.
+	ecdh.X25519(): {
+		PrivateKey:    "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a",
+		PublicKey:     "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a",
+		PeerPublicKey: "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f",
+		SharedSecret:  "4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742",
+	},
+}
+
+func TestVectors(t *testing.T) {
+	for curve, v := range vectors {
+		t.Run(fmt.Sprint(curve), func(t *testing.T) {
+			key, err := curve.NewPrivateKey(hexDecode(t, v.PrivateKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := key.PublicKey().Bytes(); !bytes.Equal(got, hexDecode(t, v.PublicKey)) {
+				t.Errorf("public key: got %x, want %s", got, v.PublicKey)
+			}
+			peer, err := curve.NewPublicKey(hexDecode(t, v.PeerPublicKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			secret, err := key.ECDH(peer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(secret, hexDecode(t, v.SharedSecret)) {
+				t.Errorf("shared secret: got %x, want %s", secret, v.SharedSecret)
+			}
+		})
+	}
+}
+
+func hexDecode(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal("invalid hex string:", s)
+	}
+	return b
+}
+
+func TestInvalidPrivateKeys(t *testing.T) {
+	for _, curve := range []ecdh.Curve{ecdh.P256(), ecdh.P384(), ecdh.P521()} {
+		t.Run(fmt.Sprint(curve), func(t *testing.T) {
+			params := nistParams(curve)
+			size := (params.BitSize + 7) / 8
+			for name, key := range map[string][]byte{
+				"zero":  make([]byte, size),
+				"order": params.N.FillBytes(make([]byte, size)),
+				"max":   bytes.Repeat([]byte{0xff}, size),
+				"short": make([]byte, size-1),
+				"long":  make([]byte, size+1),
+			} {
+				if _, err := curve.NewPrivateKey(key); err == nil {
+					t.Errorf("%s private key was accepted", name)
+				}
+			}
+		})
+	}
+	if _, err := ecdh.X25519().NewPrivateKey(make([]byte, 31)); err == nil {
+		t.Error("short X25519 private key was accepted")
+	}
+}
+
+func TestInvalidPublicKeys(t *testing.T) {
+	for _, curve := range []ecdh.Curve{ecdh.P256(), ecdh.P384(), ecdh.P521()} {
+		t.Run(fmt.Sprint(curve), func(t *testing.T) {
+			key, err := curve.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			valid := key.PublicKey().Bytes()
+			offCurve := append([]byte{}, valid...)
+			offCurve[len(offCurve)-1] ^= 1
+			compressed := append([]byte{2 | valid[len(valid)-1]&1}, valid[1:1+len(valid)/2]...)
+			for name, pub := range map[string][]byte{
+				"infinity":   {0},
+				"empty":      {},
+				"off curve":  offCurve,
+				"compressed": compressed,
+				"truncated":  valid[:len(valid)-1],
+			} {
+				if _, err := curve.NewPublicKey(pub); err == nil {
+					t.Errorf("%s public key was accepted", name)
+				}
+			}
+		})
+	}
+	if _, err := ecdh.X25519().NewPublicKey(make([]byte, 33)); err == nil {
+		t.Error("long X25519 public key was accepted")
+	}
+}
+
+func TestX25519LowOrderPoint(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := ecdh.X25519().NewPublicKey(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := key.ECDH(peer); err == nil {
+		t.Error("ECDH with a low order point succeeded")
+	}
+}
+
+func TestMismatchedCurves(t *testing.T) {
+	for _, a := range curves {
+		for _, b := range curves {
+			if a == b {
+				continue
+			}
+			privA, err := a.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			privB, err := b.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := privA.ECDH(privB.PublicKey()); err == nil {
+				t.Errorf("ECDH between %v and %v succeeded", a, b)
+			}
+			if privA.Equal(privB) || privA.PublicKey().Equal(privB.PublicKey()) {
+				t.Errorf("keys on %v and %v are reported as equal", a, b)
+			}
+		}
+	}
+}
+
+func TestKeyEncodingAliasing(t *testing.T) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := key.Bytes()
+	key.Bytes()[0] ^= 0xff
+	key.PublicKey().Bytes()[1] ^= 0xff
+	if !bytes.Equal(key.Bytes(), want) {
+		t.Error("Bytes returned a slice aliasing the private key")
+	}
+	if _, err := ecdh.P256().NewPublicKey(key.PublicKey().Bytes()); err != nil {
+		t.Error("Bytes returned a slice aliasing the public key")
+	}
+}
+
+func nistParams(c ecdh.Curve) *elliptic.CurveParams {
+	switch c {
+	case ecdh.P256():
+		return elliptic.P256().Params()
+	case ecdh.P384():
+		return elliptic.P384().Params()
+	case ecdh.P521():
+		return elliptic.P521().Params()
+	}
+	panic("not a NIST curve")
+}
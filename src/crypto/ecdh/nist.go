@@ -0,0 +1,129 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ecdh
+
+import (
+	"crypto/elliptic"
+	"crypto/internal/randutil"
+	"errors"
+	"io"
+	"math/big"
+)
+
+type nistCurve struct {
+	name  string
+	curve elliptic.Curve
+}
+
+func (c *nistCurve) String() string {
+	return c.name
+}
+
+// byteLen returns the length in bytes of scalars and field elements.
+func (c *nistCurve) byteLen() int {
+	return (c.curve.Params().BitSize + 7) / 8
+}
+
+func (c *nistCurve) GenerateKey(rand io.Reader) (*PrivateKey, error) {
+	randutil.MaybeReadByte(rand)
+
+	// Generate a scalar in [1, N-1] with extra random bits, as in FIPS 186-4,
+	// Appendix B.4.1. This is the same method as crypto/ecdsa, and unlike
+	// rejection sampling it terminates even with a deterministic reader.
+	params := c.curve.Params()
+	b := make([]byte, params.BitSize/8+8)
+	if _, err := io.ReadFull(rand, b); err != nil {
+		return nil, err
+	}
+	k := new(big.Int).SetBytes(b)
+	n := new(big.Int).Sub(params.N, big.NewInt(1))
+	k.Mod(k, n)
+	k.Add(k, big.NewInt(1))
+	return c.NewPrivateKey(k.FillBytes(make([]byte, c.byteLen())))
+}
+
+func (c *nistCurve) NewPrivateKey(key []byte) (*PrivateKey, error) {
+	if len(key) != c.byteLen() {
+		return nil, errors.New("crypto/ecdh: invalid private key size")
+	}
+	s := new(big.Int).SetBytes(key)
+	if s.Sign() == 0 || s.Cmp(c.curve.Params().N) >= 0 {
+		return nil, errors.New("crypto/ecdh: invalid private key")
+	}
+	k := &PrivateKey{
+		curve:      c,
+		privateKey: append([]byte(nil), key...),
+	}
+	k.publicKey = c.privateKeyToPublicKey(k)
+	return k, nil
+}
+
+func (c *nistCurve) privateKeyToPublicKey(key *PrivateKey) *PublicKey {
+	if key.curve != c {
+		panic("crypto/ecdh: internal error: converting the wrong key type")
+	}
+	x, y := c.curve.ScalarBaseMult(key.privateKey)
+	return &PublicKey{
+		curve:     c,
+		publicKey: elliptic.Marshal(c.curve, x, y),
+	}
+}
+
+func (c *nistCurve) NewPublicKey(key []byte) (*PublicKey, error) {
+	// Reject the point at infinity and compressed encodings. Unmarshal
+	// checks the 0x04 prefix, that the coordinates are reduced, and that
+	// the point is on the curve.
+	if len(key) == 0 || key[0] != 4 {
+		return nil, errors.New("crypto/ecdh: invalid public key")
+	}
+	if x, _ := elliptic.Unmarshal(c.curve, key); x == nil {
+		return nil, errors.New("crypto/ecdh: invalid public key")
+	}
+	return &PublicKey{
+		curve:     c,
+		publicKey: append([]byte(nil), key...),
+	}, nil
+}
+
+func (c *nistCurve) ecdh(local *PrivateKey, remote *PublicKey) ([]byte, error) {
+	// SEC 1, Version 2.0, Section 3.3.1. The remote point was validated by
+	// NewPublicKey, and the cofactor of the NIST curves is one, so the only
+	// way to reach the point at infinity is a scalar equal to the order,
+	// which NewPrivateKey rejects. Check anyway, as a failure here would
+	// silently produce a predictable secret.
+	x, y := elliptic.Unmarshal(c.curve, remote.publicKey)
+	x, y = c.curve.ScalarMult(x, y, local.privateKey)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, errors.New("crypto/ecdh: bad ECDH result: point at infinity")
+	}
+	return x.FillBytes(make([]byte, c.byteLen())), nil
+}
+
+// P256 returns a Curve which implements NIST P-256 (FIPS 186-3, section D.2.3),
+// also known as secp256r1 or prime256v1.
+//
+// Multiple invocations of this function will return the same value, which can
+// be used for equality checks and switch statements.
+func P256() Curve { return p256 }
+
+var p256 = &nistCurve{"P-256", elliptic.P256()}
+
+// P384 returns a Curve which implements NIST P-384 (FIPS 186-3, section D.2.4),
+// also known as secp384r1.
+//
+// Multiple invocations of this function will return the same value, which can
+// be used for equality checks and switch statements.
+func P384() Curve { return p384 }
+
+var p384 = &nistCurve{"P-384", elliptic.P384()}
+
+// P521 returns a Curve which implements NIST P-521 (FIPS 186-3, section D.2.5),
+// also known as secp521r1.
+//
+// Multiple invocations of this function will return the same value, which can
+// be used for equality checks and switch statements.
+func P521() Curve { return p521 }
+
+var p521 = &nistCurve{"P-521", elliptic.P521()}
@@ -0,0 +1,631 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hpke implements Hybrid Public Key Encryption (HPKE), as specified
+// in RFC 9180.
+//
+// HPKE combines a key encapsulation mechanism (KEM), a key derivation
+// function (KDF) and an authenticated encryption with associated data
+// (AEAD) algorithm into a Suite. A sender sets up a Sender context for a
+// recipient's public key, producing an encapsulated key which is sent to the
+// recipient along with the sealed messages. The recipient uses its private
+// key and the encapsulated key to set up the matching Receiver context.
+//
+// All four modes of RFC 9180, Section 5 are implemented: base, PSK, where
+// both parties also hold a pre-shared key, auth, where the sender also
+// authenticates with its own private key, and auth-PSK, which combines the
+// two.
+package hpke
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"strconv"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// A KEM is a key encapsulation mechanism identifier, from the IANA HPKE
+// registry.
+type KEM uint16
+
+const (
+	DHKEM_P256_HKDF_SHA256   KEM = 0x0010
+	DHKEM_P384_HKDF_SHA384   KEM = 0x0011
+	DHKEM_P521_HKDF_SHA512   KEM = 0x0012
+	DHKEM_X25519_HKDF_SHA256 KEM = 0x0020
+)
+
+// A KDF is a key derivation function identifier, from the IANA HPKE
+// registry.
+type KDF uint16
+
+const (
+	KDF_HKDF_SHA256 KDF = 0x0001
+	KDF_HKDF_SHA384 KDF = 0x0002
+	KDF_HKDF_SHA512 KDF = 0x0003
+)
+
+// An AEAD is an authenticated encryption algorithm identifier, from the
+// IANA HPKE registry.
+type AEAD uint16
+
+const (
+	AEAD_AES_128_GCM      AEAD = 0x0001
+	AEAD_AES_256_GCM      AEAD = 0x0002
+	AEAD_ChaCha20Poly1305 AEAD = 0x0003
+
+	// AEAD_ExportOnly indicates that the context is only used to export
+	// secrets with Export. Seal and Open always fail.
+	AEAD_ExportOnly AEAD = 0xffff
+)
+
+// A Suite is a combination of algorithms used to set up an HPKE context.
+type Suite struct {
+	KEM  KEM
+	KDF  KDF
+	AEAD AEAD
+}
+
+// Supported reports whether the KEM is implemented by this package.
+func (kem KEM) Supported() bool {
+	return kem.Curve() != nil
+}
+
+// Curve returns the curve of the KEM's private and public keys, or nil if the
+// KEM is not supported.
+func (kem KEM) Curve() ecdh.Curve {
+	switch kem {
+	case DHKEM_P256_HKDF_SHA256:
+		return ecdh.P256()
+	case DHKEM_P384_HKDF_SHA384:
+		return ecdh.P384()
+	case DHKEM_P521_HKDF_SHA512:
+		return ecdh.P521()
+	case DHKEM_X25519_HKDF_SHA256:
+		return ecdh.X25519()
+	}
+	return nil
+}
+
+// kdf returns the KDF used internally by the KEM.
+func (kem KEM) kdf() KDF {
+	switch kem {
+	case DHKEM_P384_HKDF_SHA384:
+		return KDF_HKDF_SHA384
+	case DHKEM_P521_HKDF_SHA512:
+		return KDF_HKDF_SHA512
+	}
+	return KDF_HKDF_SHA256
+}
+
+// secretSize returns Nsecret, the length of the KEM shared secret.
+func (kem KEM) secretSize() int {
+	return kem.kdf().size()
+}
+
+// privateKeySize returns Nsk, the length of an encoded private key.
+func (kem KEM) privateKeySize() int {
+	switch kem {
+	case DHKEM_P384_HKDF_SHA384:
+		return 48
+	case DHKEM_P521_HKDF_SHA512:
+		return 66
+	}
+	return 32
+}
+
+func (kem KEM) suiteID() []byte {
+	return []byte{'K', 'E', 'M', byte(kem >> 8), byte(kem)}
+}
+
+func (kem KEM) String() string {
+	switch kem {
+	case DHKEM_P256_HKDF_SHA256:
+		return "DHKEM(P-256, HKDF-SHA256)"
+	case DHKEM_P384_HKDF_SHA384:
+		return "DHKEM(P-384, HKDF-SHA384)"
+	case DHKEM_P521_HKDF_SHA512:
+		return "DHKEM(P-521, HKDF-SHA512)"
+	case DHKEM_X25519_HKDF_SHA256:
+		return "DHKEM(X25519, HKDF-SHA256)"
+	}
+	return "KEM(0x" + strconv.FormatUint(uint64(kem), 16) + ")"
+}
+
+// DeriveKeyPair deterministically derives a private key from the input
+// keying material ikm, as specified in RFC 9180, Section 7.1.3. ikm must be
+// at least as long as the private keys of the KEM, and should have as much
+// entropy.
+//
+// Most applications should use the GenerateKey method of the KEM's Curve
+// instead.
+func (kem KEM) DeriveKeyPair(ikm []byte) (*ecdh.PrivateKey, error) {
+	curve := kem.Curve()
+	if curve == nil {
+		return nil, errors.New("hpke: unsupported KEM")
+	}
+	nsk := kem.privateKeySize()
+	if len(ikm) < nsk {
+		return nil, errors.New("hpke: input keying material is too short")
+	}
+	suiteID := kem.suiteID()
+	h := kem.kdf().hash()
+	prk := labeledExtract(h, suiteID, nil, "dkp_prk", ikm)
+	if kem == DHKEM_X25519_HKDF_SHA256 {
+		sk, err := labeledExpand(h, suiteID, prk, "sk", nil, nsk)
+		if err != nil {
+			return nil, err
+		}
+		return curve.NewPrivateKey(sk)
+	}
+
+	bitmask := byte(0xff)
+	if kem == DHKEM_P521_HKDF_SHA512 {
+		bitmask = 0x01
+	}
+	for counter := 0; counter < 256; counter++ {
+		sk, err := labeledExpand(h, suiteID, prk, "candidate", []byte{byte(counter)}, nsk)
+		if err != nil {
+			return nil, err
+		}
+		sk[0] &= bitmask
+		// NewPrivateKey rejects zero and scalars not lower than the order.
+		if k, err := curve.NewPrivateKey(sk); err == nil {
+			return k, nil
+		}
+	}
+	return nil, errors.New("hpke: failed to derive a key pair")
+}
+
+// Supported reports whether the KDF is implemented by this package.
+func (kdf KDF) Supported() bool {
+	return kdf.hash() != nil
+}
+
+func (kdf KDF) hash() func() hash.Hash {
+	switch kdf {
+	case KDF_HKDF_SHA256:
+		return sha256.New
+	case KDF_HKDF_SHA384:
+		return sha512.New384
+	case KDF_HKDF_SHA512:
+		return sha512.New
+	}
+	return nil
+}
+
+// size returns Nh, the output size of the KDF's Extract function.
+func (kdf KDF) size() int {
+	switch kdf {
+	case KDF_HKDF_SHA384:
+		return sha512.Size384
+	case KDF_HKDF_SHA512:
+		return sha512.Size
+	}
+	return sha256.Size
+}
+
+func (kdf KDF) String() string {
+	switch kdf {
+	case KDF_HKDF_SHA256:
+		return "HKDF-SHA256"
+	case KDF_HKDF_SHA384:
+		return "HKDF-SHA384"
+	case KDF_HKDF_SHA512:
+		return "HKDF-SHA512"
+	}
+	return "KDF(0x" + strconv.FormatUint(uint64(kdf), 16) + ")"
+}
+
+// Supported reports whether the AEAD is implemented by this package.
+func (aead AEAD) Supported() bool {
+	return aead == AEAD_ExportOnly || aead.keySize() != 0
+}
+
+// keySize returns Nk, the length of the AEAD key, or zero if the AEAD is not
+// supported or is AEAD_ExportOnly.
+func (aead AEAD) keySize() int {
+	switch aead {
+	case AEAD_AES_128_GCM:
+		return 16
+	case AEAD_AES_256_GCM:
+		return 32
+	case AEAD_ChaCha20Poly1305:
+		return chacha20poly1305.KeySize
+	}
+	return 0
+}
+
+func (aead AEAD) new(key []byte) (cipher.AEAD, error) {
+	switch aead {
+	case AEAD_AES_128_GCM, AEAD_AES_256_GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AEAD_ChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	}
+	return nil, errors.New("hpke: unsupported AEAD")
+}
+
+func (aead AEAD) String() string {
+	switch aead {
+	case AEAD_AES_128_GCM:
+		return "AES-128-GCM"
+	case AEAD_AES_256_GCM:
+		return "AES-256-GCM"
+	case AEAD_ChaCha20Poly1305:
+		return "ChaCha20Poly1305"
+	case AEAD_ExportOnly:
+		return "Export-only"
+	}
+	return "AEAD(0x" + strconv.FormatUint(uint64(aead), 16) + ")"
+}
+
+func (s Suite) check() error {
+	if !s.KEM.Supported() {
+		return errors.New("hpke: unsupported KEM " + s.KEM.String())
+	}
+	if !s.KDF.Supported() {
+		return errors.New("hpke: unsupported KDF " + s.KDF.String())
+	}
+	if !s.AEAD.Supported() {
+		return errors.New("hpke: unsupported AEAD " + s.AEAD.String())
+	}
+	return nil
+}
+
+func (s Suite) suiteID() []byte {
+	return []byte{'H', 'P', 'K', 'E',
+		byte(s.KEM >> 8), byte(s.KEM),
+		byte(s.KDF >> 8), byte(s.KDF),
+		byte(s.AEAD >> 8), byte(s.AEAD)}
+}
+
+// labeledExtract is LabeledExtract from RFC 9180, Section 4.
+func labeledExtract(h func() hash.Hash, suiteID, salt []byte, label string, ikm []byte) []byte {
+	labeledIKM := make([]byte, 0, 7+len(suiteID)+len(label)+len(ikm))
+	labeledIKM = append(labeledIKM, "HPKE-v1"...)
+	labeledIKM = append(labeledIKM, suiteID...)
+	labeledIKM = append(labeledIKM, label...)
+	labeledIKM = append(labeledIKM, ikm...)
+	return hkdf.Extract(h, labeledIKM, salt)
+}
+
+// labeledExpand is LabeledExpand from RFC 9180, Section 4.
+func labeledExpand(h func() hash.Hash, suiteID, prk []byte, label string, info []byte, length int) ([]byte, error) {
+	if length > 0xffff {
+		return nil, errors.New("hpke: requested output is too long")
+	}
+	labeledInfo := make([]byte, 2, 2+7+len(suiteID)+len(label)+len(info))
+	binary.BigEndian.PutUint16(labeledInfo, uint16(length))
+	labeledInfo = append(labeledInfo, "HPKE-v1"...)
+	labeledInfo = append(labeledInfo, suiteID...)
+	labeledInfo = append(labeledInfo, label...)
+	labeledInfo = append(labeledInfo, info...)
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(h, prk, labeledInfo), out); err != nil {
+		return nil, errors.New("hpke: requested output is too long")
+	}
+	return out, nil
+}
+
+// extractAndExpand derives the KEM shared secret from the Diffie-Hellman
+// output and the KEM context. See RFC 9180, Section 4.1.
+func (kem KEM) extractAndExpand(dh, kemContext []byte) ([]byte, error) {
+	h, suiteID := kem.kdf().hash(), kem.suiteID()
+	eaePRK := labeledExtract(h, suiteID, nil, "eae_prk", dh)
+	return labeledExpand(h, suiteID, eaePRK, "shared_secret", kemContext, kem.secretSize())
+}
+
+// encap implements Encap and AuthEncap from RFC 9180, Section 4.1, with the
+// ephemeral key skE. The sender key skS is nil for Encap.
+func (kem KEM) encap(skE *ecdh.PrivateKey, pkR *ecdh.PublicKey, skS *ecdh.PrivateKey) (sharedSecret, enc []byte, err error) {
+	dh, err := skE.ECDH(pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc = skE.PublicKey().Bytes()
+	kemContext := append(enc[:len(enc):len(enc)], pkR.Bytes()...)
+	if skS != nil {
+		dhS, err := skS.ECDH(pkR)
+		if err != nil {
+			return nil, nil, err
+		}
+		dh = append(dh, dhS...)
+		kemContext = append(kemContext, skS.PublicKey().Bytes()...)
+	}
+	sharedSecret, err = kem.extractAndExpand(dh, kemContext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sharedSecret, enc, nil
+}
+
+// decap implements Decap and AuthDecap from RFC 9180, Section 4.1. The
+// sender public key pkS is nil for Decap.
+func (kem KEM) decap(enc []byte, skR *ecdh.PrivateKey, pkS *ecdh.PublicKey) ([]byte, error) {
+	pkE, err := skR.Curve().NewPublicKey(enc)
+	if err != nil {
+		return nil, err
+	}
+	dh, err := skR.ECDH(pkE)
+	if err != nil {
+		return nil, err
+	}
+	kemContext := append(append([]byte{}, enc...), skR.PublicKey().Bytes()...)
+	if pkS != nil {
+		dhS, err := skR.ECDH(pkS)
+		if err != nil {
+			return nil, err
+		}
+		dh = append(dh, dhS...)
+		kemContext = append(kemContext, pkS.Bytes()...)
+	}
+	return kem.extractAndExpand(dh, kemContext)
+}
+
+// Modes, from RFC 9180, Section 5.
+const (
+	modeBase    = 0x00
+	modePSK     = 0x01
+	modeAuth    = 0x02
+	modeAuthPSK = 0x03
+)
+
+type context struct {
+	suite          Suite
+	aead           cipher.AEAD // nil for AEAD_ExportOnly
+	baseNonce      []byte
+	seq            uint64
+	exporterSecret []byte
+}
+
+// keySchedule implements KeySchedule from RFC 9180, Section 5.1.
+func keySchedule(suite Suite, mode byte, sharedSecret, info, psk, pskID []byte) (*context, error) {
+	// VerifyPSKInputs.
+	gotPSK, gotPSKID := len(psk) != 0, len(pskID) != 0
+	if gotPSK != gotPSKID {
+		return nil, errors.New("hpke: inconsistent PSK inputs")
+	}
+	if gotPSK && (mode == modeBase || mode == modeAuth) {
+		return nil, errors.New("hpke: PSK input provided when not needed")
+	}
+	if !gotPSK && (mode == modePSK || mode == modeAuthPSK) {
+		return nil, errors.New("hpke: missing required PSK input")
+	}
+
+	h, suiteID := suite.KDF.hash(), suite.suiteID()
+	pskIDHash := labeledExtract(h, suiteID, nil, "psk_id_hash", pskID)
+	infoHash := labeledExtract(h, suiteID, nil, "info_hash", info)
+	ksContext := append([]byte{mode}, pskIDHash...)
+	ksContext = append(ksContext, infoHash...)
+
+	secret := labeledExtract(h, suiteID, sharedSecret, "secret", psk)
+	exporterSecret, err := labeledExpand(h, suiteID, secret, "exp", ksContext, suite.KDF.size())
+	if err != nil {
+		return nil, err
+	}
+	ctx := &context{suite: suite, exporterSecret: exporterSecret}
+	if suite.AEAD == AEAD_ExportOnly {
+		return ctx, nil
+	}
+
+	key, err := labeledExpand(h, suiteID, secret, "key", ksContext, suite.AEAD.keySize())
+	if err != nil {
+		return nil, err
+	}
+	if ctx.aead, err = suite.AEAD.new(key); err != nil {
+		return nil, err
+	}
+	ctx.baseNonce, err = labeledExpand(h, suiteID, secret, "base_nonce", ksContext, ctx.aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// nextNonce returns the nonce for the next message and increments the
+// sequence number. See RFC 9180, Section 5.2.
+func (ctx *context) nextNonce() ([]byte, error) {
+	if ctx.aead == nil {
+		return nil, errors.New("hpke: Seal and Open are not available with AEAD_ExportOnly")
+	}
+	if ctx.seq == 1<<64-1 {
+		return nil, errors.New("hpke: message limit reached")
+	}
+	nonce := make([]byte, len(ctx.baseNonce))
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], ctx.seq)
+	for i := range nonce {
+		nonce[i] ^= ctx.baseNonce[i]
+	}
+	ctx.seq++
+	return nonce, nil
+}
+
+// export implements Context.Export from RFC 9180, Section 5.3.
+func (ctx *context) export(exporterContext []byte, length int) ([]byte, error) {
+	if length < 0 || length > 255*ctx.suite.KDF.size() {
+		return nil, errors.New("hpke: invalid exported secret length")
+	}
+	return labeledExpand(ctx.suite.KDF.hash(), ctx.suite.suiteID(), ctx.exporterSecret,
+		"sec", exporterContext, length)
+}
+
+// A Sender is the context of the sender of a sequence of messages to a
+// single recipient. It's not safe for concurrent use.
+type Sender struct {
+	ctx *context
+}
+
+// SetupBaseSender sets up a base mode context for sending messages to the
+// recipient with the public key pkR, and returns the encapsulated key to
+// send to the recipient along with the messages. The ephemeral key is
+// generated with rand.
+func SetupBaseSender(rand io.Reader, suite Suite, pkR *ecdh.PublicKey, info []byte) (enc []byte, s *Sender, err error) {
+	return setupSender(rand, nil, suite, modeBase, pkR, info, nil, nil, nil)
+}
+
+// SetupPSKSender is like SetupBaseSender, but also authenticates the
+// recipient and the sender with the pre-shared key psk, identified by pskID.
+// Both must be non-empty.
+func SetupPSKSender(rand io.Reader, suite Suite, pkR *ecdh.PublicKey, info, psk, pskID []byte) (enc []byte, s *Sender, err error) {
+	return setupSender(rand, nil, suite, modePSK, pkR, info, psk, pskID, nil)
+}
+
+// SetupAuthSender is like SetupBaseSender, but also authenticates the sender
+// with its private key skS. The recipient must know the corresponding public
+// key.
+func SetupAuthSender(rand io.Reader, suite Suite, pkR *ecdh.PublicKey, info []byte, skS *ecdh.PrivateKey) (enc []byte, s *Sender, err error) {
+	if skS == nil {
+		return nil, nil, errors.New("hpke: missing sender private key")
+	}
+	return setupSender(rand, nil, suite, modeAuth, pkR, info, nil, nil, skS)
+}
+
+// SetupAuthPSKSender combines SetupPSKSender and SetupAuthSender.
+func SetupAuthPSKSender(rand io.Reader, suite Suite, pkR *ecdh.PublicKey, info, psk, pskID []byte, skS *ecdh.PrivateKey) (enc []byte, s *Sender, err error) {
+	if skS == nil {
+		return nil, nil, errors.New("hpke: missing sender private key")
+	}
+	return setupSender(rand, nil, suite, modeAuthPSK, pkR, info, psk, pskID, skS)
+}
+
+// setupSender implements the SetupS functions of RFC 9180, Section 5.1. If
+// skE is not nil, it's used as the ephemeral key instead of generating one
+// from rand, for testing.
+func setupSender(rand io.Reader, skE *ecdh.PrivateKey, suite Suite, mode byte, pkR *ecdh.PublicKey, info, psk, pskID []byte, skS *ecdh.PrivateKey) ([]byte, *Sender, error) {
+	if err := suite.check(); err != nil {
+		return nil, nil, err
+	}
+	curve := suite.KEM.Curve()
+	if pkR == nil || pkR.Curve() != curve {
+		return nil, nil, errors.New("hpke: recipient public key does not match the KEM")
+	}
+	if skS != nil && skS.Curve() != curve {
+		return nil, nil, errors.New("hpke: sender private key does not match the KEM")
+	}
+	if skE == nil {
+		var err error
+		if skE, err = curve.GenerateKey(rand); err != nil {
+			return nil, nil, err
+		}
+	}
+	sharedSecret, enc, err := suite.KEM.encap(skE, pkR, skS)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, err := keySchedule(suite, mode, sharedSecret, info, psk, pskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, &Sender{ctx}, nil
+}
+
+// Seal encrypts and authenticates the next message, and authenticates the
+// additional data aad.
+func (s *Sender) Seal(aad, plaintext []byte) ([]byte, error) {
+	nonce, err := s.ctx.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	return s.ctx.aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+// Export derives a secret of the given length from the context, bound to
+// exporterContext. The recipient derives the same secret with
+// Receiver.Export.
+func (s *Sender) Export(exporterContext []byte, length int) ([]byte, error) {
+	return s.ctx.export(exporterContext, length)
+}
+
+// A Receiver is the context of the recipient of a sequence of messages.
+// It's not safe for concurrent use.
+type Receiver struct {
+	ctx *context
+}
+
+// SetupBaseReceiver sets up a base mode context for receiving messages sent
+// with the encapsulated key enc to the recipient with the private key skR.
+func SetupBaseReceiver(suite Suite, enc []byte, skR *ecdh.PrivateKey, info []byte) (*Receiver, error) {
+	return setupReceiver(suite, modeBase, enc, skR, info, nil, nil, nil)
+}
+
+// SetupPSKReceiver is the recipient counterpart of SetupPSKSender.
+func SetupPSKReceiver(suite Suite, enc []byte, skR *ecdh.PrivateKey, info, psk, pskID []byte) (*Receiver, error) {
+	return setupReceiver(suite, modePSK, enc, skR, info, psk, pskID, nil)
+}
+
+// SetupAuthReceiver is the recipient counterpart of SetupAuthSender. pkS is
+// the public key of the expected sender.
+func SetupAuthReceiver(suite Suite, enc []byte, skR *ecdh.PrivateKey, info []byte, pkS *ecdh.PublicKey) (*Receiver, error) {
+	if pkS == nil {
+		return nil, errors.New("hpke: missing sender public key")
+	}
+	return setupReceiver(suite, modeAuth, enc, skR, info, nil, nil, pkS)
+}
+
+// SetupAuthPSKReceiver is the recipient counterpart of SetupAuthPSKSender.
+func SetupAuthPSKReceiver(suite Suite, enc []byte, skR *ecdh.PrivateKey, info, psk, pskID []byte, pkS *ecdh.PublicKey) (*Receiver, error) {
+	if pkS == nil {
+		return nil, errors.New("hpke: missing sender public key")
+	}
+	return setupReceiver(suite, modeAuthPSK, enc, skR, info, psk, pskID, pkS)
+}
+
+// setupReceiver implements the SetupR functions of RFC 9180, Section 5.1.
+func setupReceiver(suite Suite, mode byte, enc []byte, skR *ecdh.PrivateKey, info, psk, pskID []byte, pkS *ecdh.PublicKey) (*Receiver, error) {
+	if err := suite.check(); err != nil {
+		return nil, err
+	}
+	curve := suite.KEM.Curve()
+	if skR == nil || skR.Curve() != curve {
+		return nil, errors.New("hpke: recipient private key does not match the KEM")
+	}
+	if pkS != nil && pkS.Curve() != curve {
+		return nil, errors.New("hpke: sender public key does not match the KEM")
+	}
+	sharedSecret, err := suite.KEM.decap(enc, skR, pkS)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := keySchedule(suite, mode, sharedSecret, info, psk, pskID)
+	if err != nil {
+		return nil, err
+	}
+	return &Receiver{ctx}, nil
+}
+
+// Open decrypts and authenticates the next message, and authenticates the
+// additional data aad.
+func (r *Receiver) Open(aad, ciphertext []byte) ([]byte, error) {
+	nonce, err := r.ctx.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := r.ctx.aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		// A failed decryption doesn't consume a sequence number.
+		r.ctx.seq--
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// Export derives a secret of the given length from the context, bound to
+// exporterContext. See Sender.Export.
+func (r *Receiver) Export(exporterContext []byte, length int) ([]byte, error) {
+	return r.ctx.export(exporterContext, length)
+}
@@ -0,0 +1,377 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpke
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// testVector is an entry of testdata/rfc9180-vectors.json, which is the
+// subset of the RFC 9180 test vectors (from the CFRG repository, commit
+// 5f503c5) that uses the supported KEMs, with only the first two
+// encryptions of each context.
+type testVector struct {
+	Mode        byte   `json:"mode"`
+	KEM         KEM    `json:"kem_id"`
+	KDF         KDF    `json:"kdf_id"`
+	AEAD        AEAD   `json:"aead_id"`
+	Info        string `json:"info"`
+	IKMR        string `json:"ikmR"`
+	IKMS        string `json:"ikmS"`
+	IKME        string `json:"ikmE"`
+	SKRm        string `json:"skRm"`
+	SKSm        string `json:"skSm"`
+	SKEm        string `json:"skEm"`
+	PSK         string `json:"psk"`
+	PSKID       string `json:"psk_id"`
+	PKRm        string `json:"pkRm"`
+	PKSm        string `json:"pkSm"`
+	PKEm        string `json:"pkEm"`
+	Enc         string `json:"enc"`
+	Encryptions []struct {
+		AAD        string `json:"aad"`
+		Ciphertext string `json:"ct"`
+		Plaintext  string `json:"pt"`
+	} `json:"encryptions"`
+	Exports []struct {
+		Context string `json:"exporter_context"`
+		L       int    `json:"L"`
+		Value   string `json:"exported_value"`
+	} `json:"exports"`
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// deriveKey derives a private key from ikm and checks it against the
+// expected encodings of the private and public key.
+func deriveKey(t *testing.T, kem KEM, ikm, sk, pk string) *ecdh.PrivateKey {
+	t.Helper()
+	key, err := kem.DeriveKeyPair(mustDecodeHex(t, ikm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := key.Bytes(); !bytes.Equal(got, mustDecodeHex(t, sk)) {
+		t.Errorf("derived private key: got %x, want %s", got, sk)
+	}
+	if got := key.PublicKey().Bytes(); !bytes.Equal(got, mustDecodeHex(t, pk)) {
+		t.Errorf("derived public key: got %x, want %s", got, pk)
+	}
+	return key
+}
+
+func TestRFC9180Vectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/rfc9180-vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []testVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vectors {
+		v := v
+		name := fmt.Sprintf("mode %d %v %v %v", v.Mode, v.KEM, v.KDF, v.AEAD)
+		t.Run(name, func(t *testing.T) {
+			suite := Suite{v.KEM, v.KDF, v.AEAD}
+			info := mustDecodeHex(t, v.Info)
+			psk, pskID := mustDecodeHex(t, v.PSK), mustDecodeHex(t, v.PSKID)
+
+			skR := deriveKey(t, v.KEM, v.IKMR, v.SKRm, v.PKRm)
+			skE := deriveKey(t, v.KEM, v.IKME, v.SKEm, v.PKEm)
+			var skS *ecdh.PrivateKey
+			var pkS *ecdh.PublicKey
+			if v.Mode == modeAuth || v.Mode == modeAuthPSK {
+				skS = deriveKey(t, v.KEM, v.IKMS, v.SKSm, v.PKSm)
+				pkS = skS.PublicKey()
+			}
+
+			enc, sender, err := setupSender(nil, skE, suite, v.Mode, skR.PublicKey(), info, psk, pskID, skS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(enc, mustDecodeHex(t, v.Enc)) {
+				t.Errorf("enc: got %x, want %s", enc, v.Enc)
+			}
+			receiver, err := setupReceiver(suite, v.Mode, enc, skR, info, psk, pskID, pkS)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, e := range v.Encryptions {
+				aad, pt := mustDecodeHex(t, e.AAD), mustDecodeHex(t, e.Plaintext)
+				ct, err := sender.Seal(aad, pt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(ct, mustDecodeHex(t, e.Ciphertext)) {
+					t.Errorf("ciphertext: got %x, want %s", ct, e.Ciphertext)
+				}
+				got, err := receiver.Open(aad, ct)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, pt) {
+					t.Errorf("plaintext: got %x, want %x", got, pt)
+				}
+			}
+			if v.AEAD == AEAD_ExportOnly {
+				if _, err := sender.Seal(nil, nil); err == nil {
+					t.Error("Seal with AEAD_ExportOnly succeeded")
+				}
+				if _, err := receiver.Open(nil, nil); err == nil {
+					t.Error("Open with AEAD_ExportOnly succeeded")
+				}
+			}
+
+			for _, e := range v.Exports {
+				exporterContext := mustDecodeHex(t, e.Context)
+				got, err := sender.Export(exporterContext, e.L)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, mustDecodeHex(t, e.Value)) {
+					t.Errorf("exported value: got %x, want %s", got, e.Value)
+				}
+				got, err = receiver.Export(exporterContext, e.L)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, mustDecodeHex(t, e.Value)) {
+					t.Errorf("receiver exported value: got %x, want %s", got, e.Value)
+				}
+			}
+		})
+	}
+}
+
+var (
+	testInfo  = []byte("info")
+	testPSK   = []byte("0123456789abcdef0123456789abcdef")
+	testPSKID = []byte("psk id")
+)
+
+// setupModes sets up a Sender and a Receiver in each of the four modes.
+func setupModes(suite Suite, skR, skS *ecdh.PrivateKey) map[string]func() ([]byte, *Sender, *Receiver, error) {
+	pkR, pkS := skR.PublicKey(), skS.PublicKey()
+	return map[string]func() ([]byte, *Sender, *Receiver, error){
+		"base": func() ([]byte, *Sender, *Receiver, error) {
+			enc, s, err := SetupBaseSender(rand.Reader, suite, pkR, testInfo)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			r, err := SetupBaseReceiver(suite, enc, skR, testInfo)
+			return enc, s, r, err
+		},
+		"psk": func() ([]byte, *Sender, *Receiver, error) {
+			enc, s, err := SetupPSKSender(rand.Reader, suite, pkR, testInfo, testPSK, testPSKID)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			r, err := SetupPSKReceiver(suite, enc, skR, testInfo, testPSK, testPSKID)
+			return enc, s, r, err
+		},
+		"auth": func() ([]byte, *Sender, *Receiver, error) {
+			enc, s, err := SetupAuthSender(rand.Reader, suite, pkR, testInfo, skS)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			r, err := SetupAuthReceiver(suite, enc, skR, testInfo, pkS)
+			return enc, s, r, err
+		},
+		"auth-psk": func() ([]byte, *Sender, *Receiver, error) {
+			enc, s, err := SetupAuthPSKSender(rand.Reader, suite, pkR, testInfo, testPSK, testPSKID, skS)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			r, err := SetupAuthPSKReceiver(suite, enc, skR, testInfo, testPSK, testPSKID, pkS)
+			return enc, s, r, err
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	kems := []KEM{DHKEM_P256_HKDF_SHA256, DHKEM_P384_HKDF_SHA384,
+		DHKEM_P521_HKDF_SHA512, DHKEM_X25519_HKDF_SHA256}
+	kdfs := []KDF{KDF_HKDF_SHA256, KDF_HKDF_SHA384, KDF_HKDF_SHA512}
+	aeads := []AEAD{AEAD_AES_128_GCM, AEAD_AES_256_GCM, AEAD_ChaCha20Poly1305}
+	for _, kem := range kems {
+		skR, err := kem.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		skS, err := kem.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, kdf := range kdfs {
+			for _, aead := range aeads {
+				suite := Suite{kem, kdf, aead}
+				for mode, setup := range setupModes(suite, skR, skS) {
+					t.Run(fmt.Sprintf("%v %v %v %s", kem, kdf, aead, mode), func(t *testing.T) {
+						_, sender, receiver, err := setup()
+						if err != nil {
+							t.Fatal(err)
+						}
+						for i := 0; i < 3; i++ {
+							msg := []byte(fmt.Sprintf("message %d", i))
+							ct, err := sender.Seal([]byte("aad"), msg)
+							if err != nil {
+								t.Fatal(err)
+							}
+							if _, err := receiver.Open([]byte("wrong aad"), ct); err == nil {
+								t.Error("Open with the wrong additional data succeeded")
+							}
+							pt, err := receiver.Open([]byte("aad"), ct)
+							if err != nil {
+								t.Fatal(err)
+							}
+							if !bytes.Equal(pt, msg) {
+								t.Errorf("got %q, want %q", pt, msg)
+							}
+						}
+						s, err := sender.Export([]byte("context"), 42)
+						if err != nil {
+							t.Fatal(err)
+						}
+						r, err := receiver.Export([]byte("context"), 42)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if !bytes.Equal(s, r) {
+							t.Error("sender and receiver exported different secrets")
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestMismatchedInputs(t *testing.T) {
+	suite := Suite{DHKEM_X25519_HKDF_SHA256, KDF_HKDF_SHA256, AEAD_AES_128_GCM}
+	curve := suite.KEM.Curve()
+	skR, _ := curve.GenerateKey(rand.Reader)
+	skS, _ := curve.GenerateKey(rand.Reader)
+	other, _ := curve.GenerateKey(rand.Reader)
+	pkR, pkS := skR.PublicKey(), skS.PublicKey()
+
+	tests := []struct {
+		name     string
+		sender   func() ([]byte, *Sender, error)
+		receiver func(enc []byte) (*Receiver, error)
+	}{
+		{"wrong info",
+			func() ([]byte, *Sender, error) { return SetupBaseSender(rand.Reader, suite, pkR, testInfo) },
+			func(enc []byte) (*Receiver, error) { return SetupBaseReceiver(suite, enc, skR, []byte("other")) }},
+		{"wrong recipient",
+			func() ([]byte, *Sender, error) { return SetupBaseSender(rand.Reader, suite, pkR, testInfo) },
+			func(enc []byte) (*Receiver, error) { return SetupBaseReceiver(suite, enc, other, testInfo) }},
+		{"wrong PSK",
+			func() ([]byte, *Sender, error) {
+				return SetupPSKSender(rand.Reader, suite, pkR, testInfo, testPSK, testPSKID)
+			},
+			func(enc []byte) (*Receiver, error) {
+				return SetupPSKReceiver(suite, enc, skR, testInfo, []byte("wrong psk"), testPSKID)
+			}},
+		{"wrong PSK ID",
+			func() ([]byte, *Sender, error) {
+				return SetupPSKSender(rand.Reader, suite, pkR, testInfo, testPSK, testPSKID)
+			},
+			func(enc []byte) (*Receiver, error) {
+				return SetupPSKReceiver(suite, enc, skR, testInfo, testPSK, []byte("wrong id"))
+			}},
+		{"wrong sender",
+			func() ([]byte, *Sender, error) { return SetupAuthSender(rand.Reader, suite, pkR, testInfo, skS) },
+			func(enc []byte) (*Receiver, error) {
+				return SetupAuthReceiver(suite, enc, skR, testInfo, other.PublicKey())
+			}},
+		{"auth to base",
+			func() ([]byte, *Sender, error) { return SetupAuthSender(rand.Reader, suite, pkR, testInfo, skS) },
+			func(enc []byte) (*Receiver, error) { return SetupBaseReceiver(suite, enc, skR, testInfo) }},
+		{"psk to auth-psk",
+			func() ([]byte, *Sender, error) {
+				return SetupPSKSender(rand.Reader, suite, pkR, testInfo, testPSK, testPSKID)
+			},
+			func(enc []byte) (*Receiver, error) {
+				return SetupAuthPSKReceiver(suite, enc, skR, testInfo, testPSK, testPSKID, pkS)
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, sender, err := tt.sender()
+			if err != nil {
+				t.Fatal(err)
+			}
+			receiver, err := tt.receiver(enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ct, err := sender.Seal(nil, []byte("message"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := receiver.Open(nil, ct); err == nil {
+				t.Error("Open succeeded")
+			}
+		})
+	}
+}
+
+func TestInvalidSetup(t *testing.T) {
+	suite := Suite{DHKEM_X25519_HKDF_SHA256, KDF_HKDF_SHA256, AEAD_AES_128_GCM}
+	skR, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	p256Key, _ := ecdh.P256().GenerateKey(rand.Reader)
+	pkR := skR.PublicKey()
+
+	if _, _, err := SetupPSKSender(rand.Reader, suite, pkR, nil, nil, nil); err == nil {
+		t.Error("PSK mode without a PSK succeeded")
+	}
+	if _, _, err := SetupPSKSender(rand.Reader, suite, pkR, nil, testPSK, nil); err == nil {
+		t.Error("PSK mode without a PSK ID succeeded")
+	}
+	if _, _, err := SetupAuthSender(rand.Reader, suite, pkR, nil, nil); err == nil {
+		t.Error("auth mode without a sender key succeeded")
+	}
+	if _, _, err := SetupAuthSender(rand.Reader, suite, pkR, nil, p256Key); err == nil {
+		t.Error("auth mode with a sender key of the wrong curve succeeded")
+	}
+	if _, _, err := SetupBaseSender(rand.Reader, suite, p256Key.PublicKey(), nil); err == nil {
+		t.Error("recipient key of the wrong curve was accepted")
+	}
+	if _, err := SetupBaseReceiver(suite, make([]byte, 31), skR, nil); err == nil {
+		t.Error("invalid encapsulated key was accepted")
+	}
+	for _, s := range []Suite{
+		{0x0021, KDF_HKDF_SHA256, AEAD_AES_128_GCM},
+		{DHKEM_X25519_HKDF_SHA256, 0x0004, AEAD_AES_128_GCM},
+		{DHKEM_X25519_HKDF_SHA256, KDF_HKDF_SHA256, 0x0004},
+	} {
+		if _, _, err := SetupBaseSender(rand.Reader, s, pkR, nil); err == nil {
+			t.Errorf("unsupported suite %v was accepted", s)
+		}
+	}
+
+	_, sender, err := SetupBaseSender(rand.Reader, suite, pkR, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sender.Export(nil, 255*32+1); err == nil {
+		t.Error("overlong Export succeeded")
+	}
+}
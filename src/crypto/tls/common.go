@@ -99,6 +99,9 @@ const (
 	extensionCertificateAuthorities  uint16 = 47
 	extensionSignatureAlgorithmsCert uint16 = 50
 	extensionKeyShare                uint16 = 51
+	extensionQUICTransportParameters uint16 = 57
+	extensionECHOuterExtensions      uint16 = 0xfd00
+	extensionEncryptedClientHello    uint16 = 0xfe0d
 	extensionRenegotiationInfo       uint16 = 0xff01
 )
 
@@ -223,6 +226,23 @@ type ConnectionState struct {
 	// previous session with a session ticket or similar mechanism.
 	DidResume bool
 
+	// EarlyDataAccepted is true if the client sent TLS 1.3 early data
+	// ("0-RTT") and the server accepted it. See Config.EnableEarlyData and
+	// Config.AcceptEarlyData.
+	EarlyDataAccepted bool
+
+	// PreSharedKeyIdentity is the identity of the external TLS 1.3
+	// pre-shared key that authenticated the connection instead of
+	// certificates, if any. See Config.PreSharedKeys and
+	// Config.GetPreSharedKey.
+	PreSharedKeyIdentity []byte
+
+	// ECHAccepted is true if the client offered Encrypted Client Hello and
+	// the server accepted it, in which case ServerName and the rest of the
+	// ClientHello were only visible to the server. See
+	// Config.EncryptedClientHelloConfigList.
+	ECHAccepted bool
+
 	// CipherSuite is the cipher suite negotiated for the connection (e.g.
 	// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_AES_128_GCM_SHA256).
 	CipherSuite uint16
@@ -339,9 +359,11 @@ type ClientSessionState struct {
 	scts               [][]byte              // SCTs presented by the server
 
 	// TLS 1.3 fields.
-	nonce  []byte    // Ticket nonce sent by the server, to derive PSK
-	useBy  time.Time // Expiration of the ticket lifetime as set by the server
-	ageAdd uint32    // Random obfuscation factor for sending the ticket age
+	nonce        []byte    // Ticket nonce sent by the server, to derive PSK
+	useBy        time.Time // Expiration of the ticket lifetime as set by the server
+	ageAdd       uint32    // Random obfuscation factor for sending the ticket age
+	maxEarlyData uint32    // Maximum amount of early data allowed by the server
+	alpn         string    // ALPN protocol negotiated for the session
 }
 
 // ClientSessionCache is a cache of ClientSessionState objects that can be used
@@ -453,6 +475,57 @@ func (c *ClientHelloInfo) Context() context.Context {
 	return c.ctx
 }
 
+// EarlyDataInfo contains information about the early data a client is
+// sending with a resumed session, in order to decide whether to accept it
+// with the Config.AcceptEarlyData callback.
+type EarlyDataInfo struct {
+	// ClientHello is the ClientHello carrying the early data.
+	ClientHello *ClientHelloInfo
+
+	// Random is the random value of the ClientHello. A replay of the client's
+	// first flight, and of the early data in it, carries the same Random.
+	Random []byte
+
+	// TicketAge is the age of the session ticket reported by the client. The
+	// server only accepts early data if it is close to the actual age.
+	TicketAge time.Duration
+}
+
+// A PreSharedKey is an external pre-shared key for TLS 1.3, established out
+// of band between a client and a server. See RFC 8446, Section 2.2.
+//
+// External pre-shared keys are used with SHA-256, as specified by RFC 8446,
+// Section 4.2.11, and therefore only with the cipher suites using SHA-256.
+type PreSharedKey struct {
+	// Identity is the name of the key, which the client sends to the server.
+	// It should not reveal anything about the key.
+	Identity []byte
+
+	// Key is the secret key. It should be at least 128 bits of entropy, and
+	// only shared by one client and one server.
+	Key []byte
+}
+
+// An EncryptedClientHelloKey is a key a server uses to decrypt the
+// ClientHello of clients using Encrypted Client Hello (ECH).
+type EncryptedClientHelloKey struct {
+	// Config is the ECHConfig published for the key, which clients obtain
+	// in an ECHConfigList, typically through DNS. It must be the same bytes
+	// as the published config, which must use one of the KEMs, KDFs and
+	// AEADs implemented by package crypto/hpke.
+	Config []byte
+
+	// PrivateKey is the private key matching the public key in Config, in
+	// the encoding accepted by the NewPrivateKey method of the KEM's
+	// ecdh.Curve: the 32-byte scalar for X25519, and the fixed-length big
+	// endian scalar for the NIST curves.
+	PrivateKey []byte
+
+	// SendAsRetry makes the server send Config to clients whose ECH offer
+	// was rejected, for them to retry with.
+	SendAsRetry bool
+}
+
 // CertificateRequestInfo contains information from a server's
 // CertificateRequest message, which is used to demand a certificate and proof
 // of control from a client.
@@ -664,7 +737,8 @@ type Config struct {
 
 	// SessionTicketsDisabled may be set to true to disable session ticket and
 	// PSK (resumption) support. Note that on clients, session ticket support is
-	// also disabled if ClientSessionCache is nil.
+	// also disabled if ClientSessionCache is nil. External pre-shared keys are
+	// not affected.
 	SessionTicketsDisabled bool
 
 	// SessionTicketKey is used by TLS servers to provide session resumption.
@@ -677,10 +751,135 @@ type Config struct {
 	// terminating connections for the same host, use SetSessionTicketKeys.
 	SessionTicketKey [32]byte
 
+	// WrapSession, if not nil, is called by a server to produce the session
+	// ticket for a SessionState, instead of encrypting it with the session
+	// ticket keys. The ticket is sent to the client, and is the PSK identity
+	// the client offers in TLS 1.3. WrapSession can for example store the
+	// session in a database shared by a fleet of servers, and return its key.
+	//
+	// The ConnectionState describes the connection the session is for, whose
+	// handshake is not complete yet. WrapSession can set SessionState.Extra,
+	// and use Config.EncryptTicket to encrypt the session with the session
+	// ticket keys. If it returns an error, the handshake is aborted.
+	//
+	// WrapSession is usually set along with UnwrapSession.
+	WrapSession func(ConnectionState, *SessionState) ([]byte, error)
+
+	// UnwrapSession, if not nil, is called by a server with the session
+	// tickets or TLS 1.3 PSK identities sent by clients, and returns the
+	// session they refer to, instead of decrypting them with the session
+	// ticket keys. It typically reverses WrapSession, and can use
+	// Config.DecryptTicket for tickets encrypted with the session ticket keys.
+	//
+	// If UnwrapSession returns nil and no error, the session is not resumed,
+	// and in TLS 1.3 the identity can be an external pre-shared key (see
+	// GetPreSharedKey). If it returns an error, the handshake is aborted.
+	// The session is resumed only if it is still valid and compatible with
+	// the connection, but the server can decline to resume it by returning
+	// nil, for example if the application data in Extra is stale.
+	//
+	// The ConnectionState describes the connection being established, whose
+	// handshake is not complete yet.
+	UnwrapSession func(identity []byte, cs ConnectionState) (*SessionState, error)
+
 	// ClientSessionCache is a cache of ClientSessionState entries for TLS
 	// session resumption. It is only used by clients.
 	ClientSessionCache ClientSessionCache
 
+	// EnableEarlyData allows a client to send the data passed to the first
+	// Write as TLS 1.3 early data ("0-RTT"), along with its first flight,
+	// when it resumes a session with a server that allows it. This saves a
+	// round trip before the server receives the data. It only applies if
+	// that Write starts the handshake, rather than Handshake or Read, and
+	// the data is limited to the amount the server allowed in the session
+	// ticket. The rest, or all of it if the server rejects the early data,
+	// is sent after the handshake as usual. ConnectionState.EarlyDataAccepted
+	// reports whether the server accepted it.
+	//
+	// Early data is not protected against replay: an attacker can send it
+	// to the server again, so it should only be enabled for requests that
+	// are safe to process more than once. Early data is not supported for
+	// QUIC connections.
+	EnableEarlyData bool
+
+	// MaxEarlyData is the maximum amount of TLS 1.3 early data, in bytes,
+	// that a server accepts from a client resuming a session. It is
+	// advertised in the session tickets the server sends if AcceptEarlyData
+	// is also set. If zero, the server does not accept early data.
+	MaxEarlyData uint32
+
+	// AcceptEarlyData, if not nil, is called by a server when a client sends
+	// early data with a resumed session that allows it, and decides whether
+	// the early data is accepted. If it returns false, the early data is
+	// discarded and the handshake continues as a normal resumption.
+	//
+	// Early data can be replayed by an attacker, to this server or to any
+	// other server sharing its session ticket keys. The server rejects early
+	// data if the ticket age reported by the client is too far from the
+	// actual one, which limits replays to a short window, and
+	// AcceptEarlyData can detect replays within that window, for example by
+	// recording EarlyDataInfo.Random, or only accept early data for the
+	// client's first use of a ticket.
+	//
+	// When the early data is accepted, the server handshake completes as
+	// soon as the server has sent its first flight, and Read returns the
+	// early data without waiting for the rest of the client's handshake.
+	// Read then checks the client's Finished message when it arrives, and
+	// returns an error if it is invalid.
+	AcceptEarlyData func(*EarlyDataInfo) bool
+
+	// PreSharedKeys are the external TLS 1.3 pre-shared keys a client offers
+	// to the server, in order of preference, after the session it resumes, if
+	// any. If the server selects one, it authenticates both peers instead of
+	// certificates, and ConnectionState.PreSharedKeyIdentity reports its
+	// identity. An ECDHE key exchange is still performed, for forward secrecy.
+	PreSharedKeys []PreSharedKey
+
+	// GetPreSharedKey, if not nil, is called by a server with the PSK
+	// identities offered by a TLS 1.3 client which aren't sessions it can
+	// resume, and returns the external pre-shared key with that identity, or
+	// nil if there is none. If it returns an error, the handshake is aborted.
+	//
+	// When an external pre-shared key is used, it authenticates the client
+	// regardless of ClientAuth, the server doesn't send a certificate, and
+	// it doesn't send session tickets, as the client can use the key again.
+	GetPreSharedKey func(identity []byte) (*PreSharedKey, error)
+
+	// EncryptedClientHelloConfigList is an ECHConfigList, as published in
+	// DNS by a server supporting Encrypted Client Hello (ECH). If not empty,
+	// a client encrypts its ClientHello with the first supported config in
+	// the list, and sends it inside a ClientHello for the config's public
+	// name, so that ServerName and the other parameters of the connection are
+	// only visible to the server. The handshake fails if the list has no
+	// supported config.
+	//
+	// With ECH, the client only offers TLS 1.3, and doesn't send early data.
+	//
+	// If the server rejects ECH, the client completes the handshake with the
+	// public name, authenticating the server's certificate for it, and then
+	// aborts it with an ECHRejectionError, which can contain new configs to
+	// retry with. See also EncryptedClientHelloRejectionVerify.
+	EncryptedClientHelloConfigList []byte
+
+	// EncryptedClientHelloRejectionVerify, if not nil, is called by a client
+	// when the server rejected ECH, to verify the certificate of its public
+	// name instead of the default verification with RootCAs. If it returns
+	// an error, the handshake is aborted with that error rather than an
+	// ECHRejectionError.
+	//
+	// InsecureSkipVerify, VerifyPeerCertificate and VerifyConnection don't
+	// apply to the public name.
+	EncryptedClientHelloRejectionVerify func(ConnectionState) error
+
+	// EncryptedClientHelloKeys are the keys a server uses to accept the
+	// Encrypted Client Hello of clients. A ClientHello that can't be
+	// decrypted with one of the keys is processed as a regular ClientHello,
+	// and the retry configs of the keys are sent to the client.
+	//
+	// The keys of the original Config are used even if GetConfigForClient
+	// returns another Config, which receives the decrypted ClientHello.
+	EncryptedClientHelloKeys []EncryptedClientHelloKey
+
 	// MinVersion contains the minimum TLS version that is acceptable.
 	// If zero, TLS 1.0 is currently taken as the minimum.
 	MinVersion uint16
@@ -777,34 +976,44 @@ func (c *Config) Clone() *Config {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 	return &Config{
-		Rand:                        c.Rand,
-		Time:                        c.Time,
-		Certificates:                c.Certificates,
-		NameToCertificate:           c.NameToCertificate,
-		GetCertificate:              c.GetCertificate,
-		GetClientCertificate:        c.GetClientCertificate,
-		GetConfigForClient:          c.GetConfigForClient,
-		VerifyPeerCertificate:       c.VerifyPeerCertificate,
-		VerifyConnection:            c.VerifyConnection,
-		RootCAs:                     c.RootCAs,
-		NextProtos:                  c.NextProtos,
-		ServerName:                  c.ServerName,
-		ClientAuth:                  c.ClientAuth,
-		ClientCAs:                   c.ClientCAs,
-		InsecureSkipVerify:          c.InsecureSkipVerify,
-		CipherSuites:                c.CipherSuites,
-		PreferServerCipherSuites:    c.PreferServerCipherSuites,
-		SessionTicketsDisabled:      c.SessionTicketsDisabled,
-		SessionTicketKey:            c.SessionTicketKey,
-		ClientSessionCache:          c.ClientSessionCache,
-		MinVersion:                  c.MinVersion,
-		MaxVersion:                  c.MaxVersion,
-		CurvePreferences:            c.CurvePreferences,
-		DynamicRecordSizingDisabled: c.DynamicRecordSizingDisabled,
-		Renegotiation:               c.Renegotiation,
-		KeyLogWriter:                c.KeyLogWriter,
-		sessionTicketKeys:           c.sessionTicketKeys,
-		autoSessionTicketKeys:       c.autoSessionTicketKeys,
+		Rand:                                c.Rand,
+		Time:                                c.Time,
+		Certificates:                        c.Certificates,
+		NameToCertificate:                   c.NameToCertificate,
+		GetCertificate:                      c.GetCertificate,
+		GetClientCertificate:                c.GetClientCertificate,
+		GetConfigForClient:                  c.GetConfigForClient,
+		VerifyPeerCertificate:               c.VerifyPeerCertificate,
+		VerifyConnection:                    c.VerifyConnection,
+		RootCAs:                             c.RootCAs,
+		NextProtos:                          c.NextProtos,
+		ServerName:                          c.ServerName,
+		ClientAuth:                          c.ClientAuth,
+		ClientCAs:                           c.ClientCAs,
+		InsecureSkipVerify:                  c.InsecureSkipVerify,
+		CipherSuites:                        c.CipherSuites,
+		PreferServerCipherSuites:            c.PreferServerCipherSuites,
+		SessionTicketsDisabled:              c.SessionTicketsDisabled,
+		SessionTicketKey:                    c.SessionTicketKey,
+		WrapSession:                         c.WrapSession,
+		UnwrapSession:                       c.UnwrapSession,
+		ClientSessionCache:                  c.ClientSessionCache,
+		EnableEarlyData:                     c.EnableEarlyData,
+		MaxEarlyData:                        c.MaxEarlyData,
+		AcceptEarlyData:                     c.AcceptEarlyData,
+		PreSharedKeys:                       c.PreSharedKeys,
+		GetPreSharedKey:                     c.GetPreSharedKey,
+		EncryptedClientHelloConfigList:      c.EncryptedClientHelloConfigList,
+		EncryptedClientHelloRejectionVerify: c.EncryptedClientHelloRejectionVerify,
+		EncryptedClientHelloKeys:            c.EncryptedClientHelloKeys,
+		MinVersion:                          c.MinVersion,
+		MaxVersion:                          c.MaxVersion,
+		CurvePreferences:                    c.CurvePreferences,
+		DynamicRecordSizingDisabled:         c.DynamicRecordSizingDisabled,
+		Renegotiation:                       c.Renegotiation,
+		KeyLogWriter:                        c.KeyLogWriter,
+		sessionTicketKeys:                   c.sessionTicketKeys,
+		autoSessionTicketKeys:               c.autoSessionTicketKeys,
 	}
 }
 
@@ -1300,6 +1509,7 @@ func (c *Config) BuildNameToCertificate() {
 
 const (
 	keyLogLabelTLS12           = "CLIENT_RANDOM"
+	keyLogLabelClientEarly     = "CLIENT_EARLY_TRAFFIC_SECRET"
 	keyLogLabelClientHandshake = "CLIENT_HANDSHAKE_TRAFFIC_SECRET"
 	keyLogLabelServerHandshake = "SERVER_HANDSHAKE_TRAFFIC_SECRET"
 	keyLogLabelClientTraffic   = "CLIENT_TRAFFIC_SECRET_0"
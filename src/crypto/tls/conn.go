@@ -44,7 +44,9 @@ type Conn struct {
 	// connection so far. If renegotiation is disabled then this is either
 	// zero or one.
 	handshakes       int
-	didResume        bool // whether this connection was a session resumption
+	didResume        bool   // whether this connection was a session resumption
+	pskIdentity      []byte // identity of the external PSK used, if any
+	echAccepted      bool   // whether Encrypted Client Hello was accepted
 	cipherSuite      uint16
 	ocspResponse     []byte   // stapled OCSP response
 	scts             [][]byte // signed certificate timestamps from server
@@ -91,6 +93,19 @@ type Conn struct {
 	// clientProtocol is the negotiated ALPN protocol.
 	clientProtocol string
 
+	// earlyData is the data a client sends as TLS 1.3 early data, taken from
+	// the Write that starts the handshake, and truncated by the handshake to
+	// the amount allowed by the server.
+	earlyData []byte
+	// earlyDataAccepted is true if early data was sent and accepted.
+	earlyDataAccepted bool
+	// acceptedEarlyData is set by a server that accepted early data until it
+	// receives the client's Finished message.
+	acceptedEarlyData *acceptedEarlyData
+	// earlyDataSkip is the number of bytes of early data that a server that
+	// rejected it may still discard.
+	earlyDataSkip int
+
 	// input/output
 	in, out   halfConn
 	rawInput  bytes.Buffer // raw input, starting with a record header
@@ -114,6 +129,10 @@ type Conn struct {
 	// in Conn.Write.
 	activeCall int32
 
+	// quic is non-nil when the Conn is the TLS layer of a QUIC connection.
+	// See QUICConn.
+	quic *quicState
+
 	tmp [16]byte
 }
 
@@ -167,7 +186,8 @@ type halfConn struct {
 	nextCipher interface{} // next encryption state
 	nextMac    hash.Hash   // next MAC algorithm
 
-	trafficSecret []byte // current TLS 1.3 traffic secret
+	level         QUICEncryptionLevel // current QUIC encryption level
+	trafficSecret []byte              // current TLS 1.3 traffic secret
 }
 
 type permanentError struct {
@@ -212,8 +232,9 @@ func (hc *halfConn) changeCipherSpec() error {
 	return nil
 }
 
-func (hc *halfConn) setTrafficSecret(suite *cipherSuiteTLS13, secret []byte) {
+func (hc *halfConn) setTrafficSecret(suite *cipherSuiteTLS13, level QUICEncryptionLevel, secret []byte) {
 	hc.trafficSecret = secret
+	hc.level = level
 	key, iv := suite.trafficKey(secret)
 	hc.cipher = suite.aead(key, iv)
 	for i := range hc.seq {
@@ -659,6 +680,9 @@ func (c *Conn) readRecordOrCCS(expectChangeCipherSpec bool) error {
 	record := c.rawInput.Next(recordHeaderLen + n)
 	data, typ, err := c.in.decrypt(record)
 	if err != nil {
+		if c.earlyDataSkip > 0 && recordType(record[0]) == recordTypeApplicationData {
+			return c.skipEarlyData(n, expectChangeCipherSpec)
+		}
 		return c.in.setErrorLocked(c.sendAlert(err.(alert)))
 	}
 	if len(data) > maxPlaintext {
@@ -667,9 +691,17 @@ func (c *Conn) readRecordOrCCS(expectChangeCipherSpec bool) error {
 
 	// Application Data messages are always protected.
 	if c.in.cipher == nil && typ == recordTypeApplicationData {
+		if c.earlyDataSkip > 0 {
+			return c.skipEarlyData(n, expectChangeCipherSpec)
+		}
 		return c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
 	}
 
+	// Once a record can be read, the client has moved past its early data.
+	if typ != recordTypeChangeCipherSpec {
+		c.earlyDataSkip = 0
+	}
+
 	if typ != recordTypeAlert && typ != recordTypeChangeCipherSpec && len(data) > 0 {
 		// This is a state-advancing message: reset the retry count.
 		c.retryCount = 0
@@ -731,6 +763,14 @@ func (c *Conn) readRecordOrCCS(expectChangeCipherSpec bool) error {
 		if !handshakeComplete || expectChangeCipherSpec {
 			return c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
 		}
+		if a := c.acceptedEarlyData; a != nil {
+			// Application data must not follow EndOfEarlyData before the
+			// client's Finished, and early data is limited in size.
+			if c.in.level != QUICEncryptionLevelEarly || len(data) > a.left {
+				return c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
+			}
+			a.left -= len(data)
+		}
 		// Some OpenSSL servers send empty records in order to randomize the
 		// CBC IV. Ignore a limited number of empty records.
 		if len(data) == 0 {
@@ -751,6 +791,24 @@ func (c *Conn) readRecordOrCCS(expectChangeCipherSpec bool) error {
 	return nil
 }
 
+// skipEarlyData recurses into readRecordOrCCS to drop a record of n bytes
+// carrying early data that the server rejected, which can't be decrypted with
+// the handshake traffic keys or was sent before a HelloRetryRequest. See RFC
+// 8446, Section 4.2.10.
+func (c *Conn) skipEarlyData(n int, expectChangeCipherSpec bool) error {
+	// The record carries the content type and a 16-byte AEAD tag along with
+	// the early data.
+	if n -= 1 + 16; n < 1 {
+		n = 1
+	}
+	c.earlyDataSkip -= n
+	if c.earlyDataSkip < 0 {
+		c.sendAlert(alertUnexpectedMessage)
+		return c.in.setErrorLocked(errors.New("tls: too much rejected early data"))
+	}
+	return c.readRecordOrCCS(expectChangeCipherSpec)
+}
+
 // retryReadRecord recurses into readRecordOrCCS to drop a non-advancing record, like
 // a warning alert, empty application_data, or a change_cipher_spec in TLS 1.3.
 func (c *Conn) retryReadRecord(expectChangeCipherSpec bool) error {
@@ -802,6 +860,12 @@ func (c *Conn) readFromUntil(r io.Reader, n int) error {
 
 // sendAlert sends a TLS alert message.
 func (c *Conn) sendAlertLocked(err alert) error {
+	if c.quic != nil {
+		// QUIC transports alerts in CONNECTION_CLOSE frames, so
+		// record the alert for the QUICConn to report instead.
+		return c.out.setErrorLocked(&net.OpError{Op: "local error", Err: err})
+	}
+
 	switch err {
 	case alertNoRenegotiation, alertCloseNotify:
 		c.tmp[0] = alertLevelWarning
@@ -936,6 +1000,19 @@ var outBufPool = sync.Pool{
 // writeRecordLocked writes a TLS record with the given type and payload to the
 // connection and updates the record layer state.
 func (c *Conn) writeRecordLocked(typ recordType, data []byte) (int, error) {
+	if c.quic != nil {
+		if typ != recordTypeHandshake {
+			return 0, errors.New("tls: internal error: sending non-handshake message to QUIC transport")
+		}
+		c.quicWriteCryptoData(c.out.level, data)
+		if !c.buffering {
+			if _, err := c.flush(); err != nil {
+				return 0, err
+			}
+		}
+		return len(data), nil
+	}
+
 	outBufPtr := outBufPool.Get().(*[]byte)
 	outBuf := *outBufPtr
 	defer func() {
@@ -958,6 +1035,10 @@ func (c *Conn) writeRecordLocked(typ recordType, data []byte) (int, error) {
 		_, outBuf = sliceForAppend(outBuf[:0], recordHeaderLen)
 		outBuf[0] = byte(typ)
 		vers := c.vers
+		if vers == 0 && c.out.version == VersionTLS13 {
+			// Early data is sent before the server selects the version.
+			vers = VersionTLS13
+		}
 		if vers == 0 {
 			// Some TLS servers fail if the record version is
 			// greater than TLS 1.0 for the initial ClientHello.
@@ -984,7 +1065,9 @@ func (c *Conn) writeRecordLocked(typ recordType, data []byte) (int, error) {
 		data = data[m:]
 	}
 
-	if typ == recordTypeChangeCipherSpec && c.vers != VersionTLS13 {
+	// The version is not negotiated yet when a TLS 1.3 client sends early
+	// data, but the ChangeCipherSpec it sends is a dummy anyway.
+	if typ == recordTypeChangeCipherSpec && c.vers != VersionTLS13 && c.out.version != VersionTLS13 {
 		if err := c.out.changeCipherSpec(); err != nil {
 			return n, c.sendAlertLocked(err.(alert))
 		}
@@ -1002,13 +1085,24 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (int, error) {
 	return c.writeRecordLocked(typ, data)
 }
 
+// readHandshakeBytes reads handshake data until c.hand contains at least n bytes.
+func (c *Conn) readHandshakeBytes(n int) error {
+	if c.quic != nil {
+		return c.quicReadHandshakeBytes(n)
+	}
+	for c.hand.Len() < n {
+		if err := c.readRecord(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // readHandshake reads the next handshake message from
 // the record layer.
 func (c *Conn) readHandshake() (interface{}, error) {
-	for c.hand.Len() < 4 {
-		if err := c.readRecord(); err != nil {
-			return nil, err
-		}
+	if err := c.readHandshakeBytes(4); err != nil {
+		return nil, err
 	}
 
 	data := c.hand.Bytes()
@@ -1017,10 +1111,8 @@ func (c *Conn) readHandshake() (interface{}, error) {
 		c.sendAlertLocked(alertInternalError)
 		return nil, c.in.setErrorLocked(fmt.Errorf("tls: handshake message of length %d bytes exceeds maximum of %d bytes", n, maxHandshake))
 	}
-	for c.hand.Len() < 4+n {
-		if err := c.readRecord(); err != nil {
-			return nil, err
-		}
+	if err := c.readHandshakeBytes(4 + n); err != nil {
+		return nil, err
 	}
 	data = c.hand.Next(4 + n)
 	var m handshakeMessage
@@ -1109,6 +1201,29 @@ func (c *Conn) Write(b []byte) (int, error) {
 	}
 	defer atomic.AddInt32(&c.activeCall, -2)
 
+	// If this Write starts a client handshake, offer b as early data.
+	var early int
+	if c.isClient && c.config.EnableEarlyData && len(b) > 0 {
+		c.handshakeMutex.Lock()
+		claimed := c.handshakes == 0 && c.handshakeErr == nil && c.earlyData == nil
+		if claimed {
+			c.earlyData = b
+		}
+		c.handshakeMutex.Unlock()
+		if claimed {
+			if err := c.Handshake(); err != nil {
+				return 0, err
+			}
+			if c.earlyDataAccepted {
+				early = len(c.earlyData)
+				b = b[early:]
+			}
+			if len(b) == 0 {
+				return early, nil
+			}
+		}
+	}
+
 	if err := c.Handshake(); err != nil {
 		return 0, err
 	}
@@ -1149,7 +1264,7 @@ func (c *Conn) Write(b []byte) (int, error) {
 	}
 
 	n, err := c.writeRecordLocked(recordTypeApplicationData, b)
-	return n + m, c.out.setErrorLocked(err)
+	return early + n + m, c.out.setErrorLocked(err)
 }
 
 // handleRenegotiation processes a HelloRequest handshake message.
@@ -1215,6 +1330,10 @@ func (c *Conn) handlePostHandshakeMessage() error {
 		return c.in.setErrorLocked(errors.New("tls: too many non-advancing records"))
 	}
 
+	if c.acceptedEarlyData != nil {
+		return c.handleEndOfEarlyData(msg)
+	}
+
 	switch msg := msg.(type) {
 	case *newSessionTicketMsgTLS13:
 		return c.handleNewSessionTicket(msg)
@@ -1227,13 +1346,19 @@ func (c *Conn) handlePostHandshakeMessage() error {
 }
 
 func (c *Conn) handleKeyUpdate(keyUpdate *keyUpdateMsg) error {
+	if c.quic != nil {
+		// QUIC has its own key update mechanism. See RFC 9001, Section 6.
+		c.sendAlert(alertUnexpectedMessage)
+		return c.in.setErrorLocked(errors.New("tls: received unexpected key update message"))
+	}
+
 	cipherSuite := cipherSuiteTLS13ByID(c.cipherSuite)
 	if cipherSuite == nil {
 		return c.in.setErrorLocked(c.sendAlert(alertInternalError))
 	}
 
 	newSecret := cipherSuite.nextTrafficSecret(c.in.trafficSecret)
-	c.in.setTrafficSecret(cipherSuite, newSecret)
+	c.in.setTrafficSecret(cipherSuite, QUICEncryptionLevelApplication, newSecret)
 
 	if keyUpdate.updateRequested {
 		c.out.Lock()
@@ -1248,7 +1373,7 @@ func (c *Conn) handleKeyUpdate(keyUpdate *keyUpdateMsg) error {
 		}
 
 		newSecret := cipherSuite.nextTrafficSecret(c.out.trafficSecret)
-		c.out.setTrafficSecret(cipherSuite, newSecret)
+		c.out.setTrafficSecret(cipherSuite, QUICEncryptionLevelApplication, newSecret)
 	}
 
 	return nil
@@ -1402,12 +1527,15 @@ func (c *Conn) handshakeContext(ctx context.Context) (ret error) {
 	// this cancellation. In the former case, we need to close the connection.
 	defer cancel()
 
-	// Start the "interrupter" goroutine, if this context might be canceled.
-	// (The background context cannot).
-	//
-	// The interrupter goroutine waits for the input context to be done and
-	// closes the connection if this happens before the function returns.
-	if ctx.Done() != nil {
+	if c.quic != nil {
+		c.quic.cancelc = handshakeCtx.Done()
+		c.quic.cancel = cancel
+	} else if ctx.Done() != nil {
+		// Start the "interrupter" goroutine, if this context might be canceled.
+		// (The background context cannot).
+		//
+		// The interrupter goroutine waits for the input context to be done and
+		// closes the connection if this happens before the function returns.
 		done := make(chan struct{})
 		interruptRes := make(chan error, 1)
 		defer func() {
@@ -1429,6 +1557,13 @@ func (c *Conn) handshakeContext(ctx context.Context) (ret error) {
 		}()
 	}
 
+	if c.quic != nil {
+		defer func() {
+			close(c.quic.blockedc)
+			close(c.quic.signalc)
+		}()
+	}
+
 	c.handshakeMutex.Lock()
 	defer c.handshakeMutex.Unlock()
 
@@ -1455,6 +1590,20 @@ func (c *Conn) handshakeContext(ctx context.Context) (ret error) {
 		c.handshakeErr = errors.New("tls: internal error: handshake should have had a result")
 	}
 
+	if c.quic != nil {
+		if c.handshakeErr == nil {
+			c.quicHandshakeComplete()
+		} else {
+			// Report the alert recorded by sendAlertLocked, if any.
+			var a alert
+			if errors.As(c.out.err, &a) {
+				c.handshakeErr = &quicAlertError{err: c.handshakeErr, alert: AlertError(a)}
+			} else {
+				c.handshakeErr = quicError(c.handshakeErr)
+			}
+		}
+	}
+
 	return c.handshakeErr
 }
 
@@ -1471,6 +1620,9 @@ func (c *Conn) connectionStateLocked() ConnectionState {
 	state.Version = c.vers
 	state.NegotiatedProtocol = c.clientProtocol
 	state.DidResume = c.didResume
+	state.EarlyDataAccepted = c.earlyDataAccepted
+	state.PreSharedKeyIdentity = c.pskIdentity
+	state.ECHAccepted = c.echAccepted
 	state.NegotiatedProtocolIsMutual = true
 	state.ServerName = c.serverName
 	state.CipherSuite = c.cipherSuite
@@ -0,0 +1,693 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"crypto/hpke"
+	"errors"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// This file implements Encrypted Client Hello (ECH), as specified in
+// draft-ietf-tls-esni-18. The client sends its real ClientHello, the
+// ClientHelloInner, encrypted with HPKE in an extension of a ClientHelloOuter
+// addressed to the public name of the server. A server that can decrypt it
+// proceeds with the ClientHelloInner, and confirms it in its ServerHello.
+
+const (
+	echVersion = 0xfe0d
+
+	// ECHClientHello.type values.
+	echClientHelloOuter = 0
+	echClientHelloInner = 1
+
+	echConfirmationLength = 8
+
+	echAcceptConfirmationLabel    = "ech accept confirmation"
+	echHRRAcceptConfirmationLabel = "hrr ech accept confirmation"
+)
+
+// echInnerExtension is the encrypted_client_hello extension of a
+// ClientHelloInner.
+var echInnerExtension = []byte{echClientHelloInner}
+
+// ECHRejectionError is returned by a client handshake when the server
+// rejected Encrypted Client Hello. The handshake was completed with the
+// server's public name, and then aborted.
+type ECHRejectionError struct {
+	// RetryConfigList is the ECHConfigList sent by the server for the client
+	// to retry with, if any. It was authenticated by the certificate of the
+	// server's public name.
+	RetryConfigList []byte
+}
+
+func (e *ECHRejectionError) Error() string {
+	return "tls: server rejected ECH"
+}
+
+type echCipherSuite struct {
+	kdfID, aeadID uint16
+}
+
+// An echConfig is a parsed ECHConfig. See draft-ietf-tls-esni-18, Section 4.
+type echConfig struct {
+	raw []byte
+
+	configID      uint8
+	kemID         uint16
+	publicKey     []byte
+	cipherSuites  []echCipherSuite
+	maxNameLength uint8
+	publicName    string
+
+	// unsupported is set if the config has a version or a mandatory
+	// extension that is not implemented.
+	unsupported bool
+}
+
+// readECHConfig reads an ECHConfig from s.
+func readECHConfig(s *cryptobyte.String, config *echConfig) bool {
+	var version uint16
+	var contents cryptobyte.String
+	raw := *s
+	if !s.ReadUint16(&version) || !s.ReadUint16LengthPrefixed(&contents) {
+		return false
+	}
+	config.raw = raw[:len(raw)-len(*s)]
+	if version != echVersion {
+		config.unsupported = true
+		return true
+	}
+
+	var publicName, extensions, suites cryptobyte.String
+	if !contents.ReadUint8(&config.configID) ||
+		!contents.ReadUint16(&config.kemID) ||
+		!readUint16LengthPrefixed(&contents, &config.publicKey) ||
+		len(config.publicKey) == 0 ||
+		!contents.ReadUint16LengthPrefixed(&suites) || suites.Empty() {
+		return false
+	}
+	for !suites.Empty() {
+		var suite echCipherSuite
+		if !suites.ReadUint16(&suite.kdfID) || !suites.ReadUint16(&suite.aeadID) {
+			return false
+		}
+		config.cipherSuites = append(config.cipherSuites, suite)
+	}
+	if !contents.ReadUint8(&config.maxNameLength) ||
+		!contents.ReadUint8LengthPrefixed(&publicName) || publicName.Empty() ||
+		!contents.ReadUint16LengthPrefixed(&extensions) || !contents.Empty() {
+		return false
+	}
+	config.publicName = string(publicName)
+	for !extensions.Empty() {
+		var extType uint16
+		var extData cryptobyte.String
+		if !extensions.ReadUint16(&extType) || !extensions.ReadUint16LengthPrefixed(&extData) {
+			return false
+		}
+		// No extensions are implemented, so the config can't be used if one
+		// of them is mandatory. See draft-ietf-tls-esni-18, Section 4.2.
+		if extType&0x8000 != 0 {
+			config.unsupported = true
+		}
+	}
+	return true
+}
+
+// parseECHConfigList parses an ECHConfigList.
+func parseECHConfigList(data []byte) ([]echConfig, error) {
+	s := cryptobyte.String(data)
+	var list cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&list) || list.Empty() || !s.Empty() {
+		return nil, errors.New("tls: invalid ECHConfigList")
+	}
+	var configs []echConfig
+	for !list.Empty() {
+		var config echConfig
+		if !readECHConfig(&list, &config) {
+			return nil, errors.New("tls: invalid ECHConfigList")
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// parseECHConfig parses a single ECHConfig.
+func parseECHConfig(data []byte) (*echConfig, error) {
+	s := cryptobyte.String(data)
+	config := new(echConfig)
+	if !readECHConfig(&s, config) || !s.Empty() {
+		return nil, errors.New("tls: invalid ECHConfig")
+	}
+	return config, nil
+}
+
+// cipherSuite returns the first cipher suite of the config that is
+// implemented, in the order of the config.
+func (config *echConfig) cipherSuite() (echCipherSuite, bool) {
+	for _, suite := range config.cipherSuites {
+		aead := hpke.AEAD(suite.aeadID)
+		if hpke.KDF(suite.kdfID).Supported() && aead.Supported() && aead != hpke.AEAD_ExportOnly {
+			return suite, true
+		}
+	}
+	return echCipherSuite{}, false
+}
+
+// hpkeSuite returns the HPKE suite of the config's KEM and suite.
+func (config *echConfig) hpkeSuite(suite echCipherSuite) hpke.Suite {
+	return hpke.Suite{
+		KEM:  hpke.KEM(config.kemID),
+		KDF:  hpke.KDF(suite.kdfID),
+		AEAD: hpke.AEAD(suite.aeadID),
+	}
+}
+
+func (config *echConfig) supportsCipherSuite(suite echCipherSuite) bool {
+	for _, s := range config.cipherSuites {
+		if s == suite {
+			return true
+		}
+	}
+	return false
+}
+
+// usable reports whether a client can use the config.
+func (config *echConfig) usable() bool {
+	if config.unsupported || !hpke.KEM(config.kemID).Supported() {
+		return false
+	}
+	if _, ok := config.cipherSuite(); !ok {
+		return false
+	}
+	return validECHPublicName(config.publicName)
+}
+
+// validECHPublicName reports whether name is a DNS name that can be sent as
+// the server name of a ClientHelloOuter. See draft-ietf-tls-esni-18, Section
+// 4.
+func validECHPublicName(name string) bool {
+	if len(name) == 0 || len(name) > 253 {
+		return false
+	}
+	labels := strings.Split(name, ".")
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 ||
+			label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range []byte(label) {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+				'0' <= c && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	// The last label can't be numeric, to exclude IPv4 addresses.
+	last := labels[len(labels)-1]
+	if strings.Trim(last, "0123456789") == "" ||
+		strings.HasPrefix(last, "0x") || strings.HasPrefix(last, "0X") {
+		return false
+	}
+	return true
+}
+
+// echInfo returns the HPKE info parameter for a config.
+func echInfo(config *echConfig) []byte {
+	info := make([]byte, 0, len("tls ech")+1+len(config.raw))
+	info = append(info, "tls ech"...)
+	info = append(info, 0)
+	return append(info, config.raw...)
+}
+
+// echClientContext is the state of a client offering ECH.
+type echClientContext struct {
+	config          *echConfig
+	suite           echCipherSuite
+	encapsulatedKey []byte
+	sender          *hpke.Sender
+	innerHello      *clientHelloMsg
+	innerTranscript hash.Hash
+	outerRandom     []byte
+}
+
+// newECHClientContext selects a config from the ECHConfigList in the Config
+// and sets up the HPKE context to encrypt ClientHelloInner messages with.
+func (c *Conn) newECHClientContext() (*echClientContext, error) {
+	configs, err := parseECHConfigList(c.config.EncryptedClientHelloConfigList)
+	if err != nil {
+		return nil, err
+	}
+	for i := range configs {
+		config := &configs[i]
+		if !config.usable() {
+			continue
+		}
+		suite, _ := config.cipherSuite()
+		hpkeSuite := config.hpkeSuite(suite)
+		pub, err := hpkeSuite.KEM.Curve().NewPublicKey(config.publicKey)
+		if err != nil {
+			return nil, errors.New("tls: invalid ECH config public key")
+		}
+		enc, sender, err := hpke.SetupBaseSender(c.config.rand(), hpkeSuite, pub, echInfo(config))
+		if err != nil {
+			return nil, err
+		}
+		return &echClientContext{
+			config:          config,
+			suite:           suite,
+			encapsulatedKey: enc,
+			sender:          sender,
+		}, nil
+	}
+	return nil, errors.New("tls: no supported ECH config in EncryptedClientHelloConfigList")
+}
+
+// marshalOuterECHExtension returns the encrypted_client_hello extension of
+// a ClientHelloOuter.
+func marshalOuterECHExtension(suite echCipherSuite, configID uint8, enc, payload []byte) []byte {
+	var b cryptobyte.Builder
+	b.AddUint8(echClientHelloOuter)
+	b.AddUint16(suite.kdfID)
+	b.AddUint16(suite.aeadID)
+	b.AddUint8(configID)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(enc)
+	})
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(payload)
+	})
+	return b.BytesOrPanic()
+}
+
+// encodeInnerClientHello returns the EncodedClientHelloInner for inner,
+// which omits the legacy_session_id, and is padded to hide the length of the
+// server name. See draft-ietf-tls-esni-18, Sections 5.1 and 6.1.3.
+func encodeInnerClientHello(inner *clientHelloMsg, maxNameLength int) []byte {
+	hello := *inner
+	hello.raw = nil
+	hello.sessionId = nil
+	encoded := hello.marshal()[4:] // without the handshake message header
+
+	var padding int
+	if inner.serverName != "" {
+		if n := maxNameLength - len(inner.serverName); n > 0 {
+			padding = n
+		}
+	} else {
+		padding = maxNameLength + 9
+	}
+	padding += 31 - ((len(encoded) + padding - 1) % 32)
+	return append(encoded, make([]byte, padding)...)
+}
+
+// sealInnerHello encrypts ech.innerHello in the encrypted_client_hello
+// extension of outer. The encapsulated key is only sent with the first
+// ClientHelloOuter, as a second one after a HelloRetryRequest uses the same
+// HPKE context. See draft-ietf-tls-esni-18, Sections 6.1.1 and 6.1.5.
+func (ech *echClientContext) sealInnerHello(outer *clientHelloMsg, first bool) error {
+	encoded := encodeInnerClientHello(ech.innerHello, int(ech.config.maxNameLength))
+	var enc []byte
+	if first {
+		enc = ech.encapsulatedKey
+	}
+
+	// The additional data is the ClientHelloOuter with a zeroed payload.
+	const aeadOverhead = 16 // the tag size of all supported AEADs
+	outer.encryptedClientHello = marshalOuterECHExtension(ech.suite, ech.config.configID,
+		enc, make([]byte, len(encoded)+aeadOverhead))
+	outer.raw = nil
+	aad := outer.marshal()[4:]
+
+	payload, err := ech.sender.Seal(aad, encoded)
+	if err != nil {
+		return err
+	}
+	if len(payload) != len(encoded)+aeadOverhead {
+		return errors.New("tls: internal error: unexpected ECH payload length")
+	}
+	outer.encryptedClientHello = marshalOuterECHExtension(ech.suite, ech.config.configID,
+		enc, payload)
+	outer.raw = nil
+	return nil
+}
+
+// makeOuterHello returns a ClientHelloOuter for ech.innerHello, which offers
+// the same parameters, but to the public name of the server, and without
+// the PSKs. first is false for the second ClientHelloOuter after a
+// HelloRetryRequest. See draft-ietf-tls-esni-18, Section 6.1.
+func (ech *echClientContext) makeOuterHello(first bool) (*clientHelloMsg, error) {
+	outer := *ech.innerHello
+	outer.raw = nil
+	outer.random = ech.outerRandom
+	outer.serverName = ech.config.publicName
+	outer.pskIdentities = nil
+	outer.pskBinders = nil
+	outer.earlyData = false
+	if err := ech.sealInnerHello(&outer, first); err != nil {
+		return nil, err
+	}
+	return &outer, nil
+}
+
+// echAcceptConfirmation returns the ECH acceptance confirmation for a
+// ClientHelloInner with the random innerRandom, followed by the messages in
+// transcript and then msg, with the confirmation bytes zeroed. See
+// draft-ietf-tls-esni-18, Section 7.2.
+func echAcceptConfirmation(suite *cipherSuiteTLS13, innerRandom []byte, label string, transcript hash.Hash, msg []byte) []byte {
+	transcript.Write(msg)
+	return suite.expandLabel(suite.extract(innerRandom, nil), label,
+		transcript.Sum(nil), echConfirmationLength)
+}
+
+// serverHelloWithoutConfirmation returns the ServerHello or HelloRetryRequest
+// m with its ECH acceptance confirmation zeroed.
+func serverHelloWithoutConfirmation(m *serverHelloMsg, hrr bool) []byte {
+	sh := *m
+	sh.raw = nil
+	if hrr {
+		sh.encryptedClientHello = make([]byte, echConfirmationLength)
+	} else {
+		sh.random = append([]byte(nil), m.random[:32-echConfirmationLength]...)
+		sh.random = append(sh.random, make([]byte, echConfirmationLength)...)
+	}
+	return sh.marshal()
+}
+
+// echServerContext is the state of a server that received a ClientHelloOuter.
+// If ECH was rejected, only retryConfigs is set.
+type echServerContext struct {
+	receiver *hpke.Receiver
+	configID uint8
+	suite    echCipherSuite
+
+	retryConfigs []byte // the ECHConfigList sent if ECH is rejected
+}
+
+// parseOuterECHExtension parses the encrypted_client_hello extension of a
+// ClientHelloOuter.
+func parseOuterECHExtension(data []byte) (suite echCipherSuite, configID uint8, enc, payload []byte, ok bool) {
+	s := cryptobyte.String(data)
+	var typ uint8
+	if !s.ReadUint8(&typ) || typ != echClientHelloOuter ||
+		!s.ReadUint16(&suite.kdfID) || !s.ReadUint16(&suite.aeadID) ||
+		!s.ReadUint8(&configID) ||
+		!readUint16LengthPrefixed(&s, &enc) ||
+		!readUint16LengthPrefixed(&s, &payload) || len(payload) == 0 ||
+		!s.Empty() {
+		return echCipherSuite{}, 0, nil, nil, false
+	}
+	return suite, configID, enc, payload, true
+}
+
+// rawExtension is an extension of a marshaled ClientHello.
+type rawExtension struct {
+	typ  uint16
+	data []byte
+}
+
+// clientHelloExtensions returns the extensions of the marshaled ClientHello
+// raw, in order, with their data aliasing raw.
+func clientHelloExtensions(raw []byte) ([]rawExtension, bool) {
+	s := cryptobyte.String(raw)
+	var ignored, extensions cryptobyte.String
+	if !s.Skip(4+2+32) || // header, legacy_version and random
+		!s.ReadUint8LengthPrefixed(&ignored) ||
+		!s.ReadUint16LengthPrefixed(&ignored) ||
+		!s.ReadUint8LengthPrefixed(&ignored) {
+		return nil, false
+	}
+	if s.Empty() {
+		return nil, true
+	}
+	if !s.ReadUint16LengthPrefixed(&extensions) || !s.Empty() {
+		return nil, false
+	}
+	var exts []rawExtension
+	for !extensions.Empty() {
+		var ext rawExtension
+		if !extensions.ReadUint16(&ext.typ) ||
+			!readUint16LengthPrefixed(&extensions, &ext.data) {
+			return nil, false
+		}
+		exts = append(exts, ext)
+	}
+	return exts, true
+}
+
+// echOuterAAD returns the additional data of the ECH payload of outer, which
+// is outer without its handshake message header and with the payload zeroed.
+func echOuterAAD(outer *clientHelloMsg, payloadLen int) ([]byte, bool) {
+	raw := append([]byte(nil), outer.marshal()...)
+	exts, ok := clientHelloExtensions(raw)
+	if !ok {
+		return nil, false
+	}
+	for _, ext := range exts {
+		if ext.typ != extensionEncryptedClientHello {
+			continue
+		}
+		if len(ext.data) < payloadLen {
+			return nil, false
+		}
+		payload := ext.data[len(ext.data)-payloadLen:]
+		for i := range payload {
+			payload[i] = 0
+		}
+		return raw[4:], true
+	}
+	return nil, false
+}
+
+var errInvalidInnerHello = errors.New("tls: invalid ECH ClientHelloInner")
+
+// decodeInnerClientHello reconstructs the ClientHelloInner from the
+// EncodedClientHelloInner encoded, decrypted from outer, expanding the
+// ech_outer_extensions extension. See draft-ietf-tls-esni-18, Section 5.1.
+func decodeInnerClientHello(outer *clientHelloMsg, encoded []byte) (*clientHelloMsg, error) {
+	s := cryptobyte.String(encoded)
+	var vers uint16
+	var random []byte
+	var sessionID, cipherSuites, compressionMethods, extensions cryptobyte.String
+	if !s.ReadUint16(&vers) || !s.ReadBytes(&random, 32) ||
+		!s.ReadUint8LengthPrefixed(&sessionID) || !sessionID.Empty() ||
+		!s.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!s.ReadUint8LengthPrefixed(&compressionMethods) ||
+		!s.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errInvalidInnerHello
+	}
+	for _, b := range s {
+		if b != 0 {
+			return nil, errInvalidInnerHello
+		}
+	}
+
+	outerExtensions, ok := clientHelloExtensions(outer.marshal())
+	if !ok {
+		return nil, errInvalidInnerHello
+	}
+
+	var b cryptobyte.Builder
+	b.AddUint8(typeClientHello)
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16(vers)
+		b.AddBytes(random)
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(outer.sessionId)
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(cipherSuites)
+		})
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(compressionMethods)
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			next := 0 // referenced outer extensions must be in order
+			for !extensions.Empty() {
+				var extType uint16
+				var extData cryptobyte.String
+				if !extensions.ReadUint16(&extType) ||
+					!extensions.ReadUint16LengthPrefixed(&extData) {
+					b.SetError(errInvalidInnerHello)
+					return
+				}
+				if extType != extensionECHOuterExtensions {
+					b.AddUint16(extType)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddBytes(extData)
+					})
+					continue
+				}
+				var types cryptobyte.String
+				if !extData.ReadUint8LengthPrefixed(&types) || types.Empty() ||
+					!extData.Empty() {
+					b.SetError(errInvalidInnerHello)
+					return
+				}
+				for !types.Empty() {
+					var typ uint16
+					if !types.ReadUint16(&typ) || typ == extensionEncryptedClientHello {
+						b.SetError(errInvalidInnerHello)
+						return
+					}
+					for next < len(outerExtensions) && outerExtensions[next].typ != typ {
+						next++
+					}
+					if next == len(outerExtensions) {
+						b.SetError(errInvalidInnerHello)
+						return
+					}
+					b.AddUint16(typ)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddBytes(outerExtensions[next].data)
+					})
+					next++
+				}
+			}
+		})
+	})
+	raw, err := b.Bytes()
+	if err != nil {
+		return nil, errInvalidInnerHello
+	}
+
+	inner := new(clientHelloMsg)
+	if !inner.unmarshal(raw) {
+		return nil, errInvalidInnerHello
+	}
+	if len(inner.encryptedClientHello) != 1 || inner.encryptedClientHello[0] != echClientHelloInner {
+		return nil, errInvalidInnerHello
+	}
+	// ECH requires TLS 1.3. See draft-ietf-tls-esni-18, Section 7.1.
+	for _, v := range inner.supportedVersions {
+		if v < VersionTLS13 {
+			return nil, errInvalidInnerHello
+		}
+	}
+	if len(inner.supportedVersions) == 0 {
+		return nil, errInvalidInnerHello
+	}
+	return inner, nil
+}
+
+// acceptECH attempts to decrypt the ClientHelloInner in the ClientHelloOuter
+// outer with the EncryptedClientHelloKeys in the Config. It returns a nil
+// ClientHelloInner if ECH is not used or is rejected, and a nil context if
+// ECH is not used.
+func (c *Conn) acceptECH(outer *clientHelloMsg) (*clientHelloMsg, *echServerContext, error) {
+	if len(outer.encryptedClientHello) == 0 || len(c.config.EncryptedClientHelloKeys) == 0 {
+		return nil, nil, nil
+	}
+	// A ClientHelloInner sent in the clear is meant for a backend server
+	// of a split mode deployment, which is not supported.
+	if outer.encryptedClientHello[0] == echClientHelloInner {
+		return nil, nil, nil
+	}
+	suite, configID, enc, payload, ok := parseOuterECHExtension(outer.encryptedClientHello)
+	if !ok {
+		c.sendAlert(alertDecodeError)
+		return nil, nil, errors.New("tls: invalid ECH extension")
+	}
+	aad, ok := echOuterAAD(outer, len(payload))
+	if !ok {
+		c.sendAlert(alertDecodeError)
+		return nil, nil, errors.New("tls: invalid ECH extension")
+	}
+
+	for _, key := range c.config.EncryptedClientHelloKeys {
+		config, err := parseECHConfig(key.Config)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return nil, nil, errors.New("tls: invalid EncryptedClientHelloKeys Config: " + err.Error())
+		}
+		if config.unsupported || config.configID != configID || !config.supportsCipherSuite(suite) {
+			continue
+		}
+		hpkeSuite := config.hpkeSuite(suite)
+		if !hpkeSuite.KEM.Supported() {
+			continue
+		}
+		priv, err := hpkeSuite.KEM.Curve().NewPrivateKey(key.PrivateKey)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return nil, nil, errors.New("tls: invalid EncryptedClientHelloKeys PrivateKey: " + err.Error())
+		}
+		receiver, err := hpke.SetupBaseReceiver(hpkeSuite, enc, priv, echInfo(config))
+		if err != nil {
+			continue
+		}
+		encoded, err := receiver.Open(aad, payload)
+		if err != nil {
+			// The client might have used a different key with the same
+			// config ID, or the config of another server.
+			continue
+		}
+		inner, err := decodeInnerClientHello(outer, encoded)
+		if err != nil {
+			c.sendAlert(alertIllegalParameter)
+			return nil, nil, err
+		}
+		return inner, &echServerContext{receiver: receiver, configID: configID, suite: suite}, nil
+	}
+	return nil, &echServerContext{retryConfigs: c.config.echRetryConfigs()}, nil
+}
+
+// openSecondECHHello decrypts the ClientHelloInner of the second
+// ClientHelloOuter after a HelloRetryRequest, with the HPKE context used for
+// the first one. See draft-ietf-tls-esni-18, Section 7.1.1.
+func (c *Conn) openSecondECHHello(ech *echServerContext, outer *clientHelloMsg) (*clientHelloMsg, error) {
+	if len(outer.encryptedClientHello) == 0 {
+		c.sendAlert(alertMissingExtension)
+		return nil, errors.New("tls: client did not offer ECH in its second ClientHello")
+	}
+	suite, configID, enc, payload, ok := parseOuterECHExtension(outer.encryptedClientHello)
+	if !ok || len(enc) != 0 || suite != ech.suite || configID != ech.configID {
+		c.sendAlert(alertIllegalParameter)
+		return nil, errors.New("tls: invalid ECH extension in second ClientHello")
+	}
+	aad, ok := echOuterAAD(outer, len(payload))
+	if !ok {
+		c.sendAlert(alertDecodeError)
+		return nil, errors.New("tls: invalid ECH extension in second ClientHello")
+	}
+	encoded, err := ech.receiver.Open(aad, payload)
+	if err != nil {
+		c.sendAlert(alertDecryptError)
+		return nil, errors.New("tls: failed to decrypt second ECH ClientHelloInner")
+	}
+	inner, err := decodeInnerClientHello(outer, encoded)
+	if err != nil {
+		c.sendAlert(alertIllegalParameter)
+		return nil, err
+	}
+	return inner, nil
+}
+
+// echRetryConfigs returns the ECHConfigList of the keys in the Config to
+// send to clients as retry configurations, or nil if there are none.
+func (c *Config) echRetryConfigs() []byte {
+	var b cryptobyte.Builder
+	found := false
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, key := range c.EncryptedClientHelloKeys {
+			if key.SendAsRetry {
+				b.AddBytes(key.Config)
+				found = true
+			}
+		}
+	})
+	if !found {
+		return nil
+	}
+	list, err := b.Bytes()
+	if err != nil {
+		return nil
+	}
+	return list
+}
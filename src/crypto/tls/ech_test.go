@@ -0,0 +1,358 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"bytes"
+	"crypto/hpke"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// marshalTestECHConfig returns an ECHConfig for publicKey.
+func marshalTestECHConfig(version uint16, id uint8, kem hpke.KEM, publicName string, publicKey []byte, suites []echCipherSuite, extensions []byte) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16(version)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(id)
+		b.AddUint16(uint16(kem))
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(publicKey)
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, suite := range suites {
+				b.AddUint16(suite.kdfID)
+				b.AddUint16(suite.aeadID)
+			}
+		})
+		b.AddUint8(32) // maximum_name_length
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes([]byte(publicName))
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(extensions)
+		})
+	})
+	return b.BytesOrPanic()
+}
+
+// marshalTestECHConfigList returns an ECHConfigList of configs.
+func marshalTestECHConfigList(configs ...[]byte) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, config := range configs {
+			b.AddBytes(config)
+		}
+	})
+	return b.BytesOrPanic()
+}
+
+// newTestECHKey generates an ECH key with the given config ID and public
+// name, and returns it along with an ECHConfigList of its config.
+func newTestECHKey(t *testing.T, id uint8, publicName string) (EncryptedClientHelloKey, []byte) {
+	return newTestECHKeyWithKEM(t, hpke.DHKEM_X25519_HKDF_SHA256, id, publicName)
+}
+
+func newTestECHKeyWithKEM(t *testing.T, kem hpke.KEM, id uint8, publicName string) (EncryptedClientHelloKey, []byte) {
+	priv, err := kem.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suites := []echCipherSuite{
+		{uint16(hpke.KDF_HKDF_SHA256), uint16(hpke.AEAD_AES_128_GCM)},
+		{uint16(hpke.KDF_HKDF_SHA256), uint16(hpke.AEAD_ChaCha20Poly1305)},
+	}
+	config := marshalTestECHConfig(echVersion, id, kem, publicName, priv.PublicKey().Bytes(), suites, nil)
+	key := EncryptedClientHelloKey{Config: config, PrivateKey: priv.Bytes(), SendAsRetry: true}
+	return key, marshalTestECHConfigList(config)
+}
+
+func TestParseECHConfigList(t *testing.T) {
+	pub := bytes.Repeat([]byte{1}, 32)
+	suites := []echCipherSuite{{0xffff, 0xffff}, {uint16(hpke.KDF_HKDF_SHA256), uint16(hpke.AEAD_AES_256_GCM)}}
+	supported := marshalTestECHConfig(echVersion, 1, hpke.DHKEM_X25519_HKDF_SHA256, "public.example", pub, suites, nil)
+	otherVersion := marshalTestECHConfig(0xfe0a, 2, hpke.DHKEM_X25519_HKDF_SHA256, "public.example", pub, suites, nil)
+	mandatoryExtension := marshalTestECHConfig(echVersion, 3, hpke.DHKEM_X25519_HKDF_SHA256, "public.example", pub, suites,
+		[]byte{0xff, 0xff, 0, 0})
+	optionalExtension := marshalTestECHConfig(echVersion, 4, hpke.DHKEM_X25519_HKDF_SHA256, "public.example", pub, suites,
+		[]byte{0x0f, 0xff, 0, 1, 0})
+	ipAddress := marshalTestECHConfig(echVersion, 5, hpke.DHKEM_X25519_HKDF_SHA256, "192.0.2.1", pub, suites, nil)
+
+	configs, err := parseECHConfigList(marshalTestECHConfigList(otherVersion,
+		mandatoryExtension, ipAddress, optionalExtension, supported))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var usable []uint8
+	for _, config := range configs {
+		if config.usable() {
+			usable = append(usable, config.configID)
+		}
+	}
+	if want := []uint8{4, 1}; !bytes.Equal(usable, want) {
+		t.Errorf("usable configs = %v, want %v", usable, want)
+	}
+	if !bytes.Equal(configs[4].raw, supported) {
+		t.Errorf("raw config = %x, want %x", configs[4].raw, supported)
+	}
+	if suite, _ := configs[4].cipherSuite(); suite != suites[1] {
+		t.Errorf("cipher suite = %v, want %v", suite, suites[1])
+	}
+
+	for _, list := range [][]byte{
+		nil,
+		{0, 0},
+		marshalTestECHConfigList(supported[:len(supported)-1]),
+		append(marshalTestECHConfigList(supported), 0),
+		marshalTestECHConfigList(marshalTestECHConfig(echVersion, 1, hpke.DHKEM_X25519_HKDF_SHA256, "", pub, suites, nil)),
+		marshalTestECHConfigList(marshalTestECHConfig(echVersion, 1, hpke.DHKEM_X25519_HKDF_SHA256, "public.example", pub, nil, nil)),
+	} {
+		if _, err := parseECHConfigList(list); err == nil {
+			t.Errorf("parseECHConfigList(%x) succeeded", list)
+		}
+	}
+}
+
+func TestValidECHPublicName(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		valid bool
+	}{
+		{"example.com", true},
+		{"public-name.example", true},
+		{"localhost", true},
+		{"a1.b2.c3", true},
+		{"", false},
+		{"example.com.", false},
+		{".example.com", false},
+		{"-example.com", false},
+		{"example-.com", false},
+		{"exa_mple.com", false},
+		{"192.0.2.1", false},
+		{"example.123", false},
+		{"example.0x1f", false},
+		{strings.Repeat("a", 64) + ".example", false},
+	} {
+		if got := validECHPublicName(tt.name); got != tt.valid {
+			t.Errorf("validECHPublicName(%q) = %v, want %v", tt.name, got, tt.valid)
+		}
+	}
+}
+
+// echHandshakeResult is the outcome of a handshake run by testECHHandshake.
+type echHandshakeResult struct {
+	ss, cs               ConnectionState
+	serverErr, clientErr error
+	clientHello          []byte // the first flight of the client
+}
+
+// testECHHandshake runs a handshake between a client and a server.
+func testECHHandshake(t *testing.T, clientConfig, serverConfig *Config) (r echHandshakeResult) {
+	c, s := localPipe(t)
+	rc := &recordingConn{Conn: c}
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		cli := Client(rc, clientConfig)
+		defer cli.Close()
+		if r.clientErr = cli.Handshake(); r.clientErr != nil {
+			return
+		}
+		r.cs = cli.ConnectionState()
+		// Read until the server closes the connection, to receive the
+		// session tickets.
+		io.Copy(io.Discard, cli)
+	}()
+	srv := Server(s, serverConfig)
+	if r.serverErr = srv.Handshake(); r.serverErr == nil {
+		r.ss = srv.ConnectionState()
+	}
+	srv.Close()
+	<-done
+	if len(rc.flows) > 0 {
+		r.clientHello = rc.flows[0]
+	}
+	return
+}
+
+func TestECH(t *testing.T) {
+	const secretName = "secret.example"
+	key1, list1 := newTestECHKey(t, 1, "public.example")
+	key2, list2 := newTestECHKey(t, 2, "example.golang")
+	// The server doesn't have the key of list3.
+	_, list3 := newTestECHKey(t, 2, "example.golang")
+
+	issuer, err := x509.ParseCertificate(testRSACertificateIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(issuer)
+	now := func() time.Time { return time.Unix(1476984729, 0) }
+
+	newConfigs := func(list []byte, keys ...EncryptedClientHelloKey) (clientConfig, serverConfig *Config) {
+		serverConfig = testConfig.Clone()
+		serverConfig.Time = now
+		serverConfig.EncryptedClientHelloKeys = keys
+		clientConfig = testConfig.Clone()
+		clientConfig.Time = now
+		clientConfig.ServerName = secretName
+		clientConfig.RootCAs = rootCAs
+		clientConfig.EncryptedClientHelloConfigList = list
+		return clientConfig, serverConfig
+	}
+
+	checkAccepted := func(t *testing.T, r echHandshakeResult) {
+		t.Helper()
+		if r.serverErr != nil || r.clientErr != nil {
+			t.Fatalf("handshake failed: %v (server), %v (client)", r.serverErr, r.clientErr)
+		}
+		if !r.ss.ECHAccepted || !r.cs.ECHAccepted {
+			t.Errorf("ECHAccepted = %v (server), %v (client); want true", r.ss.ECHAccepted, r.cs.ECHAccepted)
+		}
+		if r.ss.ServerName != secretName || r.cs.ServerName != secretName {
+			t.Errorf("ServerName = %q (server), %q (client); want %q", r.ss.ServerName, r.cs.ServerName, secretName)
+		}
+		if bytes.Contains(r.clientHello, []byte(secretName)) {
+			t.Errorf("the server name was sent in plaintext")
+		}
+	}
+
+	checkRejected := func(t *testing.T, clientErr error, retryConfigs []byte) {
+		t.Helper()
+		var echErr *ECHRejectionError
+		if !errors.As(clientErr, &echErr) {
+			t.Fatalf("client error = %v, want an ECHRejectionError", clientErr)
+		}
+		if !bytes.Equal(echErr.RetryConfigList, retryConfigs) {
+			t.Errorf("RetryConfigList = %x, want %x", echErr.RetryConfigList, retryConfigs)
+		}
+	}
+
+	t.Run("Accepted", func(t *testing.T) {
+		clientConfig, serverConfig := newConfigs(list1, key2, key1)
+		checkAccepted(t, testECHHandshake(t, clientConfig, serverConfig))
+	})
+
+	t.Run("P256KEM", func(t *testing.T) {
+		key, list := newTestECHKeyWithKEM(t, hpke.DHKEM_P256_HKDF_SHA256, 3, "public.example")
+		clientConfig, serverConfig := newConfigs(list, key1, key)
+		checkAccepted(t, testECHHandshake(t, clientConfig, serverConfig))
+	})
+
+	t.Run("HelloRetryRequest", func(t *testing.T) {
+		clientConfig, serverConfig := newConfigs(list1, key1)
+		serverConfig.CurvePreferences = []CurveID{CurveP256}
+		checkAccepted(t, testECHHandshake(t, clientConfig, serverConfig))
+	})
+
+	t.Run("Resumption", func(t *testing.T) {
+		clientConfig, serverConfig := newConfigs(list1, key1)
+		clientConfig.ClientSessionCache = NewLRUClientSessionCache(1)
+		checkAccepted(t, testECHHandshake(t, clientConfig, serverConfig))
+		r := testECHHandshake(t, clientConfig, serverConfig)
+		checkAccepted(t, r)
+		if !r.ss.DidResume || !r.cs.DidResume {
+			t.Errorf("DidResume = %v (server), %v (client); want true", r.ss.DidResume, r.cs.DidResume)
+		}
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		// testRSACertificate is valid for the public name, example.golang.
+		clientConfig, serverConfig := newConfigs(list3, key2)
+		serverConfig.ClientAuth = RequestClientCert
+		r := testECHHandshake(t, clientConfig, serverConfig)
+		checkRejected(t, r.clientErr, list2)
+		if r.serverErr == nil && (r.ss.ECHAccepted || len(r.ss.PeerCertificates) != 0) {
+			t.Errorf("server ECHAccepted = %v with %d client certificates",
+				r.ss.ECHAccepted, len(r.ss.PeerCertificates))
+		}
+
+		// Retry with the configs sent by the server.
+		clientConfig.EncryptedClientHelloConfigList = list2
+		checkAccepted(t, testECHHandshake(t, clientConfig, serverConfig))
+	})
+
+	t.Run("RejectedHelloRetryRequest", func(t *testing.T) {
+		clientConfig, serverConfig := newConfigs(list3, key2)
+		serverConfig.CurvePreferences = []CurveID{CurveP256}
+		r := testECHHandshake(t, clientConfig, serverConfig)
+		checkRejected(t, r.clientErr, list2)
+	})
+
+	t.Run("RejectedWithoutKeys", func(t *testing.T) {
+		clientConfig, serverConfig := newConfigs(list2)
+		r := testECHHandshake(t, clientConfig, serverConfig)
+		checkRejected(t, r.clientErr, nil)
+	})
+
+	t.Run("RejectionVerify", func(t *testing.T) {
+		// The certificate of the server is not valid for public.example,
+		// despite InsecureSkipVerify.
+		key4, list4 := newTestECHKey(t, 1, "public.example")
+		clientConfig, serverConfig := newConfigs(list1, key4)
+		r := testECHHandshake(t, clientConfig, serverConfig)
+		if _, ok := r.clientErr.(*ECHRejectionError); ok || r.clientErr == nil {
+			t.Fatalf("client error = %v, want a certificate error", r.clientErr)
+		}
+
+		var verifiedName string
+		clientConfig.EncryptedClientHelloRejectionVerify = func(cs ConnectionState) error {
+			verifiedName = cs.ServerName
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("no certificates")
+			}
+			return nil
+		}
+		r = testECHHandshake(t, clientConfig, serverConfig)
+		checkRejected(t, r.clientErr, list4)
+		if verifiedName != "public.example" {
+			t.Errorf("EncryptedClientHelloRejectionVerify got ServerName %q, want %q", verifiedName, "public.example")
+		}
+	})
+}
+
+func TestECHClientErrors(t *testing.T) {
+	_, list := newTestECHKey(t, 1, "public.example")
+	for _, tt := range []struct {
+		name   string
+		config *Config
+		err    string
+	}{
+		{
+			"TLSv12",
+			&Config{ServerName: "example.golang", EncryptedClientHelloConfigList: list, MaxVersion: VersionTLS12},
+			"requires TLS 1.3",
+		},
+		{
+			"InvalidList",
+			&Config{ServerName: "example.golang", EncryptedClientHelloConfigList: list[:len(list)-1]},
+			"invalid ECHConfigList",
+		},
+		{
+			"UnsupportedConfigs",
+			&Config{ServerName: "example.golang", EncryptedClientHelloConfigList: marshalTestECHConfigList(
+				marshalTestECHConfig(0xfe0a, 1, hpke.DHKEM_X25519_HKDF_SHA256, "public.example", bytes.Repeat([]byte{1}, 32), nil, nil))},
+			"no supported ECH config",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, s := localPipe(t)
+			defer c.Close()
+			defer s.Close()
+			err := Client(c, tt.config).Handshake()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
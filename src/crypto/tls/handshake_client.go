@@ -56,6 +56,14 @@ func (c *Conn) makeClientHello() (*clientHelloMsg, ecdheParameters, error) {
 	if len(supportedVersions) == 0 {
 		return nil, nil, errors.New("tls: no supported versions satisfy MinVersion and MaxVersion")
 	}
+	if len(config.EncryptedClientHelloConfigList) > 0 {
+		// ECH is only defined for TLS 1.3. See draft-ietf-tls-esni-18,
+		// Section 6.1.
+		if supportedVersions[0] != VersionTLS13 {
+			return nil, nil, errors.New("tls: EncryptedClientHelloConfigList requires TLS 1.3")
+		}
+		supportedVersions = supportedVersions[:1]
+	}
 
 	clientHelloVersion := config.maxSupportedVersion()
 	// The version at the beginning of the ClientHello was capped at TLS 1.2
@@ -112,8 +120,14 @@ func (c *Conn) makeClientHello() (*clientHelloMsg, ecdheParameters, error) {
 	// A random session ID is used to detect when the server accepted a ticket
 	// and is resuming a session (see RFC 5077). In TLS 1.3, it's always set as
 	// a compatibility measure (see RFC 8446, Section 4.1.2).
-	if _, err := io.ReadFull(config.rand(), hello.sessionId); err != nil {
-		return nil, nil, errors.New("tls: short read from Rand: " + err.Error())
+	//
+	// The session ID is not set for QUIC connections (see RFC 9001, Section 8.4).
+	if c.quic == nil {
+		if _, err := io.ReadFull(config.rand(), hello.sessionId); err != nil {
+			return nil, nil, errors.New("tls: short read from Rand: " + err.Error())
+		}
+	} else {
+		hello.sessionId = nil
 	}
 
 	if hello.vers >= VersionTLS12 {
@@ -139,6 +153,17 @@ func (c *Conn) makeClientHello() (*clientHelloMsg, ecdheParameters, error) {
 		hello.keyShares = []keyShare{{group: curveID, data: params.PublicKey()}}
 	}
 
+	if c.quic != nil {
+		p, err := c.quicGetTransportParameters()
+		if err != nil {
+			return nil, nil, err
+		}
+		if p == nil {
+			p = []byte{}
+		}
+		hello.quicTransportParameters = p
+	}
+
 	return hello, params, nil
 }
 
@@ -157,7 +182,23 @@ func (c *Conn) clientHandshake(ctx context.Context) (err error) {
 	}
 	c.serverName = hello.serverName
 
+	var ech *echClientContext
+	if len(c.config.EncryptedClientHelloConfigList) > 0 {
+		ech, err = c.newECHClientContext()
+		if err != nil {
+			return err
+		}
+		hello.encryptedClientHello = echInnerExtension
+	}
+
 	cacheKey, session, earlySecret, binderKey := c.loadSession(hello)
+	psks, err := c.offerPreSharedKeys(hello)
+	if err != nil {
+		return err
+	}
+	if len(hello.pskIdentities) > 0 {
+		computePSKBinders(hello, session, binderKey, psks, nil)
+	}
 	if cacheKey != "" && session != nil {
 		defer func() {
 			// If we got a handshake failure when resuming a session, throw away
@@ -172,10 +213,31 @@ func (c *Conn) clientHandshake(ctx context.Context) (err error) {
 		}()
 	}
 
-	if _, err := c.writeRecord(recordTypeHandshake, hello.marshal()); err != nil {
+	firstHello := hello
+	if ech != nil {
+		// The ClientHelloInner is sent encrypted in a ClientHelloOuter,
+		// which has its own random. See draft-ietf-tls-esni-18, Section 6.1.
+		ech.innerHello = hello
+		ech.outerRandom = make([]byte, 32)
+		if _, err := io.ReadFull(c.config.rand(), ech.outerRandom); err != nil {
+			return errors.New("tls: short read from Rand: " + err.Error())
+		}
+		firstHello, err = ech.makeOuterHello(true)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.writeRecord(recordTypeHandshake, firstHello.marshal()); err != nil {
 		return err
 	}
 
+	if hello.earlyData {
+		if err := c.sendEarlyData(hello, session, earlySecret); err != nil {
+			return err
+		}
+	}
+
 	msg, err := c.readHandshake()
 	if err != nil {
 		return err
@@ -191,6 +253,16 @@ func (c *Conn) clientHandshake(ctx context.Context) (err error) {
 		return err
 	}
 
+	// The early data can't be taken back. See RFC 8446, Appendix D.3.
+	if hello.earlyData && c.vers != VersionTLS13 {
+		return errors.New("tls: server selected TLS 1.2 or lower after the client sent early data")
+	}
+
+	if ech != nil && c.vers != VersionTLS13 {
+		c.sendAlert(alertProtocolVersion)
+		return errors.New("tls: server selected TLS 1.2 or lower in response to Encrypted Client Hello")
+	}
+
 	// If we are negotiating a protocol version that's lower than what we
 	// support, check for the server downgrade canaries.
 	// See RFC 8446, Section 4.1.3.
@@ -205,14 +277,17 @@ func (c *Conn) clientHandshake(ctx context.Context) (err error) {
 
 	if c.vers == VersionTLS13 {
 		hs := &clientHandshakeStateTLS13{
-			c:           c,
-			ctx:         ctx,
-			serverHello: serverHello,
-			hello:       hello,
-			ecdheParams: ecdheParams,
-			session:     session,
-			earlySecret: earlySecret,
-			binderKey:   binderKey,
+			c:            c,
+			ctx:          ctx,
+			serverHello:  serverHello,
+			hello:        firstHello,
+			ecdheParams:  ecdheParams,
+			session:      session,
+			earlySecret:  earlySecret,
+			binderKey:    binderKey,
+			externalPSKs: psks,
+			sentDummyCCS: hello.earlyData,
+			echContext:   ech,
 		}
 
 		// In TLS 1.3, session tickets are delivered after the handshake.
@@ -262,7 +337,10 @@ func (c *Conn) loadSession(hello *clientHelloMsg) (cacheKey string,
 	}
 
 	// Try to resume a previously negotiated TLS session, if available.
-	cacheKey = clientSessionCacheKey(c.conn.RemoteAddr(), c.config)
+	cacheKey = c.clientSessionCacheKey()
+	if cacheKey == "" {
+		return "", nil, nil, nil
+	}
 	session, ok := c.config.ClientSessionCache.Get(cacheKey)
 	if !ok || session == nil {
 		return cacheKey, nil, nil, nil
@@ -343,19 +421,98 @@ func (c *Conn) loadSession(hello *clientHelloMsg) (cacheKey string,
 	hello.pskIdentities = []pskIdentity{identity}
 	hello.pskBinders = [][]byte{make([]byte, cipherSuite.hash.Size())}
 
-	// Compute the PSK binders. See RFC 8446, Section 4.2.11.2.
+	// Offer early data if the Write that started the handshake provided
+	// some. The server can only accept it with the session's cipher suite
+	// and ALPN protocol. See RFC 8446, Section 4.2.10. It's not offered with
+	// ECH, as it would be sent to the public name if ECH was rejected.
+	if c.config.EnableEarlyData && len(c.earlyData) > 0 && c.quic == nil &&
+		hello.encryptedClientHello == nil && session.maxEarlyData > 0 &&
+		mutualCipherSuiteTLS13(hello.cipherSuites, session.cipherSuite) != nil {
+		alpnOK := session.alpn == "" && len(hello.alpnProtocols) == 0
+		for _, proto := range hello.alpnProtocols {
+			if proto == session.alpn {
+				alpnOK = true
+				break
+			}
+		}
+		hello.earlyData = alpnOK
+	}
+
+	// The PSK binders are computed by computePSKBinders, once all the PSKs
+	// are offered.
 	psk := cipherSuite.expandLabel(session.masterSecret, "resumption",
 		session.nonce, cipherSuite.hash.Size())
 	earlySecret = cipherSuite.extract(psk, nil)
 	binderKey = cipherSuite.deriveSecret(earlySecret, resumptionBinderLabel, nil)
-	transcript := cipherSuite.hash.New()
-	transcript.Write(hello.marshalWithoutBinders())
-	pskBinders := [][]byte{cipherSuite.finishedHash(binderKey, transcript)}
-	hello.updateBinders(pskBinders)
 
 	return
 }
 
+// offerPreSharedKeys adds the external pre-shared keys from the Config to
+// hello, after the session being resumed, if any, and returns them.
+func (c *Conn) offerPreSharedKeys(hello *clientHelloMsg) ([]PreSharedKey, error) {
+	if len(c.config.PreSharedKeys) == 0 || hello.supportedVersions[0] != VersionTLS13 ||
+		c.handshakes != 0 {
+		return nil, nil
+	}
+
+	// External PSKs are used with SHA-256. Ensure we offer at least one
+	// cipher suite with that hash.
+	suiteOK := false
+	for _, offeredID := range hello.cipherSuites {
+		offeredSuite := cipherSuiteTLS13ByID(offeredID)
+		if offeredSuite != nil && offeredSuite.hash == crypto.SHA256 {
+			suiteOK = true
+			break
+		}
+	}
+	if !suiteOK {
+		return nil, nil
+	}
+
+	for _, psk := range c.config.PreSharedKeys {
+		if len(psk.Identity) == 0 || len(psk.Identity) > 1<<16-1 || len(psk.Key) == 0 {
+			return nil, errors.New("tls: invalid PreSharedKey in Config")
+		}
+		// The obfuscated_ticket_age of external PSKs is zero. See RFC 8446,
+		// Section 4.2.11.
+		hello.pskIdentities = append(hello.pskIdentities, pskIdentity{label: psk.Identity})
+		hello.pskBinders = append(hello.pskBinders, make([]byte, crypto.SHA256.Size()))
+	}
+	hello.pskModes = []uint8{pskModeDHE}
+	return c.config.PreSharedKeys, nil
+}
+
+// externalPSKSuite is a cipher suite with the hash of external PSKs, which
+// is all that matters for their key schedule.
+var externalPSKSuite = cipherSuiteTLS13ByID(TLS_AES_128_GCM_SHA256)
+
+// computePSKBinders sets the binders of the PSKs offered in hello: first the
+// session, if binderKey is not nil, and then the external PSKs. prefix is the
+// part of the transcript that precedes hello, after a HelloRetryRequest.
+// See RFC 8446, Section 4.2.11.2.
+func computePSKBinders(hello *clientHelloMsg, session *ClientSessionState, binderKey []byte,
+	psks []PreSharedKey, prefix []byte) {
+	truncated := hello.marshalWithoutBinders()
+	binder := func(suite *cipherSuiteTLS13, binderKey []byte) []byte {
+		transcript := suite.hash.New()
+		transcript.Write(prefix)
+		transcript.Write(truncated)
+		return suite.finishedHash(binderKey, transcript)
+	}
+
+	var pskBinders [][]byte
+	if binderKey != nil {
+		pskBinders = append(pskBinders, binder(cipherSuiteTLS13ByID(session.cipherSuite), binderKey))
+	}
+	for _, psk := range psks {
+		earlySecret := externalPSKSuite.extract(psk.Key, nil)
+		pskBinders = append(pskBinders, binder(externalPSKSuite,
+			externalPSKSuite.deriveSecret(earlySecret, externalBinderLabel, nil)))
+	}
+	hello.updateBinders(pskBinders)
+}
+
 func (c *Conn) pickTLSVersion(serverHello *serverHelloMsg) error {
 	peerVersion := serverHello.vers
 	if serverHello.supportedVersion != 0 {
@@ -711,7 +868,7 @@ func (hs *clientHandshakeState) processServerHello() (bool, error) {
 		}
 	}
 
-	if err := checkALPN(hs.hello.alpnProtocols, hs.serverHello.alpnProtocol); err != nil {
+	if err := checkALPN(hs.hello.alpnProtocols, hs.serverHello.alpnProtocol, false); err != nil {
 		c.sendAlert(alertUnsupportedExtension)
 		return false, err
 	}
@@ -749,8 +906,14 @@ func (hs *clientHandshakeState) processServerHello() (bool, error) {
 
 // checkALPN ensure that the server's choice of ALPN protocol is compatible with
 // the protocols that we advertised in the Client Hello.
-func checkALPN(clientProtos []string, serverProto string) error {
+// checkALPN checks that the server's ALPN selection is one the client offered.
+// QUIC connections must negotiate an application protocol (see RFC 9001,
+// Section 8.1).
+func checkALPN(clientProtos []string, serverProto string, quic bool) error {
 	if serverProto == "" {
+		if quic && len(clientProtos) > 0 {
+			return errors.New("tls: server did not select an ALPN protocol")
+		}
 		return nil
 	}
 	if len(clientProtos) == 0 {
@@ -854,11 +1017,20 @@ func (c *Conn) verifyServerCertificate(certificates [][]byte) error {
 		certs[i] = cert
 	}
 
-	if !c.config.InsecureSkipVerify {
+	// If the server rejected ECH, the certificate is for its public name,
+	// and is verified regardless of InsecureSkipVerify, unless the
+	// application verifies it. See draft-ietf-tls-esni-18, Section 6.1.7.
+	echRejected := len(c.config.EncryptedClientHelloConfigList) > 0 && !c.echAccepted
+	if echRejected && c.config.EncryptedClientHelloRejectionVerify == nil ||
+		!echRejected && !c.config.InsecureSkipVerify {
+		dnsName := c.config.ServerName
+		if echRejected {
+			dnsName = c.serverName
+		}
 		opts := x509.VerifyOptions{
 			Roots:         c.config.RootCAs,
 			CurrentTime:   c.config.time(),
-			DNSName:       c.config.ServerName,
+			DNSName:       dnsName,
 			Intermediates: x509.NewCertPool(),
 		}
 		for _, cert := range certs[1:] {
@@ -882,6 +1054,16 @@ func (c *Conn) verifyServerCertificate(certificates [][]byte) error {
 
 	c.peerCertificates = certs
 
+	if echRejected {
+		if c.config.EncryptedClientHelloRejectionVerify != nil {
+			if err := c.config.EncryptedClientHelloRejectionVerify(c.connectionStateLocked()); err != nil {
+				c.sendAlert(alertBadCertificate)
+				return err
+			}
+		}
+		return nil
+	}
+
 	if c.config.VerifyPeerCertificate != nil {
 		if err := c.config.VerifyPeerCertificate(certificates, c.verifiedChains); err != nil {
 			c.sendAlert(alertBadCertificate)
@@ -983,11 +1165,14 @@ func (c *Conn) getClientCertificate(cri *CertificateRequestInfo) (*Certificate,
 
 // clientSessionCacheKey returns a key used to cache sessionTickets that could
 // be used to resume previously negotiated TLS sessions with a server.
-func clientSessionCacheKey(serverAddr net.Addr, config *Config) string {
-	if len(config.ServerName) > 0 {
-		return config.ServerName
+func (c *Conn) clientSessionCacheKey() string {
+	if len(c.config.ServerName) > 0 {
+		return c.config.ServerName
+	}
+	if c.conn != nil {
+		return c.conn.RemoteAddr().String()
 	}
-	return serverAddr.String()
+	return ""
 }
 
 // hostnameInSNI converts name into an appropriate hostname for SNI.
@@ -986,6 +986,9 @@ func testResumption(t *testing.T, version uint16) {
 
 	// Age the session ticket a bit at a time, but don't expire it.
 	d := 0 * time.Hour
+	serverConfig.Time = func() time.Time { return time.Now().Add(d) }
+	deleteTicket()
+	testResumeState("GetFreshSessionTicket", false)
 	for i := 0; i < 13; i++ {
 		d += 12 * time.Hour
 		serverConfig.Time = func() time.Time { return time.Now().Add(d) }
@@ -2595,3 +2598,133 @@ func TestClientHandshakeContextCancellation(t *testing.T) {
 		t.Error("Client connection was not closed when the context was canceled")
 	}
 }
+
+// earlyDataExchange has the client write msg as its first Write, and the
+// server read it back and answer. It returns the ConnectionState of both
+// sides after the exchange.
+func earlyDataExchange(t *testing.T, clientConfig, serverConfig *Config, msg []byte) (serverState, clientState ConnectionState) {
+	t.Helper()
+	const reply = "reply"
+	c, s := localPipe(t)
+	errChan := make(chan error, 1)
+	go func() {
+		srv := Server(s, serverConfig)
+		defer srv.Close()
+		if err := srv.Handshake(); err != nil {
+			errChan <- fmt.Errorf("server: %v", err)
+			return
+		}
+		got := make([]byte, len(msg))
+		if _, err := io.ReadFull(srv, got); err != nil {
+			errChan <- fmt.Errorf("server: Read: %v", err)
+			return
+		}
+		if !bytes.Equal(got, msg) {
+			errChan <- fmt.Errorf("server: read %q, want %q", got, msg)
+			return
+		}
+		serverState = srv.ConnectionState()
+		if _, err := io.WriteString(srv, reply); err != nil {
+			errChan <- fmt.Errorf("server: Write: %v", err)
+			return
+		}
+		errChan <- nil
+	}()
+
+	cli := Client(c, clientConfig)
+	defer cli.Close()
+	if n, err := cli.Write(msg); n != len(msg) || err != nil {
+		t.Fatalf("client: Write = %d, %v; want %d, nil", n, err, len(msg))
+	}
+	got := make([]byte, len(reply))
+	if _, err := io.ReadFull(cli, got); err != nil {
+		t.Fatalf("client: Read: %v", err)
+	}
+	if string(got) != reply {
+		t.Errorf("client: read %q, want %q", got, reply)
+	}
+	clientState = cli.ConnectionState()
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+	return serverState, clientState
+}
+
+func TestEarlyData(t *testing.T) {
+	var infos []*EarlyDataInfo
+	accept := true
+	serverConfig := testConfig.Clone()
+	serverConfig.Rand = nil
+	serverConfig.MaxVersion = VersionTLS13
+	serverConfig.MaxEarlyData = 1024
+	serverConfig.AcceptEarlyData = func(info *EarlyDataInfo) bool {
+		infos = append(infos, info)
+		return accept
+	}
+	clientConfig := testConfig.Clone()
+	clientConfig.Rand = nil
+	clientConfig.EnableEarlyData = true
+	clientConfig.ClientSessionCache = NewLRUClientSessionCache(1)
+	clientConfig.NextProtos = []string{"proto"}
+	serverConfig.NextProtos = []string{"proto"}
+
+	check := func(name string, msg []byte, wantAccepted bool) {
+		t.Helper()
+		ss, cs := earlyDataExchange(t, clientConfig, serverConfig, msg)
+		if !cs.DidResume {
+			t.Errorf("%s: session was not resumed", name)
+		}
+		if ss.EarlyDataAccepted != wantAccepted || cs.EarlyDataAccepted != wantAccepted {
+			t.Errorf("%s: EarlyDataAccepted = %v (server), %v (client); want %v",
+				name, ss.EarlyDataAccepted, cs.EarlyDataAccepted, wantAccepted)
+		}
+		if cs.NegotiatedProtocol != "proto" {
+			t.Errorf("%s: NegotiatedProtocol = %q, want %q", name, cs.NegotiatedProtocol, "proto")
+		}
+	}
+
+	// The first connection has no session to send early data with.
+	ss, cs := earlyDataExchange(t, clientConfig, serverConfig, []byte("hello"))
+	if cs.DidResume || ss.EarlyDataAccepted || cs.EarlyDataAccepted || len(infos) != 0 {
+		t.Fatalf("first connection resumed or accepted early data")
+	}
+
+	check("Accepted", []byte("early hello"), true)
+	if len(infos) != 1 {
+		t.Fatalf("AcceptEarlyData called %d times, want 1", len(infos))
+	}
+	if info := infos[0]; len(info.Random) != 32 || bytes.Equal(info.Random, make([]byte, 32)) ||
+		info.ClientHello == nil || info.TicketAge < 0 || info.TicketAge > maxTicketAgeSkew {
+		t.Errorf("unexpected EarlyDataInfo: %+v", info)
+	}
+
+	// Only MaxEarlyData bytes are sent early, the rest after the handshake.
+	long := bytes.Repeat([]byte("0123456789abcdef"), 200)
+	check("Long", long, true)
+
+	accept = false
+	check("Rejected", []byte("rejected hello"), false)
+	check("RejectedLong", long, false)
+	accept = true
+
+	// A server that no longer accepts early data skips it.
+	serverConfig.MaxEarlyData = 0
+	check("Disabled", []byte("skipped hello"), false)
+	// The ticket it issued then doesn't allow early data.
+	serverConfig.MaxEarlyData = 1024
+	check("Reenabled", []byte("hello"), false)
+	check("AcceptedAgain", []byte("early hello"), true)
+
+	// After a HelloRetryRequest, the early data is sent again in the clear.
+	clientConfig.CurvePreferences = []CurveID{X25519, CurveP256}
+	serverConfig.CurvePreferences = []CurveID{CurveP256}
+	check("HelloRetryRequest", []byte("retried hello"), false)
+
+	// A different application protocol prevents early data.
+	clientConfig.NextProtos = []string{"other", "proto"}
+	serverConfig.NextProtos = []string{"other", "proto"}
+	ss, cs = earlyDataExchange(t, clientConfig, serverConfig, []byte("hello"))
+	if ss.EarlyDataAccepted || cs.EarlyDataAccepted {
+		t.Errorf("early data accepted with a different application protocol")
+	}
+}
@@ -25,19 +25,27 @@ type clientHandshakeStateTLS13 struct {
 
 	session     *ClientSessionState
 	earlySecret []byte
-	binderKey   []byte
-
-	certReq       *certificateRequestMsgTLS13
-	usingPSK      bool
-	sentDummyCCS  bool
-	suite         *cipherSuiteTLS13
-	transcript    hash.Hash
-	masterSecret  []byte
-	trafficSecret []byte // client_application_traffic_secret_0
+	binderKey   []byte // set if the session is offered
+
+	externalPSKs []PreSharedKey // offered after the session
+
+	echContext      *echClientContext // set if ECH is offered
+	echRetryConfigs []byte
+
+	certReq         *certificateRequestMsgTLS13
+	usingPSK        bool
+	sentDummyCCS    bool
+	suite           *cipherSuiteTLS13
+	transcript      hash.Hash
+	handshakeSecret []byte // client_handshake_traffic_secret
+	masterSecret    []byte
+	trafficSecret   []byte // client_application_traffic_secret_0
 }
 
 // handshake requires hs.c, hs.hello, hs.serverHello, hs.ecdheParams, and,
-// optionally, hs.session, hs.earlySecret and hs.binderKey to be set.
+// optionally, hs.session, hs.earlySecret, hs.binderKey, hs.externalPSKs and
+// hs.echContext to be set. If hs.echContext is set, hs.hello is the
+// ClientHelloOuter.
 func (hs *clientHandshakeStateTLS13) handshake() error {
 	c := hs.c
 
@@ -59,8 +67,13 @@ func (hs *clientHandshakeStateTLS13) handshake() error {
 
 	hs.transcript = hs.suite.hash.New()
 	hs.transcript.Write(hs.hello.marshal())
+	if hs.echContext != nil {
+		hs.echContext.innerTranscript = hs.suite.hash.New()
+		hs.echContext.innerTranscript.Write(hs.echContext.innerHello.marshal())
+	}
 
-	if bytes.Equal(hs.serverHello.random, helloRetryRequestRandom) {
+	hrr := bytes.Equal(hs.serverHello.random, helloRetryRequestRandom)
+	if hrr {
 		if err := hs.sendDummyChangeCipherSpec(); err != nil {
 			return err
 		}
@@ -69,6 +82,23 @@ func (hs *clientHandshakeStateTLS13) handshake() error {
 		}
 	}
 
+	// If ECH was rejected by a HelloRetryRequest, the ServerHello doesn't
+	// confirm it either.
+	if hs.echContext != nil && (!hrr || c.echAccepted) {
+		accepted, err := hs.checkECHAcceptance(false)
+		if err != nil {
+			return err
+		}
+		if hrr && !accepted {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: server rejected ECH after accepting it in a HelloRetryRequest")
+		}
+	}
+	if hs.echContext != nil && !c.echAccepted {
+		// The rest of the handshake is with the public name.
+		c.serverName = hs.echContext.config.publicName
+	}
+
 	hs.transcript.Write(hs.serverHello.marshal())
 
 	c.buffering = true
@@ -90,6 +120,9 @@ func (hs *clientHandshakeStateTLS13) handshake() error {
 	if err := hs.readServerFinished(); err != nil {
 		return err
 	}
+	if err := hs.sendEndOfEarlyData(); err != nil {
+		return err
+	}
 	if err := hs.sendClientCertificate(); err != nil {
 		return err
 	}
@@ -100,6 +133,13 @@ func (hs *clientHandshakeStateTLS13) handshake() error {
 		return err
 	}
 
+	// A handshake with the public name only serves to authenticate the
+	// retry configs. See draft-ietf-tls-esni-18, Section 6.1.6.
+	if hs.echContext != nil && !c.echAccepted {
+		c.sendAlert(alertECHRequired)
+		return &ECHRejectionError{RetryConfigList: hs.echRetryConfigs}
+	}
+
 	atomic.StoreUint32(&c.handshakeStatus, 1)
 
 	return nil
@@ -163,6 +203,9 @@ func (hs *clientHandshakeStateTLS13) checkServerHelloOrHRR() error {
 // sendDummyChangeCipherSpec sends a ChangeCipherSpec record for compatibility
 // with middleboxes that didn't implement TLS correctly. See RFC 8446, Appendix D.4.
 func (hs *clientHandshakeStateTLS13) sendDummyChangeCipherSpec() error {
+	if hs.c.quic != nil {
+		return nil
+	}
 	if hs.sentDummyCCS {
 		return nil
 	}
@@ -172,11 +215,55 @@ func (hs *clientHandshakeStateTLS13) sendDummyChangeCipherSpec() error {
 	return err
 }
 
+// checkECHAcceptance checks the ECH acceptance confirmation of the
+// HelloRetryRequest or ServerHello in hs.serverHello. If it's valid, the
+// handshake continues with the ClientHelloInner and its transcript. See
+// draft-ietf-tls-esni-18, Section 6.1.4.
+func (hs *clientHandshakeStateTLS13) checkECHAcceptance(hrr bool) (bool, error) {
+	c := hs.c
+	ech := hs.echContext
+
+	transcript := cloneHash(ech.innerTranscript, hs.suite.hash)
+	if transcript == nil {
+		c.sendAlert(alertInternalError)
+		return false, errors.New("tls: internal error: failed to clone hash")
+	}
+	label := echAcceptConfirmationLabel
+	confirmation := hs.serverHello.random[32-echConfirmationLength:]
+	if hrr {
+		chHash := transcript.Sum(nil)
+		transcript.Reset()
+		transcript.Write([]byte{typeMessageHash, 0, 0, uint8(len(chHash))})
+		transcript.Write(chHash)
+		label = echHRRAcceptConfirmationLabel
+		confirmation = hs.serverHello.encryptedClientHello
+	}
+	expected := echAcceptConfirmation(hs.suite, ech.innerHello.random, label,
+		transcript, serverHelloWithoutConfirmation(hs.serverHello, hrr))
+	if !hmac.Equal(confirmation, expected) {
+		return false, nil
+	}
+
+	hs.hello = ech.innerHello
+	hs.transcript = ech.innerTranscript
+	c.echAccepted = true
+	return true, nil
+}
+
 // processHelloRetryRequest handles the HRR in hs.serverHello, modifies and
 // resends hs.hello, and reads the new ServerHello into hs.serverHello.
 func (hs *clientHandshakeStateTLS13) processHelloRetryRequest() error {
 	c := hs.c
 
+	if hs.echContext != nil {
+		if _, err := hs.checkECHAcceptance(true); err != nil {
+			return err
+		}
+	} else if hs.serverHello.encryptedClientHello != nil {
+		c.sendAlert(alertUnsupportedExtension)
+		return errors.New("tls: server sent an unexpected encrypted_client_hello extension")
+	}
+
 	// The first ClientHello gets double-hashed into the transcript upon a
 	// HelloRetryRequest. (The idea is that the server might offload transcript
 	// storage to the client in the cookie.) See RFC 8446, Section 4.4.1.
@@ -235,33 +322,84 @@ func (hs *clientHandshakeStateTLS13) processHelloRetryRequest() error {
 		hs.hello.keyShares = []keyShare{{group: curveID, data: params.PublicKey()}}
 	}
 
+	// Early data is rejected by a HelloRetryRequest, and the second
+	// ClientHello is sent in plaintext. See RFC 8446, Section 4.2.10.
+	if hs.hello.earlyData {
+		hs.hello.earlyData = false
+		c.out.cipher = nil
+		c.out.trafficSecret = nil
+		c.out.level = QUICEncryptionLevelInitial
+		c.out.seq = [8]byte{}
+	}
+
 	hs.hello.raw = nil
 	if len(hs.hello.pskIdentities) > 0 {
-		pskSuite := cipherSuiteTLS13ByID(hs.session.cipherSuite)
-		if pskSuite == nil {
-			return c.sendAlert(alertInternalError)
+		// Only keep offering the PSKs compatible with the cipher suite
+		// selected by the server.
+		var identities []pskIdentity
+		var binders [][]byte
+		if hs.binderKey != nil {
+			pskSuite := cipherSuiteTLS13ByID(hs.session.cipherSuite)
+			if pskSuite == nil {
+				return c.sendAlert(alertInternalError)
+			}
+			if pskSuite.hash == hs.suite.hash {
+				// Update obfuscated_ticket_age.
+				ticketAge := uint32(c.config.time().Sub(hs.session.receivedAt) / time.Millisecond)
+				identities = append(identities, pskIdentity{
+					label:               hs.session.sessionTicket,
+					obfuscatedTicketAge: ticketAge + hs.session.ageAdd,
+				})
+				binders = append(binders, make([]byte, pskSuite.hash.Size()))
+			} else {
+				hs.session = nil
+				hs.earlySecret = nil
+				hs.binderKey = nil
+			}
 		}
-		if pskSuite.hash == hs.suite.hash {
-			// Update binders and obfuscated_ticket_age.
-			ticketAge := uint32(c.config.time().Sub(hs.session.receivedAt) / time.Millisecond)
-			hs.hello.pskIdentities[0].obfuscatedTicketAge = ticketAge + hs.session.ageAdd
-
-			transcript := hs.suite.hash.New()
-			transcript.Write([]byte{typeMessageHash, 0, 0, uint8(len(chHash))})
-			transcript.Write(chHash)
-			transcript.Write(hs.serverHello.marshal())
-			transcript.Write(hs.hello.marshalWithoutBinders())
-			pskBinders := [][]byte{hs.suite.finishedHash(hs.binderKey, transcript)}
-			hs.hello.updateBinders(pskBinders)
+		if hs.suite.hash == crypto.SHA256 {
+			for _, psk := range hs.externalPSKs {
+				identities = append(identities, pskIdentity{label: psk.Identity})
+				binders = append(binders, make([]byte, hs.suite.hash.Size()))
+			}
 		} else {
-			// Server selected a cipher suite incompatible with the PSK.
-			hs.hello.pskIdentities = nil
-			hs.hello.pskBinders = nil
+			hs.externalPSKs = nil
+		}
+		hs.hello.pskIdentities = identities
+		hs.hello.pskBinders = binders
+
+		if len(identities) > 0 {
+			prefix := []byte{typeMessageHash, 0, 0, uint8(len(chHash))}
+			prefix = append(prefix, chHash...)
+			prefix = append(prefix, hs.serverHello.marshal()...)
+			computePSKBinders(hs.hello, hs.session, hs.binderKey, hs.externalPSKs, prefix)
+		}
+	}
+
+	hello := hs.hello
+	if hs.echContext != nil {
+		// The second ClientHelloOuter carries the updated ClientHelloInner,
+		// even if the server rejected ECH. See draft-ietf-tls-esni-18,
+		// Section 6.1.5.
+		if !c.echAccepted {
+			inner := hs.echContext.innerHello
+			inner.keyShares = hs.hello.keyShares
+			inner.cookie = hs.hello.cookie
+			inner.raw = nil
+		}
+		outer, err := hs.echContext.makeOuterHello(false)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+		hello = outer
+		if !c.echAccepted {
+			hs.hello = outer
 		}
 	}
 
 	hs.transcript.Write(hs.hello.marshal())
-	if _, err := c.writeRecord(recordTypeHandshake, hs.hello.marshal()); err != nil {
+	if _, err := c.writeRecord(recordTypeHandshake, hello.marshal()); err != nil {
 		return err
 	}
 
@@ -297,6 +435,11 @@ func (hs *clientHandshakeStateTLS13) processServerHello() error {
 		return errors.New("tls: server sent a cookie in a normal ServerHello")
 	}
 
+	if hs.serverHello.encryptedClientHello != nil {
+		c.sendAlert(alertUnsupportedExtension)
+		return errors.New("tls: server sent an encrypted_client_hello extension in a normal ServerHello")
+	}
+
 	if hs.serverHello.selectedGroup != 0 {
 		c.sendAlert(alertDecodeError)
 		return errors.New("tls: malformed key_share extension")
@@ -320,9 +463,33 @@ func (hs *clientHandshakeStateTLS13) processServerHello() error {
 		return errors.New("tls: server selected an invalid PSK")
 	}
 
-	if len(hs.hello.pskIdentities) != 1 || hs.session == nil {
+	i := int(hs.serverHello.selectedIdentity)
+	if hs.binderKey != nil {
+		if i == 0 {
+			return hs.resumeSession()
+		}
+		i--
+	}
+	if i >= len(hs.externalPSKs) {
 		return c.sendAlert(alertInternalError)
 	}
+	psk := hs.externalPSKs[i]
+	if hs.suite.hash != crypto.SHA256 {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server selected an invalid PSK and cipher suite pair")
+	}
+
+	hs.usingPSK = true
+	hs.earlySecret = hs.suite.extract(psk.Key, nil)
+	c.pskIdentity = psk.Identity
+	return nil
+}
+
+// resumeSession is called when the server selected the session offered in
+// the ClientHello.
+func (hs *clientHandshakeStateTLS13) resumeSession() error {
+	c := hs.c
+
 	pskSuite := cipherSuiteTLS13ByID(hs.session.cipherSuite)
 	if pskSuite == nil {
 		return c.sendAlert(alertInternalError)
@@ -359,10 +526,22 @@ func (hs *clientHandshakeStateTLS13) establishHandshakeKeys() error {
 
 	clientSecret := hs.suite.deriveSecret(handshakeSecret,
 		clientHandshakeTrafficLabel, hs.transcript)
-	c.out.setTrafficSecret(hs.suite, clientSecret)
+	hs.handshakeSecret = clientSecret
+	// Early data records keep being written until the server's Finished.
+	if !hs.hello.earlyData {
+		c.out.setTrafficSecret(hs.suite, QUICEncryptionLevelHandshake, clientSecret)
+	}
 	serverSecret := hs.suite.deriveSecret(handshakeSecret,
 		serverHandshakeTrafficLabel, hs.transcript)
-	c.in.setTrafficSecret(hs.suite, serverSecret)
+	c.in.setTrafficSecret(hs.suite, QUICEncryptionLevelHandshake, serverSecret)
+
+	if c.quic != nil {
+		if c.hand.Len() != 0 {
+			c.sendAlert(alertUnexpectedMessage)
+		}
+		c.quicSetWriteSecret(QUICEncryptionLevelHandshake, hs.suite.id, clientSecret)
+		c.quicSetReadSecret(QUICEncryptionLevelHandshake, hs.suite.id, serverSecret)
+	}
 
 	err := c.config.writeKeyLog(keyLogLabelClientHandshake, hs.hello.random, clientSecret)
 	if err != nil {
@@ -396,12 +575,53 @@ func (hs *clientHandshakeStateTLS13) readServerParameters() error {
 	}
 	hs.transcript.Write(encryptedExtensions.marshal())
 
-	if err := checkALPN(hs.hello.alpnProtocols, encryptedExtensions.alpnProtocol); err != nil {
-		c.sendAlert(alertUnsupportedExtension)
+	if err := checkALPN(hs.hello.alpnProtocols, encryptedExtensions.alpnProtocol, c.quic != nil); err != nil {
+		if c.quic != nil {
+			// RFC 9001, Section 8.1 specifies that QUIC clients send
+			// no_application_protocol in this case.
+			c.sendAlert(alertNoApplicationProtocol)
+		} else {
+			c.sendAlert(alertUnsupportedExtension)
+		}
 		return err
 	}
 	c.clientProtocol = encryptedExtensions.alpnProtocol
 
+	if encryptedExtensions.earlyData {
+		if !hs.hello.earlyData {
+			c.sendAlert(alertUnsupportedExtension)
+			return errors.New("tls: server accepted early data that was not offered")
+		}
+		if !c.didResume || hs.suite.id != hs.session.cipherSuite ||
+			c.clientProtocol != hs.session.alpn {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: server accepted early data with different session parameters")
+		}
+		c.earlyDataAccepted = true
+	}
+
+	if encryptedExtensions.echRetryConfigs != nil {
+		if hs.echContext == nil || c.echAccepted {
+			c.sendAlert(alertUnsupportedExtension)
+			return errors.New("tls: server sent unexpected ECH retry configs")
+		}
+		hs.echRetryConfigs = encryptedExtensions.echRetryConfigs
+	}
+
+	if c.quic != nil {
+		if encryptedExtensions.quicTransportParameters == nil {
+			// RFC 9001 Section 8.2.
+			c.sendAlert(alertMissingExtension)
+			return errors.New("tls: server did not send a quic_transport_parameters extension")
+		}
+		c.quicSetTransportParameters(encryptedExtensions.quicTransportParameters)
+	} else {
+		if encryptedExtensions.quicTransportParameters != nil {
+			c.sendAlert(alertUnsupportedExtension)
+			return errors.New("tls: server sent an unexpected quic_transport_parameters extension")
+		}
+	}
+
 	return nil
 }
 
@@ -522,7 +742,14 @@ func (hs *clientHandshakeStateTLS13) readServerFinished() error {
 		clientApplicationTrafficLabel, hs.transcript)
 	serverSecret := hs.suite.deriveSecret(hs.masterSecret,
 		serverApplicationTrafficLabel, hs.transcript)
-	c.in.setTrafficSecret(hs.suite, serverSecret)
+	c.in.setTrafficSecret(hs.suite, QUICEncryptionLevelApplication, serverSecret)
+
+	if c.quic != nil {
+		if c.hand.Len() != 0 {
+			c.sendAlert(alertUnexpectedMessage)
+		}
+		c.quicSetReadSecret(QUICEncryptionLevelApplication, hs.suite.id, serverSecret)
+	}
 
 	err = c.config.writeKeyLog(keyLogLabelClientTraffic, hs.hello.random, hs.trafficSecret)
 	if err != nil {
@@ -540,6 +767,28 @@ func (hs *clientHandshakeStateTLS13) readServerFinished() error {
 	return nil
 }
 
+// sendEndOfEarlyData ends the early data, if it was accepted, and switches to
+// the handshake traffic keys if early data was sent.
+func (hs *clientHandshakeStateTLS13) sendEndOfEarlyData() error {
+	c := hs.c
+
+	if !hs.hello.earlyData {
+		return nil
+	}
+
+	if c.earlyDataAccepted {
+		endOfEarlyData := new(endOfEarlyDataMsg)
+		hs.transcript.Write(endOfEarlyData.marshal())
+		if _, err := c.writeRecord(recordTypeHandshake, endOfEarlyData.marshal()); err != nil {
+			return err
+		}
+	}
+
+	c.out.setTrafficSecret(hs.suite, QUICEncryptionLevelHandshake, hs.handshakeSecret)
+
+	return nil
+}
+
 func (hs *clientHandshakeStateTLS13) sendClientCertificate() error {
 	c := hs.c
 
@@ -547,14 +796,20 @@ func (hs *clientHandshakeStateTLS13) sendClientCertificate() error {
 		return nil
 	}
 
-	cert, err := c.getClientCertificate(&CertificateRequestInfo{
-		AcceptableCAs:    hs.certReq.certificateAuthorities,
-		SignatureSchemes: hs.certReq.supportedSignatureAlgorithms,
-		Version:          c.vers,
-		ctx:              hs.ctx,
-	})
-	if err != nil {
-		return err
+	// No certificate is sent to the public name of a server that rejected
+	// ECH. See draft-ietf-tls-esni-18, Section 6.1.6.
+	cert := new(Certificate)
+	var err error
+	if hs.echContext == nil || c.echAccepted {
+		cert, err = c.getClientCertificate(&CertificateRequestInfo{
+			AcceptableCAs:    hs.certReq.certificateAuthorities,
+			SignatureSchemes: hs.certReq.supportedSignatureAlgorithms,
+			Version:          c.vers,
+			ctx:              hs.ctx,
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	certMsg := new(certificateMsgTLS13)
@@ -621,7 +876,11 @@ func (hs *clientHandshakeStateTLS13) sendClientFinished() error {
 		return err
 	}
 
-	c.out.setTrafficSecret(hs.suite, hs.trafficSecret)
+	c.out.setTrafficSecret(hs.suite, QUICEncryptionLevelApplication, hs.trafficSecret)
+
+	if c.quic != nil {
+		c.quicSetWriteSecret(QUICEncryptionLevelApplication, hs.suite.id, hs.trafficSecret)
+	}
 
 	if !c.config.SessionTicketsDisabled && c.config.ClientSessionCache != nil {
 		c.resumptionSecret = hs.suite.deriveSecret(hs.masterSecret,
@@ -641,6 +900,11 @@ func (c *Conn) handleNewSessionTicket(msg *newSessionTicketMsgTLS13) error {
 		return nil
 	}
 
+	// The external PSK can be used again instead.
+	if c.pskIdentity != nil {
+		return nil
+	}
+
 	// See RFC 8446, Section 4.6.1.
 	if msg.lifetime == 0 {
 		return nil
@@ -671,12 +935,48 @@ func (c *Conn) handleNewSessionTicket(msg *newSessionTicketMsgTLS13) error {
 		nonce:              msg.nonce,
 		useBy:              c.config.time().Add(lifetime),
 		ageAdd:             msg.ageAdd,
+		maxEarlyData:       msg.maxEarlyData,
+		alpn:               c.clientProtocol,
 		ocspResponse:       c.ocspResponse,
 		scts:               c.scts,
 	}
 
-	cacheKey := clientSessionCacheKey(c.conn.RemoteAddr(), c.config)
-	c.config.ClientSessionCache.Put(cacheKey, session)
+	if cacheKey := c.clientSessionCacheKey(); cacheKey != "" {
+		c.config.ClientSessionCache.Put(cacheKey, session)
+	}
 
 	return nil
 }
+
+// sendEarlyData sends c.earlyData as early data following hello, which offers
+// it with session, truncating it to the amount allowed by the server. See RFC
+// 8446, Section 4.2.10.
+func (c *Conn) sendEarlyData(hello *clientHelloMsg, session *ClientSessionState, earlySecret []byte) error {
+	suite := cipherSuiteTLS13ByID(session.cipherSuite)
+	if suite == nil {
+		return c.sendAlert(alertInternalError)
+	}
+
+	// The dummy ChangeCipherSpec goes right after the first ClientHello
+	// when sending early data. See RFC 8446, Appendix D.4.
+	c.out.version = VersionTLS13
+	if _, err := c.writeRecord(recordTypeChangeCipherSpec, []byte{1}); err != nil {
+		return err
+	}
+
+	transcript := suite.hash.New()
+	transcript.Write(hello.marshal())
+	earlyTrafficSecret := suite.deriveSecret(earlySecret, clientEarlyTrafficLabel, transcript)
+	c.out.setTrafficSecret(suite, QUICEncryptionLevelEarly, earlyTrafficSecret)
+
+	if err := c.config.writeKeyLog(keyLogLabelClientEarly, hello.random, earlyTrafficSecret); err != nil {
+		c.sendAlert(alertInternalError)
+		return err
+	}
+
+	if len(c.earlyData) > int(session.maxEarlyData) {
+		c.earlyData = c.earlyData[:session.maxEarlyData]
+	}
+	_, err := c.writeRecord(recordTypeApplicationData, c.earlyData)
+	return err
+}
@@ -27,8 +27,6 @@ var tests = []interface{}{
 	&certificateStatusMsg{},
 	&clientKeyExchangeMsg{},
 	&newSessionTicketMsg{},
-	&sessionState{},
-	&sessionStateTLS13{},
 	&encryptedExtensionsMsg{},
 	&endOfEarlyDataMsg{},
 	&keyUpdateMsg{},
@@ -99,6 +97,51 @@ func TestFuzz(t *testing.T) {
 	}
 }
 
+func TestSessionState(t *testing.T) {
+	rand := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	n := 100
+	if testing.Short() {
+		n = 5
+	}
+	for i := 0; i < n; i++ {
+		v, ok := quick.Value(reflect.TypeOf(&SessionState{}), rand)
+		if !ok {
+			t.Fatal("failed to create value")
+		}
+		s1 := v.Interface().(*SessionState)
+		b, err := s1.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s2, err := ParseSessionState(b)
+		if err != nil {
+			t.Fatalf("failed to parse %#v %x: %v", s1, b, err)
+		}
+		if !reflect.DeepEqual(s1, s2) {
+			t.Fatalf("got:%#v want:%#v %x", s2, s1, b)
+		}
+
+		// Only the encoding without the application data is a valid prefix.
+		withoutExtra := *s1
+		withoutExtra.Extra = nil
+		b0, err := withoutExtra.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < len(b); j++ {
+			if _, err := ParseSessionState(b[:j]); err == nil && j != len(b0) {
+				t.Fatalf("parsed a prefix of length %d of %#v", j, s1)
+			}
+		}
+	}
+
+	for j := 0; j < 1000; j++ {
+		// This just looks for crashes due to bounds errors etc.
+		ParseSessionState(randomBytes(rand.Intn(100), rand))
+	}
+}
+
 func randomBytes(n int, rand *rand.Rand) []byte {
 	r := make([]byte, n)
 	if _, err := rand.Read(r); err != nil {
@@ -190,6 +233,9 @@ func (*clientHelloMsg) Generate(rand *rand.Rand, size int) reflect.Value {
 	if rand.Intn(10) > 5 {
 		m.earlyData = true
 	}
+	if rand.Intn(10) > 5 {
+		m.encryptedClientHello = randomBytes(rand.Intn(500)+1, rand)
+	}
 
 	return reflect.ValueOf(m)
 }
@@ -239,6 +285,9 @@ func (*serverHelloMsg) Generate(rand *rand.Rand, size int) reflect.Value {
 		m.selectedIdentityPresent = true
 		m.selectedIdentity = uint16(rand.Intn(0xffff))
 	}
+	if rand.Intn(10) > 5 {
+		m.encryptedClientHello = randomBytes(echConfirmationLength, rand)
+	}
 
 	return reflect.ValueOf(m)
 }
@@ -249,6 +298,12 @@ func (*encryptedExtensionsMsg) Generate(rand *rand.Rand, size int) reflect.Value
 	if rand.Intn(10) > 5 {
 		m.alpnProtocol = randomString(rand.Intn(32)+1, rand)
 	}
+	if rand.Intn(10) > 5 {
+		m.earlyData = true
+	}
+	if rand.Intn(10) > 5 {
+		m.echRetryConfigs = randomBytes(rand.Intn(500)+1, rand)
+	}
 
 	return reflect.ValueOf(m)
 }
@@ -304,23 +359,32 @@ func (*newSessionTicketMsg) Generate(rand *rand.Rand, size int) reflect.Value {
 	return reflect.ValueOf(m)
 }
 
-func (*sessionState) Generate(rand *rand.Rand, size int) reflect.Value {
-	s := &sessionState{}
-	s.vers = uint16(rand.Intn(10000))
+func (*SessionState) Generate(rand *rand.Rand, size int) reflect.Value {
+	s := &SessionState{}
 	s.cipherSuite = uint16(rand.Intn(10000))
-	s.masterSecret = randomBytes(rand.Intn(100)+1, rand)
+	s.secret = randomBytes(rand.Intn(100)+1, rand)
 	s.createdAt = uint64(rand.Int63())
-	for i := 0; i < rand.Intn(20); i++ {
-		s.certificates = append(s.certificates, randomBytes(rand.Intn(500)+1, rand))
+	if rand.Intn(10) > 5 {
+		for i := 0; i < rand.Intn(3)+1; i++ {
+			s.Extra = append(s.Extra, randomBytes(rand.Intn(100), rand))
+		}
+	}
+	if rand.Intn(2) == 0 {
+		s.version = uint16(rand.Intn(VersionTLS13))
+		for i := 0; i < rand.Intn(20); i++ {
+			s.certificate.Certificate = append(
+				s.certificate.Certificate, randomBytes(rand.Intn(500)+1, rand))
+		}
+		return reflect.ValueOf(s)
+	}
+	s.version = VersionTLS13
+	if rand.Intn(10) > 5 {
+		s.ageAdd = rand.Uint32()
+		s.maxEarlyData = rand.Uint32() | 1
+		if rand.Intn(10) > 5 {
+			s.alpn = randomString(rand.Intn(32)+1, rand)
+		}
 	}
-	return reflect.ValueOf(s)
-}
-
-func (*sessionStateTLS13) Generate(rand *rand.Rand, size int) reflect.Value {
-	s := &sessionStateTLS13{}
-	s.cipherSuite = uint16(rand.Intn(10000))
-	s.resumptionSecret = randomBytes(rand.Intn(100)+1, rand)
-	s.createdAt = uint64(rand.Int63())
 	for i := 0; i < rand.Intn(2)+1; i++ {
 		s.certificate.Certificate = append(
 			s.certificate.Certificate, randomBytes(rand.Intn(500)+1, rand))
@@ -42,7 +42,7 @@ func testClientHelloFailure(t *testing.T, serverConfig *Config, m handshakeMessa
 	}()
 	ctx := context.Background()
 	conn := Server(s, serverConfig)
-	ch, err := conn.readClientHello(ctx)
+	ch, _, err := conn.readClientHello(ctx)
 	hs := serverHandshakeState{
 		c:           conn,
 		ctx:         ctx,
@@ -1430,7 +1430,7 @@ func TestSNIGivenOnFailure(t *testing.T) {
 	}()
 	conn := Server(s, serverConfig)
 	ctx := context.Background()
-	ch, err := conn.readClientHello(ctx)
+	ch, _, err := conn.readClientHello(ctx)
 	hs := serverHandshakeState{
 		c:           conn,
 		ctx:         ctx,
@@ -2026,3 +2026,178 @@ func TestHandshakeContextHierarchy(t *testing.T) {
 		t.Errorf("Unexpected client error: %v", err)
 	}
 }
+
+func TestWrapSession(t *testing.T) {
+	t.Run("TLSv12", func(t *testing.T) { testWrapSession(t, VersionTLS12) })
+	t.Run("TLSv13", func(t *testing.T) { testWrapSession(t, VersionTLS13) })
+}
+
+func testWrapSession(t *testing.T, version uint16) {
+	// store is a session store shared by servers, keyed by ticket.
+	store := make(map[string][]byte)
+	var unwrapErr error
+	var extra [][]byte
+	serverConfig := testConfig.Clone()
+	serverConfig.MaxVersion = version
+	serverConfig.WrapSession = func(cs ConnectionState, ss *SessionState) ([]byte, error) {
+		if cs.Version != version {
+			t.Errorf("WrapSession: got version %x, want %x", cs.Version, version)
+		}
+		ss.Extra = [][]byte{[]byte("app data"), nil}
+		b, err := ss.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("session %d", len(store))
+		store[key] = b
+		return []byte(key), nil
+	}
+	serverConfig.UnwrapSession = func(identity []byte, cs ConnectionState) (*SessionState, error) {
+		if unwrapErr != nil {
+			return nil, unwrapErr
+		}
+		b, ok := store[string(identity)]
+		if !ok {
+			return nil, nil
+		}
+		ss, err := ParseSessionState(b)
+		if err != nil {
+			return nil, err
+		}
+		extra = ss.Extra
+		return ss, nil
+	}
+	clientConfig := testConfig.Clone()
+	clientConfig.ClientSessionCache = NewLRUClientSessionCache(1)
+
+	testResumeState := func(name string, didResume bool) {
+		t.Helper()
+		ss, cs, err := testHandshake(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Fatalf("%s: handshake failed: %v", name, err)
+		}
+		if ss.DidResume != didResume || cs.DidResume != didResume {
+			t.Fatalf("%s: DidResume = %v (server), %v (client); want %v", name, ss.DidResume, cs.DidResume, didResume)
+		}
+	}
+
+	testResumeState("Handshake", false)
+	if len(store) == 0 {
+		t.Fatal("WrapSession was not called")
+	}
+	testResumeState("Resume", true)
+	if len(extra) != 2 || string(extra[0]) != "app data" || len(extra[1]) != 0 {
+		t.Errorf("got Extra %q after resumption", extra)
+	}
+
+	// A session that is not in the store is not resumed.
+	for k := range store {
+		delete(store, k)
+	}
+	testResumeState("UnknownSession", false)
+	testResumeState("ResumeAgain", true)
+
+	unwrapErr = errors.New("unwrap error")
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); err == nil || !strings.Contains(err.Error(), "unwrap error") {
+		t.Errorf("got error %v, want UnwrapSession error", err)
+	}
+	unwrapErr = nil
+
+	// EncryptTicket and DecryptTicket implement the default behavior.
+	serverConfig.WrapSession = serverConfig.EncryptTicket
+	serverConfig.UnwrapSession = serverConfig.DecryptTicket
+	testResumeState("EncryptTicket", false)
+	testResumeState("DecryptTicket", true)
+	serverConfig.WrapSession = nil
+	serverConfig.UnwrapSession = nil
+	testResumeState("DefaultTicket", true)
+}
+
+func TestExternalPSK(t *testing.T) {
+	key1 := PreSharedKey{Identity: []byte("client 1"), Key: bytes.Repeat([]byte{1}, 32)}
+	key2 := PreSharedKey{Identity: []byte("client 2"), Key: bytes.Repeat([]byte{2}, 32)}
+	serverKeys := map[string]*PreSharedKey{
+		"client 1": &key1,
+		"client 2": &key2,
+	}
+	serverConfig := &Config{
+		GetPreSharedKey: func(identity []byte) (*PreSharedKey, error) {
+			return serverKeys[string(identity)], nil
+		},
+	}
+	clientConfig := &Config{
+		ServerName:         "example.golang",
+		PreSharedKeys:      []PreSharedKey{key1},
+		ClientSessionCache: NewLRUClientSessionCache(1),
+	}
+
+	testPSK := func(name string, identity string) {
+		t.Helper()
+		ss, cs, err := testHandshake(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Fatalf("%s: handshake failed: %v", name, err)
+		}
+		if string(ss.PreSharedKeyIdentity) != identity || string(cs.PreSharedKeyIdentity) != identity {
+			t.Errorf("%s: PreSharedKeyIdentity = %q (server), %q (client); want %q",
+				name, ss.PreSharedKeyIdentity, cs.PreSharedKeyIdentity, identity)
+		}
+		if ss.DidResume || cs.DidResume {
+			t.Errorf("%s: connection was resumed", name)
+		}
+		if identity != "" && (len(ss.PeerCertificates) != 0 || len(cs.PeerCertificates) != 0) {
+			t.Errorf("%s: certificates were sent", name)
+		}
+	}
+
+	// The server needs no certificate.
+	testPSK("Basic", "client 1")
+	if _, ok := clientConfig.ClientSessionCache.Get(clientConfig.ServerName); ok {
+		t.Errorf("client stored a session after an external PSK handshake")
+	}
+
+	clientConfig.PreSharedKeys = []PreSharedKey{{Identity: []byte("unknown"), Key: key1.Key}, key2}
+	testPSK("Second", "client 2")
+
+	// A HelloRetryRequest changes the binders.
+	clientConfig.CurvePreferences = []CurveID{X25519, CurveP256}
+	serverConfig.CurvePreferences = []CurveID{CurveP256}
+	testPSK("HelloRetryRequest", "client 2")
+	clientConfig.CurvePreferences = nil
+	serverConfig.CurvePreferences = nil
+
+	// External PSKs don't depend on session tickets.
+	serverConfig.SessionTicketsDisabled = true
+	testPSK("SessionTicketsDisabled", "client 2")
+	serverConfig.SessionTicketsDisabled = false
+
+	// The client authenticates the server by its certificate when its PSKs
+	// are unknown, and it can then resume the session.
+	clientConfig.PreSharedKeys = []PreSharedKey{{Identity: []byte("unknown"), Key: key1.Key}}
+	serverConfig.Certificates = testConfig.Certificates
+	clientConfig.InsecureSkipVerify = true
+	testPSK("Unknown", "")
+	clientConfig.PreSharedKeys = []PreSharedKey{key1}
+	ss, cs, err := testHandshake(t, clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if !ss.DidResume || !cs.DidResume || ss.PreSharedKeyIdentity != nil || cs.PreSharedKeyIdentity != nil {
+		t.Errorf("external PSK selected over the session being resumed")
+	}
+
+	// A key mismatch is fatal.
+	clientConfig.PreSharedKeys = []PreSharedKey{{Identity: key1.Identity, Key: key2.Key}}
+	clientConfig.ClientSessionCache = nil
+	if _, _, err := testHandshake(t, clientConfig, serverConfig); err == nil || !strings.Contains(err.Error(), "PSK binder") {
+		t.Errorf("got error %v, want invalid PSK binder", err)
+	}
+
+	// The identity is checked.
+	// The client checks its keys before sending the ClientHello.
+	clientConfig.PreSharedKeys = []PreSharedKey{{Key: key1.Key}}
+	c, s := localPipe(t)
+	defer s.Close()
+	if err := Client(c, clientConfig).Handshake(); err == nil || !strings.Contains(err.Error(), "invalid PreSharedKey") {
+		t.Errorf("got error %v, want invalid PreSharedKey", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"crypto/hmac"
 	"crypto/rsa"
 	"errors"
+	"fmt"
 	"hash"
 	"io"
 	"sync/atomic"
@@ -22,6 +23,10 @@ import (
 // messages cause too much work in session ticket decryption attempts.
 const maxClientPSKIdentities = 5
 
+// maxTicketAgeSkew is how far the ticket age reported by a client can be from
+// the actual age of the ticket for the server to accept early data.
+const maxTicketAgeSkew = 10 * time.Second
+
 type serverHandshakeStateTLS13 struct {
 	c               *Conn
 	ctx             context.Context
@@ -32,13 +37,27 @@ type serverHandshakeStateTLS13 struct {
 	suite           *cipherSuiteTLS13
 	cert            *Certificate
 	sigAlg          SignatureScheme
+	earlyData       bool
 	earlySecret     []byte
 	sharedKey       []byte
 	handshakeSecret []byte
+	clientSecret    []byte // client_handshake_traffic_secret
 	masterSecret    []byte
 	trafficSecret   []byte // client_application_traffic_secret_0
 	transcript      hash.Hash
 	clientFinished  []byte
+	echContext      *echServerContext // set if the client offered ECH
+}
+
+// acceptedEarlyData is the state a server keeps after accepting early data,
+// until the client's EndOfEarlyData and Finished messages, which follow the
+// early data, are read by Conn.Read.
+type acceptedEarlyData struct {
+	suite          *cipherSuiteTLS13
+	left           int    // amount of early data the client can still send
+	clientSecret   []byte // client_handshake_traffic_secret
+	trafficSecret  []byte // client_application_traffic_secret_0
+	clientFinished []byte
 }
 
 func (hs *serverHandshakeStateTLS13) handshake() error {
@@ -51,6 +70,9 @@ func (hs *serverHandshakeStateTLS13) handshake() error {
 	if err := hs.checkForResumption(); err != nil {
 		return err
 	}
+	if hs.clientHello.earlyData && !hs.earlyData {
+		hs.skipEarlyData()
+	}
 	if err := hs.pickCertificate(); err != nil {
 		return err
 	}
@@ -73,6 +95,19 @@ func (hs *serverHandshakeStateTLS13) handshake() error {
 	if err := hs.readClientCertificate(); err != nil {
 		return err
 	}
+	if hs.earlyData {
+		// The application reads the early data before the client's second
+		// flight, which is processed by handleEndOfEarlyData.
+		c.acceptedEarlyData = &acceptedEarlyData{
+			suite:          hs.suite,
+			left:           int(c.config.MaxEarlyData),
+			clientSecret:   hs.clientSecret,
+			trafficSecret:  hs.trafficSecret,
+			clientFinished: hs.clientFinished,
+		}
+		atomic.StoreUint32(&c.handshakeStatus, 1)
+		return nil
+	}
 	if err := hs.readClientFinished(); err != nil {
 		return err
 	}
@@ -135,20 +170,23 @@ func (hs *serverHandshakeStateTLS13) processClientHello() error {
 		return errors.New("tls: initial handshake had non-empty renegotiation extension")
 	}
 
-	if hs.clientHello.earlyData {
-		// See RFC 8446, Section 4.2.10 for the complicated behavior required
-		// here. The scenario is that a different server at our address offered
-		// to accept early data in the past, which we can't handle. For now, all
-		// 0-RTT enabled session tickets need to expire before a Go server can
-		// replace a server or join a pool. That's the same requirement that
-		// applies to mixing or replacing with any TLS 1.2 server.
-		c.sendAlert(alertUnsupportedExtension)
-		return errors.New("tls: client sent unexpected early data")
-	}
-
 	hs.hello.sessionId = hs.clientHello.sessionId
 	hs.hello.compressionMethod = compressionNone
 
+	if c.quic != nil {
+		if hs.clientHello.quicTransportParameters == nil {
+			// RFC 9001 Section 8.2.
+			c.sendAlert(alertMissingExtension)
+			return errors.New("tls: client did not send a quic_transport_parameters extension")
+		}
+		c.quicSetTransportParameters(hs.clientHello.quicTransportParameters)
+	} else {
+		if hs.clientHello.quicTransportParameters != nil {
+			c.sendAlert(alertUnsupportedExtension)
+			return errors.New("tls: client sent an unexpected quic_transport_parameters extension")
+		}
+	}
+
 	preferenceList := defaultCipherSuitesTLS13
 	if !hasAESGCMHardwareSupport || !aesgcmPreferred(hs.clientHello.cipherSuites) {
 		preferenceList = defaultCipherSuitesTLS13NoAES
@@ -224,7 +262,7 @@ GroupSelection:
 func (hs *serverHandshakeStateTLS13) checkForResumption() error {
 	c := hs.c
 
-	if c.config.SessionTicketsDisabled {
+	if c.config.SessionTicketsDisabled && c.config.GetPreSharedKey == nil {
 		return nil
 	}
 
@@ -252,45 +290,69 @@ func (hs *serverHandshakeStateTLS13) checkForResumption() error {
 			break
 		}
 
-		plaintext, _ := c.decryptTicket(identity.label)
-		if plaintext == nil {
-			continue
-		}
-		sessionState := new(sessionStateTLS13)
-		if ok := sessionState.unmarshal(plaintext); !ok {
-			continue
+		var sessionState *SessionState
+		if !c.config.SessionTicketsDisabled {
+			var err error
+			sessionState, err = c.unwrapSession(identity.label)
+			if err != nil {
+				c.sendAlert(alertInternalError)
+				return err
+			}
 		}
 
-		createdAt := time.Unix(int64(sessionState.createdAt), 0)
-		if c.config.time().Sub(createdAt) > maxSessionTicketLifetime {
-			continue
-		}
+		var psk []byte
+		var binderLabel string
+		var externalPSK *PreSharedKey
+		if sessionState != nil {
+			if sessionState.version != VersionTLS13 {
+				continue
+			}
 
-		// We don't check the obfuscated ticket age because it's affected by
-		// clock skew and it's only a freshness signal useful for shrinking the
-		// window for replay attacks, which don't affect us as we don't do 0-RTT.
+			createdAt := time.Unix(int64(sessionState.createdAt), 0)
+			if c.config.time().Sub(createdAt) > maxSessionTicketLifetime {
+				continue
+			}
 
-		pskSuite := cipherSuiteTLS13ByID(sessionState.cipherSuite)
-		if pskSuite == nil || pskSuite.hash != hs.suite.hash {
-			continue
-		}
+			pskSuite := cipherSuiteTLS13ByID(sessionState.cipherSuite)
+			if pskSuite == nil || pskSuite.hash != hs.suite.hash {
+				continue
+			}
 
-		// PSK connections don't re-establish client certificates, but carry
-		// them over in the session ticket. Ensure the presence of client certs
-		// in the ticket is consistent with the configured requirements.
-		sessionHasClientCerts := len(sessionState.certificate.Certificate) != 0
-		needClientCerts := requiresClientCert(c.config.ClientAuth)
-		if needClientCerts && !sessionHasClientCerts {
-			continue
-		}
-		if sessionHasClientCerts && c.config.ClientAuth == NoClientCert {
+			// PSK connections don't re-establish client certificates, but carry
+			// them over in the session ticket. Ensure the presence of client certs
+			// in the ticket is consistent with the configured requirements.
+			sessionHasClientCerts := len(sessionState.certificate.Certificate) != 0
+			needClientCerts := requiresClientCert(c.config.ClientAuth)
+			if needClientCerts && !sessionHasClientCerts {
+				continue
+			}
+			if sessionHasClientCerts && c.config.ClientAuth == NoClientCert {
+				continue
+			}
+
+			psk = hs.suite.expandLabel(sessionState.secret, "resumption",
+				nil, hs.suite.hash.Size())
+			binderLabel = resumptionBinderLabel
+		} else if c.config.GetPreSharedKey != nil {
+			var err error
+			externalPSK, err = c.config.GetPreSharedKey(identity.label)
+			if err != nil {
+				c.sendAlert(alertInternalError)
+				return err
+			}
+			// An external PSK authenticates the client, so it is used
+			// regardless of ClientAuth.
+			if externalPSK == nil || hs.suite.hash != crypto.SHA256 {
+				continue
+			}
+			psk = externalPSK.Key
+			binderLabel = externalBinderLabel
+		} else {
 			continue
 		}
 
-		psk := hs.suite.expandLabel(sessionState.resumptionSecret, "resumption",
-			nil, hs.suite.hash.Size())
 		hs.earlySecret = hs.suite.extract(psk, nil)
-		binderKey := hs.suite.deriveSecret(hs.earlySecret, resumptionBinderLabel, nil)
+		binderKey := hs.suite.deriveSecret(hs.earlySecret, binderLabel, nil)
 		// Clone the transcript in case a HelloRetryRequest was recorded.
 		transcript := cloneHash(hs.transcript, hs.suite.hash)
 		if transcript == nil {
@@ -304,20 +366,82 @@ func (hs *serverHandshakeStateTLS13) checkForResumption() error {
 			return errors.New("tls: invalid PSK binder")
 		}
 
+		hs.hello.selectedIdentityPresent = true
+		hs.hello.selectedIdentity = uint16(i)
+		hs.usingPSK = true
+
+		if externalPSK != nil {
+			c.pskIdentity = externalPSK.Identity
+			return nil
+		}
+
 		c.didResume = true
 		if err := c.processCertsFromClient(sessionState.certificate); err != nil {
 			return err
 		}
-
-		hs.hello.selectedIdentityPresent = true
-		hs.hello.selectedIdentity = uint16(i)
-		hs.usingPSK = true
+		// Early data can only be accepted with the first PSK.
+		hs.earlyData = i == 0 && hs.acceptEarlyData(identity, sessionState)
+		c.earlyDataAccepted = hs.earlyData
 		return nil
 	}
 
 	return nil
 }
 
+// acceptEarlyData reports whether the early data offered by the client with
+// the resumed session is accepted. See RFC 8446, Section 4.2.10.
+func (hs *serverHandshakeStateTLS13) acceptEarlyData(identity pskIdentity, sessionState *SessionState) bool {
+	c := hs.c
+
+	if !hs.clientHello.earlyData || c.quic != nil ||
+		c.config.MaxEarlyData == 0 || c.config.AcceptEarlyData == nil {
+		return false
+	}
+
+	// The early data was sent with the parameters of the session, which must
+	// not change.
+	if sessionState.maxEarlyData == 0 || sessionState.maxEarlyData > c.config.MaxEarlyData ||
+		sessionState.cipherSuite != hs.suite.id {
+		return false
+	}
+	if proto, err := negotiateALPN(c.config.NextProtos, hs.clientHello.alpnProtocols, false); err != nil ||
+		proto != sessionState.alpn {
+		return false
+	}
+
+	// Only accept early data from a client that reports an age for the ticket
+	// close to its actual age, which is the time that a replay of the
+	// ClientHello can be accepted for. See RFC 8446, Section 8.3.
+	ticketAge := time.Duration(identity.obfuscatedTicketAge-sessionState.ageAdd) * time.Millisecond
+	expectedAge := c.config.time().Sub(time.Unix(int64(sessionState.createdAt), 0))
+	if d := expectedAge - ticketAge; d < -maxTicketAgeSkew || d > maxTicketAgeSkew {
+		return false
+	}
+
+	return c.config.AcceptEarlyData(&EarlyDataInfo{
+		ClientHello: clientHelloInfo(hs.ctx, c, hs.clientHello),
+		Random:      hs.clientHello.random,
+		TicketAge:   ticketAge,
+	})
+}
+
+// skipEarlyData makes the server discard the early data that the client sent
+// with its ClientHello, which was rejected. Up to MaxEarlyData bytes are
+// discarded, or a full record if MaxEarlyData is lower, in case a different
+// server allowed early data in the ticket the client used.
+func (hs *serverHandshakeStateTLS13) skipEarlyData() {
+	c := hs.c
+
+	// QUIC transports discard rejected 0-RTT packets themselves.
+	if c.quic != nil {
+		return
+	}
+	c.earlyDataSkip = int(c.config.MaxEarlyData)
+	if c.earlyDataSkip < maxPlaintext {
+		c.earlyDataSkip = maxPlaintext
+	}
+}
+
 // cloneHash uses the encoding.BinaryMarshaler and encoding.BinaryUnmarshaler
 // interfaces implemented by standard library hashes to clone the state of in
 // to a new instance of h. It returns nil if the operation fails.
@@ -383,6 +507,9 @@ func (hs *serverHandshakeStateTLS13) pickCertificate() error {
 // sendDummyChangeCipherSpec sends a ChangeCipherSpec record for compatibility
 // with middleboxes that didn't implement TLS correctly. See RFC 8446, Appendix D.4.
 func (hs *serverHandshakeStateTLS13) sendDummyChangeCipherSpec() error {
+	if hs.c.quic != nil {
+		return nil
+	}
 	if hs.sentDummyCCS {
 		return nil
 	}
@@ -413,6 +540,19 @@ func (hs *serverHandshakeStateTLS13) doHelloRetryRequest(selectedGroup CurveID)
 		selectedGroup:     selectedGroup,
 	}
 
+	// ECH acceptance is confirmed in an extension of the HelloRetryRequest.
+	// See draft-ietf-tls-esni-18, Section 7.2.1.
+	if c.echAccepted {
+		transcript := cloneHash(hs.transcript, hs.suite.hash)
+		if transcript == nil {
+			c.sendAlert(alertInternalError)
+			return errors.New("tls: internal error: failed to clone hash")
+		}
+		helloRetryRequest.encryptedClientHello = echAcceptConfirmation(hs.suite,
+			hs.clientHello.random, echHRRAcceptConfirmationLabel, transcript,
+			serverHelloWithoutConfirmation(helloRetryRequest, true))
+	}
+
 	hs.transcript.Write(helloRetryRequest.marshal())
 	if _, err := c.writeRecord(recordTypeHandshake, helloRetryRequest.marshal()); err != nil {
 		return err
@@ -422,6 +562,10 @@ func (hs *serverHandshakeStateTLS13) doHelloRetryRequest(selectedGroup CurveID)
 		return err
 	}
 
+	if hs.clientHello.earlyData {
+		hs.skipEarlyData()
+	}
+
 	msg, err := c.readHandshake()
 	if err != nil {
 		return err
@@ -433,6 +577,13 @@ func (hs *serverHandshakeStateTLS13) doHelloRetryRequest(selectedGroup CurveID)
 		return unexpectedMessageError(clientHello, msg)
 	}
 
+	if c.echAccepted {
+		clientHello, err = c.openSecondECHHello(hs.echContext, clientHello)
+		if err != nil {
+			return err
+		}
+	}
+
 	if len(clientHello.keyShares) != 1 || clientHello.keyShares[0].group != selectedGroup {
 		c.sendAlert(alertIllegalParameter)
 		return errors.New("tls: client sent invalid key share in second ClientHello")
@@ -514,6 +665,33 @@ func (hs *serverHandshakeStateTLS13) sendServerParameters() error {
 	c := hs.c
 
 	hs.transcript.Write(hs.clientHello.marshal())
+
+	// Early data follows the ClientHello, and is read before the handshake
+	// messages that follow it.
+	if hs.earlyData {
+		earlyTrafficSecret := hs.suite.deriveSecret(hs.earlySecret,
+			clientEarlyTrafficLabel, hs.transcript)
+		c.in.setTrafficSecret(hs.suite, QUICEncryptionLevelEarly, earlyTrafficSecret)
+		err := c.config.writeKeyLog(keyLogLabelClientEarly, hs.clientHello.random, earlyTrafficSecret)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+	}
+
+	// The last bytes of the random of the ServerHello confirm ECH acceptance.
+	// See draft-ietf-tls-esni-18, Section 7.2.
+	if c.echAccepted {
+		transcript := cloneHash(hs.transcript, hs.suite.hash)
+		if transcript == nil {
+			c.sendAlert(alertInternalError)
+			return errors.New("tls: internal error: failed to clone hash")
+		}
+		copy(hs.hello.random[32-echConfirmationLength:], echAcceptConfirmation(hs.suite,
+			hs.clientHello.random, echAcceptConfirmationLabel, transcript,
+			serverHelloWithoutConfirmation(hs.hello, false)))
+	}
+
 	hs.transcript.Write(hs.hello.marshal())
 	if _, err := c.writeRecord(recordTypeHandshake, hs.hello.marshal()); err != nil {
 		return err
@@ -532,10 +710,21 @@ func (hs *serverHandshakeStateTLS13) sendServerParameters() error {
 
 	clientSecret := hs.suite.deriveSecret(hs.handshakeSecret,
 		clientHandshakeTrafficLabel, hs.transcript)
-	c.in.setTrafficSecret(hs.suite, clientSecret)
+	hs.clientSecret = clientSecret
+	if !hs.earlyData {
+		c.in.setTrafficSecret(hs.suite, QUICEncryptionLevelHandshake, clientSecret)
+	}
 	serverSecret := hs.suite.deriveSecret(hs.handshakeSecret,
 		serverHandshakeTrafficLabel, hs.transcript)
-	c.out.setTrafficSecret(hs.suite, serverSecret)
+	c.out.setTrafficSecret(hs.suite, QUICEncryptionLevelHandshake, serverSecret)
+
+	if c.quic != nil {
+		if c.hand.Len() != 0 {
+			c.sendAlert(alertUnexpectedMessage)
+		}
+		c.quicSetWriteSecret(QUICEncryptionLevelHandshake, hs.suite.id, serverSecret)
+		c.quicSetReadSecret(QUICEncryptionLevelHandshake, hs.suite.id, clientSecret)
+	}
 
 	err := c.config.writeKeyLog(keyLogLabelClientHandshake, hs.clientHello.random, clientSecret)
 	if err != nil {
@@ -550,13 +739,25 @@ func (hs *serverHandshakeStateTLS13) sendServerParameters() error {
 
 	encryptedExtensions := new(encryptedExtensionsMsg)
 
-	selectedProto, err := negotiateALPN(c.config.NextProtos, hs.clientHello.alpnProtocols)
+	selectedProto, err := negotiateALPN(c.config.NextProtos, hs.clientHello.alpnProtocols, c.quic != nil)
 	if err != nil {
 		c.sendAlert(alertNoApplicationProtocol)
 		return err
 	}
 	encryptedExtensions.alpnProtocol = selectedProto
 	c.clientProtocol = selectedProto
+	encryptedExtensions.earlyData = hs.earlyData
+	if hs.echContext != nil && !c.echAccepted {
+		encryptedExtensions.echRetryConfigs = hs.echContext.retryConfigs
+	}
+
+	if c.quic != nil {
+		p, err := c.quicGetTransportParameters()
+		if err != nil {
+			return err
+		}
+		encryptedExtensions.quicTransportParameters = p
+	}
 
 	hs.transcript.Write(encryptedExtensions.marshal())
 	if _, err := c.writeRecord(recordTypeHandshake, encryptedExtensions.marshal()); err != nil {
@@ -661,7 +862,14 @@ func (hs *serverHandshakeStateTLS13) sendServerFinished() error {
 		clientApplicationTrafficLabel, hs.transcript)
 	serverSecret := hs.suite.deriveSecret(hs.masterSecret,
 		serverApplicationTrafficLabel, hs.transcript)
-	c.out.setTrafficSecret(hs.suite, serverSecret)
+	c.out.setTrafficSecret(hs.suite, QUICEncryptionLevelApplication, serverSecret)
+
+	if c.quic != nil {
+		if c.hand.Len() != 0 {
+			c.sendAlert(alertUnexpectedMessage)
+		}
+		c.quicSetWriteSecret(QUICEncryptionLevelApplication, hs.suite.id, serverSecret)
+	}
 
 	err := c.config.writeKeyLog(keyLogLabelClientTraffic, hs.clientHello.random, hs.trafficSecret)
 	if err != nil {
@@ -693,6 +901,11 @@ func (hs *serverHandshakeStateTLS13) shouldSendSessionTickets() bool {
 		return false
 	}
 
+	// The client can use the external PSK again instead.
+	if hs.c.pskIdentity != nil {
+		return false
+	}
+
 	// Don't send tickets the client wouldn't use. See RFC 8446, Section 4.2.9.
 	for _, pskMode := range hs.clientHello.pskModes {
 		if pskMode == pskModeDHE {
@@ -705,7 +918,13 @@ func (hs *serverHandshakeStateTLS13) shouldSendSessionTickets() bool {
 func (hs *serverHandshakeStateTLS13) sendSessionTickets() error {
 	c := hs.c
 
-	hs.clientFinished = hs.suite.finishedHash(c.in.trafficSecret, hs.transcript)
+	// The client sends EndOfEarlyData before its Finished if early data
+	// was accepted.
+	if hs.earlyData {
+		hs.transcript.Write(new(endOfEarlyDataMsg).marshal())
+	}
+
+	hs.clientFinished = hs.suite.finishedHash(hs.clientSecret, hs.transcript)
 	finishedMsg := &finishedMsg{
 		verifyData: hs.clientFinished,
 	}
@@ -724,10 +943,25 @@ func (hs *serverHandshakeStateTLS13) sendSessionTickets() error {
 	for _, cert := range c.peerCertificates {
 		certsFromClient = append(certsFromClient, cert.Raw)
 	}
-	state := sessionStateTLS13{
-		cipherSuite:      hs.suite.id,
-		createdAt:        uint64(c.config.time().Unix()),
-		resumptionSecret: resumptionSecret,
+	ageAdd := make([]byte, 4)
+	if _, err := io.ReadFull(c.config.rand(), ageAdd); err != nil {
+		c.sendAlert(alertInternalError)
+		return err
+	}
+	m.ageAdd = uint32(ageAdd[0])<<24 | uint32(ageAdd[1])<<16 | uint32(ageAdd[2])<<8 | uint32(ageAdd[3])
+	// Only offer early data if the application decides what to accept.
+	if c.quic == nil && c.config.AcceptEarlyData != nil {
+		m.maxEarlyData = c.config.MaxEarlyData
+	}
+
+	state := &SessionState{
+		version:      VersionTLS13,
+		cipherSuite:  hs.suite.id,
+		createdAt:    uint64(c.config.time().Unix()),
+		ageAdd:       m.ageAdd,
+		maxEarlyData: m.maxEarlyData,
+		alpn:         c.clientProtocol,
+		secret:       resumptionSecret,
 		certificate: Certificate{
 			Certificate:                 certsFromClient,
 			OCSPStaple:                  c.ocspResponse,
@@ -735,7 +969,7 @@ func (hs *serverHandshakeStateTLS13) sendSessionTickets() error {
 		},
 	}
 	var err error
-	m.label, err = c.encryptTicket(state.marshal())
+	m.label, err = c.wrapSession(state)
 	if err != nil {
 		return err
 	}
@@ -852,7 +1086,38 @@ func (hs *serverHandshakeStateTLS13) readClientFinished() error {
 		return errors.New("tls: invalid client finished hash")
 	}
 
-	c.in.setTrafficSecret(hs.suite, hs.trafficSecret)
+	c.in.setTrafficSecret(hs.suite, QUICEncryptionLevelApplication, hs.trafficSecret)
+
+	if c.quic != nil {
+		c.quicSetReadSecret(QUICEncryptionLevelApplication, hs.suite.id, hs.trafficSecret)
+	}
 
 	return nil
 }
+
+// handleEndOfEarlyData processes the client's EndOfEarlyData and Finished
+// messages after the server accepted early data, completing the handshake.
+func (c *Conn) handleEndOfEarlyData(msg interface{}) error {
+	a := c.acceptedEarlyData
+
+	switch msg := msg.(type) {
+	case *endOfEarlyDataMsg:
+		if c.in.level == QUICEncryptionLevelEarly {
+			c.in.setTrafficSecret(a.suite, QUICEncryptionLevelHandshake, a.clientSecret)
+			return nil
+		}
+	case *finishedMsg:
+		if c.in.level == QUICEncryptionLevelHandshake {
+			if !hmac.Equal(a.clientFinished, msg.verifyData) {
+				c.sendAlert(alertDecryptError)
+				return c.in.setErrorLocked(errors.New("tls: invalid client finished hash"))
+			}
+			c.in.setTrafficSecret(a.suite, QUICEncryptionLevelApplication, a.trafficSecret)
+			c.acceptedEarlyData = nil
+			return nil
+		}
+	}
+
+	c.sendAlert(alertUnexpectedMessage)
+	return c.in.setErrorLocked(fmt.Errorf("tls: received unexpected handshake message of type %T after early data", msg))
+}
@@ -22,6 +22,8 @@ import (
 
 const (
 	resumptionBinderLabel         = "res binder"
+	externalBinderLabel           = "ext binder"
+	clientEarlyTrafficLabel       = "c e traffic"
 	clientHandshakeTrafficLabel   = "c hs traffic"
 	serverHandshakeTrafficLabel   = "s hs traffic"
 	clientApplicationTrafficLabel = "c ap traffic"
@@ -17,51 +17,169 @@ import (
 	"golang.org/x/crypto/cryptobyte"
 )
 
-// sessionState contains the information that is serialized into a session
-// ticket in order to later resume a connection.
-type sessionState struct {
-	vers         uint16
-	cipherSuite  uint16
-	createdAt    uint64
-	masterSecret []byte // opaque master_secret<1..2^16-1>;
-	// struct { opaque certificate<1..2^24-1> } Certificate;
-	certificates [][]byte // Certificate certificate_list<0..2^24-1>;
+// A SessionState is a resumable session, which a server sends to the client
+// in a session ticket, and which the client sends back to resume it.
+//
+// By default, the server encrypts the encoding of the SessionState with its
+// session ticket keys to produce the ticket (see Config.EncryptTicket). A
+// server can instead wrap the session itself with Config.WrapSession, for
+// example by storing it in a database shared with other servers and using
+// its key as the ticket.
+type SessionState struct {
+	// Extra is ignored by crypto/tls, but is encoded by Bytes and parsed by
+	// ParseSessionState. It allows a server to attach application data to a
+	// session in WrapSession, and to retrieve it in UnwrapSession when the
+	// session is resumed.
+	Extra [][]byte
+
+	version     uint16
+	cipherSuite uint16
+	createdAt   uint64
+	// secret is the master secret in TLS 1.2 and earlier, or the resumption
+	// master secret in TLS 1.3.
+	secret []byte
+	// certificate holds the client certificates, and in TLS 1.3 the OCSP
+	// response and SCTs sent by the server.
+	certificate Certificate
+
+	// TLS 1.3 fields, only encoded for sessions that allow early data.
+	ageAdd       uint32
+	maxEarlyData uint32
+	alpn         string
 
 	// usedOldKey is true if the ticket from which this session came from
 	// was encrypted with an older key and thus should be refreshed.
 	usedOldKey bool
 }
 
-func (m *sessionState) marshal() []byte {
+// Bytes encodes the session, including any application data from Extra.
+// The encoding contains the session's secrets and must be kept
+// confidential, and it should be authenticated before being parsed by
+// ParseSessionState.
+func (s *SessionState) Bytes() ([]byte, error) {
 	var b cryptobyte.Builder
-	b.AddUint16(m.vers)
-	b.AddUint16(m.cipherSuite)
-	addUint64(&b, m.createdAt)
+	if s.version == VersionTLS13 {
+		s.marshalTLS13(&b)
+	} else {
+		s.marshalTLS12(&b)
+	}
+	// The application data is appended to the encoding of sessions without
+	// it, which predates it.
+	if len(s.Extra) > 0 {
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, extra := range s.Extra {
+				b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddBytes(extra)
+				})
+			}
+		})
+	}
+	return b.Bytes()
+}
+
+// The encoding of a TLS 1.2 session is
+//
+//	uint16 version;
+//	uint16 cipher_suite;
+//	uint64 created_at;
+//	opaque master_secret<1..2^16-1>;
+//	Certificate certificate_list<0..2^24-1>;
+//	opaque extra<1..2^24-1>; (if present)
+func (s *SessionState) marshalTLS12(b *cryptobyte.Builder) {
+	b.AddUint16(s.version)
+	b.AddUint16(s.cipherSuite)
+	addUint64(b, s.createdAt)
 	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
-		b.AddBytes(m.masterSecret)
+		b.AddBytes(s.secret)
 	})
 	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
-		for _, cert := range m.certificates {
+		for _, cert := range s.certificate.Certificate {
 			b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
 				b.AddBytes(cert)
 			})
 		}
 	})
-	return b.BytesOrPanic()
 }
 
-func (m *sessionState) unmarshal(data []byte) bool {
-	*m = sessionState{usedOldKey: m.usedOldKey}
-	s := cryptobyte.String(data)
-	if ok := s.ReadUint16(&m.vers) &&
-		s.ReadUint16(&m.cipherSuite) &&
-		readUint64(&s, &m.createdAt) &&
-		readUint16LengthPrefixed(&s, &m.masterSecret) &&
-		len(m.masterSecret) != 0; !ok {
+// The encoding of a TLS 1.3 session has two revisions. The first one doesn't
+// carry any of the information needed for 0-RTT validation. Revision 1 adds
+// the ticket's obfuscation factor and early data limit, and the negotiated
+// ALPN protocol. It is only used for sessions that allow early data, so that
+// servers that don't know about it can still resume the other sessions.
+//
+//	uint16 version = 0x0304;
+//	uint8 revision = 0 or 1;
+//	uint16 cipher_suite;
+//	uint64 created_at;
+//	uint32 age_add;                 (revision 1)
+//	uint32 max_early_data;          (revision 1, not zero)
+//	opaque alpn<0..2^8-1>;          (revision 1)
+//	opaque resumption_master_secret<1..2^8-1>;
+//	CertificateEntry certificate_list<0..2^24-1>;
+//	opaque extra<1..2^24-1>;        (if present)
+func (s *SessionState) marshalTLS13(b *cryptobyte.Builder) {
+	b.AddUint16(VersionTLS13)
+	if s.maxEarlyData == 0 {
+		b.AddUint8(0) // revision
+		b.AddUint16(s.cipherSuite)
+		addUint64(b, s.createdAt)
+	} else {
+		b.AddUint8(1) // revision
+		b.AddUint16(s.cipherSuite)
+		addUint64(b, s.createdAt)
+		b.AddUint32(s.ageAdd)
+		b.AddUint32(s.maxEarlyData)
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes([]byte(s.alpn))
+		})
+	}
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(s.secret)
+	})
+	marshalCertificate(b, s.certificate)
+}
+
+// ParseSessionState parses a SessionState encoded by Bytes.
+func ParseSessionState(data []byte) (*SessionState, error) {
+	s := new(SessionState)
+	in := cryptobyte.String(data)
+	var version uint16
+	var ok bool
+	if peek := in; peek.ReadUint16(&version) && version == VersionTLS13 {
+		ok = s.unmarshalTLS13(&in)
+	} else {
+		ok = s.unmarshalTLS12(&in)
+	}
+	if !ok {
+		return nil, errors.New("tls: invalid session encoding")
+	}
+	if !in.Empty() {
+		var extraList cryptobyte.String
+		if !in.ReadUint24LengthPrefixed(&extraList) || extraList.Empty() || !in.Empty() {
+			return nil, errors.New("tls: invalid session encoding")
+		}
+		for !extraList.Empty() {
+			var extra []byte
+			if !readUint24LengthPrefixed(&extraList, &extra) {
+				return nil, errors.New("tls: invalid session encoding")
+			}
+			s.Extra = append(s.Extra, extra)
+		}
+	}
+	return s, nil
+}
+
+func (s *SessionState) unmarshalTLS12(in *cryptobyte.String) bool {
+	if !in.ReadUint16(&s.version) ||
+		s.version == VersionTLS13 ||
+		!in.ReadUint16(&s.cipherSuite) ||
+		!readUint64(in, &s.createdAt) ||
+		!readUint16LengthPrefixed(in, &s.secret) ||
+		len(s.secret) == 0 {
 		return false
 	}
 	var certList cryptobyte.String
-	if !s.ReadUint24LengthPrefixed(&certList) {
+	if !in.ReadUint24LengthPrefixed(&certList) {
 		return false
 	}
 	for !certList.Empty() {
@@ -69,55 +187,48 @@ func (m *sessionState) unmarshal(data []byte) bool {
 		if !readUint24LengthPrefixed(&certList, &cert) {
 			return false
 		}
-		m.certificates = append(m.certificates, cert)
+		s.certificate.Certificate = append(s.certificate.Certificate, cert)
 	}
-	return s.Empty()
-}
-
-// sessionStateTLS13 is the content of a TLS 1.3 session ticket. Its first
-// version (revision = 0) doesn't carry any of the information needed for 0-RTT
-// validation and the nonce is always empty.
-type sessionStateTLS13 struct {
-	// uint8 version  = 0x0304;
-	// uint8 revision = 0;
-	cipherSuite      uint16
-	createdAt        uint64
-	resumptionSecret []byte      // opaque resumption_master_secret<1..2^8-1>;
-	certificate      Certificate // CertificateEntry certificate_list<0..2^24-1>;
+	return true
 }
 
-func (m *sessionStateTLS13) marshal() []byte {
-	var b cryptobyte.Builder
-	b.AddUint16(VersionTLS13)
-	b.AddUint8(0) // revision
-	b.AddUint16(m.cipherSuite)
-	addUint64(&b, m.createdAt)
-	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
-		b.AddBytes(m.resumptionSecret)
-	})
-	marshalCertificate(&b, m.certificate)
-	return b.BytesOrPanic()
+func (s *SessionState) unmarshalTLS13(in *cryptobyte.String) bool {
+	var revision uint8
+	if !in.ReadUint16(&s.version) ||
+		s.version != VersionTLS13 ||
+		!in.ReadUint8(&revision) ||
+		revision > 1 ||
+		!in.ReadUint16(&s.cipherSuite) ||
+		!readUint64(in, &s.createdAt) {
+		return false
+	}
+	if revision == 1 {
+		var alpn []byte
+		if !in.ReadUint32(&s.ageAdd) ||
+			!in.ReadUint32(&s.maxEarlyData) || s.maxEarlyData == 0 ||
+			!readUint8LengthPrefixed(in, &alpn) {
+			return false
+		}
+		s.alpn = string(alpn)
+	}
+	return readUint8LengthPrefixed(in, &s.secret) &&
+		len(s.secret) != 0 &&
+		unmarshalCertificate(in, &s.certificate)
 }
 
-func (m *sessionStateTLS13) unmarshal(data []byte) bool {
-	*m = sessionStateTLS13{}
-	s := cryptobyte.String(data)
-	var version uint16
-	var revision uint8
-	return s.ReadUint16(&version) &&
-		version == VersionTLS13 &&
-		s.ReadUint8(&revision) &&
-		revision == 0 &&
-		s.ReadUint16(&m.cipherSuite) &&
-		readUint64(&s, &m.createdAt) &&
-		readUint8LengthPrefixed(&s, &m.resumptionSecret) &&
-		len(m.resumptionSecret) != 0 &&
-		unmarshalCertificate(&s, &m.certificate) &&
-		s.Empty()
+// EncryptTicket encrypts a ticket with the Config's configured (or default)
+// session ticket keys. It can be used as a Config.WrapSession implementation.
+func (c *Config) EncryptTicket(cs ConnectionState, ss *SessionState) ([]byte, error) {
+	ticketKeys := c.ticketKeys(nil)
+	stateBytes, err := ss.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return c.encryptTicket(stateBytes, ticketKeys)
 }
 
-func (c *Conn) encryptTicket(state []byte) ([]byte, error) {
-	if len(c.ticketKeys) == 0 {
+func (c *Config) encryptTicket(state []byte, ticketKeys []ticketKey) ([]byte, error) {
+	if len(ticketKeys) == 0 {
 		return nil, errors.New("tls: internal error: session ticket keys unavailable")
 	}
 
@@ -126,10 +237,10 @@ func (c *Conn) encryptTicket(state []byte) ([]byte, error) {
 	iv := encrypted[ticketKeyNameLen : ticketKeyNameLen+aes.BlockSize]
 	macBytes := encrypted[len(encrypted)-sha256.Size:]
 
-	if _, err := io.ReadFull(c.config.rand(), iv); err != nil {
+	if _, err := io.ReadFull(c.rand(), iv); err != nil {
 		return nil, err
 	}
-	key := c.ticketKeys[0]
+	key := ticketKeys[0]
 	copy(keyName, key.keyName[:])
 	block, err := aes.NewCipher(key.aesKey[:])
 	if err != nil {
@@ -144,9 +255,18 @@ func (c *Conn) encryptTicket(state []byte) ([]byte, error) {
 	return encrypted, nil
 }
 
-func (c *Conn) decryptTicket(encrypted []byte) (plaintext []byte, usedOldKey bool) {
+// DecryptTicket decrypts a ticket encrypted by Config.EncryptTicket. It can
+// be used as a Config.UnwrapSession implementation.
+//
+// If the ticket can't be decrypted or parsed, DecryptTicket returns (nil, nil).
+func (c *Config) DecryptTicket(identity []byte, cs ConnectionState) (*SessionState, error) {
+	ticketKeys := c.ticketKeys(nil)
+	return c.decryptTicket(identity, ticketKeys), nil
+}
+
+func (c *Config) decryptTicket(encrypted []byte, ticketKeys []ticketKey) *SessionState {
 	if len(encrypted) < ticketKeyNameLen+aes.BlockSize+sha256.Size {
-		return nil, false
+		return nil
 	}
 
 	keyName := encrypted[:ticketKeyNameLen]
@@ -155,31 +275,58 @@ func (c *Conn) decryptTicket(encrypted []byte) (plaintext []byte, usedOldKey boo
 	ciphertext := encrypted[ticketKeyNameLen+aes.BlockSize : len(encrypted)-sha256.Size]
 
 	keyIndex := -1
-	for i, candidateKey := range c.ticketKeys {
+	for i, candidateKey := range ticketKeys {
 		if bytes.Equal(keyName, candidateKey.keyName[:]) {
 			keyIndex = i
 			break
 		}
 	}
 	if keyIndex == -1 {
-		return nil, false
+		return nil
 	}
-	key := &c.ticketKeys[keyIndex]
+	key := &ticketKeys[keyIndex]
 
 	mac := hmac.New(sha256.New, key.hmacKey[:])
 	mac.Write(encrypted[:len(encrypted)-sha256.Size])
 	expected := mac.Sum(nil)
 
 	if subtle.ConstantTimeCompare(macBytes, expected) != 1 {
-		return nil, false
+		return nil
 	}
 
 	block, err := aes.NewCipher(key.aesKey[:])
 	if err != nil {
-		return nil, false
+		return nil
 	}
-	plaintext = make([]byte, len(ciphertext))
+	plaintext := make([]byte, len(ciphertext))
 	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
 
-	return plaintext, keyIndex > 0
+	s, err := ParseSessionState(plaintext)
+	if err != nil {
+		return nil
+	}
+	s.usedOldKey = keyIndex > 0
+	return s
+}
+
+// wrapSession returns the session ticket for s, produced by
+// Config.WrapSession or encrypted with the connection's ticket keys.
+func (c *Conn) wrapSession(s *SessionState) ([]byte, error) {
+	if c.config.WrapSession != nil {
+		return c.config.WrapSession(c.connectionStateLocked(), s)
+	}
+	stateBytes, err := s.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return c.config.encryptTicket(stateBytes, c.ticketKeys)
+}
+
+// unwrapSession returns the session in a session ticket or PSK identity
+// sent by the client, or nil if there is none.
+func (c *Conn) unwrapSession(identity []byte) (*SessionState, error) {
+	if c.config.UnwrapSession != nil {
+		return c.config.UnwrapSession(identity, c.connectionStateLocked())
+	}
+	return c.config.decryptTicket(identity, c.ticketKeys), nil
 }
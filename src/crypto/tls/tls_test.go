@@ -734,7 +734,7 @@ func TestWarningAlertFlood(t *testing.T) {
 }
 
 func TestCloneFuncFields(t *testing.T) {
-	const expectedCount = 6
+	const expectedCount = 11
 	called := 0
 
 	c1 := Config{
@@ -762,6 +762,26 @@ func TestCloneFuncFields(t *testing.T) {
 			called |= 1 << 5
 			return nil
 		},
+		AcceptEarlyData: func(*EarlyDataInfo) bool {
+			called |= 1 << 6
+			return true
+		},
+		WrapSession: func(ConnectionState, *SessionState) ([]byte, error) {
+			called |= 1 << 7
+			return nil, nil
+		},
+		UnwrapSession: func([]byte, ConnectionState) (*SessionState, error) {
+			called |= 1 << 8
+			return nil, nil
+		},
+		GetPreSharedKey: func([]byte) (*PreSharedKey, error) {
+			called |= 1 << 9
+			return nil, nil
+		},
+		EncryptedClientHelloRejectionVerify: func(ConnectionState) error {
+			called |= 1 << 10
+			return nil
+		},
 	}
 
 	c2 := c1.Clone()
@@ -772,6 +792,11 @@ func TestCloneFuncFields(t *testing.T) {
 	c2.GetConfigForClient(nil)
 	c2.VerifyPeerCertificate(nil, nil)
 	c2.VerifyConnection(ConnectionState{})
+	c2.AcceptEarlyData(nil)
+	c2.WrapSession(ConnectionState{}, nil)
+	c2.UnwrapSession(nil, ConnectionState{})
+	c2.GetPreSharedKey(nil)
+	c2.EncryptedClientHelloRejectionVerify(ConnectionState{})
 
 	if called != (1<<expectedCount)-1 {
 		t.Fatalf("expected %d calls but saw calls %b", expectedCount, called)
@@ -790,7 +815,8 @@ func TestCloneNonFuncFields(t *testing.T) {
 		switch fn := typ.Field(i).Name; fn {
 		case "Rand":
 			f.Set(reflect.ValueOf(io.Reader(os.Stdin)))
-		case "Time", "GetCertificate", "GetConfigForClient", "VerifyPeerCertificate", "VerifyConnection", "GetClientCertificate":
+		case "Time", "GetCertificate", "GetConfigForClient", "VerifyPeerCertificate", "VerifyConnection", "GetClientCertificate", "AcceptEarlyData",
+			"WrapSession", "UnwrapSession", "GetPreSharedKey", "EncryptedClientHelloRejectionVerify":
 			// DeepEqual can't compare functions. If you add a
 			// function field to this list, you must also change
 			// TestCloneFuncFields to ensure that the func field is
@@ -813,10 +839,18 @@ func TestCloneNonFuncFields(t *testing.T) {
 			f.Set(reflect.ValueOf("b"))
 		case "ClientAuth":
 			f.Set(reflect.ValueOf(VerifyClientCertIfGiven))
-		case "InsecureSkipVerify", "SessionTicketsDisabled", "DynamicRecordSizingDisabled", "PreferServerCipherSuites":
+		case "InsecureSkipVerify", "SessionTicketsDisabled", "DynamicRecordSizingDisabled", "PreferServerCipherSuites", "EnableEarlyData":
 			f.Set(reflect.ValueOf(true))
 		case "MinVersion", "MaxVersion":
 			f.Set(reflect.ValueOf(uint16(VersionTLS12)))
+		case "PreSharedKeys":
+			f.Set(reflect.ValueOf([]PreSharedKey{{Identity: []byte("a"), Key: []byte("b")}}))
+		case "EncryptedClientHelloConfigList":
+			f.Set(reflect.ValueOf([]byte{'e', 'c', 'h'}))
+		case "EncryptedClientHelloKeys":
+			f.Set(reflect.ValueOf([]EncryptedClientHelloKey{{Config: []byte{'c'}, PrivateKey: []byte{'k'}}}))
+		case "MaxEarlyData":
+			f.Set(reflect.ValueOf(uint32(16384)))
 		case "SessionTicketKey":
 			f.Set(reflect.ValueOf([32]byte{}))
 		case "CipherSuites":
@@ -40,6 +40,10 @@ type lazyCert struct {
 	// fewer allocations.
 	rawSubject []byte
 
+	// rawSum224 is sum224(cert.Raw), used by AddPool for duplicate
+	// detection without calling getCert.
+	rawSum224 sum224
+
 	// getCert returns the certificate.
 	//
 	// It is not meant to do network operations or anything else
@@ -49,6 +53,10 @@ type lazyCert struct {
 	// case where a cert file existed on local disk when the program
 	// started up is deleted later before it's read.
 	getCert func() (*Certificate, error)
+
+	// constraint is an optional function that Verify calls on every
+	// chain ending in this certificate, as added by AddCertWithConstraint.
+	constraint func([]*Certificate) error
 }
 
 // NewCertPool returns a new, empty CertPool.
@@ -101,7 +109,8 @@ func (s *CertPool) copy() *CertPool {
 // Any mutations to the returned pool are not written to disk and do not affect
 // any other pool returned by SystemCertPool.
 //
-// New changes in the system cert pool might not be reflected in subsequent calls.
+// The system cert pool is loaded once and cached. Changes to the system
+// cert pool are only reflected in subsequent calls after ReloadSystemRoots.
 func SystemCertPool() (*CertPool, error) {
 	if runtime.GOOS == "windows" {
 		// Issue 16736, 18609:
@@ -115,9 +124,33 @@ func SystemCertPool() (*CertPool, error) {
 	return loadSystemRoots()
 }
 
-// findPotentialParents returns the indexes of certificates in s which might
-// have signed cert.
-func (s *CertPool) findPotentialParents(cert *Certificate) []*Certificate {
+// equal reports whether s and other contain the same certificates.
+// Constraints are not compared.
+func (s *CertPool) equal(other *CertPool) bool {
+	if s.len() != other.len() {
+		return false
+	}
+	if s == nil {
+		return true
+	}
+	for sum := range s.haveSum {
+		if !other.haveSum[sum] {
+			return false
+		}
+	}
+	return true
+}
+
+// potentialParent is a candidate issuer returned by findPotentialParents,
+// along with its constraint, if any.
+type potentialParent struct {
+	cert       *Certificate
+	constraint func([]*Certificate) error
+}
+
+// findPotentialParents returns the certificates in s which might have signed
+// cert.
+func (s *CertPool) findPotentialParents(cert *Certificate) []potentialParent {
 	if s == nil {
 		return nil
 	}
@@ -128,18 +161,19 @@ func (s *CertPool) findPotentialParents(cert *Certificate) []*Certificate {
 	//   AKID and SKID match
 	//   AKID present, SKID missing / AKID missing, SKID present
 	//   AKID and SKID don't match
-	var matchingKeyID, oneKeyID, mismatchKeyID []*Certificate
+	var matchingKeyID, oneKeyID, mismatchKeyID []potentialParent
 	for _, c := range s.byName[string(cert.RawIssuer)] {
-		candidate, err := s.cert(c)
+		candidateCert, err := s.cert(c)
 		if err != nil {
 			continue
 		}
-		kidMatch := bytes.Equal(candidate.SubjectKeyId, cert.AuthorityKeyId)
+		candidate := potentialParent{candidateCert, s.lazyCerts[c].constraint}
+		kidMatch := bytes.Equal(candidateCert.SubjectKeyId, cert.AuthorityKeyId)
 		switch {
 		case kidMatch:
 			matchingKeyID = append(matchingKeyID, candidate)
-		case (len(candidate.SubjectKeyId) == 0 && len(cert.AuthorityKeyId) > 0) ||
-			(len(candidate.SubjectKeyId) > 0 && len(cert.AuthorityKeyId) == 0):
+		case (len(candidateCert.SubjectKeyId) == 0 && len(cert.AuthorityKeyId) > 0) ||
+			(len(candidateCert.SubjectKeyId) > 0 && len(cert.AuthorityKeyId) == 0):
 			oneKeyID = append(oneKeyID, candidate)
 		default:
 			mismatchKeyID = append(mismatchKeyID, candidate)
@@ -150,7 +184,7 @@ func (s *CertPool) findPotentialParents(cert *Certificate) []*Certificate {
 	if found == 0 {
 		return nil
 	}
-	candidates := make([]*Certificate, 0, found)
+	candidates := make([]potentialParent, 0, found)
 	candidates = append(candidates, matchingKeyID...)
 	candidates = append(candidates, oneKeyID...)
 	candidates = append(candidates, mismatchKeyID...)
@@ -164,6 +198,22 @@ func (s *CertPool) contains(cert *Certificate) bool {
 	return s.haveSum[sha256.Sum224(cert.Raw)]
 }
 
+// constraint returns the constraint of cert in s, if any.
+func (s *CertPool) constraint(cert *Certificate) func([]*Certificate) error {
+	if s == nil {
+		return nil
+	}
+	for _, i := range s.byName[string(cert.RawSubject)] {
+		if s.lazyCerts[i].constraint == nil {
+			continue
+		}
+		if c, err := s.cert(i); err == nil && c.Equal(cert) {
+			return s.lazyCerts[i].constraint
+		}
+	}
+	return nil
+}
+
 // AddCert adds a certificate to a pool.
 func (s *CertPool) AddCert(cert *Certificate) {
 	if cert == nil {
@@ -171,15 +221,56 @@ func (s *CertPool) AddCert(cert *Certificate) {
 	}
 	s.addCertFunc(sha256.Sum224(cert.Raw), string(cert.RawSubject), func() (*Certificate, error) {
 		return cert, nil
-	})
+	}, nil)
+}
+
+// AddCertWithConstraint adds a certificate to the pool with the additional
+// constraint. When Certificate.Verify builds a chain which is rooted by cert,
+// it will additionally pass the whole chain to constraint to determine its
+// validity. If constraint returns a non-nil error, the chain will be discarded.
+// constraint may be called concurrently from multiple goroutines.
+//
+// For example, a private root can be restricted to certain names by checking
+// the DNSNames of chain[0], the leaf.
+//
+// If cert is already in the pool, the pool is unchanged. If constraint is
+// nil, AddCertWithConstraint is equivalent to AddCert.
+func (s *CertPool) AddCertWithConstraint(cert *Certificate, constraint func([]*Certificate) error) {
+	if cert == nil {
+		panic("adding nil Certificate to CertPool")
+	}
+	s.addCertFunc(sha256.Sum224(cert.Raw), string(cert.RawSubject), func() (*Certificate, error) {
+		return cert, nil
+	}, constraint)
+}
+
+// AddPool adds all the certificates in other to s, along with their
+// constraints. Certificates that are already in s are skipped, keeping their
+// existing constraints. other is not modified.
+//
+// AddPool can be used to combine the system roots with private roots:
+//
+//	roots, err := x509.SystemCertPool()
+//	if err != nil {
+//		// handle error
+//	}
+//	roots.AddPool(privateRoots)
+func (s *CertPool) AddPool(other *CertPool) {
+	if other == nil || s == other {
+		return
+	}
+	for _, lc := range other.lazyCerts {
+		s.addCertFunc(lc.rawSum224, string(lc.rawSubject), lc.getCert, lc.constraint)
+	}
 }
 
 // addCertFunc adds metadata about a certificate to a pool, along with
 // a func to fetch that certificate later when needed.
 //
 // The rawSubject is Certificate.RawSubject and must be non-empty.
-// The getCert func may be called 0 or more times.
-func (s *CertPool) addCertFunc(rawSum224 sum224, rawSubject string, getCert func() (*Certificate, error)) {
+// The getCert func may be called 0 or more times. The constraint
+// func may be nil.
+func (s *CertPool) addCertFunc(rawSum224 sum224, rawSubject string, getCert func() (*Certificate, error), constraint func([]*Certificate) error) {
 	if getCert == nil {
 		panic("getCert can't be nil")
 	}
@@ -192,7 +283,9 @@ func (s *CertPool) addCertFunc(rawSum224 sum224, rawSubject string, getCert func
 	s.haveSum[rawSum224] = true
 	s.lazyCerts = append(s.lazyCerts, lazyCert{
 		rawSubject: []byte(rawSubject),
+		rawSum224:  rawSum224,
 		getCert:    getCert,
+		constraint: constraint,
 	})
 	s.byName[rawSubject] = append(s.byName[rawSubject], len(s.lazyCerts)-1)
 }
@@ -230,7 +323,7 @@ func (s *CertPool) AppendCertsFromPEM(pemCerts []byte) (ok bool) {
 				certBytes = nil
 			})
 			return lazyCert.v, nil
-		})
+		}, nil)
 		ok = true
 	}
 
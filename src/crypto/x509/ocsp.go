@@ -0,0 +1,993 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// This file implements the Online Certificate Status Protocol (OCSP) as
+// specified in RFC 6960.
+
+var (
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidOCSPNonce         = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+	oidSHA1              = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+var ocspHashOIDs = []struct {
+	hash crypto.Hash
+	oid  asn1.ObjectIdentifier
+}{
+	{crypto.SHA1, oidSHA1},
+	{crypto.SHA256, oidSHA256},
+	{crypto.SHA384, oidSHA384},
+	{crypto.SHA512, oidSHA512},
+}
+
+// ocspHashOID returns the OID of hash, or nil if it can't be used in OCSP.
+func ocspHashOID(hash crypto.Hash) asn1.ObjectIdentifier {
+	for _, h := range ocspHashOIDs {
+		if h.hash == hash {
+			return h.oid
+		}
+	}
+	return nil
+}
+
+// OCSPStatus is the status of a certificate in an OCSP response.
+type OCSPStatus int
+
+const (
+	OCSPGood OCSPStatus = iota
+	OCSPRevoked
+	OCSPUnknown
+)
+
+func (s OCSPStatus) String() string {
+	switch s {
+	case OCSPGood:
+		return "good"
+	case OCSPRevoked:
+		return "revoked"
+	case OCSPUnknown:
+		return "unknown"
+	}
+	return "OCSPStatus(" + strconv.Itoa(int(s)) + ")"
+}
+
+// OCSPResponseStatus is the status of an OCSP response, as opposed to the
+// status of the certificate it is about.
+type OCSPResponseStatus int
+
+const (
+	OCSPSuccess       OCSPResponseStatus = 0
+	OCSPMalformed     OCSPResponseStatus = 1
+	OCSPInternalError OCSPResponseStatus = 2
+	OCSPTryLater      OCSPResponseStatus = 3
+	// Status code 4 is not used.
+	OCSPSignatureRequired OCSPResponseStatus = 5
+	OCSPUnauthorized      OCSPResponseStatus = 6
+)
+
+func (s OCSPResponseStatus) String() string {
+	switch s {
+	case OCSPSuccess:
+		return "success"
+	case OCSPMalformed:
+		return "malformed request"
+	case OCSPInternalError:
+		return "internal error"
+	case OCSPTryLater:
+		return "try later"
+	case OCSPSignatureRequired:
+		return "signature required"
+	case OCSPUnauthorized:
+		return "unauthorized"
+	}
+	return "OCSPResponseStatus(" + strconv.Itoa(int(s)) + ")"
+}
+
+// OCSPResponseError is returned by ParseOCSPResponse and
+// ParseOCSPResponseForCert when the OCSP response status is not OCSPSuccess.
+type OCSPResponseError struct {
+	Status OCSPResponseStatus
+}
+
+func (e OCSPResponseError) Error() string {
+	return "x509: OCSP response error: " + e.Status.String()
+}
+
+// ocspCertID is the CertID structure that identifies a certificate in OCSP
+// requests and responses.
+type ocspCertID struct {
+	hash           crypto.Hash
+	issuerNameHash []byte
+	issuerKeyHash  []byte
+	serialNumber   *big.Int
+}
+
+// issuerKeyBits returns the contents of the subjectPublicKey BIT STRING of
+// the certificate c, which is hashed to identify c as an issuer.
+func issuerKeyBits(c *Certificate) ([]byte, error) {
+	spki := cryptobyte.String(c.RawSubjectPublicKeyInfo)
+	var key asn1.BitString
+	if !spki.ReadASN1(&spki, cryptobyte_asn1.SEQUENCE) ||
+		!spki.SkipASN1(cryptobyte_asn1.SEQUENCE) ||
+		!spki.ReadASN1BitString(&key) {
+		return nil, errors.New("x509: malformed issuer public key")
+	}
+	return key.Bytes, nil
+}
+
+func newOCSPCertID(issuer *Certificate, serial *big.Int, hash crypto.Hash) (*ocspCertID, error) {
+	if ocspHashOID(hash) == nil || !hash.Available() {
+		return nil, errors.New("x509: unsupported OCSP hash function")
+	}
+	key, err := issuerKeyBits(issuer)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(key)
+	return &ocspCertID{
+		hash:           hash,
+		issuerNameHash: nameHash,
+		issuerKeyHash:  h.Sum(nil),
+		serialNumber:   serial,
+	}, nil
+}
+
+// issuedBy reports whether id identifies a certificate issued by issuer.
+func (id *ocspCertID) issuedBy(issuer *Certificate) bool {
+	other, err := newOCSPCertID(issuer, id.serialNumber, id.hash)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(id.issuerNameHash, other.issuerNameHash) &&
+		bytes.Equal(id.issuerKeyHash, other.issuerKeyHash)
+}
+
+func (id *ocspCertID) marshal(b *cryptobyte.Builder) {
+	oid := ocspHashOID(id.hash)
+	if oid == nil {
+		b.SetError(errors.New("x509: unsupported OCSP hash function"))
+		return
+	}
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(oid)
+			b.AddASN1NULL()
+		})
+		b.AddASN1OctetString(id.issuerNameHash)
+		b.AddASN1OctetString(id.issuerKeyHash)
+		b.AddASN1BigInt(id.serialNumber)
+	})
+}
+
+func parseOCSPCertID(der *cryptobyte.String) (*ocspCertID, error) {
+	var certID, hashAI cryptobyte.String
+	if !der.ReadASN1(&certID, cryptobyte_asn1.SEQUENCE) ||
+		!certID.ReadASN1(&hashAI, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed OCSP CertID")
+	}
+	ai, err := parseAI(hashAI)
+	if err != nil {
+		return nil, err
+	}
+	id := &ocspCertID{serialNumber: new(big.Int)}
+	for _, h := range ocspHashOIDs {
+		if h.oid.Equal(ai.Algorithm) {
+			id.hash = h.hash
+		}
+	}
+	if id.hash == 0 {
+		return nil, errors.New("x509: unsupported OCSP hash function")
+	}
+	if !certID.ReadASN1Bytes(&id.issuerNameHash, cryptobyte_asn1.OCTET_STRING) ||
+		!certID.ReadASN1Bytes(&id.issuerKeyHash, cryptobyte_asn1.OCTET_STRING) ||
+		!certID.ReadASN1Integer(id.serialNumber) || !certID.Empty() {
+		return nil, errors.New("x509: malformed OCSP CertID")
+	}
+	return id, nil
+}
+
+func marshalExtensions(b *cryptobyte.Builder, exts []pkix.Extension) {
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for _, ext := range exts {
+			b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddASN1ObjectIdentifier(ext.Id)
+				if ext.Critical {
+					b.AddASN1Boolean(true)
+				}
+				b.AddASN1OctetString(ext.Value)
+			})
+		}
+	})
+}
+
+// parseOCSPExtensions parses an optional sequence of extensions, explicitly
+// tagged with tag.
+func parseOCSPExtensions(der *cryptobyte.String, tag cryptobyte_asn1.Tag) ([]pkix.Extension, error) {
+	var extensions cryptobyte.String
+	var present bool
+	if !der.ReadOptionalASN1(&extensions, &present, tag) {
+		return nil, errors.New("x509: malformed extensions")
+	}
+	if !present {
+		return nil, nil
+	}
+	if !extensions.ReadASN1(&extensions, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed extensions")
+	}
+	var exts []pkix.Extension
+	for !extensions.Empty() {
+		var extension cryptobyte.String
+		if !extensions.ReadASN1(&extension, cryptobyte_asn1.SEQUENCE) {
+			return nil, errors.New("x509: malformed extension")
+		}
+		ext, err := parseExtension(extension)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, ext)
+	}
+	return exts, nil
+}
+
+// nonceExtension returns a nonce extension for nonce, encoded as an OCTET
+// STRING as specified in RFC 8954.
+func nonceExtension(nonce []byte) pkix.Extension {
+	var b cryptobyte.Builder
+	b.AddASN1OctetString(nonce)
+	return pkix.Extension{Id: oidOCSPNonce, Value: b.BytesOrPanic()}
+}
+
+// parseNonce returns the nonce in a nonce extension. Some implementations
+// don't wrap the nonce in an OCTET STRING, in which case the whole value is
+// returned.
+func parseNonce(ext pkix.Extension) []byte {
+	val := cryptobyte.String(ext.Value)
+	var nonce []byte
+	if val.ReadASN1Bytes(&nonce, cryptobyte_asn1.OCTET_STRING) && val.Empty() {
+		return nonce
+	}
+	return ext.Value
+}
+
+// OCSPRequest represents an OCSP request for the status of a single
+// certificate, as specified in RFC 6960, Section 4.1.
+type OCSPRequest struct {
+	// HashAlgorithm is the hash function used to compute IssuerNameHash and
+	// IssuerKeyHash.
+	HashAlgorithm crypto.Hash
+	// IssuerNameHash is the hash of the DER encoded subject of the issuer of
+	// the certificate.
+	IssuerNameHash []byte
+	// IssuerKeyHash is the hash of the public key of the issuer of the
+	// certificate, not including the algorithm identifier.
+	IssuerKeyHash []byte
+	// SerialNumber is the serial number of the certificate.
+	SerialNumber *big.Int
+
+	// Nonce, if not empty, is sent in the nonce extension to bind the
+	// request to the response. It is also populated from the extension when
+	// parsing a request.
+	Nonce []byte
+
+	// Extensions contains the raw requestExtensions. It is populated when
+	// parsing a request and ignored when marshaling one, see
+	// ExtraExtensions.
+	Extensions []pkix.Extension
+	// ExtraExtensions contains additional requestExtensions to add to the
+	// request when marshaling it.
+	ExtraExtensions []pkix.Extension
+}
+
+// NewOCSPRequest returns an OCSPRequest for the status of cert, which must
+// have been issued by issuer. The issuer is identified using hash, or SHA-1
+// if hash is zero, which is the only hash function that responders are
+// required to support by RFC 5019.
+func NewOCSPRequest(cert, issuer *Certificate, hash crypto.Hash) (*OCSPRequest, error) {
+	if hash == 0 {
+		hash = crypto.SHA1
+	}
+	id, err := newOCSPCertID(issuer, cert.SerialNumber, hash)
+	if err != nil {
+		return nil, err
+	}
+	return &OCSPRequest{
+		HashAlgorithm:  id.hash,
+		IssuerNameHash: id.issuerNameHash,
+		IssuerKeyHash:  id.issuerKeyHash,
+		SerialNumber:   id.serialNumber,
+	}, nil
+}
+
+func (req *OCSPRequest) certID() *ocspCertID {
+	return &ocspCertID{
+		hash:           req.HashAlgorithm,
+		issuerNameHash: req.IssuerNameHash,
+		issuerKeyHash:  req.IssuerKeyHash,
+		serialNumber:   req.SerialNumber,
+	}
+}
+
+// MatchesIssuer reports whether req is about a certificate issued by issuer.
+// Responders serving multiple issuers can use it to select the issuer to
+// pass to CreateOCSPResponse.
+func (req *OCSPRequest) MatchesIssuer(issuer *Certificate) bool {
+	return req.certID().issuedBy(issuer)
+}
+
+// Marshal returns the DER encoding of req. The request is not signed.
+func (req *OCSPRequest) Marshal() ([]byte, error) {
+	if req.SerialNumber == nil {
+		return nil, errors.New("x509: OCSP request contains nil SerialNumber field")
+	}
+	var exts []pkix.Extension
+	if len(req.Nonce) > 0 && !oidInExtensions(oidOCSPNonce, req.ExtraExtensions) {
+		exts = append(exts, nonceExtension(req.Nonce))
+	}
+	exts = append(exts, req.ExtraExtensions...)
+
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // OCSPRequest
+		b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // TBSRequest
+			b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // requestList
+				b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // Request
+					req.certID().marshal(b)
+				})
+			})
+			if len(exts) > 0 {
+				b.AddASN1(cryptobyte_asn1.Tag(2).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+					marshalExtensions(b, exts)
+				})
+			}
+		})
+	})
+	return b.Bytes()
+}
+
+// ParseOCSPRequest parses a DER encoded OCSP request. The request must be for
+// the status of exactly one certificate. Request signatures are not checked.
+func ParseOCSPRequest(der []byte) (*OCSPRequest, error) {
+	input := cryptobyte.String(der)
+	var tbs, requestList, request cryptobyte.String
+	if !input.ReadASN1Element(&input, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed OCSP request")
+	}
+	if len(der) != len(input) {
+		return nil, errors.New("x509: trailing data")
+	}
+	if !input.ReadASN1(&input, cryptobyte_asn1.SEQUENCE) ||
+		!input.ReadASN1(&tbs, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed OCSP request")
+	}
+
+	var version int
+	if !tbs.ReadOptionalASN1Integer(&version, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific(), 0) {
+		return nil, errors.New("x509: malformed OCSP request version")
+	}
+	if version != 0 {
+		return nil, errors.New("x509: unsupported OCSP request version")
+	}
+	if !tbs.SkipOptionalASN1(cryptobyte_asn1.Tag(1).Constructed().ContextSpecific()) {
+		return nil, errors.New("x509: malformed OCSP requestor name")
+	}
+	if !tbs.ReadASN1(&requestList, cryptobyte_asn1.SEQUENCE) ||
+		!requestList.ReadASN1(&request, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed OCSP request")
+	}
+	if !requestList.Empty() {
+		return nil, errors.New("x509: OCSP request contains more than one certificate")
+	}
+	id, err := parseOCSPCertID(&request)
+	if err != nil {
+		return nil, err
+	}
+	if !request.SkipOptionalASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) || !request.Empty() {
+		return nil, errors.New("x509: malformed OCSP request")
+	}
+
+	req := &OCSPRequest{
+		HashAlgorithm:  id.hash,
+		IssuerNameHash: id.issuerNameHash,
+		IssuerKeyHash:  id.issuerKeyHash,
+		SerialNumber:   id.serialNumber,
+	}
+	req.Extensions, err = parseOCSPExtensions(&tbs, cryptobyte_asn1.Tag(2).Constructed().ContextSpecific())
+	if err != nil {
+		return nil, err
+	}
+	if !tbs.Empty() {
+		return nil, errors.New("x509: malformed OCSP request")
+	}
+	for _, ext := range req.Extensions {
+		if ext.Id.Equal(oidOCSPNonce) {
+			req.Nonce = parseNonce(ext)
+		}
+	}
+
+	// The optional signature is ignored.
+	if !input.SkipOptionalASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) || !input.Empty() {
+		return nil, errors.New("x509: malformed OCSP request")
+	}
+
+	return req, nil
+}
+
+// OCSPResponse represents a successful OCSP response about the status of a
+// single certificate, as specified in RFC 6960, Section 4.2. It contains the
+// fields used to create a response with CreateOCSPResponse, and is returned
+// by ParseOCSPResponse.
+type OCSPResponse struct {
+	// Raw contains the complete ASN.1 DER content of the OCSPResponse. It is
+	// set when parsing a response.
+	Raw []byte
+	// RawTBSResponseData contains the signed ResponseData portion of the
+	// ASN.1 DER. It is set when parsing a response.
+	RawTBSResponseData []byte
+
+	// Status is the status of the certificate.
+	Status OCSPStatus
+	// SerialNumber is the serial number of the certificate.
+	SerialNumber *big.Int
+	// IssuerHash is the hash function used to identify the issuer of the
+	// certificate. When creating a response, zero means SHA-1.
+	IssuerHash crypto.Hash
+
+	// ProducedAt is the time at which the response was signed. When creating
+	// a response, zero means the current time.
+	ProducedAt time.Time
+	// ThisUpdate is the time at which the status is known to be correct.
+	ThisUpdate time.Time
+	// NextUpdate is the time at or before which newer information will be
+	// available about the status of the certificate. It is optional and
+	// omitted if zero.
+	NextUpdate time.Time
+
+	// RevokedAt and RevocationReason are only used if Status is
+	// OCSPRevoked. RevocationReasonUnspecified causes the reason to be
+	// omitted.
+	RevokedAt        time.Time
+	RevocationReason RevocationReason
+
+	// Certificate is the delegated responder certificate included in the
+	// response, if any. It is set when parsing a response: if the response
+	// includes several certificates, it is the one identified by the
+	// responder ID, or else the first. When creating a response, the
+	// responder certificate is included if it's not the issuer.
+	Certificate *Certificate
+
+	// Signature contains the signature of the response. It is set when
+	// parsing a response.
+	Signature []byte
+	// SignatureAlgorithm is used to determine the signature algorithm to be
+	// used when signing the response. If 0 the default algorithm for the
+	// signing key will be used. When parsing, it is set to the algorithm the
+	// response was signed with.
+	SignatureAlgorithm SignatureAlgorithm
+
+	// RawResponderName and ResponderKeyHash identify the responder. Exactly
+	// one of them is set when parsing a response. CreateOCSPResponse always
+	// identifies the responder by the SHA-1 hash of its public key.
+	RawResponderName []byte
+	ResponderKeyHash []byte
+
+	// Nonce, if not empty, is sent in the nonce extension. It should be
+	// copied from the request. It is also populated from the extension when
+	// parsing a response.
+	Nonce []byte
+
+	// Extensions contains the raw responseExtensions, and SingleExtensions
+	// the raw singleExtensions of the response about the certificate. They
+	// are populated when parsing a response and ignored when creating one,
+	// see ExtraExtensions.
+	Extensions       []pkix.Extension
+	SingleExtensions []pkix.Extension
+	// ExtraExtensions contains additional responseExtensions to add to the
+	// response.
+	ExtraExtensions []pkix.Extension
+
+	certID *ocspCertID
+}
+
+// CheckSignatureFrom verifies that the signature on resp is a valid signature
+// from the responder certificate parent, which is either the issuer of the
+// certificate or a delegated responder certificate.
+func (resp *OCSPResponse) CheckSignatureFrom(parent *Certificate) error {
+	return parent.CheckSignature(resp.SignatureAlgorithm, resp.RawTBSResponseData, resp.Signature)
+}
+
+// verify checks that resp is about a certificate issued by issuer and that
+// it's signed either by issuer or by an OCSP responder certificate issued by
+// issuer.
+func (resp *OCSPResponse) verify(issuer *Certificate) error {
+	if !resp.certID.issuedBy(issuer) {
+		return errors.New("x509: OCSP response is not about a certificate of the issuer")
+	}
+	signer := issuer
+	if resp.Certificate != nil && !bytes.Equal(resp.Certificate.Raw, issuer.Raw) {
+		if err := resp.Certificate.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("x509: invalid OCSP responder certificate: %w", err)
+		}
+		ocspSigning := false
+		for _, eku := range resp.Certificate.ExtKeyUsage {
+			if eku == ExtKeyUsageOCSPSigning {
+				ocspSigning = true
+			}
+		}
+		if !ocspSigning {
+			return errors.New("x509: OCSP responder certificate is not authorized for OCSP signing")
+		}
+		signer = resp.Certificate
+	}
+	if err := resp.CheckSignatureFrom(signer); err != nil {
+		return fmt.Errorf("x509: invalid OCSP response signature: %w", err)
+	}
+	return nil
+}
+
+// ParseOCSPResponse parses a DER encoded OCSP response, which must contain
+// the status of exactly one certificate. If the response status is not
+// OCSPSuccess, the error is an OCSPResponseError.
+//
+// If issuer is not nil, the response must be about a certificate issued by
+// issuer, and its signature is checked. It must be signed either by issuer,
+// or by a responder certificate included in the response, issued by issuer
+// and with the OCSP signing extended key usage. Note that the validity of
+// the responder certificate is not checked.
+func ParseOCSPResponse(der []byte, issuer *Certificate) (*OCSPResponse, error) {
+	return parseOCSPResponse(der, nil, issuer)
+}
+
+// ParseOCSPResponseForCert is like ParseOCSPResponse, but the response may
+// contain the status of multiple certificates, and the status of cert is
+// returned.
+func ParseOCSPResponseForCert(der []byte, cert, issuer *Certificate) (*OCSPResponse, error) {
+	return parseOCSPResponse(der, cert, issuer)
+}
+
+func parseOCSPResponse(der []byte, cert, issuer *Certificate) (*OCSPResponse, error) {
+	resp := &OCSPResponse{}
+
+	input := cryptobyte.String(der)
+	if !input.ReadASN1Element(&input, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed OCSP response")
+	}
+	resp.Raw = input
+	if len(der) != len(resp.Raw) {
+		return nil, errors.New("x509: trailing data")
+	}
+	var status int
+	if !input.ReadASN1(&input, cryptobyte_asn1.SEQUENCE) || !input.ReadASN1Enum(&status) {
+		return nil, errors.New("x509: malformed OCSP response")
+	}
+	if OCSPResponseStatus(status) != OCSPSuccess {
+		return nil, OCSPResponseError{OCSPResponseStatus(status)}
+	}
+
+	var responseBytes, basic cryptobyte.String
+	var responseType asn1.ObjectIdentifier
+	if !input.ReadASN1(&responseBytes, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) || !input.Empty() ||
+		!responseBytes.ReadASN1(&responseBytes, cryptobyte_asn1.SEQUENCE) ||
+		!responseBytes.ReadASN1ObjectIdentifier(&responseType) {
+		return nil, errors.New("x509: malformed OCSP response")
+	}
+	if !responseType.Equal(oidOCSPBasicResponse) {
+		return nil, errors.New("x509: unsupported OCSP response type")
+	}
+	if !responseBytes.ReadASN1(&basic, cryptobyte_asn1.OCTET_STRING) || !responseBytes.Empty() ||
+		!basic.ReadASN1(&basic, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed OCSP response")
+	}
+
+	var tbs cryptobyte.String
+	if !basic.ReadASN1Element(&tbs, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed OCSP response data")
+	}
+	resp.RawTBSResponseData = tbs
+	if !tbs.ReadASN1(&tbs, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed OCSP response data")
+	}
+
+	var sigAISeq cryptobyte.String
+	if !basic.ReadASN1(&sigAISeq, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed signature algorithm identifier")
+	}
+	sigAI, err := parseAI(sigAISeq)
+	if err != nil {
+		return nil, err
+	}
+	resp.SignatureAlgorithm = getSignatureAlgorithmFromAI(sigAI)
+	var signature asn1.BitString
+	if !basic.ReadASN1BitString(&signature) {
+		return nil, errors.New("x509: malformed signature")
+	}
+	resp.Signature = signature.RightAlign()
+
+	var certsDER cryptobyte.String
+	var present bool
+	if !basic.ReadOptionalASN1(&certsDER, &present, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) || !basic.Empty() {
+		return nil, errors.New("x509: malformed OCSP response")
+	}
+	var certs []*Certificate
+	if present {
+		if !certsDER.ReadASN1(&certsDER, cryptobyte_asn1.SEQUENCE) {
+			return nil, errors.New("x509: malformed OCSP response certificates")
+		}
+		for !certsDER.Empty() {
+			var certDER cryptobyte.String
+			if !certsDER.ReadASN1Element(&certDER, cryptobyte_asn1.SEQUENCE) {
+				return nil, errors.New("x509: malformed OCSP response certificates")
+			}
+			cert, err := parseCertificate(certDER)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+	}
+
+	var version int
+	if !tbs.ReadOptionalASN1Integer(&version, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific(), 0) {
+		return nil, errors.New("x509: malformed OCSP response version")
+	}
+	if version != 0 {
+		return nil, errors.New("x509: unsupported OCSP response version")
+	}
+
+	switch {
+	case tbs.PeekASN1Tag(cryptobyte_asn1.Tag(1).Constructed().ContextSpecific()):
+		var name cryptobyte.String
+		if !tbs.ReadASN1(&name, cryptobyte_asn1.Tag(1).Constructed().ContextSpecific()) {
+			return nil, errors.New("x509: malformed OCSP responder ID")
+		}
+		resp.RawResponderName = name
+	case tbs.PeekASN1Tag(cryptobyte_asn1.Tag(2).Constructed().ContextSpecific()):
+		var keyHash cryptobyte.String
+		if !tbs.ReadASN1(&keyHash, cryptobyte_asn1.Tag(2).Constructed().ContextSpecific()) ||
+			!keyHash.ReadASN1Bytes(&resp.ResponderKeyHash, cryptobyte_asn1.OCTET_STRING) || !keyHash.Empty() {
+			return nil, errors.New("x509: malformed OCSP responder ID")
+		}
+	default:
+		return nil, errors.New("x509: malformed OCSP responder ID")
+	}
+	resp.Certificate = responderCertificate(certs, resp.RawResponderName, resp.ResponderKeyHash)
+
+	if !tbs.ReadASN1GeneralizedTime(&resp.ProducedAt) {
+		return nil, errors.New("x509: malformed OCSP response producedAt")
+	}
+
+	var responses cryptobyte.String
+	if !tbs.ReadASN1(&responses, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed OCSP responses")
+	}
+	n := 0
+	for !responses.Empty() {
+		single := &OCSPResponse{}
+		if err := parseOCSPSingleResponse(&responses, single); err != nil {
+			return nil, err
+		}
+		n++
+		if resp.certID == nil && (cert == nil || single.certID.serialNumber.Cmp(cert.SerialNumber) == 0 &&
+			(issuer == nil || single.certID.issuedBy(issuer))) {
+			resp.certID = single.certID
+			resp.SerialNumber = single.SerialNumber
+			resp.IssuerHash = single.IssuerHash
+			resp.Status = single.Status
+			resp.ThisUpdate = single.ThisUpdate
+			resp.NextUpdate = single.NextUpdate
+			resp.RevokedAt = single.RevokedAt
+			resp.RevocationReason = single.RevocationReason
+			resp.SingleExtensions = single.SingleExtensions
+		}
+	}
+	if cert == nil && n != 1 {
+		return nil, fmt.Errorf("x509: OCSP response contains %d responses, want 1", n)
+	}
+	if resp.certID == nil {
+		return nil, errors.New("x509: OCSP response does not contain the status of the certificate")
+	}
+
+	resp.Extensions, err = parseOCSPExtensions(&tbs, cryptobyte_asn1.Tag(1).Constructed().ContextSpecific())
+	if err != nil {
+		return nil, err
+	}
+	if !tbs.Empty() {
+		return nil, errors.New("x509: malformed OCSP response data")
+	}
+	for _, ext := range resp.Extensions {
+		if ext.Id.Equal(oidOCSPNonce) {
+			resp.Nonce = parseNonce(ext)
+		}
+	}
+
+	if issuer != nil {
+		if err := resp.verify(issuer); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// responderCertificate returns the certificate of certs that the responder ID,
+// given by name or keyHash, identifies, or the first certificate if none
+// does. Responders may include a chain, not just their own certificate.
+func responderCertificate(certs []*Certificate, name, keyHash []byte) *Certificate {
+	for _, cert := range certs {
+		if name != nil && bytes.Equal(cert.RawSubject, name) {
+			return cert
+		}
+		if keyHash != nil {
+			if key, err := issuerKeyBits(cert); err == nil {
+				h := sha1.Sum(key)
+				if bytes.Equal(h[:], keyHash) {
+					return cert
+				}
+			}
+		}
+	}
+	if len(certs) > 0 {
+		return certs[0]
+	}
+	return nil
+}
+
+// parseOCSPSingleResponse reads a SingleResponse from der into the
+// certificate status fields of resp.
+func parseOCSPSingleResponse(der *cryptobyte.String, resp *OCSPResponse) error {
+	var single cryptobyte.String
+	if !der.ReadASN1(&single, cryptobyte_asn1.SEQUENCE) {
+		return errors.New("x509: malformed OCSP single response")
+	}
+	id, err := parseOCSPCertID(&single)
+	if err != nil {
+		return err
+	}
+	resp.certID = id
+	resp.SerialNumber = id.serialNumber
+	resp.IssuerHash = id.hash
+
+	switch {
+	case single.PeekASN1Tag(cryptobyte_asn1.Tag(0).ContextSpecific()):
+		resp.Status = OCSPGood
+		var null cryptobyte.String
+		if !single.ReadASN1(&null, cryptobyte_asn1.Tag(0).ContextSpecific()) || !null.Empty() {
+			return errors.New("x509: malformed OCSP certificate status")
+		}
+	case single.PeekASN1Tag(cryptobyte_asn1.Tag(1).Constructed().ContextSpecific()):
+		resp.Status = OCSPRevoked
+		var revoked, reason cryptobyte.String
+		var present bool
+		if !single.ReadASN1(&revoked, cryptobyte_asn1.Tag(1).Constructed().ContextSpecific()) ||
+			!revoked.ReadASN1GeneralizedTime(&resp.RevokedAt) ||
+			!revoked.ReadOptionalASN1(&reason, &present, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) ||
+			!revoked.Empty() {
+			return errors.New("x509: malformed OCSP revoked info")
+		}
+		if present {
+			var r int
+			if !reason.ReadASN1Enum(&r) || !reason.Empty() || !RevocationReason(r).valid() {
+				return errors.New("x509: malformed OCSP revocation reason")
+			}
+			resp.RevocationReason = RevocationReason(r)
+		}
+	case single.PeekASN1Tag(cryptobyte_asn1.Tag(2).ContextSpecific()):
+		resp.Status = OCSPUnknown
+		if !single.SkipASN1(cryptobyte_asn1.Tag(2).ContextSpecific()) {
+			return errors.New("x509: malformed OCSP certificate status")
+		}
+	default:
+		return errors.New("x509: malformed OCSP certificate status")
+	}
+
+	if !single.ReadASN1GeneralizedTime(&resp.ThisUpdate) {
+		return errors.New("x509: malformed OCSP thisUpdate")
+	}
+	var nextUpdate cryptobyte.String
+	var present bool
+	if !single.ReadOptionalASN1(&nextUpdate, &present, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
+		return errors.New("x509: malformed OCSP nextUpdate")
+	}
+	if present && (!nextUpdate.ReadASN1GeneralizedTime(&resp.NextUpdate) || !nextUpdate.Empty()) {
+		return errors.New("x509: malformed OCSP nextUpdate")
+	}
+	resp.SingleExtensions, err = parseOCSPExtensions(&single, cryptobyte_asn1.Tag(1).Constructed().ContextSpecific())
+	if err != nil {
+		return err
+	}
+	if !single.Empty() {
+		return errors.New("x509: malformed OCSP single response")
+	}
+	return nil
+}
+
+// CreateOCSPResponse creates a successful OCSP response about the status of
+// the certificate with serial number template.SerialNumber, issued by
+// issuer, based on template.
+//
+// The response is signed by priv, which should be the private key associated
+// with the public key of responder. If responder is nil, the issuer itself is
+// the responder. Otherwise, responder should be issued by issuer and have the
+// OCSP signing extended key usage, and it's included in the response.
+func CreateOCSPResponse(rand io.Reader, template *OCSPResponse, issuer, responder *Certificate, priv crypto.Signer) ([]byte, error) {
+	if template == nil {
+		return nil, errors.New("x509: template can not be nil")
+	}
+	if issuer == nil {
+		return nil, errors.New("x509: issuer can not be nil")
+	}
+	if responder == nil {
+		responder = issuer
+	}
+	if template.SerialNumber == nil {
+		return nil, errors.New("x509: template contains nil SerialNumber field")
+	}
+	if template.ThisUpdate.IsZero() {
+		return nil, errors.New("x509: template contains zero ThisUpdate field")
+	}
+	if !template.NextUpdate.IsZero() && template.NextUpdate.Before(template.ThisUpdate) {
+		return nil, errors.New("x509: template.ThisUpdate is after template.NextUpdate")
+	}
+	if template.Status == OCSPRevoked {
+		if template.RevokedAt.IsZero() {
+			return nil, errors.New("x509: template contains zero RevokedAt field")
+		}
+		if !template.RevocationReason.valid() {
+			return nil, errors.New("x509: template contains invalid RevocationReason")
+		}
+	}
+
+	hash := template.IssuerHash
+	if hash == 0 {
+		hash = crypto.SHA1
+	}
+	id, err := newOCSPCertID(issuer, template.SerialNumber, hash)
+	if err != nil {
+		return nil, err
+	}
+	responderKey, err := issuerKeyBits(responder)
+	if err != nil {
+		return nil, err
+	}
+	responderKeyHash := sha1.Sum(responderKey)
+
+	hashFunc, signatureAlgorithm, err := signingParamsForPublicKey(priv.Public(), template.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	producedAt := template.ProducedAt
+	if producedAt.IsZero() {
+		producedAt = time.Now()
+	}
+	var exts []pkix.Extension
+	if len(template.Nonce) > 0 && !oidInExtensions(oidOCSPNonce, template.ExtraExtensions) {
+		exts = append(exts, nonceExtension(template.Nonce))
+	}
+	exts = append(exts, template.ExtraExtensions...)
+
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // ResponseData
+		b.AddASN1(cryptobyte_asn1.Tag(2).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+			b.AddASN1OctetString(responderKeyHash[:])
+		})
+		b.AddASN1GeneralizedTime(producedAt.UTC())
+		b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // responses
+			b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // SingleResponse
+				id.marshal(b)
+				switch template.Status {
+				case OCSPGood:
+					b.AddASN1(cryptobyte_asn1.Tag(0).ContextSpecific(), func(b *cryptobyte.Builder) {})
+				case OCSPRevoked:
+					b.AddASN1(cryptobyte_asn1.Tag(1).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+						b.AddASN1GeneralizedTime(template.RevokedAt.UTC())
+						if template.RevocationReason != RevocationReasonUnspecified {
+							b.AddASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+								b.AddASN1Enum(int64(template.RevocationReason))
+							})
+						}
+					})
+				case OCSPUnknown:
+					b.AddASN1(cryptobyte_asn1.Tag(2).ContextSpecific(), func(b *cryptobyte.Builder) {})
+				default:
+					b.SetError(errors.New("x509: template contains invalid Status"))
+				}
+				b.AddASN1GeneralizedTime(template.ThisUpdate.UTC())
+				if !template.NextUpdate.IsZero() {
+					b.AddASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+						b.AddASN1GeneralizedTime(template.NextUpdate.UTC())
+					})
+				}
+			})
+		})
+		if len(exts) > 0 {
+			b.AddASN1(cryptobyte_asn1.Tag(1).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+				marshalExtensions(b, exts)
+			})
+		}
+	})
+	tbs, err := b.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	input := tbs
+	if hashFunc != 0 {
+		h := hashFunc.New()
+		h.Write(tbs)
+		input = h.Sum(nil)
+	}
+	var signerOpts crypto.SignerOpts = hashFunc
+	if template.SignatureAlgorithm.isRSAPSS() {
+		signerOpts = &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       hashFunc,
+		}
+	}
+
+	signature, err := priv.Sign(rand, input, signerOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	b = cryptobyte.Builder{}
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // OCSPResponse
+		b.AddASN1Enum(int64(OCSPSuccess))
+		b.AddASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+			b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // ResponseBytes
+				b.AddASN1ObjectIdentifier(oidOCSPBasicResponse)
+				b.AddASN1(cryptobyte_asn1.OCTET_STRING, func(b *cryptobyte.Builder) {
+					b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // BasicOCSPResponse
+						b.AddBytes(tbs)
+						b.MarshalASN1(signatureAlgorithm)
+						b.AddASN1BitString(signature)
+						if responder != issuer && !bytes.Equal(responder.Raw, issuer.Raw) {
+							b.AddASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+								b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+									b.AddBytes(responder.Raw)
+								})
+							})
+						}
+					})
+				})
+			})
+		})
+	})
+	return b.Bytes()
+}
+
+// CreateOCSPErrorResponse creates an unsuccessful OCSP response with the
+// given status, which can't be OCSPSuccess. Such responses are not signed.
+func CreateOCSPErrorResponse(status OCSPResponseStatus) ([]byte, error) {
+	if status == OCSPSuccess {
+		return nil, errors.New("x509: OCSP error response can't have status OCSPSuccess")
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Enum(int64(status))
+	})
+	return b.Bytes()
+}
@@ -0,0 +1,434 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// The following OCSP response was generated by OpenSSL for ocspTestLeaf,
+// which is revoked, and is signed by ocspTestCA, which is included in the
+// response.
+const ocspTestCA = `-----BEGIN CERTIFICATE-----
+MIIBljCCATugAwIBAgIUNioR2sphHVsTLZOkbyMf9aaBIZ8wCgYIKoZIzj0EAwIw
+FzEVMBMGA1UEAwwMT0NTUCBUZXN0IENBMCAXDTI2MTAxNjE3MTIzMFoYDzIxMjYw
+OTIyMTcxMjMwWjAXMRUwEwYDVQQDDAxPQ1NQIFRlc3QgQ0EwWTATBgcqhkjOPQIB
+BggqhkjOPQMBBwNCAASWZ6AuQhK62kvyq1WdYcoOT/YMt3oF7n3TiV+aCEv8i/eT
+2MvYorSBlXHKBItADt2w+j0NAgZF/fLx0H0J9HOCo2MwYTAdBgNVHQ4EFgQUqKrY
+CR+pHA6D3z70gNeP/Y05CA8wHwYDVR0jBBgwFoAUqKrYCR+pHA6D3z70gNeP/Y05
+CA8wDwYDVR0TAQH/BAUwAwEB/zAOBgNVHQ8BAf8EBAMCAQYwCgYIKoZIzj0EAwID
+SQAwRgIhAOzOIO0C/RqVMCnC4S1VxRIOvgd/hv80pbNDfUKlCRrzAiEAwPAvUmbW
+V9DMzdeb9fx1BR5upBmkDJUrzWRtoAbVjIY=
+-----END CERTIFICATE-----
+-----END CERTIFICATE-----`
+
+const ocspTestLeaf = `-----BEGIN CERTIFICATE-----
+MIIBDzCBtwICEJIwCgYIKoZIzj0EAwIwFzEVMBMGA1UEAwwMT0NTUCBUZXN0IENB
+MCAXDTI2MTAxNjE3MTIzMFoYDzIxMjYwOTIyMTcxMjMwWjAPMQ0wCwYDVQQDDARs
+ZWFmMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEiUpsymYLd+szhh6huy/hJ9qw
+oowl35WfJOeCEQ64KTb2dd98DWwF7kaQGZW62sLv85M+w8VaC8gVoSXugLWsgjAK
+BggqhkjOPQQDAgNHADBEAiAvLgUo8xTFOoYJb9n7OwboT1UXnAxrgvyGYrqTkOMV
+RwIgVJzaKJPxlU05KzxZoz83PBX70EWkWt2pcJiRn3C1JgY=
+-----END CERTIFICATE-----`
+
+const ocspTestResponseBase64 = "MIICvQoBAKCCArYwggKyBgkrBgEFBQcwAQEEggKjMIICnzCBpqIWBBSoqtgJH6kcDoPfPvSA14/9jTkIDxgPMjAyNjEwMTYxNzEyMzBaMHsweTA7MAkGBSsOAwIaBQAEFKp+ks0HqcWPpQAzDat9ugquQINfBBSoqtgJH6kcDoPfPvSA14/9jTkIDwICEJKhFhgPMjAyMzAzMDExMjAwMDBaoAMKAQEYDzIwMjYxMDE2MTcxMjMwWqARGA8yMTI2MDkyMjE3MTIzMFowCgYIKoZIzj0EAwIDRgAwQwIfL/od3wQZ7eQvNr0NPrtc7xsOjGNE/5tEac31kYJXeAIgBkoJ5lZZNmBiPgv6S75MpB5WaJMSe0Sps72bcEUI1xqgggGeMIIBmjCCAZYwggE7oAMCAQICFDYqEdrKYR1bEy2TpG8jH/WmgSGfMAoGCCqGSM49BAMCMBcxFTATBgNVBAMMDE9DU1AgVGVzdCBDQTAgFw0yNjEwMTYxNzEyMzBaGA8yMTI2MDkyMjE3MTIzMFowFzEVMBMGA1UEAwwMT0NTUCBUZXN0IENBMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAElmegLkISutpL8qtVnWHKDk/2DLd6Be5904lfmghL/Iv3k9jL2KK0gZVxygSLQA7dsPo9DQIGRf3y8dB9CfRzgqNjMGEwHQYDVR0OBBYEFKiq2AkfqRwOg98+9IDXj/2NOQgPMB8GA1UdIwQYMBaAFKiq2AkfqRwOg98+9IDXj/2NOQgPMA8GA1UdEwEB/wQFMAMBAf8wDgYDVR0PAQH/BAQDAgEGMAoGCCqGSM49BAMCA0kAMEYCIQDsziDtAv0alTApwuEtVcUSDr4Hf4b/NKWzQ31CpQka8wIhAMDwL1Jm1lfQzM3Xm/X8dQUebqQZpAyVK81kbaAG1YyG"
+
+func TestParseOCSPResponseOpenSSL(t *testing.T) {
+	ca, err := certificateFromPEM(ocspTestCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := certificateFromPEM(ocspTestLeaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := base64.StdEncoding.DecodeString(ocspTestResponseBase64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := ParseOCSPResponseForCert(der, leaf, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != OCSPRevoked {
+		t.Errorf("Status = %v, want %v", resp.Status, OCSPRevoked)
+	}
+	if resp.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		t.Errorf("SerialNumber = %v, want %v", resp.SerialNumber, leaf.SerialNumber)
+	}
+	if resp.IssuerHash != crypto.SHA1 {
+		t.Errorf("IssuerHash = %v, want SHA-1", resp.IssuerHash)
+	}
+	if want := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC); !resp.RevokedAt.Equal(want) {
+		t.Errorf("RevokedAt = %v, want %v", resp.RevokedAt, want)
+	}
+	if resp.RevocationReason != RevocationReasonKeyCompromise {
+		t.Errorf("RevocationReason = %v, want %v", resp.RevocationReason, RevocationReasonKeyCompromise)
+	}
+	if resp.NextUpdate.Before(resp.ThisUpdate) || resp.ThisUpdate.IsZero() || resp.ProducedAt.IsZero() {
+		t.Errorf("unexpected ProducedAt, ThisUpdate, NextUpdate: %v, %v, %v",
+			resp.ProducedAt, resp.ThisUpdate, resp.NextUpdate)
+	}
+	if resp.Certificate == nil || !resp.Certificate.Equal(ca) {
+		t.Error("the CA certificate included in the response was not parsed")
+	}
+	if len(resp.ResponderKeyHash) == 0 || resp.RawResponderName != nil {
+		t.Errorf("ResponderKeyHash = %x, RawResponderName = %x", resp.ResponderKeyHash, resp.RawResponderName)
+	}
+	if resp.SignatureAlgorithm != ECDSAWithSHA256 {
+		t.Errorf("SignatureAlgorithm = %v, want %v", resp.SignatureAlgorithm, ECDSAWithSHA256)
+	}
+	if !bytes.Equal(resp.Raw, der) {
+		t.Error("Raw doesn't match the response")
+	}
+
+	if _, err := ParseOCSPResponse(der, leaf); err == nil {
+		t.Error("ParseOCSPResponse succeeded with the wrong issuer")
+	}
+	other := *leaf
+	other.SerialNumber = big.NewInt(1)
+	if _, err := ParseOCSPResponseForCert(der, &other, ca); err == nil {
+		t.Error("ParseOCSPResponseForCert succeeded with the wrong certificate")
+	}
+	if _, err := ParseOCSPResponse(append(der, 0), nil); err == nil {
+		t.Error("ParseOCSPResponse accepted trailing data")
+	}
+	der[len(der)-1] ^= 1 // Modify the included certificate.
+	if _, err := ParseOCSPResponse(der, ca); err == nil {
+		t.Error("ParseOCSPResponse accepted a modified response")
+	}
+}
+
+// createOCSPResponderCert returns a certificate issued by issuer with the
+// given extended key usages, along with its private key.
+func createOCSPResponderCert(t *testing.T, issuer *Certificate, issuerKey crypto.Signer, ekus ...ExtKeyUsage) (*Certificate, crypto.Signer) {
+	t.Helper()
+	cert, key, err := generateCert("OCSP Responder", false, issuer, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := *cert
+	template.ExtKeyUsage = ekus
+	der, err := CreateCertificate(rand.Reader, &template, issuer, key.(*ecdsa.PrivateKey).Public(), issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key.(crypto.Signer)
+}
+
+func TestOCSPRequest(t *testing.T) {
+	ca, caKey, err := generateCert("OCSP CA", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA, _, err := generateCert("Other CA", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := generateCert("leaf", false, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hash := range []crypto.Hash{0, crypto.SHA256, crypto.SHA512} {
+		req, err := NewOCSPRequest(leaf, ca, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash == 0 && req.HashAlgorithm != crypto.SHA1 {
+			t.Errorf("default HashAlgorithm = %v, want SHA-1", req.HashAlgorithm)
+		}
+		req.Nonce = []byte("nonce")
+		req.ExtraExtensions = []pkix.Extension{{Id: []int{1, 2, 3, 4}, Value: []byte{5, 0}}}
+		der, err := req.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseOCSPRequest(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(parsed.Extensions) != 2 || !reflect.DeepEqual(parsed.Extensions[1], req.ExtraExtensions[0]) {
+			t.Errorf("Extensions = %v", parsed.Extensions)
+		}
+		parsed.Extensions, parsed.ExtraExtensions = nil, req.ExtraExtensions
+		if !reflect.DeepEqual(parsed, req) {
+			t.Errorf("ParseOCSPRequest = %+v, want %+v", parsed, req)
+		}
+		if !parsed.MatchesIssuer(ca) || parsed.MatchesIssuer(otherCA) {
+			t.Error("MatchesIssuer returned the wrong result")
+		}
+
+		if _, err := ParseOCSPRequest(append(der, 0)); err == nil {
+			t.Error("ParseOCSPRequest accepted trailing data")
+		}
+		if _, err := ParseOCSPRequest(der[:len(der)-1]); err == nil {
+			t.Error("ParseOCSPRequest accepted a truncated request")
+		}
+	}
+
+	if _, err := NewOCSPRequest(leaf, ca, crypto.MD5); err == nil {
+		t.Error("NewOCSPRequest accepted MD5")
+	}
+}
+
+func TestOCSPResponse(t *testing.T) {
+	ca, caKey, err := generateCert("OCSP CA", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := generateCert("leaf", false, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responder, responderKey := createOCSPResponderCert(t, ca, caKey.(crypto.Signer), ExtKeyUsageOCSPSigning)
+
+	thisUpdate := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	templates := map[string]*OCSPResponse{
+		"good": {
+			Status:       OCSPGood,
+			SerialNumber: leaf.SerialNumber,
+			ThisUpdate:   thisUpdate,
+		},
+		"revoked": {
+			Status:           OCSPRevoked,
+			SerialNumber:     leaf.SerialNumber,
+			IssuerHash:       crypto.SHA256,
+			ProducedAt:       thisUpdate.Add(time.Minute),
+			ThisUpdate:       thisUpdate,
+			NextUpdate:       thisUpdate.Add(time.Hour),
+			RevokedAt:        thisUpdate.Add(-time.Hour),
+			RevocationReason: RevocationReasonCessationOfOperation,
+			Nonce:            []byte("nonce"),
+		},
+		"unknown": {
+			Status:       OCSPUnknown,
+			SerialNumber: leaf.SerialNumber,
+			ThisUpdate:   thisUpdate,
+			ExtraExtensions: []pkix.Extension{
+				{Id: []int{1, 2, 3, 4}, Value: []byte{5, 0}},
+			},
+		},
+	}
+	for name, template := range templates {
+		for _, delegated := range []bool{false, true} {
+			signer, key := ca, caKey.(crypto.Signer)
+			if delegated {
+				signer, key = responder, responderKey
+			}
+			der, err := CreateOCSPResponse(rand.Reader, template, ca, signer, key)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			resp, err := ParseOCSPResponseForCert(der, leaf, ca)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+
+			if delegated != (resp.Certificate != nil) {
+				t.Errorf("%s: delegated = %v, but Certificate = %v", name, delegated, resp.Certificate)
+			}
+			if resp.Status != template.Status || resp.SerialNumber.Cmp(template.SerialNumber) != 0 {
+				t.Errorf("%s: Status, SerialNumber = %v, %v", name, resp.Status, resp.SerialNumber)
+			}
+			if template.IssuerHash != 0 && resp.IssuerHash != template.IssuerHash {
+				t.Errorf("%s: IssuerHash = %v, want %v", name, resp.IssuerHash, template.IssuerHash)
+			}
+			if !resp.ThisUpdate.Equal(template.ThisUpdate) || !resp.NextUpdate.Equal(template.NextUpdate) {
+				t.Errorf("%s: ThisUpdate, NextUpdate = %v, %v", name, resp.ThisUpdate, resp.NextUpdate)
+			}
+			if !template.ProducedAt.IsZero() && !resp.ProducedAt.Equal(template.ProducedAt) {
+				t.Errorf("%s: ProducedAt = %v, want %v", name, resp.ProducedAt, template.ProducedAt)
+			}
+			if !resp.RevokedAt.Equal(template.RevokedAt) || resp.RevocationReason != template.RevocationReason {
+				t.Errorf("%s: RevokedAt, RevocationReason = %v, %v", name, resp.RevokedAt, resp.RevocationReason)
+			}
+			if !bytes.Equal(resp.Nonce, template.Nonce) {
+				t.Errorf("%s: Nonce = %q, want %q", name, resp.Nonce, template.Nonce)
+			}
+			if len(template.ExtraExtensions) > 0 && !reflect.DeepEqual(resp.Extensions, template.ExtraExtensions) {
+				t.Errorf("%s: Extensions = %v, want %v", name, resp.Extensions, template.ExtraExtensions)
+			}
+			if err := resp.CheckSignatureFrom(signer); err != nil {
+				t.Errorf("%s: CheckSignatureFrom failed: %s", name, err)
+			}
+		}
+	}
+}
+
+func TestOCSPResponseVerification(t *testing.T) {
+	ca, caKey, err := generateCert("OCSP CA", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA, otherCAKey, err := generateCert("Other CA", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := generateCert("leaf", false, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &OCSPResponse{
+		Status:       OCSPGood,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now(),
+	}
+
+	notResponder, notResponderKey := createOCSPResponderCert(t, ca, caKey.(crypto.Signer), ExtKeyUsageServerAuth)
+	der, err := CreateOCSPResponse(rand.Reader, template, ca, notResponder, notResponderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseOCSPResponse(der, ca); err == nil {
+		t.Error("ParseOCSPResponse accepted a responder without the OCSP signing EKU")
+	}
+	if _, err := ParseOCSPResponse(der, nil); err != nil {
+		t.Errorf("ParseOCSPResponse without an issuer failed: %s", err)
+	}
+
+	otherResponder, otherResponderKey := createOCSPResponderCert(t, otherCA, otherCAKey.(crypto.Signer), ExtKeyUsageOCSPSigning)
+	der, err = CreateOCSPResponse(rand.Reader, template, ca, otherResponder, otherResponderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseOCSPResponse(der, ca); err == nil {
+		t.Error("ParseOCSPResponse accepted a responder issued by another CA")
+	}
+
+	// The response is signed by otherCA, but about a certificate of ca.
+	der, err = CreateOCSPResponse(rand.Reader, template, ca, otherCA, otherCAKey.(crypto.Signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseOCSPResponse(der, ca); err == nil {
+		t.Error("ParseOCSPResponse accepted a response signed by another CA")
+	}
+	if _, err := ParseOCSPResponse(der, otherCA); err == nil {
+		t.Error("ParseOCSPResponse accepted a response about a certificate of another CA")
+	}
+
+	for _, invalid := range []*OCSPResponse{
+		{Status: OCSPGood, ThisUpdate: time.Now()},
+		{Status: OCSPGood, SerialNumber: leaf.SerialNumber},
+		{Status: OCSPRevoked, SerialNumber: leaf.SerialNumber, ThisUpdate: time.Now()},
+		{Status: OCSPStatus(3), SerialNumber: leaf.SerialNumber, ThisUpdate: time.Now()},
+		{Status: OCSPGood, SerialNumber: leaf.SerialNumber, ThisUpdate: time.Now(), IssuerHash: crypto.MD5},
+	} {
+		if _, err := CreateOCSPResponse(rand.Reader, invalid, ca, nil, caKey.(crypto.Signer)); err == nil {
+			t.Errorf("CreateOCSPResponse accepted invalid template %+v", invalid)
+		}
+	}
+}
+
+// prependOCSPCertificate returns the OCSP response der with cert added
+// before the certificates it already includes.
+func prependOCSPCertificate(t *testing.T, der []byte, cert *Certificate) []byte {
+	t.Helper()
+	input := cryptobyte.String(der)
+	var resp, responseBytes, responseType, basic, tbs, sigAlg, sig, certs cryptobyte.String
+	var status int
+	if !input.ReadASN1(&resp, cryptobyte_asn1.SEQUENCE) ||
+		!resp.ReadASN1Enum(&status) ||
+		!resp.ReadASN1(&resp, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) ||
+		!resp.ReadASN1(&resp, cryptobyte_asn1.SEQUENCE) ||
+		!resp.ReadASN1Element(&responseType, cryptobyte_asn1.OBJECT_IDENTIFIER) ||
+		!resp.ReadASN1(&responseBytes, cryptobyte_asn1.OCTET_STRING) ||
+		!responseBytes.ReadASN1(&basic, cryptobyte_asn1.SEQUENCE) ||
+		!basic.ReadASN1Element(&tbs, cryptobyte_asn1.SEQUENCE) ||
+		!basic.ReadASN1Element(&sigAlg, cryptobyte_asn1.SEQUENCE) ||
+		!basic.ReadASN1Element(&sig, cryptobyte_asn1.BIT_STRING) ||
+		!basic.ReadASN1(&certs, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) ||
+		!certs.ReadASN1(&certs, cryptobyte_asn1.SEQUENCE) {
+		t.Fatal("failed to parse OCSP response")
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Enum(int64(status))
+		b.AddASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+			b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddBytes(responseType)
+				b.AddASN1(cryptobyte_asn1.OCTET_STRING, func(b *cryptobyte.Builder) {
+					b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+						b.AddBytes(tbs)
+						b.AddBytes(sigAlg)
+						b.AddBytes(sig)
+						b.AddASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+							b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+								b.AddBytes(cert.Raw)
+								b.AddBytes(certs)
+							})
+						})
+					})
+				})
+			})
+		})
+	})
+	return b.BytesOrPanic()
+}
+
+func TestOCSPResponseSeveralCertificates(t *testing.T) {
+	ca, caKey, err := generateCert("OCSP CA", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := generateCert("leaf", false, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responder, responderKey := createOCSPResponderCert(t, ca, caKey.(crypto.Signer), ExtKeyUsageOCSPSigning)
+	template := &OCSPResponse{
+		Status:       OCSPGood,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now(),
+	}
+	der, err := CreateOCSPResponse(rand.Reader, template, ca, responder, responderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Responders may include their chain, in any order.
+	der = prependOCSPCertificate(t, der, ca)
+	resp, err := ParseOCSPResponse(der, ca)
+	if err != nil {
+		t.Fatalf("ParseOCSPResponse failed: %s", err)
+	}
+	if !resp.Certificate.Equal(responder) {
+		t.Errorf("resp.Certificate is %q, want the responder certificate", resp.Certificate.Subject.CommonName)
+	}
+}
+
+func TestOCSPErrorResponse(t *testing.T) {
+	der, err := CreateOCSPErrorResponse(OCSPTryLater)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseOCSPResponse(der, nil)
+	var respErr OCSPResponseError
+	if !errors.As(err, &respErr) || respErr.Status != OCSPTryLater {
+		t.Errorf("ParseOCSPResponse error = %v, want OCSPResponseError{OCSPTryLater}", err)
+	}
+	if _, err := CreateOCSPErrorResponse(OCSPSuccess); err == nil {
+		t.Error("CreateOCSPErrorResponse accepted OCSPSuccess")
+	}
+}
@@ -157,53 +157,54 @@ func parseAI(der cryptobyte.String) (pkix.AlgorithmIdentifier, error) {
 	return ai, nil
 }
 
-func parseValidity(der cryptobyte.String) (time.Time, time.Time, error) {
-	extract := func() (time.Time, error) {
-		var t time.Time
-		switch {
-		case der.PeekASN1Tag(cryptobyte_asn1.UTCTime):
-			// TODO(rolandshoemaker): once #45411 is fixed, the following code
-			// should be replaced with a call to der.ReadASN1UTCTime.
-			var utc cryptobyte.String
-			if !der.ReadASN1(&utc, cryptobyte_asn1.UTCTime) {
-				return t, errors.New("x509: malformed UTCTime")
-			}
-			s := string(utc)
+// parseTime reads a Time, either a UTCTime or a GeneralizedTime, from der.
+func parseTime(der *cryptobyte.String) (time.Time, error) {
+	var t time.Time
+	switch {
+	case der.PeekASN1Tag(cryptobyte_asn1.UTCTime):
+		// TODO(rolandshoemaker): once #45411 is fixed, the following code
+		// should be replaced with a call to der.ReadASN1UTCTime.
+		var utc cryptobyte.String
+		if !der.ReadASN1(&utc, cryptobyte_asn1.UTCTime) {
+			return t, errors.New("x509: malformed UTCTime")
+		}
+		s := string(utc)
 
-			formatStr := "0601021504Z0700"
-			var err error
+		formatStr := "0601021504Z0700"
+		var err error
+		t, err = time.Parse(formatStr, s)
+		if err != nil {
+			formatStr = "060102150405Z0700"
 			t, err = time.Parse(formatStr, s)
-			if err != nil {
-				formatStr = "060102150405Z0700"
-				t, err = time.Parse(formatStr, s)
-			}
-			if err != nil {
-				return t, err
-			}
+		}
+		if err != nil {
+			return t, err
+		}
 
-			if serialized := t.Format(formatStr); serialized != s {
-				return t, errors.New("x509: malformed UTCTime")
-			}
+		if serialized := t.Format(formatStr); serialized != s {
+			return t, errors.New("x509: malformed UTCTime")
+		}
 
-			if t.Year() >= 2050 {
-				// UTCTime only encodes times prior to 2050. See https://tools.ietf.org/html/rfc5280#section-4.1.2.5.1
-				t = t.AddDate(-100, 0, 0)
-			}
-		case der.PeekASN1Tag(cryptobyte_asn1.GeneralizedTime):
-			if !der.ReadASN1GeneralizedTime(&t) {
-				return t, errors.New("x509: malformed GeneralizedTime")
-			}
-		default:
-			return t, errors.New("x509: unsupported time format")
+		if t.Year() >= 2050 {
+			// UTCTime only encodes times prior to 2050. See https://tools.ietf.org/html/rfc5280#section-4.1.2.5.1
+			t = t.AddDate(-100, 0, 0)
+		}
+	case der.PeekASN1Tag(cryptobyte_asn1.GeneralizedTime):
+		if !der.ReadASN1GeneralizedTime(&t) {
+			return t, errors.New("x509: malformed GeneralizedTime")
 		}
-		return t, nil
+	default:
+		return t, errors.New("x509: unsupported time format")
 	}
+	return t, nil
+}
 
-	notBefore, err := extract()
+func parseValidity(der cryptobyte.String) (time.Time, time.Time, error) {
+	notBefore, err := parseTime(&der)
 	if err != nil {
 		return time.Time{}, time.Time{}, err
 	}
-	notAfter, err := extract()
+	notAfter, err := parseTime(&der)
 	if err != nil {
 		return time.Time{}, time.Time{}, err
 	}
@@ -646,6 +647,70 @@ func parseNameConstraintsExtension(out *Certificate, e pkix.Extension) (unhandle
 	return unhandled, nil
 }
 
+// parseCRLDistributionPoints parses the value of a CRL distribution points
+// or freshest CRL extension, and returns the URIs of the full names of the
+// distribution points.
+func parseCRLDistributionPoints(der cryptobyte.String) ([]string, error) {
+	// RFC 5280, 4.2.1.13
+
+	// CRLDistributionPoints ::= SEQUENCE SIZE (1..MAX) OF DistributionPoint
+	//
+	// DistributionPoint ::= SEQUENCE {
+	//     distributionPoint       [0]     DistributionPointName OPTIONAL,
+	//     reasons                 [1]     ReasonFlags OPTIONAL,
+	//     cRLIssuer               [2]     GeneralNames OPTIONAL }
+	if !der.ReadASN1(&der, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: invalid CRL distribution points")
+	}
+	var uris []string
+	for !der.Empty() {
+		var dpDER cryptobyte.String
+		if !der.ReadASN1(&dpDER, cryptobyte_asn1.SEQUENCE) {
+			return nil, errors.New("x509: invalid CRL distribution point")
+		}
+		var dpNameDER cryptobyte.String
+		var dpNamePresent bool
+		if !dpDER.ReadOptionalASN1(&dpNameDER, &dpNamePresent, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
+			return nil, errors.New("x509: invalid CRL distribution point")
+		}
+		if !dpNamePresent {
+			continue
+		}
+		names, err := parseDistributionPointName(dpNameDER)
+		if err != nil {
+			return nil, err
+		}
+		uris = append(uris, names...)
+	}
+	return uris, nil
+}
+
+// parseDistributionPointName returns the URIs of the full name in a
+// DistributionPointName. Other forms of the name are ignored.
+func parseDistributionPointName(der cryptobyte.String) ([]string, error) {
+	// DistributionPointName ::= CHOICE {
+	//     fullName                [0]     GeneralNames,
+	//     nameRelativeToCRLIssuer [1]     RelativeDistinguishedName }
+	if !der.PeekASN1Tag(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
+		return nil, nil
+	}
+	if !der.ReadASN1(&der, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
+		return nil, errors.New("x509: invalid CRL distribution point")
+	}
+	var uris []string
+	for !der.Empty() {
+		if !der.PeekASN1Tag(cryptobyte_asn1.Tag(6).ContextSpecific()) {
+			break
+		}
+		var uri cryptobyte.String
+		if !der.ReadASN1(&uri, cryptobyte_asn1.Tag(6).ContextSpecific()) {
+			return nil, errors.New("x509: invalid CRL distribution point")
+		}
+		uris = append(uris, string(uri))
+	}
+	return uris, nil
+}
+
 func processExtensions(out *Certificate) error {
 	var err error
 	for _, e := range out.Extensions {
@@ -683,48 +748,9 @@ func processExtensions(out *Certificate) error {
 				}
 
 			case 31:
-				// RFC 5280, 4.2.1.13
-
-				// CRLDistributionPoints ::= SEQUENCE SIZE (1..MAX) OF DistributionPoint
-				//
-				// DistributionPoint ::= SEQUENCE {
-				//     distributionPoint       [0]     DistributionPointName OPTIONAL,
-				//     reasons                 [1]     ReasonFlags OPTIONAL,
-				//     cRLIssuer               [2]     GeneralNames OPTIONAL }
-				//
-				// DistributionPointName ::= CHOICE {
-				//     fullName                [0]     GeneralNames,
-				//     nameRelativeToCRLIssuer [1]     RelativeDistinguishedName }
-				val := cryptobyte.String(e.Value)
-				if !val.ReadASN1(&val, cryptobyte_asn1.SEQUENCE) {
-					return errors.New("x509: invalid CRL distribution points")
-				}
-				for !val.Empty() {
-					var dpDER cryptobyte.String
-					if !val.ReadASN1(&dpDER, cryptobyte_asn1.SEQUENCE) {
-						return errors.New("x509: invalid CRL distribution point")
-					}
-					var dpNameDER cryptobyte.String
-					var dpNamePresent bool
-					if !dpDER.ReadOptionalASN1(&dpNameDER, &dpNamePresent, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
-						return errors.New("x509: invalid CRL distribution point")
-					}
-					if !dpNamePresent {
-						continue
-					}
-					if !dpNameDER.ReadASN1(&dpNameDER, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
-						return errors.New("x509: invalid CRL distribution point")
-					}
-					for !dpNameDER.Empty() {
-						if !dpNameDER.PeekASN1Tag(cryptobyte_asn1.Tag(6).ContextSpecific()) {
-							break
-						}
-						var uri cryptobyte.String
-						if !dpNameDER.ReadASN1(&uri, cryptobyte_asn1.Tag(6).ContextSpecific()) {
-							return errors.New("x509: invalid CRL distribution point")
-						}
-						out.CRLDistributionPoints = append(out.CRLDistributionPoints, string(uri))
-					}
+				out.CRLDistributionPoints, err = parseCRLDistributionPoints(e.Value)
+				if err != nil {
+					return err
 				}
 
 			case 35:
@@ -1004,3 +1030,314 @@ func ParseCertificates(der []byte) ([]*Certificate, error) {
 	}
 	return certs, nil
 }
+
+// ParseRevocationList parses a X509 v1 or v2 Certificate Revocation List
+// from the given ASN.1 DER data.
+func ParseRevocationList(der []byte) (*RevocationList, error) {
+	rl := &RevocationList{}
+
+	input := cryptobyte.String(der)
+	// we read the SEQUENCE including length and tag bytes so that
+	// we can populate RevocationList.Raw, before unwrapping the
+	// SEQUENCE so it can be operated on
+	if !input.ReadASN1Element(&input, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed crl")
+	}
+	rl.Raw = input
+	if !input.ReadASN1(&input, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed crl")
+	}
+	if len(der) != len(rl.Raw) {
+		return nil, errors.New("x509: trailing data")
+	}
+
+	var tbs cryptobyte.String
+	// do the same trick again as above to extract the raw
+	// bytes for RevocationList.RawTBSRevocationList
+	if !input.ReadASN1Element(&tbs, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed tbs crl")
+	}
+	rl.RawTBSRevocationList = tbs
+	if !tbs.ReadASN1(&tbs, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed tbs crl")
+	}
+
+	// The version is OPTIONAL and absent in v1 CRLs. It isn't EXPLICIT
+	// tagged, so it can't be read with ReadOptionalASN1Integer.
+	version := 0
+	if tbs.PeekASN1Tag(cryptobyte_asn1.INTEGER) {
+		if !tbs.ReadASN1Integer(&version) {
+			return nil, errors.New("x509: malformed crl")
+		}
+		if version != 1 {
+			return nil, fmt.Errorf("x509: unsupported crl version: %d", version)
+		}
+	}
+
+	var sigAISeq cryptobyte.String
+	if !tbs.ReadASN1(&sigAISeq, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed signature algorithm identifier")
+	}
+	// Before parsing the inner algorithm identifier, extract
+	// the outer algorithm identifier and make sure that they
+	// match.
+	var outerSigAISeq cryptobyte.String
+	if !input.ReadASN1(&outerSigAISeq, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed algorithm identifier")
+	}
+	if !bytes.Equal(outerSigAISeq, sigAISeq) {
+		return nil, errors.New("x509: inner and outer signature algorithm identifiers don't match")
+	}
+	sigAI, err := parseAI(sigAISeq)
+	if err != nil {
+		return nil, err
+	}
+	rl.SignatureAlgorithm = getSignatureAlgorithmFromAI(sigAI)
+
+	var signature asn1.BitString
+	if !input.ReadASN1BitString(&signature) {
+		return nil, errors.New("x509: malformed signature")
+	}
+	rl.Signature = signature.RightAlign()
+
+	var issuerSeq cryptobyte.String
+	if !tbs.ReadASN1Element(&issuerSeq, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: malformed issuer")
+	}
+	rl.RawIssuer = issuerSeq
+	issuerRDNs, err := parseName(issuerSeq)
+	if err != nil {
+		return nil, err
+	}
+	rl.Issuer.FillFromRDNSequence(issuerRDNs)
+
+	rl.ThisUpdate, err = parseTime(&tbs)
+	if err != nil {
+		return nil, err
+	}
+	if tbs.PeekASN1Tag(cryptobyte_asn1.GeneralizedTime) || tbs.PeekASN1Tag(cryptobyte_asn1.UTCTime) {
+		rl.NextUpdate, err = parseTime(&tbs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tbs.PeekASN1Tag(cryptobyte_asn1.SEQUENCE) {
+		var revokedSeq cryptobyte.String
+		if !tbs.ReadASN1(&revokedSeq, cryptobyte_asn1.SEQUENCE) {
+			return nil, errors.New("x509: malformed crl")
+		}
+		for !revokedSeq.Empty() {
+			rce, err := parseRevocationListEntry(&revokedSeq)
+			if err != nil {
+				return nil, err
+			}
+			rl.RevokedCertificateEntries = append(rl.RevokedCertificateEntries, rce)
+			rl.RevokedCertificates = append(rl.RevokedCertificates, pkix.RevokedCertificate{
+				SerialNumber:   rce.SerialNumber,
+				RevocationTime: rce.RevocationTime,
+				Extensions:     rce.Extensions,
+			})
+		}
+	}
+
+	var extensions cryptobyte.String
+	var present bool
+	if !tbs.ReadOptionalASN1(&extensions, &present, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
+		return nil, errors.New("x509: malformed extensions")
+	}
+	if present {
+		if !extensions.ReadASN1(&extensions, cryptobyte_asn1.SEQUENCE) {
+			return nil, errors.New("x509: malformed extensions")
+		}
+		for !extensions.Empty() {
+			var extension cryptobyte.String
+			if !extensions.ReadASN1(&extension, cryptobyte_asn1.SEQUENCE) {
+				return nil, errors.New("x509: malformed extension")
+			}
+			ext, err := parseExtension(extension)
+			if err != nil {
+				return nil, err
+			}
+			if err := processRevocationListExtension(rl, ext); err != nil {
+				return nil, err
+			}
+			rl.Extensions = append(rl.Extensions, ext)
+		}
+	}
+	if !tbs.Empty() {
+		return nil, errors.New("x509: malformed tbs crl")
+	}
+
+	return rl, nil
+}
+
+func parseRevocationListEntry(der *cryptobyte.String) (RevocationListEntry, error) {
+	var rce RevocationListEntry
+	var entry cryptobyte.String
+	if !der.ReadASN1Element(&entry, cryptobyte_asn1.SEQUENCE) {
+		return rce, errors.New("x509: malformed crl entry")
+	}
+	rce.Raw = entry
+	if !entry.ReadASN1(&entry, cryptobyte_asn1.SEQUENCE) {
+		return rce, errors.New("x509: malformed crl entry")
+	}
+
+	rce.SerialNumber = new(big.Int)
+	if !entry.ReadASN1Integer(rce.SerialNumber) {
+		return rce, errors.New("x509: malformed serial number")
+	}
+	var err error
+	rce.RevocationTime, err = parseTime(&entry)
+	if err != nil {
+		return rce, err
+	}
+
+	var extensions cryptobyte.String
+	var present bool
+	if !entry.ReadOptionalASN1(&extensions, &present, cryptobyte_asn1.SEQUENCE) {
+		return rce, errors.New("x509: malformed extensions")
+	}
+	for present && !extensions.Empty() {
+		var extension cryptobyte.String
+		if !extensions.ReadASN1(&extension, cryptobyte_asn1.SEQUENCE) {
+			return rce, errors.New("x509: malformed extension")
+		}
+		ext, err := parseExtension(extension)
+		if err != nil {
+			return rce, err
+		}
+		switch {
+		case ext.Id.Equal(oidExtensionReasonCode):
+			val := cryptobyte.String(ext.Value)
+			var reason int
+			if !val.ReadASN1Enum(&reason) || !val.Empty() || !RevocationReason(reason).valid() {
+				return rce, errors.New("x509: malformed reasonCode extension")
+			}
+			rce.ReasonCode = RevocationReason(reason)
+		case ext.Id.Equal(oidExtensionInvalidityDate):
+			val := cryptobyte.String(ext.Value)
+			if !val.ReadASN1GeneralizedTime(&rce.InvalidityDate) || !val.Empty() {
+				return rce, errors.New("x509: malformed invalidityDate extension")
+			}
+		}
+		rce.Extensions = append(rce.Extensions, ext)
+	}
+	if !entry.Empty() {
+		return rce, errors.New("x509: malformed crl entry")
+	}
+
+	return rce, nil
+}
+
+func processRevocationListExtension(rl *RevocationList, ext pkix.Extension) error {
+	val := cryptobyte.String(ext.Value)
+	switch {
+	case ext.Id.Equal(oidExtensionAuthorityKeyId):
+		// RFC 5280, 4.2.1.1
+		var akid cryptobyte.String
+		if !val.ReadASN1(&akid, cryptobyte_asn1.SEQUENCE) {
+			return errors.New("x509: invalid authority key identifier")
+		}
+		if akid.PeekASN1Tag(cryptobyte_asn1.Tag(0).ContextSpecific()) {
+			if !akid.ReadASN1(&akid, cryptobyte_asn1.Tag(0).ContextSpecific()) {
+				return errors.New("x509: invalid authority key identifier")
+			}
+			rl.AuthorityKeyId = akid
+		}
+	case ext.Id.Equal(oidExtensionCRLNumber):
+		rl.Number = new(big.Int)
+		if !val.ReadASN1Integer(rl.Number) || !val.Empty() {
+			return errors.New("x509: malformed crl number")
+		}
+	case ext.Id.Equal(oidExtensionDeltaCRLIndicator):
+		rl.BaseCRLNumber = new(big.Int)
+		if !val.ReadASN1Integer(rl.BaseCRLNumber) || !val.Empty() {
+			return errors.New("x509: malformed delta crl indicator")
+		}
+	case ext.Id.Equal(oidExtensionIssuingDistributionPoint):
+		idp, err := parseIssuingDistributionPoint(val)
+		if err != nil {
+			return err
+		}
+		rl.IssuingDistributionPoint = idp
+	case ext.Id.Equal(oidExtensionFreshestCRL):
+		var err error
+		rl.FreshestCRL, err = parseCRLDistributionPoints(val)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseIssuingDistributionPoint(der cryptobyte.String) (*IssuingDistributionPoint, error) {
+	// RFC 5280, 5.2.5
+
+	// IssuingDistributionPoint ::= SEQUENCE {
+	//     distributionPoint          [0] DistributionPointName OPTIONAL,
+	//     onlyContainsUserCerts      [1] BOOLEAN DEFAULT FALSE,
+	//     onlyContainsCACerts        [2] BOOLEAN DEFAULT FALSE,
+	//     onlySomeReasons            [3] ReasonFlags OPTIONAL,
+	//     indirectCRL                [4] BOOLEAN DEFAULT FALSE,
+	//     onlyContainsAttributeCerts [5] BOOLEAN DEFAULT FALSE }
+	if !der.ReadASN1(&der, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("x509: invalid issuing distribution point")
+	}
+	idp := &IssuingDistributionPoint{}
+
+	var dpName cryptobyte.String
+	var present bool
+	if !der.ReadOptionalASN1(&dpName, &present, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
+		return nil, errors.New("x509: invalid issuing distribution point")
+	}
+	if present {
+		var err error
+		idp.DistributionPoint, err = parseDistributionPointName(dpName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	readBool := func(out *bool, tag int) bool {
+		var val cryptobyte.String
+		var present bool
+		if !der.ReadOptionalASN1(&val, &present, cryptobyte_asn1.Tag(tag).ContextSpecific()) {
+			return false
+		}
+		if !present {
+			return true
+		}
+		if len(val) != 1 || val[0] != 0 && val[0] != 0xff {
+			return false
+		}
+		*out = val[0] == 0xff
+		return true
+	}
+	if !readBool(&idp.OnlyContainsUserCerts, 1) || !readBool(&idp.OnlyContainsCACerts, 2) {
+		return nil, errors.New("x509: invalid issuing distribution point")
+	}
+
+	var reasons cryptobyte.String
+	if !der.ReadOptionalASN1(&reasons, &present, cryptobyte_asn1.Tag(3).ContextSpecific()) {
+		return nil, errors.New("x509: invalid issuing distribution point")
+	}
+	if present {
+		if len(reasons) == 0 || reasons[0] > 7 || len(reasons) == 1 && reasons[0] != 0 {
+			return nil, errors.New("x509: invalid issuing distribution point reasons")
+		}
+		flags := reasons[1:]
+		for r := RevocationReasonKeyCompromise; r <= RevocationReasonAACompromise; r++ {
+			bit, ok := r.reasonFlagsBit()
+			if ok && bit/8 < len(flags) && flags[bit/8]&(0x80>>uint(bit%8)) != 0 {
+				idp.OnlySomeReasons = append(idp.OnlySomeReasons, r)
+			}
+		}
+	}
+
+	if !readBool(&idp.IndirectCRL, 4) || !readBool(&idp.OnlyContainsAttributeCerts, 5) || !der.Empty() {
+		return nil, errors.New("x509: invalid issuing distribution point")
+	}
+
+	return idp, nil
+}
@@ -14,18 +14,58 @@ import "sync"
 
 var (
 	once           sync.Once
+	systemRootsMu  sync.RWMutex
 	systemRoots    *CertPool
 	systemRootsErr error
 )
 
 func systemRootsPool() *CertPool {
 	once.Do(initSystemRoots)
+	systemRootsMu.RLock()
+	defer systemRootsMu.RUnlock()
 	return systemRoots
 }
 
+// systemRootsError returns the error encountered loading the system roots,
+// if systemRootsPool returned nil.
+func systemRootsError() error {
+	systemRootsMu.RLock()
+	defer systemRootsMu.RUnlock()
+	return systemRootsErr
+}
+
 func initSystemRoots() {
+	systemRootsMu.Lock()
+	defer systemRootsMu.Unlock()
 	systemRoots, systemRootsErr = loadSystemRoots()
 	if systemRootsErr != nil {
 		systemRoots = nil
 	}
 }
+
+// ReloadSystemRoots reloads the system root pool, which is otherwise loaded
+// once and cached for the life of the process. The reloaded roots are used
+// by Certificate.Verify when VerifyOptions.Roots is nil, and are returned by
+// subsequent calls to SystemCertPool. Pools previously returned by
+// SystemCertPool are not affected.
+//
+// ReloadSystemRoots reports whether the set of system roots changed. If the
+// roots can't be loaded, the error is returned and the previously loaded
+// roots are kept.
+//
+// Long-running programs can call ReloadSystemRoots periodically, or on a
+// signal, to pick up changes to the system roots. On Windows, where the
+// platform verifier is always consulted, it has no effect.
+func ReloadSystemRoots() (changed bool, err error) {
+	once.Do(initSystemRoots)
+	roots, err := loadSystemRoots()
+	if err != nil {
+		return false, err
+	}
+
+	systemRootsMu.Lock()
+	defer systemRootsMu.Unlock()
+	changed = systemRootsErr != nil || !systemRoots.equal(roots)
+	systemRoots, systemRootsErr = roots, nil
+	return changed, nil
+}
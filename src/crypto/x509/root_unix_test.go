@@ -227,3 +227,59 @@ func TestReadUniqueDirectoryEntries(t *testing.T) {
 		t.Errorf("got %q; want %q", gotNames, wantNames)
 	}
 }
+
+func TestReloadSystemRoots(t *testing.T) {
+	origFile, origDir := os.Getenv(certFileEnv), os.Getenv(certDirEnv)
+	origRoots := systemRootsPool()
+	defer func() {
+		os.Setenv(certFileEnv, origFile)
+		os.Setenv(certDirEnv, origDir)
+		systemRootsMu.Lock()
+		systemRoots, systemRootsErr = origRoots, nil
+		systemRootsMu.Unlock()
+	}()
+
+	tmpDir := t.TempDir()
+	certFile := filepath.Join(tmpDir, "cert.pem")
+	os.Setenv(certFileEnv, certFile)
+	os.Setenv(certDirEnv, filepath.Join(tmpDir, "certs"))
+
+	reload := func(wantChanged bool, wantLen int) {
+		t.Helper()
+		changed, err := ReloadSystemRoots()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != wantChanged {
+			t.Errorf("ReloadSystemRoots reported changed = %v, want %v", changed, wantChanged)
+		}
+		pool, err := SystemCertPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pool.len() != wantLen {
+			t.Errorf("SystemCertPool has %d certificates, want %d", pool.len(), wantLen)
+		}
+	}
+
+	if err := os.WriteFile(certFile, []byte(geoTrustRoot), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ReloadSystemRoots()
+	reload(false, 1)
+
+	if err := os.WriteFile(certFile, []byte(geoTrustRoot+"\n"+startComRoot), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reload(true, 2)
+	reload(false, 2)
+
+	// A failed reload keeps the previous roots.
+	os.Setenv(certFileEnv, tmpDir)
+	if _, err := ReloadSystemRoots(); err == nil {
+		t.Error("ReloadSystemRoots succeeded with a directory as the certificate file")
+	}
+	if systemRootsPool().len() != 2 {
+		t.Error("failed reload modified the system roots")
+	}
+}
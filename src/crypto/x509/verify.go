@@ -151,6 +151,22 @@ func (e UnknownAuthorityError) Error() string {
 	return s
 }
 
+// RevocationError results when VerifyOptions.RevocationCheck returns an error
+// for a certificate of every candidate chain.
+type RevocationError struct {
+	// Cert is the certificate that failed the check in the first discarded
+	// chain.
+	Cert *Certificate
+	// Err is the error returned by VerifyOptions.RevocationCheck.
+	Err error
+}
+
+func (e RevocationError) Error() string {
+	return "x509: certificate failed the revocation check: " + e.Err.Error()
+}
+
+func (e RevocationError) Unwrap() error { return e.Err }
+
 // SystemRootsError results when we fail to load the system root certificates.
 type SystemRootsError struct {
 	Err error
@@ -199,6 +215,19 @@ type VerifyOptions struct {
 	// certificates from consuming excessive amounts of CPU time when
 	// validating. It does not apply to the platform verifier.
 	MaxConstraintComparisions int
+
+	// RevocationCheck, if not nil, is called to check the revocation status
+	// of each certificate of the candidate chains, except the root, along
+	// with the next certificate in the chain, which issued it. It should
+	// return an error if the certificate is revoked, or if its status can't
+	// be determined and the caller can't tolerate that. Chains containing
+	// such a certificate are discarded, and if none remain Verify returns a
+	// RevocationError. RevocationCheck is called at most once for each pair
+	// of certificates, and it also applies to the platform verifier.
+	//
+	// ParseRevocationList and ParseOCSPResponseForCert can be used to
+	// implement it.
+	RevocationCheck func(cert, issuer *Certificate) error
 }
 
 const (
@@ -724,7 +753,9 @@ func (c *Certificate) isValid(certType int, currentChain []*Certificate, opts *V
 // list. (While this is not specified, it is common practice in order to limit
 // the types of certificates a CA can issue.)
 //
-// WARNING: this function doesn't do any revocation checking.
+// WARNING: this function doesn't do any revocation checking on its own. To
+// check the revocation status of the certificates, set
+// opts.RevocationCheck.
 func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err error) {
 	// Platform-specific verification needs the ASN.1 contents so
 	// this makes the behavior consistent across platforms.
@@ -743,13 +774,17 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 
 	// Use Windows's own verification and chain building.
 	if opts.Roots == nil && runtime.GOOS == "windows" {
-		return c.systemVerify(&opts)
+		chains, err = c.systemVerify(&opts)
+		if err != nil {
+			return nil, err
+		}
+		return checkChainsRevocation(chains, &opts)
 	}
 
 	if opts.Roots == nil {
 		opts.Roots = systemRootsPool()
 		if opts.Roots == nil {
-			return nil, SystemRootsError{systemRootsErr}
+			return nil, SystemRootsError{systemRootsError()}
 		}
 	}
 
@@ -767,7 +802,13 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 
 	var candidateChains [][]*Certificate
 	if opts.Roots.contains(c) {
-		candidateChains = append(candidateChains, []*Certificate{c})
+		chain := []*Certificate{c}
+		if constraint := opts.Roots.constraint(c); constraint != nil {
+			if err := constraint(chain); err != nil {
+				return nil, UnknownAuthorityError{c, err, c}
+			}
+		}
+		candidateChains = append(candidateChains, chain)
 	} else {
 		if candidateChains, err = c.buildChains(nil, []*Certificate{c}, nil, &opts); err != nil {
 			return nil, err
@@ -782,7 +823,7 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 	// If any key usage is acceptable then we're done.
 	for _, usage := range keyUsages {
 		if usage == ExtKeyUsageAny {
-			return candidateChains, nil
+			return checkChainsRevocation(candidateChains, &opts)
 		}
 	}
 
@@ -796,7 +837,45 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 		return nil, CertificateInvalidError{c, IncompatibleUsage, ""}
 	}
 
-	return chains, nil
+	return checkChainsRevocation(chains, &opts)
+}
+
+// checkChainsRevocation returns the chains in which opts.RevocationCheck
+// doesn't return an error for any certificate.
+func checkChainsRevocation(chains [][]*Certificate, opts *VerifyOptions) ([][]*Certificate, error) {
+	if opts.RevocationCheck == nil {
+		return chains, nil
+	}
+
+	type certPair struct {
+		cert, issuer *Certificate
+	}
+	checked := make(map[certPair]error)
+	var firstErr error
+	var verified [][]*Certificate
+NextChain:
+	for _, chain := range chains {
+		for i := 0; i < len(chain)-1; i++ {
+			pair := certPair{chain[i], chain[i+1]}
+			err, ok := checked[pair]
+			if !ok {
+				err = opts.RevocationCheck(pair.cert, pair.issuer)
+				checked[pair] = err
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = RevocationError{Cert: pair.cert, Err: err}
+				}
+				continue NextChain
+			}
+		}
+		verified = append(verified, chain)
+	}
+
+	if len(verified) == 0 {
+		return nil, firstErr
+	}
+	return verified, nil
 }
 
 func appendToFreshChain(chain []*Certificate, cert *Certificate) []*Certificate {
@@ -818,9 +897,9 @@ func (c *Certificate) buildChains(cache map[*Certificate][][]*Certificate, curre
 		hintCert *Certificate
 	)
 
-	considerCandidate := func(certType int, candidate *Certificate) {
+	considerCandidate := func(certType int, candidate potentialParent) {
 		for _, cert := range currentChain {
-			if cert.Equal(candidate) {
+			if cert.Equal(candidate.cert) {
 				return
 			}
 		}
@@ -834,30 +913,40 @@ func (c *Certificate) buildChains(cache map[*Certificate][][]*Certificate, curre
 			return
 		}
 
-		if err := c.CheckSignatureFrom(candidate); err != nil {
+		if err := c.CheckSignatureFrom(candidate.cert); err != nil {
 			if hintErr == nil {
 				hintErr = err
-				hintCert = candidate
+				hintCert = candidate.cert
 			}
 			return
 		}
 
-		err = candidate.isValid(certType, currentChain, opts)
+		err = candidate.cert.isValid(certType, currentChain, opts)
 		if err != nil {
 			return
 		}
 
 		switch certType {
 		case rootCertificate:
-			chains = append(chains, appendToFreshChain(currentChain, candidate))
+			chain := appendToFreshChain(currentChain, candidate.cert)
+			if candidate.constraint != nil {
+				if err := candidate.constraint(chain); err != nil {
+					if hintErr == nil {
+						hintErr = err
+						hintCert = candidate.cert
+					}
+					return
+				}
+			}
+			chains = append(chains, chain)
 		case intermediateCertificate:
 			if cache == nil {
 				cache = make(map[*Certificate][][]*Certificate)
 			}
-			childChains, ok := cache[candidate]
+			childChains, ok := cache[candidate.cert]
 			if !ok {
-				childChains, err = candidate.buildChains(cache, appendToFreshChain(currentChain, candidate), sigChecks, opts)
-				cache[candidate] = childChains
+				childChains, err = candidate.cert.buildChains(cache, appendToFreshChain(currentChain, candidate.cert), sigChecks, opts)
+				cache[candidate.cert] = childChains
 			}
 			chains = append(chains, childChains...)
 		}
@@ -1868,3 +1868,140 @@ func TestSystemRootsErrorUnwrap(t *testing.T) {
 		t.Error("errors.Is failed, wanted success")
 	}
 }
+
+func TestVerifyRevocationCheck(t *testing.T) {
+	root1, root1Key, err := generateCert("Root CA 1", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root2, root2Key, err := generateCert("Root CA 2", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inter1, interKey, err := generateCert("Intermediate CA", true, root1, root1Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// inter2 is a cross-signed version of inter1, issued by root2.
+	der, err := CreateCertificate(rand.Reader, inter1, root2, interKey.(*ecdsa.PrivateKey).Public(), root2Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inter2, err := ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := generateCert("Leaf", false, inter1, interKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots, intermediates := NewCertPool(), NewCertPool()
+	roots.AddCert(root1)
+	roots.AddCert(root2)
+	intermediates.AddCert(inter1)
+	intermediates.AddCert(inter2)
+
+	errRevoked := errors.New("revoked")
+	verify := func(revoked *Certificate) ([][]*Certificate, int, error) {
+		calls := 0
+		chains, err := leaf.Verify(VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			RevocationCheck: func(cert, issuer *Certificate) error {
+				calls++
+				if cert == root1 || cert == root2 {
+					t.Errorf("RevocationCheck called for root %v", cert.Subject)
+				}
+				if cert == revoked {
+					return errRevoked
+				}
+				return nil
+			},
+		})
+		return chains, calls, err
+	}
+
+	chains, calls, err := verify(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 2 || calls != 4 {
+		t.Errorf("got %d chains and %d calls, want 2 chains and 4 calls", len(chains), calls)
+	}
+
+	chains, _, err = verify(inter1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || chains[0][1] != inter2 {
+		t.Errorf("unexpected chains with a revoked intermediate: %v", chains)
+	}
+
+	_, _, err = verify(leaf)
+	var revErr RevocationError
+	if !errors.As(err, &revErr) || revErr.Cert != leaf || !errors.Is(err, errRevoked) {
+		t.Errorf("error with a revoked leaf = %v, want a RevocationError", err)
+	}
+}
+
+func TestVerifyWithConstraint(t *testing.T) {
+	root, rootKey, err := generateCert("Private Root", true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, _, err := generateCert("allowed.example", false, root, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	denied, _, err := generateCert("denied.example", false, root, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errDenied := errors.New("name not allowed for this root")
+	var calls int
+	constraint := func(chain []*Certificate) error {
+		calls++
+		if chain[len(chain)-1] != root {
+			t.Errorf("constraint called with a chain rooted at %v", chain[len(chain)-1].Subject)
+		}
+		if chain[0].Subject.CommonName != "allowed.example" && chain[0] != root {
+			return errDenied
+		}
+		return nil
+	}
+	constrained := NewCertPool()
+	constrained.AddCertWithConstraint(root, constraint)
+	// Combined pools keep the constraint.
+	roots := NewCertPool()
+	roots.AddPool(constrained)
+
+	opts := VerifyOptions{Roots: roots}
+	if _, err := allowed.Verify(opts); err != nil {
+		t.Errorf("allowed leaf: %v", err)
+	}
+	_, err = denied.Verify(opts)
+	if uaErr, ok := err.(UnknownAuthorityError); !ok || uaErr.hintErr != errDenied {
+		t.Errorf("denied leaf: got error %v, want an UnknownAuthorityError for the constraint", err)
+	}
+	if _, err := root.Verify(opts); err != nil {
+		t.Errorf("root: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("constraint called %d times, want 3", calls)
+	}
+
+	// Adding the same root without a constraint doesn't lift it.
+	roots.AddCert(root)
+	if _, err := denied.Verify(opts); err == nil {
+		t.Error("denied leaf verified after adding the root again")
+	}
+
+	// Without the constraint, both leaves are valid.
+	unconstrained := NewCertPool()
+	unconstrained.AddCert(root)
+	if _, err := denied.Verify(VerifyOptions{Roots: unconstrained}); err != nil {
+		t.Errorf("denied leaf with an unconstrained root: %v", err)
+	}
+}
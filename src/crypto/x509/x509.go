@@ -865,6 +865,8 @@ func checkSignature(algo SignatureAlgorithm, signed, signature []byte, publicKey
 }
 
 // CheckCRLSignature checks that the signature in crl is from c.
+//
+// New code should use ParseRevocationList and RevocationList.CheckSignatureFrom.
 func (c *Certificate) CheckCRLSignature(crl *pkix.CertificateList) error {
 	algo := getSignatureAlgorithmFromAI(crl.SignatureAlgorithm)
 	return c.CheckSignature(algo, crl.TBSCertList.Raw, crl.SignatureValue.RightAlign())
@@ -912,6 +914,93 @@ type distributionPointName struct {
 	RelativeName pkix.RDNSequence `asn1:"optional,tag:1"`
 }
 
+// RFC 5280, 5.2.5
+type issuingDistributionPoint struct {
+	DistributionPoint          distributionPointName `asn1:"optional,tag:0"`
+	OnlyContainsUserCerts      bool                  `asn1:"optional,tag:1"`
+	OnlyContainsCACerts        bool                  `asn1:"optional,tag:2"`
+	OnlySomeReasons            asn1.BitString        `asn1:"optional,tag:3"`
+	IndirectCRL                bool                  `asn1:"optional,tag:4"`
+	OnlyContainsAttributeCerts bool                  `asn1:"optional,tag:5"`
+}
+
+// marshalCRLDistributionPoints marshals the contents of a CRL distribution
+// points or freshest CRL extension, with a distribution point for each URI.
+func marshalCRLDistributionPoints(uris []string) ([]byte, error) {
+	var crlDp []distributionPoint
+	for _, name := range uris {
+		dp := distributionPoint{
+			DistributionPoint: distributionPointName{
+				FullName: []asn1.RawValue{
+					{Tag: 6, Class: 2, Bytes: []byte(name)},
+				},
+			},
+		}
+		crlDp = append(crlDp, dp)
+	}
+	return asn1.Marshal(crlDp)
+}
+
+func marshalIssuingDistributionPoint(idp *IssuingDistributionPoint) ([]byte, error) {
+	only := 0
+	for _, b := range []bool{idp.OnlyContainsUserCerts, idp.OnlyContainsCACerts, idp.OnlyContainsAttributeCerts} {
+		if b {
+			only++
+		}
+	}
+	if only > 1 {
+		return nil, errors.New("x509: IssuingDistributionPoint can only set one of the OnlyContains fields")
+	}
+
+	out := issuingDistributionPoint{
+		OnlyContainsUserCerts:      idp.OnlyContainsUserCerts,
+		OnlyContainsCACerts:        idp.OnlyContainsCACerts,
+		IndirectCRL:                idp.IndirectCRL,
+		OnlyContainsAttributeCerts: idp.OnlyContainsAttributeCerts,
+	}
+	for _, name := range idp.DistributionPoint {
+		out.DistributionPoint.FullName = append(out.DistributionPoint.FullName,
+			asn1.RawValue{Tag: 6, Class: 2, Bytes: []byte(name)})
+	}
+	if len(idp.OnlySomeReasons) > 0 {
+		var flags [2]byte
+		for _, r := range idp.OnlySomeReasons {
+			bit, ok := r.reasonFlagsBit()
+			if !ok {
+				return nil, fmt.Errorf("x509: reason code %d can't be used in IssuingDistributionPoint.OnlySomeReasons", r)
+			}
+			flags[bit/8] |= 0x80 >> uint(bit%8)
+		}
+		bitLength := asn1BitLength(flags[:])
+		out.OnlySomeReasons = asn1.BitString{Bytes: flags[:(bitLength+7)/8], BitLength: bitLength}
+	}
+	return asn1.Marshal(out)
+}
+
+// marshalRevocationListEntryExtensions returns the extensions of the CRL
+// entry rce, including its ExtraExtensions.
+func marshalRevocationListEntryExtensions(rce *RevocationListEntry) ([]pkix.Extension, error) {
+	if !rce.ReasonCode.valid() {
+		return nil, fmt.Errorf("x509: template contains entry with invalid ReasonCode %d", rce.ReasonCode)
+	}
+	var exts []pkix.Extension
+	if rce.ReasonCode != RevocationReasonUnspecified && !oidInExtensions(oidExtensionReasonCode, rce.ExtraExtensions) {
+		reasonCode, err := asn1.Marshal(asn1.Enumerated(rce.ReasonCode))
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, pkix.Extension{Id: oidExtensionReasonCode, Value: reasonCode})
+	}
+	if !rce.InvalidityDate.IsZero() && !oidInExtensions(oidExtensionInvalidityDate, rce.ExtraExtensions) {
+		invalidityDate, err := asn1.MarshalWithParams(rce.InvalidityDate.UTC(), "generalized")
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, pkix.Extension{Id: oidExtensionInvalidityDate, Value: invalidityDate})
+	}
+	return append(exts, rce.ExtraExtensions...), nil
+}
+
 func reverseBitsInAByte(in byte) byte {
 	b1 := in>>4 | in<<4
 	b2 := b1>>2&0x33 | b1<<2&0xcc
@@ -940,17 +1029,22 @@ func asn1BitLength(bitString []byte) int {
 }
 
 var (
-	oidExtensionSubjectKeyId          = []int{2, 5, 29, 14}
-	oidExtensionKeyUsage              = []int{2, 5, 29, 15}
-	oidExtensionExtendedKeyUsage      = []int{2, 5, 29, 37}
-	oidExtensionAuthorityKeyId        = []int{2, 5, 29, 35}
-	oidExtensionBasicConstraints      = []int{2, 5, 29, 19}
-	oidExtensionSubjectAltName        = []int{2, 5, 29, 17}
-	oidExtensionCertificatePolicies   = []int{2, 5, 29, 32}
-	oidExtensionNameConstraints       = []int{2, 5, 29, 30}
-	oidExtensionCRLDistributionPoints = []int{2, 5, 29, 31}
-	oidExtensionAuthorityInfoAccess   = []int{1, 3, 6, 1, 5, 5, 7, 1, 1}
-	oidExtensionCRLNumber             = []int{2, 5, 29, 20}
+	oidExtensionSubjectKeyId             = []int{2, 5, 29, 14}
+	oidExtensionKeyUsage                 = []int{2, 5, 29, 15}
+	oidExtensionExtendedKeyUsage         = []int{2, 5, 29, 37}
+	oidExtensionAuthorityKeyId           = []int{2, 5, 29, 35}
+	oidExtensionBasicConstraints         = []int{2, 5, 29, 19}
+	oidExtensionSubjectAltName           = []int{2, 5, 29, 17}
+	oidExtensionCertificatePolicies      = []int{2, 5, 29, 32}
+	oidExtensionNameConstraints          = []int{2, 5, 29, 30}
+	oidExtensionCRLDistributionPoints    = []int{2, 5, 29, 31}
+	oidExtensionAuthorityInfoAccess      = []int{1, 3, 6, 1, 5, 5, 7, 1, 1}
+	oidExtensionCRLNumber                = []int{2, 5, 29, 20}
+	oidExtensionReasonCode               = []int{2, 5, 29, 21}
+	oidExtensionInvalidityDate           = []int{2, 5, 29, 24}
+	oidExtensionDeltaCRLIndicator        = []int{2, 5, 29, 27}
+	oidExtensionIssuingDistributionPoint = []int{2, 5, 29, 28}
+	oidExtensionFreshestCRL              = []int{2, 5, 29, 46}
 )
 
 var (
@@ -1209,20 +1303,7 @@ func buildCertExtensions(template *Certificate, subjectIsEmpty bool, authorityKe
 	if len(template.CRLDistributionPoints) > 0 &&
 		!oidInExtensions(oidExtensionCRLDistributionPoints, template.ExtraExtensions) {
 		ret[n].Id = oidExtensionCRLDistributionPoints
-
-		var crlDp []distributionPoint
-		for _, name := range template.CRLDistributionPoints {
-			dp := distributionPoint{
-				DistributionPoint: distributionPointName{
-					FullName: []asn1.RawValue{
-						{Tag: 6, Class: 2, Bytes: []byte(name)},
-					},
-				},
-			}
-			crlDp = append(crlDp, dp)
-		}
-
-		ret[n].Value, err = asn1.Marshal(crlDp)
+		ret[n].Value, err = marshalCRLDistributionPoints(template.CRLDistributionPoints)
 		if err != nil {
 			return
 		}
@@ -1612,6 +1693,9 @@ func ParseCRL(crlBytes []byte) (*pkix.CertificateList, error) {
 }
 
 // ParseDERCRL parses a DER encoded CRL from the given bytes.
+//
+// The CRL extensions are not parsed. New code should use ParseRevocationList,
+// which supports X.509 v2 CRL extensions.
 func ParseDERCRL(derBytes []byte) (*pkix.CertificateList, error) {
 	certList := new(pkix.CertificateList)
 	if rest, err := asn1.Unmarshal(derBytes, certList); err != nil {
@@ -2064,35 +2148,221 @@ func (c *CertificateRequest) CheckSignature() error {
 	return checkSignature(c.SignatureAlgorithm, c.RawTBSCertificateRequest, c.Signature, c.PublicKey)
 }
 
-// RevocationList contains the fields used to create an X.509 v2 Certificate
-// Revocation list with CreateRevocationList.
+// RevocationReason is a reason code for the revocation of a certificate, as
+// used in the reasonCode CRL entry extension and in OCSP responses. See RFC
+// 5280, Section 5.3.1.
+type RevocationReason int
+
+const (
+	RevocationReasonUnspecified          RevocationReason = 0
+	RevocationReasonKeyCompromise        RevocationReason = 1
+	RevocationReasonCACompromise         RevocationReason = 2
+	RevocationReasonAffiliationChanged   RevocationReason = 3
+	RevocationReasonSuperseded           RevocationReason = 4
+	RevocationReasonCessationOfOperation RevocationReason = 5
+	RevocationReasonCertificateHold      RevocationReason = 6
+	// Value 7 is not used.
+	RevocationReasonRemoveFromCRL      RevocationReason = 8
+	RevocationReasonPrivilegeWithdrawn RevocationReason = 9
+	RevocationReasonAACompromise       RevocationReason = 10
+)
+
+func (r RevocationReason) valid() bool {
+	return r >= RevocationReasonUnspecified && r <= RevocationReasonAACompromise && r != 7
+}
+
+// reasonFlagsBit returns the position of r in the ReasonFlags BIT STRING of
+// RFC 5280, Section 4.2.1.13, which has no bit for removeFromCRL.
+func (r RevocationReason) reasonFlagsBit() (int, bool) {
+	switch {
+	case r >= RevocationReasonKeyCompromise && r <= RevocationReasonCertificateHold:
+		return int(r), true
+	case r == RevocationReasonPrivilegeWithdrawn:
+		return 7, true
+	case r == RevocationReasonAACompromise:
+		return 8, true
+	}
+	return 0, false
+}
+
+// RevocationListEntry represents an entry in the revokedCertificates
+// sequence of a CRL.
+type RevocationListEntry struct {
+	// Raw contains the raw bytes of the revokedCertificates entry. It is set
+	// when parsing a CRL; it is ignored when generating a CRL.
+	Raw []byte
+
+	// SerialNumber represents the serial number of a revoked certificate. It
+	// is both used when creating a CRL and populated when parsing a CRL. It
+	// must not be nil.
+	SerialNumber *big.Int
+	// RevocationTime represents the time at which the certificate was
+	// revoked. It is both used when creating a CRL and populated when parsing
+	// a CRL. It must not be the zero time.
+	RevocationTime time.Time
+	// ReasonCode represents the reason for revocation, using the reasonCode
+	// CRL entry extension. RevocationReasonUnspecified causes the extension
+	// to be omitted, as recommended by RFC 5280, Section 5.3.1. When parsing,
+	// a missing extension also results in RevocationReasonUnspecified.
+	ReasonCode RevocationReason
+	// InvalidityDate is the time at which the private key is known or
+	// suspected to have been compromised, using the invalidityDate CRL entry
+	// extension. It is omitted if zero.
+	InvalidityDate time.Time
+
+	// Extensions contains raw X.509 extensions. When parsing CRL entries,
+	// this can be used to extract extensions that are not parsed by this
+	// package. This field is not populated when marshaling CRL entries, see
+	// ExtraExtensions.
+	Extensions []pkix.Extension
+	// ExtraExtensions contains any additional extensions to add directly to
+	// the CRL entry. It is populated when creating a CRL, and ignored when
+	// parsing. Values override any extensions that would otherwise be
+	// produced based on the other fields of the entry.
+	ExtraExtensions []pkix.Extension
+}
+
+// IssuingDistributionPoint is the issuing distribution point CRL extension,
+// which identifies the scope of a CRL. See RFC 5280, Section 5.2.5.
+type IssuingDistributionPoint struct {
+	// DistributionPoint contains the URIs of the fullName of the distribution
+	// point of the CRL. Other names are ignored when parsing.
+	DistributionPoint []string
+
+	// At most one of OnlyContainsUserCerts, OnlyContainsCACerts and
+	// OnlyContainsAttributeCerts may be set.
+	OnlyContainsUserCerts      bool
+	OnlyContainsCACerts        bool
+	OnlyContainsAttributeCerts bool
+
+	// OnlySomeReasons, if not empty, restricts the CRL to revocations for the
+	// listed reasons. RevocationReasonUnspecified and
+	// RevocationReasonRemoveFromCRL can't be listed.
+	OnlySomeReasons []RevocationReason
+
+	// IndirectCRL indicates that the CRL may contain revocations of
+	// certificates issued by authorities other than the CRL issuer.
+	IndirectCRL bool
+}
+
+// RevocationList represents a Certificate Revocation List (CRL) as specified
+// by RFC 5280. It contains the fields used to create an X.509 v2 CRL with
+// CreateRevocationList, and is returned by ParseRevocationList.
 type RevocationList struct {
+	// Raw contains the complete ASN.1 DER content of the CRL (tbsCertList,
+	// signatureAlgorithm, and signatureValue.) It is set when parsing a CRL.
+	Raw []byte
+	// RawTBSRevocationList contains just the tbsCertList portion of the ASN.1
+	// DER. It is set when parsing a CRL.
+	RawTBSRevocationList []byte
+	// RawIssuer contains the DER encoded Issuer. It is set when parsing a
+	// CRL.
+	RawIssuer []byte
+
+	// Issuer contains the DN of the issuing certificate. It is set when
+	// parsing a CRL, and populated from the issuer certificate when creating
+	// one.
+	Issuer pkix.Name
+	// AuthorityKeyId is used to identify the public key associated with the
+	// issuing certificate. It is populated from the authorityKeyIdentifier
+	// extension when parsing a CRL. It is ignored when creating a CRL; the
+	// extension is populated from the issuing certificate itself.
+	AuthorityKeyId []byte
+
+	// Signature contains the signature of the CRL. It is set when parsing a
+	// CRL.
+	Signature []byte
 	// SignatureAlgorithm is used to determine the signature algorithm to be
 	// used when signing the CRL. If 0 the default algorithm for the signing
-	// key will be used.
+	// key will be used. When parsing, it is set to the algorithm the CRL was
+	// signed with.
 	SignatureAlgorithm SignatureAlgorithm
 
+	// RevokedCertificateEntries represents the revokedCertificates sequence
+	// in the CRL. It is used when creating a CRL and also populated when
+	// parsing a CRL. When creating a CRL, it may be empty or nil, in which
+	// case the revokedCertificates ASN.1 sequence will be omitted from the
+	// CRL entirely.
+	RevokedCertificateEntries []RevocationListEntry
+
 	// RevokedCertificates is used to populate the revokedCertificates
-	// sequence in the CRL, it may be empty. RevokedCertificates may be nil,
-	// in which case an empty CRL will be created.
+	// sequence in the CRL if RevokedCertificateEntries is empty. It may be
+	// empty or nil, in which case an empty CRL will be created. When parsing
+	// a CRL, it is populated from the same entries as
+	// RevokedCertificateEntries.
+	//
+	// New code should use RevokedCertificateEntries, which supports reason
+	// codes and other CRL entry extensions.
 	RevokedCertificates []pkix.RevokedCertificate
 
 	// Number is used to populate the X.509 v2 cRLNumber extension in the CRL,
 	// which should be a monotonically increasing sequence number for a given
-	// CRL scope and CRL issuer.
+	// CRL scope and CRL issuer. It is also populated from the cRLNumber
+	// extension when parsing a CRL.
 	Number *big.Int
+	// BaseCRLNumber, if not nil, makes the CRL a delta CRL with the critical
+	// deltaCRLIndicator extension, which identifies the number of the
+	// complete CRL the delta CRL updates. It must be lower than Number. It is
+	// also populated from the extension when parsing a CRL.
+	BaseCRLNumber *big.Int
+	// IssuingDistributionPoint, if not nil, is used to populate the critical
+	// issuingDistributionPoint extension. It is also populated from the
+	// extension when parsing a CRL.
+	IssuingDistributionPoint *IssuingDistributionPoint
+	// FreshestCRL contains the URIs of the distribution points of the delta
+	// CRLs for this complete CRL, using the freshestCRL extension. It is
+	// both used when creating a CRL and populated when parsing a CRL.
+	FreshestCRL []string
+
 	// ThisUpdate is used to populate the thisUpdate field in the CRL, which
 	// indicates the issuance date of the CRL.
 	ThisUpdate time.Time
 	// NextUpdate is used to populate the nextUpdate field in the CRL, which
 	// indicates the date by which the next CRL will be issued. NextUpdate
-	// must be greater than ThisUpdate.
+	// must be greater than ThisUpdate. When parsing a CRL without a
+	// nextUpdate field, it is the zero time.
 	NextUpdate time.Time
+
+	// Extensions contains raw X.509 extensions. When creating a CRL,
+	// the Extensions field is ignored, see ExtraExtensions.
+	Extensions []pkix.Extension
 	// ExtraExtensions contains any additional extensions to add directly to
 	// the CRL.
 	ExtraExtensions []pkix.Extension
 }
 
+// CheckSignatureFrom verifies that the signature on rl is a valid signature
+// from parent.
+func (rl *RevocationList) CheckSignatureFrom(parent *Certificate) error {
+	if parent.Version == 3 && !parent.BasicConstraintsValid ||
+		parent.BasicConstraintsValid && !parent.IsCA {
+		return ConstraintViolationError{}
+	}
+
+	if parent.KeyUsage != 0 && parent.KeyUsage&KeyUsageCRLSign == 0 {
+		return ConstraintViolationError{}
+	}
+
+	if parent.PublicKeyAlgorithm == UnknownPublicKeyAlgorithm {
+		return ErrUnsupportedAlgorithm
+	}
+
+	return parent.CheckSignature(rl.SignatureAlgorithm, rl.RawTBSRevocationList, rl.Signature)
+}
+
+// Entry returns the entry in RevokedCertificateEntries for the certificate
+// with the given serial number, and whether there is one. Note that a serial
+// number only identifies a certificate together with its issuer, which is
+// the issuer of the CRL unless it's an indirect CRL.
+func (rl *RevocationList) Entry(serial *big.Int) (RevocationListEntry, bool) {
+	for _, e := range rl.RevokedCertificateEntries {
+		if e.SerialNumber.Cmp(serial) == 0 {
+			return e, true
+		}
+	}
+	return RevocationListEntry{}, false
+}
+
 // CreateRevocationList creates a new X.509 v2 Certificate Revocation List,
 // according to RFC 5280, based on template.
 //
@@ -2124,17 +2394,43 @@ func CreateRevocationList(rand io.Reader, template *RevocationList, issuer *Cert
 	if template.Number == nil {
 		return nil, errors.New("x509: template contains nil Number field")
 	}
+	if template.BaseCRLNumber != nil && template.BaseCRLNumber.Cmp(template.Number) >= 0 {
+		return nil, errors.New("x509: template.BaseCRLNumber is not lower than template.Number")
+	}
 
 	hashFunc, signatureAlgorithm, err := signingParamsForPublicKey(priv.Public(), template.SignatureAlgorithm)
 	if err != nil {
 		return nil, err
 	}
 
-	// Force revocation times to UTC per RFC 5280.
-	revokedCertsUTC := make([]pkix.RevokedCertificate, len(template.RevokedCertificates))
-	for i, rc := range template.RevokedCertificates {
-		rc.RevocationTime = rc.RevocationTime.UTC()
-		revokedCertsUTC[i] = rc
+	var revokedCertsUTC []pkix.RevokedCertificate
+	if len(template.RevokedCertificateEntries) > 0 {
+		revokedCertsUTC = make([]pkix.RevokedCertificate, len(template.RevokedCertificateEntries))
+		for i, rce := range template.RevokedCertificateEntries {
+			if rce.SerialNumber == nil {
+				return nil, errors.New("x509: template contains entry with nil SerialNumber field")
+			}
+			if rce.RevocationTime.IsZero() {
+				return nil, errors.New("x509: template contains entry with zero RevocationTime field")
+			}
+			exts, err := marshalRevocationListEntryExtensions(&rce)
+			if err != nil {
+				return nil, err
+			}
+			// Force revocation times to UTC per RFC 5280.
+			revokedCertsUTC[i] = pkix.RevokedCertificate{
+				SerialNumber:   rce.SerialNumber,
+				RevocationTime: rce.RevocationTime.UTC(),
+				Extensions:     exts,
+			}
+		}
+	} else {
+		// Force revocation times to UTC per RFC 5280.
+		revokedCertsUTC = make([]pkix.RevokedCertificate, len(template.RevokedCertificates))
+		for i, rc := range template.RevokedCertificates {
+			rc.RevocationTime = rc.RevocationTime.UTC()
+			revokedCertsUTC[i] = rc
+		}
 	}
 
 	aki, err := asn1.Marshal(authKeyId{Id: issuer.SubjectKeyId})
@@ -2167,6 +2463,39 @@ func CreateRevocationList(rand io.Reader, template *RevocationList, issuer *Cert
 		tbsCertList.RevokedCertificates = revokedCertsUTC
 	}
 
+	if template.BaseCRLNumber != nil && !oidInExtensions(oidExtensionDeltaCRLIndicator, template.ExtraExtensions) {
+		baseNum, err := asn1.Marshal(template.BaseCRLNumber)
+		if err != nil {
+			return nil, err
+		}
+		tbsCertList.Extensions = append(tbsCertList.Extensions, pkix.Extension{
+			Id:       oidExtensionDeltaCRLIndicator,
+			Critical: true,
+			Value:    baseNum,
+		})
+	}
+	if template.IssuingDistributionPoint != nil && !oidInExtensions(oidExtensionIssuingDistributionPoint, template.ExtraExtensions) {
+		idp, err := marshalIssuingDistributionPoint(template.IssuingDistributionPoint)
+		if err != nil {
+			return nil, err
+		}
+		tbsCertList.Extensions = append(tbsCertList.Extensions, pkix.Extension{
+			Id:       oidExtensionIssuingDistributionPoint,
+			Critical: true,
+			Value:    idp,
+		})
+	}
+	if len(template.FreshestCRL) > 0 && !oidInExtensions(oidExtensionFreshestCRL, template.ExtraExtensions) {
+		freshest, err := marshalCRLDistributionPoints(template.FreshestCRL)
+		if err != nil {
+			return nil, err
+		}
+		tbsCertList.Extensions = append(tbsCertList.Extensions, pkix.Extension{
+			Id:    oidExtensionFreshestCRL,
+			Value: freshest,
+		})
+	}
+
 	if len(template.ExtraExtensions) > 0 {
 		tbsCertList.Extensions = append(tbsCertList.Extensions, template.ExtraExtensions...)
 	}
@@ -2454,6 +2454,91 @@ func TestCreateRevocationList(t *testing.T) {
 			},
 			expectedError: "x509: template contains nil Number field",
 		},
+		{
+			name: "BaseCRLNumber not lower than Number",
+			key:  ec256Priv,
+			issuer: &Certificate{
+				KeyUsage: KeyUsageCRLSign,
+				Subject: pkix.Name{
+					CommonName: "testing",
+				},
+				SubjectKeyId: []byte{1, 2, 3},
+			},
+			template: &RevocationList{
+				Number:        big.NewInt(5),
+				BaseCRLNumber: big.NewInt(5),
+				ThisUpdate:    time.Time{}.Add(time.Hour * 24),
+				NextUpdate:    time.Time{}.Add(time.Hour * 48),
+			},
+			expectedError: "x509: template.BaseCRLNumber is not lower than template.Number",
+		},
+		{
+			name: "invalid reason code",
+			key:  ec256Priv,
+			issuer: &Certificate{
+				KeyUsage: KeyUsageCRLSign,
+				Subject: pkix.Name{
+					CommonName: "testing",
+				},
+				SubjectKeyId: []byte{1, 2, 3},
+			},
+			template: &RevocationList{
+				RevokedCertificateEntries: []RevocationListEntry{
+					{
+						SerialNumber:   big.NewInt(2),
+						RevocationTime: time.Time{}.Add(time.Hour),
+						ReasonCode:     7,
+					},
+				},
+				Number:     big.NewInt(5),
+				ThisUpdate: time.Time{}.Add(time.Hour * 24),
+				NextUpdate: time.Time{}.Add(time.Hour * 48),
+			},
+			expectedError: "x509: template contains entry with invalid ReasonCode 7",
+		},
+		{
+			name: "entry without serial number",
+			key:  ec256Priv,
+			issuer: &Certificate{
+				KeyUsage: KeyUsageCRLSign,
+				Subject: pkix.Name{
+					CommonName: "testing",
+				},
+				SubjectKeyId: []byte{1, 2, 3},
+			},
+			template: &RevocationList{
+				RevokedCertificateEntries: []RevocationListEntry{
+					{
+						RevocationTime: time.Time{}.Add(time.Hour),
+					},
+				},
+				Number:     big.NewInt(5),
+				ThisUpdate: time.Time{}.Add(time.Hour * 24),
+				NextUpdate: time.Time{}.Add(time.Hour * 48),
+			},
+			expectedError: "x509: template contains entry with nil SerialNumber field",
+		},
+		{
+			name: "conflicting issuing distribution point",
+			key:  ec256Priv,
+			issuer: &Certificate{
+				KeyUsage: KeyUsageCRLSign,
+				Subject: pkix.Name{
+					CommonName: "testing",
+				},
+				SubjectKeyId: []byte{1, 2, 3},
+			},
+			template: &RevocationList{
+				IssuingDistributionPoint: &IssuingDistributionPoint{
+					OnlyContainsUserCerts: true,
+					OnlyContainsCACerts:   true,
+				},
+				Number:     big.NewInt(5),
+				ThisUpdate: time.Time{}.Add(time.Hour * 24),
+				NextUpdate: time.Time{}.Add(time.Hour * 48),
+			},
+			expectedError: "x509: IssuingDistributionPoint can only set one of the OnlyContains fields",
+		},
 		{
 			name: "invalid signature algorithm",
 			key:  ec256Priv,
@@ -2621,6 +2706,21 @@ func TestCreateRevocationList(t *testing.T) {
 					parsedCRL.TBSCertList.RevokedCertificates, tc.template.RevokedCertificates)
 			}
 
+			rl, err := ParseRevocationList(crl)
+			if err != nil {
+				t.Fatalf("ParseRevocationList failed: %s", err)
+			}
+			if !reflect.DeepEqual(rl.RevokedCertificates, tc.template.RevokedCertificates) {
+				t.Fatalf("ParseRevocationList RevokedCertificates mismatch: got %v; want %v.",
+					rl.RevokedCertificates, tc.template.RevokedCertificates)
+			}
+			if rl.Number.Cmp(tc.template.Number) != 0 {
+				t.Fatalf("Number mismatch: got %v; want %v", rl.Number, tc.template.Number)
+			}
+			if !bytes.Equal(rl.AuthorityKeyId, tc.issuer.SubjectKeyId) {
+				t.Fatalf("AuthorityKeyId mismatch: got %x; want %x", rl.AuthorityKeyId, tc.issuer.SubjectKeyId)
+			}
+
 			if len(parsedCRL.TBSCertList.Extensions) != 2+len(tc.template.ExtraExtensions) {
 				t.Fatalf("Generated CRL has wrong number of extensions, wanted: %d, got: %d", 2+len(tc.template.ExtraExtensions), len(parsedCRL.TBSCertList.Extensions))
 			}
@@ -2661,6 +2761,263 @@ func TestCreateRevocationList(t *testing.T) {
 	}
 }
 
+func TestParseRevocationList(t *testing.T) {
+	block, _ := pem.Decode(fromBase64(pemCRLBase64))
+	rl, err := ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseRevocationList failed: %s", err)
+	}
+	if rl.Issuer.CommonName != "RSA Public Root CA v1" {
+		t.Errorf("unexpected issuer: %v", rl.Issuer)
+	}
+	if rl.SignatureAlgorithm != SHA1WithRSA {
+		t.Errorf("unexpected SignatureAlgorithm: %v", rl.SignatureAlgorithm)
+	}
+	if rl.Number.Int64() != 132 {
+		t.Errorf("unexpected Number: %v", rl.Number)
+	}
+	if want := fromBase64("9UwxelEDPyzXi5eZb6hxkKt4PZs="); !bytes.Equal(rl.AuthorityKeyId, want) {
+		t.Errorf("unexpected AuthorityKeyId: %x", rl.AuthorityKeyId)
+	}
+	if want := time.Date(2011, time.August, 22, 19, 28, 30, 0, time.UTC); !rl.NextUpdate.Equal(want) {
+		t.Errorf("unexpected NextUpdate: %v", rl.NextUpdate)
+	}
+	if len(rl.RevokedCertificateEntries) != 2 || len(rl.RevokedCertificates) != 2 {
+		t.Fatalf("unexpected number of entries: %d", len(rl.RevokedCertificateEntries))
+	}
+	entry := rl.RevokedCertificateEntries[0]
+	if entry.ReasonCode != RevocationReasonPrivilegeWithdrawn {
+		t.Errorf("unexpected ReasonCode: %v", entry.ReasonCode)
+	}
+	if want := time.Date(2009, time.November, 2, 14, 24, 55, 0, time.UTC); !entry.InvalidityDate.Equal(want) {
+		t.Errorf("unexpected InvalidityDate: %v", entry.InvalidityDate)
+	}
+	if len(entry.Extensions) != 2 {
+		t.Errorf("unexpected number of entry extensions: %d", len(entry.Extensions))
+	}
+	if rl.RevokedCertificateEntries[1].ReasonCode != RevocationReasonUnspecified {
+		t.Errorf("unexpected ReasonCode: %v", rl.RevokedCertificateEntries[1].ReasonCode)
+	}
+	if _, ok := rl.Entry(entry.SerialNumber); !ok {
+		t.Errorf("Entry didn't find serial number %v", entry.SerialNumber)
+	}
+	if _, ok := rl.Entry(big.NewInt(1)); ok {
+		t.Errorf("Entry found unexpected serial number 1")
+	}
+
+	rl, err = ParseRevocationList(fromBase64(derCRLBase64))
+	if err != nil {
+		t.Fatalf("ParseRevocationList failed: %s", err)
+	}
+	if len(rl.RevokedCertificateEntries) != 88 {
+		t.Errorf("unexpected number of entries: %d", len(rl.RevokedCertificateEntries))
+	}
+
+	// A v1 CRL, without a version field.
+	v1 := fromBase64("MIHYMIGZMAkGByqGSM44BAMwEjEQMA4GA1UEAxMHQ2FybERTUxcNOTkwODI3MDcwMDAwWjBpMBMCAgDIFw05OTA4MjIwNzAwMDBaMBMCAgDJFw05OTA4MjIwNzAwMDBaMBMCAgDTFw05OTA4MjIwNzAwMDBaMBMCAgDSFw05OTA4MjIwNzAwMDBaMBMCAgDUFw05OTA4MjQwNzAwMDBaMAkGByqGSM44BAMDLwAwLAIUfmVSdjP+NHMX0feW+aDU2G1cfT0CFAJ6W7fVWxjBz4fvftok8yqDnDWh")
+	rl, err = ParseRevocationList(v1)
+	if err != nil {
+		t.Fatalf("ParseRevocationList failed on a v1 CRL: %s", err)
+	}
+	if rl.Issuer.CommonName != "CarlDSS" {
+		t.Errorf("unexpected issuer: %v", rl.Issuer)
+	}
+	if want := time.Date(1999, time.August, 27, 7, 0, 0, 0, time.UTC); !rl.ThisUpdate.Equal(want) {
+		t.Errorf("unexpected ThisUpdate: %v", rl.ThisUpdate)
+	}
+	if len(rl.RevokedCertificateEntries) != 5 {
+		t.Errorf("unexpected number of entries: %d", len(rl.RevokedCertificateEntries))
+	}
+	if rl.Number != nil || len(rl.Extensions) != 0 {
+		t.Errorf("unexpected extensions in a v1 CRL: %v", rl.Extensions)
+	}
+	if _, err := ParseRevocationList(append(block.Bytes, 0)); err == nil {
+		t.Error("ParseRevocationList accepted trailing data")
+	}
+	if _, err := ParseRevocationList(block.Bytes[:len(block.Bytes)-1]); err == nil {
+		t.Error("ParseRevocationList accepted a truncated CRL")
+	}
+}
+
+func TestRevocationListRoundTrip(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CRL Test CA"},
+		NotBefore:             time.Unix(1000, 0),
+		NotAfter:              time.Unix(100000, 0),
+		KeyUsage:              KeyUsageCertSign | KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thisUpdate := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	template := &RevocationList{
+		RevokedCertificateEntries: []RevocationListEntry{
+			{
+				SerialNumber:   big.NewInt(10),
+				RevocationTime: thisUpdate.Add(-time.Hour).In(time.FixedZone("UTC+2", 2*60*60)),
+				ReasonCode:     RevocationReasonKeyCompromise,
+				InvalidityDate: thisUpdate.Add(-48 * time.Hour),
+			},
+			{
+				SerialNumber:   big.NewInt(11),
+				RevocationTime: thisUpdate.Add(-2 * time.Hour),
+			},
+			{
+				SerialNumber:   big.NewInt(12),
+				RevocationTime: thisUpdate.Add(-3 * time.Hour),
+				ReasonCode:     RevocationReasonSuperseded,
+				ExtraExtensions: []pkix.Extension{
+					// Overrides ReasonCode.
+					{Id: oidExtensionReasonCode, Value: []byte{0x0a, 0x01, 0x05}},
+				},
+			},
+		},
+		Number:        big.NewInt(20),
+		BaseCRLNumber: big.NewInt(18),
+		IssuingDistributionPoint: &IssuingDistributionPoint{
+			DistributionPoint:   []string{"http://example.com/delta.crl"},
+			OnlyContainsCACerts: true,
+			OnlySomeReasons: []RevocationReason{RevocationReasonKeyCompromise,
+				RevocationReasonCACompromise, RevocationReasonAACompromise},
+			IndirectCRL: true,
+		},
+		FreshestCRL: []string{"http://example.com/delta.crl", "ldap://example.com/delta"},
+		ThisUpdate:  thisUpdate,
+		NextUpdate:  thisUpdate.Add(24 * time.Hour),
+	}
+	der, err := CreateRevocationList(rand.Reader, template, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl, err := ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rl.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("CheckSignatureFrom failed: %s", err)
+	}
+	if !bytes.Equal(rl.RawIssuer, ca.RawSubject) {
+		t.Errorf("RawIssuer = %x, want %x", rl.RawIssuer, ca.RawSubject)
+	}
+	if !rl.ThisUpdate.Equal(template.ThisUpdate) || !rl.NextUpdate.Equal(template.NextUpdate) {
+		t.Errorf("ThisUpdate, NextUpdate = %v, %v; want %v, %v", rl.ThisUpdate, rl.NextUpdate,
+			template.ThisUpdate, template.NextUpdate)
+	}
+	if rl.Number.Cmp(template.Number) != 0 || rl.BaseCRLNumber.Cmp(template.BaseCRLNumber) != 0 {
+		t.Errorf("Number, BaseCRLNumber = %v, %v; want %v, %v", rl.Number, rl.BaseCRLNumber,
+			template.Number, template.BaseCRLNumber)
+	}
+	if !reflect.DeepEqual(rl.IssuingDistributionPoint, template.IssuingDistributionPoint) {
+		t.Errorf("IssuingDistributionPoint = %+v, want %+v", rl.IssuingDistributionPoint, template.IssuingDistributionPoint)
+	}
+	if !reflect.DeepEqual(rl.FreshestCRL, template.FreshestCRL) {
+		t.Errorf("FreshestCRL = %v, want %v", rl.FreshestCRL, template.FreshestCRL)
+	}
+
+	wantReasons := []RevocationReason{RevocationReasonKeyCompromise, RevocationReasonUnspecified,
+		RevocationReasonCessationOfOperation}
+	for i, entry := range rl.RevokedCertificateEntries {
+		want := template.RevokedCertificateEntries[i]
+		if entry.SerialNumber.Cmp(want.SerialNumber) != 0 {
+			t.Errorf("entry %d: SerialNumber = %v, want %v", i, entry.SerialNumber, want.SerialNumber)
+		}
+		if !entry.RevocationTime.Equal(want.RevocationTime) || entry.RevocationTime.Location() != time.UTC {
+			t.Errorf("entry %d: RevocationTime = %v, want %v", i, entry.RevocationTime, want.RevocationTime.UTC())
+		}
+		if !entry.InvalidityDate.Equal(want.InvalidityDate) {
+			t.Errorf("entry %d: InvalidityDate = %v, want %v", i, entry.InvalidityDate, want.InvalidityDate)
+		}
+		if entry.ReasonCode != wantReasons[i] {
+			t.Errorf("entry %d: ReasonCode = %v, want %v", i, entry.ReasonCode, wantReasons[i])
+		}
+		if len(entry.Raw) == 0 {
+			t.Errorf("entry %d: Raw is empty", i)
+		}
+	}
+	if len(rl.RevokedCertificateEntries) != len(template.RevokedCertificateEntries) {
+		t.Errorf("got %d entries, want %d", len(rl.RevokedCertificateEntries), len(template.RevokedCertificateEntries))
+	}
+
+	rl.Signature[len(rl.Signature)-1] ^= 1
+	if err := rl.CheckSignatureFrom(ca); err == nil {
+		t.Error("CheckSignatureFrom succeeded with a modified signature")
+	}
+	leaf := &Certificate{Version: 3, BasicConstraintsValid: true, PublicKey: caKey.Public(),
+		PublicKeyAlgorithm: ECDSA}
+	if err := rl.CheckSignatureFrom(leaf); err != (ConstraintViolationError{}) {
+		t.Errorf("CheckSignatureFrom a non-CA certificate = %v, want ConstraintViolationError", err)
+	}
+}
+
+func TestRevocationListRelativeDistributionPoint(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CRL Test CA"},
+		NotBefore:             time.Unix(1000, 0),
+		NotAfter:              time.Unix(100000, 0),
+		KeyUsage:              KeyUsageCertSign | KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An issuing distribution point naming the distribution point
+	// relative to the CRL issuer, with onlyContainsUserCerts set.
+	idp := []byte{
+		0x30, 0x13, // IssuingDistributionPoint
+		0xa0, 0x0e, // distributionPoint
+		0xa1, 0x0c, // nameRelativeToCRLIssuer
+		0x30, 0x0a, 0x06, 0x03, 0x55, 0x04, 0x03, 0x0c, 0x03, 'c', 'r', 'l', // CN=crl
+		0x81, 0x01, 0xff, // onlyContainsUserCerts
+	}
+	thisUpdate := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	template := &RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: thisUpdate,
+		NextUpdate: thisUpdate.Add(24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionIssuingDistributionPoint, Critical: true, Value: idp},
+		},
+	}
+	der, err := CreateRevocationList(rand.Reader, template, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl, err := ParseRevocationList(der)
+	if err != nil {
+		t.Fatalf("ParseRevocationList: %v", err)
+	}
+	want := &IssuingDistributionPoint{OnlyContainsUserCerts: true}
+	if !reflect.DeepEqual(rl.IssuingDistributionPoint, want) {
+		t.Errorf("IssuingDistributionPoint = %+v, want %+v", rl.IssuingDistributionPoint, want)
+	}
+}
+
 func TestRSAPSAParameters(t *testing.T) {
 	generateParams := func(hashFunc crypto.Hash) []byte {
 		var hashOID asn1.ObjectIdentifier
@@ -2963,6 +3320,37 @@ func certPoolEqual(a, b *CertPool) bool {
 	return true
 }
 
+func TestCertPoolAddPool(t *testing.T) {
+	a, b := NewCertPool(), NewCertPool()
+	if !a.AppendCertsFromPEM([]byte(rsaPSSSelfSignedPEM)) {
+		t.Fatal("failed to add certificate to pool a")
+	}
+	if !b.AppendCertsFromPEM([]byte(rsaPSSSelfSignedPEM)) || !b.AppendCertsFromPEM([]byte(pemCertificate)) {
+		t.Fatal("failed to add certificates to pool b")
+	}
+
+	a.AddPool(b)
+	a.AddPool(a)
+	a.AddPool(nil)
+	if a.len() != 2 || len(a.Subjects()) != 2 {
+		t.Fatalf("combined pool has %d certificates, want 2", a.len())
+	}
+	if !a.equal(b) || !b.equal(a) {
+		t.Error("combined pool differs from the pool containing both certificates")
+	}
+	for i, c := range allCerts(t, b) {
+		if !a.contains(c) {
+			t.Errorf("combined pool is missing certificate %d", i)
+		}
+	}
+	if b.len() != 2 {
+		t.Errorf("AddPool modified its argument")
+	}
+	if a.equal(NewCertPool()) || !(*CertPool)(nil).equal(NewCertPool()) {
+		t.Error("equal mismatch for empty pools")
+	}
+}
+
 func TestCertificateRequestRoundtripFields(t *testing.T) {
 	urlA, err := url.Parse("https://example.com/_")
 	if err != nil {
@@ -70,7 +70,7 @@ import (
 var depsRules = `
 	# No dependencies allowed for any of these packages.
 	NONE
-	< container/list, container/ring,
+	< constraints, container/list, container/ring,
 	  internal/cfg, internal/cpu, internal/goarch,
 	  internal/goexperiment, internal/goos,
 	  internal/goversion, internal/nettrace,
@@ -103,9 +103,18 @@ var depsRules = `
 	< sort
 	< container/heap;
 
+	constraints, math/bits
+	< slices;
+
+	RUNTIME
+	< maps;
+
 	RUNTIME
 	< io;
 
+	RUNTIME
+	< internal/intern;
+
 	syscall !< io;
 	reflect !< sort;
 
@@ -245,8 +254,8 @@ var depsRules = `
 
 	# compression
 	FMT, encoding/binary, hash/adler32, hash/crc32
-	< compress/bzip2, compress/flate, compress/lzw
-	< archive/zip, compress/gzip, compress/zlib;
+	< compress/bzip2, compress/flate, compress/lzw, compress/zstd
+	< compress/gzip, compress/zlib;
 
 	# templates
 	FMT
@@ -346,6 +355,9 @@ var depsRules = `
 	sync
 	< internal/singleflight;
 
+	internal/bytealg, internal/intern, internal/itoa, math, math/bits, strconv
+	< net/netip;
+
 	os
 	< golang.org/x/net/dns/dnsmessage,
 	  golang.org/x/net/lif,
@@ -363,6 +375,7 @@ var depsRules = `
 	internal/poll,
 	internal/singleflight,
 	internal/race,
+	net/netip,
 	os
 	< net;
 
@@ -378,10 +391,14 @@ var depsRules = `
 
 	# logging - most packages should not import; http and up is allowed
 	FMT
+	< log/internal
 	< log;
 
 	log !< crypto/tls, database/sql, go/importer, testing;
 
+	context, encoding/json, log
+	< log/slog;
+
 	FMT, log, net
 	< log/syslog;
 
@@ -404,6 +421,10 @@ var depsRules = `
 
 	CGO, fmt, net !< CRYPTO;
 
+	# archive/zip decrypts WinZip AES encrypted files.
+	CRYPTO, FMT, compress/flate, compress/zstd
+	< archive/zip;
+
 	# CRYPTO-MATH is core bignum-based crypto - no cgo, net; fmt now ok.
 	CRYPTO, FMT, math/big
 	< crypto/rand
@@ -414,7 +435,7 @@ var depsRules = `
 	< golang.org/x/crypto/cryptobyte
 	< golang.org/x/crypto/curve25519
 	< crypto/dsa, crypto/elliptic, crypto/rsa
-	< crypto/ecdsa
+	< crypto/ecdh, crypto/ecdsa
 	< CRYPTO-MATH;
 
 	CGO, net !< CRYPTO-MATH;
@@ -426,6 +447,7 @@ var depsRules = `
 	< golang.org/x/crypto/poly1305
 	< golang.org/x/crypto/chacha20poly1305
 	< golang.org/x/crypto/hkdf
+	< crypto/hpke
 	< crypto/x509/internal/macos
 	< crypto/x509/pkix
 	< crypto/x509
@@ -439,12 +461,18 @@ var depsRules = `
 	crypto/tls
 	< net/smtp;
 
+	crypto/tls
+	< net/http/internal/quic;
+
 	# HTTP, King of Dependencies.
 
 	FMT
 	< golang.org/x/net/http2/hpack
 	< net/http/internal, net/http/internal/ascii, net/http/internal/testcert;
 
+	golang.org/x/net/http2/hpack
+	< net/http/internal/qpack;
+
 	FMT, NET, container/list, encoding/binary, log
 	< golang.org/x/text/transform
 	< golang.org/x/text/unicode/norm
@@ -462,6 +490,8 @@ var depsRules = `
 	golang.org/x/net/http2/hpack,
 	net/http/internal,
 	net/http/internal/ascii,
+	net/http/internal/qpack,
+	net/http/internal/quic,
 	net/http/internal/testcert,
 	net/http/httptrace,
 	mime/multipart,
@@ -493,6 +523,10 @@ var depsRules = `
 	html, internal/profile, net/http, runtime/pprof, runtime/trace
 	< net/http/pprof;
 
+	# Coverage of programs built with 'go build -cover'
+	OS, hash/fnv
+	< internal/coverage;
+
 	# RPC
 	encoding/gob, encoding/json, go/token, html/template, net/http
 	< net/rpc
@@ -513,7 +547,11 @@ var depsRules = `
 	FMT, flag, runtime/debug, runtime/trace, internal/sysinfo, math/rand
 	< testing;
 
-	internal/testlog, runtime/pprof, regexp
+	FMT, context, crypto/sha256, encoding/binary, encoding/json,
+	go/ast, go/parser, go/token, internal/unsafeheader, math/rand, os/exec
+	< internal/fuzz;
+
+	internal/fuzz, internal/testlog, os/signal, runtime/pprof, regexp
 	< testing/internal/testdeps;
 
 	OS, flag, testing, internal/cfg
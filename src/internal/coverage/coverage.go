@@ -0,0 +1,312 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package coverage holds the runtime support for programs built with
+// 'go build -cover', and the format of the coverage data files they write.
+//
+// Each package instrumented by the go command registers the counters of
+// its source files with RegisterFile as it is initialized. When the program
+// exits, either by returning from main.main or by calling os.Exit, the
+// counters are written to two files in the directory named by the
+// GOCOVERDIR environment variable:
+//
+//	covmeta.<hash>                     the blocks of the program
+//	covcounters.<hash>.<pid>.<time>    the values of the counters in one run
+//
+// The hash identifies the contents of the meta-data file, so that all the
+// runs of a binary share a single meta-data file and add a counter data
+// file each.
+//
+// Both are text files. A meta-data file starts with the line
+// "go coverage meta v1" and the "mode: " line of a coverage profile,
+// and is followed by a line for each block, in the form of a line of a
+// coverage profile without its count:
+//
+//	name.go:line.column,line.column numberOfStatements
+//
+// A counter data file starts with the line "go coverage counters v1",
+// and is followed by a line holding the count of each block in the
+// meta-data file, in order.
+//
+// 'go tool covdata' reads these files.
+package coverage
+
+import (
+	"bufio"
+	"errors"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Block is a block of statements in a source file, as instrumented
+// by cmd/cover.
+type Block struct {
+	File  string // file name, as in a coverage profile
+	Line0 uint32 // line number for block start
+	Col0  uint16 // column number for block start
+	Line1 uint32 // line number for block end
+	Col1  uint16 // column number for block end
+	Stmts uint16 // number of statements included in this block
+}
+
+// Data is the coverage data of a program.
+type Data struct {
+	Mode   string   // "set", "count" or "atomic"
+	Blocks []Block  // blocks of the program
+	Counts []uint32 // Counts[i] is the counter of Blocks[i]
+}
+
+const (
+	metaHeader     = "go coverage meta v1"
+	countersHeader = "go coverage counters v1"
+
+	metaPrefix     = "covmeta."
+	countersPrefix = "covcounters."
+)
+
+// meta returns the contents of the meta-data file for d.
+func (d *Data) meta() []byte {
+	buf := make([]byte, 0, 64*len(d.Blocks))
+	buf = append(buf, metaHeader+"\nmode: "...)
+	buf = append(buf, d.Mode...)
+	buf = append(buf, '\n')
+	for _, b := range d.Blocks {
+		buf = append(buf, b.File...)
+		buf = append(buf, ':')
+		buf = strconv.AppendUint(buf, uint64(b.Line0), 10)
+		buf = append(buf, '.')
+		buf = strconv.AppendUint(buf, uint64(b.Col0), 10)
+		buf = append(buf, ',')
+		buf = strconv.AppendUint(buf, uint64(b.Line1), 10)
+		buf = append(buf, '.')
+		buf = strconv.AppendUint(buf, uint64(b.Col1), 10)
+		buf = append(buf, ' ')
+		buf = strconv.AppendUint(buf, uint64(b.Stmts), 10)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// counters returns the contents of the counter data file for d.
+func (d *Data) counters() []byte {
+	buf := make([]byte, 0, 4*len(d.Counts))
+	buf = append(buf, countersHeader+"\n"...)
+	for _, c := range d.Counts {
+		buf = strconv.AppendUint(buf, uint64(c), 10)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// WriteDir writes d to the directory dir as the data of a run of a program:
+// it adds a counter data file, and the meta-data file for d if dir doesn't
+// have it already.
+func WriteDir(dir string, d *Data) error {
+	if len(d.Blocks) != len(d.Counts) {
+		return errors.New("coverage: mismatched blocks and counters")
+	}
+	meta := d.meta()
+	h := fnv.New128a()
+	h.Write(meta)
+	hash := hexString(h.Sum(nil))
+
+	metaFile := filepath.Join(dir, metaPrefix+hash)
+	if _, err := os.Stat(metaFile); err != nil {
+		if err := writeFile(dir, metaFile, meta); err != nil {
+			return err
+		}
+	}
+	name := countersPrefix + hash + "." + strconv.Itoa(os.Getpid()) + "." + strconv.FormatInt(time.Now().UnixNano(), 10)
+	return writeFile(dir, filepath.Join(dir, name), d.counters())
+}
+
+// writeFile writes data to the named file in dir. The file is written
+// under a temporary name and renamed, so that readers never see it
+// partially written.
+func writeFile(dir, name string, data []byte) error {
+	f, err := os.CreateTemp(dir, "covtmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func hexString(b []byte) string {
+	const digits = "0123456789abcdef"
+	s := make([]byte, 2*len(b))
+	for i, c := range b {
+		s[2*i] = digits[c>>4]
+		s[2*i+1] = digits[c&0xf]
+	}
+	return string(s)
+}
+
+// ReadDir reads the coverage data files in dir and returns the data
+// of each run they record. Files other than coverage data files are
+// ignored.
+func ReadDir(dir string) ([]*Data, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	metas := make(map[string]*Data)
+	var runs []*Data
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, countersPrefix) {
+			continue
+		}
+		hash := name[len(countersPrefix):]
+		if i := strings.Index(hash, "."); i >= 0 {
+			hash = hash[:i]
+		}
+		meta := metas[hash]
+		if meta == nil {
+			meta, err = readMeta(filepath.Join(dir, metaPrefix+hash))
+			if err != nil {
+				return nil, err
+			}
+			metas[hash] = meta
+		}
+		counts, err := readCounters(filepath.Join(dir, name), len(meta.Blocks))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, &Data{Mode: meta.Mode, Blocks: meta.Blocks, Counts: counts})
+	}
+	return runs, nil
+}
+
+// readLines reads the named file, checks that its first line is header,
+// and calls f for each later line with its line number.
+func readLines(name, header string, f func(line string, lineno int) error) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	s := bufio.NewScanner(file)
+	s.Buffer(nil, 1<<20)
+	if !s.Scan() || s.Text() != header {
+		if err := s.Err(); err != nil {
+			return err
+		}
+		return errors.New(name + ": not a coverage data file")
+	}
+	for lineno := 2; s.Scan(); lineno++ {
+		if err := f(s.Text(), lineno); err != nil {
+			return errors.New(name + ":" + strconv.Itoa(lineno) + ": " + err.Error())
+		}
+	}
+	return s.Err()
+}
+
+// readMeta reads the meta-data file name.
+func readMeta(name string) (*Data, error) {
+	d := new(Data)
+	err := readLines(name, metaHeader, func(line string, lineno int) error {
+		if lineno == 2 {
+			if !strings.HasPrefix(line, "mode: ") {
+				return errors.New("missing mode line")
+			}
+			d.Mode = line[len("mode: "):]
+			return nil
+		}
+		b, err := parseBlock(line)
+		if err != nil {
+			return err
+		}
+		d.Blocks = append(d.Blocks, b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.Mode == "" {
+		return nil, errors.New(name + ": missing mode line")
+	}
+	return d, nil
+}
+
+var errMalformedBlock = errors.New("malformed block")
+
+// parseBlock parses a block line of a meta-data file,
+// "name.go:line.column,line.column numberOfStatements".
+func parseBlock(line string) (Block, error) {
+	sp := strings.LastIndex(line, " ")
+	colon := strings.LastIndex(line, ":")
+	if sp < 0 || colon < 0 || colon > sp {
+		return Block{}, errMalformedBlock
+	}
+	start, end, ok := cut(line[colon+1:sp], ",")
+	line0, col0, ok0 := cut(start, ".")
+	line1, col1, ok1 := cut(end, ".")
+	if !ok || !ok0 || !ok1 {
+		return Block{}, errMalformedBlock
+	}
+	var err error
+	b := Block{
+		File:  line[:colon],
+		Line0: uint32(parseUint(line0, 32, &err)),
+		Col0:  uint16(parseUint(col0, 16, &err)),
+		Line1: uint32(parseUint(line1, 32, &err)),
+		Col1:  uint16(parseUint(col1, 16, &err)),
+		Stmts: uint16(parseUint(line[sp+1:], 16, &err)),
+	}
+	if err != nil {
+		return Block{}, errMalformedBlock
+	}
+	return b, nil
+}
+
+// parseUint parses s as an unsigned integer of the given bit size.
+// If s is invalid, parseUint sets *err.
+func parseUint(s string, bitSize int, err *error) uint64 {
+	n, e := strconv.ParseUint(s, 10, bitSize)
+	if e != nil {
+		*err = e
+	}
+	return n
+}
+
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// readCounters reads the counter data file name, which must hold n counters.
+func readCounters(name string, n int) ([]uint32, error) {
+	counts := make([]uint32, 0, n)
+	err := readLines(name, countersHeader, func(line string, lineno int) error {
+		c, err := strconv.ParseUint(line, 10, 32)
+		if err != nil {
+			return errors.New("malformed counter")
+		}
+		counts = append(counts, uint32(c))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(counts) != n {
+		return nil, errors.New(name + ": has " + strconv.Itoa(len(counts)) + " counters, want " + strconv.Itoa(n))
+	}
+	return counts, nil
+}
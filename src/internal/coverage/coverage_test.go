@@ -0,0 +1,103 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coverage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testData = &Data{
+	Mode: "count",
+	Blocks: []Block{
+		{File: "example.com/m/a.go", Line0: 3, Col0: 14, Line1: 5, Col1: 2, Stmts: 1},
+		{File: "example.com/m/a.go", Line0: 5, Col0: 2, Line1: 7, Col1: 3, Stmts: 2},
+		{File: `C:\work\b.go`, Line0: 10, Col0: 1, Line1: 10, Col1: 40, Stmts: 1},
+	},
+	Counts: []uint32{1, 0, 42},
+}
+
+func TestReadWriteDir(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		if err := WriteDir(dir, testData); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both runs share a meta-data file.
+	metas, _ := filepath.Glob(filepath.Join(dir, metaPrefix+"*"))
+	counters, _ := filepath.Glob(filepath.Join(dir, countersPrefix+"*"))
+	if len(metas) != 1 || len(counters) != 2 {
+		t.Fatalf("got %d meta-data and %d counter data files, want 1 and 2", len(metas), len(counters))
+	}
+
+	runs, err := ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("ReadDir returned %d runs, want 2", len(runs))
+	}
+	for _, d := range runs {
+		if !reflect.DeepEqual(d, testData) {
+			t.Errorf("ReadDir returned\n%+v\nwant\n%+v", d, testData)
+		}
+	}
+}
+
+func TestReadDirErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		meta    string
+		counter string
+		err     string
+	}{
+		{"bad header", "mode: set\na.go:1.1,2.2 1\n", countersHeader + "\n1\n", "not a coverage data file"},
+		{"no mode", metaHeader + "\n", countersHeader + "\n", "missing mode line"},
+		{"bad block", metaHeader + "\nmode: set\na.go:1.1-2.2 1\n", countersHeader + "\n1\n", ":3: malformed block"},
+		{"bad column", metaHeader + "\nmode: set\na.go:1.70000,2.2 1\n", countersHeader + "\n1\n", ":3: malformed block"},
+		{"bad counter", metaHeader + "\nmode: set\na.go:1.1,2.2 1\n", countersHeader + "\nx\n", ":2: malformed counter"},
+		{"short", metaHeader + "\nmode: set\na.go:1.1,2.2 1\n", countersHeader + "\n", "has 0 counters, want 1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, metaPrefix+"1234"), []byte(tt.meta), 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, countersPrefix+"1234.1.1"), []byte(tt.counter), 0666); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadDir(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ReadDir: got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	saved := registered
+	defer func() { registered = saved }()
+	registered.mode = "set"
+	registered.files = []coverFile{{
+		name:     "example.com/m/a.go",
+		counter:  []uint32{1, 0},
+		pos:      []uint32{3, 5, 14 | 2<<16, 5, 7, 2 | 3<<16},
+		numStmts: []uint16{1, 2},
+	}}
+
+	want := &Data{
+		Mode:   "set",
+		Blocks: testData.Blocks[:2],
+		Counts: []uint32{1, 0},
+	}
+	if d := snapshot(); !reflect.DeepEqual(d, want) {
+		t.Errorf("snapshot() = %+v, want %+v", d, want)
+	}
+}
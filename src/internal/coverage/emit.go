@@ -0,0 +1,81 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coverage
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// Implemented in the runtime.
+func runtime_addExitHook(f func(), runOnNonZeroExit bool)
+
+// A coverFile is a source file registered with RegisterFile.
+type coverFile struct {
+	name     string
+	counter  []uint32
+	pos      []uint32
+	numStmts []uint16
+}
+
+// registered holds the files of the instrumented packages of the program.
+// It is only written during package initialization.
+var registered struct {
+	mode  string
+	files []coverFile
+}
+
+// RegisterFile records the counters of a source file instrumented by
+// cmd/cover in the given mode, to be written to GOCOVERDIR when the
+// program exits. The go command calls it from the initialization of each
+// package built with 'go build -cover'. counter, pos and numStmts are the
+// Count, Pos and NumStmt fields of the variable cmd/cover declared for the
+// file.
+func RegisterFile(mode, fileName string, counter, pos []uint32, numStmts []uint16) {
+	if 3*len(counter) != len(pos) || len(counter) != len(numStmts) {
+		panic("coverage: mismatched sizes")
+	}
+	if registered.mode == "" {
+		registered.mode = mode
+		// Write the counters even if the program fails:
+		// the coverage of failing runs counts too.
+		runtime_addExitHook(emit, true)
+	} else if registered.mode != mode {
+		panic("coverage: inconsistent modes " + registered.mode + " and " + mode)
+	}
+	registered.files = append(registered.files, coverFile{fileName, counter, pos, numStmts})
+}
+
+// snapshot returns the current values of the registered counters.
+func snapshot() *Data {
+	d := &Data{Mode: registered.mode}
+	for _, f := range registered.files {
+		for i := range f.counter {
+			d.Blocks = append(d.Blocks, Block{
+				File:  f.name,
+				Line0: f.pos[3*i+0],
+				Col0:  uint16(f.pos[3*i+2]),
+				Line1: f.pos[3*i+1],
+				Col1:  uint16(f.pos[3*i+2] >> 16),
+				Stmts: f.numStmts[i],
+			})
+			// The program may still be running other goroutines.
+			d.Counts = append(d.Counts, atomic.LoadUint32(&f.counter[i]))
+		}
+	}
+	return d
+}
+
+// emit writes the registered counters to GOCOVERDIR.
+func emit() {
+	dir := os.Getenv("GOCOVERDIR")
+	if dir == "" {
+		os.Stderr.WriteString("warning: GOCOVERDIR not set, no coverage data emitted\n")
+		return
+	}
+	if err := WriteDir(dir, snapshot()); err != nil {
+		os.Stderr.WriteString("error: coverage data emit failed: " + err.Error() + "\n")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestUnmarshalMarshal(t *testing.T) {
+	var tests = []struct {
+		in string
+		ok bool
+	}{
+		{
+			in: "int(1234)",
+			ok: false, // missing version
+		},
+		{
+			in: `go test fuzz v1
+string("a"bcad")`,
+			ok: false, // malformed
+		},
+		{
+			in: `go test fuzz v1
+int()`,
+			ok: false, // empty value
+		},
+		{
+			in: `go test fuzz v1
+uint(-32)`,
+			ok: false, // invalid negative uint
+		},
+		{
+			in: `go test fuzz v1
+int8(1234456)`,
+			ok: false, // int8 too large
+		},
+		{
+			in: `go test fuzz v1
+int(20*5)`,
+			ok: false, // expression in int value
+		},
+		{
+			in: `go test fuzz v1
+int(--5)`,
+			ok: false, // expression in int value
+		},
+		{
+			in: `go test fuzz v1
+bool(0)`,
+			ok: false, // malformed bool
+		},
+		{
+			in: `go test fuzz v1
+byte('aa)`,
+			ok: false, // malformed byte
+		},
+		{
+			in: `go test fuzz v1
+byte('☃')`,
+			ok: false, // byte out of range
+		},
+		{
+			in: `go test fuzz v1
+string("extra")
+[]byte("spacing")  
+    `,
+			ok: true,
+		},
+		{
+			in: `go test fuzz v1
+float64(0)
+float32(0)`,
+			ok: true, // will be an integer literal since there is no decimal
+		},
+		{
+			in: `go test fuzz v1
+int(-23)
+int8(-2)
+int64(2342425)
+uint(1)
+uint16(234)
+uint32(352342)
+uint64(123)
+rune('œ')
+byte('K')
+byte('ÿ')
+[]byte("hello¿")
+[]byte("a")
+bool(true)
+string("hello\\xbd\\xb2=\\xbc ⌘")
+float64(-12.5)
+float32(2.5)`,
+			ok: true,
+		},
+		{
+			in: `go test fuzz v1
+float32(-0)
+float64(-0)
+float32(+Inf)
+float32(-Inf)
+float32(NaN)
+float64(+Inf)
+float64(-Inf)
+float64(NaN)
+math.Float64frombits(0x7ff8000000000002)
+math.Float32frombits(0x7fc00001)`,
+			ok: false, // non-finite values must be written as math.Float*frombits
+		},
+		{
+			in: `go test fuzz v1
+math.Float64frombits(0x3ff0000000000000)
+math.Float32frombits(0x3f800000)`,
+			ok: true,
+		},
+		{
+			in: `go test fuzz v1
+int32(-1)
+int32(0)
+int32(1)`,
+			ok: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			vals, err := unmarshalCorpusFile([]byte(test.in))
+			if test.ok && err != nil {
+				t.Fatalf("unmarshal unexpected error: %v", err)
+			} else if !test.ok && err == nil {
+				t.Fatalf("unmarshal unexpected success")
+			}
+			if !test.ok {
+				return // skip the rest of the test
+			}
+			b := marshalCorpusFile(vals...)
+			if b[len(b)-1] != '\n' {
+				t.Error("didn't write final newline to corpus file")
+			}
+			got, err := unmarshalCorpusFile(b)
+			if err != nil {
+				t.Fatalf("unmarshal of marshaled values failed: %v\n%s", err, b)
+			}
+			if !reflect.DeepEqual(got, vals) {
+				t.Errorf("values were not the same after a roundtrip\ngot:\n%v\nwant:\n%v", got, vals)
+			}
+		})
+	}
+}
+
+// TestFloatRoundTrip checks that floating point values, including values
+// that have no literal representation, are encoded and decoded exactly.
+func TestFloatRoundTrip(t *testing.T) {
+	for _, f := range []float64{
+		0,
+		math.Copysign(0, -1),
+		-12.5,
+		math.MaxFloat64,
+		math.SmallestNonzeroFloat64,
+		math.Inf(1),
+		math.Inf(-1),
+		math.NaN(),
+		math.Float64frombits(0x7ff8000000000002),
+	} {
+		t.Run(strconv.FormatFloat(f, 'g', -1, 64), func(t *testing.T) {
+			b := marshalCorpusFile(f, float32(f))
+			vals, err := unmarshalCorpusFile(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := vals[0].(float64); math.Float64bits(got) != math.Float64bits(f) {
+				t.Errorf("float64: got %v (%#x); want %v (%#x)", got, math.Float64bits(got), f, math.Float64bits(f))
+			}
+			if got, want := vals[1].(float32), float32(f); math.Float32bits(got) != math.Float32bits(want) {
+				t.Errorf("float32: got %v (%#x); want %v (%#x)", got, math.Float32bits(got), want, math.Float32bits(want))
+			}
+		})
+	}
+}
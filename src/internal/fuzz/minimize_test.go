@@ -0,0 +1,72 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMinimizeBytes(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input []byte
+		fails func([]byte) bool
+		want  []byte
+	}{
+		{
+			name:  "single_byte",
+			input: bytes.Repeat([]byte{0}, 50),
+			fails: func(b []byte) bool { return len(b) > 0 },
+			want:  []byte{'0'},
+		},
+		{
+			name:  "ones",
+			input: []byte("001010001000000000000000000"),
+			fails: func(b []byte) bool { return bytes.Count(b, []byte{'1'}) >= 3 },
+			want:  []byte("111"),
+		},
+		{
+			name:  "subset",
+			input: []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ"),
+			fails: func(b []byte) bool { return bytes.Contains(b, []byte("XYZ")) },
+			want:  []byte("XYZ"),
+		},
+		{
+			name:  "long",
+			input: bytes.Repeat([]byte("x"), 10000),
+			fails: func(b []byte) bool { return len(b) >= 100 },
+			want:  bytes.Repeat([]byte("0"), 100),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := append([]byte(nil), tc.input...)
+			try := func(candidate []byte) bool {
+				if !tc.fails(candidate) {
+					return false
+				}
+				got = append(got[:0], candidate...)
+				return true
+			}
+			minimizeBytes(append([]byte(nil), tc.input...), try, func() bool { return false })
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMinimizeBytesStop(t *testing.T) {
+	calls := 0
+	try := func([]byte) bool {
+		calls++
+		return true
+	}
+	shouldStop := func() bool { return calls >= 3 }
+	minimizeBytes(bytes.Repeat([]byte{0}, 5000), try, shouldStop)
+	if calls != 3 {
+		t.Errorf("try called %d times after shouldStop reported true; want 3", calls)
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// maxValueLen is the largest size, in bytes, that a single []byte or string
+// value may grow to during mutation.
+const maxValueLen = 1 << 20
+
+type mutator struct {
+	r       *rand.Rand
+	scratch []byte // scratch slice to avoid additional allocations
+}
+
+func newMutator() *mutator {
+	return &mutator{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (m *mutator) rand(n int) int {
+	return m.r.Intn(n)
+}
+
+func (m *mutator) randByteOrder() binary.ByteOrder {
+	if m.r.Intn(2) == 0 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// chooseLen chooses length of range mutation in range [1,n]. It gives
+// preference to shorter ranges.
+func (m *mutator) chooseLen(n int) int {
+	switch x := m.rand(100); {
+	case x < 90:
+		return m.rand(min(8, n)) + 1
+	case x < 99:
+		return m.rand(min(32, n)) + 1
+	default:
+		return m.rand(n) + 1
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// mutate performs several mutations on the provided values, in place.
+// Byte slices and strings are not allowed to grow beyond maxBytes.
+func (m *mutator) mutate(vals []interface{}, maxBytes int) {
+	// Stack a few mutations on top of each other; a single mutation
+	// rarely moves far enough from its parent to be interesting.
+	for n := m.rand(4) + 1; n > 0; n-- {
+		// Pick a random value to mutate.
+		i := m.rand(len(vals))
+		vals[i] = m.mutateValue(vals[i], maxBytes)
+	}
+}
+
+func (m *mutator) mutateValue(v interface{}, maxBytes int) interface{} {
+	switch v := v.(type) {
+	case int:
+		return int(m.mutateInt(int64(v), maxInt))
+	case int8:
+		return int8(m.mutateInt(int64(v), math.MaxInt8))
+	case int16:
+		return int16(m.mutateInt(int64(v), math.MaxInt16))
+	case int32:
+		return int32(m.mutateInt(int64(v), math.MaxInt32))
+	case int64:
+		return m.mutateInt(v, math.MaxInt64)
+	case uint:
+		return uint(m.mutateUInt(uint64(v), maxUint))
+	case uint8:
+		return uint8(m.mutateUInt(uint64(v), math.MaxUint8))
+	case uint16:
+		return uint16(m.mutateUInt(uint64(v), math.MaxUint16))
+	case uint32:
+		return uint32(m.mutateUInt(uint64(v), math.MaxUint32))
+	case uint64:
+		return m.mutateUInt(v, math.MaxUint64)
+	case float32:
+		return float32(m.mutateFloat(float64(v), math.MaxFloat32))
+	case float64:
+		return m.mutateFloat(v, math.MaxFloat64)
+	case bool:
+		return !v
+	case string:
+		if len(v) > maxBytes {
+			panic(fmt.Sprintf("cannot mutate bytes of length %d", len(v)))
+		}
+		if cap(m.scratch) < maxBytes {
+			m.scratch = make([]byte, 0, maxBytes)
+		}
+		m.scratch = append(m.scratch[:0], v...)
+		m.mutateBytes(&m.scratch)
+		return string(m.scratch)
+	case []byte:
+		if len(v) > maxBytes {
+			panic(fmt.Sprintf("cannot mutate bytes of length %d", len(v)))
+		}
+		// Copy into a fresh slice with some room to grow, so that the
+		// caller's copy is left untouched.
+		b := make([]byte, len(v), min(2*len(v)+64, maxBytes))
+		copy(b, v)
+		m.mutateBytes(&b)
+		return b
+	default:
+		panic(fmt.Sprintf("type not supported for mutating: %T", v))
+	}
+}
+
+const (
+	maxUint = uint64(^uint(0))
+	maxInt  = int64(maxUint >> 1)
+)
+
+func (m *mutator) mutateInt(v, maxValue int64) int64 {
+	var max int64
+	for {
+		max = 100
+		switch m.rand(3) {
+		case 0:
+			// Add a random number
+			if v >= maxValue {
+				continue
+			}
+			if v > 0 && maxValue-v < max {
+				// Don't let v exceed maxValue
+				max = maxValue - v
+			}
+			v += int64(1 + m.rand(int(max)))
+			return v
+		case 1:
+			// Subtract a random number
+			if v <= -maxValue {
+				continue
+			}
+			if v < 0 && maxValue+v < max {
+				// Don't let v drop below -maxValue
+				max = maxValue + v
+			}
+			v -= int64(1 + m.rand(int(max)))
+			return v
+		case 2:
+			// Flip a random bit, keeping the value in range.
+			nv := v ^ int64(1)<<uint(m.rand(bitsFor(maxValue)))
+			if nv > maxValue || nv < -maxValue {
+				continue
+			}
+			return nv
+		}
+	}
+}
+
+func (m *mutator) mutateUInt(v, maxValue uint64) uint64 {
+	var max uint64
+	for {
+		max = 100
+		switch m.rand(3) {
+		case 0:
+			// Add a random number
+			if v >= maxValue {
+				continue
+			}
+			if v > 0 && maxValue-v < max {
+				// Don't let v exceed maxValue
+				max = maxValue - v
+			}
+			v += uint64(1 + m.rand(int(max)))
+			return v
+		case 1:
+			// Subtract a random number
+			if v <= 0 {
+				continue
+			}
+			if v < max {
+				// Don't let v drop below 0
+				max = v
+			}
+			v -= uint64(1 + m.rand(int(max)))
+			return v
+		case 2:
+			// Flip a random bit, keeping the value in range.
+			nv := v ^ uint64(1)<<uint(m.rand(bitsFor(int64(maxValue>>1))+1))
+			if nv > maxValue {
+				continue
+			}
+			return nv
+		}
+	}
+}
+
+// bitsFor returns the number of bits needed to represent max.
+func bitsFor(max int64) int {
+	n := 0
+	for max > 0 {
+		n++
+		max >>= 1
+	}
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+func (m *mutator) mutateFloat(v, maxValue float64) float64 {
+	var max float64
+	for {
+		switch m.rand(4) {
+		case 0:
+			// Add a random number
+			if v >= maxValue {
+				continue
+			}
+			max = 100
+			if v > 0 && maxValue-v < max {
+				// Don't let v exceed maxValue
+				max = maxValue - v
+			}
+			if max < 1 {
+				continue
+			}
+			v += float64(1 + m.rand(int(max)))
+			return v
+		case 1:
+			// Subtract a random number
+			if v <= -maxValue {
+				continue
+			}
+			max = 100
+			if v < 0 && maxValue+v < max {
+				// Don't let v drop below -maxValue
+				max = maxValue + v
+			}
+			if max < 1 {
+				continue
+			}
+			v -= float64(1 + m.rand(int(max)))
+			return v
+		case 2:
+			// Multiply by a random number
+			absV := math.Abs(v)
+			if v == 0 || absV >= maxValue {
+				continue
+			}
+			max = 10
+			if maxValue/absV < max {
+				// Don't let v go beyond the minimum or maximum value
+				max = maxValue / absV
+			}
+			v *= float64(1 + m.rand(int(max)))
+			return v
+		case 3:
+			// Divide by a random number
+			if v == 0 {
+				continue
+			}
+			v /= float64(1 + m.rand(10))
+			return v
+		}
+	}
+}
+
+type byteSliceMutator func(*mutator, []byte) []byte
+
+var byteSliceMutators = []byteSliceMutator{
+	byteSliceRemoveBytes,
+	byteSliceInsertRandomBytes,
+	byteSliceDuplicateBytes,
+	byteSliceOverwriteBytes,
+	byteSliceBitFlip,
+	byteSliceXORByte,
+	byteSliceSwapByte,
+	byteSliceArithmeticUint8,
+	byteSliceArithmeticUint16,
+	byteSliceArithmeticUint32,
+	byteSliceArithmeticUint64,
+	byteSliceOverwriteInterestingUint8,
+	byteSliceOverwriteInterestingUint16,
+	byteSliceOverwriteInterestingUint32,
+	byteSliceInsertConstantBytes,
+	byteSliceOverwriteConstantBytes,
+	byteSliceShuffleBytes,
+	byteSliceSwapBytes,
+}
+
+// mutateBytes applies a single randomly chosen mutation to *ptrB.
+// The mutators never grow the slice beyond its capacity, so the
+// underlying array is reused.
+func (m *mutator) mutateBytes(ptrB *[]byte) {
+	b := *ptrB
+	for {
+		mut := byteSliceMutators[m.rand(len(byteSliceMutators))]
+		if mutated := mut(m, b); mutated != nil {
+			*ptrB = mutated
+			return
+		}
+	}
+}
+
+var (
+	interesting8  = []int8{-128, -1, 0, 1, 16, 32, 64, 100, 127}
+	interesting16 = []int16{-32768, -129, 128, 255, 256, 512, 1000, 1024, 4096, 32767}
+	interesting32 = []int32{-2147483648, -100663046, -32769, 32768, 65535, 65536, 100663045, 2147483647}
+)
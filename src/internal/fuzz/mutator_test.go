@@ -0,0 +1,90 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func BenchmarkMutatorBytes(b *testing.B) {
+	for _, size := range []int{1, 10, 100, 1000, 10000, 100000} {
+		size := size
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			buf := make([]byte, size)
+			m := newMutator()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				// Reset the buffer to its original length.
+				buf = buf[0:size]
+				m.mutate([]interface{}{buf}, workerSharedMemSize)
+			}
+		})
+	}
+}
+
+func TestMutateValueTypes(t *testing.T) {
+	m := newMutator()
+	for _, v := range []interface{}{
+		int(-1), int8(-1), int16(-1), int32(-1), int64(-1),
+		uint(1), uint8(1), uint16(1), uint32(1), uint64(1),
+		float32(1.5), float64(-1.5), true,
+		"hello", []byte("hello"),
+	} {
+		t.Run(fmt.Sprintf("%T", v), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := m.mutateValue(v, maxValueLen)
+				if reflect.TypeOf(got) != reflect.TypeOf(v) {
+					t.Fatalf("mutating %T produced %T", v, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMutateBytesDoesNotModifyInput(t *testing.T) {
+	m := newMutator()
+	orig := []byte("the quick brown fox jumps over the lazy dog")
+	in := append([]byte(nil), orig...)
+	for i := 0; i < 1000; i++ {
+		vals := []interface{}{in}
+		m.mutate(vals, maxValueLen)
+		if !bytes.Equal(in, orig) {
+			t.Fatalf("mutate modified its input: got %q; want %q", in, orig)
+		}
+	}
+}
+
+func TestMutateBytesLimit(t *testing.T) {
+	m := newMutator()
+	const limit = 64
+	vals := []interface{}{make([]byte, limit/2)}
+	for i := 0; i < 10000; i++ {
+		m.mutate(vals, limit)
+		if n := len(vals[0].([]byte)); n > limit {
+			t.Fatalf("mutated value has length %d, larger than the limit %d", n, limit)
+		}
+	}
+}
+
+func TestByteSliceMutators(t *testing.T) {
+	for _, mut := range byteSliceMutators {
+		m := newMutator()
+		for i := 0; i < 1000; i++ {
+			b := make([]byte, m.rand(64), 128)
+			for j := range b {
+				b[j] = byte(m.rand(256))
+			}
+			n := len(b)
+			if got := mut(m, b); got != nil && cap(got) != cap(b) {
+				t.Fatalf("%s: mutated slice of length %d was reallocated", reflect.ValueOf(mut).String(), n)
+			}
+		}
+	}
+}
@@ -0,0 +1,893 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	// workerFuzzDuration is the amount of time a worker can spend testing random
+	// variations of an input given by the coordinator.
+	workerFuzzDuration = 100 * time.Millisecond
+
+	// workerTimeoutDuration is the amount of time a worker can go without
+	// responding to the coordinator before being stopped.
+	workerTimeoutDuration = 10 * time.Second
+
+	// workerExitCode is used as an exit code by fuzz worker processes after an
+	// internal error. This distinguishes internal errors from uncontrolled panics
+	// and other crashes. Keep in sync with testing.fuzzWorkerExitCode.
+	workerExitCode = 70
+
+	// workerSharedMemSize is the maximum size of the shared memory file used to
+	// communicate with workers. This limits the size of fuzz inputs.
+	workerSharedMemSize = 100 << 20 // 100 MB
+
+	// workerOutputLimit is the number of bytes of a worker's most recent output
+	// kept for inclusion in crash reports.
+	workerOutputLimit = 64 << 10
+)
+
+// errWorkerHung is returned by worker.call when the worker process did not
+// respond in time and was killed.
+var errWorkerHung = errors.New("fuzzing process did not respond in time")
+
+// worker manages a worker process running a test binary. The worker object
+// exists only in the coordinator (the process started by 'go test -fuzz').
+// The worker process itself communicates with the coordinator through
+// a workerServer.
+type worker struct {
+	dir     string   // working directory, same as package directory
+	binPath string   // path to test executable
+	args    []string // arguments for test executable
+	env     []string // environment for test executable
+
+	coordinator *coordinator
+
+	mem *sharedMem // shared memory with worker; persists across processes.
+
+	cmd         *exec.Cmd     // current worker process
+	fuzzIn      *os.File      // write end of the pipe the worker reads calls from
+	fuzzOut     *os.File      // read end of the pipe the worker writes responses to
+	enc         *json.Encoder // encodes calls to fuzzIn
+	dec         *json.Decoder // decodes responses from fuzzOut
+	waitErr     error         // last error returned by wait, set before termC is closed.
+	interrupted bool          // true after stop interrupts a running worker.
+	termC       chan struct{} // closed by wait when worker process terminates
+
+	output tailBuffer // most recent output of the worker process
+}
+
+func newWorker(c *coordinator, dir, binPath string, args, env []string) (*worker, error) {
+	mem, err := sharedMemTempFile(workerSharedMemSize)
+	if err != nil {
+		return nil, err
+	}
+	return &worker{
+		dir:         dir,
+		binPath:     binPath,
+		args:        args,
+		env:         env[:len(env):len(env)], // copy on append to ensure workers don't overwrite each other.
+		coordinator: c,
+		mem:         mem,
+	}, nil
+}
+
+// cleanup releases persistent resources associated with the worker.
+func (w *worker) cleanup() error {
+	if w.mem == nil {
+		return nil
+	}
+	err := w.mem.Close()
+	w.mem = nil
+	return err
+}
+
+// coordinate runs the test binary to perform fuzzing.
+//
+// coordinate loops until ctx is cancelled or a fatal error is encountered.
+// If a test process terminates unexpectedly while fuzzing, coordinate will
+// attempt to restart and continue unless the termination can be attributed
+// to an interruption (from a timer or the user).
+//
+// While looping, coordinate receives inputs from the coordinator, passes
+// those inputs to the worker process, then passes the results back to
+// the coordinator.
+func (w *worker) coordinate(ctx context.Context) error {
+	for {
+		// Start or restart the worker if it's not running.
+		if !w.isRunning() {
+			if err := w.startAndPing(ctx); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			// Worker was told to stop.
+			err := w.stop()
+			if err != nil && !w.interrupted && !isInterruptError(err) {
+				return err
+			}
+			return ctx.Err()
+
+		case <-w.termC:
+			// Worker process terminated unexpectedly while waiting for input.
+			err := w.stop()
+			if err == nil || isInterruptError(err) {
+				// Worker stopped, either by exiting with status 0 or after being
+				// interrupted with a signal that was not sent by the coordinator.
+				//
+				// When the user presses ^C, on POSIX platforms, SIGINT is delivered
+				// to all processes in the group concurrently, and the worker may see
+				// it before the coordinator. This condition is probably intended by
+				// the user, so suppress the error.
+				return nil
+			}
+			if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == workerExitCode {
+				// Worker exited with a code indicating F.Fuzz was not called
+				// correctly, for example, F.Fail was called first.
+				return fmt.Errorf("fuzzing process exited unexpectedly due to an internal failure: %w%s", err, w.output.report())
+			}
+			// Worker exited non-zero or was terminated by a non-interrupt signal
+			// (for example, SIGSEGV) while waiting for input.
+			return fmt.Errorf("fuzzing process terminated unexpectedly: %w%s", err, w.output.report())
+
+		case input := <-w.coordinator.inputC:
+			// Received input from coordinator.
+			args := fuzzArgs{
+				Limit:        input.limit,
+				Timeout:      input.timeout,
+				Warmup:       input.warmup,
+				CoverageData: input.coverageData,
+			}
+			entry, resp, isInternalError, err := w.fuzz(input.entry, args)
+			canMinimize := true
+			if err != nil {
+				// Error communicating with worker.
+				hung := err == errWorkerHung
+				w.stop()
+				if ctx.Err() != nil {
+					// Timeout or interruption.
+					return ctx.Err()
+				}
+				if isInternalError {
+					// An internal error occurred which shouldn't be considered
+					// a crash.
+					return err
+				}
+				if w.interrupted {
+					// Communication error before we stopped the worker.
+					// Report an error, but don't record a crasher.
+					return fmt.Errorf("communicating with fuzzing process: %v", err)
+				}
+				if sig, ok := terminationSignal(w.waitErr); ok && !hung && !isCrashSignal(sig) {
+					// Worker terminated by a signal that probably wasn't caused by a
+					// specific input to the fuzz function. For example, on Linux,
+					// the kernel (OOM killer) may send SIGKILL to a process using a
+					// lot of memory. Or the shell might send SIGHUP when the terminal
+					// is closed. Don't record a crasher.
+					return fmt.Errorf("fuzzing process terminated by unexpected signal; no crash will be recorded: %v", w.waitErr)
+				}
+				// Unexpected termination. Set error message and fall through.
+				// We'll restart the worker on the next iteration.
+				// Don't attempt to minimize this since it crashed the worker.
+				if hung {
+					resp.Err = fmt.Sprintf("fuzzing process hung or terminated unexpectedly: %v", err)
+				} else {
+					resp.Err = fmt.Sprintf("fuzzing process hung or terminated unexpectedly: %v", w.waitErr)
+				}
+				resp.Err += w.output.report()
+				canMinimize = false
+			}
+			result := fuzzResult{
+				limit:         input.limit,
+				count:         resp.Count,
+				totalDuration: resp.TotalDuration,
+				entryDuration: resp.InterestingDuration,
+				entry:         entry,
+				crasherMsg:    resp.Err,
+				coverageData:  resp.CoverageData,
+				canMinimize:   canMinimize,
+			}
+			w.coordinator.resultC <- result
+
+		case input := <-w.coordinator.minimizeC:
+			// Received input to minimize from coordinator.
+			result, err := w.minimize(input)
+			if err != nil {
+				// Error minimizing. Send back the original input. If it didn't
+				// cause an error before, report it as causing an error now.
+				result = fuzzResult{
+					entry:       input.entry,
+					crasherMsg:  input.crasherMsg,
+					canMinimize: false,
+					limit:       input.limit,
+				}
+				if result.crasherMsg == "" {
+					result.crasherMsg = err.Error()
+				}
+			}
+			w.coordinator.resultC <- result
+		}
+	}
+}
+
+// minimize tells a worker process to attempt to find a smaller value that
+// causes the same error as input.entry. If the worker process terminates
+// while minimizing, the last value it was testing is reported, since it
+// also caused a failure.
+func (w *worker) minimize(input fuzzMinimizeInput) (min fuzzResult, err error) {
+	data, err := corpusEntryData(input.entry)
+	if err != nil {
+		return fuzzResult{}, err
+	}
+	w.mem.header().count = 0
+	w.mem.setValue(data)
+	w.output.reset()
+
+	args := minimizeArgs{Limit: input.limit, Timeout: input.timeout}
+	timeout := input.timeout
+	if timeout == 0 {
+		// Minimization is bounded only by the number of calls, so there's no
+		// useful deadline; still kill the worker if it stops responding
+		// entirely.
+		timeout = 24 * time.Hour
+	}
+	var resp minimizeResponse
+	callErr := w.call(call{Minimize: &args}, &resp, timeout+workerTimeoutDuration)
+	min = fuzzResult{
+		limit:         input.limit,
+		count:         w.mem.header().count,
+		totalDuration: resp.Duration,
+		canMinimize:   false,
+	}
+	if callErr != nil {
+		// The worker died or hung while testing the value in shared memory.
+		// That value is at least as small as the original, so report it.
+		w.stop()
+		min.entry = minimizedEntry(input.entry, w.mem.valueCopy())
+		min.crasherMsg = fmt.Sprintf("fuzzing process hung or terminated unexpectedly while minimizing: %v%s", w.waitErr, w.output.report())
+		return min, nil
+	}
+	if !resp.WroteToMem {
+		// Minimization made no progress; report the original input.
+		min.entry = input.entry
+		min.crasherMsg = input.crasherMsg
+		return min, nil
+	}
+	min.entry = minimizedEntry(input.entry, w.mem.valueCopy())
+	min.crasherMsg = resp.Err
+	if min.crasherMsg == "" {
+		min.crasherMsg = input.crasherMsg
+	}
+	return min, nil
+}
+
+// minimizedEntry returns a copy of orig whose data has been replaced by the
+// marshaled, minimized value data.
+func minimizedEntry(orig CorpusEntry, data []byte) CorpusEntry {
+	return CorpusEntry{
+		Parent:     orig.Parent,
+		Data:       data,
+		Generation: orig.Generation,
+	}
+}
+
+// fuzz tells the worker process to test random inputs derived from entryIn.
+// If the worker finds an input that crashes or expands coverage, fuzz returns
+// a new entry holding that input. Otherwise, it returns entryIn.
+//
+// isInternalError is true if err reports a problem with the fuzzing engine
+// rather than a failure caused by an input.
+func (w *worker) fuzz(entryIn CorpusEntry, args fuzzArgs) (entry CorpusEntry, resp fuzzResponse, isInternalError bool, err error) {
+	data, err := corpusEntryData(entryIn)
+	if err != nil {
+		return CorpusEntry{}, fuzzResponse{}, true, err
+	}
+	w.mem.header().count = 0
+	w.mem.setValue(data)
+	w.output.reset()
+
+	callErr := w.call(call{Fuzz: &args}, &resp, args.Timeout+workerTimeoutDuration)
+	if callErr == nil && resp.InternalErr != "" {
+		return CorpusEntry{}, fuzzResponse{}, true, errors.New(resp.InternalErr)
+	}
+	if callErr != nil {
+		// The worker didn't finish; the count in shared memory is still
+		// accurate, and the value there is the one that caused the problem.
+		resp.Count = w.mem.header().count
+	}
+	if args.Warmup || (callErr == nil && resp.Err == "" && resp.CoverageData == nil) {
+		return entryIn, resp, false, callErr
+	}
+	entry = CorpusEntry{
+		Parent:     entryIn.Path,
+		Data:       w.mem.valueCopy(),
+		Generation: entryIn.Generation + 1,
+	}
+	return entry, resp, false, callErr
+}
+
+// call sends c to the worker process and decodes its response into resp.
+// If the worker doesn't respond within timeout, call kills the worker process
+// and returns errWorkerHung.
+func (w *worker) call(c call, resp interface{}, timeout time.Duration) error {
+	proc := w.cmd.Process
+	timer := time.AfterFunc(timeout, func() { proc.Kill() })
+	err := w.enc.Encode(c)
+	if err == nil {
+		err = w.dec.Decode(resp)
+	}
+	if !timer.Stop() {
+		return errWorkerHung
+	}
+	return err
+}
+
+// startAndPing starts the worker process and checks that it's ready to
+// accept calls.
+func (w *worker) startAndPing(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := w.start(); err != nil {
+		return err
+	}
+	if err := w.call(call{Ping: &pingArgs{}}, &pingResponse{}, workerTimeoutDuration); err != nil {
+		// The worker most likely failed before calling F.Fuzz, for example
+		// because of a panic in TestMain or an init function.
+		w.stop()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if isInterruptError(w.waitErr) {
+			// User may have pressed ^C before worker responded.
+			return ctx.Err()
+		}
+		if exitErr, ok := w.waitErr.(*exec.ExitError); ok && exitErr.ExitCode() == workerExitCode {
+			return fmt.Errorf("fuzzing process exited unexpectedly due to an internal failure: %w%s", w.waitErr, w.output.report())
+		}
+		return fmt.Errorf("fuzzing process terminated without fuzzing: %w%s", err, w.output.report())
+	}
+	return nil
+}
+
+func (w *worker) isRunning() bool {
+	return w.cmd != nil
+}
+
+// start runs a new worker process.
+//
+// If the process couldn't be started, start returns an error. Start won't
+// return later termination errors from the process if they occur.
+//
+// If the process starts successfully, start returns nil. stop must be called
+// once later to clean up, even if the process terminates on its own.
+//
+// When the process starts, it reads calls from a pipe (fuzz_in) and
+// writes responses to another pipe (fuzz_out). The value being tested is
+// passed through shared memory, so that the coordinator can find out which
+// input crashed the worker.
+func (w *worker) start() (err error) {
+	if w.isRunning() {
+		panic("worker already started")
+	}
+	w.waitErr = nil
+	w.interrupted = false
+	w.termC = nil
+
+	cmd := exec.Command(w.binPath, w.args...)
+	cmd.Dir = w.dir
+	cmd.Env = w.env
+	cmd.Stdout = &w.output
+	cmd.Stderr = &w.output
+
+	// Create the "fuzz_in" and "fuzz_out" pipes so we can communicate with
+	// the worker. We don't use stdin and stdout, since the test binary may
+	// do something else with those.
+	fuzzInR, fuzzInW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer fuzzInR.Close()
+	fuzzOutR, fuzzOutW, err := os.Pipe()
+	if err != nil {
+		fuzzInW.Close()
+		return err
+	}
+	defer fuzzOutW.Close()
+	setWorkerComm(cmd, workerComm{fuzzIn: fuzzInR, fuzzOut: fuzzOutW, mem: w.mem})
+
+	// Start the worker process.
+	if err := cmd.Start(); err != nil {
+		fuzzInW.Close()
+		fuzzOutR.Close()
+		return err
+	}
+
+	// Worker started successfully.
+	// After this, w owns fuzzInW and fuzzOutR, so stop must be called later.
+	w.cmd = cmd
+	w.fuzzIn = fuzzInW
+	w.fuzzOut = fuzzOutR
+	w.enc = json.NewEncoder(fuzzInW)
+	w.dec = json.NewDecoder(fuzzOutR)
+	w.termC = make(chan struct{})
+	go func() {
+		w.waitErr = cmd.Wait()
+		close(w.termC)
+	}()
+
+	return nil
+}
+
+// stop tells the worker process to exit by closing w.fuzzIn, then blocks
+// until the process exits. If the process doesn't exit within
+// workerTimeoutDuration, stop kills it.
+//
+// stop returns the error the process terminated with, if any (same as
+// w.waitErr).
+//
+// stop must be called at least once after start returns successfully, even if
+// the worker process terminates unexpectedly.
+func (w *worker) stop() error {
+	if w.termC == nil {
+		panic("worker was not started successfully")
+	}
+	if w.cmd == nil {
+		// Already stopped.
+		return w.waitErr
+	}
+
+	// Tell the worker to stop by closing fuzz_in. It won't actually stop until
+	// it finishes with earlier calls.
+	w.fuzzIn.Close()
+
+	t := time.NewTimer(workerTimeoutDuration)
+	select {
+	case <-w.termC:
+		// Worker terminated.
+		t.Stop()
+	case <-t.C:
+		// Timer fired before worker terminated. Kill it.
+		w.interrupted = true
+		w.cmd.Process.Kill()
+		<-w.termC
+	}
+	w.fuzzOut.Close()
+	w.cmd = nil
+	w.fuzzIn = nil
+	w.fuzzOut = nil
+	w.enc = nil
+	w.dec = nil
+	return w.waitErr
+}
+
+// tailBuffer is an io.Writer that retains the last workerOutputLimit bytes
+// written to it. It's safe for concurrent use, since os/exec copies a
+// process's stdout and stderr on separate goroutines.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(p)
+	if len(p) > workerOutputLimit {
+		p = p[len(p)-workerOutputLimit:]
+	}
+	if over := len(b.buf) + len(p) - workerOutputLimit; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
+
+func (b *tailBuffer) reset() {
+	b.mu.Lock()
+	b.buf = b.buf[:0]
+	b.mu.Unlock()
+}
+
+// report returns the buffered output formatted for appending to an error
+// message, or the empty string if there was no output.
+func (b *tailBuffer) report() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := bytes.TrimSpace(b.buf)
+	if len(out) == 0 {
+		return ""
+	}
+	return "\n" + string(out)
+}
+
+// call is serialized and sent from the coordinator on fuzz_in. It acts as
+// a minimalist RPC mechanism. Exactly one of its fields must be set to indicate
+// which method to call.
+type call struct {
+	Ping     *pingArgs
+	Fuzz     *fuzzArgs
+	Minimize *minimizeArgs
+}
+
+// minimizeArgs contains arguments to workerServer.minimize. The value to
+// minimize is already in shared memory.
+type minimizeArgs struct {
+	// Timeout is the time to spend minimizing. This may include time to start up,
+	// especially if the input causes the worker process to terminated, requiring
+	// repeated restarts.
+	Timeout time.Duration
+
+	// Limit is the maximum number of values to test, without spending more time
+	// than Duration. 0 indicates no limit.
+	Limit int64
+}
+
+// minimizeResponse contains results from workerServer.minimize.
+type minimizeResponse struct {
+	// WroteToMem is true if the worker found a smaller input and wrote it to
+	// shared memory.
+	WroteToMem bool
+
+	// Err is the error string caused by the value in shared memory, if any.
+	Err string
+
+	// Duration is the time spent minimizing, not including starting or cleaning up.
+	Duration time.Duration
+}
+
+// fuzzArgs contains arguments to workerServer.fuzz. The value to fuzz is
+// passed in shared memory.
+type fuzzArgs struct {
+	// Timeout is the time to spend fuzzing, not including starting or
+	// cleaning up.
+	Timeout time.Duration
+
+	// Limit is the maximum number of values to test, without spending more time
+	// than Duration. 0 indicates no limit.
+	Limit int64
+
+	// Warmup indicates whether this is part of a warmup run, meaning that
+	// fuzzing should not occur. If coverageEnabled is true, then coverage data
+	// should be reported.
+	Warmup bool
+
+	// CoverageData is the coverage data. If set, the worker should update its
+	// local coverage data prior to fuzzing.
+	CoverageData []byte
+}
+
+// fuzzResponse contains results from workerServer.fuzz.
+type fuzzResponse struct {
+	// Duration is the time spent fuzzing, not including starting or cleaning up.
+	TotalDuration       time.Duration
+	InterestingDuration time.Duration
+
+	// Count is the number of values tested.
+	Count int64
+
+	// CoverageData is set if the value in shared memory expands coverage
+	// and therefore may be interesting to the coordinator.
+	CoverageData []byte
+
+	// Err is the error string caused by the value in shared memory, which is
+	// non-empty if the value in shared memory caused a crash.
+	Err string
+
+	// InternalErr is the error string caused by an internal error in the
+	// worker. This shouldn't be considered a crasher.
+	InternalErr string
+}
+
+// pingArgs contains arguments to workerServer.ping.
+type pingArgs struct{}
+
+// pingResponse contains results from workerServer.ping.
+type pingResponse struct{}
+
+// workerComm holds pipes and shared memory used for communication
+// between the coordinator process (client) and a worker process (server).
+// These values are unique to each worker; they are shared only with the
+// coordinator, not with other workers.
+//
+// Access to shared memory is synchronized implicitly over the pipes: the
+// coordinator only touches the memory while no call is outstanding, and the
+// worker only touches it while handling a call.
+type workerComm struct {
+	fuzzIn, fuzzOut *os.File
+	mem             *sharedMem
+}
+
+// workerServer is a minimalist RPC server, run by fuzz worker processes.
+// It allows the coordinator process (using worker) to call methods in a
+// worker process. This system allows the coordinator to run multiple worker
+// processes in parallel and to collect inputs that caused crashes from shared
+// memory after a worker process terminates unexpectedly.
+type workerServer struct {
+	workerComm
+	m *mutator
+
+	// coverageMask is the local coverage data for the worker. It is
+	// periodically updated to reflect the data in the coordinator when new
+	// coverage is found.
+	coverageMask []byte
+
+	// fuzzFn runs the worker's fuzz target on the given input and returns an
+	// error if it finds a crasher (the process may also exit or crash), and the
+	// time it took to run the input. It sets a deadline of 10 seconds, at which
+	// point it will panic with the assumption that the process is hanging or
+	// deadlocked.
+	fuzzFn func(CorpusEntry) (time.Duration, error)
+}
+
+// RunFuzzWorker is called in a worker process to communicate with the
+// coordinator process in order to fuzz random inputs. RunFuzzWorker loops
+// until the coordinator tells it to stop.
+//
+// fn is a wrapper on the fuzz function. It may return an error to indicate
+// a given input "crashed". The coordinator will also record a crasher if
+// the function times out or terminates the process.
+//
+// RunFuzzWorker returns an error if it could not communicate with the
+// coordinator process.
+func RunFuzzWorker(ctx context.Context, fn func(CorpusEntry) error) error {
+	comm, err := getWorkerComm()
+	if err != nil {
+		return err
+	}
+	srv := &workerServer{
+		workerComm: comm,
+		fuzzFn: func(e CorpusEntry) (time.Duration, error) {
+			timer := time.AfterFunc(workerTimeoutDuration, func() {
+				panic(fmt.Sprintf("fuzz function did not return within %v", workerTimeoutDuration))
+			})
+			defer timer.Stop()
+			start := time.Now()
+			err := fn(e)
+			return time.Since(start), err
+		},
+		m: newMutator(),
+	}
+	return srv.serve(ctx)
+}
+
+// serve reads serialized RPC messages on fuzzIn. When serve receives a message,
+// it calls the corresponding method, then sends the serialized result back
+// on fuzzOut.
+//
+// serve handles RPC calls synchronously; it will not attempt to read a message
+// until the previous call has finished.
+//
+// serve returns errors that occurred when communicating over pipes. serve
+// does not return errors from method calls; those are passed through serialized
+// responses.
+func (ws *workerServer) serve(ctx context.Context) error {
+	enc := json.NewEncoder(ws.fuzzOut)
+	dec := json.NewDecoder(ws.fuzzIn)
+	for {
+		var c call
+		if err := dec.Decode(&c); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				// The coordinator closed fuzz_in to tell us to stop.
+				return nil
+			}
+			return err
+		}
+
+		var resp interface{}
+		switch {
+		case c.Fuzz != nil:
+			resp = ws.fuzz(ctx, *c.Fuzz)
+		case c.Minimize != nil:
+			resp = ws.minimize(ctx, *c.Minimize)
+		case c.Ping != nil:
+			resp = ws.ping(ctx, *c.Ping)
+		default:
+			return errors.New("no arguments provided for any call")
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// fuzz runs the test function on random variations of the input value in shared
+// memory for a limited duration or number of iterations.
+//
+// fuzz returns early if it finds an input that crashes the fuzz function (with
+// fuzzResponse.Err set) or an input that expands coverage (with
+// fuzzResponse.CoverageData set).
+//
+// Before each call to the fuzz function, fuzz writes the mutated input to
+// shared memory and increments a counter there. If the worker process
+// terminates, the coordinator reads the input that caused it from shared
+// memory.
+func (ws *workerServer) fuzz(ctx context.Context, args fuzzArgs) (resp fuzzResponse) {
+	if args.CoverageData != nil {
+		if ws.coverageMask != nil && len(args.CoverageData) != len(ws.coverageMask) {
+			resp.InternalErr = fmt.Sprintf("unexpected size for CoverageData: got %d, expected %d", len(args.CoverageData), len(ws.coverageMask))
+			return resp
+		}
+		ws.coverageMask = args.CoverageData
+	}
+	start := time.Now()
+	defer func() { resp.TotalDuration = time.Since(start) }()
+	deadline := start.Add(args.Timeout)
+
+	mem := ws.mem
+	originalVals, err := unmarshalCorpusFile(mem.valueCopy())
+	if err != nil {
+		resp.InternalErr = err.Error()
+		return resp
+	}
+	defer func() { resp.Count = mem.header().count }()
+
+	// fuzzOnce runs the fuzz function once with vals. It returns the time the
+	// call took, the coverage snapshot if vals expanded coverage, and the error
+	// message if vals caused a failure.
+	fuzzOnce := func(vals []interface{}) (dur time.Duration, cov []byte, errMsg string) {
+		mem.header().count++
+		dur, err := ws.fuzzFn(CorpusEntry{Values: vals})
+		if err != nil {
+			errMsg = err.Error()
+			if errMsg == "" {
+				errMsg = "fuzz function failed with no input"
+			}
+			return dur, nil, errMsg
+		}
+		if ws.coverageMask != nil && countNewCoverageBits(ws.coverageMask, coverageSnapshot) > 0 {
+			return dur, coverageSnapshot, ""
+		}
+		return dur, nil, ""
+	}
+
+	if args.Warmup {
+		dur, _, errMsg := fuzzOnce(originalVals)
+		if errMsg != "" {
+			resp.Err = errMsg
+			return resp
+		}
+		resp.InterestingDuration = dur
+		if coverageEnabled {
+			resp.CoverageData = append([]byte(nil), coverageSnapshot...)
+		}
+		return resp
+	}
+
+	vals := make([]interface{}, len(originalVals))
+	for {
+		if ctx.Err() != nil || time.Now().After(deadline) {
+			return resp
+		}
+		copy(vals, originalVals)
+		ws.m.mutate(vals, maxValueLen)
+		// Write the mutated value to shared memory before calling the fuzz
+		// function, so the coordinator can recover it if the process crashes.
+		mem.setValue(marshalCorpusFile(vals...))
+
+		dur, cov, errMsg := fuzzOnce(vals)
+		if errMsg != "" {
+			resp.Err = errMsg
+			return resp
+		}
+		if cov != nil {
+			resp.CoverageData = append([]byte(nil), cov...)
+			resp.InterestingDuration = dur
+			return resp
+		}
+		if args.Limit > 0 && mem.header().count >= args.Limit {
+			return resp
+		}
+	}
+}
+
+func (ws *workerServer) minimize(ctx context.Context, args minimizeArgs) (resp minimizeResponse) {
+	start := time.Now()
+	defer func() { resp.Duration = time.Since(start) }()
+	mem := ws.mem
+	vals, err := unmarshalCorpusFile(mem.valueCopy())
+	if err != nil {
+		panic(err)
+	}
+	success, err := ws.minimizeInput(ctx, vals, mem, args)
+	if success {
+		mem.setValue(marshalCorpusFile(vals...))
+		resp.WroteToMem = true
+		if err != nil {
+			resp.Err = err.Error()
+		}
+	}
+	return resp
+}
+
+// minimizeInput applies a series of minimizing transformations on the provided
+// vals, ensuring that each minimization still causes an error in fuzzFn. It
+// uses the context to determine how long to run, stopping once closed. It
+// returns a bool indicating whether minimization was successful and an error
+// if one was found.
+func (ws *workerServer) minimizeInput(ctx context.Context, vals []interface{}, mem *sharedMem, args minimizeArgs) (success bool, retErr error) {
+	var deadline time.Time
+	if args.Timeout != 0 {
+		deadline = time.Now().Add(args.Timeout)
+	}
+	count := &mem.header().count
+	shouldStop := func() bool {
+		return ctx.Err() != nil ||
+			(!deadline.IsZero() && time.Now().After(deadline)) ||
+			(args.Limit > 0 && *count >= args.Limit)
+	}
+	if shouldStop() {
+		return false, nil
+	}
+
+	// Check that the original value still causes an error. If not, then
+	// whatever caused us to think the value was a crasher may have been a
+	// flake, and we can't minimize it.
+	*count++
+	if _, retErr = ws.fuzzFn(CorpusEntry{Values: vals}); retErr == nil {
+		return false, nil
+	}
+
+	var valI int
+	// tryMinimized runs the fuzz function with candidate replacing the value
+	// at index valI. It reports whether the candidate still causes an error;
+	// if so, the candidate is kept.
+	tryMinimized := func(candidate []byte) bool {
+		prev := vals[valI]
+		switch prev.(type) {
+		case []byte:
+			vals[valI] = append([]byte(nil), candidate...)
+		case string:
+			vals[valI] = string(candidate)
+		default:
+			panic("impossible")
+		}
+		// Write the candidate before running it, so that the coordinator can
+		// recover it if the worker process crashes.
+		mem.setValue(marshalCorpusFile(vals...))
+		*count++
+		if _, err := ws.fuzzFn(CorpusEntry{Values: vals}); err != nil {
+			retErr = err
+			return true
+		}
+		vals[valI] = prev
+		return false
+	}
+
+	for valI = range vals {
+		if shouldStop() {
+			break
+		}
+		switch v := vals[valI].(type) {
+		case string:
+			minimizeBytes([]byte(v), tryMinimized, shouldStop)
+		case []byte:
+			minimizeBytes(append([]byte(nil), v...), tryMinimized, shouldStop)
+		default:
+			// Only []byte and string values can be minimized.
+		}
+	}
+	return true, retErr
+}
+
+// ping does nothing. The coordinator calls this method to ensure the worker
+// has called F.Fuzz and can communicate.
+func (ws *workerServer) ping(ctx context.Context, args pingArgs) pingResponse {
+	return pingResponse{}
+}
@@ -0,0 +1,68 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slog_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// removeTime removes the top-level time attribute, so that
+// the output of the examples is deterministic.
+func removeTime(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey && len(groups) == 0 {
+		return slog.Attr{}
+	}
+	return a
+}
+
+func ExampleGroup() {
+	h := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{ReplaceAttr: removeTime})
+	logger := slog.New(h)
+
+	logger.Info("finished",
+		slog.Group("req",
+			slog.String("method", "GET"),
+			slog.String("url", "localhost")),
+		slog.Int("status", 200))
+
+	// Output:
+	// level=INFO msg=finished req.method=GET req.url=localhost status=200
+}
+
+func ExampleLogger_With() {
+	h := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{ReplaceAttr: removeTime})
+	logger := slog.New(h).With("app", "server").WithGroup("req")
+
+	logger.Warn("slow", "path", "/index.html", "ms", 1200)
+
+	// Output:
+	// {"level":"WARN","msg":"slow","app":"server","req":{"path":"/index.html","ms":1200}}
+}
+
+func ExampleNewContext() {
+	h := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{ReplaceAttr: removeTime})
+	ctx := slog.NewContext(context.Background(), slog.New(h).With("request_id", 42))
+
+	// Deeper in the call chain, retrieve the Logger from the context.
+	slog.FromContext(ctx).InfoContext(ctx, "handled")
+
+	// Output:
+	// level=INFO msg=handled request_id=42
+}
+
+func ExampleHandlerOptions_level() {
+	var programLevel = new(slog.LevelVar) // Info by default
+	h := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: programLevel, ReplaceAttr: removeTime})
+	logger := slog.New(h)
+
+	logger.Debug("not shown")
+	programLevel.Set(slog.LevelDebug)
+	logger.Debug("shown")
+
+	// Output:
+	// level=DEBUG msg=shown
+}
@@ -0,0 +1,279 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maps
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+var m1 = map[int]int{1: 2, 2: 4, 4: 8, 8: 16}
+var m2 = map[int]string{1: "2", 2: "4", 4: "8", 8: "16"}
+
+func TestKeys(t *testing.T) {
+	want := []int{1, 2, 4, 8}
+
+	got1 := Keys(m1)
+	slices.Sort(got1)
+	if !slices.Equal(got1, want) {
+		t.Errorf("Keys(%v) = %v, want %v", m1, got1, want)
+	}
+
+	got2 := Keys(m2)
+	slices.Sort(got2)
+	if !slices.Equal(got2, want) {
+		t.Errorf("Keys(%v) = %v, want %v", m2, got2, want)
+	}
+}
+
+func TestValues(t *testing.T) {
+	got1 := Values(m1)
+	want1 := []int{2, 4, 8, 16}
+	slices.Sort(got1)
+	if !slices.Equal(got1, want1) {
+		t.Errorf("Values(%v) = %v, want %v", m1, got1, want1)
+	}
+
+	got2 := Values(m2)
+	want2 := []string{"16", "2", "4", "8"}
+	slices.Sort(got2)
+	if !slices.Equal(got2, want2) {
+		t.Errorf("Values(%v) = %v, want %v", m2, got2, want2)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	if !Equal(m1, m1) {
+		t.Errorf("Equal(%v, %v) = false, want true", m1, m1)
+	}
+	if Equal(m1, (map[int]int)(nil)) {
+		t.Errorf("Equal(%v, nil) = true, want false", m1)
+	}
+	if Equal((map[int]int)(nil), m1) {
+		t.Errorf("Equal(nil, %v) = true, want false", m1)
+	}
+	if !Equal[map[int]int, map[int]int](nil, nil) {
+		t.Error("Equal(nil, nil) = false, want true")
+	}
+	if ms := map[int]int{1: 2}; Equal(m1, ms) {
+		t.Errorf("Equal(%v, %v) = true, want false", m1, ms)
+	}
+
+	// Comparing NaN for equality is expected to fail.
+	mf := map[int]float64{1: 0, 2: math.NaN()}
+	if Equal(mf, mf) {
+		t.Errorf("Equal(%v, %v) = true, want false", mf, mf)
+	}
+}
+
+// equal is simply ==.
+func equal[T comparable](v1, v2 T) bool {
+	return v1 == v2
+}
+
+// equalNaN is like == except that all NaNs are equal.
+func equalNaN[T comparable](v1, v2 T) bool {
+	isNaN := func(f T) bool { return f != f }
+	return v1 == v2 || (isNaN(v1) && isNaN(v2))
+}
+
+// equalStr compares ints and strings.
+func equalIntStr(v1 int, v2 string) bool {
+	return strconv.Itoa(v1) == v2
+}
+
+func TestEqualFunc(t *testing.T) {
+	if !EqualFunc(m1, m1, equal[int]) {
+		t.Errorf("EqualFunc(%v, %v, equal) = false, want true", m1, m1)
+	}
+	if EqualFunc(m1, (map[int]int)(nil), equal[int]) {
+		t.Errorf("EqualFunc(%v, nil, equal) = true, want false", m1)
+	}
+	if EqualFunc((map[int]int)(nil), m1, equal[int]) {
+		t.Errorf("EqualFunc(nil, %v, equal) = true, want false", m1)
+	}
+	if !EqualFunc[map[int]int, map[int]int](nil, nil, equal[int]) {
+		t.Error("EqualFunc(nil, nil, equal) = false, want true")
+	}
+	if ms := map[int]int{1: 2}; EqualFunc(m1, ms, equal[int]) {
+		t.Errorf("EqualFunc(%v, %v, equal) = true, want false", m1, ms)
+	}
+
+	// Comparing NaN for equality is expected to fail.
+	mf := map[int]float64{1: 0, 2: math.NaN()}
+	if EqualFunc(mf, mf, equal[float64]) {
+		t.Errorf("EqualFunc(%v, %v, equal) = true, want false", mf, mf)
+	}
+	// But it should succeed using equalNaN.
+	if !EqualFunc(mf, mf, equalNaN[float64]) {
+		t.Errorf("EqualFunc(%v, %v, equalNaN) = false, want true", mf, mf)
+	}
+
+	if !EqualFunc(m1, m2, equalIntStr) {
+		t.Errorf("EqualFunc(%v, %v, equalIntStr) = false, want true", m1, m2)
+	}
+}
+
+func TestClone(t *testing.T) {
+	mc := Clone(m1)
+	if !Equal(mc, m1) {
+		t.Errorf("Clone(%v) = %v, want %v", m1, mc, m1)
+	}
+	mc[16] = 32
+	if Equal(mc, m1) {
+		t.Errorf("Equal(%v, %v) = true, want false", mc, m1)
+	}
+}
+
+func TestCloneNil(t *testing.T) {
+	var m1 map[string]int
+	mc := Clone(m1)
+	if mc != nil {
+		t.Errorf("Clone(%v) = %v, want %v", m1, mc, m1)
+	}
+}
+
+func TestCloneEmpty(t *testing.T) {
+	m := map[string]int{}
+	mc := Clone(m)
+	if mc == nil || len(mc) != 0 {
+		t.Errorf("Clone(%v) = %v, want empty non-nil map", m, mc)
+	}
+	mc["x"] = 1
+	if len(m) != 0 {
+		t.Errorf("writing to clone modified original: %v", m)
+	}
+}
+
+type namedMap map[string]int
+
+func TestCloneNamed(t *testing.T) {
+	m := namedMap{"a": 1, "b": 2}
+	var mc namedMap = Clone(m)
+	if !Equal(mc, m) {
+		t.Errorf("Clone(%v) = %v, want %v", m, mc, m)
+	}
+}
+
+// TestCloneLarge clones maps of various sizes and shapes, including maps
+// with overflow buckets, deleted entries, NaN keys, keys and values too
+// large to be stored in a bucket directly, and maps in the middle of
+// growing.
+func TestCloneLarge(t *testing.T) {
+	for _, n := range []int{1, 8, 9, 100, 1000, 10000} {
+		m := make(map[int]int)
+		for i := 0; i < n; i++ {
+			m[i] = i * i
+		}
+		// Deleting half of the entries leaves holes in the buckets.
+		for i := 0; i < n; i += 2 {
+			delete(m, i)
+		}
+		mc := Clone(m)
+		if !Equal(mc, m) {
+			t.Errorf("Clone of %d-entry map differs", len(m))
+		}
+		// The clone must still be usable for lookups and inserts.
+		for i := 0; i < n; i++ {
+			if _, ok := mc[i]; ok != (i%2 == 1) {
+				t.Fatalf("Clone of %d-entry map: mc[%d] present = %v", len(m), i, ok)
+			}
+			mc[i] = -i
+		}
+		if len(mc) != n {
+			t.Errorf("after refilling clone: len = %d, want %d", len(mc), n)
+		}
+		if len(m) != n/2 {
+			t.Errorf("writing to clone modified original: len = %d, want %d", len(m), n/2)
+		}
+	}
+
+	// Keys and values larger than 128 bytes are stored indirectly.
+	type big [200]byte
+	mb := make(map[big]big)
+	for i := 0; i < 100; i++ {
+		var k, v big
+		k[0], k[199] = byte(i), byte(i>>8)
+		v[100] = byte(i)
+		mb[k] = v
+	}
+	mbc := Clone(mb)
+	if !Equal(mbc, mb) {
+		t.Errorf("Clone of map with indirect keys and values differs")
+	}
+	for k := range mbc {
+		v := mbc[k]
+		v[0] = 1
+		mbc[k] = v
+	}
+	for _, v := range mb {
+		if v[0] != 0 {
+			t.Fatalf("writing to clone modified original")
+		}
+	}
+
+	// NaN keys cannot be looked up, but must be copied.
+	mf := map[float64]int{math.NaN(): 1, math.NaN(): 2, 1: 3}
+	if mfc := Clone(mf); len(mfc) != 3 {
+		t.Errorf("Clone of map with NaN keys has %d entries, want 3", len(mfc))
+	}
+
+	// Clone a map while it is growing: inserting past the load factor
+	// starts a grow that is only finished by later writes.
+	for _, n := range []int{7, 14, 53, 105, 1000} {
+		m := make(map[int]int)
+		for i := 0; i < n; i++ {
+			m[i] = i
+		}
+		m[n] = n
+		mc := Clone(m)
+		if !Equal(mc, m) {
+			t.Errorf("Clone of %d-entry map differs", len(m))
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	mc := Clone(m1)
+	Copy(mc, mc)
+	if !Equal(mc, m1) {
+		t.Errorf("Copy(%v, %v) = %v, want %v", m1, m1, mc, m1)
+	}
+	Copy(mc, map[int]int{16: 32})
+	want := map[int]int{1: 2, 2: 4, 4: 8, 8: 16, 16: 32}
+	if !Equal(mc, want) {
+		t.Errorf("Copy result = %v, want %v", mc, want)
+	}
+
+	type M1 map[int]bool
+	type M2 map[int]bool
+	Copy(make(M1), make(M2))
+}
+
+func TestDeleteFunc(t *testing.T) {
+	mc := Clone(m1)
+	DeleteFunc(mc, func(int, int) bool { return false })
+	if !Equal(mc, m1) {
+		t.Errorf("DeleteFunc(%v, true) = %v, want %v", m1, mc, m1)
+	}
+	DeleteFunc(mc, func(k, v int) bool { return k > 3 })
+	want := map[int]int{1: 2, 2: 4}
+	if !Equal(mc, want) {
+		t.Errorf("DeleteFunc result = %v, want %v", mc, want)
+	}
+}
+
+func BenchmarkClone(b *testing.B) {
+	m := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		m[i] = i
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Clone(m)
+	}
+}
@@ -103,5 +103,17 @@ functions. Manually configuring HTTP/2 via the golang.org/x/net/http2
 package takes precedence over the net/http package's built-in HTTP/2
 support.
 
+The ServeMux pattern syntax and matching behavior changed when method
+and wildcard patterns were added: escaped slashes (%2F) in a request
+path no longer separate segments, a request whose path matches only
+patterns for other methods gets a 405 Method Not Allowed response, and
+registering conflicting patterns panics. See ServeMux for the full list.
+Programs that depend on the old behavior can restore it with:
+
+	GODEBUG=httpmuxgo117=1  # use the ServeMux behavior of Go 1.17
+
+Like the HTTP/2 settings, this GODEBUG setting is not covered by Go's
+API compatibility promise.
+
 */
 package http
@@ -0,0 +1,762 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 support, as described in RFC 9114.
+// The transport is QUIC, implemented by net/http/internal/quic,
+// and field sections are compressed with QPACK, implemented by
+// net/http/internal/qpack.
+
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/internal/ascii"
+	"net/http/internal/qpack"
+	"net/http/internal/quic"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// nextProtoH3 is the ALPN protocol identifier for HTTP/3.
+const nextProtoH3 = "h3"
+
+// HTTP/3 frame types.
+// https://www.rfc-editor.org/rfc/rfc9114#section-11.2.1
+const (
+	h3FrameData        = 0x00
+	h3FrameHeaders     = 0x01
+	h3FrameCancelPush  = 0x03
+	h3FrameSettings    = 0x04
+	h3FramePushPromise = 0x05
+	h3FrameGoaway      = 0x07
+	h3FrameMaxPushID   = 0x0d
+)
+
+// HTTP/3 unidirectional stream types.
+// https://www.rfc-editor.org/rfc/rfc9114#section-11.2.4
+// https://www.rfc-editor.org/rfc/rfc9204#section-8.3
+const (
+	h3StreamControl      = 0x00
+	h3StreamPush         = 0x01
+	h3StreamQPACKEncoder = 0x02
+	h3StreamQPACKDecoder = 0x03
+)
+
+// HTTP/3 settings.
+// https://www.rfc-editor.org/rfc/rfc9114#section-11.2.2
+// https://www.rfc-editor.org/rfc/rfc9204#section-8.2
+const (
+	h3SettingQPACKMaxTableCapacity = 0x01
+	h3SettingMaxFieldSectionSize   = 0x06
+	h3SettingQPACKBlockedStreams   = 0x07
+)
+
+// HTTP/3 error codes.
+// https://www.rfc-editor.org/rfc/rfc9114#section-8.1
+// https://www.rfc-editor.org/rfc/rfc9204#section-6
+const (
+	h3NoError                = 0x100
+	h3GeneralProtocolError   = 0x101
+	h3InternalError          = 0x102
+	h3StreamCreationError    = 0x103
+	h3ClosedCriticalStream   = 0x104
+	h3FrameUnexpected        = 0x105
+	h3FrameError             = 0x106
+	h3ExcessiveLoad          = 0x107
+	h3IDError                = 0x108
+	h3SettingsError          = 0x109
+	h3MissingSettings        = 0x10a
+	h3RequestRejected        = 0x10b
+	h3RequestCancelled       = 0x10c
+	h3RequestIncomplete      = 0x10d
+	h3MessageError           = 0x10e
+	h3ConnectError           = 0x10f
+	h3VersionFallback        = 0x110
+	qpackDecompressionFailed = 0x200
+)
+
+// h3MaxSettingsSize is the largest SETTINGS frame we accept.
+const h3MaxSettingsSize = 1 << 12
+
+// An h3ConnError is an error that terminates an HTTP/3 connection.
+type h3ConnError struct {
+	code   uint64
+	reason string
+}
+
+func (e h3ConnError) Error() string {
+	return fmt.Sprintf("http3: connection error %#x: %v", e.code, e.reason)
+}
+
+// An h3StreamError is an error that terminates a single HTTP/3 request stream.
+type h3StreamError struct {
+	code   uint64
+	reason string
+}
+
+func (e h3StreamError) Error() string {
+	return fmt.Sprintf("http3: stream error %#x: %v", e.code, e.reason)
+}
+
+// h3AppendVarint appends v to b as a QUIC variable-length integer.
+// https://www.rfc-editor.org/rfc/rfc9000#section-16
+func h3AppendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, 0x40|byte(v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, 0x80|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		return append(b, 0xc0|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+			byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
+
+// h3ReadVarint reads a QUIC variable-length integer from r.
+func h3ReadVarint(r io.ByteReader) (uint64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	v := uint64(c & 0x3f)
+	n := 1 << (c >> 6)
+	for i := 1; i < n; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// h3AppendFrameHeader appends the header of a frame with the given type
+// and payload length to b.
+func h3AppendFrameHeader(b []byte, typ, length uint64) []byte {
+	b = h3AppendVarint(b, typ)
+	return h3AppendVarint(b, length)
+}
+
+// An h3FrameReader reads HTTP/3 frames from a stream.
+type h3FrameReader struct {
+	r *bufio.Reader
+}
+
+func newH3FrameReader(st *quic.Stream) *h3FrameReader {
+	return &h3FrameReader{r: bufio.NewReader(st)}
+}
+
+// readFrameHeader reads the type and payload length of the next frame.
+// It returns io.EOF if the stream ends cleanly before the frame starts.
+func (fr *h3FrameReader) readFrameHeader() (typ, length uint64, err error) {
+	typ, err = h3ReadVarint(fr.r)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err = h3ReadVarint(fr.r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return typ, length, err
+}
+
+// readPayload reads a frame payload of the given length.
+// It returns an error if the length exceeds max.
+func (fr *h3FrameReader) readPayload(length, max uint64) ([]byte, error) {
+	if length > max {
+		return nil, h3ConnError{h3ExcessiveLoad, "frame too large"}
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(fr.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// skip discards n bytes of frame payload.
+func (fr *h3FrameReader) skip(n uint64) error {
+	_, err := io.CopyN(io.Discard, fr.r, int64(n))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// h3UnexpectedFrame returns the connection error for a frame of type typ
+// that is not permitted on the current stream, or nil if frames of
+// this type should be ignored.
+// https://www.rfc-editor.org/rfc/rfc9114#section-7.2.8
+func h3UnexpectedFrame(typ uint64) error {
+	switch typ {
+	case h3FrameData, h3FrameHeaders, h3FrameCancelPush, h3FrameSettings,
+		h3FramePushPromise, h3FrameGoaway, h3FrameMaxPushID:
+		return h3ConnError{h3FrameUnexpected, fmt.Sprintf("unexpected frame type %#x", typ)}
+	case 0x02, 0x06, 0x08, 0x09:
+		// Reserved frame types used in HTTP/2.
+		return h3ConnError{h3FrameUnexpected, fmt.Sprintf("reserved frame type %#x", typ)}
+	}
+	return nil
+}
+
+// h3Conn holds the state common to HTTP/3 client and server connections.
+type h3Conn struct {
+	qconn *quic.Conn
+
+	// maxFieldSectionSize is the limit we advertise for received
+	// field sections.
+	maxFieldSectionSize uint64
+
+	// peerMaxFieldSectionSize is the limit the peer advertised,
+	// or 0 if it did not advertise one. Accessed atomically.
+	peerMaxFieldSectionSize uint64
+
+	mu                 sync.Mutex
+	gotControlStream   bool
+	gotEncoderStream   bool
+	gotDecoderStream   bool
+	gotSettings        bool
+	settingsc          chan struct{} // closed when the peer's SETTINGS arrive
+	controlStream      *quic.Stream
+	controlStreamWrite sync.Mutex
+}
+
+func (c *h3Conn) init(qconn *quic.Conn, maxFieldSectionSize uint64) {
+	c.qconn = qconn
+	c.maxFieldSectionSize = maxFieldSectionSize
+	c.settingsc = make(chan struct{})
+}
+
+// abort closes the connection with an error.
+func (c *h3Conn) abort(err error) {
+	var ce h3ConnError
+	if !errors.As(err, &ce) {
+		ce = h3ConnError{h3InternalError, err.Error()}
+	}
+	c.qconn.Abort(&quic.ApplicationError{Code: ce.code, Reason: ce.reason})
+}
+
+// openControlStream creates our control stream and sends SETTINGS.
+// https://www.rfc-editor.org/rfc/rfc9114#section-6.2.1
+func (c *h3Conn) openControlStream(ctx context.Context) error {
+	st, err := c.qconn.NewSendOnlyStream(ctx)
+	if err != nil {
+		return err
+	}
+	var settings []byte
+	settings = h3AppendVarint(settings, h3SettingMaxFieldSectionSize)
+	settings = h3AppendVarint(settings, c.maxFieldSectionSize)
+	// QPACK_MAX_TABLE_CAPACITY and QPACK_BLOCKED_STREAMS default to zero,
+	// which is the only configuration we support.
+
+	b := h3AppendVarint(nil, h3StreamControl)
+	b = h3AppendFrameHeader(b, h3FrameSettings, uint64(len(settings)))
+	b = append(b, settings...)
+	if _, err := st.WriteContext(ctx, b); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.controlStream = st
+	c.mu.Unlock()
+	return nil
+}
+
+// writeControlFrame writes a frame to our control stream.
+func (c *h3Conn) writeControlFrame(typ uint64, payload []byte) error {
+	c.mu.Lock()
+	st := c.controlStream
+	c.mu.Unlock()
+	if st == nil {
+		return errors.New("http3: control stream not open")
+	}
+	c.controlStreamWrite.Lock()
+	defer c.controlStreamWrite.Unlock()
+	b := h3AppendFrameHeader(nil, typ, uint64(len(payload)))
+	b = append(b, payload...)
+	_, err := st.Write(b)
+	return err
+}
+
+// handleUniStream handles a unidirectional stream created by the peer.
+// https://www.rfc-editor.org/rfc/rfc9114#section-6.2
+func (c *h3Conn) handleUniStream(st *quic.Stream, onGoaway func(id uint64)) {
+	fr := newH3FrameReader(st)
+	typ, err := h3ReadVarint(fr.r)
+	if err != nil {
+		st.CancelRead(h3StreamCreationError)
+		return
+	}
+	var dup *bool
+	switch typ {
+	case h3StreamControl:
+		dup = &c.gotControlStream
+	case h3StreamQPACKEncoder:
+		dup = &c.gotEncoderStream
+	case h3StreamQPACKDecoder:
+		dup = &c.gotDecoderStream
+	case h3StreamPush:
+		// We never send MAX_PUSH_ID, so the server may not push.
+		// https://www.rfc-editor.org/rfc/rfc9114#section-4.6-3
+		c.abort(h3ConnError{h3IDError, "push stream without MAX_PUSH_ID"})
+		return
+	default:
+		// "Recipients of unknown stream types MUST either abort reading
+		// of the stream or discard incoming data without further processing."
+		// https://www.rfc-editor.org/rfc/rfc9114#section-6.2-7
+		st.CancelRead(h3StreamCreationError)
+		return
+	}
+	c.mu.Lock()
+	if *dup {
+		c.mu.Unlock()
+		c.abort(h3ConnError{h3StreamCreationError, "duplicate critical stream"})
+		return
+	}
+	*dup = true
+	c.mu.Unlock()
+
+	if typ != h3StreamControl {
+		// Since the dynamic table capacity is zero, the QPACK encoder and
+		// decoder streams carry no instructions we need to act on.
+		io.Copy(io.Discard, fr.r)
+		return
+	}
+	if err := c.readControlStream(fr, onGoaway); err != nil {
+		c.abort(err)
+	}
+}
+
+// readControlStream reads frames from the peer's control stream.
+// It returns when the connection closes.
+func (c *h3Conn) readControlStream(fr *h3FrameReader, onGoaway func(id uint64)) error {
+	for first := true; ; first = false {
+		typ, length, err := fr.readFrameHeader()
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return h3ConnError{h3ClosedCriticalStream, "control stream closed"}
+			}
+			return err
+		}
+		if first && typ != h3FrameSettings {
+			return h3ConnError{h3MissingSettings, "first control frame is not SETTINGS"}
+		}
+		switch typ {
+		case h3FrameSettings:
+			if !first {
+				return h3ConnError{h3FrameUnexpected, "duplicate SETTINGS frame"}
+			}
+			b, err := fr.readPayload(length, h3MaxSettingsSize)
+			if err != nil {
+				return err
+			}
+			if err := c.handleSettings(b); err != nil {
+				return err
+			}
+		case h3FrameGoaway:
+			b, err := fr.readPayload(length, 8)
+			if err != nil {
+				return err
+			}
+			id, n := h3ConsumeVarint(b)
+			if n != len(b) {
+				return h3ConnError{h3FrameError, "malformed GOAWAY frame"}
+			}
+			onGoaway(id)
+		case h3FrameCancelPush, h3FrameMaxPushID:
+			// We never accept pushes, so there is nothing to cancel.
+			if err := fr.skip(length); err != nil {
+				return err
+			}
+		default:
+			if err := h3UnexpectedFrame(typ); err != nil {
+				return err
+			}
+			if err := fr.skip(length); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleSettings processes the payload of a SETTINGS frame.
+// https://www.rfc-editor.org/rfc/rfc9114#section-7.2.4
+func (c *h3Conn) handleSettings(b []byte) error {
+	seen := make(map[uint64]bool)
+	for len(b) > 0 {
+		id, n := h3ConsumeVarint(b)
+		if n < 0 {
+			return h3ConnError{h3FrameError, "malformed SETTINGS frame"}
+		}
+		b = b[n:]
+		v, n := h3ConsumeVarint(b)
+		if n < 0 {
+			return h3ConnError{h3FrameError, "malformed SETTINGS frame"}
+		}
+		b = b[n:]
+		if seen[id] {
+			return h3ConnError{h3SettingsError, "duplicate setting"}
+		}
+		seen[id] = true
+		switch id {
+		case 0x02, 0x03, 0x04, 0x05:
+			// Reserved settings used in HTTP/2.
+			return h3ConnError{h3SettingsError, fmt.Sprintf("reserved setting %#x", id)}
+		case h3SettingMaxFieldSectionSize:
+			atomic.StoreUint64(&c.peerMaxFieldSectionSize, v)
+		case h3SettingQPACKMaxTableCapacity, h3SettingQPACKBlockedStreams:
+			// The peer's decoder may allow us to use a dynamic table,
+			// but we never do.
+		}
+	}
+	c.mu.Lock()
+	if !c.gotSettings {
+		c.gotSettings = true
+		close(c.settingsc)
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// h3ConsumeVarint parses a variable-length integer at the start of b.
+// It returns the integer and its length in bytes, or -1 on error.
+func h3ConsumeVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, -1
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, -1
+	}
+	v := uint64(b[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
+
+// h3ConnSpecificHeaders are headers which may not appear in HTTP/3 messages.
+// https://www.rfc-editor.org/rfc/rfc9114#section-4.2-4
+var h3ConnSpecificHeaders = map[string]bool{
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// h3AppendHeaderFields appends the fields in h to fields, with lowercased names.
+// Connection-specific headers and headers for which skip returns true are omitted.
+func h3AppendHeaderFields(fields []qpack.HeaderField, h Header, skip func(k string) bool) []qpack.HeaderField {
+	for k, vv := range h {
+		if h3ConnSpecificHeaders[k] || (skip != nil && skip(k)) {
+			continue
+		}
+		if k == "Te" {
+			// The only value of TE permitted is "trailers".
+			for _, v := range vv {
+				if v == "trailers" {
+					fields = append(fields, qpack.HeaderField{Name: "te", Value: "trailers"})
+					break
+				}
+			}
+			continue
+		}
+		name, ok := ascii.ToLower(k)
+		if !ok {
+			// Header names must be ASCII; skip invalid ones.
+			continue
+		}
+		for _, v := range vv {
+			fields = append(fields, qpack.HeaderField{
+				Name:      name,
+				Value:     v,
+				Sensitive: k == "Authorization" || k == "Proxy-Authorization" || k == "Cookie" || k == "Set-Cookie",
+			})
+		}
+	}
+	return fields
+}
+
+// writeHeaders writes a HEADERS frame containing fields to st.
+// It returns an error if the encoded fields exceed the peer's limit.
+func (c *h3Conn) writeHeaders(ctx context.Context, st *quic.Stream, fields []qpack.HeaderField) error {
+	if max := atomic.LoadUint64(&c.peerMaxFieldSectionSize); max > 0 {
+		var size uint64
+		for _, f := range fields {
+			size += f.Size()
+		}
+		if size > max {
+			return errors.New("http3: header list exceeds peer's SETTINGS_MAX_FIELD_SECTION_SIZE")
+		}
+	}
+	section := qpack.AppendFieldSection(nil, fields)
+	b := h3AppendFrameHeader(make([]byte, 0, len(section)+16), h3FrameHeaders, uint64(len(section)))
+	b = append(b, section...)
+	_, err := st.WriteContext(ctx, b)
+	return err
+}
+
+// h3Message holds the decoded contents of a HEADERS frame.
+type h3Message struct {
+	pseudo map[string]string
+	header Header
+}
+
+// h3ValidPseudo lists the pseudo-header fields permitted in requests
+// and responses.
+var h3ValidPseudo = map[string]bool{
+	":method":    true,
+	":scheme":    true,
+	":authority": true,
+	":path":      true,
+	":status":    true,
+}
+
+// readHeaders reads the payload of a HEADERS frame of the given length
+// from fr and decodes it.
+func (c *h3Conn) readHeaders(fr *h3FrameReader, length uint64, trailers bool) (*h3Message, error) {
+	// An encoded field section is never larger than the sum of its
+	// fields' sizes, which include 32 bytes of overhead per field.
+	b, err := fr.readPayload(length, c.maxFieldSectionSize)
+	if err != nil {
+		if ce, ok := err.(h3ConnError); ok && ce.code == h3ExcessiveLoad {
+			return nil, h3StreamError{h3MessageError, "header list too large"}
+		}
+		return nil, err
+	}
+	m := &h3Message{
+		pseudo: make(map[string]string),
+		header: make(Header),
+	}
+	var (
+		size       uint64
+		sawRegular bool
+		cookies    []string
+		msgErr     error
+	)
+	if err := qpack.DecodeFieldSection(b, func(f qpack.HeaderField) {
+		if msgErr != nil {
+			return
+		}
+		size += f.Size()
+		if size > c.maxFieldSectionSize {
+			msgErr = h3StreamError{h3MessageError, "header list too large"}
+			return
+		}
+		if strings.HasPrefix(f.Name, ":") {
+			if trailers || sawRegular || !h3ValidPseudo[f.Name] {
+				msgErr = h3StreamError{h3MessageError, fmt.Sprintf("invalid pseudo-header %q", f.Name)}
+				return
+			}
+			if _, dup := m.pseudo[f.Name]; dup {
+				msgErr = h3StreamError{h3MessageError, fmt.Sprintf("duplicate pseudo-header %q", f.Name)}
+				return
+			}
+			m.pseudo[f.Name] = f.Value
+			return
+		}
+		sawRegular = true
+		if lower, _ := ascii.ToLower(f.Name); !httpguts.ValidHeaderFieldName(f.Name) || lower != f.Name {
+			msgErr = h3StreamError{h3MessageError, fmt.Sprintf("invalid header field name %q", f.Name)}
+			return
+		}
+		if !httpguts.ValidHeaderFieldValue(f.Value) {
+			msgErr = h3StreamError{h3MessageError, fmt.Sprintf("invalid header field value for %q", f.Name)}
+			return
+		}
+		k := textproto.CanonicalMIMEHeaderKey(f.Name)
+		if h3ConnSpecificHeaders[k] || (k == "Te" && f.Value != "trailers") {
+			msgErr = h3StreamError{h3MessageError, fmt.Sprintf("connection-specific header %q", f.Name)}
+			return
+		}
+		if k == "Cookie" {
+			// "If there are multiple field lines with the cookie field name
+			// after decompression, these MUST be concatenated into a single
+			// byte string using the two-byte delimiter of "; "."
+			// https://www.rfc-editor.org/rfc/rfc9114#section-4.2.1-1
+			cookies = append(cookies, f.Value)
+			return
+		}
+		m.header[k] = append(m.header[k], f.Value)
+	}); err != nil {
+		return nil, h3ConnError{qpackDecompressionFailed, err.Error()}
+	}
+	if msgErr != nil {
+		return nil, msgErr
+	}
+	if len(cookies) > 0 {
+		m.header["Cookie"] = []string{strings.Join(cookies, "; ")}
+	}
+	return m, nil
+}
+
+// h3ParseContentLength returns the value of the Content-Length header in h,
+// or -1 if it is absent or invalid.
+func h3ParseContentLength(h Header) int64 {
+	cl := h["Content-Length"]
+	if len(cl) != 1 {
+		return -1
+	}
+	n, err := strconv.ParseUint(cl[0], 10, 63)
+	if err != nil {
+		return -1
+	}
+	return int64(n)
+}
+
+// h3Body is the body of an HTTP/3 request or response.
+type h3Body struct {
+	conn    *h3Conn
+	st      *quic.Stream
+	fr      *h3FrameReader
+	trailer Header // declared trailers; filled in when trailers arrive
+
+	mu       sync.Mutex // guards fields below; not held during reads
+	remain   uint64     // bytes remaining in the current DATA frame
+	read     int64      // total bytes read
+	length   int64      // expected length from Content-Length, or -1
+	err      error      // sticky read error
+	closed   bool
+	onFinish func() // called once, when the body reaches EOF or is closed
+}
+
+func (b *h3Body) Read(p []byte) (n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, errors.New("http: read on closed body")
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	for b.remain == 0 {
+		if err := b.readFrame(); err != nil {
+			b.setErr(err)
+			return 0, b.err
+		}
+	}
+	if uint64(len(p)) > b.remain {
+		p = p[:b.remain]
+	}
+	n, err = b.fr.r.Read(p)
+	b.remain -= uint64(n)
+	b.read += int64(n)
+	if b.length >= 0 && b.read > b.length {
+		b.setErr(h3StreamError{h3MessageError, "body exceeds Content-Length"})
+		return n, b.err
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		b.setErr(err)
+	}
+	return n, err
+}
+
+// readFrame reads the next frame header from the stream, handling
+// trailers and unknown frames.
+func (b *h3Body) readFrame() error {
+	typ, length, err := b.fr.readFrameHeader()
+	if err == io.EOF {
+		if b.length >= 0 && b.read != b.length {
+			return h3StreamError{h3MessageError, "body shorter than Content-Length"}
+		}
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+	switch typ {
+	case h3FrameData:
+		b.remain = length
+		return nil
+	case h3FrameHeaders:
+		m, err := b.conn.readHeaders(b.fr, length, true)
+		if err != nil {
+			return err
+		}
+		for k, vv := range m.header {
+			if b.trailer != nil {
+				b.trailer[k] = vv
+			}
+		}
+		// Trailers end the message.
+		if _, _, err := b.fr.readFrameHeader(); err != io.EOF {
+			if err == nil {
+				err = h3ConnError{h3FrameUnexpected, "frame after trailers"}
+			}
+			return err
+		}
+		return io.EOF
+	}
+	if err := h3UnexpectedFrame(typ); err != nil {
+		return err
+	}
+	return b.fr.skip(length)
+}
+
+func (b *h3Body) setErr(err error) {
+	b.err = err
+	switch e := err.(type) {
+	case h3ConnError:
+		b.conn.abort(e)
+	case h3StreamError:
+		b.st.CancelRead(e.code)
+	}
+	b.finish()
+}
+
+func (b *h3Body) finish() {
+	if f := b.onFinish; f != nil {
+		b.onFinish = nil
+		f()
+	}
+}
+
+// Close closes the body, aborting reads on the stream if it has not been
+// read to completion.
+func (b *h3Body) Close() error {
+	// Abort reads before taking the lock, to unblock any concurrent Read.
+	b.st.CancelRead(h3NoError)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.finish()
+	return nil
+}
+
+// An h3BodyWriter writes DATA frames to a stream.
+type h3BodyWriter struct {
+	ctx context.Context
+	st  *quic.Stream
+	buf []byte
+}
+
+func (w *h3BodyWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.buf = h3AppendFrameHeader(w.buf[:0], h3FrameData, uint64(len(p)))
+	if _, err := w.st.WriteContext(w.ctx, w.buf); err != nil {
+		return 0, err
+	}
+	return w.st.WriteContext(w.ctx, p)
+}
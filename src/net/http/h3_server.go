@@ -0,0 +1,626 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 server implementation.
+
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http/internal/qpack"
+	"net/http/internal/quic"
+	"net/textproto"
+	"net/url"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// h3ServerWriteBufferSize is the amount of response body a handler may
+// write before the response headers are sent.
+const h3ServerWriteBufferSize = 4 << 10
+
+// ServeHTTP3 accepts incoming HTTP/3 connections on the packet connection
+// pc, creating a new service goroutine for each request. The service
+// goroutines read requests and then call srv.Handler to reply to them.
+//
+// Files containing a certificate and matching private key for the server
+// must be provided if neither the Server's TLSConfig.Certificates nor
+// TLSConfig.GetCertificate are populated.
+//
+// While ServeHTTP3 is running, responses sent by srv over TLS on other
+// connections include an Alt-Svc header advertising HTTP/3 on pc's port,
+// unless the handler has set an Alt-Svc header itself.
+// Clients with HTTP/3 enabled use this to upgrade later requests.
+//
+// ServeHTTP3 takes ownership of pc, and closes it before returning.
+// ServeHTTP3 always returns a non-nil error. After Shutdown or Close, the
+// returned error is ErrServerClosed.
+func (srv *Server) ServeHTTP3(pc net.PacketConn, certFile, keyFile string) error {
+	// Set up HTTP/2 before cloning srv.TLSConfig, since doing so
+	// may modify it.
+	if err := srv.setupHTTP2_ServeTLS(); err != nil {
+		pc.Close()
+		return err
+	}
+	config := cloneTLSConfig(srv.TLSConfig)
+	config.NextProtos = []string{nextProtoH3}
+	configHasCert := len(config.Certificates) > 0 || config.GetCertificate != nil
+	if !configHasCert || certFile != "" || keyFile != "" {
+		var err error
+		config.Certificates = make([]tls.Certificate, 1)
+		config.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			pc.Close()
+			return err
+		}
+	}
+
+	e := quic.NewEndpoint(pc, &quic.Config{
+		TLSConfig:      config,
+		MaxIdleTimeout: srv.idleTimeout(),
+	})
+	closeEndpoint := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		e.Close(ctx)
+	}
+	var wg sync.WaitGroup
+	defer func() {
+		if !srv.shuttingDown() {
+			// Connections are drained gracefully only by Shutdown.
+			closeEndpoint()
+		}
+		wg.Wait()
+		closeEndpoint()
+		srv.trackH3Endpoint(e, false)
+	}()
+	if !srv.trackH3Endpoint(e, true) {
+		return ErrServerClosed
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-srv.getDoneChan():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for {
+		qconn, err := e.Accept(ctx)
+		if err != nil {
+			if srv.shuttingDown() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		sc := &h3ServerConn{srv: srv, lastStream: -1}
+		sc.init(qconn, uint64(srv.maxHeaderBytes()))
+		if !srv.trackH3Conn(sc, true) {
+			qconn.Abort(&quic.ApplicationError{Code: h3NoError})
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer srv.trackH3Conn(sc, false)
+			sc.serve()
+		}()
+	}
+}
+
+// ListenAndServeHTTP3 listens on the UDP network address srv.Addr and
+// then calls ServeHTTP3 to handle requests on incoming HTTP/3 connections.
+//
+// Filenames containing a certificate and matching private key for the
+// server must be provided if neither the Server's TLSConfig.Certificates
+// nor TLSConfig.GetCertificate are populated.
+//
+// If srv.Addr is blank, ":https" is used.
+//
+// ListenAndServeHTTP3 always returns a non-nil error. After Shutdown or
+// Close, the returned error is ErrServerClosed.
+func (srv *Server) ListenAndServeHTTP3(certFile, keyFile string) error {
+	if srv.shuttingDown() {
+		return ErrServerClosed
+	}
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":https"
+	}
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.ServeHTTP3(pc, certFile, keyFile)
+}
+
+// trackH3Endpoint adds or removes an HTTP/3 endpoint from the set of
+// tracked endpoints, and updates the Alt-Svc value advertised
+// in responses sent over TLS.
+// It reports whether the server is still up (not Shutdown or Closed).
+func (s *Server) trackH3Endpoint(e *quic.Endpoint, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.h3Endpoints == nil {
+		s.h3Endpoints = make(map[*quic.Endpoint]struct{})
+	}
+	if add {
+		if s.shuttingDown() {
+			return false
+		}
+		s.h3Endpoints[e] = struct{}{}
+	} else {
+		delete(s.h3Endpoints, e)
+	}
+	altSvc := ""
+	for e := range s.h3Endpoints {
+		if addr, ok := e.LocalAddr().(*net.UDPAddr); ok {
+			altSvc = fmt.Sprintf(`%v=":%d"`, nextProtoH3, addr.Port)
+			break
+		}
+	}
+	s.h3AltSvc.Store(altSvc)
+	return true
+}
+
+// trackH3Conn adds or removes an HTTP/3 connection from the set of
+// tracked connections.
+// It reports whether the server is still up (not Shutdown or Closed).
+func (s *Server) trackH3Conn(c *h3ServerConn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.h3Conns == nil {
+		s.h3Conns = make(map[*h3ServerConn]struct{})
+	}
+	if add {
+		if s.shuttingDown() {
+			return false
+		}
+		s.h3Conns[c] = struct{}{}
+	} else {
+		delete(s.h3Conns, c)
+	}
+	return true
+}
+
+// altSvc returns the Alt-Svc header value advertising HTTP/3,
+// or "" if the server is not serving HTTP/3.
+func (s *Server) altSvc() string {
+	v, _ := s.h3AltSvc.Load().(string)
+	return v
+}
+
+// An h3ServerConn is a server-side HTTP/3 connection.
+type h3ServerConn struct {
+	h3Conn
+	srv *Server
+
+	mu         sync.Mutex
+	active     int   // number of requests being handled
+	lastStream int64 // ID of the last request stream accepted, or -1
+	goaway     bool  // GOAWAY has been sent
+}
+
+func (sc *h3ServerConn) serve() {
+	ctx := context.Background()
+	if err := sc.openControlStream(ctx); err != nil {
+		sc.abort(err)
+		return
+	}
+	for {
+		st, err := sc.qconn.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+		if st.IsReadOnly() {
+			go sc.handleUniStream(st, func(uint64) {
+				// The client's GOAWAY limits server pushes, which we never send.
+			})
+			continue
+		}
+		sc.mu.Lock()
+		if sc.goaway {
+			sc.mu.Unlock()
+			// "[...] the server MUST NOT process requests on streams
+			// with IDs greater than or equal to the identifier in GOAWAY."
+			st.CancelRead(h3RequestRejected)
+			st.CancelWrite(h3RequestRejected)
+			continue
+		}
+		sc.active++
+		sc.lastStream = st.ID()
+		sc.mu.Unlock()
+		go sc.serveStream(st)
+	}
+}
+
+// shutdown starts a graceful shutdown of the connection, closing it
+// if it is idle. It reports whether the connection was closed.
+func (sc *h3ServerConn) shutdown() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if !sc.goaway {
+		sc.goaway = true
+		// The GOAWAY frame identifies the first request stream that
+		// will not be processed.
+		// https://www.rfc-editor.org/rfc/rfc9114#section-5.2
+		go sc.writeControlFrame(h3FrameGoaway, h3AppendVarint(nil, uint64(sc.lastStream+4)))
+	}
+	if sc.active > 0 {
+		return false
+	}
+	sc.qconn.Abort(&quic.ApplicationError{Code: h3NoError})
+	return true
+}
+
+func (sc *h3ServerConn) requestDone() {
+	sc.mu.Lock()
+	sc.active--
+	sc.mu.Unlock()
+}
+
+// serveStream handles a request stream.
+func (sc *h3ServerConn) serveStream(st *quic.Stream) {
+	defer sc.requestDone()
+	fr := newH3FrameReader(st)
+	req, err := sc.readRequest(st, fr)
+	if err != nil {
+		sc.streamError(st, err)
+		return
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	req = req.WithContext(ctx)
+	w := &h3ResponseWriter{
+		sc:            sc,
+		st:            st,
+		req:           req,
+		handlerHeader: make(Header),
+		contentLength: -1,
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			if e != ErrAbortHandler {
+				const size = 64 << 10
+				buf := make([]byte, size)
+				buf = buf[:runtime.Stack(buf, false)]
+				sc.srv.logf("http3: panic serving %v: %v\n%s", sc.qconn.RemoteAddr(), e, buf)
+			}
+			st.CancelRead(h3InternalError)
+			st.CancelWrite(h3InternalError)
+			return
+		}
+	}()
+	serverHandler{sc.srv}.ServeHTTP(w, req)
+	w.finishRequest()
+}
+
+// streamError resets a request stream after an error.
+func (sc *h3ServerConn) streamError(st *quic.Stream, err error) {
+	switch e := err.(type) {
+	case h3ConnError:
+		sc.abort(e)
+	case h3StreamError:
+		st.CancelRead(e.code)
+		st.CancelWrite(e.code)
+	default:
+		st.CancelRead(h3RequestIncomplete)
+		st.CancelWrite(h3RequestIncomplete)
+	}
+}
+
+// readRequest reads the request headers from a request stream.
+func (sc *h3ServerConn) readRequest(st *quic.Stream, fr *h3FrameReader) (*Request, error) {
+	var m *h3Message
+	for m == nil {
+		typ, length, err := fr.readFrameHeader()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case h3FrameHeaders:
+			if m, err = sc.readHeaders(fr, length, false); err != nil {
+				return nil, err
+			}
+		default:
+			if err := h3UnexpectedFrame(typ); err != nil {
+				return nil, err
+			}
+			if err := fr.skip(length); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// https://www.rfc-editor.org/rfc/rfc9114#section-4.3.1
+	method := m.pseudo[":method"]
+	scheme := m.pseudo[":scheme"]
+	authority := m.pseudo[":authority"]
+	reqPath := m.pseudo[":path"]
+	if _, ok := m.pseudo[":status"]; ok {
+		return nil, h3StreamError{h3MessageError, "request contains :status"}
+	}
+	if !validMethod(method) {
+		return nil, h3StreamError{h3MessageError, "invalid :method"}
+	}
+	var (
+		u          *url.URL
+		requestURI string
+		err        error
+	)
+	if method == "CONNECT" {
+		if scheme != "" || reqPath != "" || authority == "" {
+			return nil, h3StreamError{h3MessageError, "invalid CONNECT request"}
+		}
+		u = &url.URL{Host: authority}
+		requestURI = authority
+	} else {
+		if scheme == "" || reqPath == "" {
+			return nil, h3StreamError{h3MessageError, "missing :scheme or :path"}
+		}
+		if u, err = url.ParseRequestURI(reqPath); err != nil {
+			return nil, h3StreamError{h3MessageError, "invalid :path"}
+		}
+		requestURI = reqPath
+	}
+	if authority == "" {
+		authority = m.header.Get("Host")
+	}
+
+	var trailer Header
+	for _, v := range m.header["Trailer"] {
+		for _, key := range strings.Split(v, ",") {
+			key = CanonicalHeaderKey(textproto.TrimString(key))
+			switch key {
+			case "Transfer-Encoding", "Trailer", "Content-Length":
+				// Bogus. (copy of http1 rules)
+				// Ignore.
+			default:
+				if trailer == nil {
+					trailer = make(Header)
+				}
+				trailer[key] = nil
+			}
+		}
+	}
+	delete(m.header, "Trailer")
+
+	cs := sc.qconn.ConnectionState()
+	ctx := context.WithValue(context.Background(), ServerContextKey, sc.srv)
+	ctx = context.WithValue(ctx, LocalAddrContextKey, sc.qconn.LocalAddr())
+	req := &Request{
+		Method:        method,
+		URL:           u,
+		RemoteAddr:    sc.qconn.RemoteAddr().String(),
+		Header:        m.header,
+		RequestURI:    requestURI,
+		Proto:         "HTTP/3.0",
+		ProtoMajor:    3,
+		ProtoMinor:    0,
+		TLS:           &cs,
+		Host:          authority,
+		Trailer:       trailer,
+		ContentLength: h3ParseContentLength(m.header),
+		ctx:           ctx,
+	}
+	req.Body = &h3Body{
+		conn:    &sc.h3Conn,
+		st:      st,
+		fr:      fr,
+		trailer: trailer,
+		length:  req.ContentLength,
+	}
+	return req, nil
+}
+
+// h3ResponseWriter implements ResponseWriter for HTTP/3 requests.
+type h3ResponseWriter struct {
+	sc  *h3ServerConn
+	st  *quic.Stream
+	req *Request
+
+	handlerHeader Header
+	status        int      // status passed to WriteHeader, or 0
+	sentHeader    bool     // HEADERS frame has been sent
+	trailers      []string // trailers declared before the headers were sent
+	buf           []byte   // body bytes not yet sent
+	written       int64    // body bytes written by the handler
+	contentLength int64    // Content-Length set by the handler, or -1
+	handlerDone   bool
+	err           error // sticky write error
+}
+
+func (w *h3ResponseWriter) Header() Header {
+	return w.handlerHeader
+}
+
+func (w *h3ResponseWriter) WriteHeader(code int) {
+	checkWriteHeaderCode(code)
+	if w.status != 0 || w.handlerDone {
+		caller := relevantCaller()
+		w.sc.srv.logf("http: superfluous response.WriteHeader call from %s (%s:%d)", caller.Function, path.Base(caller.File), caller.Line)
+		return
+	}
+	if code >= 100 && code <= 199 && code != StatusSwitchingProtocols {
+		// Informational responses are sent immediately.
+		fields := []qpack.HeaderField{{Name: ":status", Value: strconv.Itoa(code)}}
+		fields = h3AppendHeaderFields(fields, w.handlerHeader, nil)
+		if err := w.sc.writeHeaders(w.req.Context(), w.st, fields); err != nil && w.err == nil {
+			w.err = err
+		}
+		return
+	}
+	w.status = code
+	if cl := w.handlerHeader.get("Content-Length"); cl != "" {
+		if v, err := strconv.ParseInt(cl, 10, 64); err == nil && v >= 0 {
+			w.contentLength = v
+		} else {
+			w.sc.srv.logf("http: invalid Content-Length of %q", cl)
+			w.handlerHeader.Del("Content-Length")
+		}
+	}
+}
+
+func (w *h3ResponseWriter) Write(p []byte) (int, error) {
+	return w.write(len(p), p, "")
+}
+
+func (w *h3ResponseWriter) WriteString(s string) (int, error) {
+	return w.write(len(s), nil, s)
+}
+
+// write writes either p or s to the response body.
+func (w *h3ResponseWriter) write(n int, p []byte, s string) (int, error) {
+	if w.handlerDone {
+		return 0, ErrHandlerTimeout
+	}
+	if w.status == 0 {
+		w.WriteHeader(StatusOK)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if !bodyAllowedForStatus(w.status) {
+		return 0, ErrBodyNotAllowed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.contentLength != -1 && w.written+int64(n) > w.contentLength {
+		return 0, ErrContentLength
+	}
+	w.written += int64(n)
+	if w.req.Method == "HEAD" {
+		return n, nil
+	}
+	if p != nil {
+		w.buf = append(w.buf, p...)
+	} else {
+		w.buf = append(w.buf, s...)
+	}
+	if len(w.buf) >= h3ServerWriteBufferSize {
+		if err := w.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Flush sends any buffered data to the client.
+func (w *h3ResponseWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(StatusOK)
+	}
+	w.flush()
+}
+
+func (w *h3ResponseWriter) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if !w.sentHeader {
+		if w.err = w.writeResponseHeader(); w.err != nil {
+			return w.err
+		}
+	}
+	if len(w.buf) > 0 {
+		bw := &h3BodyWriter{ctx: w.req.Context(), st: w.st}
+		if _, w.err = bw.Write(w.buf); w.err != nil {
+			return w.err
+		}
+		w.buf = w.buf[:0]
+	}
+	return nil
+}
+
+// writeResponseHeader sends the response HEADERS frame.
+func (w *h3ResponseWriter) writeResponseHeader() error {
+	w.sentHeader = true
+	h := w.handlerHeader
+	if h.get("Date") == "" {
+		h.Set("Date", string(appendTime(nil, time.Now())))
+	}
+	bodyAllowed := bodyAllowedForStatus(w.status)
+	if bodyAllowed && h.get("Content-Type") == "" && len(w.buf) > 0 {
+		if _, haveType := h["Content-Type"]; !haveType {
+			h.Set("Content-Type", DetectContentType(w.buf))
+		}
+	}
+	if w.handlerDone && bodyAllowed && h.get("Content-Length") == "" && (w.req.Method != "HEAD" || w.written > 0) {
+		// The handler finished without setting Content-Length,
+		// so we know the full length of the body.
+		h.Set("Content-Length", strconv.FormatInt(w.written, 10))
+	}
+	for _, v := range h["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			if k = CanonicalHeaderKey(textproto.TrimString(k)); k != "" {
+				w.trailers = append(w.trailers, k)
+			}
+		}
+	}
+	fields := []qpack.HeaderField{{Name: ":status", Value: strconv.Itoa(w.status)}}
+	fields = h3AppendHeaderFields(fields, h, func(k string) bool {
+		return strings.HasPrefix(k, TrailerPrefix)
+	})
+	return w.sc.writeHeaders(w.req.Context(), w.st, fields)
+}
+
+// finishRequest completes the response after the handler returns.
+func (w *h3ResponseWriter) finishRequest() {
+	if w.status == 0 {
+		w.WriteHeader(StatusOK)
+	}
+	w.handlerDone = true
+	if w.flush() != nil {
+		w.st.CancelWrite(h3InternalError)
+		w.req.Body.Close()
+		return
+	}
+	if w.contentLength != -1 && w.written < w.contentLength && w.req.Method != "HEAD" {
+		// The handler wrote less than the declared Content-Length.
+		w.st.CancelWrite(h3InternalError)
+		w.req.Body.Close()
+		return
+	}
+	trailers := w.trailerFields()
+	if len(trailers) > 0 {
+		if err := w.sc.writeHeaders(w.req.Context(), w.st, trailers); err != nil {
+			w.st.CancelWrite(h3InternalError)
+			w.req.Body.Close()
+			return
+		}
+	}
+	w.st.CloseWrite()
+	// "[...] a server can send a complete response prior to the client
+	// sending an entire request if the response does not depend on any
+	// portion of the request that has not been sent and received."
+	// Abort reading the rest of the request, if any.
+	// https://www.rfc-editor.org/rfc/rfc9114#section-4.1-15
+	w.req.Body.Close()
+}
+
+// trailerFields returns the response trailers.
+func (w *h3ResponseWriter) trailerFields() []qpack.HeaderField {
+	trailer := make(Header)
+	for _, k := range w.trailers {
+		if vv, ok := w.handlerHeader[k]; ok {
+			trailer[k] = vv
+		}
+	}
+	for k, vv := range w.handlerHeader {
+		if strings.HasPrefix(k, TrailerPrefix) {
+			trailer[CanonicalHeaderKey(strings.TrimPrefix(k, TrailerPrefix))] = vv
+		}
+	}
+	return h3AppendHeaderFields(nil, trailer, nil)
+}
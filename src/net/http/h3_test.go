@@ -0,0 +1,282 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Tests for HTTP/3, over QUIC on the loopback interface.
+
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	. "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newH3Server starts an httptest server with HTTP/3 enabled,
+// and returns it along with a client which has already upgraded
+// to HTTP/3 using the server's Alt-Svc advertisement.
+func newH3Server(t *testing.T, h Handler) (*httptest.Server, *Client) {
+	ts := httptest.NewUnstartedServer(h)
+	ts.EnableHTTP3 = true
+	ts.Config.ErrorLog = quietLog
+	ts.StartTLS()
+	c := ts.Client()
+
+	res, err := c.Get(ts.URL)
+	if err != nil {
+		ts.Close()
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.ProtoMajor == 3 {
+		ts.Close()
+		t.Fatalf("first request used %v, want a TCP protocol", res.Proto)
+	}
+	if !strings.HasPrefix(res.Header.Get("Alt-Svc"), `h3=":`) {
+		ts.Close()
+		t.Fatalf("Alt-Svc = %q, want h3 advertisement", res.Header.Get("Alt-Svc"))
+	}
+	return ts, c
+}
+
+func TestHTTP3AltSvcUpgrade(t *testing.T) {
+	defer afterTest(t)
+	ts, c := newH3Server(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("X-Proto", r.Proto)
+		fmt.Fprintf(w, "Hello, %v", r.URL.Path)
+	}))
+	defer ts.Close()
+	for i := 0; i < 3; i++ {
+		res, err := c.Get(ts.URL + "/path")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Proto != "HTTP/3.0" || res.ProtoMajor != 3 {
+			t.Errorf("response Proto = %q, want HTTP/3.0", res.Proto)
+		}
+		if got := res.Header.Get("X-Proto"); got != "HTTP/3.0" {
+			t.Errorf("request Proto = %q, want HTTP/3.0", got)
+		}
+		if got, want := string(body), "Hello, /path"; got != want {
+			t.Errorf("body = %q, want %q", got, want)
+		}
+		if res.TLS == nil || res.TLS.NegotiatedProtocol != "h3" {
+			t.Errorf("res.TLS = %+v, want NegotiatedProtocol h3", res.TLS)
+		}
+		if got, want := res.ContentLength, int64(len(body)); got != want {
+			t.Errorf("ContentLength = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestHTTP3RequestBody(t *testing.T) {
+	defer afterTest(t)
+	ts, c := newH3Server(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor != 3 {
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading request body: %v", err)
+		}
+		fmt.Fprintf(w, "%v %v %v", r.Method, r.ContentLength, len(body))
+		w.Write(body)
+	}))
+	defer ts.Close()
+	for _, size := range []int{0, 1, 1 << 10, 256 << 10} {
+		body := strings.Repeat("a", size)
+		res, err := c.Post(ts.URL, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("POST %v %v%v", size, size, body); string(got) != want {
+			t.Errorf("size %v: response body mismatch (len %v, want %v)", size, len(got), len(want))
+		}
+	}
+}
+
+func TestHTTP3HeadersAndTrailers(t *testing.T) {
+	defer afterTest(t)
+	ts, c := newH3Server(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor != 3 {
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Trailer", "Server-Trailer")
+		w.Header().Set("X-Request-Header", r.Header.Get("X-Request-Header"))
+		w.Header().Set("X-Request-Trailer", r.Trailer.Get("Client-Trailer"))
+		w.Header().Add("X-Multi", "a")
+		w.Header().Add("X-Multi", "b")
+		w.WriteHeader(StatusTeapot)
+		io.WriteString(w, "body")
+		w.Header().Set("Server-Trailer", "server value")
+		w.Header().Set(TrailerPrefix+"Undeclared-Trailer", "undeclared value")
+	}))
+	defer ts.Close()
+	req, err := NewRequest("PUT", ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-Header", "header value")
+	req.Trailer = Header{"Client-Trailer": nil}
+	req.Body = io.NopCloser(readerFunc(func(p []byte) (int, error) {
+		req.Trailer.Set("Client-Trailer", "client value")
+		return 0, io.EOF
+	}))
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != StatusTeapot {
+		t.Errorf("StatusCode = %v, want %v", res.StatusCode, StatusTeapot)
+	}
+	if got, want := res.Header.Get("X-Request-Header"), "header value"; got != want {
+		t.Errorf("X-Request-Header = %q, want %q", got, want)
+	}
+	if got, want := res.Header.Get("X-Request-Trailer"), "client value"; got != want {
+		t.Errorf("X-Request-Trailer = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(res.Header["X-Multi"], ","), "a,b"; got != want {
+		t.Errorf("X-Multi = %q, want %q", got, want)
+	}
+	if _, ok := res.Trailer["Server-Trailer"]; !ok {
+		t.Errorf("Trailer = %v, want Server-Trailer declared", res.Trailer)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "body" {
+		t.Errorf("body = %q, want %q", body, "body")
+	}
+	want := Header{
+		"Server-Trailer":     {"server value"},
+		"Undeclared-Trailer": {"undeclared value"},
+	}
+	if got := res.Trailer; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Trailer = %v, want %v", got, want)
+	}
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestHTTP3Head(t *testing.T) {
+	defer afterTest(t)
+	ts, c := newH3Server(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "body")
+	}))
+	defer ts.Close()
+	res, err := c.Head(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.ProtoMajor != 3 {
+		t.Fatalf("Proto = %v, want HTTP/3.0", res.Proto)
+	}
+	if res.Body != NoBody {
+		t.Errorf("Body = %v, want NoBody", res.Body)
+	}
+	if got, want := res.ContentLength, int64(4); got != want {
+		t.Errorf("ContentLength = %v, want %v", got, want)
+	}
+}
+
+func TestHTTP3CancelRequest(t *testing.T) {
+	defer afterTest(t)
+	unblock := make(chan struct{})
+	ts, c := newH3Server(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor != 3 {
+			return
+		}
+		w.(Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-unblock:
+		}
+	}))
+	defer ts.Close()
+	defer close(unblock)
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := NewRequestWithContext(ctx, "GET", ts.URL, nil)
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ProtoMajor != 3 {
+		t.Fatalf("Proto = %v, want HTTP/3.0", res.Proto)
+	}
+	cancel()
+	if _, err := io.ReadAll(res.Body); err == nil {
+		t.Errorf("reading body of canceled request: got nil error, want error")
+	}
+	res.Body.Close()
+}
+
+func TestHTTP3ServerShutdown(t *testing.T) {
+	defer afterTest(t)
+	handlerStarted := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	ts, c := newH3Server(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor != 3 {
+			return
+		}
+		handlerStarted <- struct{}{}
+		<-unblock
+		io.WriteString(w, "done")
+	}))
+	defer ts.Close()
+
+	resc := make(chan string, 1)
+	go func() {
+		res, err := c.Get(ts.URL)
+		if err != nil {
+			resc <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			resc <- err.Error()
+			return
+		}
+		resc <- string(body)
+	}()
+	<-handlerStarted
+
+	shutdownc := make(chan error, 1)
+	go func() {
+		shutdownc <- ts.Config.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-shutdownc:
+		t.Fatalf("Shutdown returned with a request in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(unblock)
+	if got := <-resc; got != "done" {
+		t.Errorf("in-flight request got %q, want %q", got, "done")
+	}
+	if err := <-shutdownc; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
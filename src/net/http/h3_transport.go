@@ -0,0 +1,737 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 client implementation.
+
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/internal/ascii"
+	"net/http/internal/qpack"
+	"net/http/internal/quic"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// h3DefaultUserAgent is the User-Agent sent with HTTP/3 requests
+// which do not set one.
+const h3DefaultUserAgent = "Go-http-client/3"
+
+// h3DefaultDialTimeout bounds the QUIC handshake when the Transport
+// has no TLSHandshakeTimeout.
+const h3DefaultDialTimeout = 10 * time.Second
+
+// h3Transport holds a Transport's HTTP/3 state.
+type h3Transport struct {
+	mu       sync.Mutex
+	endpoint *quic.Endpoint           // created on first use
+	altSvc   map[string]h3AltSvcEntry // by origin host:port
+	conns    map[string]*h3ClientConn // by h3ConnKey
+	live     map[*h3ClientConn]bool   // all open connections, including draining ones
+	dials    map[string]*h3DialCall   // in-progress dials, by h3ConnKey
+}
+
+// An h3AltSvcEntry is a cached HTTP/3 alternative service for an origin.
+type h3AltSvcEntry struct {
+	addr    string // host:port to connect to
+	expires time.Time
+}
+
+// An h3DialCall is an in-progress HTTP/3 connection attempt.
+type h3DialCall struct {
+	done chan struct{}
+	cc   *h3ClientConn
+	err  error
+}
+
+// h3RoundTrip sends req over HTTP/3 if the request's origin has
+// advertised HTTP/3 support. It reports whether HTTP/3 was used;
+// if not, the request has not been sent, and may be sent over TCP.
+func (t *Transport) h3RoundTrip(req *Request) (resp *Response, used bool, err error) {
+	if req.URL.Scheme != "https" || req.URL.Host == "" || req.requiresHTTP1() {
+		return nil, false, nil
+	}
+	if req.Method != "" && !validMethod(req.Method) {
+		return nil, false, nil
+	}
+	origin := canonicalAddr(req.URL)
+	addr, ok := t.h3.lookupAltSvc(origin)
+	if !ok {
+		return nil, false, nil
+	}
+	if t.Proxy != nil {
+		// QUIC cannot be sent through an HTTP proxy.
+		if u, err := t.Proxy(req); err != nil || u != nil {
+			return nil, false, nil
+		}
+	}
+	ctx := req.Context()
+	cc, err := t.h3.getConn(ctx, t, addr, req.URL.Hostname())
+	if err != nil {
+		if ctx.Err() != nil {
+			req.closeBody()
+			return nil, true, ctx.Err()
+		}
+		// The alternative service is unusable, so forget it
+		// and fall back to TCP.
+		t.h3.forgetAltSvc(origin)
+		return nil, false, nil
+	}
+	resp, err = cc.roundTrip(req)
+	return resp, true, err
+}
+
+// lookupAltSvc returns the address of the HTTP/3 alternative service
+// for an origin, if any.
+func (h *h3Transport) lookupAltSvc(origin string) (addr string, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e, ok := h.altSvc[origin]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(e.expires) {
+		delete(h.altSvc, origin)
+		return "", false
+	}
+	return e.addr, true
+}
+
+func (h *h3Transport) forgetAltSvc(origin string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.altSvc, origin)
+}
+
+// noteAltSvc records the HTTP/3 alternative service advertised
+// in the Alt-Svc header of a response received over TCP.
+// https://www.rfc-editor.org/rfc/rfc7838#section-3
+func (h *h3Transport) noteAltSvc(req *Request, resp *Response) {
+	if req.URL.Scheme != "https" || resp.TLS == nil {
+		// Alternative services are only trusted when advertised
+		// over an authenticated connection.
+		return
+	}
+	vv := resp.Header["Alt-Svc"]
+	if len(vv) == 0 {
+		return
+	}
+	origin := canonicalAddr(req.URL)
+	alts, clear := parseAltSvc(strings.Join(vv, ","))
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Each Alt-Svc header replaces any alternatives previously
+	// advertised for the origin.
+	delete(h.altSvc, origin)
+	if clear {
+		return
+	}
+	for _, alt := range alts {
+		if alt.proto != nextProtoH3 {
+			continue
+		}
+		host := alt.host
+		if host == "" {
+			host = req.URL.Hostname()
+		}
+		if h.altSvc == nil {
+			h.altSvc = make(map[string]h3AltSvcEntry)
+		}
+		h.altSvc[origin] = h3AltSvcEntry{
+			addr:    net.JoinHostPort(host, alt.port),
+			expires: time.Now().Add(alt.maxAge),
+		}
+		return
+	}
+}
+
+// h3ConnKey returns the key identifying connections to addr
+// authenticated with serverName.
+func h3ConnKey(addr, serverName string) string {
+	return addr + "|" + serverName
+}
+
+// getConn returns a connection to addr with a reserved request slot,
+// dialing a new connection if necessary.
+func (h *h3Transport) getConn(ctx context.Context, t *Transport, addr, serverName string) (*h3ClientConn, error) {
+	key := h3ConnKey(addr, serverName)
+	h.mu.Lock()
+	if cc := h.conns[key]; cc != nil && cc.reserve() {
+		h.mu.Unlock()
+		return cc, nil
+	}
+	call := h.dials[key]
+	if call == nil {
+		call = &h3DialCall{done: make(chan struct{})}
+		if h.dials == nil {
+			h.dials = make(map[string]*h3DialCall)
+		}
+		h.dials[key] = call
+		go h.dial(t, key, addr, serverName, call)
+	}
+	h.mu.Unlock()
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	if !call.cc.reserve() {
+		return nil, errors.New("http3: connection closed")
+	}
+	return call.cc, nil
+}
+
+// dial creates a new HTTP/3 connection.
+// It is not bound to any one request's context,
+// since other requests may wait for it as well.
+func (h *h3Transport) dial(t *Transport, key, addr, serverName string, call *h3DialCall) {
+	defer close(call.done)
+	call.cc, call.err = h.dialConn(t, key, addr, serverName)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.dials, key)
+	if call.err == nil {
+		if h.conns == nil {
+			h.conns = make(map[string]*h3ClientConn)
+		}
+		h.conns[key] = call.cc
+		if h.live == nil {
+			h.live = make(map[*h3ClientConn]bool)
+		}
+		h.live[call.cc] = true
+	}
+}
+
+func (h *h3Transport) dialConn(t *Transport, key, addr, serverName string) (*h3ClientConn, error) {
+	e, err := h.getEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	timeout := t.TLSHandshakeTimeout
+	if timeout <= 0 {
+		timeout = h3DefaultDialTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	config := cloneTLSConfig(t.TLSClientConfig)
+	if config.ServerName == "" {
+		config.ServerName = serverName
+	}
+	config.NextProtos = []string{nextProtoH3}
+	qconn, err := e.Dial(ctx, "udp", addr, &quic.Config{
+		TLSConfig:      config,
+		MaxIdleTimeout: t.IdleConnTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	maxHeaderBytes := t.MaxResponseHeaderBytes
+	if maxHeaderBytes <= 0 {
+		maxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	cc := &h3ClientConn{t: h, key: key}
+	cc.init(qconn, uint64(maxHeaderBytes))
+	if err := cc.openControlStream(ctx); err != nil {
+		qconn.Abort(nil)
+		return nil, err
+	}
+	go cc.run()
+	return cc, nil
+}
+
+// getEndpoint returns the QUIC endpoint used for outbound connections.
+func (h *h3Transport) getEndpoint() (*quic.Endpoint, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.endpoint == nil {
+		pc, err := net.ListenPacket("udp", ":0")
+		if err != nil {
+			return nil, err
+		}
+		h.endpoint = quic.NewEndpoint(pc, nil)
+	}
+	return h.endpoint, nil
+}
+
+// removeConn stops using cc for new requests.
+// If closed is set, cc is no longer open.
+func (h *h3Transport) removeConn(cc *h3ClientConn, closed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conns[cc.key] == cc {
+		delete(h.conns, cc.key)
+	}
+	if closed {
+		delete(h.live, cc)
+	}
+}
+
+// closeIdleConns closes connections with no requests in flight.
+// If no connections remain, it also closes the endpoint.
+func (h *h3Transport) closeIdleConns() {
+	h.mu.Lock()
+	for cc := range h.live {
+		if cc.closeIfIdle() {
+			if h.conns[cc.key] == cc {
+				delete(h.conns, cc.key)
+			}
+			delete(h.live, cc)
+		}
+	}
+	var e *quic.Endpoint
+	if len(h.live) == 0 && len(h.dials) == 0 {
+		e, h.endpoint = h.endpoint, nil
+	}
+	h.mu.Unlock()
+	if e != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		e.Close(ctx)
+	}
+}
+
+// An h3ClientConn is a client-side HTTP/3 connection.
+type h3ClientConn struct {
+	h3Conn
+	t   *h3Transport
+	key string
+
+	mu      sync.Mutex
+	streams int  // number of requests in flight
+	goaway  bool // the server has sent GOAWAY
+	closed  bool
+}
+
+// run handles streams created by the server.
+func (cc *h3ClientConn) run() {
+	defer cc.t.removeConn(cc, true)
+	for {
+		st, err := cc.qconn.AcceptStream(context.Background())
+		if err != nil {
+			cc.mu.Lock()
+			cc.closed = true
+			cc.mu.Unlock()
+			return
+		}
+		if !st.IsReadOnly() {
+			// "Clients MUST treat receipt of a server-initiated
+			// bidirectional stream as a connection error of type
+			// H3_STREAM_CREATION_ERROR [...]"
+			// https://www.rfc-editor.org/rfc/rfc9114#section-6.1-3
+			cc.abort(h3ConnError{h3StreamCreationError, "server-initiated bidirectional stream"})
+			continue
+		}
+		go cc.handleUniStream(st, cc.handleGoaway)
+	}
+}
+
+// handleGoaway handles a GOAWAY frame from the server.
+func (cc *h3ClientConn) handleGoaway(id uint64) {
+	cc.mu.Lock()
+	cc.goaway = true
+	cc.mu.Unlock()
+	cc.t.removeConn(cc, false)
+}
+
+// reserve reserves a slot for a new request,
+// reporting false if the connection cannot accept new requests.
+func (cc *h3ClientConn) reserve() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.goaway || cc.closed {
+		return false
+	}
+	select {
+	case <-cc.qconn.Done():
+		return false
+	default:
+	}
+	cc.streams++
+	return true
+}
+
+func (cc *h3ClientConn) release() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.streams--
+}
+
+func (cc *h3ClientConn) closeIfIdle() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.streams > 0 {
+		return false
+	}
+	cc.closed = true
+	cc.qconn.Abort(&quic.ApplicationError{Code: h3NoError})
+	return true
+}
+
+// roundTrip sends a request on the connection, using a slot
+// previously reserved with reserve.
+func (cc *h3ClientConn) roundTrip(req *Request) (*Response, error) {
+	ctx := req.Context()
+	fields, err := cc.encodeRequestHeaders(req)
+	if err != nil {
+		cc.release()
+		req.closeBody()
+		return nil, err
+	}
+	st, err := cc.qconn.NewStream(ctx)
+	if err != nil {
+		cc.release()
+		req.closeBody()
+		return nil, err
+	}
+	if err := cc.writeHeaders(ctx, st, fields); err != nil {
+		st.CancelRead(h3RequestCancelled)
+		st.CancelWrite(h3RequestCancelled)
+		cc.release()
+		req.closeBody()
+		return nil, err
+	}
+	go cc.writeRequestBody(ctx, st, req)
+
+	// Abort the stream if the request is canceled before
+	// the response body has been consumed.
+	var once sync.Once
+	donec := make(chan struct{})
+	done := func() {
+		once.Do(func() {
+			close(donec)
+			cc.release()
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			st.CancelRead(h3RequestCancelled)
+			st.CancelWrite(h3RequestCancelled)
+		case <-donec:
+		}
+	}()
+
+	resp, err := cc.readResponse(st, req, done)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		st.CancelRead(h3RequestCancelled)
+		st.CancelWrite(h3RequestCancelled)
+		done()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// encodeRequestHeaders returns the header fields for req.
+// https://www.rfc-editor.org/rfc/rfc9114#section-4.3.1
+func (cc *h3ClientConn) encodeRequestHeaders(req *Request) ([]qpack.HeaderField, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host, err := httpguts.PunycodeHostPort(host)
+	if err != nil {
+		return nil, err
+	}
+	method := valueOrDefault(req.Method, "GET")
+	fields := []qpack.HeaderField{{Name: ":method", Value: method}}
+	if method == "CONNECT" {
+		fields = append(fields, qpack.HeaderField{Name: ":authority", Value: host})
+	} else {
+		path := req.URL.RequestURI()
+		if !validPseudoPath(path) {
+			return nil, fmt.Errorf("http3: invalid request :path %q", path)
+		}
+		fields = append(fields,
+			qpack.HeaderField{Name: ":scheme", Value: "https"},
+			qpack.HeaderField{Name: ":authority", Value: host},
+			qpack.HeaderField{Name: ":path", Value: path},
+		)
+	}
+	fields = h3AppendHeaderFields(fields, req.Header, func(k string) bool {
+		switch k {
+		case "Host", "Content-Length", "User-Agent", "Trailer":
+			return true
+		}
+		return false
+	})
+	userAgent := h3DefaultUserAgent
+	if vv, ok := req.Header["User-Agent"]; ok {
+		userAgent = ""
+		if len(vv) > 0 {
+			userAgent = vv[0]
+		}
+	}
+	if userAgent != "" {
+		fields = append(fields, qpack.HeaderField{Name: "user-agent", Value: userAgent})
+	}
+	if cl := req.outgoingLength(); cl > 0 || (cl == 0 && !requestMethodUsuallyLacksBody(method) && method != "CONNECT") {
+		fields = append(fields, qpack.HeaderField{Name: "content-length", Value: strconv.FormatInt(cl, 10)})
+	}
+	if len(req.Trailer) > 0 {
+		keys := make([]string, 0, len(req.Trailer))
+		for k := range req.Trailer {
+			k = CanonicalHeaderKey(k)
+			switch k {
+			case "Transfer-Encoding", "Trailer", "Content-Length":
+				return nil, fmt.Errorf("http3: invalid Trailer key %q", k)
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fields = append(fields, qpack.HeaderField{Name: "trailer", Value: strings.Join(keys, ",")})
+	}
+	return fields, nil
+}
+
+// validPseudoPath reports whether v is a valid :path pseudo-header value.
+func validPseudoPath(v string) bool {
+	return (len(v) > 0 && v[0] == '/') || v == "*"
+}
+
+// writeRequestBody sends the request body and trailers, and closes
+// the write side of the stream.
+func (cc *h3ClientConn) writeRequestBody(ctx context.Context, st *quic.Stream, req *Request) {
+	if req.Body == nil || req.Body == NoBody {
+		st.CloseWrite()
+		return
+	}
+	defer req.closeBody()
+	n, err := io.Copy(&h3BodyWriter{ctx: ctx, st: st}, req.Body)
+	if err == nil && req.ContentLength > 0 && n != req.ContentLength {
+		err = fmt.Errorf("http3: request body length %v does not match ContentLength %v", n, req.ContentLength)
+	}
+	if err == nil && len(req.Trailer) > 0 {
+		if trailers := h3AppendHeaderFields(nil, req.Trailer, nil); len(trailers) > 0 {
+			err = cc.writeHeaders(ctx, st, trailers)
+		}
+	}
+	if err != nil {
+		st.CancelWrite(h3RequestCancelled)
+		return
+	}
+	st.CloseWrite()
+}
+
+// readResponse reads the response headers from a request stream.
+// It calls done when the response body has been consumed.
+func (cc *h3ClientConn) readResponse(st *quic.Stream, req *Request, done func()) (*Response, error) {
+	fr := newH3FrameReader(st)
+	for {
+		typ, length, err := fr.readFrameHeader()
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("http3: server closed stream before sending response")
+			}
+			return nil, err
+		}
+		if typ != h3FrameHeaders {
+			if err := h3UnexpectedFrame(typ); err != nil {
+				cc.abort(err)
+				return nil, err
+			}
+			if err := fr.skip(length); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		m, err := cc.readHeaders(fr, length, false)
+		if err != nil {
+			if _, ok := err.(h3ConnError); ok {
+				cc.abort(err)
+			}
+			return nil, err
+		}
+		status, ok := m.pseudo[":status"]
+		if !ok || len(m.pseudo) != 1 || len(status) != 3 {
+			return nil, h3StreamError{h3MessageError, "malformed response pseudo-headers"}
+		}
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 100 {
+			return nil, h3StreamError{h3MessageError, fmt.Sprintf("invalid :status %q", status)}
+		}
+		if code < 200 {
+			if code == StatusSwitchingProtocols {
+				return nil, h3StreamError{h3MessageError, "101 Switching Protocols in HTTP/3"}
+			}
+			// Skip informational responses.
+			continue
+		}
+		return cc.newResponse(st, fr, req, code, m, done), nil
+	}
+}
+
+func (cc *h3ClientConn) newResponse(st *quic.Stream, fr *h3FrameReader, req *Request, code int, m *h3Message, done func()) *Response {
+	cs := cc.qconn.ConnectionState()
+	resp := &Response{
+		Status:        strconv.Itoa(code) + " " + StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/3.0",
+		ProtoMajor:    3,
+		Header:        m.header,
+		ContentLength: h3ParseContentLength(m.header),
+		Request:       req,
+		TLS:           &cs,
+	}
+	for _, v := range m.header["Trailer"] {
+		for _, key := range strings.Split(v, ",") {
+			if key = CanonicalHeaderKey(textproto.TrimString(key)); key != "" {
+				if resp.Trailer == nil {
+					resp.Trailer = make(Header)
+				}
+				resp.Trailer[key] = nil
+			}
+		}
+	}
+	if req.Method == "HEAD" || !bodyAllowedForStatus(code) {
+		resp.Body = NoBody
+		st.CancelRead(h3NoError)
+		done()
+		return resp
+	}
+	resp.Body = &h3Body{
+		conn:     &cc.h3Conn,
+		st:       st,
+		fr:       fr,
+		trailer:  resp.Trailer,
+		length:   resp.ContentLength,
+		onFinish: done,
+	}
+	return resp
+}
+
+// An altSvc is an alternative service advertised in an Alt-Svc header.
+type altSvc struct {
+	proto  string        // ALPN protocol ID
+	host   string        // host, or "" for the origin's host
+	port   string        // port
+	maxAge time.Duration // freshness lifetime
+}
+
+// altSvcDefaultMaxAge is the default freshness lifetime of an alternative service.
+// https://www.rfc-editor.org/rfc/rfc7838#section-3.1
+const altSvcDefaultMaxAge = 24 * time.Hour
+
+// parseAltSvc parses an Alt-Svc header field value.
+// It reports clear as true if the value is "clear".
+// Malformed alternatives are ignored.
+// https://www.rfc-editor.org/rfc/rfc7838#section-3
+func parseAltSvc(v string) (alts []altSvc, clear bool) {
+	if textproto.TrimString(v) == "clear" {
+		return nil, true
+	}
+	for _, entry := range splitQuoted(v, ',') {
+		params := splitQuoted(entry, ';')
+		protoID, authority, ok := cutAltSvcParam(params[0])
+		if !ok {
+			continue
+		}
+		proto, err := url.PathUnescape(protoID)
+		if err != nil {
+			continue
+		}
+		authority, ok = unquoteAltSvc(authority)
+		if !ok {
+			continue
+		}
+		host, port, err := net.SplitHostPort(authority)
+		if err != nil {
+			continue
+		}
+		if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+			continue
+		}
+		alt := altSvc{proto: proto, host: host, port: port, maxAge: altSvcDefaultMaxAge}
+		for _, param := range params[1:] {
+			name, value, _ := cutAltSvcParam(param)
+			if !ascii.EqualFold(name, "ma") {
+				continue
+			}
+			if value, ok := unquoteAltSvc(value); ok {
+				if secs, err := strconv.ParseInt(value, 10, 64); err == nil && secs >= 0 {
+					if secs > int64(1<<63-1)/int64(time.Second) {
+						secs = int64(1<<63-1) / int64(time.Second)
+					}
+					alt.maxAge = time.Duration(secs) * time.Second
+				}
+			}
+		}
+		alts = append(alts, alt)
+	}
+	return alts, false
+}
+
+// cutAltSvcParam splits a name=value pair, trimming whitespace.
+func cutAltSvcParam(s string) (name, value string, ok bool) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return textproto.TrimString(s), "", false
+	}
+	return textproto.TrimString(s[:i]), textproto.TrimString(s[i+1:]), true
+}
+
+// splitQuoted splits s at each instance of sep which is not
+// within a quoted string.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquoteAltSvc returns the value of a token or quoted-string.
+func unquoteAltSvc(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '"' {
+		return s, s != "" && !strings.ContainsAny(s, "\" \t")
+	}
+	if s[len(s)-1] != '"' {
+		return "", false
+	}
+	s = s[1 : len(s)-1]
+	if !strings.Contains(s, `\`) {
+		return s, true
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			if i == len(s) {
+				return "", false
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), true
+}
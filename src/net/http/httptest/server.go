@@ -32,6 +32,17 @@ type Server struct {
 	// NewUnstartedServer and calling Server.StartTLS.
 	EnableHTTP2 bool
 
+	// EnableHTTP3 controls whether HTTP/3 is enabled on the server.
+	// When set, StartTLS also serves HTTP/3 on a UDP port on the loopback
+	// interface, and responses advertise it with an Alt-Svc header.
+	// The server's Client upgrades to HTTP/3 after its first request.
+	// It must be set between calling NewUnstartedServer and calling
+	// Server.StartTLS.
+	EnableHTTP3 bool
+
+	// packetConn is the UDP connection used for HTTP/3, if enabled.
+	packetConn net.PacketConn
+
 	// TLS is the optional TLS configuration, populated with a new config
 	// after TLS is started. If set on an unstarted server before StartTLS
 	// is called, existing fields are copied into the new config.
@@ -176,11 +187,19 @@ func (s *Server) StartTLS() {
 			RootCAs: certpool,
 		},
 		ForceAttemptHTTP2: s.EnableHTTP2,
+		EnableHTTP3:       s.EnableHTTP3,
 	}
 	s.Listener = tls.NewListener(s.Listener, s.TLS)
 	s.URL = "https://" + s.Listener.Addr().String()
 	s.wrap()
+	if s.EnableHTTP3 && s.Config.TLSConfig == nil {
+		// ServeHTTP3 takes its certificate from the server's TLSConfig.
+		s.Config.TLSConfig = s.TLS.Clone()
+	}
 	s.goServe()
+	if s.EnableHTTP3 {
+		s.goServeHTTP3()
+	}
 }
 
 // NewTLSServer starts and returns a new Server using TLS.
@@ -202,6 +221,9 @@ func (s *Server) Close() {
 	if !s.closed {
 		s.closed = true
 		s.Listener.Close()
+		if s.packetConn != nil {
+			s.packetConn.Close()
+		}
 		s.Config.SetKeepAlivesEnabled(false)
 		for c, st := range s.conns {
 			// Force-close any idle connections (those between
@@ -309,6 +331,27 @@ func (s *Server) goServe() {
 	}()
 }
 
+// goServeHTTP3 serves HTTP/3 on a UDP port on the same address as
+// s.Listener, or on another port if that one is unavailable.
+func (s *Server) goServeHTTP3() {
+	host, port, err := net.SplitHostPort(s.Listener.Addr().String())
+	if err != nil {
+		panic(fmt.Sprintf("httptest: failed to parse listener address: %v", err))
+	}
+	pc, err := net.ListenPacket("udp", net.JoinHostPort(host, port))
+	if err != nil {
+		if pc, err = net.ListenPacket("udp", net.JoinHostPort(host, "0")); err != nil {
+			panic(fmt.Sprintf("httptest: failed to listen on a UDP port: %v", err))
+		}
+	}
+	s.packetConn = pc
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.Config.ServeHTTP3(pc, "", "")
+	}()
+}
+
 // wrap installs the connection state-tracking hook to know which
 // connections are idle.
 func (s *Server) wrap() {
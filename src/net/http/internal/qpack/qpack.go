@@ -0,0 +1,229 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package qpack implements QPACK, the field compression format for HTTP/3,
+// as described in RFC 9204.
+//
+// Only the static table is supported. The encoder never inserts fields
+// into the dynamic table, and the decoder advertises a dynamic table
+// capacity of zero, so the encoder and decoder streams carry no data.
+package qpack
+
+import (
+	"errors"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// A HeaderField is a name-value pair.
+// Names are lowercase.
+type HeaderField struct {
+	Name, Value string
+
+	// Sensitive means that the field should never be
+	// added to a dynamic table by an intermediary.
+	Sensitive bool
+}
+
+// Size returns the size of the field as defined by RFC 9114,
+// for comparison against SETTINGS_MAX_FIELD_SECTION_SIZE.
+// https://www.rfc-editor.org/rfc/rfc9114#section-4.2.2
+func (f HeaderField) Size() uint64 {
+	return uint64(len(f.Name)) + uint64(len(f.Value)) + 32
+}
+
+// ErrDecompressionFailed is returned when a field section cannot be decoded.
+// It corresponds to the QPACK_DECOMPRESSION_FAILED error code.
+var ErrDecompressionFailed = errors.New("qpack: decompression failed")
+
+// AppendFieldSection appends an encoded field section containing fields to b.
+func AppendFieldSection(b []byte, fields []HeaderField) []byte {
+	// Encoded Field Section Prefix: Required Insert Count and Delta Base
+	// are both zero, since the dynamic table is not used.
+	// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.1
+	b = append(b, 0, 0)
+	for _, f := range fields {
+		b = appendField(b, f)
+	}
+	return b
+}
+
+func appendField(b []byte, f HeaderField) []byte {
+	if !f.Sensitive {
+		if i, ok := staticIndex[HeaderField{Name: f.Name, Value: f.Value}]; ok {
+			// Indexed Field Line, static table.
+			// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.2
+			return appendPrefixedInt(b, 0b1100_0000, 6, i)
+		}
+	}
+	var nbit byte
+	if f.Sensitive {
+		nbit = 0b0010_0000
+	}
+	if i, ok := staticNameIndex[f.Name]; ok {
+		// Literal Field Line with Name Reference, static table.
+		// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.4
+		b = appendPrefixedInt(b, 0b0101_0000|nbit, 4, i)
+		return appendString(b, 0, 7, f.Value)
+	}
+	// Literal Field Line with Literal Name.
+	// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.6
+	b = appendString(b, 0b0010_0000|(nbit>>1), 3, f.Name)
+	return appendString(b, 0, 7, f.Value)
+}
+
+// DecodeFieldSection decodes the encoded field section in b,
+// calling f for each field.
+// It returns an error if the section refers to the dynamic table.
+func DecodeFieldSection(b []byte, f func(HeaderField)) error {
+	ric, b, err := readPrefixedInt(b, 8)
+	if err != nil {
+		return err
+	}
+	if ric != 0 {
+		// The dynamic table capacity is zero, so the encoder
+		// cannot have referenced any dynamic table entries.
+		// https://www.rfc-editor.org/rfc/rfc9204#section-4.5.1.1-5
+		return ErrDecompressionFailed
+	}
+	if _, b, err = readPrefixedInt(b, 7); err != nil {
+		return err
+	}
+	for len(b) > 0 {
+		var hf HeaderField
+		switch c := b[0]; {
+		case c&0b1000_0000 != 0:
+			// Indexed Field Line.
+			if c&0b0100_0000 == 0 {
+				return ErrDecompressionFailed
+			}
+			var i uint64
+			if i, b, err = readPrefixedInt(b, 6); err != nil {
+				return err
+			}
+			if hf, err = staticField(i); err != nil {
+				return err
+			}
+		case c&0b0100_0000 != 0:
+			// Literal Field Line with Name Reference.
+			if c&0b0001_0000 == 0 {
+				return ErrDecompressionFailed
+			}
+			hf.Sensitive = c&0b0010_0000 != 0
+			var i uint64
+			if i, b, err = readPrefixedInt(b, 4); err != nil {
+				return err
+			}
+			sf, err := staticField(i)
+			if err != nil {
+				return err
+			}
+			hf.Name = sf.Name
+			if hf.Value, b, err = readString(b, 7); err != nil {
+				return err
+			}
+		case c&0b0010_0000 != 0:
+			// Literal Field Line with Literal Name.
+			hf.Sensitive = c&0b0001_0000 != 0
+			if hf.Name, b, err = readString(b, 3); err != nil {
+				return err
+			}
+			if hf.Value, b, err = readString(b, 7); err != nil {
+				return err
+			}
+		default:
+			// Post-base references refer to the dynamic table.
+			return ErrDecompressionFailed
+		}
+		f(hf)
+	}
+	return nil
+}
+
+func staticField(i uint64) (HeaderField, error) {
+	if i >= uint64(len(staticTable)) {
+		return HeaderField{}, ErrDecompressionFailed
+	}
+	return staticTable[i], nil
+}
+
+// appendPrefixedInt appends v encoded as an integer with an n-bit prefix.
+// The high bits of the first byte are taken from flags.
+// https://www.rfc-editor.org/rfc/rfc7541#section-5.1
+func appendPrefixedInt(b []byte, flags byte, n uint, v uint64) []byte {
+	max := uint64(1)<<n - 1
+	if v < max {
+		return append(b, flags|byte(v))
+	}
+	b = append(b, flags|byte(max))
+	v -= max
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// readPrefixedInt reads an integer with an n-bit prefix from the start of b.
+// It returns the integer and the remainder of b.
+func readPrefixedInt(b []byte, n uint) (uint64, []byte, error) {
+	if len(b) == 0 {
+		return 0, nil, ErrDecompressionFailed
+	}
+	max := uint64(1)<<n - 1
+	v := uint64(b[0]) & max
+	b = b[1:]
+	if v < max {
+		return v, b, nil
+	}
+	for shift := uint(0); shift < 63; shift += 7 {
+		if len(b) == 0 {
+			return 0, nil, ErrDecompressionFailed
+		}
+		c := b[0]
+		b = b[1:]
+		v += uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, b, nil
+		}
+	}
+	return 0, nil, ErrDecompressionFailed
+}
+
+// appendString appends a string literal with an n-bit length prefix.
+// The Huffman flag is the bit immediately above the prefix.
+// https://www.rfc-editor.org/rfc/rfc9204#section-4.1.2
+func appendString(b []byte, flags byte, n uint, s string) []byte {
+	if hl := hpack.HuffmanEncodeLength(s); hl < uint64(len(s)) {
+		b = appendPrefixedInt(b, flags|1<<n, n, hl)
+		return hpack.AppendHuffmanString(b, s)
+	}
+	b = appendPrefixedInt(b, flags, n, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a string literal with an n-bit length prefix
+// from the start of b.
+func readString(b []byte, n uint) (string, []byte, error) {
+	if len(b) == 0 {
+		return "", nil, ErrDecompressionFailed
+	}
+	huffman := b[0]&(1<<n) != 0
+	size, b, err := readPrefixedInt(b, n)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(b)) < size {
+		return "", nil, ErrDecompressionFailed
+	}
+	data, b := b[:size], b[size:]
+	if !huffman {
+		return string(data), b, nil
+	}
+	s, err := hpack.HuffmanDecodeToString(data)
+	if err != nil {
+		return "", nil, ErrDecompressionFailed
+	}
+	return s, b, nil
+}
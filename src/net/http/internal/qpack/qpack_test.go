@@ -0,0 +1,155 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qpack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStaticTable(t *testing.T) {
+	if got, want := len(staticTable), 99; got != want {
+		t.Fatalf("len(staticTable) = %v, want %v", got, want)
+	}
+	for _, test := range []struct {
+		i int
+		f HeaderField
+	}{
+		{0, HeaderField{Name: ":authority"}},
+		{17, HeaderField{Name: ":method", Value: "GET"}},
+		{25, HeaderField{Name: ":status", Value: "200"}},
+		{63, HeaderField{Name: ":status", Value: "100"}},
+		{98, HeaderField{Name: "x-frame-options", Value: "sameorigin"}},
+	} {
+		if got := staticTable[test.i]; got != test.f {
+			t.Errorf("staticTable[%v] = %v, want %v", test.i, got, test.f)
+		}
+	}
+}
+
+func TestDecodeRFCExample(t *testing.T) {
+	// https://www.rfc-editor.org/rfc/rfc9204#appendix-B.1
+	b, _ := hex.DecodeString("0000510b2f696e6465782e68746d6c")
+	var fields []HeaderField
+	if err := DecodeFieldSection(b, func(f HeaderField) {
+		fields = append(fields, f)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []HeaderField{{Name: ":path", Value: "/index.html"}}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("DecodeFieldSection = %v, want %v", fields, want)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, test := range []struct {
+		f    HeaderField
+		want string
+	}{
+		// Indexed field line.
+		{HeaderField{Name: ":method", Value: "GET"}, "d1"},
+		// Name reference, Huffman-encoded value.
+		{HeaderField{Name: ":path", Value: "/index.html"}, "518860d5485f2bce9a68"},
+		// Name reference, value not shortened by Huffman encoding.
+		{HeaderField{Name: ":path", Value: "{}"}, "51027b7d"},
+		// Sensitive fields are never indexed.
+		{HeaderField{Name: ":method", Value: "GET", Sensitive: true}, "7f0003474554"},
+		// Literal name.
+		{HeaderField{Name: "{}", Value: ""}, "22" + "7b7d" + "00"},
+		{HeaderField{Name: "{}", Value: "", Sensitive: true}, "32" + "7b7d" + "00"},
+	} {
+		got := AppendFieldSection(nil, []HeaderField{test.f})
+		if want := "0000" + test.want; hex.EncodeToString(got) != want {
+			t.Errorf("AppendFieldSection(%v) = %x, want %v", test.f, got, want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, fields := range [][]HeaderField{
+		nil,
+		{
+			{Name: ":method", Value: "GET"},
+			{Name: ":scheme", Value: "https"},
+			{Name: ":authority", Value: "example.com"},
+			{Name: ":path", Value: "/"},
+		},
+		{
+			{Name: ":status", Value: "200"},
+			{Name: "content-type", Value: "text/html; charset=utf-8"},
+			{Name: "content-length", Value: "1234"},
+			{Name: "x-custom", Value: "value"},
+			{Name: "x-empty", Value: ""},
+		},
+		{
+			{Name: "authorization", Value: "secret", Sensitive: true},
+			{Name: "x-token", Value: "secret", Sensitive: true},
+			{Name: "cookie", Value: "", Sensitive: true},
+		},
+		{
+			{Name: "x-long", Value: strings.Repeat("long value ", 100)},
+			{Name: strings.Repeat("n", 300), Value: "\x00\xff binary"},
+		},
+	} {
+		b := AppendFieldSection(nil, fields)
+		var got []HeaderField
+		if err := DecodeFieldSection(b, func(f HeaderField) {
+			got = append(got, f)
+		}); err != nil {
+			t.Errorf("DecodeFieldSection(AppendFieldSection(%v)): %v", fields, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, fields) {
+			t.Errorf("round trip:\n got %v\nwant %v", got, fields)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		hex  string
+	}{
+		{"empty", ""},
+		{"missing base", "00"},
+		{"dynamic table insert count", "0200"},
+		{"indexed dynamic", "000080"},
+		{"static index out of range", "0000ff24"},
+		{"name reference dynamic", "00004000"},
+		{"post-base indexed", "000010"},
+		{"post-base name reference", "00000000"},
+		{"truncated value", "0000510b2f69"},
+		{"truncated integer", "0000ff"},
+		{"invalid huffman", "00002901ff"},
+	} {
+		b, err := hex.DecodeString(test.hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := DecodeFieldSection(b, func(HeaderField) {}); err != ErrDecompressionFailed {
+			t.Errorf("%v: DecodeFieldSection(%x) = %v, want ErrDecompressionFailed", test.name, b, err)
+		}
+	}
+}
+
+func TestPrefixedInt(t *testing.T) {
+	for _, v := range []uint64{0, 1, 30, 31, 32, 127, 128, 1337, 1<<32 - 1} {
+		for _, n := range []uint{3, 4, 5, 6, 7, 8} {
+			b := appendPrefixedInt(nil, 0, n, v)
+			got, rest, err := readPrefixedInt(b, n)
+			if err != nil || got != v || len(rest) != 0 {
+				t.Errorf("readPrefixedInt(appendPrefixedInt(%v), %v) = %v, %x, %v", v, n, got, rest, err)
+			}
+		}
+	}
+	// https://www.rfc-editor.org/rfc/rfc7541#appendix-C.1.2
+	if got, want := appendPrefixedInt(nil, 0, 5, 1337), []byte{0x1f, 0x9a, 0x0a}; !bytes.Equal(got, want) {
+		t.Errorf("appendPrefixedInt(1337, 5) = %x, want %x", got, want)
+	}
+}
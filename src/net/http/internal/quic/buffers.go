@@ -0,0 +1,166 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+// A recvBuffer reassembles data received out of order on a stream.
+type recvBuffer struct {
+	start int64    // stream offset of buf[0]; data before start has been consumed
+	buf   []byte   // data from start up to the end of the highest received range
+	recv  rangeset // byte ranges received
+}
+
+// write records data received at the given offset.
+func (b *recvBuffer) write(off int64, data []byte) {
+	end := off + int64(len(data))
+	if end <= b.start {
+		return // entirely old data
+	}
+	if off < b.start {
+		data = data[b.start-off:]
+		off = b.start
+	}
+	if need := int(end - b.start); need > len(b.buf) {
+		if need > cap(b.buf) {
+			nb := make([]byte, need, need*2)
+			copy(nb, b.buf)
+			b.buf = nb
+		} else {
+			b.buf = b.buf[:need]
+		}
+	}
+	copy(b.buf[off-b.start:], data)
+	b.recv.add(off, end)
+}
+
+// readable returns the number of contiguous bytes available to read.
+func (b *recvBuffer) readable() int {
+	if len(b.recv) == 0 || b.recv[0].start > b.start {
+		return 0
+	}
+	return int(b.recv[0].end - b.start)
+}
+
+// read consumes up to len(p) contiguous bytes.
+func (b *recvBuffer) read(p []byte) int {
+	n := copy(p, b.buf[:b.readable()])
+	b.consume(n)
+	return n
+}
+
+// peek returns the contiguous bytes available to read, without consuming them.
+func (b *recvBuffer) peek() []byte {
+	return b.buf[:b.readable()]
+}
+
+// consume discards n bytes from the start of the buffer.
+func (b *recvBuffer) consume(n int) {
+	b.buf = b.buf[n:]
+	b.start += int64(n)
+	if len(b.buf) == 0 {
+		// Reuse the underlying array once it has been drained.
+		b.buf = b.buf[:0:0]
+	}
+}
+
+// end returns the offset just past the highest byte received.
+func (b *recvBuffer) end() int64 {
+	if e := b.recv.end(); e > b.start {
+		return e
+	}
+	return b.start
+}
+
+// A sendBuffer holds data written to a stream until the peer acknowledges it.
+type sendBuffer struct {
+	start int64    // stream offset of buf[0]; data before start has been acked
+	buf   []byte   // unacknowledged data
+	sent  int64    // data before sent has been sent at least once
+	lost  rangeset // sent ranges needing retransmission
+	acked rangeset // acked ranges after start
+}
+
+// end returns the offset just past the last byte written.
+func (b *sendBuffer) end() int64 {
+	return b.start + int64(len(b.buf))
+}
+
+func (b *sendBuffer) write(p []byte) {
+	b.buf = append(b.buf, p...)
+}
+
+// unacked returns the number of bytes written but not yet acknowledged.
+func (b *sendBuffer) unacked() int {
+	return len(b.buf)
+}
+
+// bytes returns the data in [off, end).
+func (b *sendBuffer) bytes(off, end int64) []byte {
+	return b.buf[off-b.start : end-b.start]
+}
+
+// ack records the acknowledgement of [off, end).
+func (b *sendBuffer) ack(off, end int64) {
+	b.acked.add(off, end)
+	b.lost.sub(off, end)
+	if len(b.acked) > 0 && b.acked[0].start <= b.start {
+		n := b.acked[0].end - b.start
+		if n > 0 {
+			b.buf = b.buf[n:]
+			b.start += n
+		}
+		b.acked.sub(0, b.start)
+		if len(b.buf) == 0 {
+			b.buf = nil
+		}
+	}
+}
+
+// lose records the loss of [off, end).
+func (b *sendBuffer) lose(off, end int64) {
+	if off < b.start {
+		off = b.start
+	}
+	if end <= off {
+		return
+	}
+	b.lost.add(off, end)
+	for _, r := range b.acked {
+		b.lost.sub(r.start, r.end)
+	}
+}
+
+// hasPending reports whether there is data to send.
+// New data is limited to offsets below limit.
+func (b *sendBuffer) hasPending(limit int64) bool {
+	if len(b.lost) > 0 {
+		return true
+	}
+	return b.sent < b.end() && b.sent < limit
+}
+
+// next returns the next range of data to send, preferring retransmissions.
+// New data is limited to offsets below limit.
+// It returns end == off if there is nothing to send.
+func (b *sendBuffer) next(limit int64) (off, end int64, isNew bool) {
+	if len(b.lost) > 0 {
+		return b.lost[0].start, b.lost[0].end, false
+	}
+	end = b.end()
+	if end > limit {
+		end = limit
+	}
+	if end < b.sent {
+		end = b.sent
+	}
+	return b.sent, end, true
+}
+
+// markSent records that [off, end) has been sent.
+func (b *sendBuffer) markSent(off, end int64) {
+	b.lost.sub(off, end)
+	if end > b.sent {
+		b.sent = end
+	}
+}
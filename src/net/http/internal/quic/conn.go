@@ -0,0 +1,524 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+)
+
+// A Conn is a QUIC connection.
+//
+// Multiple goroutines may invoke methods on a Conn simultaneously.
+type Conn struct {
+	side     side
+	endpoint *Endpoint
+	config   *Config
+	peerAddr net.Addr
+
+	msgc    chan []byte   // datagrams received from the endpoint
+	wakec   chan struct{} // wakes the connection loop
+	exitc   chan struct{} // closed to force the connection loop to exit
+	donec   chan struct{} // closed when the connection loop exits
+	closedc chan struct{} // closed when the connection begins closing
+
+	exitOnce sync.Once
+
+	// mu guards all the fields below.
+	// Blocked operations wait on cond, which is broadcast
+	// whenever connection or stream state changes.
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// Connection IDs.
+	origDstConnID []byte // destination ID of the client's first Initial packet
+	localConnID   []byte // our connection ID
+	remoteConnID  []byte // peer's connection ID
+	gotPeerConnID bool   // client: received the server's connection ID
+
+	localParams transportParameters
+	peerParams  transportParameters
+	gotParams   bool // peerParams have been received
+
+	tls *tls.QUICConn
+
+	// Packet protection keys.
+	initialKeys   fixedKeyPair
+	handshakeKeys fixedKeyPair
+	appKeys       updatingKeys
+
+	spaces [numberSpaceCount]spaceState
+	crypto [numberSpaceCount]cryptoStream
+
+	// Packets we could not decrypt yet, to be processed once keys are available.
+	pending      [][]byte
+	reprocess    bool
+	pathResponse []uint64 // PATH_CHALLENGE data to echo
+
+	handshakeDone      bool // TLS handshake has completed
+	handshakeConfirmed bool // handshake is confirmed (RFC 9001, Section 4.1.2)
+	needHandshakeDone  bool // server: HANDSHAKE_DONE frame needs to be sent
+	handshakeDonec     chan struct{}
+	addrValidated      bool // server: peer address is validated
+	bytesRecv          int  // server: bytes received before address validation
+	bytesSent          int  // server: bytes sent before address validation
+	handshakeDeadline  time.Time
+	idleTimeout        time.Duration
+	idleDeadline       time.Time
+	keepAliveDeadline  time.Time
+
+	loss lossState
+
+	streams streamsState
+
+	// Connection close state.
+	closeState    closeState
+	closeErr      error // error returned to users of the connection
+	closeFrame    error // error sent to the peer in CONNECTION_CLOSE
+	sendClose     bool  // CONNECTION_CLOSE needs to be sent
+	closeDeadline time.Time
+	closeSentc    chan struct{} // closed after the first CONNECTION_CLOSE is sent
+
+	w packetWriter
+}
+
+type closeState int
+
+const (
+	connOpen     = closeState(iota)
+	connClosing  // we sent CONNECTION_CLOSE
+	connDraining // peer sent CONNECTION_CLOSE
+	connDone     // connection is finished
+)
+
+// A cryptoStream carries TLS handshake data at a single encryption level.
+type cryptoStream struct {
+	in  recvBuffer
+	out sendBuffer
+}
+
+// maxCryptoBuffer is the maximum amount of out-of-order CRYPTO data
+// we will buffer at an encryption level.
+const maxCryptoBuffer = 1 << 16
+
+func newConn(now time.Time, side side, initialConnID, peerConnID []byte, peerAddr net.Addr, config *Config, e *Endpoint) (*Conn, error) {
+	c := &Conn{
+		side:           side,
+		endpoint:       e,
+		config:         config,
+		peerAddr:       peerAddr,
+		msgc:           make(chan []byte, 32),
+		wakec:          make(chan struct{}, 1),
+		exitc:          make(chan struct{}),
+		donec:          make(chan struct{}),
+		closedc:        make(chan struct{}),
+		closeSentc:     make(chan struct{}),
+		handshakeDonec: make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	c.localConnID = newRandomConnID()
+	if side == clientSide {
+		c.origDstConnID = newRandomConnID()
+		c.remoteConnID = c.origDstConnID
+	} else {
+		c.origDstConnID = initialConnID
+		c.remoteConnID = peerConnID
+		c.gotPeerConnID = true
+	}
+	c.initialKeys = initialKeys(c.origDstConnID, side)
+	for i := range c.spaces {
+		c.spaces[i].init()
+	}
+	c.loss.init()
+	c.streams.init(side, config)
+	c.handshakeDeadline = now.Add(config.handshakeTimeout())
+
+	p := defaultTransportParameters()
+	p.initialSrcConnID = c.localConnID
+	if side == serverSide {
+		p.originalDstConnID = c.origDstConnID
+	}
+	p.maxIdleTimeout = config.maxIdleTimeout()
+	p.maxUDPPayloadSize = maxUDPPayloadSize
+	p.initialMaxData = config.maxConnReadBufferSize()
+	p.initialMaxStreamDataBidiLocal = config.maxStreamReadBufferSize()
+	p.initialMaxStreamDataBidiRemote = config.maxStreamReadBufferSize()
+	p.initialMaxStreamDataUni = config.maxStreamReadBufferSize()
+	p.initialMaxStreamsBidi = config.maxBidiRemoteStreams()
+	p.initialMaxStreamsUni = config.maxUniRemoteStreams()
+	p.disableActiveMigration = true
+	c.localParams = p
+	c.idleTimeout = p.maxIdleTimeout
+	c.resetIdleTimer(now)
+
+	tlsConfig := config.TLSConfig.Clone()
+	tlsConfig.MinVersion = tls.VersionTLS13
+	qconfig := &tls.QUICConfig{TLSConfig: tlsConfig}
+	if side == clientSide {
+		c.tls = tls.QUICClient(qconfig)
+	} else {
+		c.tls = tls.QUICServer(qconfig)
+	}
+	c.tls.SetTransportParameters(marshalTransportParameters(p))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.tls.Start(context.Background()); err != nil {
+		return nil, err
+	}
+	c.handleTLSEvents(now)
+	if c.closeState != connOpen {
+		return nil, c.closeErr
+	}
+	go c.loop()
+	return c, nil
+}
+
+func newRandomConnID() []byte {
+	id := make([]byte, connIDLen)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.endpoint.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.peerAddr
+}
+
+// ConnectionState returns basic TLS details about the connection.
+func (c *Conn) ConnectionState() tls.ConnectionState {
+	return c.tls.ConnectionState()
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.closedc
+}
+
+// Err returns the reason the connection was closed,
+// or nil if it is still open.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeErr
+}
+
+// Close closes the connection with no error (application error code 0).
+// It does not wait for the peer to acknowledge the close.
+func (c *Conn) Close() error {
+	c.Abort(nil)
+	return nil
+}
+
+// Abort closes the connection and returns immediately.
+//
+// If err is an *ApplicationError, its error code is sent to the peer
+// in an application CONNECTION_CLOSE frame. Otherwise, the peer
+// receives a transport error: NO_ERROR if err is nil, or
+// INTERNAL_ERROR otherwise.
+func (c *Conn) Abort(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var frame error
+	switch e := err.(type) {
+	case nil:
+		frame = &ApplicationError{Code: 0}
+	case *ApplicationError:
+		frame = e
+	default:
+		frame = localTransportError{code: errInternal}
+	}
+	c.closeLocked(time.Now(), frame, errConnClosed)
+}
+
+// waitHandshake waits for the handshake to complete.
+func (c *Conn) waitHandshake(ctx context.Context) error {
+	select {
+	case <-c.handshakeDonec:
+		return nil
+	case <-c.closedc:
+		return c.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait blocks until ready returns true, the connection is closed,
+// or the context is done. It must be called with c.mu held.
+func (c *Conn) wait(ctx context.Context, ready func() bool) error {
+	if ready() {
+		return nil
+	}
+	if done := ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-done:
+				c.mu.Lock()
+				c.cond.Broadcast()
+				c.mu.Unlock()
+			case <-stop:
+			}
+		}()
+	}
+	for !ready() {
+		if c.closeErr != nil {
+			return c.closeErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.cond.Wait()
+	}
+	return nil
+}
+
+// wake wakes up the connection loop to send pending data.
+func (c *Conn) wake() {
+	select {
+	case c.wakec <- struct{}{}:
+	default:
+	}
+}
+
+// deliver passes a datagram received by the endpoint to the connection.
+// Datagrams are dropped if the connection is not keeping up.
+func (c *Conn) deliver(b []byte) {
+	select {
+	case c.msgc <- b:
+	default:
+	}
+}
+
+// exit forces the connection loop to exit.
+func (c *Conn) exit() {
+	c.exitOnce.Do(func() {
+		close(c.exitc)
+	})
+}
+
+// loop is the connection's main loop.
+// It processes received datagrams and timer events, and sends packets.
+func (c *Conn) loop() {
+	defer close(c.donec)
+	defer c.endpoint.removeConn(c)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		c.mu.Lock()
+		now := time.Now()
+		c.maybeSend(now)
+		next := c.nextTimer()
+		done := c.closeState == connDone
+		c.mu.Unlock()
+		if done {
+			return
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if !next.IsZero() {
+			timer.Reset(next.Sub(now))
+		}
+		select {
+		case b := <-c.msgc:
+			c.mu.Lock()
+			c.handleDatagram(time.Now(), b)
+			// Process any other datagrams that have arrived
+			// before sending, so acknowledgements are coalesced.
+		drain:
+			for i := 0; i < 16; i++ {
+				select {
+				case b := <-c.msgc:
+					c.handleDatagram(time.Now(), b)
+				default:
+					break drain
+				}
+			}
+			c.mu.Unlock()
+		case <-timer.C:
+			c.mu.Lock()
+			c.handleTimer(time.Now())
+			c.mu.Unlock()
+		case <-c.wakec:
+		case <-c.exitc:
+			c.mu.Lock()
+			c.setDone(errEndpointClosed)
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+// nextTimer returns the time of the next timer event.
+func (c *Conn) nextTimer() time.Time {
+	var next time.Time
+	earliest := func(t time.Time) {
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	switch c.closeState {
+	case connClosing, connDraining:
+		return c.closeDeadline
+	case connDone:
+		return time.Time{}
+	}
+	earliest(c.idleDeadline)
+	if !c.handshakeDone {
+		earliest(c.handshakeDeadline)
+	}
+	earliest(c.keepAliveDeadline)
+	earliest(c.lossTimer())
+	return next
+}
+
+// handleTimer handles expired timers.
+func (c *Conn) handleTimer(now time.Time) {
+	switch c.closeState {
+	case connClosing, connDraining:
+		if !now.Before(c.closeDeadline) {
+			c.closeState = connDone
+		}
+		return
+	case connDone:
+		return
+	}
+	if !c.idleDeadline.IsZero() && !now.Before(c.idleDeadline) {
+		c.setDone(errIdleTimeout)
+		return
+	}
+	if !c.handshakeDone && !now.Before(c.handshakeDeadline) {
+		c.setDone(errHandshakeTimeout)
+		return
+	}
+	if !c.keepAliveDeadline.IsZero() && !now.Before(c.keepAliveDeadline) {
+		c.spaces[appDataSpace].probe = true
+		c.keepAliveDeadline = time.Time{}
+	}
+	if t := c.lossTimer(); !t.IsZero() && !now.Before(t) {
+		c.handleLossTimer(now)
+	}
+}
+
+// resetIdleTimer restarts the idle timer.
+func (c *Conn) resetIdleTimer(now time.Time) {
+	if c.idleTimeout <= 0 {
+		c.idleDeadline = time.Time{}
+	} else {
+		// RFC 9000, Section 10.1: the idle timeout is at least
+		// three times the current PTO.
+		c.idleDeadline = now.Add(maxDuration(c.idleTimeout, 3*c.loss.ptoBasePeriod()))
+	}
+	if c.config.KeepAlivePeriod > 0 && c.handshakeConfirmed {
+		c.keepAliveDeadline = now.Add(c.config.KeepAlivePeriod)
+	}
+}
+
+// closeLocked begins closing the connection, sending frameErr to the peer
+// and reporting userErr to users of the connection.
+func (c *Conn) closeLocked(now time.Time, frameErr, userErr error) {
+	if c.closeState != connOpen {
+		return
+	}
+	c.closeState = connClosing
+	c.closeFrame = frameErr
+	c.sendClose = true
+	c.closeDeadline = now.Add(3 * c.loss.ptoBasePeriod())
+	c.setCloseErr(userErr)
+	c.wake()
+}
+
+// abort closes the connection due to a protocol error.
+func (c *Conn) abort(now time.Time, err error) {
+	c.closeLocked(now, err, err)
+}
+
+// enterDraining enters the draining state after receiving CONNECTION_CLOSE.
+func (c *Conn) enterDraining(now time.Time, err error) {
+	if c.closeState == connDone || c.closeState == connDraining {
+		return
+	}
+	if c.closeState == connOpen {
+		c.setCloseErr(err)
+	}
+	c.closeState = connDraining
+	c.sendClose = false
+	c.closeDeadline = now.Add(3 * c.loss.ptoBasePeriod())
+	c.closeSent()
+}
+
+// setDone closes the connection immediately, without sending CONNECTION_CLOSE.
+func (c *Conn) setDone(err error) {
+	if c.closeState == connOpen {
+		c.setCloseErr(err)
+	}
+	c.closeState = connDone
+	c.closeSent()
+}
+
+func (c *Conn) setCloseErr(err error) {
+	if c.closeErr != nil {
+		return
+	}
+	c.closeErr = err
+	close(c.closedc)
+	c.tls.Close()
+	c.cond.Broadcast()
+}
+
+func (c *Conn) closeSent() {
+	select {
+	case <-c.closeSentc:
+	default:
+		close(c.closeSentc)
+	}
+}
+
+// NewStream creates a stream.
+//
+// If the peer's maximum stream limit for the connection has been reached,
+// NewStream blocks until the limit is increased or the context expires.
+func (c *Conn) NewStream(ctx context.Context) (*Stream, error) {
+	return c.newLocalStream(ctx, bidiStream)
+}
+
+// NewSendOnlyStream creates a unidirectional, send-only stream.
+//
+// If the peer's maximum stream limit for the connection has been reached,
+// NewSendOnlyStream blocks until the limit is increased or the context expires.
+func (c *Conn) NewSendOnlyStream(ctx context.Context) (*Stream, error) {
+	return c.newLocalStream(ctx, uniStream)
+}
+
+// AcceptStream waits for and returns the next stream created by the peer.
+func (c *Conn) AcceptStream(ctx context.Context) (*Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.wait(ctx, func() bool {
+		return len(c.streams.acceptq) > 0
+	}); err != nil {
+		return nil, err
+	}
+	s := c.streams.acceptq[0]
+	c.streams.acceptq[0] = nil
+	c.streams.acceptq = c.streams.acceptq[1:]
+	return s, nil
+}
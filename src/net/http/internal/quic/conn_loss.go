@@ -0,0 +1,509 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"math"
+	"time"
+)
+
+// spaceState is the per-number-space state of a connection.
+type spaceState struct {
+	// Sending.
+	nextNum          int64         // next packet number to send
+	largestAcked     int64         // largest packet number acked by the peer, or -1
+	sent             []*sentPacket // sent packets not yet acked or declared lost, in order
+	lossTime         time.Time     // time at which the next packet will be declared lost
+	lastAckEliciting time.Time     // time the last ack-eliciting packet was sent
+	probe            bool          // send an ack-eliciting probe packet
+
+	// Receiving.
+	seen      rangeset  // packet numbers received
+	largest   int64     // largest packet number received, or -1
+	largestAt time.Time // time the largest packet number was received
+	ackNeeded bool      // an ack-eliciting packet has been received and not acked
+}
+
+// maxAckRanges is the maximum number of received packet number ranges we track.
+// Older ranges are discarded; see packetWriter.appendAckFrame.
+const maxAckRanges = 64
+
+func (s *spaceState) init() {
+	s.largestAcked = -1
+	s.largest = -1
+}
+
+// ackElicitingInFlight reports whether any ack-eliciting packets are in flight.
+func (s *spaceState) ackElicitingInFlight() bool {
+	for _, p := range s.sent {
+		if p.ackEliciting {
+			return true
+		}
+	}
+	return false
+}
+
+// received records the receipt of a packet.
+func (s *spaceState) received(now time.Time, num int64, ackEliciting bool) {
+	s.seen.add(num, num+1)
+	if len(s.seen) > maxAckRanges {
+		s.seen.removeranges(0, len(s.seen)-maxAckRanges)
+	}
+	if num > s.largest {
+		s.largest = num
+		s.largestAt = now
+	}
+	if ackEliciting {
+		s.ackNeeded = true
+	}
+}
+
+// lossState holds the state used for loss detection and congestion control.
+// https://www.rfc-editor.org/rfc/rfc9002
+type lossState struct {
+	// RTT estimation (RFC 9002, Section 5).
+	minRTT      time.Duration
+	latestRTT   time.Duration
+	smoothedRTT time.Duration
+	rttvar      time.Duration
+	haveRTT     bool
+	maxAckDelay time.Duration // peer's max_ack_delay
+
+	ptoCount int
+
+	// NewReno congestion control (RFC 9002, Section 7).
+	cwnd          int
+	ssthresh      int
+	bytesInFlight int
+	recoveryStart time.Time
+}
+
+const (
+	initialRTT      = 333 * time.Millisecond
+	initialWindow   = 10 * maxUDPPayloadSize
+	minimumWindow   = 2 * maxUDPPayloadSize
+	packetThreshold = 3
+)
+
+func (l *lossState) init() {
+	l.smoothedRTT = initialRTT
+	l.rttvar = initialRTT / 2
+	l.maxAckDelay = maxAckDelay
+	l.cwnd = initialWindow
+	l.ssthresh = math.MaxInt
+}
+
+// updateRTT records an RTT sample.
+// https://www.rfc-editor.org/rfc/rfc9002#section-5.3
+func (l *lossState) updateRTT(latest, ackDelay time.Duration, handshakeConfirmed bool) {
+	l.latestRTT = latest
+	if !l.haveRTT {
+		l.haveRTT = true
+		l.minRTT = latest
+		l.smoothedRTT = latest
+		l.rttvar = latest / 2
+		return
+	}
+	if latest < l.minRTT {
+		l.minRTT = latest
+	}
+	if handshakeConfirmed {
+		ackDelay = minDuration(ackDelay, l.maxAckDelay)
+	}
+	adjusted := latest
+	if latest >= l.minRTT+ackDelay {
+		adjusted = latest - ackDelay
+	}
+	d := l.smoothedRTT - adjusted
+	if d < 0 {
+		d = -d
+	}
+	l.rttvar = (3*l.rttvar + d) / 4
+	l.smoothedRTT = (7*l.smoothedRTT + adjusted) / 8
+}
+
+// ptoBasePeriod returns the probe timeout, without backoff or max_ack_delay.
+// https://www.rfc-editor.org/rfc/rfc9002#section-6.2.1
+func (l *lossState) ptoBasePeriod() time.Duration {
+	return l.smoothedRTT + maxDuration(4*l.rttvar, timerGranularity)
+}
+
+// ptoPeriod returns the probe timeout for a number space, including backoff.
+func (l *lossState) ptoPeriod(space numberSpace) time.Duration {
+	pto := l.ptoBasePeriod()
+	if space == appDataSpace {
+		pto += l.maxAckDelay
+	}
+	return pto << uint(l.ptoCount)
+}
+
+// lossDelay returns the time threshold for declaring a packet lost.
+// https://www.rfc-editor.org/rfc/rfc9002#section-6.1.2
+func (l *lossState) lossDelay() time.Duration {
+	d := maxDuration(l.latestRTT, l.smoothedRTT) * 9 / 8
+	return maxDuration(d, timerGranularity)
+}
+
+// canSend reports whether the congestion window permits sending.
+func (l *lossState) canSend() bool {
+	return l.bytesInFlight < l.cwnd
+}
+
+func (l *lossState) packetSent(p *sentPacket) {
+	if p.inFlight {
+		l.bytesInFlight += p.size
+	}
+}
+
+func (l *lossState) packetAcked(p *sentPacket) {
+	if !p.inFlight {
+		return
+	}
+	l.bytesInFlight -= p.size
+	if !p.time.After(l.recoveryStart) {
+		// Don't increase the window for packets sent before recovery began.
+		return
+	}
+	if l.cwnd < l.ssthresh {
+		l.cwnd += p.size
+	} else {
+		l.cwnd += maxUDPPayloadSize * p.size / l.cwnd
+	}
+}
+
+func (l *lossState) packetLost(now time.Time, p *sentPacket) {
+	if !p.inFlight {
+		return
+	}
+	l.bytesInFlight -= p.size
+	if !p.time.After(l.recoveryStart) {
+		// Only respond to one loss per round trip.
+		return
+	}
+	l.recoveryStart = now
+	l.ssthresh = l.cwnd / 2
+	l.cwnd = l.ssthresh
+	if l.cwnd < minimumWindow {
+		l.cwnd = minimumWindow
+	}
+}
+
+// discardSpace forgets all sent packets in a number space,
+// after its keys have been discarded.
+// https://www.rfc-editor.org/rfc/rfc9002#section-6.4
+func (l *lossState) discardSpace(s *spaceState) {
+	for _, p := range s.sent {
+		if p.inFlight {
+			l.bytesInFlight -= p.size
+		}
+		p.recycle()
+	}
+	s.sent = nil
+	s.lossTime = time.Time{}
+	s.lastAckEliciting = time.Time{}
+	s.probe = false
+	s.ackNeeded = false
+	l.ptoCount = 0
+}
+
+// packetSent records a packet sent in a number space.
+func (c *Conn) packetSent(now time.Time, space numberSpace, p *sentPacket) {
+	p.time = now
+	s := &c.spaces[space]
+	s.nextNum++
+	if p.ackEliciting {
+		s.lastAckEliciting = now
+	}
+	if !p.inFlight && !p.ackEliciting {
+		// Packets containing only ACK frames are not tracked.
+		p.recycle()
+		return
+	}
+	s.sent = append(s.sent, p)
+	c.loss.packetSent(p)
+}
+
+// handleAck processes an ACK frame.
+func (c *Conn) handleAck(now time.Time, space numberSpace, largest int64, delay time.Duration, acked rangeset) error {
+	s := &c.spaces[space]
+	if largest >= s.nextNum {
+		return localTransportError{code: errProtocolViolation, reason: "acknowledgement for unsent packet"}
+	}
+	var (
+		newlyAcked         bool
+		largestNewlyAcked  *sentPacket
+		anyNewAckEliciting bool
+	)
+	for _, p := range s.sent {
+		if p.acked || p.lost || !acked.contains(p.num) {
+			continue
+		}
+		p.acked = true
+		newlyAcked = true
+		if p.ackEliciting {
+			anyNewAckEliciting = true
+		}
+		if p.num == largest {
+			largestNewlyAcked = p
+		}
+		c.loss.packetAcked(p)
+		c.packetAckedFrames(space, p)
+	}
+	if largest > s.largestAcked {
+		s.largestAcked = largest
+	}
+	if !newlyAcked {
+		return nil
+	}
+	if largestNewlyAcked != nil && anyNewAckEliciting {
+		if space != appDataSpace {
+			delay = 0
+		}
+		c.loss.updateRTT(now.Sub(largestNewlyAcked.time), delay, c.handshakeConfirmed)
+	}
+	c.detectLoss(now, space)
+	c.compactSent(space)
+	// "The PTO backoff factor is reset when an acknowledgment is received,
+	// except in the following case. A server might take longer to respond
+	// to packets during the handshake than otherwise. To protect such a
+	// server from repeated client probes, the PTO backoff is not reset
+	// at a client that is not yet certain that the server has finished
+	// validating the client's address."
+	// https://www.rfc-editor.org/rfc/rfc9002#section-6.2.1-9
+	if c.side == serverSide || c.handshakeKeys.canRead() || c.handshakeConfirmed {
+		c.loss.ptoCount = 0
+	}
+	return nil
+}
+
+// detectLoss declares packets lost.
+// https://www.rfc-editor.org/rfc/rfc9002#section-6.1
+func (c *Conn) detectLoss(now time.Time, space numberSpace) {
+	s := &c.spaces[space]
+	s.lossTime = time.Time{}
+	lossDelay := c.loss.lossDelay()
+	for _, p := range s.sent {
+		if p.acked || p.lost || p.num > s.largestAcked {
+			continue
+		}
+		if now.Sub(p.time) >= lossDelay || s.largestAcked >= p.num+packetThreshold {
+			c.packetLost(now, space, p)
+			continue
+		}
+		if t := p.time.Add(lossDelay); s.lossTime.IsZero() || t.Before(s.lossTime) {
+			s.lossTime = t
+		}
+	}
+	c.compactSent(space)
+}
+
+// packetLost handles a packet declared lost.
+func (c *Conn) packetLost(now time.Time, space numberSpace, p *sentPacket) {
+	p.lost = true
+	c.loss.packetLost(now, p)
+	c.packetLostFrames(space, p)
+}
+
+// compactSent removes acked and lost packets from the sent list.
+func (c *Conn) compactSent(space numberSpace) {
+	s := &c.spaces[space]
+	i := 0
+	for _, p := range s.sent {
+		if p.acked || p.lost {
+			p.recycle()
+			continue
+		}
+		s.sent[i] = p
+		i++
+	}
+	for j := i; j < len(s.sent); j++ {
+		s.sent[j] = nil
+	}
+	s.sent = s.sent[:i]
+}
+
+// lossTimer returns the time of the next loss detection or PTO event.
+// https://www.rfc-editor.org/rfc/rfc9002#appendix-A.8
+func (c *Conn) lossTimer() time.Time {
+	var next time.Time
+	for space := initialSpace; space < numberSpaceCount; space++ {
+		t := c.spaces[space].lossTime
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	if !next.IsZero() {
+		return next
+	}
+	if !c.canSendAmplified() {
+		// The server is blocked by the anti-amplification limit.
+		return time.Time{}
+	}
+	_, t := c.ptoTime()
+	return t
+}
+
+// ptoTime returns the number space and time of the next PTO.
+func (c *Conn) ptoTime() (numberSpace, time.Time) {
+	var (
+		next      time.Time
+		nextSpace numberSpace
+	)
+	anyInFlight := false
+	for space := initialSpace; space < numberSpaceCount; space++ {
+		s := &c.spaces[space]
+		if !s.ackElicitingInFlight() {
+			continue
+		}
+		anyInFlight = true
+		if space == appDataSpace && !c.handshakeConfirmed {
+			// Skip the Application Data space until the handshake is confirmed.
+			continue
+		}
+		t := s.lastAckEliciting.Add(c.loss.ptoPeriod(space))
+		if next.IsZero() || t.Before(next) {
+			next = t
+			nextSpace = space
+		}
+	}
+	if !anyInFlight && c.side == clientSide && !c.handshakeConfirmed {
+		// "[...] the client MUST set the PTO timer if the client has not
+		// received an acknowledgment for any of its Handshake packets and
+		// the handshake is not confirmed [...]"
+		// https://www.rfc-editor.org/rfc/rfc9002#section-6.2.2.1
+		space := initialSpace
+		if c.handshakeKeys.canWrite() {
+			space = handshakeSpace
+		}
+		last := c.spaces[space].lastAckEliciting
+		if last.IsZero() {
+			last = time.Now()
+		}
+		return space, last.Add(c.loss.ptoPeriod(space))
+	}
+	return nextSpace, next
+}
+
+// handleLossTimer handles expiration of the loss detection timer.
+// https://www.rfc-editor.org/rfc/rfc9002#appendix-A.9
+func (c *Conn) handleLossTimer(now time.Time) {
+	for space := initialSpace; space < numberSpaceCount; space++ {
+		s := &c.spaces[space]
+		if !s.lossTime.IsZero() && !now.Before(s.lossTime) {
+			c.detectLoss(now, space)
+			return
+		}
+	}
+	space, _ := c.ptoTime()
+	c.loss.ptoCount++
+	// Rather than sending new data in the probe, we retransmit the
+	// contents of every in-flight packet. This is permitted by
+	// RFC 9002, Section 6.2.4, and ensures progress when packets
+	// have been lost.
+	s := &c.spaces[space]
+	for _, p := range s.sent {
+		if p.acked || p.lost || !p.ackEliciting {
+			continue
+		}
+		p.lost = true
+		if p.inFlight {
+			c.loss.bytesInFlight -= p.size
+		}
+		c.packetLostFrames(space, p)
+	}
+	c.compactSent(space)
+	s.probe = true
+	s.lastAckEliciting = now
+}
+
+// canSendAmplified reports whether the server may send more data
+// before its peer's address is validated.
+// https://www.rfc-editor.org/rfc/rfc9000#section-8.1
+func (c *Conn) canSendAmplified() bool {
+	return c.side == clientSide || c.addrValidated || c.bytesSent < 3*c.bytesRecv
+}
+
+// packetAckedFrames processes the frames in a packet acknowledged by the peer.
+func (c *Conn) packetAckedFrames(space numberSpace, p *sentPacket) {
+	p.n = 0
+	for !p.done() {
+		switch f := p.next(); f {
+		case frameTypeAck:
+			// The peer has received our ACK; we need not acknowledge
+			// packets below the largest we acknowledged again.
+			largest := int64(p.nextInt())
+			s := &c.spaces[space]
+			if largest > 0 {
+				s.seen.sub(0, largest-maxAckRanges)
+			}
+		case frameTypeCrypto:
+			start, end := p.nextRange()
+			c.crypto[space].out.ack(start, end)
+		case frameTypeResetStream, frameTypeStopSending:
+			id := int64(p.nextInt())
+			if s := c.streams.m[id]; s != nil {
+				s.frameAcked(f)
+			}
+		case frameTypeMaxStreamData:
+			p.nextInt()
+		case frameTypeMaxData, frameTypeMaxStreamsBidi, frameTypeMaxStreamsUni,
+			frameTypeHandshakeDone, frameTypePathResponse:
+		default:
+			if f&^streamFinBit == frameTypeStreamBase {
+				id := int64(p.nextInt())
+				start, end := p.nextRange()
+				if s := c.streams.m[id]; s != nil {
+					s.dataAcked(start, end, f&streamFinBit != 0)
+				}
+			}
+		}
+	}
+}
+
+// packetLostFrames requeues the frames in a lost packet.
+func (c *Conn) packetLostFrames(space numberSpace, p *sentPacket) {
+	p.n = 0
+	for !p.done() {
+		switch f := p.next(); f {
+		case frameTypeAck:
+			p.nextInt()
+			// Any pending ack will be sent with the next packet.
+		case frameTypeCrypto:
+			start, end := p.nextRange()
+			c.crypto[space].out.lose(start, end)
+		case frameTypeResetStream, frameTypeStopSending:
+			id := int64(p.nextInt())
+			if s := c.streams.m[id]; s != nil {
+				s.frameLost(f)
+				c.streams.queue(s)
+			}
+		case frameTypeMaxStreamData:
+			id := int64(p.nextInt())
+			if s := c.streams.m[id]; s != nil {
+				s.needMaxStreamData = true
+				c.streams.queue(s)
+			}
+		case frameTypeMaxData:
+			c.streams.needMaxData = true
+		case frameTypeMaxStreamsBidi:
+			c.streams.needMaxStreams[bidiStream] = true
+		case frameTypeMaxStreamsUni:
+			c.streams.needMaxStreams[uniStream] = true
+		case frameTypeHandshakeDone:
+			c.needHandshakeDone = true
+		case frameTypePathResponse:
+			// PATH_RESPONSE frames are not retransmitted.
+		default:
+			if f&^streamFinBit == frameTypeStreamBase {
+				id := int64(p.nextInt())
+				start, end := p.nextRange()
+				if s := c.streams.m[id]; s != nil {
+					s.dataLost(start, end, f&streamFinBit != 0)
+					c.streams.queue(s)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,494 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"time"
+)
+
+// maxPendingPackets is the maximum number of packets we buffer
+// while waiting for the keys needed to decrypt them.
+const maxPendingPackets = 8
+
+// handleDatagram processes a datagram received from the peer.
+func (c *Conn) handleDatagram(now time.Time, buf []byte) {
+	if c.side == serverSide && !c.addrValidated {
+		c.bytesRecv += len(buf)
+	}
+	c.handlePackets(now, buf, len(buf))
+	for c.reprocess {
+		c.reprocess = false
+		pending := c.pending
+		c.pending = nil
+		for _, b := range pending {
+			c.handlePackets(now, b, len(b))
+		}
+	}
+}
+
+// handlePackets processes the packets in a datagram of size dgramSize.
+func (c *Conn) handlePackets(now time.Time, buf []byte, dgramSize int) {
+	for len(buf) > 0 && c.closeState != connDone {
+		var n int
+		switch ptype := getPacketType(buf); ptype {
+		case packetTypeInitial:
+			if c.side == serverSide && dgramSize < minimumClientInitialDatagramSize {
+				// "[...] a server MUST discard an Initial packet that is carried
+				// in a UDP datagram with a payload that is smaller than the
+				// smallest allowed maximum datagram size of 1200 bytes."
+				// https://www.rfc-editor.org/rfc/rfc9000#section-14.1-4
+				return
+			}
+			n = c.handleLongHeader(now, initialSpace, &c.initialKeys, buf)
+		case packetTypeHandshake:
+			n = c.handleLongHeader(now, handshakeSpace, &c.handshakeKeys, buf)
+		case packetType1RTT:
+			n = c.handle1RTT(now, buf)
+		default:
+			// Version Negotiation, Retry, and 0-RTT packets are not supported.
+			return
+		}
+		if n <= 0 {
+			return
+		}
+		buf = buf[n:]
+	}
+}
+
+// bufferPacket saves a packet which cannot be decrypted yet.
+func (c *Conn) bufferPacket(b []byte) {
+	if len(c.pending) < maxPendingPackets {
+		c.pending = append(c.pending, append([]byte(nil), b...))
+	}
+}
+
+// handleLongHeader processes an Initial or Handshake packet,
+// returning the length of the packet or -1 if the rest of the datagram
+// should be discarded.
+func (c *Conn) handleLongHeader(now time.Time, space numberSpace, k *fixedKeyPair, buf []byte) int {
+	n := skipLongHeaderPacket(buf)
+	if n < 0 {
+		return -1
+	}
+	if !k.canRead() {
+		if space == handshakeSpace && !c.handshakeConfirmed {
+			// We may not have the Handshake keys yet.
+			c.bufferPacket(buf[:n])
+		}
+		return n
+	}
+	s := &c.spaces[space]
+	p, pn := parseLongHeaderPacket(buf, k.r, s.largest)
+	if pn < 0 {
+		// Undecryptable; drop this packet but continue with the datagram.
+		return n
+	}
+	if p.version != quicVersion1 {
+		return -1
+	}
+	if !bytes.Equal(p.dstConnID, c.localConnID) &&
+		!(c.side == serverSide && space == initialSpace && bytes.Equal(p.dstConnID, c.origDstConnID)) {
+		return n
+	}
+	if c.side == clientSide && !c.gotPeerConnID {
+		// "[...] the client MUST change the Destination Connection ID
+		// it uses for sending packets in response to only the first
+		// received Initial or Retry packet."
+		// https://www.rfc-editor.org/rfc/rfc9000#section-7.2-6
+		c.remoteConnID = append([]byte(nil), p.srcConnID...)
+		c.gotPeerConnID = true
+	} else if !bytes.Equal(p.srcConnID, c.remoteConnID) {
+		return n
+	}
+	if c.side == serverSide && space == handshakeSpace {
+		// "[...] a server MUST discard Initial keys when it first
+		// successfully processes a Handshake packet."
+		// https://www.rfc-editor.org/rfc/rfc9001#section-4.9.1-2
+		c.addrValidated = true
+		c.discardKeys(now, initialSpace)
+	}
+	c.handlePayload(now, space, p.num, p.payload)
+	return pn
+}
+
+// handle1RTT processes a 1-RTT packet, which always extends
+// to the end of the datagram.
+func (c *Conn) handle1RTT(now time.Time, buf []byte) int {
+	if len(buf) < 1+connIDLen || !bytes.Equal(buf[1:1+connIDLen], c.localConnID) {
+		return -1
+	}
+	if !c.appKeys.canRead() {
+		c.bufferPacket(buf)
+		return len(buf)
+	}
+	s := &c.spaces[appDataSpace]
+	p, err := parse1RTTPacket(buf, &c.appKeys, connIDLen, s.largest)
+	if err != nil {
+		return -1
+	}
+	c.handlePayload(now, appDataSpace, p.num, p.payload)
+	return len(buf)
+}
+
+// handlePayload processes the frames in a decrypted packet.
+func (c *Conn) handlePayload(now time.Time, space numberSpace, num int64, payload []byte) {
+	s := &c.spaces[space]
+	if s.seen.contains(num) {
+		// Duplicate packet.
+		return
+	}
+	if len(payload) == 0 {
+		c.abort(now, localTransportError{code: errProtocolViolation, reason: "packet with no frames"})
+		return
+	}
+	if c.closeState == connClosing {
+		// "An endpoint in the closing state sends a packet containing
+		// a CONNECTION_CLOSE frame in response to any incoming packet
+		// that it attributes to the connection."
+		// https://www.rfc-editor.org/rfc/rfc9000#section-10.2.1-2
+		c.sendClose = true
+		return
+	}
+	if c.closeState != connOpen {
+		return
+	}
+	ackEliciting, err := c.handleFrames(now, space, payload)
+	if err != nil {
+		c.abort(now, err)
+		return
+	}
+	s = &c.spaces[space] // keys may have been discarded
+	s.received(now, num, ackEliciting)
+	c.resetIdleTimer(now)
+}
+
+// frameAllowedInSpace reports whether a frame type may appear in a number space.
+// https://www.rfc-editor.org/rfc/rfc9000#section-12.4
+func frameAllowedInSpace(typ uint64, space numberSpace) bool {
+	if space == appDataSpace {
+		return true
+	}
+	switch typ {
+	case frameTypePadding, frameTypePing, frameTypeAck, frameTypeAckECN,
+		frameTypeCrypto, frameTypeConnectionCloseTransport:
+		return true
+	}
+	return false
+}
+
+// handleFrames processes frames in a packet payload.
+// It reports whether the packet was ack-eliciting.
+func (c *Conn) handleFrames(now time.Time, space numberSpace, payload []byte) (ackEliciting bool, err error) {
+	errFrame := func(reason string) error {
+		return localTransportError{code: errFrameEncoding, reason: reason}
+	}
+	for len(payload) > 0 {
+		typ, n := consumeVarint(payload)
+		if n < 0 {
+			return false, errFrame("invalid frame type")
+		}
+		if !frameAllowedInSpace(typ, space) {
+			return false, localTransportError{code: errProtocolViolation, reason: "frame not allowed in packet"}
+		}
+		switch typ {
+		case frameTypePadding, frameTypeAck, frameTypeAckECN,
+			frameTypeConnectionCloseTransport, frameTypeConnectionCloseApplication:
+		default:
+			ackEliciting = true
+		}
+		b := payload[n:]
+		switch {
+		case typ == frameTypePadding:
+			// Skip all padding at once.
+			for len(b) > 0 && b[0] == frameTypePadding {
+				b = b[1:]
+			}
+			n = 0
+		case typ == frameTypePing:
+			n = 0
+		case typ == frameTypeAck || typ == frameTypeAckECN:
+			n, err = c.parseAndHandleAck(now, space, typ, b)
+		case typ == frameTypeResetStream:
+			var id, code, size uint64
+			id, code, size, n = consumeThreeVarints(b)
+			if n >= 0 {
+				err = c.handleResetStreamFrame(int64(id), code, int64(size))
+			}
+		case typ == frameTypeStopSending:
+			var id, code uint64
+			id, code, n = consumeTwoVarints(b)
+			if n >= 0 {
+				err = c.handleStopSendingFrame(int64(id), code)
+			}
+		case typ == frameTypeCrypto:
+			var off uint64
+			var data []byte
+			off, data, n = consumeOffsetAndData(b)
+			if n >= 0 {
+				err = c.handleCrypto(now, space, int64(off), data)
+			}
+		case typ == frameTypeNewToken:
+			var token []byte
+			token, n = consumeVarintBytes(b)
+			if n >= 0 && (c.side == serverSide || len(token) == 0) {
+				return false, errFrame("invalid NEW_TOKEN frame")
+			}
+			// Address validation tokens are not used.
+		case typ&^0x07 == frameTypeStreamBase:
+			n, err = c.parseAndHandleStream(typ, b)
+		case typ == frameTypeMaxData:
+			var max int64
+			max, n = consumeVarintInt64(b)
+			if n >= 0 {
+				c.handleMaxDataFrame(max)
+			}
+		case typ == frameTypeMaxStreamData:
+			var id, max uint64
+			id, max, n = consumeTwoVarints(b)
+			if n >= 0 {
+				err = c.handleMaxStreamDataFrame(int64(id), int64(max))
+			}
+		case typ == frameTypeMaxStreamsBidi, typ == frameTypeMaxStreamsUni:
+			var max int64
+			max, n = consumeVarintInt64(b)
+			if n >= 0 {
+				st := bidiStream
+				if typ == frameTypeMaxStreamsUni {
+					st = uniStream
+				}
+				err = c.handleMaxStreamsFrame(st, max)
+			}
+		case typ == frameTypeDataBlocked,
+			typ == frameTypeStreamsBlockedBidi, typ == frameTypeStreamsBlockedUni,
+			typ == frameTypeRetireConnectionID:
+			// We send flow control updates proactively, and never issue
+			// more than one connection ID, so these frames are informational.
+			_, n = consumeVarint(b)
+		case typ == frameTypeStreamDataBlocked:
+			_, _, n = consumeTwoVarints(b)
+		case typ == frameTypeNewConnectionID:
+			n = skipNewConnectionIDFrame(b)
+			// We continue using the peer's initial connection ID.
+		case typ == frameTypePathChallenge:
+			if len(b) < 8 {
+				n = -1
+				break
+			}
+			var data uint64
+			for _, v := range b[:8] {
+				data = data<<8 | uint64(v)
+			}
+			c.pathResponse = append(c.pathResponse, data)
+			n = 8
+		case typ == frameTypePathResponse:
+			if len(b) < 8 {
+				n = -1
+				break
+			}
+			// We never send PATH_CHALLENGE.
+			n = 8
+		case typ == frameTypeConnectionCloseTransport:
+			var code uint64
+			var reason []byte
+			code, n = consumeVarint(b)
+			if n >= 0 {
+				_, nn := consumeVarint(b[n:]) // frame type
+				if nn < 0 {
+					n = -1
+					break
+				}
+				n += nn
+				reason, nn = consumeVarintBytes(b[n:])
+				if nn < 0 {
+					n = -1
+					break
+				}
+				n += nn
+				c.enterDraining(now, peerTransportError{code: transportError(code), reason: string(reason)})
+				return ackEliciting, nil
+			}
+		case typ == frameTypeConnectionCloseApplication:
+			var code uint64
+			var reason []byte
+			code, n = consumeVarint(b)
+			if n >= 0 {
+				var nn int
+				reason, nn = consumeVarintBytes(b[n:])
+				if nn < 0 {
+					n = -1
+					break
+				}
+				c.enterDraining(now, &ApplicationError{Code: code, Reason: string(reason)})
+				return ackEliciting, nil
+			}
+		case typ == frameTypeHandshakeDone:
+			if c.side == serverSide {
+				return false, localTransportError{code: errProtocolViolation, reason: "client sent HANDSHAKE_DONE"}
+			}
+			n = 0
+			c.confirmHandshake(now)
+		default:
+			return false, errFrame("unknown frame type")
+		}
+		if err != nil {
+			return false, err
+		}
+		if n < 0 {
+			return false, errFrame("invalid frame")
+		}
+		payload = b[n:]
+		if c.closeState != connOpen {
+			return ackEliciting, nil
+		}
+	}
+	return ackEliciting, nil
+}
+
+// parseAndHandleAck parses and processes an ACK frame.
+// https://www.rfc-editor.org/rfc/rfc9000#section-19.3
+func (c *Conn) parseAndHandleAck(now time.Time, space numberSpace, typ uint64, b []byte) (int, error) {
+	n := 0
+	next := func() int64 {
+		if n < 0 {
+			return 0
+		}
+		v, nn := consumeVarintInt64(b[n:])
+		if nn < 0 {
+			n = -1
+			return 0
+		}
+		n += nn
+		return v
+	}
+	largest := next()
+	delay := next()
+	count := next()
+	first := next()
+	if n < 0 || first > largest {
+		return -1, nil
+	}
+	var acked rangeset
+	end := largest + 1
+	start := end - first - 1
+	acked.add(start, end)
+	for i := int64(0); i < count; i++ {
+		gap := next()
+		size := next()
+		if n < 0 {
+			return -1, nil
+		}
+		end = start - gap - 1
+		start = end - size - 1
+		if start < 0 {
+			return -1, nil
+		}
+		acked.add(start, end)
+	}
+	if typ == frameTypeAckECN {
+		next()
+		next()
+		next()
+	}
+	if n < 0 {
+		return -1, nil
+	}
+	exp := c.peerParams.ackDelayExponent
+	if !c.gotParams {
+		exp = ackDelayExponent
+	}
+	ackDelay := time.Duration(delay<<uint(exp)) * time.Microsecond
+	if ackDelay < 0 {
+		ackDelay = 0
+	}
+	return n, c.handleAck(now, space, largest, ackDelay, acked)
+}
+
+// parseAndHandleStream parses and processes a STREAM frame.
+// https://www.rfc-editor.org/rfc/rfc9000#section-19.8
+func (c *Conn) parseAndHandleStream(typ uint64, b []byte) (int, error) {
+	id, n := consumeVarint(b)
+	if n < 0 {
+		return -1, nil
+	}
+	var off uint64
+	if typ&streamOffBit != 0 {
+		var nn int
+		off, nn = consumeVarint(b[n:])
+		if nn < 0 {
+			return -1, nil
+		}
+		n += nn
+	}
+	var data []byte
+	if typ&streamLenBit != 0 {
+		var nn int
+		data, nn = consumeVarintBytes(b[n:])
+		if nn < 0 {
+			return -1, nil
+		}
+		n += nn
+	} else {
+		data = b[n:]
+		n = len(b)
+	}
+	return n, c.handleStreamFrame(int64(id), int64(off), data, typ&streamFinBit != 0)
+}
+
+func consumeTwoVarints(b []byte) (v1, v2 uint64, n int) {
+	v1, n1 := consumeVarint(b)
+	if n1 < 0 {
+		return 0, 0, -1
+	}
+	v2, n2 := consumeVarint(b[n1:])
+	if n2 < 0 {
+		return 0, 0, -1
+	}
+	return v1, v2, n1 + n2
+}
+
+func consumeThreeVarints(b []byte) (v1, v2, v3 uint64, n int) {
+	v1, v2, n = consumeTwoVarints(b)
+	if n < 0 {
+		return 0, 0, 0, -1
+	}
+	v3, n3 := consumeVarint(b[n:])
+	if n3 < 0 {
+		return 0, 0, 0, -1
+	}
+	return v1, v2, v3, n + n3
+}
+
+// consumeOffsetAndData parses the offset and data of a CRYPTO frame.
+func consumeOffsetAndData(b []byte) (off uint64, data []byte, n int) {
+	off, n = consumeVarint(b)
+	if n < 0 {
+		return 0, nil, -1
+	}
+	data, nn := consumeVarintBytes(b[n:])
+	if nn < 0 || off+uint64(len(data)) > maxVarint {
+		return 0, nil, -1
+	}
+	return off, data, n + nn
+}
+
+// skipNewConnectionIDFrame returns the length of a NEW_CONNECTION_ID frame body.
+// https://www.rfc-editor.org/rfc/rfc9000#section-19.15
+func skipNewConnectionIDFrame(b []byte) int {
+	_, _, n := consumeTwoVarints(b) // sequence number, retire prior to
+	if n < 0 {
+		return -1
+	}
+	id, nn := consumeUint8Bytes(b[n:])
+	if nn < 0 || len(id) < 1 || len(id) > maxConnIDLen {
+		return -1
+	}
+	n += nn
+	n += 16 // stateless reset token
+	if n > len(b) {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,282 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"time"
+)
+
+// maybeSend sends datagrams, if possible.
+func (c *Conn) maybeSend(now time.Time) {
+	switch c.closeState {
+	case connClosing:
+		if c.sendClose {
+			c.sendClose = false
+			c.sendConnectionClose(now)
+			c.closeSent()
+		}
+		return
+	case connDraining, connDone:
+		return
+	}
+	for {
+		buf := c.buildDatagram(now)
+		if len(buf) == 0 {
+			return
+		}
+		c.datagramSent(buf)
+		c.endpoint.sendDatagram(buf, c.peerAddr)
+	}
+}
+
+// datagramLimit returns the maximum size of the next datagram,
+// or 0 if we may not send.
+func (c *Conn) datagramLimit() int {
+	if c.side == serverSide && !c.addrValidated {
+		// "Prior to validating the client address, servers MUST NOT send
+		// more than three times as many bytes as the number of bytes they
+		// have received."
+		// https://www.rfc-editor.org/rfc/rfc9000#section-8.1-3
+		if 3*c.bytesRecv-c.bytesSent < maxUDPPayloadSize {
+			return 0
+		}
+	}
+	return maxUDPPayloadSize
+}
+
+func (c *Conn) datagramSent(buf []byte) {
+	if c.side == serverSide && !c.addrValidated {
+		c.bytesSent += len(buf)
+	}
+}
+
+// buildDatagram constructs the next datagram to send.
+// It returns an empty buffer if there is nothing to send.
+func (c *Conn) buildDatagram(now time.Time) []byte {
+	lim := c.datagramLimit()
+	if lim == 0 {
+		return nil
+	}
+	c.w.reset(lim)
+	ccLimited := !c.loss.canSend()
+
+	// Initial packet.
+	pad := false
+	var sentInitial *sentPacket
+	if k := c.initialKeys.w; k.isSet() {
+		s := &c.spaces[initialSpace]
+		p := c.longPacket(packetTypeInitial, s.nextNum)
+		c.w.startProtectedLongHeaderPacket(s.largestAcked, p)
+		c.appendFrames(now, initialSpace, ccLimited)
+		sentInitial = c.w.finishProtectedLongHeaderPacket(s.largestAcked, k, p)
+		if sentInitial != nil {
+			// Client Initial packets and ack-eliciting server Initial packets
+			// must be sent in datagrams padded to at least 1200 bytes.
+			// We add the padding after coalescing any other packets.
+			// https://www.rfc-editor.org/rfc/rfc9000#section-14.1
+			if c.side == clientSide || sentInitial.ackEliciting {
+				pad = true
+			}
+		}
+	}
+
+	// Handshake packet.
+	if k := c.handshakeKeys.w; k.isSet() {
+		s := &c.spaces[handshakeSpace]
+		p := c.longPacket(packetTypeHandshake, s.nextNum)
+		c.w.startProtectedLongHeaderPacket(s.largestAcked, p)
+		c.appendFrames(now, handshakeSpace, ccLimited)
+		if sent := c.w.finishProtectedLongHeaderPacket(s.largestAcked, k, p); sent != nil {
+			c.packetSent(now, handshakeSpace, sent)
+			if c.side == clientSide {
+				// "[...] a client MUST discard Initial keys when it first
+				// sends a Handshake packet [...]"
+				// https://www.rfc-editor.org/rfc/rfc9001#section-4.9.1-2
+				c.discardKeys(now, initialSpace)
+			}
+		}
+	}
+
+	// 1-RTT packet.
+	if c.appKeys.canWrite() {
+		s := &c.spaces[appDataSpace]
+		c.w.start1RTTPacket(s.nextNum, s.largestAcked, c.remoteConnID)
+		c.appendFrames(now, appDataSpace, ccLimited)
+		if pad && len(c.w.payload()) > 0 {
+			// 1-RTT packets extend to the end of the datagram,
+			// so padding must be added within the packet.
+			c.w.appendPaddingTo(minimumClientInitialDatagramSize)
+			pad = false
+		}
+		if sent := c.w.finish1RTTPacket(s.nextNum, s.largestAcked, c.remoteConnID, &c.appKeys); sent != nil {
+			c.packetSent(now, appDataSpace, sent)
+		}
+	}
+
+	buf := c.w.datagram()
+	if sentInitial != nil {
+		if pad {
+			// Pad the datagram with zeros, which the peer ignores
+			// as an invalid packet coalesced after the Initial packet.
+			// https://www.rfc-editor.org/rfc/rfc9000#section-14.1-1
+			for len(buf) < minimumClientInitialDatagramSize {
+				buf = append(buf, 0)
+				sentInitial.size++
+			}
+			sentInitial.inFlight = true
+		}
+		if c.initialKeys.canWrite() {
+			c.packetSent(now, initialSpace, sentInitial)
+		} else {
+			// The client discarded Initial keys after sending
+			// a Handshake packet in this datagram.
+			sentInitial.recycle()
+		}
+	}
+	return buf
+}
+
+func (c *Conn) longPacket(ptype packetType, num int64) longPacket {
+	return longPacket{
+		ptype:     ptype,
+		version:   quicVersion1,
+		num:       num,
+		dstConnID: c.remoteConnID,
+		srcConnID: c.localConnID,
+	}
+}
+
+// appendFrames appends frames to the current packet in a number space.
+// When ccLimited is set, the congestion window is full, and only
+// acknowledgements and probes may be sent.
+func (c *Conn) appendFrames(now time.Time, space numberSpace, ccLimited bool) {
+	s := &c.spaces[space]
+	w := &c.w
+	if s.ackNeeded {
+		var delay uint64
+		if space == appDataSpace {
+			delay = uint64(now.Sub(s.largestAt).Microseconds()) >> ackDelayExponent
+		}
+		if w.appendAckFrame(s.seen, delay) {
+			s.ackNeeded = false
+		}
+	}
+	if ccLimited && !s.probe {
+		return
+	}
+	defer func() {
+		if s.probe && !w.sent.ackEliciting {
+			if w.appendPingFrame() {
+				s.probe = false
+			}
+		} else if w.sent.ackEliciting {
+			s.probe = false
+		}
+	}()
+
+	cs := &c.crypto[space]
+	for cs.out.hasPending(maxVarint) {
+		off, end, _ := cs.out.next(maxVarint)
+		b, ok := w.appendCryptoFrame(off, int(end-off))
+		if !ok {
+			return
+		}
+		copy(b, cs.out.bytes(off, off+int64(len(b))))
+		cs.out.markSent(off, off+int64(len(b)))
+		if off+int64(len(b)) < end {
+			return
+		}
+	}
+	if space != appDataSpace {
+		return
+	}
+	if c.needHandshakeDone {
+		if !w.appendHandshakeDoneFrame() {
+			return
+		}
+		c.needHandshakeDone = false
+	}
+	for len(c.pathResponse) > 0 {
+		if !w.appendPathResponseFrame(c.pathResponse[0]) {
+			return
+		}
+		c.pathResponse = c.pathResponse[1:]
+	}
+	if !c.handshakeDone {
+		return
+	}
+	c.appendStreamFrames(w)
+}
+
+// sendConnectionClose sends a datagram containing CONNECTION_CLOSE frames.
+// https://www.rfc-editor.org/rfc/rfc9000#section-10.2.3
+func (c *Conn) sendConnectionClose(now time.Time) {
+	c.w.reset(maxUDPPayloadSize)
+	var (
+		code   = errApplicationError
+		reason string
+		app    *ApplicationError
+	)
+	switch e := c.closeFrame.(type) {
+	case localTransportError:
+		code, reason = e.code, e.reason
+	case *ApplicationError:
+		app = e
+	default:
+		code = errInternal
+	}
+	appendClose := func(space numberSpace) {
+		if space == appDataSpace && app != nil {
+			c.w.appendConnectionCloseApplicationFrame(app.Code, app.Reason)
+		} else {
+			// Application errors may not be sent in Initial or Handshake
+			// packets, so we send APPLICATION_ERROR instead.
+			c.w.appendConnectionCloseTransportFrame(code, 0, reason)
+		}
+	}
+	closePacket := func(space numberSpace, sent *sentPacket) {
+		if sent != nil {
+			c.spaces[space].nextNum++
+			sent.recycle()
+		}
+	}
+	sentInitial := false
+	if k := c.initialKeys.w; k.isSet() && !c.handshakeConfirmed {
+		s := &c.spaces[initialSpace]
+		p := c.longPacket(packetTypeInitial, s.nextNum)
+		c.w.startProtectedLongHeaderPacket(s.largestAcked, p)
+		appendClose(initialSpace)
+		sent := c.w.finishProtectedLongHeaderPacket(s.largestAcked, k, p)
+		sentInitial = sent != nil
+		closePacket(initialSpace, sent)
+	}
+	if k := c.handshakeKeys.w; k.isSet() && !c.handshakeConfirmed {
+		s := &c.spaces[handshakeSpace]
+		p := c.longPacket(packetTypeHandshake, s.nextNum)
+		c.w.startProtectedLongHeaderPacket(s.largestAcked, p)
+		appendClose(handshakeSpace)
+		closePacket(handshakeSpace, c.w.finishProtectedLongHeaderPacket(s.largestAcked, k, p))
+	}
+	if c.appKeys.canWrite() {
+		s := &c.spaces[appDataSpace]
+		c.w.start1RTTPacket(s.nextNum, s.largestAcked, c.remoteConnID)
+		appendClose(appDataSpace)
+		closePacket(appDataSpace, c.w.finish1RTTPacket(s.nextNum, s.largestAcked, c.remoteConnID, &c.appKeys))
+	}
+	buf := c.w.datagram()
+	if len(buf) == 0 {
+		return
+	}
+	if sentInitial && c.side == clientSide {
+		for len(buf) < minimumClientInitialDatagramSize {
+			buf = append(buf, 0)
+		}
+	}
+	if lim := c.datagramLimit(); lim == 0 {
+		return
+	}
+	c.datagramSent(buf)
+	c.endpoint.sendDatagram(buf, c.peerAddr)
+}
@@ -0,0 +1,374 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+)
+
+// streamsState is the stream-related state of a connection.
+type streamsState struct {
+	side side
+	m    map[int64]*Stream
+
+	// Locally-initiated streams.
+	localLimit  [2]int64 // peer's MAX_STREAMS limit
+	localOpened [2]int64 // number of streams opened
+
+	// Peer-initiated streams.
+	maxRemote      [2]int64  // configured limit on concurrent peer streams
+	remoteLimit    [2]int64  // our MAX_STREAMS limit
+	remoteOpened   [2]int64  // number of streams opened by the peer
+	remoteClosed   [2]int64  // number of peer streams which are done
+	needMaxStreams [2]bool   // MAX_STREAMS frame needs to be sent
+	acceptq        []*Stream // streams waiting to be accepted
+
+	// Streams with frames to send.
+	sendq []*Stream
+
+	// Connection-level flow control for data we receive.
+	inWindow    int64 // size of the connection receive window
+	inMaxData   int64 // our MAX_DATA limit
+	inRecvd     int64 // sum of the highest offsets received on each stream
+	inConsumed  int64 // amount of received data consumed (read or discarded)
+	needMaxData bool  // MAX_DATA frame needs to be sent
+
+	// Connection-level flow control for data we send.
+	outMaxData int64 // peer's MAX_DATA limit
+	outSent    int64 // amount of new stream data sent
+
+	// Peer's initial stream flow control limits.
+	peerMaxStreamDataBidiLocal  int64
+	peerMaxStreamDataBidiRemote int64
+	peerMaxStreamDataUni        int64
+
+	streamReadBufferSize  int64
+	streamWriteBufferSize int64
+}
+
+func (ss *streamsState) init(side side, config *Config) {
+	ss.side = side
+	ss.m = make(map[int64]*Stream)
+	ss.maxRemote[bidiStream] = config.maxBidiRemoteStreams()
+	ss.maxRemote[uniStream] = config.maxUniRemoteStreams()
+	ss.remoteLimit = ss.maxRemote
+	ss.inWindow = config.maxConnReadBufferSize()
+	ss.inMaxData = ss.inWindow
+	ss.streamReadBufferSize = config.maxStreamReadBufferSize()
+	ss.streamWriteBufferSize = config.maxStreamWriteBufferSize()
+}
+
+// setPeerParams records the stream limits from the peer's transport parameters.
+func (ss *streamsState) setPeerParams(p transportParameters) {
+	ss.localLimit[bidiStream] = p.initialMaxStreamsBidi
+	ss.localLimit[uniStream] = p.initialMaxStreamsUni
+	ss.outMaxData = p.initialMaxData
+	ss.peerMaxStreamDataBidiLocal = p.initialMaxStreamDataBidiLocal
+	ss.peerMaxStreamDataBidiRemote = p.initialMaxStreamDataBidiRemote
+	ss.peerMaxStreamDataUni = p.initialMaxStreamDataUni
+}
+
+// queue adds a stream to the send queue.
+func (ss *streamsState) queue(s *Stream) {
+	if s.queued {
+		return
+	}
+	s.queued = true
+	s.blocked = false
+	ss.sendq = append(ss.sendq, s)
+}
+
+// consumed records that n bytes of received data have been read or discarded,
+// and extends the connection's flow control window as needed.
+func (ss *streamsState) consumed(n int64) {
+	ss.inConsumed += n
+	// Send MAX_DATA when half the window has been consumed.
+	if ss.inMaxData-ss.inConsumed < ss.inWindow/2 {
+		ss.inMaxData = ss.inConsumed + ss.inWindow
+		ss.needMaxData = true
+	}
+}
+
+// newLocalStream creates a locally-initiated stream.
+func (c *Conn) newLocalStream(ctx context.Context, typ streamType) (*Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.handshakeDone {
+		// The peer's transport parameters may not have been received yet.
+		if err := c.wait(ctx, func() bool { return c.handshakeDone }); err != nil {
+			return nil, err
+		}
+	}
+	ss := &c.streams
+	if err := c.wait(ctx, func() bool {
+		return ss.localOpened[typ] < ss.localLimit[typ]
+	}); err != nil {
+		return nil, err
+	}
+	if c.closeErr != nil {
+		return nil, c.closeErr
+	}
+	num := ss.localOpened[typ]
+	ss.localOpened[typ]++
+	s := newStream(c, newStreamID(c.side, typ, num))
+	if typ == bidiStream {
+		s.initRecv(ss.streamReadBufferSize)
+		s.initSend(ss.peerMaxStreamDataBidiRemote, ss.streamWriteBufferSize)
+	} else {
+		s.initSend(ss.peerMaxStreamDataUni, ss.streamWriteBufferSize)
+	}
+	ss.m[s.id] = s
+	return s, nil
+}
+
+// streamDirection is the direction of a frame relative to a stream.
+type streamDirection int
+
+const (
+	recvFrame = streamDirection(iota) // frame carries data from the peer
+	sendFrame                         // frame controls data we send
+)
+
+// streamForFrame returns the stream referenced by a received frame,
+// creating peer-initiated streams as needed.
+// It returns nil (and no error) if the stream has been closed.
+func (c *Conn) streamForFrame(id int64, dir streamDirection) (*Stream, error) {
+	ss := &c.streams
+	initiator := streamIDInitiator(id)
+	typ := streamIDType(id)
+	num := streamIDNum(id)
+	if typ == uniStream {
+		if dir == recvFrame && initiator == c.side {
+			return nil, localTransportError{code: errStreamState, reason: "received data on send-only stream"}
+		}
+		if dir == sendFrame && initiator != c.side {
+			return nil, localTransportError{code: errStreamState, reason: "received send control frame on receive-only stream"}
+		}
+	}
+	if initiator == c.side {
+		if num >= ss.localOpened[typ] {
+			return nil, localTransportError{code: errStreamState, reason: "frame for unopened stream"}
+		}
+		return ss.m[id], nil
+	}
+	if num >= ss.remoteLimit[typ] {
+		return nil, localTransportError{code: errStreamLimit, reason: "stream limit exceeded"}
+	}
+	for ss.remoteOpened[typ] <= num {
+		sid := newStreamID(initiator, typ, ss.remoteOpened[typ])
+		ss.remoteOpened[typ]++
+		s := newStream(c, sid)
+		s.initRecv(ss.streamReadBufferSize)
+		if typ == bidiStream {
+			s.initSend(ss.peerMaxStreamDataBidiLocal, ss.streamWriteBufferSize)
+		}
+		ss.m[sid] = s
+		ss.acceptq = append(ss.acceptq, s)
+		c.cond.Broadcast()
+	}
+	return ss.m[id], nil
+}
+
+// maybeRemoveStream forgets a stream once both directions are done.
+func (c *Conn) maybeRemoveStream(s *Stream) {
+	if !s.isDone() {
+		return
+	}
+	ss := &c.streams
+	if ss.m[s.id] != s {
+		return
+	}
+	delete(ss.m, s.id)
+	if streamIDInitiator(s.id) != c.side {
+		// Allow the peer to open another stream in place of this one.
+		typ := streamIDType(s.id)
+		ss.remoteClosed[typ]++
+		ss.remoteLimit[typ] = ss.remoteClosed[typ] + ss.maxRemote[typ]
+		ss.needMaxStreams[typ] = true
+	}
+}
+
+// handleStreamFrame processes a STREAM frame.
+func (c *Conn) handleStreamFrame(id, off int64, data []byte, fin bool) error {
+	s, err := c.streamForFrame(id, recvFrame)
+	if err != nil || s == nil {
+		return err
+	}
+	end := off + int64(len(data))
+	if end > maxVarint {
+		return localTransportError{code: errFlowControl, reason: "stream offset too large"}
+	}
+	if err := s.checkFinalSize(end, fin); err != nil {
+		return err
+	}
+	if end > s.inMax {
+		return localTransportError{code: errFlowControl, reason: "stream flow control limit exceeded"}
+	}
+	if err := c.streamReceived(s, end); err != nil {
+		return err
+	}
+	if s.inCanceled || s.inErr != nil {
+		// Data after CancelRead or RESET_STREAM is discarded.
+		s.creditConsumed(s.inHighest)
+	} else {
+		s.in.write(off, data)
+	}
+	c.cond.Broadcast()
+	c.maybeRemoveStream(s)
+	return nil
+}
+
+// streamReceived updates connection-level flow control accounting
+// after receiving stream data up to end.
+func (c *Conn) streamReceived(s *Stream, end int64) error {
+	if end <= s.inHighest {
+		return nil
+	}
+	ss := &c.streams
+	ss.inRecvd += end - s.inHighest
+	s.inHighest = end
+	if ss.inRecvd > ss.inMaxData {
+		return localTransportError{code: errFlowControl, reason: "connection flow control limit exceeded"}
+	}
+	return nil
+}
+
+// handleResetStreamFrame processes a RESET_STREAM frame.
+func (c *Conn) handleResetStreamFrame(id int64, code uint64, finalSize int64) error {
+	s, err := c.streamForFrame(id, recvFrame)
+	if err != nil || s == nil {
+		return err
+	}
+	if err := s.checkFinalSize(finalSize, true); err != nil {
+		return err
+	}
+	if err := c.streamReceived(s, finalSize); err != nil {
+		return err
+	}
+	if s.inErr == nil {
+		s.inErr = StreamErrorCode(code)
+	}
+	s.inStopState = frameAcked // no need to send STOP_SENDING
+	s.in = recvBuffer{start: s.in.start}
+	s.creditConsumed(finalSize)
+	c.cond.Broadcast()
+	c.maybeRemoveStream(s)
+	return nil
+}
+
+// handleStopSendingFrame processes a STOP_SENDING frame.
+func (c *Conn) handleStopSendingFrame(id int64, code uint64) error {
+	s, err := c.streamForFrame(id, sendFrame)
+	if err != nil || s == nil {
+		return err
+	}
+	if s.outErr == nil {
+		s.outErr = StreamErrorCode(code)
+	}
+	// "An endpoint that receives a STOP_SENDING frame MUST send
+	// a RESET_STREAM frame if the stream is in the "Ready" or
+	// "Send" state."
+	// https://www.rfc-editor.org/rfc/rfc9000#section-3.5-4
+	s.resetLocked(code)
+	c.cond.Broadcast()
+	return nil
+}
+
+// handleMaxStreamDataFrame processes a MAX_STREAM_DATA frame.
+func (c *Conn) handleMaxStreamDataFrame(id, max int64) error {
+	s, err := c.streamForFrame(id, sendFrame)
+	if err != nil || s == nil {
+		return err
+	}
+	if max > s.outMax {
+		s.outMax = max
+		if s.hasDataToSend() {
+			c.streams.queue(s)
+		}
+	}
+	return nil
+}
+
+// handleMaxDataFrame processes a MAX_DATA frame.
+func (c *Conn) handleMaxDataFrame(max int64) {
+	if max > c.streams.outMaxData {
+		c.streams.outMaxData = max
+		c.unblockStreams()
+	}
+}
+
+// handleMaxStreamsFrame processes a MAX_STREAMS frame.
+func (c *Conn) handleMaxStreamsFrame(typ streamType, max int64) error {
+	if max > maxStreamsLimit {
+		return localTransportError{code: errFrameEncoding, reason: "MAX_STREAMS too large"}
+	}
+	if max > c.streams.localLimit[typ] {
+		c.streams.localLimit[typ] = max
+		c.cond.Broadcast()
+	}
+	return nil
+}
+
+// appendStreamFrames appends stream-related frames to the current 1-RTT packet.
+// It reports whether the packet is full.
+func (c *Conn) appendStreamFrames(w *packetWriter) (full bool) {
+	ss := &c.streams
+	if ss.needMaxData {
+		if !w.appendMaxDataFrame(ss.inMaxData) {
+			return true
+		}
+		ss.needMaxData = false
+	}
+	for _, typ := range []streamType{bidiStream, uniStream} {
+		if ss.needMaxStreams[typ] {
+			if !w.appendMaxStreamsFrame(typ, ss.remoteLimit[typ]) {
+				return true
+			}
+			ss.needMaxStreams[typ] = false
+		}
+	}
+	for len(ss.sendq) > 0 {
+		s := ss.sendq[0]
+		if !s.appendFrames(w) {
+			return true
+		}
+		s.queued = false
+		ss.sendq[0] = nil
+		ss.sendq = ss.sendq[1:]
+		if s.hasDataToSend() {
+			// The stream is blocked by flow control,
+			// and is requeued when the limit increases.
+			s.blocked = true
+		}
+		c.maybeRemoveStream(s)
+	}
+	if len(ss.sendq) == 0 {
+		ss.sendq = nil
+	}
+	return false
+}
+
+// unblockStreams requeues streams blocked by connection-level flow control.
+func (c *Conn) unblockStreams() {
+	for _, s := range c.streams.m {
+		if s.blocked {
+			c.streams.queue(s)
+		}
+	}
+}
+
+// wantStreamSend reports whether there are stream frames to send.
+func (c *Conn) wantStreamSend() bool {
+	ss := &c.streams
+	if ss.needMaxData || ss.needMaxStreams[bidiStream] || ss.needMaxStreams[uniStream] {
+		return true
+	}
+	for _, s := range ss.sendq {
+		if s.wantSend() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,350 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http/internal/testcert"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testALPN = "quic-test"
+
+func newTestConfig(t *testing.T) *Config {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Config{
+		TLSConfig: &tls.Config{
+			Certificates:       []tls.Certificate{cert},
+			InsecureSkipVerify: true,
+			NextProtos:         []string{testALPN},
+		},
+	}
+}
+
+// newLocalConnPair returns a connected client and server connection over loopback.
+// The client's packet connection is wrapped by wrap, if non-nil.
+func newLocalConnPair(t *testing.T, serverConfig, clientConfig *Config, wrap func(net.PacketConn) net.PacketConn) (client, server *Conn) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	se, err := Listen("udp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrap != nil {
+		pc = wrap(pc)
+	}
+	ce := NewEndpoint(pc, nil)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		ce.Close(ctx)
+		se.Close(ctx)
+	})
+
+	client, err = ce.Dial(ctx, "udp", se.LocalAddr().String(), clientConfig)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	server, err = se.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	return client, server
+}
+
+func TestConnHandshake(t *testing.T) {
+	client, server := newLocalConnPair(t, newTestConfig(t), newTestConfig(t), nil)
+	for _, c := range []*Conn{client, server} {
+		cs := c.ConnectionState()
+		if !cs.HandshakeComplete || cs.Version != tls.VersionTLS13 {
+			t.Errorf("ConnectionState = %+v, want completed TLS 1.3 handshake", cs)
+		}
+		if cs.NegotiatedProtocol != testALPN {
+			t.Errorf("NegotiatedProtocol = %q, want %q", cs.NegotiatedProtocol, testALPN)
+		}
+	}
+}
+
+func TestConnHandshakeFailure(t *testing.T) {
+	se, err := Listen("udp", "127.0.0.1:0", newTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer se.Close(context.Background())
+	ce, err := Listen("udp", "127.0.0.1:0", newTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ce.Close(context.Background())
+
+	config := newTestConfig(t)
+	config.TLSConfig.InsecureSkipVerify = false
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := ce.Dial(ctx, "udp", se.LocalAddr().String(), config); err == nil {
+		t.Fatal("Dial with untrusted certificate succeeded, want error")
+	}
+}
+
+func testStreamEcho(t *testing.T, client, server *Conn, size int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	want := make([]byte, size)
+	for i := range want {
+		want[i] = byte(i * 7)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		s, err := server.AcceptStream(ctx)
+		if err != nil {
+			errc <- err
+			return
+		}
+		_, err = io.Copy(s, s)
+		s.CloseWrite()
+		errc <- err
+	}()
+
+	s, err := client.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		s.Write(want)
+		s.CloseWrite()
+	}()
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatalf("reading echoed data: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("server: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("echoed %v bytes, want %v bytes (equal: %v)", len(got), len(want), bytes.Equal(got, want))
+	}
+}
+
+func TestStreamEcho(t *testing.T) {
+	client, server := newLocalConnPair(t, newTestConfig(t), newTestConfig(t), nil)
+	testStreamEcho(t, client, server, 1)
+	testStreamEcho(t, client, server, 3<<20)
+}
+
+func TestStreamFlowControl(t *testing.T) {
+	// Small receive windows force frequent MAX_DATA and MAX_STREAM_DATA updates.
+	serverConfig := newTestConfig(t)
+	serverConfig.MaxStreamReadBufferSize = 4000
+	serverConfig.MaxConnReadBufferSize = 10000
+	clientConfig := newTestConfig(t)
+	clientConfig.MaxStreamReadBufferSize = 3000
+	clientConfig.MaxConnReadBufferSize = 5000
+	client, server := newLocalConnPair(t, serverConfig, clientConfig, nil)
+	testStreamEcho(t, client, server, 100000)
+}
+
+// A lossyPacketConn drops every nth datagram it sends,
+// and every nth datagram it receives.
+type lossyPacketConn struct {
+	net.PacketConn
+	n int
+
+	mu                   sync.Mutex
+	sendCount, recvCount int
+}
+
+func (c *lossyPacketConn) drop(count *int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*count++
+	return *count%c.n == 0
+}
+
+func (c *lossyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if c.drop(&c.sendCount) {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func (c *lossyPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(b)
+		if err != nil || !c.drop(&c.recvCount) {
+			return n, addr, err
+		}
+	}
+}
+
+func TestStreamPacketLoss(t *testing.T) {
+	wrap := func(pc net.PacketConn) net.PacketConn {
+		return &lossyPacketConn{PacketConn: pc, n: 5}
+	}
+	client, server := newLocalConnPair(t, newTestConfig(t), newTestConfig(t), wrap)
+	testStreamEcho(t, client, server, 200000)
+}
+
+func TestStreamLimits(t *testing.T) {
+	serverConfig := newTestConfig(t)
+	serverConfig.MaxBidiRemoteStreams = 2
+	client, server := newLocalConnPair(t, serverConfig, newTestConfig(t), nil)
+	// The client may only have two streams open at once,
+	// so this requires the server to raise the limit as streams complete.
+	for i := 0; i < 10; i++ {
+		testStreamEcho(t, client, server, 10)
+	}
+}
+
+func TestUniStreams(t *testing.T) {
+	client, server := newLocalConnPair(t, newTestConfig(t), newTestConfig(t), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s, err := server.NewSendOnlyStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsWriteOnly() {
+		t.Errorf("NewSendOnlyStream: IsWriteOnly() = false, want true")
+	}
+	if _, err := s.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Read on send-only stream succeeded, want error")
+	}
+	s.Write([]byte("hello"))
+	s.CloseWrite()
+
+	r, err := client.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.IsReadOnly() {
+		t.Errorf("accepted uni stream: IsReadOnly() = false, want true")
+	}
+	if _, err := r.Write([]byte("x")); err == nil {
+		t.Errorf("Write on receive-only stream succeeded, want error")
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("ReadAll = %q, %v; want %q, nil", got, err, "hello")
+	}
+}
+
+func TestStreamCancelWrite(t *testing.T) {
+	client, server := newLocalConnPair(t, newTestConfig(t), newTestConfig(t), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s, err := client.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write([]byte("data"))
+	s.CancelWrite(42)
+
+	r, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(r)
+	if got, want := err, StreamErrorCode(42); got != want {
+		t.Errorf("read from reset stream: err = %v, want %v", got, want)
+	}
+}
+
+func TestStreamCancelRead(t *testing.T) {
+	client, server := newLocalConnPair(t, newTestConfig(t), newTestConfig(t), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s, err := client.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write([]byte("data"))
+	r, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.CancelRead(7)
+
+	// The client's writes fail once it receives STOP_SENDING.
+	buf := make([]byte, 1024)
+	for {
+		if _, err = s.WriteContext(ctx, buf); err != nil {
+			break
+		}
+	}
+	if got, want := err, StreamErrorCode(7); got != want {
+		t.Errorf("write to stream after peer CancelRead: err = %v, want %v", got, want)
+	}
+}
+
+func TestConnAbort(t *testing.T) {
+	client, server := newLocalConnPair(t, newTestConfig(t), newTestConfig(t), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client.Abort(&ApplicationError{Code: 3, Reason: "bye"})
+	_, err := server.AcceptStream(ctx)
+	var ae *ApplicationError
+	if !errors.As(err, &ae) || ae.Code != 3 || ae.Reason != "bye" {
+		t.Fatalf("AcceptStream after peer Abort: err = %v, want ApplicationError{3, bye}", err)
+	}
+	select {
+	case <-server.Done():
+	case <-ctx.Done():
+		t.Fatal("server connection not done after peer Abort")
+	}
+	if _, err := client.NewStream(ctx); err == nil {
+		t.Fatal("NewStream on closed connection succeeded, want error")
+	}
+}
+
+func TestConnIdleTimeout(t *testing.T) {
+	serverConfig := newTestConfig(t)
+	serverConfig.MaxIdleTimeout = 100 * time.Millisecond
+	client, server := newLocalConnPair(t, serverConfig, newTestConfig(t), nil)
+	for _, c := range []*Conn{client, server} {
+		select {
+		case <-c.Done():
+		case <-time.After(10 * time.Second):
+			t.Fatal("connection not closed after idle timeout")
+		}
+		if err := c.Err(); err != errIdleTimeout {
+			t.Errorf("Err() = %v, want %v", err, errIdleTimeout)
+		}
+	}
+}
+
+func TestConnKeepAlive(t *testing.T) {
+	serverConfig := newTestConfig(t)
+	serverConfig.MaxIdleTimeout = 500 * time.Millisecond
+	clientConfig := newTestConfig(t)
+	clientConfig.KeepAlivePeriod = 50 * time.Millisecond
+	client, server := newLocalConnPair(t, serverConfig, clientConfig, nil)
+	select {
+	case <-server.Done():
+		t.Fatalf("connection closed despite keep-alives: %v", server.Err())
+	case <-time.After(1500 * time.Millisecond):
+	}
+	testStreamEcho(t, client, server, 10)
+}
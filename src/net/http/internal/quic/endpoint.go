@@ -0,0 +1,246 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// An Endpoint handles QUIC traffic on a network address.
+// It can accept inbound connections or create outbound ones.
+//
+// Multiple goroutines may invoke methods on an Endpoint simultaneously.
+type Endpoint struct {
+	pc           net.PacketConn
+	listenConfig *Config
+
+	acceptc chan *Conn    // connections established by the peer
+	closec  chan struct{} // closed when the endpoint is closed
+	readc   chan struct{} // closed when the read loop exits
+
+	mu      sync.Mutex
+	conns   map[string]*Conn // connections by connection ID
+	connSet map[*Conn]struct{}
+	closing bool
+}
+
+// acceptQueueSize is the number of established connections
+// that may wait to be accepted.
+const acceptQueueSize = 64
+
+// Listen listens on a local network address.
+// The configuration config must be non-nil.
+func Listen(network, address string, config *Config) (*Endpoint, error) {
+	if config.TLSConfig == nil {
+		return nil, errors.New("quic: TLSConfig is not set")
+	}
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewEndpoint(pc, config), nil
+}
+
+// NewEndpoint returns an endpoint using the provided packet connection.
+// If config is non-nil, the endpoint accepts inbound connections.
+// The endpoint takes ownership of pc, and closes it when the endpoint is closed.
+func NewEndpoint(pc net.PacketConn, config *Config) *Endpoint {
+	e := &Endpoint{
+		pc:           pc,
+		listenConfig: config,
+		acceptc:      make(chan *Conn, acceptQueueSize),
+		closec:       make(chan struct{}),
+		readc:        make(chan struct{}),
+		conns:        make(map[string]*Conn),
+		connSet:      make(map[*Conn]struct{}),
+	}
+	go e.readLoop()
+	return e
+}
+
+// LocalAddr returns the local network address.
+func (e *Endpoint) LocalAddr() net.Addr {
+	return e.pc.LocalAddr()
+}
+
+// Close closes the endpoint.
+//
+// Close closes all connections on the endpoint,
+// waiting until the context is done for the peers to be notified,
+// and then closes the underlying packet connection.
+func (e *Endpoint) Close(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.closing {
+		e.closing = true
+		close(e.closec)
+	}
+	conns := make([]*Conn, 0, len(e.connSet))
+	for c := range e.connSet {
+		conns = append(conns, c)
+	}
+	e.mu.Unlock()
+
+	for _, c := range conns {
+		c.Abort(localTransportError{code: errNo})
+	}
+	for _, c := range conns {
+		select {
+		case <-c.closeSentc:
+		case <-ctx.Done():
+		}
+	}
+	for _, c := range conns {
+		c.exit()
+	}
+	err := e.pc.Close()
+	<-e.readc
+	for _, c := range conns {
+		<-c.donec
+	}
+	return err
+}
+
+// Accept waits for and returns the next connection to the endpoint.
+func (e *Endpoint) Accept(ctx context.Context) (*Conn, error) {
+	select {
+	case c := <-e.acceptc:
+		return c, nil
+	case <-e.closec:
+		return nil, errEndpointClosed
+	case <-e.readc:
+		// The packet connection was closed.
+		return nil, errEndpointClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Dial creates and returns a connection to a network address.
+// It waits for the handshake to complete.
+func (e *Endpoint) Dial(ctx context.Context, network, address string, config *Config) (*Conn, error) {
+	u, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	if e.closing {
+		e.mu.Unlock()
+		return nil, errEndpointClosed
+	}
+	c, err := newConn(time.Now(), clientSide, nil, nil, u, config, e)
+	if err != nil {
+		e.mu.Unlock()
+		return nil, err
+	}
+	e.addConnLocked(c)
+	e.mu.Unlock()
+	if err := c.waitHandshake(ctx); err != nil {
+		c.Abort(nil)
+		return nil, err
+	}
+	return c, nil
+}
+
+func (e *Endpoint) addConnLocked(c *Conn) {
+	e.connSet[c] = struct{}{}
+	e.conns[string(c.localConnID)] = c
+	if c.side == serverSide {
+		// The client continues to use the original destination
+		// connection ID until it receives a packet from us.
+		e.conns[string(c.origDstConnID)] = c
+	}
+}
+
+// removeConn forgets a connection whose loop has exited.
+func (e *Endpoint) removeConn(c *Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.connSet, c)
+	for _, id := range [][]byte{c.localConnID, c.origDstConnID} {
+		if e.conns[string(id)] == c {
+			delete(e.conns, string(id))
+		}
+	}
+}
+
+// serverConnEstablished queues a server connection for Accept
+// once its handshake completes.
+func (e *Endpoint) serverConnEstablished(c *Conn) {
+	select {
+	case e.acceptc <- c:
+	default:
+		// The accept queue is full; refuse the connection.
+		c.closeLocked(time.Now(), localTransportError{code: errConnectionRefused}, errConnClosed)
+	}
+}
+
+// sendDatagram sends a datagram to addr.
+func (e *Endpoint) sendDatagram(b []byte, addr net.Addr) {
+	// Errors are ignored; lost datagrams are handled by loss recovery.
+	e.pc.WriteTo(b, addr)
+}
+
+func (e *Endpoint) readLoop() {
+	defer close(e.readc)
+	buf := make([]byte, 1<<16)
+	for {
+		n, addr, err := e.pc.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		if n == 0 {
+			continue
+		}
+		e.handleDatagram(append([]byte(nil), buf[:n]...), addr)
+	}
+}
+
+// handleDatagram routes a datagram to its connection,
+// creating a new server connection if needed.
+func (e *Endpoint) handleDatagram(b []byte, addr net.Addr) {
+	id, ok := dstConnIDForDatagram(b)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	c := e.conns[string(id)]
+	e.mu.Unlock()
+	if c != nil {
+		c.deliver(b)
+		return
+	}
+	if e.listenConfig == nil || getPacketType(b) != packetTypeInitial || len(b) < minimumClientInitialDatagramSize {
+		// No stateless resets or version negotiation.
+		return
+	}
+	p, n := parseLongHeaderPacket(b, fixedKeys{}, -1)
+	if n < 0 || p.version != quicVersion1 || len(p.dstConnID) < 8 {
+		// "This Destination Connection ID MUST be at least 8 bytes in length."
+		// https://www.rfc-editor.org/rfc/rfc9000#section-7.2-3
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closing {
+		return
+	}
+	if c := e.conns[string(id)]; c != nil {
+		c.deliver(b)
+		return
+	}
+	c, err := newConn(time.Now(), serverSide, append([]byte(nil), p.dstConnID...), append([]byte(nil), p.srcConnID...), addr, e.listenConfig, e)
+	if err != nil {
+		return
+	}
+	e.addConnLocked(c)
+	c.deliver(b)
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Test vectors from RFC 9001, Appendix A.
+func TestInitialKeys(t *testing.T) {
+	cid := unhex("8394c8f03e515708")
+	for _, test := range []struct {
+		side   side
+		iv     string
+		sample string
+		mask   string
+	}{{
+		// https://www.rfc-editor.org/rfc/rfc9001#appendix-A.2
+		side:   clientSide,
+		iv:     "fa044b2f42a3fd3b46fb255c",
+		sample: "d1b1c98dd7689fb8ec11d242b123dc9b",
+		mask:   "437b9aec36",
+	}, {
+		// https://www.rfc-editor.org/rfc/rfc9001#appendix-A.3
+		side:   serverSide,
+		iv:     "0ac1493ca1905853b0bba03e",
+		sample: "2cd0991cd25b0aac406a5816b6394100",
+		mask:   "2ec0d8356a",
+	}} {
+		k := initialKeys(cid, test.side).w
+		if got, want := k.pkt.iv, unhex(test.iv); !bytes.Equal(got, want) {
+			t.Errorf("%v initial iv = %x, want %x", test.side, got, want)
+		}
+		mask := k.hdr.hp.headerProtection(unhex(test.sample))
+		if got, want := mask[:], unhex(test.mask); !bytes.Equal(got, want) {
+			t.Errorf("%v header protection mask = %x, want %x", test.side, got, want)
+		}
+	}
+	// The client's read keys are the server's write keys.
+	if c, s := initialKeys(cid, clientSide).r, initialKeys(cid, serverSide).w; !bytes.Equal(c.pkt.iv, s.pkt.iv) {
+		t.Errorf("client read iv %x != server write iv %x", c.pkt.iv, s.pkt.iv)
+	}
+}
+
+// https://www.rfc-editor.org/rfc/rfc9001#appendix-A.5
+func TestChaCha20ShortHeaderPacket(t *testing.T) {
+	const (
+		suite = tls.TLS_CHACHA20_POLY1305_SHA256
+		pnum  = 654360564
+	)
+	secret := unhex("9ac312a7f877468ebe69422748ad00a15443f18203a07d6060f688f30f21632b")
+	hdr := unhex("4200bff4")
+	payload := unhex("01")
+	want := unhex("4cfe4189655e5cd55c41f69080575d7999c25a5bfb")
+
+	var w updatingKeys
+	w.setWriteKey(suite, secret)
+	got := w.protect(append([]byte(nil), hdr...), payload, 1, pnum)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("protected packet:\ngot  %x\nwant %x", got, want)
+	}
+
+	var r updatingKeys
+	r.setReadKey(suite, secret)
+	p, err := parse1RTTPacket(want, &r, 0, pnum-1)
+	if err != nil {
+		t.Fatalf("parse1RTTPacket: %v", err)
+	}
+	if p.num != pnum || !bytes.Equal(p.payload, payload) {
+		t.Fatalf("parse1RTTPacket = num %v payload %x, want num %v payload %x", p.num, p.payload, pnum, payload)
+	}
+}
+
+func TestKeyUpdate(t *testing.T) {
+	const suite = tls.TLS_AES_128_GCM_SHA256
+	secret := bytes.Repeat([]byte{1}, 32)
+	var sender, receiver updatingKeys
+	sender.setWriteKey(suite, secret)
+	receiver.setReadKey(suite, secret)
+	receiver.setWriteKey(suite, secret)
+
+	send := func(pnum int64) []byte {
+		hdr := []byte{fixedBit | 0x00, byte(pnum)}
+		pay := bytes.Repeat([]byte{frameTypePing}, 20)
+		return sender.protect(hdr, pay, 1, pnum)
+	}
+	recv := func(pkt []byte, pnumMax int64) int64 {
+		t.Helper()
+		p, err := parse1RTTPacket(pkt, &receiver, 0, pnumMax)
+		if err != nil {
+			t.Fatalf("parse1RTTPacket: %v", err)
+		}
+		return p.num
+	}
+
+	recv(send(0), -1)
+	old := send(1)
+	// The sender initiates a key update.
+	sender.phase ^= 1
+	sender.wSecret = updateSecret(suite, sender.wSecret)
+	sender.w = packetKey{}
+	sender.w.init(suite, sender.wSecret)
+	if got := recv(send(2), 0); got != 2 {
+		t.Fatalf("packet after key update: num = %v, want 2", got)
+	}
+	if receiver.phase != 1 {
+		t.Fatalf("receiver did not update keys")
+	}
+	// A reordered packet from the previous phase is still readable.
+	if got := recv(old, 2); got != 1 {
+		t.Fatalf("reordered packet: num = %v, want 1", got)
+	}
+}
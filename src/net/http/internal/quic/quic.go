@@ -0,0 +1,149 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package quic implements the QUIC transport protocol (RFC 9000)
+// as needed by the HTTP/3 support in net/http.
+//
+// The implementation uses crypto/tls to perform the TLS 1.3 handshake
+// (RFC 9001). It supports bidirectional and unidirectional streams,
+// stream and connection flow control, loss recovery, and key updates.
+// It does not implement 0-RTT, Retry, connection migration, or
+// version negotiation.
+package quic
+
+import (
+	"fmt"
+	"time"
+)
+
+// quicVersion1 is the QUIC version number from RFC 9000.
+const quicVersion1 = 1
+
+// connIDLen is the length of the connection IDs chosen by this endpoint.
+// Connection IDs chosen by the peer may have any valid length.
+const connIDLen = 8
+
+// maxConnIDLen is the maximum length of a QUIC version 1 connection ID.
+const maxConnIDLen = 20
+
+// maxUDPPayloadSize is the size of the datagrams this endpoint sends.
+// This is the minimum size every QUIC path must support (RFC 9000, Section 14),
+// so no path MTU discovery is required.
+const maxUDPPayloadSize = 1200
+
+// minimumClientInitialDatagramSize is the minimum size of a UDP datagram
+// containing a client Initial packet (RFC 9000, Section 14.1).
+const minimumClientInitialDatagramSize = 1200
+
+// Default values of connection settings.
+const (
+	defaultMaxIdleTimeout          = 30 * time.Second
+	defaultMaxStreamReadBufferSize = 1 << 20
+	defaultMaxConnReadBufferSize   = 1 << 22
+	defaultMaxStreamWriteBuffer    = 1 << 20
+	defaultMaxBidiRemoteStreams    = 100
+	defaultMaxUniRemoteStreams     = 100
+	defaultHandshakeTimeout        = 10 * time.Second
+)
+
+// Local timer granularity (RFC 9002, Section 6.1.2).
+const timerGranularity = 1 * time.Millisecond
+
+// maxAckDelay is the maximum amount of time by which we delay acknowledgements.
+// We acknowledge packets promptly, so this is only used for PTO computation.
+const maxAckDelay = 25 * time.Millisecond
+
+// ackDelayExponent is the default ack_delay_exponent (RFC 9000, Section 18.2).
+const ackDelayExponent = 3
+
+// A side distinguishes the client and server ends of a connection.
+type side int8
+
+const (
+	clientSide = side(iota)
+	serverSide
+)
+
+func (s side) String() string {
+	if s == clientSide {
+		return "client"
+	}
+	return "server"
+}
+
+// A numberSpace is a QUIC packet number space (RFC 9000, Section 12.3).
+type numberSpace int8
+
+const (
+	initialSpace = numberSpace(iota)
+	handshakeSpace
+	appDataSpace
+	numberSpaceCount
+)
+
+func (n numberSpace) String() string {
+	switch n {
+	case initialSpace:
+		return "Initial"
+	case handshakeSpace:
+		return "Handshake"
+	case appDataSpace:
+		return "AppData"
+	}
+	return fmt.Sprintf("numberSpace(%v)", int(n))
+}
+
+// A streamType is the type of a stream: bidirectional or unidirectional.
+type streamType int8
+
+const (
+	bidiStream = streamType(iota)
+	uniStream
+	streamTypeCount
+)
+
+func (s streamType) String() string {
+	if s == bidiStream {
+		return "bidi"
+	}
+	return "uni"
+}
+
+// newStreamID returns the ID of the num'th stream of the given type
+// initiated by the given side (RFC 9000, Section 2.1).
+func newStreamID(initiator side, typ streamType, num int64) int64 {
+	id := num << 2
+	if typ == uniStream {
+		id |= 2
+	}
+	if initiator == serverSide {
+		id |= 1
+	}
+	return id
+}
+
+func streamIDInitiator(id int64) side {
+	if id&1 != 0 {
+		return serverSide
+	}
+	return clientSide
+}
+
+func streamIDType(id int64) streamType {
+	if id&2 != 0 {
+		return uniStream
+	}
+	return bidiStream
+}
+
+func streamIDNum(id int64) int64 {
+	return id >> 2
+}
+
+// maxStreamsLimit is the maximum value of a MAX_STREAMS frame
+// (RFC 9000, Section 4.6).
+const maxStreamsLimit = 1 << 60
+
+// maxVarint is the largest value representable by a variable-length integer.
+const maxVarint = (1 << 62) - 1
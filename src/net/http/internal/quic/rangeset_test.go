@@ -0,0 +1,94 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRangeset(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		ops  func(s *rangeset)
+		want rangeset
+	}{{
+		desc: "add disjoint",
+		ops: func(s *rangeset) {
+			s.add(10, 20)
+			s.add(0, 5)
+			s.add(30, 40)
+		},
+		want: rangeset{{0, 5}, {10, 20}, {30, 40}},
+	}, {
+		desc: "add adjacent",
+		ops: func(s *rangeset) {
+			s.add(0, 5)
+			s.add(5, 10)
+			s.add(10, 15)
+		},
+		want: rangeset{{0, 15}},
+	}, {
+		desc: "add spanning",
+		ops: func(s *rangeset) {
+			s.add(0, 5)
+			s.add(10, 15)
+			s.add(20, 25)
+			s.add(3, 22)
+		},
+		want: rangeset{{0, 25}},
+	}, {
+		desc: "sub middle",
+		ops: func(s *rangeset) {
+			s.add(0, 20)
+			s.sub(5, 10)
+		},
+		want: rangeset{{0, 5}, {10, 20}},
+	}, {
+		desc: "sub edges",
+		ops: func(s *rangeset) {
+			s.add(0, 10)
+			s.add(20, 30)
+			s.sub(5, 25)
+		},
+		want: rangeset{{0, 5}, {25, 30}},
+	}, {
+		desc: "sub all",
+		ops: func(s *rangeset) {
+			s.add(0, 10)
+			s.add(20, 30)
+			s.sub(0, 30)
+		},
+		want: rangeset{},
+	}} {
+		var s rangeset
+		test.ops(&s)
+		if len(s) == 0 && len(test.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(s, test.want) {
+			t.Errorf("%v: got %v, want %v", test.desc, s, test.want)
+		}
+	}
+}
+
+func TestRangesetContains(t *testing.T) {
+	var s rangeset
+	s.add(10, 20)
+	s.add(30, 40)
+	for v, want := range map[int64]bool{
+		9: false, 10: true, 19: true, 20: false, 29: false, 30: true, 39: true, 40: false,
+	} {
+		if got := s.contains(v); got != want {
+			t.Errorf("contains(%v) = %v, want %v", v, got, want)
+		}
+	}
+	if got, want := s.min(), int64(10); got != want {
+		t.Errorf("min() = %v, want %v", got, want)
+	}
+	if got, want := s.max(), int64(39); got != want {
+		t.Errorf("max() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,484 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// A Stream is an ordered byte stream within a QUIC connection.
+//
+// Streams may be bidirectional or unidirectional.
+// Reading from a send-only stream or writing to a receive-only stream
+// returns an error.
+type Stream struct {
+	id   int64
+	conn *Conn
+
+	queued  bool // in the connection's send queue
+	blocked bool // blocked by flow control
+
+	// Receive side. Guarded by conn.mu.
+	hasRecv           bool
+	in                recvBuffer
+	inWindow          int64      // size of the stream receive window
+	inMax             int64      // our MAX_STREAM_DATA limit
+	inHighest         int64      // highest offset received
+	inFinal           int64      // final size, or -1 if unknown
+	inCredited        int64      // offset through which data has been credited to connection flow control
+	inErr             error      // set when RESET_STREAM is received
+	inCanceled        bool       // CancelRead has been called
+	inStopCode        uint64     // code sent in STOP_SENDING
+	inStopState       frameState // state of STOP_SENDING
+	needMaxStreamData bool       // MAX_STREAM_DATA frame needs to be sent
+
+	// Send side. Guarded by conn.mu.
+	hasSend       bool
+	out           sendBuffer
+	outMax        int64      // peer's MAX_STREAM_DATA limit
+	outBufSize    int64      // maximum amount of unacknowledged data to buffer
+	outClosed     bool       // CloseWrite has been called
+	outFinSent    bool       // FIN has been sent
+	outFinAcked   bool       // FIN has been acknowledged
+	outErr        error      // set when STOP_SENDING is received
+	outResetCode  uint64     // code sent in RESET_STREAM
+	outResetState frameState // state of RESET_STREAM
+}
+
+// A frameState is the state of a frame which is sent at most once
+// (and retransmitted until acknowledged).
+type frameState int8
+
+const (
+	frameNone   = frameState(iota) // frame is not needed
+	frameNeeded                    // frame needs to be sent
+	frameSent                      // frame has been sent
+	frameAcked                     // frame has been acknowledged, or is no longer needed
+)
+
+var (
+	errStreamReadOnly  = errors.New("quic: write to receive-only stream")
+	errStreamWriteOnly = errors.New("quic: read from send-only stream")
+	errStreamClosed    = errors.New("quic: write to closed stream")
+	errReadCanceled    = errors.New("quic: read after CancelRead")
+)
+
+func newStream(c *Conn, id int64) *Stream {
+	return &Stream{
+		id:      id,
+		conn:    c,
+		inFinal: -1,
+	}
+}
+
+func (s *Stream) initRecv(window int64) {
+	s.hasRecv = true
+	s.inWindow = window
+	s.inMax = window
+}
+
+func (s *Stream) initSend(max, bufSize int64) {
+	s.hasSend = true
+	s.outMax = max
+	s.outBufSize = bufSize
+}
+
+// ID returns the QUIC stream ID of s.
+func (s *Stream) ID() int64 {
+	return s.id
+}
+
+// IsReadOnly reports whether the stream is read-only
+// (a unidirectional stream created by the peer).
+func (s *Stream) IsReadOnly() bool {
+	return !s.hasSend
+}
+
+// IsWriteOnly reports whether the stream is write-only
+// (a unidirectional stream created locally).
+func (s *Stream) IsWriteOnly() bool {
+	return !s.hasRecv
+}
+
+// Read reads data from the stream.
+// See ReadContext for more details.
+func (s *Stream) Read(b []byte) (n int, err error) {
+	return s.ReadContext(context.Background(), b)
+}
+
+// ReadContext reads data from the stream.
+//
+// ReadContext returns as soon as at least one byte of data is available.
+//
+// If the peer closes the stream cleanly, ReadContext returns io.EOF after
+// returning all data sent by the peer.
+// If the peer aborts writes on the stream, ReadContext returns
+// an error wrapping StreamErrorCode.
+func (s *Stream) ReadContext(ctx context.Context, b []byte) (n int, err error) {
+	if !s.hasRecv {
+		return 0, errStreamWriteOnly
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.wait(ctx, func() bool {
+		return s.in.readable() > 0 || s.inErr != nil || s.inCanceled || s.readEOF()
+	}); err != nil {
+		return 0, err
+	}
+	switch {
+	case s.inCanceled:
+		return 0, errReadCanceled
+	case s.inErr != nil:
+		return 0, s.inErr
+	case s.in.readable() > 0:
+		if len(b) == 0 {
+			return 0, nil
+		}
+		n = s.in.read(b)
+		s.creditConsumed(s.in.start)
+		s.maybeUpdateWindow()
+		c.maybeRemoveStream(s)
+		c.wake()
+		return n, nil
+	default:
+		return 0, io.EOF
+	}
+}
+
+// readEOF reports whether all data up to the final size has been read.
+func (s *Stream) readEOF() bool {
+	return s.inFinal >= 0 && s.in.start >= s.inFinal
+}
+
+// creditConsumed records that data through offset to has been consumed,
+// for purposes of connection-level flow control.
+func (s *Stream) creditConsumed(to int64) {
+	if to > s.inCredited {
+		s.conn.streams.consumed(to - s.inCredited)
+		s.inCredited = to
+	}
+}
+
+// maybeUpdateWindow extends the stream's flow control window
+// once half of it has been consumed.
+func (s *Stream) maybeUpdateWindow() {
+	if s.inFinal >= 0 || s.inCanceled {
+		return
+	}
+	if s.inMax-s.in.start < s.inWindow/2 {
+		s.inMax = s.in.start + s.inWindow
+		s.needMaxStreamData = true
+		s.conn.streams.queue(s)
+	}
+}
+
+// Write writes data to the stream.
+// See WriteContext for more details.
+func (s *Stream) Write(b []byte) (n int, err error) {
+	return s.WriteContext(context.Background(), b)
+}
+
+// WriteContext writes data to the stream.
+//
+// WriteContext returns once all data has been added to the stream write buffer,
+// blocking while the buffer is full. Buffered data is sent as soon as flow and
+// congestion control permit.
+//
+// If the peer aborts reads on the stream, WriteContext returns
+// an error wrapping StreamErrorCode.
+func (s *Stream) WriteContext(ctx context.Context, b []byte) (n int, err error) {
+	if !s.hasSend {
+		return 0, errStreamReadOnly
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(b) > 0 {
+		if err := c.wait(ctx, func() bool {
+			return s.outClosed || s.outResetState != frameNone ||
+				int64(s.out.unacked()) < s.outBufSize
+		}); err != nil {
+			return n, err
+		}
+		if c.closeErr != nil {
+			return n, c.closeErr
+		}
+		if s.outErr != nil {
+			return n, s.outErr
+		}
+		if s.outClosed || s.outResetState != frameNone {
+			return n, errStreamClosed
+		}
+		chunk := b
+		if avail := s.outBufSize - int64(s.out.unacked()); avail < int64(len(chunk)) {
+			chunk = chunk[:avail]
+		}
+		s.out.write(chunk)
+		n += len(chunk)
+		b = b[len(chunk):]
+		c.streams.queue(s)
+		c.wake()
+	}
+	return n, nil
+}
+
+// CloseWrite aborts writes on the stream after sending all buffered data.
+// Any blocked writes will be unblocked and return errors.
+func (s *Stream) CloseWrite() {
+	if !s.hasSend {
+		return
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.outClosed || s.outResetState != frameNone {
+		return
+	}
+	s.outClosed = true
+	c.streams.queue(s)
+	c.cond.Broadcast()
+	c.wake()
+}
+
+// CancelWrite aborts writes on the stream, discarding any unsent data.
+// The peer receives a RESET_STREAM frame with the given error code.
+// Any blocked writes will be unblocked and return errors.
+func (s *Stream) CancelWrite(code uint64) {
+	if !s.hasSend {
+		return
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.resetLocked(code)
+	c.cond.Broadcast()
+	c.wake()
+}
+
+// resetLocked begins resetting the send side of the stream.
+func (s *Stream) resetLocked(code uint64) {
+	if !s.hasSend || s.outFinAcked || s.outResetState != frameNone {
+		return
+	}
+	s.outResetState = frameNeeded
+	s.outResetCode = code
+	// The final size of the stream is the amount of data sent;
+	// any unsent data is discarded.
+	s.out = sendBuffer{start: s.out.sent, sent: s.out.sent}
+	s.conn.streams.queue(s)
+}
+
+// CancelRead aborts reads on the stream, discarding any unread data.
+// The peer receives a STOP_SENDING frame with the given error code,
+// unless it has already sent all data on the stream.
+// Any blocked reads will be unblocked and return errors.
+func (s *Stream) CancelRead(code uint64) {
+	if !s.hasRecv {
+		return
+	}
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.cancelReadLocked(code)
+	c.cond.Broadcast()
+	c.wake()
+}
+
+func (s *Stream) cancelReadLocked(code uint64) {
+	if s.inCanceled {
+		return
+	}
+	s.inCanceled = true
+	s.creditConsumed(s.inHighest)
+	s.in = recvBuffer{start: s.inHighest}
+	if s.inFinal < 0 && s.inErr == nil {
+		s.inStopState = frameNeeded
+		s.inStopCode = code
+		s.conn.streams.queue(s)
+	}
+	s.conn.maybeRemoveStream(s)
+}
+
+// Close closes the stream.
+// It sends all buffered data and a FIN to the peer,
+// and aborts reads with error code 0 if unread data remains.
+func (s *Stream) Close() error {
+	s.CloseWrite()
+	if s.hasRecv {
+		c := s.conn
+		c.mu.Lock()
+		if !s.readEOF() && s.inErr == nil {
+			s.cancelReadLocked(0)
+			c.wake()
+		}
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// isDone reports whether both directions of the stream are complete,
+// and the stream's state may be discarded.
+func (s *Stream) isDone() bool {
+	recvDone := !s.hasRecv || (s.inFinal >= 0 && (s.inErr != nil || s.inCanceled || s.readEOF()))
+	sendDone := !s.hasSend || (s.outFinAcked && s.out.unacked() == 0) || s.outResetState == frameAcked
+	return recvDone && sendDone
+}
+
+// checkFinalSize validates a received stream offset against the stream's final size.
+// https://www.rfc-editor.org/rfc/rfc9000#section-4.5
+func (s *Stream) checkFinalSize(end int64, fin bool) error {
+	if s.inFinal >= 0 {
+		if end > s.inFinal || (fin && end != s.inFinal) {
+			return localTransportError{code: errFinalSize, reason: "stream final size changed"}
+		}
+		return nil
+	}
+	if fin {
+		if end < s.inHighest {
+			return localTransportError{code: errFinalSize, reason: "stream final size below received data"}
+		}
+		s.inFinal = end
+	}
+	return nil
+}
+
+// sendLimit returns the offset through which new data may be sent.
+func (s *Stream) sendLimit() int64 {
+	ss := &s.conn.streams
+	return min64(s.outMax, s.out.sent+ss.outMaxData-ss.outSent)
+}
+
+// hasDataToSend reports whether the stream has data or a FIN left to send,
+// ignoring flow control.
+func (s *Stream) hasDataToSend() bool {
+	if !s.hasSend || s.outResetState != frameNone {
+		return false
+	}
+	return s.out.hasPending(maxVarint) || (s.outClosed && !s.outFinSent)
+}
+
+// wantSend reports whether the stream has frames that can be sent now.
+func (s *Stream) wantSend() bool {
+	if s.inStopState == frameNeeded || s.needMaxStreamData || s.outResetState == frameNeeded {
+		return true
+	}
+	if !s.hasSend || s.outResetState != frameNone {
+		return false
+	}
+	if s.out.hasPending(s.sendLimit()) {
+		return true
+	}
+	return s.outClosed && !s.outFinSent && s.out.sent == s.out.end()
+}
+
+// appendFrames appends the stream's pending frames to the current packet.
+// It reports false if the packet is full.
+func (s *Stream) appendFrames(w *packetWriter) bool {
+	ss := &s.conn.streams
+	if s.inStopState == frameNeeded {
+		if !w.appendStopSendingFrame(s.id, s.inStopCode) {
+			return false
+		}
+		s.inStopState = frameSent
+	}
+	if s.needMaxStreamData {
+		if !w.appendMaxStreamDataFrame(s.id, s.inMax) {
+			return false
+		}
+		s.needMaxStreamData = false
+	}
+	if s.outResetState == frameNeeded {
+		if !w.appendResetStreamFrame(s.id, s.outResetCode, s.out.sent) {
+			return false
+		}
+		s.outResetState = frameSent
+	}
+	if !s.hasSend || s.outResetState != frameNone {
+		return true
+	}
+	for {
+		limit := s.sendLimit()
+		if !s.out.hasPending(limit) {
+			break
+		}
+		off, end, isNew := s.out.next(limit)
+		fin := s.outClosed && end == s.out.end()
+		b, ok := w.appendStreamFrame(s.id, off, int(end-off), fin)
+		if !ok {
+			return false
+		}
+		copy(b, s.out.bytes(off, off+int64(len(b))))
+		sentEnd := off + int64(len(b))
+		if isNew {
+			ss.outSent += sentEnd - s.out.sent
+		}
+		s.out.markSent(off, sentEnd)
+		if sentEnd < end {
+			return false
+		}
+		if fin {
+			s.outFinSent = true
+		}
+	}
+	if s.outClosed && !s.outFinSent && s.out.sent == s.out.end() {
+		if _, ok := w.appendStreamFrame(s.id, s.out.end(), 0, true); !ok {
+			return false
+		}
+		s.outFinSent = true
+	}
+	return true
+}
+
+// dataAcked records the acknowledgement of stream data.
+func (s *Stream) dataAcked(start, end int64, fin bool) {
+	if s.outResetState != frameNone {
+		return
+	}
+	s.out.ack(start, end)
+	if fin {
+		s.outFinAcked = true
+	}
+	s.conn.cond.Broadcast()
+	s.conn.maybeRemoveStream(s)
+}
+
+// dataLost records the loss of stream data.
+func (s *Stream) dataLost(start, end int64, fin bool) {
+	if s.outResetState != frameNone {
+		return
+	}
+	s.out.lose(start, end)
+	if fin && !s.outFinAcked {
+		s.outFinSent = false
+	}
+}
+
+// frameAcked records the acknowledgement of a RESET_STREAM or STOP_SENDING frame.
+func (s *Stream) frameAcked(frameType byte) {
+	switch frameType {
+	case frameTypeResetStream:
+		s.outResetState = frameAcked
+	case frameTypeStopSending:
+		s.inStopState = frameAcked
+	}
+	s.conn.maybeRemoveStream(s)
+}
+
+// frameLost records the loss of a RESET_STREAM or STOP_SENDING frame.
+func (s *Stream) frameLost(frameType byte) {
+	switch frameType {
+	case frameTypeResetStream:
+		if s.outResetState == frameSent {
+			s.outResetState = frameNeeded
+		}
+	case frameTypeStopSending:
+		if s.inStopState == frameSent && s.inFinal < 0 {
+			s.inStopState = frameNeeded
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"time"
+)
+
+// tlsLevel returns the TLS encryption level for a number space.
+func tlsLevel(space numberSpace) tls.QUICEncryptionLevel {
+	switch space {
+	case initialSpace:
+		return tls.QUICEncryptionLevelInitial
+	case handshakeSpace:
+		return tls.QUICEncryptionLevelHandshake
+	default:
+		return tls.QUICEncryptionLevelApplication
+	}
+}
+
+// spaceForLevel returns the number space for a TLS encryption level.
+func spaceForLevel(level tls.QUICEncryptionLevel) numberSpace {
+	switch level {
+	case tls.QUICEncryptionLevelInitial:
+		return initialSpace
+	case tls.QUICEncryptionLevelHandshake:
+		return handshakeSpace
+	default:
+		return appDataSpace
+	}
+}
+
+// handleTLSEvents processes events produced by the TLS handshake.
+func (c *Conn) handleTLSEvents(now time.Time) {
+	for {
+		e := c.tls.NextEvent()
+		// Event data is only valid until the next call to NextEvent.
+		data := append([]byte(nil), e.Data...)
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return
+		case tls.QUICSetReadSecret:
+			switch e.Level {
+			case tls.QUICEncryptionLevelHandshake:
+				c.handshakeKeys.r.init(e.Suite, data)
+			case tls.QUICEncryptionLevelApplication:
+				c.appKeys.setReadKey(e.Suite, data)
+			}
+			// Packets we buffered for lack of keys may now be readable.
+			c.reprocess = len(c.pending) > 0
+		case tls.QUICSetWriteSecret:
+			switch e.Level {
+			case tls.QUICEncryptionLevelHandshake:
+				c.handshakeKeys.w.init(e.Suite, data)
+			case tls.QUICEncryptionLevelApplication:
+				c.appKeys.setWriteKey(e.Suite, data)
+			}
+		case tls.QUICWriteData:
+			space := spaceForLevel(e.Level)
+			c.crypto[space].out.write(data)
+		case tls.QUICTransportParameters:
+			if err := c.receiveTransportParameters(data); err != nil {
+				c.abort(now, err)
+				return
+			}
+		case tls.QUICHandshakeDone:
+			c.handshakeDone = true
+			close(c.handshakeDonec)
+			if c.side == serverSide {
+				// "[...] the TLS handshake is considered confirmed
+				// at the server when the handshake completes."
+				// https://www.rfc-editor.org/rfc/rfc9001#section-4.1.2-1
+				c.confirmHandshake(now)
+				c.needHandshakeDone = true
+				c.endpoint.serverConnEstablished(c)
+			}
+			c.cond.Broadcast()
+		}
+	}
+}
+
+// handleCrypto processes data received in a CRYPTO frame.
+func (c *Conn) handleCrypto(now time.Time, space numberSpace, off int64, data []byte) error {
+	cs := &c.crypto[space]
+	end := off + int64(len(data))
+	if end-cs.in.start > maxCryptoBuffer {
+		return localTransportError{code: errCryptoBufferExceeded}
+	}
+	cs.in.write(off, data)
+	if b := cs.in.peek(); len(b) > 0 {
+		// HandleData requires that the data is not modified
+		// until the next handshake event, so pass a copy.
+		buf := append([]byte(nil), b...)
+		cs.in.consume(len(b))
+		if err := c.tls.HandleData(tlsLevel(space), buf); err != nil {
+			return tlsAlertError(err)
+		}
+		c.handleTLSEvents(now)
+	}
+	return nil
+}
+
+// receiveTransportParameters validates and records the peer's transport parameters.
+func (c *Conn) receiveTransportParameters(b []byte) error {
+	p, err := unmarshalTransportParams(b)
+	if err != nil {
+		return err
+	}
+	// Validate the connection IDs the peer authenticated.
+	// https://www.rfc-editor.org/rfc/rfc9000#section-7.3
+	if !bytes.Equal(p.initialSrcConnID, c.remoteConnID) {
+		return localTransportError{
+			code:   errTransportParameter,
+			reason: "initial_source_connection_id does not match",
+		}
+	}
+	if c.side == clientSide {
+		if !bytes.Equal(p.originalDstConnID, c.origDstConnID) {
+			return localTransportError{
+				code:   errTransportParameter,
+				reason: "original_destination_connection_id does not match",
+			}
+		}
+		if p.retrySrcConnID != nil {
+			return localTransportError{
+				code:   errTransportParameter,
+				reason: "retry_source_connection_id without Retry",
+			}
+		}
+	} else if p.originalDstConnID != nil || p.retrySrcConnID != nil || p.statelessResetToken != nil {
+		return localTransportError{
+			code:   errTransportParameter,
+			reason: "client sent server-only transport parameter",
+		}
+	}
+	c.peerParams = p
+	c.gotParams = true
+	if p.maxIdleTimeout > 0 && (c.idleTimeout <= 0 || p.maxIdleTimeout < c.idleTimeout) {
+		c.idleTimeout = p.maxIdleTimeout
+	}
+	c.loss.maxAckDelay = p.maxAckDelay
+	c.streams.setPeerParams(p)
+	return nil
+}
+
+// confirmHandshake records that the handshake is confirmed,
+// discarding the Handshake keys.
+// https://www.rfc-editor.org/rfc/rfc9001#section-4.9.2
+func (c *Conn) confirmHandshake(now time.Time) {
+	if c.handshakeConfirmed {
+		return
+	}
+	c.handshakeConfirmed = true
+	c.discardKeys(now, handshakeSpace)
+}
+
+// discardKeys discards the keys for a number space, and any state
+// associated with packets in that space.
+func (c *Conn) discardKeys(now time.Time, space numberSpace) {
+	switch space {
+	case initialSpace:
+		if !c.initialKeys.canRead() && !c.initialKeys.canWrite() {
+			return
+		}
+		c.initialKeys.discard()
+	case handshakeSpace:
+		if !c.handshakeKeys.canRead() && !c.handshakeKeys.canWrite() {
+			return
+		}
+		c.handshakeKeys.discard()
+	}
+	c.loss.discardSpace(&c.spaces[space])
+	c.crypto[space] = cryptoStream{}
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTransportParametersRoundTrip(t *testing.T) {
+	p := defaultTransportParameters()
+	p.originalDstConnID = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	p.maxIdleTimeout = 10 * time.Second
+	p.statelessResetToken = make([]byte, 16)
+	p.maxUDPPayloadSize = 1400
+	p.initialMaxData = 1 << 20
+	p.initialMaxStreamDataBidiLocal = 1 << 16
+	p.initialMaxStreamDataBidiRemote = 1 << 17
+	p.initialMaxStreamDataUni = 1 << 18
+	p.initialMaxStreamsBidi = 10
+	p.initialMaxStreamsUni = 20
+	p.ackDelayExponent = 4
+	p.maxAckDelay = 50 * time.Millisecond
+	p.disableActiveMigration = true
+	p.activeConnIDLimit = 4
+	p.initialSrcConnID = []byte{9, 9}
+	p.retrySrcConnID = []byte{}
+
+	got, err := unmarshalTransportParams(marshalTransportParameters(p))
+	if err != nil {
+		t.Fatalf("unmarshalTransportParams: %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("round trip:\ngot  %+v\nwant %+v", got, p)
+	}
+}
+
+func TestTransportParametersInvalid(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		b    []byte
+	}{
+		{"truncated", []byte{paramInitialMaxData, 2, 0x40}},
+		{"duplicate", []byte{paramInitialMaxData, 1, 1, paramInitialMaxData, 1, 1}},
+		{"small max_udp_payload_size", []byte{paramMaxUDPPayloadSize, 1, 10}},
+		{"large ack_delay_exponent", []byte{paramAckDelayExponent, 1, 21}},
+		{"bad stateless_reset_token", []byte{paramStatelessResetToken, 1, 0}},
+		{"small active_connection_id_limit", []byte{paramActiveConnectionIDLimit, 1, 1}},
+	} {
+		if _, err := unmarshalTransportParams(test.b); err == nil {
+			t.Errorf("%v: unmarshalTransportParams succeeded, want error", test.desc)
+		}
+	}
+}
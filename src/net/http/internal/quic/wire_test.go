@@ -0,0 +1,67 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Test cases from RFC 9000, Appendix A.1.
+var varintTests = []struct {
+	b []byte
+	v uint64
+}{
+	{[]byte{0xc2, 0x19, 0x7c, 0x5e, 0xff, 0x14, 0xe8, 0x8c}, 151288809941952652},
+	{[]byte{0x9d, 0x7f, 0x3e, 0x7d}, 494878333},
+	{[]byte{0x7b, 0xbd}, 15293},
+	{[]byte{0x25}, 37},
+}
+
+func TestConsumeVarint(t *testing.T) {
+	for _, test := range varintTests {
+		v, n := consumeVarint(test.b)
+		if v != test.v || n != len(test.b) {
+			t.Errorf("consumeVarint(%x) = %v, %v; want %v, %v", test.b, v, n, test.v, len(test.b))
+		}
+		if _, n := consumeVarint(test.b[:len(test.b)-1]); n != -1 {
+			t.Errorf("consumeVarint(%x) = n %v, want -1", test.b[:len(test.b)-1], n)
+		}
+	}
+	// Non-minimal encodings are valid.
+	if v, n := consumeVarint([]byte{0x40, 0x25}); v != 37 || n != 2 {
+		t.Errorf("consumeVarint(4025) = %v, %v; want 37, 2", v, n)
+	}
+}
+
+func TestAppendVarint(t *testing.T) {
+	for _, test := range varintTests {
+		if got := appendVarint(nil, test.v); !bytes.Equal(got, test.b) {
+			t.Errorf("appendVarint(%v) = %x, want %x", test.v, got, test.b)
+		}
+		if got := sizeVarint(test.v); got != len(test.b) {
+			t.Errorf("sizeVarint(%v) = %v, want %v", test.v, got, len(test.b))
+		}
+	}
+}
+
+func TestDecodePacketNumber(t *testing.T) {
+	// https://www.rfc-editor.org/rfc/rfc9000#appendix-A.3
+	if got := decodePacketNumber(0xa82f30ea, 0x9b32, 2); got != 0xa82f9b32 {
+		t.Errorf("decodePacketNumber = %x, want a82f9b32", got)
+	}
+	for _, largest := range []int64{-1, 0, 1, 100, 1 << 20} {
+		for _, pnum := range []int64{largest + 1, largest + 2, largest + 1000, largest + 100000} {
+			b := appendPacketNumber(nil, pnum, largest)
+			var truncated int64
+			for _, v := range b {
+				truncated = truncated<<8 | int64(v)
+			}
+			if got := decodePacketNumber(largest, truncated, len(b)); got != pnum {
+				t.Errorf("largest %v: encode/decode %v = %v", largest, pnum, got)
+			}
+		}
+	}
+}
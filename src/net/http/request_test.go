@@ -1375,3 +1375,40 @@ func runFileAndServerBenchmarks(b *testing.B, tlsOption bool, f *os.File, n int6
 		b.SetBytes(n)
 	}
 }
+
+func TestSetPathValue(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/a/{b}/c/{d...}", func(_ ResponseWriter, r *Request) {
+		kvs := map[string]string{
+			"b": "X",
+			"d": "Y",
+			"a": "Z",
+		}
+		for k, v := range kvs {
+			r.SetPathValue(k, v)
+		}
+		for k, w := range kvs {
+			if g := r.PathValue(k); g != w {
+				t.Errorf("%q: got %q, want %q", k, g, w)
+			}
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	res, err := Get(server.URL + "/a/b/c/d/e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+}
+
+func TestClonePathValue(t *testing.T) {
+	req, _ := NewRequest("GET", "https://example.org/", nil)
+	req.SetPathValue("p1", "orig")
+
+	r := req.Clone(context.Background())
+	r.SetPathValue("p1", "copy")
+	if g, w := req.PathValue("p1"), "orig"; g != w {
+		t.Errorf("original request PathValue = %q, want %q", g, w)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func getTestTree() *routingNode {
+	root := &routingNode{}
+	for _, p := range []string{
+		"/a",
+		"/a/b",
+		"/a/{x}",
+		"/g/h/i",
+		"/g/{x}/j",
+		"/a/b/{x...}",
+		"/a/b/{y}",
+		"/a/b/{$}",
+		"/item/",
+		"POST /item/{user}",
+		"GET /item/{user}",
+		"/item/{user}",
+		"/item/{user}/{id}",
+		"/item/{user}/new",
+		"/item/{$}",
+		"POST alt.com/item/{user}",
+		"GET /headwins",
+		"HEAD /headwins",
+		"/path/{p...}",
+	} {
+		pat, err := parsePattern(p)
+		if err != nil {
+			panic(err)
+		}
+		root.addPattern(pat, nil)
+	}
+	return root
+}
+
+func TestRoutingAddPattern(t *testing.T) {
+	root := getTestTree()
+	if got := root.findChild("").findChild("").findChild("a"); got == nil {
+		t.Fatal("no node for /a")
+	}
+	if got := root.findChild("alt.com").findChild("POST").findChild("item").findChild(""); got == nil || got.pattern.String() != "POST alt.com/item/{user}" {
+		t.Errorf("alt.com node: got %v", got)
+	}
+	if root.findChild("").findChild("").findChild("a").findChild("b").multiChild == nil {
+		t.Error("no multi child for /a/b/{x...}")
+	}
+}
+
+type testCase struct {
+	method, host, path string
+	wantPat            string // "" for nil (no match)
+	wantMatches        []string
+}
+
+func TestRoutingNodeMatch(t *testing.T) {
+
+	test := func(tree *routingNode, tests []testCase) {
+		t.Helper()
+		for _, test := range tests {
+			gotNode, gotMatches := tree.match(test.host, test.method, test.path)
+			got := ""
+			if gotNode != nil {
+				got = gotNode.pattern.String()
+			}
+			if got != test.wantPat {
+				t.Errorf("%s, %s, %s: got %q, want %q", test.host, test.method, test.path, got, test.wantPat)
+			}
+			if !reflect.DeepEqual(gotMatches, test.wantMatches) {
+				t.Errorf("%s, %s, %s: got matches %v, want %v", test.host, test.method, test.path, gotMatches, test.wantMatches)
+			}
+		}
+	}
+
+	test(getTestTree(), []testCase{
+		{"GET", "", "/a", "/a", nil},
+		{"Get", "", "/b", "", nil},
+		{"Get", "", "/a/b", "/a/b", nil},
+		{"Get", "", "/a/c", "/a/{x}", []string{"c"}},
+		{"Get", "", "/a/b/", "/a/b/{$}", nil},
+		{"Get", "", "/a/b/c", "/a/b/{y}", []string{"c"}},
+		{"Get", "", "/a/b/c/d", "/a/b/{x...}", []string{"c/d"}},
+		{"Get", "", "/g/h/i", "/g/h/i", nil},
+		{"Get", "", "/g/h/j", "/g/{x}/j", []string{"h"}},
+	})
+
+	tree := getTestTree()
+	test(tree, []testCase{
+		{"POST", "", "/a", "/a", nil},
+		{"POST", "", "/item", "", nil},
+		{"POST", "", "/item/", "/item/{$}", nil},
+		{"GET", "", "/item/", "/item/{$}", nil},
+		{"GET", "", "/item/jba", "GET /item/{user}", []string{"jba"}},
+		{"GET", "", "/item/jba/new", "/item/{user}/new", []string{"jba"}},
+		{"GET", "", "/item/jba/17", "/item/{user}/{id}", []string{"jba", "17"}},
+		{"PUT", "", "/item/jba", "/item/{user}", []string{"jba"}},
+		{"POST", "alt.com", "/item/jba", "POST alt.com/item/{user}", []string{"jba"}},
+		{"GET", "alt.com", "/item/jba", "GET /item/{user}", []string{"jba"}},
+		{"GET", "", "/item/jba/new/x", "/item/", nil},
+	})
+
+	// HEAD matches GET patterns, but an explicit HEAD pattern wins.
+	test(tree, []testCase{
+		{"HEAD", "", "/item/jba", "GET /item/{user}", []string{"jba"}},
+		{"HEAD", "", "/headwins", "HEAD /headwins", nil},
+		{"GET", "", "/headwins", "GET /headwins", nil},
+	})
+
+	// Multi wildcards are unescaped.
+	test(tree, []testCase{
+		{"GET", "", "/path/to/file", "/path/{p...}", []string{"to/file"}},
+		{"GET", "", "/path/%2F", "/path/{p...}", []string{"/"}},
+	})
+
+	// A pattern ending in {$} should only match URLs with a trailing slash.
+	pat1 := "/a/b/{$}"
+	test(tree, []testCase{
+		{"GET", "", "/a/b", "/a/b", nil},
+		{"GET", "", "/a/b/", pat1, nil},
+		{"GET", "", "/a/b/c", "/a/b/{y}", []string{"c"}},
+		{"GET", "", "/a/b/c/d", "/a/b/{x...}", []string{"c/d"}},
+	})
+
+	// A pattern ending in a single wildcard should not match a trailing slash URL.
+	pat2 := "/x/{y}"
+	tree = &routingNode{}
+	tree.addPattern(mustParsePattern(t, pat2), nil)
+	test(tree, []testCase{
+		{"GET", "", "/x/1", pat2, []string{"1"}},
+		{"GET", "", "/x/1/", "", nil},
+	})
+}
+
+func TestMatchingMethods(t *testing.T) {
+	hostTree := &routingNode{}
+	for _, p := range []string{"GET a.com/", "PUT b.com/", "POST /foo/{x}"} {
+		hostTree.addPattern(mustParsePattern(t, p), nil)
+	}
+	for _, test := range []struct {
+		name       string
+		tree       *routingNode
+		host, path string
+		want       string
+	}{
+		{
+			"post",
+			getTestTree(),
+			"", "/item/jba",
+			"GET,HEAD,POST",
+		},
+		{
+			"none",
+			getTestTree(),
+			"", "/g/h",
+			"",
+		},
+		{
+			"get and head",
+			getTestTree(),
+			"", "/headwins",
+			"GET,HEAD",
+		},
+		{
+			"host",
+			hostTree,
+			"a.com", "/",
+			"GET,HEAD",
+		},
+		{
+			"host and path",
+			hostTree,
+			"b.com", "/foo/1",
+			"POST,PUT",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ms := map[string]bool{}
+			test.tree.matchingMethods(test.host, test.path, ms)
+			var keys []string
+			for k := range ms {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			got := ""
+			for i, k := range keys {
+				if i > 0 {
+					got += ","
+				}
+				got += k
+			}
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
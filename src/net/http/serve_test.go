@@ -398,6 +398,122 @@ func TestServeMuxHandleFuncWithNilHandler(t *testing.T) {
 	mux.HandleFunc("/", nil)
 }
 
+func TestServeMuxMethodPatterns(t *testing.T) {
+	setParallel(t)
+	mux := NewServeMux()
+	mux.Handle("GET /items/{id}", serve(200))
+	mux.Handle("POST /items/{id}", serve(201))
+	mux.Handle("/items/{id}/edit", serve(202))
+	mux.Handle("DELETE /archive/", serve(203))
+
+	tests := []struct {
+		method  string
+		path    string
+		code    int
+		pattern string
+		allow   string
+	}{
+		{"GET", "/items/1", 200, "GET /items/{id}", ""},
+		{"HEAD", "/items/1", 200, "GET /items/{id}", ""},
+		{"POST", "/items/1", 201, "POST /items/{id}", ""},
+		{"PUT", "/items/1/edit", 202, "/items/{id}/edit", ""},
+		{"DELETE", "/archive/1", 203, "DELETE /archive/", ""},
+		{"PUT", "/items/1", 405, "", "GET, HEAD, POST"},
+		{"GET", "/archive/1", 405, "", "DELETE"},
+		{"GET", "/items/1/2", 404, "", ""},
+		{"GET", "/other", 404, "", ""},
+	}
+	for _, tt := range tests {
+		r := &Request{Method: tt.method, Host: "example.com", URL: &url.URL{Path: tt.path}}
+		h, pattern := mux.Handler(r)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		if pattern != tt.pattern || rr.Code != tt.code {
+			t.Errorf("%s %s = %d, %q, want %d, %q", tt.method, tt.path, rr.Code, pattern, tt.code, tt.pattern)
+		}
+		if got := rr.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: Allow = %q, want %q", tt.method, tt.path, got, tt.allow)
+		}
+	}
+}
+
+func TestServeMuxPathValue(t *testing.T) {
+	setParallel(t)
+	for _, test := range []struct {
+		pattern string
+		url     string
+		want    map[string]string
+	}{
+		{
+			"/{a}/is/{b}/{c...}",
+			"/now/is/the/time/for/all",
+			map[string]string{
+				"a": "now",
+				"b": "the",
+				"c": "time/for/all",
+				"d": "",
+			},
+		},
+		{
+			"/names/{name}/{other...}",
+			"/names/%2fjohn/address",
+			map[string]string{
+				"name":  "/john",
+				"other": "address",
+			},
+		},
+		{
+			"/names/{name}/{other...}",
+			"/names/john%2Fdoe/there/is%2F/more",
+			map[string]string{
+				"name":  "john/doe",
+				"other": "there/is//more",
+			},
+		},
+		{
+			"/{$}",
+			"/",
+			map[string]string{"a": ""},
+		},
+	} {
+		mux := NewServeMux()
+		mux.HandleFunc(test.pattern, func(w ResponseWriter, r *Request) {
+			for name, want := range test.want {
+				got := r.PathValue(name)
+				if got != want {
+					t.Errorf("%q, %q: got %q, want %q", test.pattern, name, got, want)
+				}
+			}
+		})
+		r, err := NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mux.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+func TestServeMuxConflictPanics(t *testing.T) {
+	setParallel(t)
+	for _, test := range [][2]string{
+		{"/a/{x}", "/a/{y}"},
+		{"/a/{x}", "/{y}/b"},
+		{"GET /", "/index.html"},
+		{"/items/", "/items/{rest...}"},
+	} {
+		mux := NewServeMux()
+		mux.Handle(test[0], serve(200))
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %q after %q did not panic", test[1], test[0])
+				}
+			}()
+			mux.Handle(test[1], serve(200))
+		}()
+	}
+}
+
 var serveMuxTests2 = []struct {
 	method  string
 	host    string
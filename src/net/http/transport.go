@@ -281,6 +281,18 @@ type Transport struct {
 	// To use a custom dialer or TLS config and still attempt HTTP/2
 	// upgrades, set this to true.
 	ForceAttemptHTTP2 bool
+
+	// EnableHTTP3 enables HTTP/3 for https requests to origins
+	// which advertise it. When a response received over HTTP/1.1
+	// or HTTP/2 includes an Alt-Svc header offering HTTP/3
+	// ("h3"), later requests to the same origin are sent over
+	// HTTP/3, falling back to TCP if an HTTP/3 connection cannot
+	// be established.
+	//
+	// HTTP/3 is not used for requests sent through a proxy.
+	EnableHTTP3 bool
+
+	h3 h3Transport // HTTP/3 state, used when EnableHTTP3 is set
 }
 
 // A cancelKey is the key of the reqCanceler map.
@@ -326,6 +338,7 @@ func (t *Transport) Clone() *Transport {
 		GetProxyConnectHeader:  t.GetProxyConnectHeader,
 		MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
 		ForceAttemptHTTP2:      t.ForceAttemptHTTP2,
+		EnableHTTP3:            t.EnableHTTP3,
 		WriteBufferSize:        t.WriteBufferSize,
 		ReadBufferSize:         t.ReadBufferSize,
 	}
@@ -535,8 +548,21 @@ func (t *Transport) roundTrip(req *Request) (*Response, error) {
 	cancelKey := cancelKey{origReq}
 	req = setupRewindBody(req)
 
+	if t.EnableHTTP3 && isHTTP {
+		if resp, used, err := t.h3RoundTrip(req); used {
+			if err != nil {
+				return nil, err
+			}
+			resp.Request = origReq
+			return resp, nil
+		}
+	}
+
 	if altRT := t.alternateRoundTripper(req); altRT != nil {
 		if resp, err := altRT.RoundTrip(req); err != ErrSkipAltProtocol {
+			if err == nil && t.EnableHTTP3 {
+				t.h3.noteAltSvc(req, resp)
+			}
 			return resp, err
 		}
 		var err error
@@ -595,6 +621,9 @@ func (t *Transport) roundTrip(req *Request) (*Response, error) {
 		}
 		if err == nil {
 			resp.Request = origReq
+			if t.EnableHTTP3 {
+				t.h3.noteAltSvc(req, resp)
+			}
 			return resp, nil
 		}
 
@@ -773,6 +802,7 @@ func (t *Transport) CloseIdleConnections() {
 	if t2 := t.h2transport; t2 != nil {
 		t2.CloseIdleConnections()
 	}
+	t.h3.closeIdleConns()
 }
 
 // CancelRequest cancels an in-flight request by closing its connection.
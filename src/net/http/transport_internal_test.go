@@ -13,8 +13,10 @@ import (
 	"io"
 	"net"
 	"net/http/internal/testcert"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Issue 15446: incorrect wrapping of errors when server closes an idle connection.
@@ -260,3 +262,40 @@ func TestTransportBodyAltRewind(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestParseAltSvc(t *testing.T) {
+	for _, test := range []struct {
+		v     string
+		alts  []altSvc
+		clear bool
+	}{
+		{v: "clear", clear: true},
+		{v: " clear ", clear: true},
+		{v: `h3=":443"`, alts: []altSvc{
+			{proto: "h3", port: "443", maxAge: altSvcDefaultMaxAge},
+		}},
+		{v: `h3="alt.example.com:8443"; ma=60; persist=1, h2=":443"`, alts: []altSvc{
+			{proto: "h3", host: "alt.example.com", port: "8443", maxAge: 60 * time.Second},
+			{proto: "h2", port: "443", maxAge: altSvcDefaultMaxAge},
+		}},
+		{v: `w%3Dx%3Ay=":80"; ma="10"`, alts: []altSvc{
+			{proto: "w=x:y", port: "80", maxAge: 10 * time.Second},
+		}},
+		{v: `h3="[::1]:443"`, alts: []altSvc{
+			{proto: "h3", host: "::1", port: "443", maxAge: altSvcDefaultMaxAge},
+		}},
+		// A quoted comma does not separate alternatives.
+		{v: `x="a,b", h3=":443"`, alts: []altSvc{
+			{proto: "h3", port: "443", maxAge: altSvcDefaultMaxAge},
+		}},
+		// Malformed alternatives are skipped.
+		{v: `h3, h3=":0", h3=":65536", h3="noport", h3=":443"; ma=-1`, alts: []altSvc{
+			{proto: "h3", port: "443", maxAge: altSvcDefaultMaxAge},
+		}},
+	} {
+		alts, clear := parseAltSvc(test.v)
+		if !reflect.DeepEqual(alts, test.alts) || clear != test.clear {
+			t.Errorf("parseAltSvc(%q) = %+v, %v; want %+v, %v", test.v, alts, clear, test.alts, test.clear)
+		}
+	}
+}
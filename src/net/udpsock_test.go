@@ -10,6 +10,7 @@ package net
 import (
 	"errors"
 	"internal/testenv"
+	"net/netip"
 	"os"
 	"reflect"
 	"runtime"
@@ -495,3 +496,103 @@ func BenchmarkWriteToReadFromUDP(b *testing.B) {
 		}
 	}
 }
+
+func TestUDPAddrPortRoundTrip(t *testing.T) {
+	c, err := ListenUDP("udp4", &UDPAddr{IP: IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ap := c.LocalAddr().(*UDPAddr).AddrPort()
+	if !ap.Addr().Is4() || ap.Addr() != netip.AddrFrom4([4]byte{127, 0, 0, 1}) {
+		t.Fatalf("LocalAddr().AddrPort() = %v; want 127.0.0.1:port", ap)
+	}
+
+	wb := []byte("HELLO")
+	if _, err := c.WriteToUDPAddrPort(wb, ap); err != nil {
+		t.Fatal(err)
+	}
+	rb := make([]byte, 8)
+	n, from, err := c.ReadFromUDPAddrPort(rb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rb[:n]) != string(wb) {
+		t.Errorf("ReadFromUDPAddrPort read %q; want %q", rb[:n], wb)
+	}
+	if from != ap {
+		t.Errorf("ReadFromUDPAddrPort from %v; want %v", from, ap)
+	}
+
+	if _, _, err := c.WriteMsgUDPAddrPort(wb, nil, ap); err != nil {
+		if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+			t.Skipf("WriteMsgUDPAddrPort not supported on %s: %v", runtime.GOOS, err)
+		}
+		t.Fatal(err)
+	}
+	n, _, _, from, err = c.ReadMsgUDPAddrPort(rb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rb[:n]) != string(wb) || from != ap {
+		t.Errorf("ReadMsgUDPAddrPort = %q, %v; want %q, %v", rb[:n], from, wb, ap)
+	}
+
+	if got := UDPAddrFromAddrPort(ap).AddrPort(); got != ap {
+		t.Errorf("UDPAddrFromAddrPort(%v).AddrPort() = %v", ap, got)
+	}
+}
+
+func TestUDPAddrPortAllocs(t *testing.T) {
+	switch runtime.GOOS {
+	case "plan9":
+		t.Skipf("not supported on %s", runtime.GOOS)
+	}
+	if !testableNetwork("udp4") {
+		t.Skip("udp4 is not supported")
+	}
+
+	c, err := ListenUDP("udp4", &UDPAddr{IP: IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ap := c.LocalAddr().(*UDPAddr).AddrPort()
+	buf := make([]byte, 8)
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		_, err := c.WriteToUDPAddrPort(buf, ap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = c.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if got := int(allocs); got != 0 {
+		t.Errorf("WriteToUDPAddrPort/ReadFromUDPAddrPort allocated %d objects", got)
+	}
+}
+
+func BenchmarkWriteToReadFromUDPAddrPort(b *testing.B) {
+	conn, err := ListenUDP("udp4", &UDPAddr{IP: IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	addr := conn.LocalAddr().(*UDPAddr).AddrPort()
+	buf := make([]byte, 8)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := conn.WriteToUDPAddrPort(buf, addr)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, _, err = conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -6,8 +6,10 @@ package debug_test
 
 import (
 	"internal/testenv"
+	"math"
 	"runtime"
 	. "runtime/debug"
+	"runtime/metrics"
 	"testing"
 	"time"
 )
@@ -172,6 +174,58 @@ func TestSetGCPercent(t *testing.T) {
 	}
 }
 
+var setMemoryLimitBallast []byte
+
+func TestSetMemoryLimit(t *testing.T) {
+	// Test that the limit is being set and returned correctly.
+	old := SetMemoryLimit(123 << 20)
+	defer func() {
+		SetMemoryLimit(old)
+		setMemoryLimitBallast = nil
+	}()
+	if got := SetMemoryLimit(-1); got != 123<<20 {
+		t.Errorf("SetMemoryLimit(123<<20); SetMemoryLimit(-1) = %d, want %d", got, 123<<20)
+	}
+	s := []metrics.Sample{{Name: "/gc/gomemlimit:bytes"}}
+	metrics.Read(s)
+	if got := s[0].Value.Uint64(); got != 123<<20 {
+		t.Errorf("/gc/gomemlimit:bytes = %d, want %d", got, 123<<20)
+	}
+	if got := SetMemoryLimit(math.MaxInt64); got != 123<<20 {
+		t.Errorf("SetMemoryLimit(math.MaxInt64) = %d, want %d", got, 123<<20)
+	}
+
+	// Test that the limit caps the heap goal.
+	defer SetGCPercent(SetGCPercent(100))
+	runtime.GC()
+	// Create 64 MB of live heap, so that NextGC is ~128 MB.
+	const baseline = 64 << 20
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	setMemoryLimitBallast = make([]byte, baseline-ms.Alloc)
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	if ms.NextGC < 112<<20 {
+		t.Fatalf("failed to set up baseline heap goal; got %d MB, want ~128 MB", ms.NextGC>>20)
+	}
+	// Limit total memory to 96 MB. NextGC must now be under it.
+	const limit = 96 << 20
+	SetMemoryLimit(limit)
+	runtime.ReadMemStats(&ms)
+	if ms.NextGC >= limit {
+		t.Errorf("NextGC = %d MB with memory limit of %d MB, want less", ms.NextGC>>20, limit>>20)
+	}
+	if ms.NextGC <= baseline {
+		t.Errorf("NextGC = %d MB, want more than the %d MB live heap", ms.NextGC>>20, baseline>>20)
+	}
+	// Remove the limit. NextGC should go back up.
+	SetMemoryLimit(math.MaxInt64)
+	runtime.ReadMemStats(&ms)
+	if ms.NextGC < 112<<20 {
+		t.Errorf("NextGC = %d MB after removing memory limit, want ~128 MB", ms.NextGC>>20)
+	}
+}
+
 func abs64(a int64) int64 {
 	if a < 0 {
 		return -a
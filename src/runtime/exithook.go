@@ -0,0 +1,55 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import _ "unsafe" // for go:linkname
+
+// exitHooks holds the functions to run when the program exits,
+// registered with addExitHook.
+var exitHooks struct {
+	hooks   []exitHook
+	running bool
+}
+
+// An exitHook is a function registered with addExitHook.
+type exitHook struct {
+	f                func()
+	runOnNonZeroExit bool
+}
+
+// addExitHook registers f to be run when the program exits, either by
+// returning from main.main or by calling os.Exit. If runOnNonZeroExit is
+// false, f is not run when os.Exit is called with a non-zero status.
+// Hooks run in the reverse order of their registration. They must not
+// call os.Exit.
+//
+// addExitHook is meant to be called during package initialization,
+// which runs on a single goroutine, so it doesn't need to be locked.
+//
+//go:linkname addExitHook internal/coverage.runtime_addExitHook
+func addExitHook(f func(), runOnNonZeroExit bool) {
+	exitHooks.hooks = append(exitHooks.hooks, exitHook{f: f, runOnNonZeroExit: runOnNonZeroExit})
+}
+
+// runExitHooks runs the registered exit hooks, for a program exiting
+// with the given status.
+func runExitHooks(exitCode int) {
+	if exitHooks.running {
+		throw("internal error: exit hook invoked exit")
+	}
+	if len(exitHooks.hooks) == 0 {
+		return
+	}
+	exitHooks.running = true
+	for i := len(exitHooks.hooks) - 1; i >= 0; i-- {
+		h := exitHooks.hooks[i]
+		if exitCode != 0 && !h.runOnNonZeroExit {
+			continue
+		}
+		h.f()
+	}
+	exitHooks.hooks = nil
+	exitHooks.running = false
+}
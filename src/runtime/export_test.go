@@ -1230,3 +1230,106 @@ func GCTestPointerClass(p unsafe.Pointer) string {
 }
 
 const Raceenabled = raceenabled
+
+type GCCPULimiter struct {
+	limiter gcCPULimiterState
+}
+
+func NewGCCPULimiter(now int64, gomaxprocs int32) *GCCPULimiter {
+	l := new(GCCPULimiter)
+	l.limiter.resetCapacity(now, gomaxprocs)
+	return l
+}
+
+func (l *GCCPULimiter) Fill() uint64 {
+	return l.limiter.bucket.fill
+}
+
+func (l *GCCPULimiter) Capacity() uint64 {
+	return l.limiter.bucket.capacity
+}
+
+func (l *GCCPULimiter) Overflow() uint64 {
+	return l.limiter.overflow
+}
+
+func (l *GCCPULimiter) Limiting() bool {
+	return l.limiter.limiting()
+}
+
+func (l *GCCPULimiter) NeedUpdate(now int64) bool {
+	return l.limiter.needUpdate(now)
+}
+
+func (l *GCCPULimiter) StartGCTransition(enableGC bool, now int64) {
+	l.limiter.startGCTransition(enableGC, now)
+}
+
+func (l *GCCPULimiter) FinishGCTransition(now int64) {
+	l.limiter.finishGCTransition(now)
+}
+
+func (l *GCCPULimiter) Update(now int64) {
+	l.limiter.update(now)
+}
+
+func (l *GCCPULimiter) AddAssistTime(t int64) {
+	l.limiter.addAssistTime(t)
+}
+
+func (l *GCCPULimiter) ResetCapacity(now int64, nprocs int32) {
+	l.limiter.resetCapacity(now, nprocs)
+}
+
+var ParseByteCount = parseByteCount
+
+const (
+	CapacityPerProc          = capacityPerProc
+	GCCPULimiterUpdatePeriod = gcCPULimiterUpdatePeriod
+	GCBackgroundUtilization  = gcBackgroundUtilization
+)
+
+// GCController is a standalone GC pacer for testing how the heap goal
+// and trigger are derived. Its state is set directly rather than through
+// commit, which also updates global sweeper and scavenger state.
+type GCController struct {
+	c gcControllerState
+}
+
+func NewGCController(heapMarked, gcPercentHeapGoal, trigger uint64, memoryLimit int64) *GCController {
+	c := new(GCController)
+	c.c.heapMarked = heapMarked
+	c.c.gcPercentHeapGoal = gcPercentHeapGoal
+	c.c.trigger = trigger
+	c.c.memoryLimit = memoryLimit
+	c.c.updateMemoryLimitGoal()
+	return c
+}
+
+func (c *GCController) SetMemoryLimit(limit int64) {
+	atomic.Storeint64(&c.c.memoryLimit, limit)
+	c.c.updateMemoryLimitGoal()
+}
+
+func (c *GCController) HeapGoal() (goal uint64, limited bool) {
+	return c.c.heapGoalInternal()
+}
+
+func (c *GCController) HeapTrigger() uint64 {
+	return c.c.heapTrigger()
+}
+
+func (c *GCController) EffectiveGrowthRatio() (r float64) {
+	systemstack(func() {
+		lock(&mheap_.lock)
+		r = c.c.effectiveGrowthRatio()
+		unlock(&mheap_.lock)
+	})
+	return
+}
+
+// NonHeapMemory returns the memory mapped and ready for use by the
+// runtime for things other than the heap.
+func NonHeapMemory() uint64 {
+	return nonHeapMemory()
+}
@@ -6,12 +6,14 @@ package runtime_test
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
 	"reflect"
 	"runtime"
 	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -194,6 +196,74 @@ func TestPeriodicGC(t *testing.T) {
 	}
 }
 
+func TestGCMemoryLimit(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("skipping test; memory is never returned to the OS on wasm")
+	}
+	const limit = 32 << 20
+	// With GC off, only the memory limit triggers collections.
+	got := runTestProg(t, "testprog", "GCMemoryLimit", "GOGC=off", "GOMEMLIMIT=32MiB")
+	peak, err := strconv.ParseUint(strings.TrimSpace(got), 10, 64)
+	if err != nil {
+		t.Fatalf("unexpected output %q", got)
+	}
+	// The testprog allocated 1 GiB in total. Allow some slack
+	// for memory the runtime only accounts for after the fact.
+	if peak > limit+limit/10 {
+		t.Errorf("peak memory use of %d bytes exceeds the limit of %d bytes", peak, limit)
+	}
+	t.Logf("peak memory use: %d bytes", peak)
+}
+
+func TestGCControllerMemoryLimit(t *testing.T) {
+	const (
+		marked  = 64 << 20
+		goal    = 128 << 20
+		trigger = 112 << 20
+	)
+	c := runtime.NewGCController(marked, goal, trigger, math.MaxInt64)
+	check := func(wantGoal, wantTrigger uint64) {
+		t.Helper()
+		gotGoal, limited := c.HeapGoal()
+		if limited || gotGoal != wantGoal {
+			t.Errorf("heap goal = %d (limited %t), want %d from GOGC", gotGoal, limited, wantGoal)
+		}
+		if got := c.HeapTrigger(); got != wantTrigger {
+			t.Errorf("trigger = %d, want %d", got, wantTrigger)
+		}
+	}
+	check(goal, trigger)
+
+	// The goal and trigger follow a change to the memory limit.
+	c.SetMemoryLimit(int64(runtime.NonHeapMemory() + 100<<20))
+	gotGoal, limited := c.HeapGoal()
+	if !limited || gotGoal > 100<<20 || gotGoal <= marked {
+		t.Errorf("heap goal = %d (limited %t), want limited goal in (%d, %d]", gotGoal, limited, marked, 100<<20)
+	}
+	if got := c.HeapTrigger(); got <= marked || got >= gotGoal {
+		t.Errorf("trigger = %d, want in (%d, %d)", got, marked, gotGoal)
+	}
+
+	// If non-heap memory alone exceeds the limit, GC continuously.
+	c.SetMemoryLimit(int64(runtime.NonHeapMemory()))
+	gotGoal, limited = c.HeapGoal()
+	if !limited || gotGoal != 0 {
+		t.Errorf("heap goal = %d (limited %t), want limited goal 0", gotGoal, limited)
+	}
+	if got := c.HeapTrigger(); got != 0 {
+		t.Errorf("trigger = %d, want 0", got)
+	}
+
+	// The trigger controller keeps learning from the GOGC goal, even
+	// though the limit has pushed the heap goal below the marked heap.
+	if got, want := c.EffectiveGrowthRatio(), float64(goal-marked)/marked; got != want {
+		t.Errorf("effective growth ratio = %v, want %v", got, want)
+	}
+
+	c.SetMemoryLimit(math.MaxInt64)
+	check(goal, trigger)
+}
+
 func TestGcZombieReporting(t *testing.T) {
 	// This test is somewhat sensitive to how the allocator works.
 	got := runTestProg(t, "testprog", "GCZombie")
@@ -1379,5 +1379,92 @@ func reflectlite_maplen(h *hmap) int {
 	return h.count
 }
 
+//go:linkname maps_clone maps.clone
+func maps_clone(m interface{}) interface{} {
+	e := efaceOf(&m)
+	e.data = unsafe.Pointer(mapclone((*maptype)(unsafe.Pointer(e._type)), (*hmap)(e.data)))
+	return m
+}
+
+// mapclone returns a copy of src.
+// If src is not in the middle of growing, the copy has the same hash seed
+// and number of buckets, so every entry can be copied straight into the
+// corresponding bucket without being hashed again.
+func mapclone(t *maptype, src *hmap) *hmap {
+	if raceenabled && src != nil {
+		callerpc := getcallerpc()
+		racereadpc(unsafe.Pointer(src), callerpc, abi.FuncPCABIInternal(mapclone))
+	}
+	if src == nil || src.count == 0 {
+		return makemap(t, 0, nil)
+	}
+	if src.flags&hashWriting != 0 {
+		throw("concurrent map clone and map write")
+	}
+
+	if src.oldbuckets != nil {
+		// Entries are spread over the old and new bucket arrays.
+		// Let the iterator find them and insert them one at a time.
+		dst := makemap(t, src.count, nil)
+		var it hiter
+		for mapiterinit(t, src, &it); it.key != nil; mapiternext(&it) {
+			p := mapassign(t, dst, it.key)
+			typedmemmove(t.elem, p, it.elem)
+		}
+		return dst
+	}
+
+	dst := new(hmap)
+	dst.hash0 = src.hash0
+	dst.B = src.B
+	var nextOverflow *bmap
+	dst.buckets, nextOverflow = makeBucketArray(t, dst.B, nil)
+	if nextOverflow != nil {
+		dst.extra = new(mapextra)
+		dst.extra.nextOverflow = nextOverflow
+	}
+
+	for i := uintptr(0); i < bucketShift(src.B); i++ {
+		to := (*bmap)(add(dst.buckets, i*uintptr(t.bucketsize)))
+		n := 0
+		for b := (*bmap)(add(src.buckets, i*uintptr(t.bucketsize))); b != nil; b = b.overflow(t) {
+			for j := uintptr(0); j < bucketCnt; j++ {
+				top := b.tophash[j]
+				if isEmpty(top) {
+					continue
+				}
+				if n == bucketCnt {
+					to = dst.newoverflow(t, to)
+					n = 0
+				}
+				to.tophash[n] = top
+
+				k := add(unsafe.Pointer(b), dataOffset+j*uintptr(t.keysize))
+				dk := add(unsafe.Pointer(to), dataOffset+uintptr(n)*uintptr(t.keysize))
+				if t.indirectkey() {
+					kmem := newobject(t.key)
+					typedmemmove(t.key, kmem, *(*unsafe.Pointer)(k))
+					*(*unsafe.Pointer)(dk) = kmem
+				} else {
+					typedmemmove(t.key, dk, k)
+				}
+
+				e := add(unsafe.Pointer(b), dataOffset+bucketCnt*uintptr(t.keysize)+j*uintptr(t.elemsize))
+				de := add(unsafe.Pointer(to), dataOffset+bucketCnt*uintptr(t.keysize)+uintptr(n)*uintptr(t.elemsize))
+				if t.indirectelem() {
+					emem := newobject(t.elem)
+					typedmemmove(t.elem, emem, *(*unsafe.Pointer)(e))
+					*(*unsafe.Pointer)(de) = emem
+				} else {
+					typedmemmove(t.elem, de, e)
+				}
+				n++
+				dst.count++
+			}
+		}
+	}
+	return dst
+}
+
 const maxZero = 1024 // must match value in reflect/value.go:maxZero cmd/compile/internal/gc/walk.go:zeroValSize
 var zeroVal [maxZero]byte
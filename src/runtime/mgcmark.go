@@ -439,6 +439,15 @@ retry:
 		}
 	}
 
+	if gcCPULimiter.limiting() {
+		// If the CPU limiter is enabled, intentionally don't
+		// assist to reduce the amount of CPU time spent in the GC.
+		if traced {
+			traceGCMarkAssistDone()
+		}
+		return
+	}
+
 	if trace.enabled && !traced {
 		traced = true
 		traceGCMarkAssistStart()
@@ -569,6 +578,7 @@ func gcAssistAlloc1(gp *g, scanWork int64) {
 	_p_.gcAssistTime += duration
 	if _p_.gcAssistTime > gcAssistTimeSlack {
 		atomic.Xaddint64(&gcController.assistTime, _p_.gcAssistTime)
+		gcCPULimiter.addAssistTime(_p_.gcAssistTime)
 		_p_.gcAssistTime = 0
 	}
 }
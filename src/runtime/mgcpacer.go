@@ -47,6 +47,16 @@ const (
 
 	// defaultHeapMinimum is the value of heapMinimum for GOGC==100.
 	defaultHeapMinimum = 4 << 20
+
+	// memoryLimitHeapGoalHeadroom is the fraction of the memory limit
+	// left unused by the heap goal derived from the memory limit. It
+	// absorbs fragmentation and memory allocated during the GC cycle
+	// that the heap goal does not account for.
+	memoryLimitHeapGoalHeadroom = 0.03
+
+	// retainedMemoryLimitPercent is the percent of the memory limit
+	// that the scavenger tries to keep total memory use under.
+	retainedMemoryLimitPercent = 95
 )
 
 func init() {
@@ -54,6 +64,10 @@ func init() {
 		println(offset)
 		throw("gcController.heapLive not aligned to 8 bytes")
 	}
+	if offset := unsafe.Offsetof(gcController.memoryLimit); offset%8 != 0 {
+		println(offset)
+		throw("gcController.memoryLimit not aligned to 8 bytes")
+	}
 }
 
 // gcController implements the GC pacing controller that determines
@@ -69,7 +83,10 @@ func init() {
 //
 // All fields of gcController are used only during a single mark
 // cycle.
-var gcController gcControllerState
+//
+// memoryLimit and memoryLimitGoal are statically initialized so that
+// the heap may grow without limit before gcinit reads $GOMEMLIMIT.
+var gcController = gcControllerState{memoryLimit: maxInt64, memoryLimitGoal: ^uint64(0)}
 
 type gcControllerState struct {
 	// Initialized from $GOGC. GOGC=off means no GC.
@@ -91,6 +108,17 @@ type gcControllerState struct {
 	// debugging.
 	heapMinimum uint64
 
+	// memoryLimit is the soft memory limit in bytes.
+	//
+	// Initialized from $GOMEMLIMIT. maxInt64 means no limit.
+	//
+	// The heap goal is capped such that the total memory mapped and
+	// ready for use by the runtime stays under this limit, and the
+	// scavenger returns memory to the OS to stay under it.
+	//
+	// Read and written atomically. Written with mheap_.lock held.
+	memoryLimit int64
+
 	// triggerRatio is the heap growth ratio that triggers marking.
 	//
 	// E.g., if this is 0.6, then GC should start when the live
@@ -102,9 +130,11 @@ type gcControllerState struct {
 	// Protected by mheap_.lock or a STW.
 	triggerRatio float64
 
-	// trigger is the heap size that triggers marking.
+	// trigger is the heap size that triggers marking, derived from
+	// triggerRatio. heapTrigger lowers it further as needed to leave
+	// room before a heap goal derived from the memory limit.
 	//
-	// When heapLive ≥ trigger, the mark phase will start.
+	// When heapLive ≥ heapTrigger(), the mark phase will start.
 	// This is also the heap size by which proportional sweeping
 	// must be complete.
 	//
@@ -114,11 +144,22 @@ type gcControllerState struct {
 	// Protected by mheap_.lock or a STW.
 	trigger uint64
 
-	// heapGoal is the goal heapLive for when next GC ends.
-	// Set to ^uint64(0) if disabled.
+	// gcPercentHeapGoal is the goal heapLive for when next GC ends,
+	// derived from gcPercent. Set to ^uint64(0) if disabled.
+	//
+	// The heap goal the pacer works toward, returned by heapGoal, is
+	// the lower of this and memoryLimitGoal.
 	//
 	// Read and written atomically, unless the world is stopped.
-	heapGoal uint64
+	gcPercentHeapGoal uint64
+
+	// memoryLimitGoal is the goal heapLive implied by the memory limit,
+	// or ^uint64(0) if there is no limit. It depends on non-heap memory,
+	// which changes without the pacer knowing about it, so it is
+	// recomputed at the start of each cycle as well as by commit.
+	//
+	// Read atomically. Written with mheap_.lock held or the world stopped.
+	memoryLimitGoal uint64
 
 	// lastHeapGoal is the value of heapGoal for the previous GC.
 	// Note that this is distinct from the last value heapGoal had,
@@ -256,8 +297,9 @@ type gcControllerState struct {
 	_ cpu.CacheLinePad
 }
 
-func (c *gcControllerState) init(gcPercent int32) {
+func (c *gcControllerState) init(gcPercent int32, memoryLimit int64) {
 	c.heapMinimum = defaultHeapMinimum
+	atomic.Storeint64(&c.memoryLimit, memoryLimit)
 
 	// Set a reasonable initial GC trigger.
 	c.triggerRatio = 7 / 8.0
@@ -282,6 +324,10 @@ func (c *gcControllerState) startCycle() {
 	c.fractionalMarkTime = 0
 	c.idleMarkTime = 0
 
+	// Account for any change in non-heap memory since the goal
+	// derived from the memory limit was last computed.
+	c.updateMemoryLimitGoal()
+
 	// Ensure that the heap goal is at least a little larger than
 	// the current live heap size. This may not be the case if GC
 	// start is delayed or if the allocation that pushed gcController.heapLive
@@ -289,8 +335,12 @@ func (c *gcControllerState) startCycle() {
 	// GOGC. Assist is proportional to this distance, so enforce a
 	// minimum distance, even if it means going over the GOGC goal
 	// by a tiny bit.
-	if c.heapGoal < c.heapLive+1024*1024 {
-		c.heapGoal = c.heapLive + 1024*1024
+	//
+	// A heap goal derived from the memory limit is not raised: there
+	// is no room above it, so revise paces assists as hard as it can
+	// instead, and the GC CPU limiter bounds their cost.
+	if c.gcPercentHeapGoal < c.heapLive+1024*1024 {
+		c.gcPercentHeapGoal = c.heapLive + 1024*1024
 	}
 
 	// Compute the background mark utilization goal. In general,
@@ -337,7 +387,7 @@ func (c *gcControllerState) startCycle() {
 		print("pacer: assist ratio=", assistRatio,
 			" (scan ", gcController.heapScan>>20, " MB in ",
 			work.initialHeapLive>>20, "->",
-			c.heapGoal>>20, " MB)",
+			c.heapGoal()>>20, " MB)",
 			" workers=", c.dedicatedMarkWorkersNeeded,
 			"+", c.fractionalUtilizationGoal, "\n")
 	}
@@ -345,7 +395,7 @@ func (c *gcControllerState) startCycle() {
 
 // revise updates the assist ratio during the GC cycle to account for
 // improved estimates. This should be called whenever gcController.heapScan,
-// gcController.heapLive, or gcController.heapGoal is updated. It is safe to
+// gcController.heapLive, or the heap goal is updated. It is safe to
 // call concurrently, but it may race with other calls to revise.
 //
 // The result of this race is that the two assist ratio values may not line
@@ -377,7 +427,8 @@ func (c *gcControllerState) revise() {
 
 	// Assume we're under the soft goal. Pace GC to complete at
 	// heapGoal assuming the heap is in steady-state.
-	heapGoal := int64(atomic.Load64(&c.heapGoal))
+	goal, limited := c.heapGoalInternal()
+	heapGoal := int64(goal)
 
 	// Compute the expected scan work remaining.
 	//
@@ -394,8 +445,13 @@ func (c *gcControllerState) revise() {
 		// We're past the soft goal, or we've already done more scan
 		// work than we expected. Pace GC so that in the worst case it
 		// will complete by the hard goal.
-		const maxOvershoot = 1.1
-		heapGoal = int64(float64(heapGoal) * maxOvershoot)
+		//
+		// If the goal is derived from the memory limit, there is no
+		// room to overshoot it, so the hard goal is the goal itself.
+		if !limited {
+			const maxOvershoot = 1.1
+			heapGoal = int64(float64(heapGoal) * maxOvershoot)
+		}
 
 		// Compute the upper bound on the scan work remaining.
 		scanWorkExpected = int64(scan)
@@ -643,7 +699,7 @@ func (c *gcControllerState) findRunnableGCWorker(_p_ *p) *g {
 // This can be called any time. If GC is the in the middle of a
 // concurrent phase, it will adjust the pacing of that phase.
 //
-// This depends on gcPercent, gcController.heapMarked, and
+// This depends on gcPercent, memoryLimit, gcController.heapMarked, and
 // gcController.heapLive. These must be up to date.
 //
 // mheap_.lock must be held or the world must be stopped.
@@ -719,7 +775,7 @@ func (c *gcControllerState) commit(triggerRatio float64) {
 			trigger = minTrigger
 		}
 		if int64(trigger) < 0 {
-			print("runtime: heapGoal=", c.heapGoal, " heapMarked=", c.heapMarked, " gcController.heapLive=", c.heapLive, " initialHeapLive=", work.initialHeapLive, "triggerRatio=", triggerRatio, " minTrigger=", minTrigger, "\n")
+			print("runtime: heapGoal=", goal, " heapMarked=", c.heapMarked, " gcController.heapLive=", c.heapLive, " initialHeapLive=", work.initialHeapLive, "triggerRatio=", triggerRatio, " minTrigger=", minTrigger, "\n")
 			throw("trigger underflow")
 		}
 		if trigger > goal {
@@ -732,7 +788,8 @@ func (c *gcControllerState) commit(triggerRatio float64) {
 
 	// Commit to the trigger and goal.
 	c.trigger = trigger
-	atomic.Store64(&c.heapGoal, goal)
+	atomic.Store64(&c.gcPercentHeapGoal, goal)
+	c.updateMemoryLimitGoal()
 	if trace.enabled {
 		traceHeapGoal()
 	}
@@ -752,7 +809,7 @@ func (c *gcControllerState) commit(triggerRatio float64) {
 		// per byte allocated, accounting for the fact that
 		// some might already be swept.
 		heapLiveBasis := atomic.Load64(&c.heapLive)
-		heapDistance := int64(trigger) - int64(heapLiveBasis)
+		heapDistance := int64(c.heapTrigger()) - int64(heapLiveBasis)
 		// Add a little margin so rounding errors and
 		// concurrent sweep are less likely to leave pages
 		// unswept when GC starts.
@@ -779,24 +836,93 @@ func (c *gcControllerState) commit(triggerRatio float64) {
 	gcPaceScavenger()
 }
 
+// heapGoal returns the goal heapLive for when the next GC ends: the
+// goal derived from gcPercent, or the goal derived from the memory
+// limit if that is lower. It returns ^uint64(0) if neither applies.
+func (c *gcControllerState) heapGoal() uint64 {
+	goal, _ := c.heapGoalInternal()
+	return goal
+}
+
+// heapGoalInternal is the implementation of heapGoal which also
+// reports whether the goal was derived from the memory limit.
+func (c *gcControllerState) heapGoalInternal() (goal uint64, limited bool) {
+	goal = atomic.Load64(&c.gcPercentHeapGoal)
+	if limitGoal := atomic.Load64(&c.memoryLimitGoal); limitGoal < goal {
+		return limitGoal, true
+	}
+	return goal, false
+}
+
+// heapTrigger returns the heap size that triggers marking.
+//
+// If the heap goal is derived from the memory limit, the trigger is
+// lowered to leave the cycle some runway before that goal, as commit
+// does for the gcPercent goal. If the live heap already exceeds the
+// goal, the GC runs continuously; the GC CPU limiter bounds the cost
+// of doing so.
+func (c *gcControllerState) heapTrigger() uint64 {
+	trigger := c.trigger
+	goal, limited := c.heapGoalInternal()
+	if !limited {
+		return trigger
+	}
+	maxTrigger := goal
+	if goal > c.heapMarked {
+		maxTrigger = c.heapMarked + uint64(0.95*float64(goal-c.heapMarked))
+	}
+	if trigger > maxTrigger {
+		trigger = maxTrigger
+	}
+	return trigger
+}
+
+// updateMemoryLimitGoal recomputes memoryLimitGoal, the heap goal
+// implied by the memory limit.
+//
+// It assumes memory the runtime uses for things other than the heap
+// stays the same through the next cycle, and leaves the rest of the
+// limit, less some headroom, to the heap. If non-heap memory alone
+// exceeds the limit, the goal is 0.
+//
+// mheap_.lock must be held or the world must be stopped.
+func (c *gcControllerState) updateMemoryLimitGoal() {
+	limit := atomic.Loadint64(&c.memoryLimit)
+	goal := ^uint64(0)
+	if limit != maxInt64 {
+		nonHeap := nonHeapMemory()
+		headroom := uint64(float64(limit) * memoryLimitHeapGoalHeadroom)
+		if uint64(limit) <= nonHeap+headroom {
+			goal = 0
+		} else {
+			goal = uint64(limit) - nonHeap - headroom
+		}
+	}
+	atomic.Store64(&c.memoryLimitGoal, goal)
+}
+
 // effectiveGrowthRatio returns the current effective heap growth
 // ratio (GOGC/100) based on heapMarked from the previous GC and
-// heapGoal for the current GC.
+// the gcPercent-derived heap goal for the current GC.
 //
 // This may differ from gcPercent/100 because of various upper and
 // lower bounds on gcPercent. For example, if the heap is smaller than
 // heapMinimum, this can be higher than gcPercent/100.
 //
+// The goal derived from the memory limit is deliberately not used:
+// the trigger controller learns a trigger ratio relative to GOGC, and
+// heapTrigger lowers the trigger separately when the limit binds.
+//
 // mheap_.lock must be held or the world must be stopped.
 func (c *gcControllerState) effectiveGrowthRatio() float64 {
 	assertWorldStoppedOrLockHeld(&mheap_.lock)
 
-	egogc := float64(atomic.Load64(&c.heapGoal)-c.heapMarked) / float64(c.heapMarked)
-	if egogc < 0 {
+	goal := atomic.Load64(&c.gcPercentHeapGoal)
+	if goal <= c.heapMarked {
 		// Shouldn't happen, but just in case.
-		egogc = 0
+		return 0
 	}
-	return egogc
+	return float64(goal-c.heapMarked) / float64(c.heapMarked)
 }
 
 // setGCPercent updates gcPercent and all related pacer state.
@@ -811,7 +937,13 @@ func (c *gcControllerState) setGCPercent(in int32) int32 {
 		in = -1
 	}
 	c.gcPercent = in
-	c.heapMinimum = defaultHeapMinimum * uint64(c.gcPercent) / 100
+	if c.gcPercent >= 0 {
+		c.heapMinimum = defaultHeapMinimum * uint64(c.gcPercent) / 100
+	} else {
+		// GC is only triggered by the memory limit, if at all,
+		// so the minimum heap size doesn't apply.
+		c.heapMinimum = defaultHeapMinimum
+	}
 	// Update pacing in response to gcPercent change.
 	c.commit(c.triggerRatio)
 
@@ -836,6 +968,40 @@ func setGCPercent(in int32) (out int32) {
 	return out
 }
 
+// setMemoryLimit updates memoryLimit and all related pacer state.
+// Returns the old value of memoryLimit. A negative input does not
+// change the limit.
+//
+// The world must be stopped, or mheap_.lock must be held.
+func (c *gcControllerState) setMemoryLimit(in int64) int64 {
+	assertWorldStoppedOrLockHeld(&mheap_.lock)
+
+	out := atomic.Loadint64(&c.memoryLimit)
+	if in < 0 {
+		return out
+	}
+	atomic.Storeint64(&c.memoryLimit, in)
+	// Update pacing in response to the memory limit change.
+	c.commit(c.triggerRatio)
+
+	return out
+}
+
+//go:linkname setMemoryLimit runtime/debug.setMemoryLimit
+func setMemoryLimit(in int64) (out int64) {
+	// Run on the system stack since we grab the heap lock.
+	systemstack(func() {
+		lock(&mheap_.lock)
+		out = gcController.setMemoryLimit(in)
+		unlock(&mheap_.lock)
+	})
+	if in >= 0 {
+		// The scavenger may have more work to do now.
+		wakeScavenger()
+	}
+	return out
+}
+
 func readGOGC() int32 {
 	p := gogetenv("GOGC")
 	if p == "off" {
@@ -846,3 +1012,18 @@ func readGOGC() int32 {
 	}
 	return 100
 }
+
+// readGOMEMLIMIT reads the memory limit from $GOMEMLIMIT.
+// "off" and the empty string mean no limit.
+func readGOMEMLIMIT() int64 {
+	p := gogetenv("GOMEMLIMIT")
+	if p == "" || p == "off" {
+		return maxInt64
+	}
+	n, ok := parseByteCount(p)
+	if !ok {
+		print("GOMEMLIMIT=", p, "\n")
+		throw("malformed GOMEMLIMIT; see `go doc runtime/debug.SetMemoryLimit`")
+	}
+	return n
+}
@@ -41,6 +41,11 @@
 // that there's more unscavenged memory to allocate out of, since each allocation
 // out of scavenged memory incurs a potentially expensive page fault.
 //
+// If a memory limit is set, the goal is additionally capped so that the total
+// memory mapped and ready for use by the runtime (see mappedReady) stays under
+// retainedMemoryLimitPercent of the limit. The allocator also scavenges eagerly
+// when paging in scavenged memory would push total memory over the limit.
+//
 // The goal is updated after each GC and the scavenger's pacing parameters
 // (which live in mheap_) are updated to match. The pacing parameters work much
 // like the background sweeping parameters. The parameters define a line whose
@@ -108,32 +113,55 @@ func heapRetained() uint64 {
 // its rate and RSS goal.
 //
 // The RSS goal is based on the current heap goal with a small overhead
-// to accommodate non-determinism in the allocator.
+// to accommodate non-determinism in the allocator. If a memory limit
+// is set, the goal is also capped so that total memory use stays under
+// retainedMemoryLimitPercent of the limit.
 //
 // The pacing is based on scavengePageRate, which applies to both regular and
 // huge pages. See that constant for more information.
 //
 // mheap_.lock must be held or the world must be stopped.
 func gcPaceScavenger() {
-	// If we're called before the first GC completed, disable scavenging.
-	// We never scavenge before the 2nd GC cycle anyway (we don't have enough
-	// information about the heap yet) so this is fine, and avoids a fault
-	// or garbage data later.
-	if gcController.lastHeapGoal == 0 {
+	// Compute our scavenging goal from the memory limit, if any. Unlike
+	// the heap goal, this applies even before the first GC completes.
+	memoryLimitGoal := ^uint64(0)
+	if limit := atomic.Loadint64(&gcController.memoryLimit); limit != maxInt64 {
+		// The scavenger can only return heap memory, so subtract
+		// everything else from the goal for total memory use.
+		goal := uint64(limit) / 100 * retainedMemoryLimitPercent
+		if nonHeap := nonHeapMemory(); goal > nonHeap {
+			memoryLimitGoal = (goal - nonHeap) &^ (uint64(physPageSize) - 1)
+		} else {
+			memoryLimitGoal = 0
+		}
+	}
+
+	// If we're called before the first GC completed, don't scavenge based
+	// on the heap goal. We never scavenge before the 2nd GC cycle anyway
+	// (we don't have enough information about the heap yet) so this is
+	// fine, and avoids a fault or garbage data later.
+	gcPercentGoal := ^uint64(0)
+	if gcController.lastHeapGoal != 0 {
+		// Compute our scavenging goal.
+		goalRatio := float64(gcController.heapGoal()) / float64(gcController.lastHeapGoal)
+		retainedGoal := uint64(float64(memstats.last_heap_inuse) * goalRatio)
+		// Add retainExtraPercent overhead to retainedGoal. This calculation
+		// looks strange but the purpose is to arrive at an integer division
+		// (e.g. if retainExtraPercent = 12.5, then we get a divisor of 8)
+		// that also avoids the overflow from a multiplication.
+		retainedGoal += retainedGoal / (1.0 / (retainExtraPercent / 100.0))
+		// Align it to a physical page boundary to make the following calculations
+		// a bit more exact.
+		gcPercentGoal = (retainedGoal + uint64(physPageSize) - 1) &^ (uint64(physPageSize) - 1)
+	}
+	retainedGoal := gcPercentGoal
+	if memoryLimitGoal < retainedGoal {
+		retainedGoal = memoryLimitGoal
+	}
+	if retainedGoal == ^uint64(0) {
 		mheap_.scavengeGoal = ^uint64(0)
 		return
 	}
-	// Compute our scavenging goal.
-	goalRatio := float64(atomic.Load64(&gcController.heapGoal)) / float64(gcController.lastHeapGoal)
-	retainedGoal := uint64(float64(memstats.last_heap_inuse) * goalRatio)
-	// Add retainExtraPercent overhead to retainedGoal. This calculation
-	// looks strange but the purpose is to arrive at an integer division
-	// (e.g. if retainExtraPercent = 12.5, then we get a divisor of 8)
-	// that also avoids the overflow from a multiplication.
-	retainedGoal += retainedGoal / (1.0 / (retainExtraPercent / 100.0))
-	// Align it to a physical page boundary to make the following calculations
-	// a bit more exact.
-	retainedGoal = (retainedGoal + uint64(physPageSize) - 1) &^ (uint64(physPageSize) - 1)
 
 	// Represents where we are now in the heap's contribution to RSS in bytes.
 	//
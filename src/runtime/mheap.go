@@ -1192,6 +1192,17 @@ func (h *mheap) allocSpan(npages uintptr, typ spanAllocType, spanclass spanClass
 		s = h.allocMSpanLocked()
 	}
 
+	// If we're about to page in scavenged memory, help the scavenger
+	// keep total memory under the memory limit by returning an equal
+	// amount of free memory elsewhere in the heap. Skip this if the GC
+	// CPU limiter is on, since the application is already struggling
+	// and we'd rather exceed the limit than add more overhead.
+	if limit := atomic.Loadint64(&gcController.memoryLimit); scav != 0 && limit != maxInt64 && !gcCPULimiter.limiting() {
+		if inUse := mappedReady(); uint64(scav)+inUse > uint64(limit) {
+			h.pages.scavenge(uintptr(uint64(scav)+inUse-uint64(limit)), false)
+		}
+	}
+
 	if needPhysPageAlign {
 		allocBase, allocPages := base, npages
 		base = alignUp(allocBase, physPageSize)
@@ -1275,6 +1286,7 @@ HaveSpan:
 	if typ.manual() {
 		// Manually managed memory doesn't count toward heap_sys.
 		memstats.heap_sys.add(-int64(nbytes))
+		atomic.Xadd64(&memstats.manualInUse, int64(nbytes))
 	}
 	// Update consistent stats.
 	stats := memstats.heapStats.acquire()
@@ -1487,6 +1499,7 @@ func (h *mheap) freeSpanLocked(s *mspan, typ spanAllocType) {
 	if typ.manual() {
 		// Manually managed memory doesn't count toward heap_sys, so add it back.
 		memstats.heap_sys.add(int64(nbytes))
+		atomic.Xadd64(&memstats.manualInUse, -int64(nbytes))
 	}
 	// Update consistent stats.
 	stats := memstats.heapStats.acquire()
@@ -36,6 +36,7 @@ type mstats struct {
 	heap_sys      sysMemStat // virtual address space obtained from system for GC'd heap
 	heap_inuse    uint64     // bytes in mSpanInUse spans
 	heap_released uint64     // bytes released to the os
+	manualInUse   uint64     // bytes in manually-managed spans; updated atomically
 
 	// heap_objects is not used by the runtime directly and instead
 	// computed on the fly by updatememstats.
@@ -453,7 +454,7 @@ func readmemstats_m(stats *MemStats) {
 	// at a more granular level in the runtime.
 	stats.GCSys = memstats.gcMiscSys.load() + memstats.gcWorkBufInUse + memstats.gcProgPtrScalarBitsInUse
 	stats.OtherSys = memstats.other_sys.load()
-	stats.NextGC = gcController.heapGoal
+	stats.NextGC = gcController.heapGoal()
 	stats.LastGC = memstats.last_gc_unix
 	stats.PauseTotalNs = memstats.pause_total_ns
 	stats.PauseNs = memstats.pause_ns
@@ -690,6 +691,38 @@ func (s *sysMemStat) add(n int64) {
 	}
 }
 
+// mappedReady returns the total number of bytes of memory mapped by the
+// runtime and in the Ready state, that is, not released back to the
+// OS. This is the quantity the memory limit applies to.
+//
+// It is safe to call concurrently, though the result may be slightly
+// stale.
+func mappedReady() uint64 {
+	return heapRetained() +
+		atomic.Load64(&memstats.manualInUse) +
+		memstats.stacks_sys.load() +
+		memstats.mspan_sys.load() +
+		memstats.mcache_sys.load() +
+		memstats.buckhash_sys.load() +
+		memstats.gcMiscSys.load() +
+		memstats.other_sys.load()
+}
+
+// nonHeapMemory returns the memory mapped and ready for use by the
+// runtime for things other than the heap.
+//
+// mappedReady and heapRetained are read separately, so a concurrent
+// update may make heapRetained briefly exceed mappedReady. In that
+// case it returns 0 rather than wrapping around.
+func nonHeapMemory() uint64 {
+	retained := heapRetained()
+	mapped := mappedReady()
+	if retained >= mapped {
+		return 0
+	}
+	return mapped - retained
+}
+
 // heapStatsDelta contains deltas of various runtime memory statistics
 // that need to be updated together in order for them to be kept
 // consistent with one another.
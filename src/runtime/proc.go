@@ -253,6 +253,7 @@ func main() {
 	}
 	fn := main_main // make an indirect call, as the linker doesn't know the address of the main package when laying down the runtime
 	fn()
+	runExitHooks(0)
 	if raceenabled {
 		racefini()
 	}
@@ -281,10 +282,11 @@ func main() {
 	}
 }
 
-// os_beforeExit is called from os.Exit(0).
+// os_beforeExit is called from os.Exit(exitCode).
 //go:linkname os_beforeExit os.runtime_beforeExit
-func os_beforeExit() {
-	if raceenabled {
+func os_beforeExit(exitCode int) {
+	runExitHooks(exitCode)
+	if exitCode == 0 && raceenabled {
 		racefini()
 	}
 }
@@ -4936,6 +4938,11 @@ func procresize(nprocs int32) *p {
 	}
 	sched.procresizetime = now
 
+	if old != nprocs {
+		// Notify the GC CPU limiter that the number of Ps has changed.
+		gcCPULimiter.resetCapacity(now, nprocs)
+	}
+
 	maskWords := (nprocs + 31) / 32
 
 	// Grow allp if necessary.
@@ -5370,6 +5377,11 @@ func sysmon() {
 			// Kick the scavenger awake if someone requested it.
 			wakeScavenger()
 		}
+		if gcCPULimiter.needUpdate(now) {
+			// Keep the GC CPU limiter current even if no assists
+			// are running to update it.
+			gcCPULimiter.update(now)
+		}
 		// retake P's blocked in syscalls
 		// and preempt long running G's
 		if retake(now) != 0 {
@@ -9,6 +9,7 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
+	"runtime/metrics"
 	"sync/atomic"
 	"time"
 	"unsafe"
@@ -21,6 +22,7 @@ func init() {
 	register("GCPhys", GCPhys)
 	register("DeferLiveness", DeferLiveness)
 	register("GCZombie", GCZombie)
+	register("GCMemoryLimit", GCMemoryLimit)
 }
 
 func GCSys() {
@@ -300,3 +302,25 @@ func GCZombie() {
 	runtime.KeepAlive(keep)
 	runtime.KeepAlive(zombies)
 }
+
+// GCMemoryLimit allocates a lot of short-lived memory and reports
+// the peak total memory use it observed. It is meant to be run with
+// GOGC=off and GOMEMLIMIT set, in which case the memory limit alone
+// must keep memory use in check.
+func GCMemoryLimit() {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	var peak uint64
+	for i := 0; i < 4096; i++ {
+		sink = make([]byte, 256<<10)
+		if i%8 == 0 {
+			metrics.Read(samples)
+			if inUse := samples[0].Value.Uint64() - samples[1].Value.Uint64(); inUse > peak {
+				peak = inUse
+			}
+		}
+	}
+	fmt.Println(peak)
+}
@@ -22,17 +22,17 @@ type InternalExample struct {
 // RunExamples is an internal function but exported because it is cross-package;
 // it is part of the implementation of the "go test" command.
 func RunExamples(matchString func(pat, str string) (bool, error), examples []InternalExample) (ok bool) {
-	_, ok = runExamples(matchString, examples)
+	_, ok = runExamples(matchStringOnly(matchString), examples)
 	return ok
 }
 
-func runExamples(matchString func(pat, str string) (bool, error), examples []InternalExample) (ran, ok bool) {
+func runExamples(deps testDeps, examples []InternalExample) (ran, ok bool) {
 	ok = true
 
 	var eg InternalExample
 
 	for _, eg = range examples {
-		matched, err := matchString(*match, eg.Name)
+		matched, err := deps.MatchString(*match, eg.Name)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "testing: invalid regexp for -test.run: %s\n", err)
 			os.Exit(1)
@@ -43,6 +43,8 @@ func runExamples(matchString func(pat, str string) (bool, error), examples []Int
 		ran = true
 		if !runExample(eg) {
 			ok = false
+		} else {
+			deps.PassTest(eg.Name)
 		}
 	}
 
@@ -132,6 +132,57 @@
 // example function, at least one other function, type, variable, or constant
 // declaration, and no test or benchmark functions.
 //
+// Fuzzing
+//
+// 'go test' and the testing package support fuzzing, a testing technique where
+// a function is called with randomly generated inputs to find bugs not
+// anticipated by unit tests.
+//
+// Functions of the form
+//     func FuzzXxx(*testing.F)
+// are considered fuzz targets.
+//
+// For example:
+//
+//     func FuzzHex(f *testing.F) {
+//         for _, seed := range [][]byte{{}, {0}, {9}, {0xa}, {0xf}, {1, 2, 3, 4}} {
+//             f.Add(seed)
+//         }
+//         f.Fuzz(func(t *testing.T, in []byte) {
+//             enc := hex.EncodeToString(in)
+//             out, err := hex.DecodeString(enc)
+//             if err != nil {
+//                 t.Fatalf("%v: decode: %v", in, err)
+//             }
+//             if !bytes.Equal(in, out) {
+//                 t.Fatalf("%v: not equal after round trip: %v", in, out)
+//             }
+//         })
+//     }
+//
+// A fuzz target must call F.Fuzz exactly once with a fuzz function. The fuzz
+// function's first parameter is a *T, and its remaining parameters are the
+// arguments to be fuzzed. Seed inputs may be registered with F.Add, or stored
+// as files in the directory testdata/fuzz/<Name> (where <Name> is the name of
+// the fuzz target) within the package containing the fuzz target. Seed inputs
+// are optional, but the fuzzing engine may find bugs more efficiently when
+// provided with a set of small seed inputs with good code coverage.
+//
+// When fuzzing is not enabled, the fuzz function is called once for each seed
+// input, as a subtest named after the input, and fuzz targets behave much like
+// regular tests. This is the default behavior of 'go test'.
+//
+// When 'go test' is run with the -fuzz flag, the fuzz target matching the
+// flag's regular expression is fuzzed: the fuzz function is called with
+// inputs generated by repeatedly making random changes to the seed inputs.
+// Packages are built with coverage instrumentation on supported platforms,
+// and the fuzzing engine prefers inputs that expand coverage. Fuzzing runs
+// in several worker processes, so that a crash in one input doesn't end the
+// run. If the fuzz function fails for an input, that input is minimized and
+// written to a file in testdata/fuzz/<Name>, which then serves as a seed
+// input: later runs of 'go test' replay it as a regression test, even
+// without -fuzz.
+//
 // Skipping
 //
 // Tests or benchmarks may be skipped at run time with a call to
@@ -246,6 +297,7 @@ import (
 	"io"
 	"math/rand"
 	"os"
+	"reflect"
 	"runtime"
 	"runtime/debug"
 	"runtime/trace"
@@ -305,8 +357,10 @@ func Init() {
 	parallel = flag.Int("test.parallel", runtime.GOMAXPROCS(0), "run at most `n` tests in parallel")
 	testlog = flag.String("test.testlogfile", "", "write test action log to `file` (for use only by cmd/go)")
 	shuffle = flag.String("test.shuffle", "off", "randomize the execution order of tests and benchmarks")
+	shard = flag.String("test.shard", "", "run only shard `i/n` of the tests, examples, fuzz targets and benchmarks")
 
 	initBenchmarkFlags()
+	initFuzzFlags()
 }
 
 var (
@@ -332,6 +386,7 @@ var (
 	cpuListStr           *string
 	parallel             *int
 	shuffle              *string
+	shard                *string
 	testlog              *string
 
 	haveExamples bool // are there examples?
@@ -1080,6 +1135,12 @@ func (t *T) Parallel() {
 		panic("testing: t.Parallel called after t.Setenv; cannot set environment variables in parallel tests")
 	}
 	t.isParallel = true
+	if t.context.isFuzzing {
+		// T.Parallel has no effect when fuzzing.
+		// Multiple processes may run in parallel, but only one input can run at a
+		// time per process so we can attribute crashes to specific inputs.
+		return
+	}
 
 	// We don't want to include the time we spend waiting for serial tests
 	// in the test duration. Record the elapsed time thus far and reset the
@@ -1327,6 +1388,16 @@ type testContext struct {
 	match    *matcher
 	deadline time.Time
 
+	// deps, if not nil, records each top-level test that passes
+	// in the test log.
+	deps testDeps
+
+	// isFuzzing is true in the context used when generating random inputs
+	// for fuzz targets. isFuzzing is false when running normal tests and
+	// when running fuzz tests as unit tests (without -fuzz or when -fuzz
+	// does not match).
+	isFuzzing bool
+
 	mu sync.Mutex
 
 	// Channel used to signal tests that are ready to be run in parallel.
@@ -1389,7 +1460,18 @@ func (f matchStringOnly) WriteProfileTo(string, io.Writer, int) error { return e
 func (f matchStringOnly) ImportPath() string                          { return "" }
 func (f matchStringOnly) StartTestLog(io.Writer)                      {}
 func (f matchStringOnly) StopTestLog() error                          { return errMain }
+func (f matchStringOnly) PassTest(string)                             {}
 func (f matchStringOnly) SetPanicOnExit0(bool)                        {}
+func (f matchStringOnly) CoordinateFuzzing(time.Duration, int64, time.Duration, int64, int, []corpusEntry, []reflect.Type, string, string) error {
+	return errMain
+}
+func (f matchStringOnly) RunFuzzWorker(func(corpusEntry) error) error { return errMain }
+func (f matchStringOnly) ReadCorpus(string, []reflect.Type) ([]corpusEntry, error) {
+	return nil, errMain
+}
+func (f matchStringOnly) CheckCorpus([]interface{}, []reflect.Type) error { return nil }
+func (f matchStringOnly) ResetCoverage()                                  {}
+func (f matchStringOnly) SnapshotCoverage()                               {}
 
 // Main is an internal function, part of the implementation of the "go test" command.
 // It was exported because it is cross-package and predates "internal" packages.
@@ -1398,15 +1480,16 @@ func (f matchStringOnly) SetPanicOnExit0(bool)                        {}
 // new functionality is added to the testing package.
 // Systems simulating "go test" should be updated to use MainStart.
 func Main(matchString func(pat, str string) (bool, error), tests []InternalTest, benchmarks []InternalBenchmark, examples []InternalExample) {
-	os.Exit(MainStart(matchStringOnly(matchString), tests, benchmarks, examples).Run())
+	os.Exit(MainStart(matchStringOnly(matchString), tests, benchmarks, nil, examples).Run())
 }
 
 // M is a type passed to a TestMain function to run the actual tests.
 type M struct {
-	deps       testDeps
-	tests      []InternalTest
-	benchmarks []InternalBenchmark
-	examples   []InternalExample
+	deps        testDeps
+	tests       []InternalTest
+	benchmarks  []InternalBenchmark
+	fuzzTargets []InternalFuzzTarget
+	examples    []InternalExample
 
 	timer     *time.Timer
 	afterOnce sync.Once
@@ -1430,19 +1513,27 @@ type testDeps interface {
 	StopCPUProfile()
 	StartTestLog(io.Writer)
 	StopTestLog() error
+	PassTest(string)
 	WriteProfileTo(string, io.Writer, int) error
+	CoordinateFuzzing(time.Duration, int64, time.Duration, int64, int, []corpusEntry, []reflect.Type, string, string) error
+	RunFuzzWorker(func(corpusEntry) error) error
+	ReadCorpus(string, []reflect.Type) ([]corpusEntry, error)
+	CheckCorpus([]interface{}, []reflect.Type) error
+	ResetCoverage()
+	SnapshotCoverage()
 }
 
 // MainStart is meant for use by tests generated by 'go test'.
 // It is not meant to be called directly and is not subject to the Go 1 compatibility document.
 // It may change signature from release to release.
-func MainStart(deps testDeps, tests []InternalTest, benchmarks []InternalBenchmark, examples []InternalExample) *M {
+func MainStart(deps testDeps, tests []InternalTest, benchmarks []InternalBenchmark, fuzzTargets []InternalFuzzTarget, examples []InternalExample) *M {
 	Init()
 	return &M{
-		deps:       deps,
-		tests:      tests,
-		benchmarks: benchmarks,
-		examples:   examples,
+		deps:        deps,
+		tests:       tests,
+		benchmarks:  benchmarks,
+		fuzzTargets: fuzzTargets,
+		examples:    examples,
 	}
 }
 
@@ -1470,8 +1561,19 @@ func (m *M) Run() (code int) {
 		return
 	}
 
+	if *shard != "" {
+		i, n, err := parseShard(*shard)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "testing:", err)
+			flag.Usage()
+			m.exitCode = 2
+			return
+		}
+		m.shard(i, n)
+	}
+
 	if len(*matchList) != 0 {
-		listTests(m.deps.MatchString, m.tests, m.benchmarks, m.examples)
+		listTests(m.deps.MatchString, m.tests, m.benchmarks, m.fuzzTargets, m.examples)
 		m.exitCode = 0
 		return
 	}
@@ -1499,25 +1601,93 @@ func (m *M) Run() (code int) {
 
 	m.before()
 	defer m.after()
-	deadline := m.startAlarm()
-	haveExamples = len(m.examples) > 0
-	testRan, testOk := runTests(m.deps.MatchString, m.tests, deadline)
-	exampleRan, exampleOk := runExamples(m.deps.MatchString, m.examples)
-	m.stopAlarm()
-	if !testRan && !exampleRan && *matchBenchmarks == "" {
-		fmt.Fprintln(os.Stderr, "testing: warning: no tests to run")
+
+	// Run tests, examples, and benchmarks unless this is a fuzz worker process.
+	// Workers start after this is done by their parent process, and they should
+	// not repeat this work.
+	if !*isFuzzWorker {
+		deadline := m.startAlarm()
+		haveExamples = len(m.examples) > 0
+		testRan, testOk := runTests(m.deps, m.tests, deadline)
+		fuzzTargetsRan, fuzzTargetsOk := runFuzzTests(m.deps, m.fuzzTargets, deadline)
+		exampleRan, exampleOk := runExamples(m.deps, m.examples)
+		m.stopAlarm()
+		if !testRan && !exampleRan && !fuzzTargetsRan && *matchBenchmarks == "" && *matchFuzz == "" {
+			fmt.Fprintln(os.Stderr, "testing: warning: no tests to run")
+		}
+		if !testOk || !exampleOk || !fuzzTargetsOk || !runBenchmarks(m.deps, m.benchmarks) || race.Errors() > 0 {
+			fmt.Println("FAIL")
+			m.exitCode = 1
+			return
+		}
 	}
-	if !testOk || !exampleOk || !runBenchmarks(m.deps.ImportPath(), m.deps.MatchString, m.benchmarks) || race.Errors() > 0 {
+
+	if !runFuzzing(m.deps, m.fuzzTargets) {
 		fmt.Println("FAIL")
-		m.exitCode = 1
+		if *isFuzzWorker {
+			m.exitCode = fuzzWorkerExitCode
+		} else {
+			m.exitCode = 1
+		}
 		return
 	}
 
-	fmt.Println("PASS")
 	m.exitCode = 0
+	if !*isFuzzWorker {
+		fmt.Println("PASS")
+	}
 	return
 }
 
+// parseShard parses the value of the -test.shard flag, "i/n",
+// which selects the i'th of n shards, counting from 0.
+func parseShard(s string) (i, n int, err error) {
+	slash := strings.Index(s, "/")
+	if slash >= 0 {
+		i, err = strconv.Atoi(s[:slash])
+		if err == nil {
+			n, err = strconv.Atoi(s[slash+1:])
+		}
+	}
+	if slash < 0 || err != nil || i < 0 || i >= n {
+		return 0, 0, fmt.Errorf("-test.shard should be i/n, where 0 <= i < n: %q", s)
+	}
+	return i, n, nil
+}
+
+// shard keeps only the i'th of n shards of the top-level tests, examples,
+// fuzz targets and benchmarks of m. Shard i gets the functions at positions
+// i, i+n, i+2n, and so on of each list, in declaration order, so that the
+// shards are disjoint and roughly equal in size, and every function is in
+// exactly one of them.
+func (m *M) shard(i, n int) {
+	var tests []InternalTest
+	for j, t := range m.tests {
+		if j%n == i {
+			tests = append(tests, t)
+		}
+	}
+	var benchmarks []InternalBenchmark
+	for j, b := range m.benchmarks {
+		if j%n == i {
+			benchmarks = append(benchmarks, b)
+		}
+	}
+	var fuzzTargets []InternalFuzzTarget
+	for j, f := range m.fuzzTargets {
+		if j%n == i {
+			fuzzTargets = append(fuzzTargets, f)
+		}
+	}
+	var examples []InternalExample
+	for j, e := range m.examples {
+		if j%n == i {
+			examples = append(examples, e)
+		}
+	}
+	m.tests, m.benchmarks, m.fuzzTargets, m.examples = tests, benchmarks, fuzzTargets, examples
+}
+
 func (t *T) report() {
 	if t.parent == nil {
 		return
@@ -1533,9 +1703,12 @@ func (t *T) report() {
 			t.flushToParent(t.name, format, "PASS", t.name, dstr)
 		}
 	}
+	if t.level == 1 && t.context.deps != nil && !t.Failed() && !t.Skipped() {
+		t.context.deps.PassTest(t.name)
+	}
 }
 
-func listTests(matchString func(pat, str string) (bool, error), tests []InternalTest, benchmarks []InternalBenchmark, examples []InternalExample) {
+func listTests(matchString func(pat, str string) (bool, error), tests []InternalTest, benchmarks []InternalBenchmark, fuzzTargets []InternalFuzzTarget, examples []InternalExample) {
 	if _, err := matchString(*matchList, "non-empty"); err != nil {
 		fmt.Fprintf(os.Stderr, "testing: invalid regexp in -test.list (%q): %s\n", *matchList, err)
 		os.Exit(1)
@@ -1551,6 +1724,11 @@ func listTests(matchString func(pat, str string) (bool, error), tests []Internal
 			fmt.Println(bench.Name)
 		}
 	}
+	for _, fuzzTarget := range fuzzTargets {
+		if ok, _ := matchString(*matchList, fuzzTarget.Name); ok {
+			fmt.Println(fuzzTarget.Name)
+		}
+	}
 	for _, example := range examples {
 		if ok, _ := matchString(*matchList, example.Name); ok {
 			fmt.Println(example.Name)
@@ -1565,14 +1743,14 @@ func RunTests(matchString func(pat, str string) (bool, error), tests []InternalT
 	if *timeout > 0 {
 		deadline = time.Now().Add(*timeout)
 	}
-	ran, ok := runTests(matchString, tests, deadline)
+	ran, ok := runTests(matchStringOnly(matchString), tests, deadline)
 	if !ran && !haveExamples {
 		fmt.Fprintln(os.Stderr, "testing: warning: no tests to run")
 	}
 	return ok
 }
 
-func runTests(matchString func(pat, str string) (bool, error), tests []InternalTest, deadline time.Time) (ran, ok bool) {
+func runTests(deps testDeps, tests []InternalTest, deadline time.Time) (ran, ok bool) {
 	ok = true
 	for _, procs := range cpuList {
 		runtime.GOMAXPROCS(procs)
@@ -1580,8 +1758,9 @@ func runTests(matchString func(pat, str string) (bool, error), tests []InternalT
 			if shouldFailFast() {
 				break
 			}
-			ctx := newTestContext(*parallel, newMatcher(matchString, *match, "-test.run"))
+			ctx := newTestContext(*parallel, newMatcher(deps.MatchString, *match, "-test.run"))
 			ctx.deadline = deadline
+			ctx.deps = deps
 			t := &T{
 				common: common{
 					signal:  make(chan bool, 1),
@@ -1612,6 +1791,12 @@ func runTests(matchString func(pat, str string) (bool, error), tests []InternalT
 
 // before runs before all testing.
 func (m *M) before() {
+	if *isFuzzWorker {
+		// Profiles and the test log describe the coordinator process. Worker
+		// processes are started with the same flags, so they must not
+		// overwrite those files.
+		return
+	}
 	if *memProfileRate > 0 {
 		runtime.MemProfileRate = *memProfileRate
 	}
@@ -1679,7 +1864,9 @@ func (m *M) before() {
 // after runs after all testing.
 func (m *M) after() {
 	m.afterOnce.Do(func() {
-		m.writeProfiles()
+		if !*isFuzzWorker {
+			m.writeProfiles()
+		}
 	})
 
 	// Restore PanicOnExit0 after every run, because we set it to true before